@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// writeDetailModule writes the module that detail is tested against to a
+// temporary directory, which the caller must remove, and returns the
+// directories of the temporary directory and the module. Packages a and b
+// both declare a provider set named SuperSet.
+func writeDetailModule(t *testing.T) (root string, wd string) {
+	t.Helper()
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = ioutil.TempDir("", "wireplus_detail_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsptest.WriteFiles(t, root, map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+		"m/go.mod": `module example.com/m
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`,
+		"m/a/a.go": `package a
+
+import "github.com/google/wire"
+
+type Config struct{ Name string }
+
+type App struct{ Config *Config }
+
+type Logger struct{}
+
+type Server struct {
+	App    *App
+	Logger *Logger
+}
+
+func NewConfig() *Config { return new(Config) }
+
+//wire:cost heavy
+func NewApp(cfg *Config) *App { return &App{Config: cfg} }
+
+func NewServer(app *App, logger *Logger) *Server { return &Server{App: app, Logger: logger} }
+
+var ConfigSet = wire.NewSet(NewConfig)
+
+var SuperSet = wire.NewSet(ConfigSet, NewApp)
+`,
+		"m/a/wire.go": `//+build wireinject
+
+package a
+
+import "github.com/google/wire"
+
+func initApp(name string) *App {
+	wire.Build(SuperSet)
+	return nil
+}
+
+func initServer() *Server {
+	wire.Build(SuperSet, NewServer)
+	return nil
+}
+`,
+		"m/b/b.go": `package b
+
+import "github.com/google/wire"
+
+type Greeter struct{}
+
+func NewGreeter() *Greeter { return new(Greeter) }
+
+var SuperSet = wire.NewSet(NewGreeter)
+`,
+	})
+	return root, filepath.Join(root, "m")
+}
+
+func TestDetail(t *testing.T) {
+	root, wd := writeDetailModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	tests := []struct {
+		args   []string
+		golden string
+		want   subcommands.ExitStatus
+	}{
+		{[]string{"./a", "SuperSet"}, "detail/set.golden", subcommands.ExitSuccess},
+		{[]string{"./a", "initApp"}, "detail/injector.golden", subcommands.ExitSuccess},
+		{[]string{"./a", "initServer"}, "detail/injector_missing.golden", subcommands.ExitFailure},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if status := (&detailCmd{}).run(ctx, wd, lsptest.ModuleEnv(), &buf, test.args); status != test.want {
+			t.Errorf("detail %q exited with status %d; want %d", test.args, status, test.want)
+		}
+		checkGolden(t, root, test.golden, buf.String())
+	}
+}
+
+func TestDetailNoMatch(t *testing.T) {
+	root, wd := writeDetailModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		// A name declared in more than one package lists the candidates.
+		{
+			[]string{"./...", "SuperSet"},
+			[]string{"SuperSet is ambiguous", `provider set "example.com/m/a".SuperSet`, `provider set "example.com/m/b".SuperSet`},
+		},
+		{[]string{"./...", "NoSuchName"}, []string{"no provider set or injector named NoSuchName found in ./..."}},
+		// The package argument is respected.
+		{[]string{"./b", "initApp"}, []string{"no provider set or injector named initApp found in ./b"}},
+	}
+	for _, test := range tests {
+		var logs bytes.Buffer
+		logging.SetOutput(&logs)
+		var buf bytes.Buffer
+		status := (&detailCmd{}).run(ctx, wd, lsptest.ModuleEnv(), &buf, test.args)
+		logging.SetOutput(os.Stderr)
+		if status != subcommands.ExitFailure {
+			t.Errorf("detail %q exited with status %d; want %d", test.args, status, subcommands.ExitFailure)
+		}
+		if buf.Len() > 0 {
+			t.Errorf("detail %q printed %q; want nothing", test.args, buf.String())
+		}
+		for _, want := range test.want {
+			if !strings.Contains(logs.String(), want) {
+				t.Errorf("detail %q logged:\n%s\nwant it to contain %q", test.args, logs.String(), want)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// syncBuffer is a bytes.Buffer that can be written by gen -watch while the
+// test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestGenWatch(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "wireplus_gen_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const depGo = `package dep
+
+import "github.com/google/wire"
+
+type Message string
+
+func NewMessage() Message { return "hello" }
+
+type Greeter struct{ Message Message }
+
+func NewGreeter() *Greeter { return new(Greeter) }
+
+var Set = wire.NewSet(NewMessage, NewGreeter)
+`
+	lsptest.WriteFiles(t, root, map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+		"app/go.mod": `module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+func initGreeter() *dep.Greeter {
+	wire.Build(dep.Set)
+	return nil
+}
+`,
+		"app/dep/dep.go": depGo,
+	})
+	wd := filepath.Join(root, "app")
+	genPath := filepath.Join(wd, "wire_gen.go")
+
+	var logs syncBuffer
+	logging.SetOutput(&logs)
+	defer logging.SetOutput(os.Stderr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := &genCmd{watch: true, pollInterval: 10 * time.Millisecond, debounce: 20 * time.Millisecond}
+	done := make(chan subcommands.ExitStatus, 1)
+	go func() {
+		done <- cmd.watchAndGenerate(ctx, wd, lsptest.ModuleEnv(), []string{"."}, new(wire.GenerateOptions))
+	}()
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(30 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s; logs:\n%s", desc, logs.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	genContains := func(s string) func() bool {
+		return func() bool {
+			src, err := ioutil.ReadFile(genPath)
+			return err == nil && strings.Contains(string(src), s)
+		}
+	}
+	waitFor("the files to be watched", func() bool { return strings.Contains(logs.String(), "watching") })
+	if !genContains("dep.NewGreeter()")() {
+		t.Fatal("wire_gen.go was not generated before watching")
+	}
+
+	// Changing a provider in a dependency regenerates the injector.
+	lsptest.WriteFiles(t, root, map[string]string{
+		"app/dep/dep.go": strings.Replace(depGo, "func NewGreeter() *Greeter { return new(Greeter) }", "func NewGreeter(m Message) *Greeter { return &Greeter{Message: m} }", 1),
+	})
+	waitFor("wire_gen.go to call NewMessage", genContains("dep.NewMessage()"))
+	waitFor("the regeneration to be logged", func() bool { return strings.Contains(logs.String(), "regenerated example.com/app in") })
+
+	// Writing wire_gen.go does not trigger another generation.
+	time.Sleep(200 * time.Millisecond)
+	if n := strings.Count(logs.String(), "regenerated"); n != 1 {
+		t.Errorf("regenerated %d times after a single change; want 1; logs:\n%s", n, logs.String())
+	}
+
+	// A new file in a watched package is picked up, here the provider that
+	// the set refers to, without which the package does not compile.
+	lsptest.WriteFiles(t, root, map[string]string{
+		"app/dep/dep.go": strings.Replace(strings.Replace(depGo,
+			"func NewGreeter() *Greeter { return new(Greeter) }", "func NewGreeter(n int) *Greeter { return new(Greeter) }", 1),
+			"wire.NewSet(NewMessage, NewGreeter)", "wire.NewSet(NewMessage, NewGreeter, NewCount)", 1),
+	})
+	waitFor("the failed regeneration to be logged", func() bool { return strings.Contains(logs.String(), "failed to regenerate example.com/app") })
+	// The file is created once the files to watch are reloaded.
+	time.Sleep(500 * time.Millisecond)
+	lsptest.WriteFiles(t, root, map[string]string{
+		"app/dep/count.go": "package dep\n\nfunc NewCount() int { return 1 }\n",
+	})
+	waitFor("wire_gen.go to call NewCount", genContains("dep.NewCount()"))
+
+	// The exit status is that of the last generation.
+	lsptest.WriteFiles(t, root, map[string]string{
+		"app/dep/dep.go": strings.Replace(depGo, "func NewGreeter() *Greeter", "func NewGreeter(n int) *Greeter", 1),
+	})
+	waitFor("the failed regeneration to be logged", func() bool { return strings.Count(logs.String(), "failed to regenerate example.com/app") == 2 })
+	cancel()
+	if status := <-done; status != subcommands.ExitFailure {
+		t.Errorf("gen -watch exited with status %d after a failed generation; want %d", status, subcommands.ExitFailure)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	lsptest.WriteFiles(t, root, map[string]string{"app/dep/dep.go": depGo})
+	go func() {
+		done <- cmd.watchAndGenerate(ctx, wd, lsptest.ModuleEnv(), []string{"."}, new(wire.GenerateOptions))
+	}()
+	waitFor("wire_gen.go to be restored", genContains("dep.NewGreeter()\n"))
+	cancel()
+	if status := <-done; status != subcommands.ExitSuccess {
+		t.Errorf("gen -watch exited with status %d after a successful generation; want %d", status, subcommands.ExitSuccess)
+	}
+}
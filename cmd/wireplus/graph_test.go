@@ -0,0 +1,777 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// writeGraphModule writes a module with the injector initApp and the
+// provider set AppSet to a temporary directory, which the caller must
+// remove, and returns the directories of both.
+func writeGraphModule(t *testing.T) (root string, wd string) {
+	t.Helper()
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = ioutil.TempDir("", "wireplus_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsptest.WriteFiles(t, root, map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+		"app/go.mod": `module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`,
+		"app/app.go": `package main
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type App struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewApp(cfg *Config) *App { return new(App) }
+
+var AppSet = wire.NewSet(NewConfig, NewApp)
+
+func main() {}
+`,
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initApp() *App {
+	wire.Build(AppSet)
+	return nil
+}
+`,
+	})
+	return root, filepath.Join(root, "app")
+}
+
+func TestGraphFormats(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	// Each target is graphed with a wire.Build and a wire.NewSet.
+	for _, name := range []string{"initApp", "AppSet"} {
+		tests := []struct {
+			desc  string
+			cmd   graphCmd
+			check func(t *testing.T, out string)
+		}{
+			{
+				desc: "graphviz",
+				cmd:  graphCmd{format: "graphviz"},
+				check: func(t *testing.T, out string) {
+					if !strings.HasPrefix(out, "digraph") || !strings.Contains(out, "NewApp") {
+						t.Errorf("got %q; want a digraph with NewApp", out)
+					}
+				},
+			},
+			{
+				desc:  "cytospace",
+				cmd:   graphCmd{format: "cytospace"},
+				check: checkCytospace(true),
+			},
+			{
+				desc:  "json",
+				cmd:   graphCmd{format: "json"},
+				check: checkJSON(name),
+			},
+			{
+				desc:  "compact",
+				cmd:   graphCmd{format: "cytospace", compact: true},
+				check: checkCytospace(false),
+			},
+		}
+		for _, test := range tests {
+			test := test
+			t.Run(name+"/"+test.desc, func(t *testing.T) {
+				var buf bytes.Buffer
+				if status := test.cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", name}); status != subcommands.ExitSuccess {
+					t.Fatalf("graph exited with status %d; want %d", status, subcommands.ExitSuccess)
+				}
+				test.check(t, buf.String())
+			})
+		}
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, cmd := range []graphCmd{
+			{format: "svg"},
+			{format: "cytospace", browser: true},
+			{format: "graphviz", compact: true},
+			{format: "cytospace", render: "svg"},
+			{format: "json", render: "png"},
+			{format: "graphviz", render: "gif"},
+			{format: "graphviz", cluster: "type"},
+			{format: "graphviz", edgeLabels: "type"},
+			{format: "graphviz", level: "sets"},
+			{format: "graphviz", level: "types"},
+			{format: "graphviz", remote: true},
+			{format: "graphviz", browser: true, remote: true, render: "svg"},
+			{format: "graphviz", browser: true, remote: true, output: "graph.dot"},
+		} {
+			var buf bytes.Buffer
+			if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "initApp"}); status != subcommands.ExitFailure {
+				t.Errorf("graph %+v exited with status %d; want %d", cmd, status, subcommands.ExitFailure)
+			}
+			if buf.Len() > 0 {
+				t.Errorf("graph %+v printed %q; want nothing", cmd, buf.String())
+			}
+		}
+	})
+}
+
+// checkCytospace returns a check that the output is cytoscape JSON with a
+// node for NewApp, indented or on a single line.
+func checkCytospace(indented bool) func(t *testing.T, out string) {
+	return func(t *testing.T, out string) {
+		var elems wire.CytospaceElements
+		if err := json.Unmarshal([]byte(out), &elems); err != nil {
+			t.Fatalf("invalid JSON %q: %v", out, err)
+		}
+		found := false
+		for _, n := range elems.Nodes {
+			found = found || strings.HasPrefix(n.Data.Id, "NewApp#")
+		}
+		if !found {
+			t.Errorf("got %s; want a node for NewApp", out)
+		}
+		if lines := strings.Count(strings.TrimSuffix(out, "\n"), "\n") + 1; (lines > 1) != indented {
+			t.Errorf("got %d lines; want indented = %t", lines, indented)
+		}
+	}
+}
+
+// checkJSON returns a check that the output is the graph of name in the
+// json schema, in which NewApp consumes NewConfig as its first argument,
+// cfg.
+func checkJSON(name string) func(t *testing.T, out string) {
+	return func(t *testing.T, out string) {
+		var g wire.JSONGraph
+		if err := json.Unmarshal([]byte(out), &g); err != nil {
+			t.Fatalf("invalid JSON %q: %v", out, err)
+		}
+		if g.Version != wire.GraphSchemaVersion || g.Name != name || g.Package != "example.com/app" {
+			t.Errorf("got version %d, name %q and package %q; want %d, %q and example.com/app", g.Version, g.Name, g.Package, wire.GraphSchemaVersion, name)
+		}
+		app, config := "NewApp#example.com/app", "NewConfig#example.com/app"
+		found := false
+		for _, n := range g.Nodes {
+			if n.ID == app {
+				found = true
+				if n.Kind != wire.JSONNodeFunction || n.Provider != "NewApp" || n.Position == nil || !n.Root {
+					t.Errorf("got NewApp %+v; want a root function with a position", n)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("got %s; want a node for NewApp", out)
+		}
+		want := wire.JSONEdge{Source: app, Target: config, Role: wire.JSONEdgeArgument, Param: "cfg"}
+		found = false
+		for _, e := range g.Edges {
+			found = found || e == want
+		}
+		if !found {
+			t.Errorf("got edges %+v; want %+v", g.Edges, want)
+		}
+	}
+}
+
+func TestGraphOutput(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	cmd := graphCmd{format: "cytospace", output: "graph.json"}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("graph -output printed %q; want nothing", buf.String())
+	}
+	data, err := ioutil.ReadFile(filepath.Join(wd, "graph.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCytospace(true)(t, string(data))
+}
+
+func TestGraphIncludeExclude(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	cmd := graphCmd{format: "json", exclude: `\.NewConfig$`}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -exclude exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	if out := buf.String(); strings.Contains(out, "NewConfig") || !strings.Contains(out, "NewApp") {
+		t.Errorf("graph -exclude %s printed %s; want NewApp without NewConfig", cmd.exclude, out)
+	}
+
+	for _, cmd := range []graphCmd{
+		{format: "json", include: "("},
+		{format: "json", exclude: "["},
+	} {
+		if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{".", "initApp"}); status != subcommands.ExitFailure {
+			t.Errorf("graph -include %q -exclude %q exited with status %d; want %d", cmd.include, cmd.exclude, status, subcommands.ExitFailure)
+		}
+	}
+}
+
+func TestGraphCollapse(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	// NewConfig is summarized by AppSet, while the root NewApp is drawn.
+	cmd := graphCmd{format: "json", collapse: " example.com/app.AppSet,Unknown"}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -collapse exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var g wire.JSONGraph
+	if err := json.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range g.Nodes {
+		got = append(got, n.Kind+" "+n.ID+" "+n.Set)
+	}
+	want := []string{
+		"collapsed collapsed-AppSet#example.com/app AppSet#example.com/app",
+		"function NewApp#example.com/app AppSet#example.com/app",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("graph -collapse %s drew %q; want %q", cmd.collapse, got, want)
+	}
+}
+
+func TestGraphReverse(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	cmd := graphCmd{format: "json", reverse: true}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "*example.com/app.Config", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -reverse exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var g wire.JSONGraph
+	if err := json.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range g.Nodes {
+		got = append(got, n.ID)
+	}
+	if want := []string{"NewConfig#example.com/app", "NewApp#example.com/app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("graph -reverse drew %q; want %q", got, want)
+	}
+
+	// Without an injector, the provider set AppSet is left out.
+	buf.Reset()
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "*example.com/app.Config"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -reverse exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var all wire.JSONGraphs
+	if err := json.Unmarshal(buf.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Graphs) != 1 || all.Graphs[0].Name != "initApp" {
+		t.Errorf("graph -reverse drew %d graphs; want the graph of initApp", len(all.Graphs))
+	}
+
+	for _, args := range [][]string{{"."}, {".", "*example.com/app.Unknown"}} {
+		buf.Reset()
+		if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, args); status != subcommands.ExitFailure {
+			t.Errorf("graph -reverse %q exited with status %d; want %d", args, status, subcommands.ExitFailure)
+		}
+	}
+}
+
+func TestGraphSets(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	cmd := graphCmd{format: "json", level: "sets"}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -level sets exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var g wire.JSONGraph
+	if err := json.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, n := range g.Nodes {
+		got = append(got, n.Kind+" "+n.ID)
+	}
+	for _, e := range g.Edges {
+		got = append(got, e.Source+" -> "+e.Target)
+	}
+	want := []string{
+		"set AppSet#example.com/app",
+		"injector initApp#example.com/app",
+		"initApp#example.com/app -> AppSet#example.com/app",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("graph -level sets drew %q; want %q", got, want)
+	}
+
+	// The flags drawing providers are rejected.
+	cmd = graphCmd{format: "json", level: "sets", criticalPath: true}
+	buf.Reset()
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitFailure {
+		t.Errorf("graph -level sets -critical-path exited with status %d; want %d", status, subcommands.ExitFailure)
+	}
+}
+
+func TestGraphAll(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	// Without a name, AppSet and initApp are drawn into one document, each
+	// as a compound node holding its own nodes.
+	cmd := graphCmd{format: "cytospace", compact: true}
+	var buf bytes.Buffer
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph without a name exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var elems wire.CytospaceElements
+	if err := json.Unmarshal(buf.Bytes(), &elems); err != nil {
+		t.Fatal(err)
+	}
+	parents := make(map[string]string)
+	for _, n := range elems.Nodes {
+		if n.Data.Parent != nil {
+			parents[n.Data.Id] = *n.Data.Parent
+		}
+	}
+	for _, key := range []string{"AppSet#example.com/app", "initApp#example.com/app"} {
+		id := key + ":NewApp#example.com/app"
+		for id != key {
+			parent, ok := parents[id]
+			if !ok {
+				t.Fatalf("%s is not drawn under %s: %s", id, key, buf.String())
+			}
+			id = parent
+		}
+	}
+
+	// In json, they are listed apart.
+	cmd = graphCmd{format: "json", compact: true}
+	buf.Reset()
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph without a name exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var all wire.JSONGraphs
+	if err := json.Unmarshal(buf.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, g := range all.Graphs {
+		names = append(names, g.Kind+" "+g.Name)
+	}
+	if want := []string{"set AppSet", "injector initApp"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got graphs %q; want %q", names, want)
+	}
+
+	// In graphviz, they are clusters, whose nodes are apart.
+	cmd = graphCmd{format: "graphviz"}
+	buf.Reset()
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph without a name exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	for _, want := range []string{
+		`subgraph "cluster-AppSet#example.com/app"`,
+		`subgraph "cluster-initApp#example.com/app"`,
+		`"AppSet#example.com/app:NewApp#example.com/app"->"AppSet#example.com/app:NewConfig#example.com/app"`,
+		`"initApp#example.com/app:NewApp#example.com/app"->"initApp#example.com/app:NewConfig#example.com/app"`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("graph without a name printed %s; want %s in it", buf.String(), want)
+		}
+	}
+
+	// With -split, a file is written for each of them.
+	out := filepath.Join(root, "graphs")
+	cmd = graphCmd{format: "d2", output: out, split: true}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -split exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	for _, name := range []string{"AppSet", "initApp"} {
+		data, err := ioutil.ReadFile(filepath.Join(out, name+".d2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"NewApp#example.com/app"`) {
+			t.Errorf("%s.d2 does not draw NewApp:\n%s", name, data)
+		}
+	}
+
+	cmd = graphCmd{format: "graphviz", split: true}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{".", "initApp"}); status != subcommands.ExitFailure {
+		t.Errorf("graph -split with a name exited with status %d; want %d", status, subcommands.ExitFailure)
+	}
+}
+
+func TestGraphOutputPath(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"", filepath.Join("/pkg", "initApp.svg")},
+		{"graph.svg", filepath.Join("/wd", "graph.svg")},
+		{filepath.Join("out", "graph.svg"), filepath.Join("/wd", "out", "graph.svg")},
+		{filepath.Join("/tmp", "graph.svg"), filepath.Join("/tmp", "graph.svg")},
+	}
+	for _, test := range tests {
+		if got := graphOutputPath("/wd", test.output, "/pkg", "initApp", "svg"); got != test.want {
+			t.Errorf("graphOutputPath(%q) = %q; want %q", test.output, got, test.want)
+		}
+	}
+}
+
+func TestGraphRender(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake dot command is a shell script")
+	}
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+	// The fake dot command writes its format flag and the graph it reads to
+	// the output file, as in "dot -Tsvg -o file".
+	fakeDot := filepath.Join(root, "fakedot")
+	if err := ioutil.WriteFile(fakeDot, []byte("#!/bin/sh\necho \"$1\" > \"$3\"\ncat >> \"$3\"\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd  graphCmd
+		want string
+	}{
+		// The rendered graph is written next to the package by default.
+		{graphCmd{format: "graphviz", render: "svg", dot: fakeDot}, filepath.Join(wd, "initApp.svg")},
+		{graphCmd{format: "graphviz", render: "png", dot: fakeDot, output: "out.png"}, filepath.Join(wd, "out.png")},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if status := test.cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "initApp"}); status != subcommands.ExitSuccess {
+			t.Fatalf("graph -render %s exited with status %d; want %d", test.cmd.render, status, subcommands.ExitSuccess)
+		}
+		data, err := ioutil.ReadFile(test.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "-T"+test.cmd.render+"\ndigraph") {
+			t.Errorf("%s = %q; want the graph rendered with -T%s", test.want, data, test.cmd.render)
+		}
+	}
+
+	// The layout flags are passed to dot as graph attributes.
+	argsDot := filepath.Join(root, "argsdot")
+	if err := ioutil.WriteFile(argsDot, []byte("#!/bin/sh\necho \"$*\" > \"$3\"\n"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cmd := graphCmd{format: "graphviz", render: "svg", dot: argsDot, output: "layout.svg", rankdir: "LR", size: "10,8!"}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph -rankdir LR -size 10,8! exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(wd, "layout.svg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(data)), "-Tsvg -o "+filepath.Join(wd, "layout.svg")+" -Grankdir=LR -Gsize=10,8!"; got != want {
+		t.Errorf("dot was run with %q; want %q", got, want)
+	}
+
+	// Invalid layout flags, or layout flags without a rendered graph, fail.
+	for _, cmd := range []graphCmd{
+		{format: "graphviz", render: "svg", dot: fakeDot, rankdir: "up"},
+		{format: "graphviz", render: "svg", dot: fakeDot, size: "big"},
+		{format: "graphviz", rankdir: "LR"},
+	} {
+		if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{".", "initApp"}); status != subcommands.ExitFailure {
+			t.Errorf("graph -rankdir %q -size %q -render %q exited with status %d; want %d", cmd.rankdir, cmd.size, cmd.render, status, subcommands.ExitFailure)
+		}
+	}
+
+	// A missing dot command fails before writing anything.
+	cmd = graphCmd{format: "graphviz", render: "svg", dot: filepath.Join(root, "nodot")}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), ioutil.Discard, []string{".", "AppSet"}); status != subcommands.ExitFailure {
+		t.Errorf("graph with a missing dot command exited with status %d; want %d", status, subcommands.ExitFailure)
+	}
+	if _, err := os.Stat(filepath.Join(wd, "AppSet.svg")); !os.IsNotExist(err) {
+		t.Errorf("graph with a missing dot command wrote AppSet.svg")
+	}
+}
+
+func TestEdotorURL(t *testing.T) {
+	got := edotorURL("digraph {\n\ta->\"b c\";\n}")
+	want := "https://edotor.net/?engine=dot#digraph%20%7B%0A%09a-%3E%22b%20c%22%3B%0A%7D"
+	if got != want {
+		t.Errorf("edotorURL(...) = %q; want %q", got, want)
+	}
+}
+
+func TestGraphServe(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newGraphServer(&graphCmd{}, wd, lsptest.ModuleEnv(), []string{"."}, "initApp")
+	if errs := srv.update(ctx); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(page), defaultCytoscapeURL) || !strings.Contains(string(page), "<title>initApp - wireplus graph</title>") {
+		t.Errorf("page = %s; want the page of initApp loading cytoscape.js", page)
+	}
+
+	// The events give the version of the graph once connected, and again
+	// when it is drawn after a change.
+	events, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Body.Close()
+	versions := make(chan string)
+	go func() {
+		r := bufio.NewReader(events.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(versions)
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				versions <- strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}()
+	nextVersion := func() string {
+		select {
+		case v := <-versions:
+			return v
+		case <-time.After(30 * time.Second):
+			t.Fatal("timed out waiting for an event")
+			return ""
+		}
+	}
+	if v := nextVersion(); v != "1" {
+		t.Fatalf("first event has version %s; want 1", v)
+	}
+	checkState := func(version int, wantNode string) {
+		t.Helper()
+		res, err := http.Get(ts.URL + "/graph.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var state struct {
+			Version  int
+			Elements wire.CytospaceElements
+			Errors   []string
+		}
+		if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Version != version || len(state.Errors) > 0 {
+			t.Errorf("graph.json has version %d and errors %q; want version %d without errors", state.Version, state.Errors, version)
+		}
+		for _, n := range state.Elements.Nodes {
+			if strings.Contains(n.Data.Id, wantNode) {
+				return
+			}
+		}
+		t.Errorf("graph.json has nodes %+v; want one for %s", state.Elements.Nodes, wantNode)
+	}
+	checkState(1, "NewApp")
+
+	go srv.watch(ctx, 10*time.Millisecond, 10*time.Millisecond)
+	// Wait for the files to be listed before changing them.
+	time.Sleep(time.Second)
+	app := filepath.Join(wd, "app.go")
+	src, err := ioutil.ReadFile(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = bytes.Replace(src, []byte("func NewApp(cfg *Config) *App"), []byte("type Logger struct{}\n\nfunc NewLogger() *Logger { return new(Logger) }\n\nfunc NewApp(cfg *Config, l *Logger) *App"), 1)
+	src = bytes.Replace(src, []byte("wire.NewSet(NewConfig, NewApp)"), []byte("wire.NewSet(NewConfig, NewLogger, NewApp)"), 1)
+	if err := ioutil.WriteFile(app, src, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if v := nextVersion(); v != "2" {
+		t.Fatalf("event after the change has version %s; want 2", v)
+	}
+	checkState(2, "NewLogger")
+}
+
+func TestGraphServeCytoscapeFile(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	srv := newGraphServer(&graphCmd{}, wd, lsptest.ModuleEnv(), []string{"."}, "initApp")
+	if err := srv.setCytoscape(filepath.Join(root, "missing.js")); err == nil {
+		t.Error("setCytoscape accepted a missing file")
+	}
+	const script = "window.cytoscape = function() {};\n"
+	path := filepath.Join(root, "cytoscape.min.js")
+	if err := ioutil.WriteFile(path, []byte(script), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.setCytoscape(path); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	get := func(path string) string {
+		t.Helper()
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	if page := get("/"); !strings.Contains(page, `<script src="/cytoscape.js">`) {
+		t.Errorf("page = %s; want it to load the local copy of cytoscape.js", page)
+	}
+	if got := get("/cytoscape.js"); got != script {
+		t.Errorf("/cytoscape.js = %q; want %q", got, script)
+	}
+}
+
+func TestGraphDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+	git := func(args ...string) {
+		t.Helper()
+		c := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		c.Dir = root
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	lsptest.WriteFiles(t, wd, map[string]string{
+		"app.go": `package main
+
+import "github.com/google/wire"
+
+type Logger struct{}
+
+type App struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewApp(l *Logger) *App { return new(App) }
+
+var AppSet = wire.NewSet(NewLogger, NewApp)
+
+func main() {}
+`,
+	})
+	git("commit", "-q", "-a", "-m", "replace the config with a logger")
+	// Uncommitted changes are left out.
+	lsptest.WriteFiles(t, wd, map[string]string{"app.go": "package main\n"})
+
+	var buf bytes.Buffer
+	cmd := graphCmd{}
+	if status := cmd.diff(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"-format", "json", "HEAD~1", ".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph diff exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var diff wire.GraphDiff
+	if err := json.Unmarshal(buf.Bytes(), &diff); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	var got []string
+	for _, n := range diff.Nodes {
+		got = append(got, strings.Split(n.Id, "#")[0]+" "+n.Status)
+	}
+	if want := []string{"NewApp rewired", "NewConfig removed", "NewLogger added"}; strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("graph diff nodes = %q; want %q", got, want)
+	}
+
+	buf.Reset()
+	if status := cmd.diff(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"HEAD~1", ".", "initApp"}); status != subcommands.ExitSuccess {
+		t.Fatalf("graph diff exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	if out := buf.String(); !strings.HasPrefix(out, "digraph") || !strings.Contains(out, "color=red") || !strings.Contains(out, "color=green3") {
+		t.Errorf("graph diff printed %s; want a colored graphviz graph", out)
+	}
+
+	// Revisions that are options of git archive or not commits are
+	// rejected.
+	out := filepath.Join(root, "out.tar")
+	for _, rev := range []string{"--output=" + out, "HEAD:app.go", "missing"} {
+		if status := cmd.diff(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"--", rev, ".", "initApp"}); status != subcommands.ExitFailure {
+			t.Errorf("graph diff %s exited with status %d; want %d", rev, status, subcommands.ExitFailure)
+		}
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("graph diff --output=%s wrote the archive", out)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire"
+)
+
+// diff runs graph diff with the given arguments, the flags of the action
+// followed by the revision, package and name, in wd, writing the diff to
+// w.
+func (cmd *graphCmd) diff(ctx context.Context, wd string, env []string, w io.Writer, args []string) subcommands.ExitStatus {
+	fs := flag.NewFlagSet("graph diff", flag.ContinueOnError)
+	format := fs.String("format", "graphviz", "specify the output format (graphviz or json)")
+	output := fs.String("output", "", "write the diff to the given file instead of stdout")
+	fs.StringVar(output, "o", "", "alias for -output")
+	fs.StringVar(&cmd.tags, "tags", cmd.tags, "append build tags to the default wirebuild")
+	if err := fs.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if fs.NArg() != 3 {
+		logging.Errorf("graph diff requires three arguments: revision, package and name")
+		return subcommands.ExitUsageError
+	}
+	if *format != "graphviz" && *format != "json" {
+		logging.Errorf("unknown -format %q; want graphviz or json", *format)
+		return subcommands.ExitFailure
+	}
+	rev, pattern, name := fs.Arg(0), []string{fs.Arg(1)}, fs.Arg(2)
+
+	top, err := gitOutput(ctx, wd, "rev-parse", "--show-toplevel")
+	if err != nil {
+		logging.Errorf("graph diff needs a git repository: %v", err)
+		return subcommands.ExitFailure
+	}
+	top = filepath.FromSlash(top)
+	// The directory of wd in the repository, which the revisions are
+	// loaded from.
+	realWd, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	rel, err := filepath.Rel(top, realWd)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	var graphs [2]string
+	for i, r := range []string{rev, "HEAD"} {
+		data, errs := graphAtRevision(ctx, top, rel, r, env, pattern, name, cmd.tags)
+		if len(errs) > 0 {
+			logErrors(errs)
+			logging.Errorf("graph failed at %s", r)
+			return subcommands.ExitFailure
+		}
+		graphs[i] = data
+	}
+	diff, err := wire.DiffGraphs(graphs[0], graphs[1])
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	var data []byte
+	if *format == "json" {
+		data, err = json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+	} else {
+		data = []byte(diff.Graphviz())
+	}
+	if *output == "" {
+		fmt.Fprintln(w, string(data))
+	} else {
+		path := graphOutputPath(wd, *output, "", name, "")
+		if err := ioutil.WriteFile(path, append(data, '\n'), 0666); err != nil {
+			logging.Errorf("failed to write %s: %v", path, err)
+			return subcommands.ExitFailure
+		}
+		logging.Infof("wrote %s", path)
+	}
+	logging.Infof("%s..HEAD: %d added, %d removed, %d rewired", rev, diff.Count(wire.DiffAdded), diff.Count(wire.DiffRemoved), diff.Count(wire.DiffRewired))
+	return subcommands.ExitSuccess
+}
+
+// graphAtRevision draws the graph named name in the packages matching
+// pattern, relative to the directory rel of the git repository at top, as
+// of the revision rev, in the cytospace format. The files of the revision
+// are extracted to a temporary directory, leaving the working tree and the
+// repository alone.
+func graphAtRevision(ctx context.Context, top string, rel string, rev string, env []string, pattern []string, name string, tags string) (string, []error) {
+	// git archive is given the hash of the commit, so that rev cannot be
+	// taken for one of its options, such as --output or --remote.
+	if strings.HasPrefix(rev, "-") {
+		return "", []error{fmt.Errorf("invalid revision %q", rev)}
+	}
+	commit, err := gitOutput(ctx, top, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", []error{fmt.Errorf("%s is not a commit", rev)}
+	}
+	dir, err := ioutil.TempDir("", "wireplus-diff-")
+	if err != nil {
+		return "", []error{err}
+	}
+	defer os.RemoveAll(dir)
+	c := exec.CommandContext(ctx, "git", "archive", "--format=tar", commit)
+	c.Dir = top
+	var stdout, stderr bytes.Buffer
+	c.Stdout, c.Stderr = &stdout, &stderr
+	if err := c.Run(); err != nil {
+		return "", []error{fmt.Errorf("git archive %s: %v\n%s", rev, err, strings.TrimSpace(stderr.String()))}
+	}
+	if err := extractTar(&stdout, dir); err != nil {
+		return "", []error{fmt.Errorf("failed to extract %s: %v", rev, err)}
+	}
+	data, _, errs := wire.Graph(ctx, filepath.Join(dir, rel), env, pattern, name, tags, "cytospace", false, nil, nil, wire.ClusterBySet, wire.EdgeLabelsNone)
+	return data, errs
+}
+
+// extractTar extracts the directories, regular files and symbolic links of
+// the tar archive r to dir.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(h.Name))
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return fmt.Errorf("%s is outside the archive", h.Name)
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0777)
+		case tar.TypeReg:
+			var f *os.File
+			if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				break
+			}
+			if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(h.Mode)&0777|0600); err == nil {
+				_, err = io.Copy(f, tr)
+				if cerr := f.Close(); err == nil {
+					err = cerr
+				}
+			}
+		case tar.TypeSymlink:
+			err = os.Symlink(h.Linkname, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// gitOutput runs git with args in dir and returns its trimmed output.
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v\n%s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// writeJSONModule writes the module that check -json and show -json are
+// tested against to a temporary directory, which the caller must remove,
+// and returns the directories of the temporary directory and the module.
+// The app package has a warning, the broken package a Wire error and the
+// typeerr package a type error.
+func writeJSONModule(t *testing.T) (root string, wd string) {
+	t.Helper()
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = ioutil.TempDir("", "wireplus_json_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lsptest.WriteFiles(t, root, map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+		"m/go.mod": `module example.com/m
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`,
+		"m/app/app.go": `package app
+
+import "github.com/google/wire"
+
+type Config struct{ Name string }
+
+type App struct{ Config *Config }
+
+func NewConfig() *Config { return new(Config) }
+
+//wire:cost heavy
+func NewApp(cfg *Config) *App { return &App{Config: cfg} }
+
+var ConfigSet = wire.NewSet(NewConfig)
+
+var AppSet = wire.NewSet(wire.Requires(new(*Config)), NewApp)
+
+var FullSet = wire.NewSet(ConfigSet, AppSet, wire.Value("name"))
+`,
+		"m/app/wire.go": `//+build wireinject
+
+package app
+
+import "github.com/google/wire"
+
+func initApp() (NewConfig *App) {
+	wire.Build(FullSet)
+	return nil
+}
+`,
+		"m/broken/wire.go": `//+build wireinject
+
+package broken
+
+import (
+	"example.com/m/app"
+	"github.com/google/wire"
+)
+
+func initApp() *app.App {
+	wire.Build(app.AppSet)
+	return nil
+}
+`,
+		"m/typeerr/typeerr.go": `package typeerr
+
+var Name = undefinedName
+`,
+	})
+	return root, filepath.Join(root, "m")
+}
+
+// checkGolden compares got, with root replaced by $ROOT, to the golden file
+// testdata/name, or updates the file with -update.
+func checkGolden(t *testing.T, root string, name string, got string) {
+	t.Helper()
+	got = strings.Replace(got, root, "$ROOT", -1)
+	path := filepath.Join("testdata", filepath.FromSlash(name))
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(string(want), got); diff != "" {
+		t.Errorf("%s differs (-want +got); run with -update if the change is expected:\n%s", name, diff)
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	root, wd := writeJSONModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	tests := []struct {
+		pattern string
+		golden  string
+		want    subcommands.ExitStatus
+	}{
+		{"./app", "json/check_warning.golden", subcommands.ExitSuccess},
+		{"./broken", "json/check_error.golden", subcommands.ExitFailure},
+		{"./typeerr", "json/check_typeerr.golden", subcommands.ExitFailure},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		cmd := checkCmd{json: true, budgets: "warn"}
+		if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), new(wire.Config), &buf, []string{test.pattern}); status != test.want {
+			t.Errorf("check -json %s exited with status %d; want %d", test.pattern, status, test.want)
+		}
+		checkGolden(t, root, test.golden, buf.String())
+	}
+}
+
+func TestShowJSON(t *testing.T) {
+	root, wd := writeJSONModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	cmd := showCmd{json: true}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"./app"}); status != subcommands.ExitSuccess {
+		t.Fatalf("show -json exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	checkGolden(t, root, "json/show.golden", buf.String())
+
+	// The text output describes the same report.
+	buf.Reset()
+	cmd = showCmd{}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"./app"}); status != subcommands.ExitSuccess {
+		t.Fatalf("show exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	checkGolden(t, root, "json/show.txt.golden", buf.String())
+}
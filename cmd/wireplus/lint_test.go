@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+func TestLint(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	if status := (&lintCmd{}).run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != subcommands.ExitSuccess {
+		t.Fatalf("lint exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("lint printed %q; want nothing", buf.String())
+	}
+
+	lsptest.WriteFiles(t, root, map[string]string{
+		"app/extra.go": `package main
+
+import "github.com/google/wire"
+
+type Extra struct{}
+
+func NewExtra() *Extra { return new(Extra) }
+
+var ExtraSet = wire.NewSet(AppSet, NewExtra)
+`,
+		"app/wire_extra.go": `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initExtraApp() *App {
+	wire.Build(ExtraSet)
+	return nil
+}
+`,
+	})
+	tests := []struct {
+		disable string
+		want    subcommands.ExitStatus
+		output  string
+	}{
+		{"", subcommands.ExitFailure, "unused-provider: provider example.com/app.NewExtra"},
+		{"unused-provider, unused-import", subcommands.ExitSuccess, ""},
+		{"no-such-rule", subcommands.ExitFailure, ""},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		cmd := &lintCmd{disable: test.disable}
+		if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"."}); status != test.want {
+			t.Errorf("lint -disable %q exited with status %d; want %d", test.disable, status, test.want)
+		}
+		if got := buf.String(); (test.output == "") != (got == "") || !strings.Contains(got, test.output) {
+			t.Errorf("lint -disable %q printed %q; want it to contain %q", test.disable, got, test.output)
+		}
+	}
+}
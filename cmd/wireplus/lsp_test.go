@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/taichimaeda/wireplus/internal/wire/lsp"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// TestLSPListen checks that each client connecting over TCP is served by
+// its own server, so that a client exiting does not affect the others.
+func TestLSPListen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	cmd := &lspCmd{opts: lsp.Options{Env: lsptest.ModuleEnv(), DiagnosticsDelay: 200 * time.Millisecond}}
+	go cmd.acceptTCP(ctx, l)
+
+	var conns []net.Conn
+	var clients []*lsptest.Client
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		c := lsptest.NewClient(t, conn, conn)
+		c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+		c.Notify("initialized", struct{}{})
+		conns = append(conns, conn)
+		clients = append(clients, c)
+	}
+	for i, c := range clients {
+		c.Call("shutdown", nil)
+		c.Notify("exit", nil)
+		// The server closes the connection once the client exits.
+		conns[i].SetReadDeadline(time.Now().Add(10 * time.Second))
+		if _, err := ioutil.ReadAll(conns[i]); err != nil {
+			t.Errorf("client %d: connection not closed after exit: %v", i, err)
+		}
+	}
+}
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		hostport string
+		want     string
+		loopback bool
+	}{
+		{":4389", "127.0.0.1:4389", true},
+		{"localhost:4389", "localhost:4389", true},
+		{"[::1]:4389", "[::1]:4389", true},
+		{"0.0.0.0:4389", "0.0.0.0:4389", false},
+		{"example.com:4389", "example.com:4389", false},
+	}
+	for _, test := range tests {
+		got, loopback, err := listenAddr(test.hostport)
+		if err != nil {
+			t.Errorf("listenAddr(%q): %v", test.hostport, err)
+			continue
+		}
+		if got != test.want || loopback != test.loopback {
+			t.Errorf("listenAddr(%q) = %q, %t; want %q, %t", test.hostport, got, loopback, test.want, test.loopback)
+		}
+	}
+	if _, _, err := listenAddr("4389"); err == nil {
+		t.Error("listenAddr(\"4389\") succeeded; want an error for the missing port separator")
+	}
+}
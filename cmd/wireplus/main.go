@@ -18,26 +18,36 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"go/token"
 	"go/types"
+	"io"
 	"io/ioutil"
-	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/pmezard/go-difflib/difflib"
+	"github.com/taichimaeda/wireplus/internal/logging"
 	"github.com/taichimaeda/wireplus/internal/wire"
 	"github.com/taichimaeda/wireplus/internal/wire/lsp"
-	"golang.org/x/tools/go/types/typeutil"
 )
 
 const Version = "v0.1.6"
@@ -53,24 +63,34 @@ func main() {
 	subcommands.Register(&showCmd{}, "")
 	subcommands.Register(&detailCmd{}, "")
 	subcommands.Register(&graphCmd{}, "")
+	subcommands.Register(&exportCmd{}, "")
+	subcommands.Register(&usageCmd{}, "")
+	subcommands.Register(&lintCmd{}, "")
+	subcommands.Register(&fmtCmd{}, "")
 	subcommands.Register(&lspCmd{}, "")
+	subcommands.Register(&debugCmd{}, "")
+	subcommands.Register(&statusCmd{}, "")
+	subcommands.Register(&selftestCmd{}, "")
 
 	// Register a flag to print the version.
 	var version bool
 	flag.CommandLine.BoolVar(&version, "version", false, "print the version and exit")
+	// Register a flag to enable debug output on stderr.
+	var debug bool
+	flag.CommandLine.BoolVar(&debug, "debug", false, "log debug output, including the package loading config and per-phase timings, to stderr")
 
 	// Parse the command-line flags.
 	flag.Parse()
 
-	// Initialize the default logger to log to stderr.
-	log.SetFlags(0)
-	log.SetPrefix("wireplus: ")
-	log.SetOutput(os.Stderr)
+	// The default logger logs to stderr, so that it does not mix with the
+	// output of the subcommands.
+	if debug {
+		logging.SetLevel(logging.LevelDebug)
+	}
 
 	// Print the version and exit if version flag is set.
 	if version {
-		log.SetOutput(os.Stdout)
-		log.Println(Version)
+		fmt.Printf("wireplus: %s\n", Version)
 		os.Exit(int(subcommands.ExitSuccess))
 	}
 
@@ -88,7 +108,14 @@ func main() {
 		"show":     true,
 		"detail":   true,
 		"graph":    true,
+		"export":   true,
+		"usage":    true,
+		"lint":     true,
+		"fmt":      true,
 		"lsp":      true,
+		"debug":    true,
+		"status":   true,
+		"selftest": true,
 	}
 	// Default to running the "gen" command.
 	if args := flag.Args(); len(args) == 0 || !allCmds[args[0]] {
@@ -122,12 +149,66 @@ func newGenerateOptions(headerFile string) (*wire.GenerateOptions, error) {
 	return opts, nil
 }
 
+// sandboxFlags holds the flags that redirect the directories the go
+// command writes to, for use in read-only sandboxes.
+type sandboxFlags struct {
+	gocache string
+	gopath  string
+}
+
+func (sf *sandboxFlags) setFlags(f *flag.FlagSet) {
+	f.StringVar(&sf.gocache, "gocache", "", "set GOCACHE for the go command (defaults to $"+wire.TmpDirEnv+"/gocache if set)")
+	f.StringVar(&sf.gopath, "gopath", "", "set GOPATH for the go command")
+}
+
+// env returns the environment to load packages with, after checking that
+// the build cache is writable.
+func (sf *sandboxFlags) env(ctx context.Context) ([]string, error) {
+	return wire.SandboxEnv(ctx, os.Environ(), sf.gocache, sf.gopath)
+}
+
+// stringsFlag is a flag.Value collecting the values of a flag that can be
+// repeated, each of which may be a comma-separated list.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
+		}
+	}
+	return nil
+}
+
 type genCmd struct {
+	sandboxFlags
 	headerFile     string
 	prefixFileName string
 	tags           string
+	verifyBuild    bool
+	traceSpans     bool
+	emitManifest   bool
+	watch          bool
+	injectors      stringsFlag
+
+	// pollInterval and debounce override defaultPollInterval and
+	// defaultDebounce for -watch if non-zero.
+	pollInterval time.Duration
+	debounce     time.Duration
 }
 
+const (
+	// defaultPollInterval is the interval at which gen -watch checks the
+	// watched files for changes.
+	defaultPollInterval = 250 * time.Millisecond
+	// defaultDebounce is the time gen -watch waits for further changes
+	// after a change before regenerating, so that a burst of changes, such
+	// as saving several files or switching branches, regenerates once.
+	defaultDebounce = 300 * time.Millisecond
+)
+
 func (*genCmd) Name() string { return "gen" }
 func (*genCmd) Synopsis() string {
 	return "generate the wire_gen.go file for each package"
@@ -137,6 +218,29 @@ func (*genCmd) Usage() string {
 
   Given one or more packages, gen creates the wire_gen.go file for each.
 
+  With -verify-build, gen type checks the packages after writing the files
+  and fails if the generated code does not compile. Errors in other files
+  are reported as pre-existing.
+
+  With -trace-spans, injectors whose provider set provides wire.TraceHooks
+  call its Before and After methods around each provider call.
+
+  With -emit-manifest, gen also writes a wire_manifest_gen.go file listing
+  the providers each injector calls, for introspection at run time.
+
+  With -injector, gen only generates the named injector functions, and keeps
+  the implementations of the other injectors of their packages from the
+  existing wire_gen.go files, so that an injector that fails does not block
+  regenerating the others. The flag can be repeated or given a
+  comma-separated list, and gen fails if a name is not an injector of the
+  packages.
+
+  With -watch, gen keeps running after generating the files and regenerates
+  them for the packages affected whenever the Go files of the packages or of
+  their dependencies in the same module change. It logs each regeneration and
+  its errors, and exits on interrupt with a non-zero status if the last
+  generation failed.
+
   If no packages are listed, it defaults to ".".
 `
 }
@@ -144,37 +248,73 @@ func (cmd *genCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.headerFile, "header_file", "", "path to file to insert as a header in wire_gen.go")
 	f.StringVar(&cmd.prefixFileName, "output_file_prefix", "", "string to prepend to output file names.")
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.verifyBuild, "verify-build", false, "verify that the generated code compiles")
+	f.BoolVar(&cmd.traceSpans, "trace-spans", false, "wrap provider calls with wire.TraceHooks if provided")
+	f.BoolVar(&cmd.emitManifest, "emit-manifest", false, "also generate wire_manifest_gen.go describing each injector's providers")
+	f.BoolVar(&cmd.watch, "watch", false, "regenerate when the Go files of the packages or their dependencies change")
+	f.Var(&cmd.injectors, "injector", "only generate the named injectors, keeping the others from the existing output; repeatable or comma-separated")
+	cmd.sandboxFlags.setFlags(f)
 }
 
 func (cmd *genCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
 		return subcommands.ExitFailure
 	}
 	opts, err := newGenerateOptions(cmd.headerFile)
 	if err != nil {
-		log.Println(err)
+		logging.Errorf("%v", err)
 		return subcommands.ExitFailure
 	}
 
 	opts.PrefixOutputFile = cmd.prefixFileName
 	opts.Tags = cmd.tags
+	opts.TraceSpans = cmd.traceSpans
+	opts.EmitManifest = cmd.emitManifest
+	opts.Injectors = cmd.injectors
+
+	env, err := cmd.env(ctx)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	if !cmd.watch {
+		return cmd.generate(ctx, wd, env, packages(f), opts)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return cmd.watchAndGenerate(ctx, wd, env, packages(f), opts)
+}
 
-	outs, errs := wire.Generate(ctx, wd, os.Environ(), packages(f), opts)
+// generate generates and writes the files for the packages matching
+// patterns, logging any errors.
+func (cmd *genCmd) generate(ctx context.Context, wd string, env []string, patterns []string, opts *wire.GenerateOptions) subcommands.ExitStatus {
+	outs, errs := wire.Generate(ctx, wd, env, patterns, opts)
 	if len(errs) > 0 {
 		logErrors(errs)
-		log.Println("generate failed")
+		logging.Errorf("generate failed")
 		return subcommands.ExitFailure
 	}
 	if len(outs) == 0 {
 		return subcommands.ExitSuccess
 	}
 	success := true
+	done := logging.Phase("write")
 	for _, out := range outs {
 		if len(out.Errs) > 0 {
 			logErrors(out.Errs)
-			log.Printf("%s: generate failed\n", out.PkgPath)
+			logging.Errorf("%s: generate failed", out.PkgPath)
 			success = false
 		}
 		if len(out.Content) == 0 {
@@ -182,22 +322,220 @@ func (cmd *genCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interfa
 			continue
 		}
 		if err := out.Commit(); err == nil {
-			log.Printf("%s: wrote %s\n", out.PkgPath, out.OutputPath)
+			logging.Infof("%s: wrote %s", out.PkgPath, out.OutputPath)
+			if len(out.ManifestContent) > 0 {
+				logging.Infof("%s: wrote %s", out.PkgPath, out.ManifestPath)
+			}
 		} else {
-			log.Printf("%s: failed to write %s: %v\n", out.PkgPath, out.OutputPath, err)
+			logging.Errorf("%s: failed to write %s: %v", out.PkgPath, out.OutputPath, err)
 			success = false
 		}
 	}
+	done()
 	if !success {
-		log.Println("at least one generate failure")
+		logging.Errorf("at least one generate failure")
 		return subcommands.ExitFailure
 	}
+	if cmd.verifyBuild {
+		buildErrs, errs := wire.VerifyBuild(ctx, wd, env, cmd.tags, outs)
+		if len(errs) > 0 {
+			logErrors(errs)
+			logging.Errorf("verify build failed")
+			return subcommands.ExitFailure
+		}
+		generated := false
+		for _, err := range buildErrs {
+			logging.Errorf("%v", err)
+			generated = generated || err.Generated
+		}
+		if generated {
+			logging.Errorf("generated code does not compile")
+			return subcommands.ExitFailure
+		}
+	}
 	return subcommands.ExitSuccess
 }
 
+// watchAndGenerate generates the files for the packages matching patterns,
+// then polls the files they depend on, and their directories for new Go
+// files, and regenerates the files of the affected packages once changes
+// settle, until ctx is done. It returns the status of the last generation.
+//
+// The files are polled rather than watched with file system notifications,
+// which would need a dependency that does not support the Go versions this
+// module does.
+func (cmd *genCmd) watchAndGenerate(ctx context.Context, wd string, env []string, patterns []string, opts *wire.GenerateOptions) subcommands.ExitStatus {
+	interval, debounce := cmd.pollInterval, cmd.debounce
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	if debounce == 0 {
+		debounce = defaultDebounce
+	}
+	status := cmd.generate(ctx, wd, env, patterns, opts)
+	files := cmd.watchFiles(ctx, wd, env, patterns, nil)
+	stats := statFiles(files)
+	logging.Infof("watching %d files for changes", len(files))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	changed := make(map[string]bool)
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return status
+		case <-ticker.C:
+		}
+		// A new file has no state yet, so it is seen as changed below.
+		for path, pkgPaths := range newGoFiles(files) {
+			files[path] = pkgPaths
+		}
+		cur := statFiles(files)
+		for path := range files {
+			if cur[path] != stats[path] {
+				changed[path] = true
+				lastChange = time.Now()
+			}
+		}
+		stats = cur
+		if len(changed) == 0 || time.Since(lastChange) < debounce {
+			continue
+		}
+		affected := make(map[string]bool)
+		for path := range changed {
+			for _, pkgPath := range files[path] {
+				affected[pkgPath] = true
+			}
+		}
+		changed = make(map[string]bool)
+		pkgPaths := sortSet(affected)
+		start := time.Now()
+		status = cmd.generate(ctx, wd, env, pkgPaths, opts)
+		if status == subcommands.ExitSuccess {
+			logging.Infof("regenerated %s in %v", strings.Join(pkgPaths, ", "), time.Since(start))
+		} else {
+			logging.Errorf("failed to regenerate %s in %v", strings.Join(pkgPaths, ", "), time.Since(start))
+		}
+		// The changes may have added or removed files or dependencies. Files
+		// changed while generating keep their state from before, and files
+		// created meanwhile have none, so that the next poll picks up the
+		// changes.
+		prev := stats
+		files = cmd.watchFiles(ctx, wd, env, patterns, files)
+		stats = statFiles(files)
+		for path, st := range stats {
+			if prevSt, ok := prev[path]; ok {
+				stats[path] = prevSt
+			} else if !st.modTime.Before(start) {
+				stats[path] = fileStat{}
+			}
+		}
+	}
+}
+
+// watchFiles returns the files to watch for the packages matching patterns,
+// as returned by wire.WatchFiles. If the packages fail to load, e.g. after
+// a syntax error, it logs the errors and returns prev, or if prev is nil,
+// the Go files of the packages in wd and its subdirectories, mapped to
+// patterns.
+func (cmd *genCmd) watchFiles(ctx context.Context, wd string, env []string, patterns []string, prev map[string][]string) map[string][]string {
+	files, errs := wire.WatchFiles(ctx, wd, env, cmd.tags, patterns)
+	if len(errs) == 0 {
+		return files
+	}
+	logErrors(errs)
+	if prev != nil {
+		return prev
+	}
+	files = make(map[string][]string)
+	filepath.Walk(wd, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := fi.Name()
+		if fi.IsDir() {
+			if path != wd && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isWatchedGoFile(name) {
+			files[path] = patterns
+		}
+		return nil
+	})
+	return files
+}
+
+// newGoFiles returns the Go files in the directories of the Go files in
+// files that are not in files yet, such as a provider file just created,
+// mapped to the packages of the other files in their directory.
+func newGoFiles(files map[string][]string) map[string][]string {
+	dirs := make(map[string]map[string]bool)
+	for path, pkgPaths := range files {
+		if !strings.HasSuffix(path, ".go") {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]bool)
+		}
+		for _, pkgPath := range pkgPaths {
+			dirs[dir][pkgPath] = true
+		}
+	}
+	added := make(map[string][]string)
+	for dir, pkgPaths := range dirs {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range fis {
+			path := filepath.Join(dir, fi.Name())
+			if _, ok := files[path]; ok || fi.IsDir() || !isWatchedGoFile(fi.Name()) {
+				continue
+			}
+			added[path] = sortSet(pkgPaths)
+		}
+	}
+	return added
+}
+
+// isWatchedGoFile reports whether the file named name is a Go file that
+// may belong to a package, other than a test or a generated file.
+func isWatchedGoFile(name string) bool {
+	if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		return false
+	}
+	return !strings.HasSuffix(name, "wire_gen.go") && !strings.HasSuffix(name, "wire_manifest_gen.go")
+}
+
+// fileStat is the state of a watched file compared between polls.
+type fileStat struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// statFiles returns the state of each file in files.
+func statFiles(files map[string][]string) map[string]fileStat {
+	stats := make(map[string]fileStat, len(files))
+	for path := range files {
+		if fi, err := os.Stat(path); err == nil {
+			stats[path] = fileStat{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+		} else {
+			stats[path] = fileStat{}
+		}
+	}
+	return stats
+}
+
 type diffCmd struct {
-	headerFile string
-	tags       string
+	sandboxFlags
+	headerFile   string
+	tags         string
+	traceSpans   bool
+	emitManifest bool
 }
 
 func (*diffCmd) Name() string { return "diff" }
@@ -219,6 +557,9 @@ func (*diffCmd) Usage() string {
 func (cmd *diffCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.headerFile, "header_file", "", "path to file to insert as a header in wire_gen.go")
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.traceSpans, "trace-spans", false, "wrap provider calls with wire.TraceHooks if provided")
+	f.BoolVar(&cmd.emitManifest, "emit-manifest", false, "also generate wire_manifest_gen.go describing each injector's providers")
+	cmd.sandboxFlags.setFlags(f)
 }
 func (cmd *diffCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	const (
@@ -227,21 +568,28 @@ func (cmd *diffCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interf
 	)
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
 		return errReturn
 	}
 	opts, err := newGenerateOptions(cmd.headerFile)
 	if err != nil {
-		log.Println(err)
+		logging.Errorf("%v", err)
 		return subcommands.ExitFailure
 	}
 
 	opts.Tags = cmd.tags
+	opts.TraceSpans = cmd.traceSpans
+	opts.EmitManifest = cmd.emitManifest
 
-	outs, errs := wire.Generate(ctx, wd, os.Environ(), packages(f), opts)
+	env, err := cmd.env(ctx)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return errReturn
+	}
+	outs, errs := wire.Generate(ctx, wd, env, packages(f), opts)
 	if len(errs) > 0 {
 		logErrors(errs)
-		log.Println("generate failed")
+		logging.Errorf("generate failed")
 		return errReturn
 	}
 	if len(outs) == 0 {
@@ -252,31 +600,38 @@ func (cmd *diffCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interf
 	for _, out := range outs {
 		if len(out.Errs) > 0 {
 			logErrors(out.Errs)
-			log.Printf("%s: generate failed\n", out.PkgPath)
+			logging.Errorf("%s: generate failed", out.PkgPath)
 			success = false
 		}
 		if len(out.Content) == 0 {
 			// No Wire output. Maybe errors, maybe no Wire directives.
 			continue
 		}
-		// Assumes the current file is empty if we can't read it.
-		cur, _ := ioutil.ReadFile(out.OutputPath)
-		if diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
-			A: difflib.SplitLines(string(cur)),
-			B: difflib.SplitLines(string(out.Content)),
-		}); err == nil {
-			if diff != "" {
-				// Print the actual diff to stdout, not stderr.
-				fmt.Printf("%s: diff from %s:\n%s\n", out.PkgPath, out.OutputPath, diff)
-				hadDiff = true
+		paths, contents := []string{out.OutputPath}, [][]byte{out.Content}
+		if len(out.ManifestContent) > 0 {
+			paths = append(paths, out.ManifestPath)
+			contents = append(contents, out.ManifestContent)
+		}
+		for i, path := range paths {
+			// Assumes the current file is empty if we can't read it.
+			cur, _ := ioutil.ReadFile(path)
+			if diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A: difflib.SplitLines(string(cur)),
+				B: difflib.SplitLines(string(contents[i])),
+			}); err == nil {
+				if diff != "" {
+					// Print the actual diff to stdout, not stderr.
+					fmt.Printf("%s: diff from %s:\n%s\n", out.PkgPath, path, diff)
+					hadDiff = true
+				}
+			} else {
+				logging.Errorf("%s: failed to diff %s: %v", out.PkgPath, path, err)
+				success = false
 			}
-		} else {
-			log.Printf("%s: failed to diff %s: %v\n", out.PkgPath, out.OutputPath, err)
-			success = false
 		}
 	}
 	if !success {
-		log.Println("at least one generate failure")
+		logging.Errorf("at least one generate failure")
 		return errReturn
 	}
 	if hadDiff {
@@ -285,470 +640,1894 @@ func (cmd *diffCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interf
 	return subcommands.ExitSuccess
 }
 
-type showCmd struct {
-	tags string
+type statusCmd struct {
+	sandboxFlags
+	headerFile   string
+	tags         string
+	traceSpans   bool
+	emitManifest bool
 }
 
-func (*showCmd) Name() string { return "show" }
-func (*showCmd) Synopsis() string {
-	return "describe all top-level provider sets"
+func (*statusCmd) Name() string { return "status" }
+func (*statusCmd) Synopsis() string {
+	return "report whether wire_gen.go files are up to date"
 }
-func (*showCmd) Usage() string {
-	return `show [packages]
+func (*statusCmd) Usage() string {
+	return `status [packages]
 
-  Given one or more packages, show finds all the provider sets declared as
-  top-level variables and prints what other provider sets they import and what
-  outputs they can produce, given possible inputs. It also lists any injector
-  functions defined in the package.
+  Given one or more packages, status prints the state of the wire_gen.go file
+  of each package with injectors: up to date, stale, not generated, signature
+  mismatch or error.
+
+  A signature mismatch means that an injector is declared with a signature
+  different from the one of its generated implementation. Unlike a stale file,
+  it may be fixed by restoring the declaration rather than regenerating; the
+  details say which file changed last.
 
   If no packages are listed, it defaults to ".".
+
+  status returns 0 if every file is up to date and 1 otherwise.
 `
 }
-func (cmd *showCmd) SetFlags(f *flag.FlagSet) {
+func (cmd *statusCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.headerFile, "header_file", "", "path to file to insert as a header in wire_gen.go")
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.traceSpans, "trace-spans", false, "wrap provider calls with wire.TraceHooks if provided")
+	f.BoolVar(&cmd.emitManifest, "emit-manifest", false, "also generate wire_manifest_gen.go describing each injector's providers")
+	cmd.sandboxFlags.setFlags(f)
 }
-func (cmd *showCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+func (cmd *statusCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
 		return subcommands.ExitFailure
 	}
-	info, errs := wire.Load(ctx, wd, os.Environ(), cmd.tags, packages(f))
-	if info != nil {
-		keys := make([]wire.ProviderSetID, 0, len(info.Sets))
-		for k := range info.Sets {
-			keys = append(keys, k)
+	opts, err := newGenerateOptions(cmd.headerFile)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	opts.Tags = cmd.tags
+	opts.TraceSpans = cmd.traceSpans
+	opts.EmitManifest = cmd.emitManifest
+	env, err := cmd.env(ctx)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	statuses, errs := wire.Status(ctx, wd, env, packages(f), opts)
+	if len(errs) > 0 {
+		logErrors(errs)
+		logging.Errorf("status failed")
+		return subcommands.ExitFailure
+	}
+	upToDate := true
+	for _, st := range statuses {
+		fmt.Printf("%s: %s\n", st.PkgPath, st.State)
+		for _, m := range st.Mismatches {
+			fmt.Printf("\t%v\n", m)
 		}
-		sort.Slice(keys, func(i, j int) bool {
-			if keys[i].ImportPath == keys[j].ImportPath {
-				return keys[i].VarName < keys[j].VarName
-			}
-			return keys[i].ImportPath < keys[j].ImportPath
-		})
-		for i, k := range keys {
-			if i > 0 {
-				fmt.Println()
-			}
-			outGroups, imports := gather(info, k)
-			fmt.Println(k)
-			for _, imp := range sortSet(imports) {
-				fmt.Printf("\t%s\n", imp)
-			}
-			for i := range outGroups {
-				fmt.Printf("\tOutputs given %s:\n", outGroups[i].name)
-				out := make(map[string]token.Pos, outGroups[i].outputs.Len())
-				outGroups[i].outputs.Iterate(func(t types.Type, v interface{}) {
-					switch v := v.(type) {
-					case *wire.Provider:
-						out[types.TypeString(t, nil)] = v.Pos
-					case *wire.Value:
-						out[types.TypeString(t, nil)] = v.Pos
-					case *wire.Field:
-						out[types.TypeString(t, nil)] = v.Pos
-					default:
-						panic("unreachable")
-					}
-				})
-				for _, t := range sortSet(out) {
-					fmt.Printf("\t\t%s\n", t)
-					fmt.Printf("\t\t\tat %v\n", info.Fset.Position(out[t]))
+		logErrors(st.Errs)
+		if st.State != wire.StatusUpToDate {
+			upToDate = false
+		}
+	}
+	if !upToDate {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+type selftestCmd struct {
+	sandboxFlags
+	update bool
+}
+
+func (*selftestCmd) Name() string { return "selftest" }
+func (*selftestCmd) Synopsis() string {
+	return "run a corpus of example modules and compare their results with the expected ones"
+}
+func (*selftestCmd) Usage() string {
+	return `selftest [-update] [dir]
+
+  Given a directory, selftest runs each example under it and compares the
+  result with the expected one, printing a diff for each mismatch. An example
+  is a directory, usually a module, with a selftest.json manifest:
+
+    {
+      "description": "what the example shows",
+      "command": "gen, check or graph",
+      "package": "the package pattern, . by default",
+      "name": "the injector or provider set to graph",
+      "format": "graphviz (default) or cytospace",
+      "tags": "build tags, as for -tags"
+    }
+
+  and an expected_output.txt file, an expected_wire_gen.go file or both. The
+  output of gen is its errors, and the code it generates is compared with
+  expected_wire_gen.go; the output of check is its errors and warnings, and
+  the output of graph is the graph or its errors. File names in the output
+  are relative to the example.
+
+  With -update, the expected files of failing examples are rewritten with the
+  results instead.
+
+  If no directory is given, it defaults to ".".
+
+  selftest returns 0 if every example passes and 1 otherwise.
+`
+}
+func (cmd *selftestCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&cmd.update, "update", false, "rewrite the expected files of failing examples")
+	cmd.sandboxFlags.setFlags(f)
+}
+func (cmd *selftestCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if f.NArg() > 1 {
+		logging.Errorf("selftest takes at most one argument: the directory of the examples")
+		return subcommands.ExitUsageError
+	}
+	root := "."
+	if f.NArg() == 1 {
+		root = f.Arg(0)
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	env, err := cmd.env(ctx)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	results, errs := wire.SelfTest(ctx, root, env)
+	if len(errs) > 0 {
+		logErrors(errs)
+		logging.Errorf("selftest failed")
+		return subcommands.ExitFailure
+	}
+	failed := 0
+	for _, r := range results {
+		if len(r.Mismatches) == 0 {
+			fmt.Printf("ok   %s\n", r.Dir)
+			continue
+		}
+		if cmd.update {
+			for _, m := range r.Mismatches {
+				if err := ioutil.WriteFile(m.Path, []byte(m.Got), 0666); err != nil {
+					logging.Errorf("failed to update %s: %v", m.Path, err)
+					return subcommands.ExitFailure
 				}
 			}
+			fmt.Printf("upd  %s\n", r.Dir)
+			continue
 		}
-		if len(info.Injectors) > 0 {
-			injectors := append([]*wire.Injector(nil), info.Injectors...)
-			sort.Slice(injectors, func(i, j int) bool {
-				if injectors[i].ImportPath == injectors[j].ImportPath {
-					return injectors[i].FuncName < injectors[j].FuncName
-				}
-				return injectors[i].ImportPath < injectors[j].ImportPath
+		failed++
+		fmt.Printf("FAIL %s\n", r.Dir)
+		for _, m := range r.Mismatches {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+				A:        difflib.SplitLines(m.Want),
+				B:        difflib.SplitLines(m.Got),
+				FromFile: filepath.Base(m.Path),
+				ToFile:   "got",
+				Context:  3,
 			})
-			fmt.Println("\nInjectors:")
-			for _, in := range injectors {
-				fmt.Printf("\t%v\n", in)
+			if err != nil {
+				logging.Errorf("%s: failed to diff %s: %v", r.Dir, m.Path, err)
+				return subcommands.ExitFailure
 			}
+			fmt.Printf("%s\n", diff)
 		}
 	}
-	if len(errs) > 0 {
-		logErrors(errs)
-		log.Println("error loading packages")
+	if failed > 0 {
+		logging.Errorf("%d of %d examples failed", failed, len(results))
 		return subcommands.ExitFailure
 	}
 	return subcommands.ExitSuccess
 }
 
-type checkCmd struct {
+type showCmd struct {
 	tags string
+	json bool
 }
 
-func (*checkCmd) Name() string { return "check" }
-func (*checkCmd) Synopsis() string {
-	return "print any Wire errors found"
+func (*showCmd) Name() string { return "show" }
+func (*showCmd) Synopsis() string {
+	return "describe all top-level provider sets"
 }
-func (*checkCmd) Usage() string {
-	return `check [-tags tag,list] [packages]
+func (*showCmd) Usage() string {
+	return `show [packages]
 
-  Given one or more packages, check prints any type-checking or Wire errors
-  found with top-level variable provider sets or injector functions.
+  Given one or more packages, show finds all the provider sets declared as
+  top-level variables and prints what other provider sets they import, the
+  inputs they declare with wire.Requires, if any, and what outputs they can
+  produce, given possible inputs. It also lists any injector functions defined
+  in the package.
+
+  With -json, show prints an object with the "sets", each with its "id",
+  "imports", "requires" and "outputs" grouped by their "inputs", and the
+  "injectors". Each output has its "type", the "position" of its provider
+  as "file", "line" and "column", and its "cost" if any.
 
   If no packages are listed, it defaults to ".".
 `
 }
-func (cmd *checkCmd) SetFlags(f *flag.FlagSet) {
+func (cmd *showCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.json, "json", false, "output the provider sets and injectors in JSON")
 }
-func (cmd *checkCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+func (cmd *showCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
 		return subcommands.ExitFailure
 	}
-	_, errs := wire.Load(ctx, wd, os.Environ(), cmd.tags, packages(f))
+	return cmd.run(ctx, wd, os.Environ(), os.Stdout, packages(f))
+}
+
+// run runs the command in wd on the packages matching patterns, writing the
+// description to w.
+func (cmd *showCmd) run(ctx context.Context, wd string, env []string, w io.Writer, patterns []string) subcommands.ExitStatus {
+	info, errs := wire.Load(ctx, wd, env, cmd.tags, patterns)
+	if info != nil {
+		report := newShowReport(info)
+		if cmd.json {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				logging.Errorf("%v", err)
+				return subcommands.ExitFailure
+			}
+			fmt.Fprintln(w, string(data))
+		} else {
+			printShowReport(w, report)
+		}
+	}
 	if len(errs) > 0 {
 		logErrors(errs)
-		log.Println("error loading packages")
+		logging.Errorf("error loading packages")
 		return subcommands.ExitFailure
 	}
 	return subcommands.ExitSuccess
 }
 
-type outGroup struct {
-	name    string
-	inputs  *typeutil.Map // values are not important
-	outputs *typeutil.Map // values are *wire.Provider, *wire.Value, or *wire.Field
+// showReport is the output of show -json. Its fields are part of the output
+// format and must stay stable.
+type showReport struct {
+	// Sets lists the top-level provider sets sorted by package and name.
+	Sets []*showSet `json:"sets"`
+	// Injectors lists the injectors as ""path/to/pkg".Name", sorted.
+	Injectors []string `json:"injectors"`
+}
+
+type showSet struct {
+	ID       string             `json:"id"`
+	Imports  []string           `json:"imports"`
+	Requires []string           `json:"requires"`
+	Outputs  []*showOutputGroup `json:"outputs"`
 }
 
-// gather flattens a provider set into outputs grouped by the inputs
-// required to create them. As it flattens the provider set, it records
-// the visited named provider sets as imports.
-func gather(info *wire.Info, key wire.ProviderSetID) (_ []outGroup, imports map[string]struct{}) {
-	set := info.Sets[key]
-	hash := typeutil.MakeHasher()
+// showOutputGroup holds the outputs of a set that need the same inputs.
+type showOutputGroup struct {
+	Inputs  []string      `json:"inputs"`
+	Outputs []*showOutput `json:"outputs"`
+}
 
-	// Find imports.
-	next := []*wire.ProviderSet{info.Sets[key]}
-	visited := make(map[*wire.ProviderSet]struct{})
-	imports = make(map[string]struct{})
-	for len(next) > 0 {
-		curr := next[len(next)-1]
-		next = next[:len(next)-1]
-		if _, found := visited[curr]; found {
-			continue
-		}
-		visited[curr] = struct{}{}
-		if curr.VarName != "" && !(curr.PkgPath == key.ImportPath && curr.VarName == key.VarName) {
-			imports[formatProviderSetName(curr.PkgPath, curr.VarName)] = struct{}{}
-		}
-		next = append(next, curr.Imports...)
-	}
+type showOutput struct {
+	Type     string       `json:"type"`
+	Position showPosition `json:"position"`
+	Cost     string       `json:"cost,omitempty"`
+}
 
-	// Depth-first search to build groups.
-	var groups []outGroup
-	inputVisited := new(typeutil.Map) // values are int, indices into groups or -1 for input.
-	inputVisited.SetHasher(hash)
-	var stk []types.Type
-	for _, k := range set.Outputs() {
-		// Start a DFS by picking a random unvisited node.
-		if inputVisited.At(k) == nil {
-			stk = append(stk, k)
-		}
+type showPosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
 
-		// Run DFS
-	dfs:
-		for len(stk) > 0 {
-			curr := stk[len(stk)-1]
-			stk = stk[:len(stk)-1]
-			if inputVisited.At(curr) != nil {
-				continue
-			}
-			switch pv := set.For(curr); {
-			case pv.IsNil():
-				// This is an input.
-				inputVisited.Set(curr, -1)
-			case pv.IsArg():
-				// This is an injector argument.
-				inputVisited.Set(curr, -1)
-			case pv.IsProvider():
-				// Try to see if any args haven't been visited.
-				p := pv.Provider()
-				allPresent := true
-				for _, arg := range p.Args {
-					if inputVisited.At(arg.Type) == nil {
-						allPresent = false
-					}
-				}
-				if !allPresent {
-					stk = append(stk, curr)
-					for _, arg := range p.Args {
-						if inputVisited.At(arg.Type) == nil {
-							stk = append(stk, arg.Type)
-						}
-					}
-					continue dfs
-				}
+func (p showPosition) String() string {
+	return token.Position{Filename: p.File, Line: p.Line, Column: p.Column}.String()
+}
 
-				// Build up set of input types, match to a group.
-				in := new(typeutil.Map)
-				in.SetHasher(hash)
-				for _, arg := range p.Args {
-					i := inputVisited.At(arg.Type).(int)
-					if i == -1 {
-						in.Set(arg.Type, true)
-					} else {
-						mergeTypeSets(in, groups[i].inputs)
-					}
-				}
-				for i := range groups {
-					if sameTypeKeys(groups[i].inputs, in) {
-						groups[i].outputs.Set(curr, p)
-						inputVisited.Set(curr, i)
-						continue dfs
-					}
-				}
-				out := new(typeutil.Map)
-				out.SetHasher(hash)
-				out.Set(curr, p)
-				inputVisited.Set(curr, len(groups))
-				groups = append(groups, outGroup{
-					inputs:  in,
-					outputs: out,
-				})
-			case pv.IsValue():
-				v := pv.Value()
-				for i := range groups {
-					if groups[i].inputs.Len() == 0 {
-						groups[i].outputs.Set(curr, v)
-						inputVisited.Set(curr, i)
-						continue dfs
-					}
-				}
-				in := new(typeutil.Map)
-				in.SetHasher(hash)
-				out := new(typeutil.Map)
-				out.SetHasher(hash)
-				out.Set(curr, v)
-				inputVisited.Set(curr, len(groups))
-				groups = append(groups, outGroup{
-					inputs:  in,
-					outputs: out,
-				})
-			case pv.IsField():
-				// Try to see if the parent struct hasn't been visited.
-				f := pv.Field()
-				if inputVisited.At(f.Parent) == nil {
-					stk = append(stk, curr, f.Parent)
-					continue
-				}
-				// Build the input map for the parent struct.
-				in := new(typeutil.Map)
-				in.SetHasher(hash)
-				i := inputVisited.At(f.Parent).(int)
-				if i == -1 {
-					in.Set(f.Parent, true)
-				} else {
-					mergeTypeSets(in, groups[i].inputs)
-				}
-				// Group all fields together under the same parent struct.
-				for i := range groups {
-					if sameTypeKeys(groups[i].inputs, in) {
-						groups[i].outputs.Set(curr, f)
-						inputVisited.Set(curr, i)
-						continue dfs
-					}
+// newShowReport describes the provider sets and injectors of info.
+func newShowReport(info *wire.Info) *showReport {
+	report := &showReport{Sets: []*showSet{}, Injectors: []string{}}
+	keys := make([]wire.ProviderSetID, 0, len(info.Sets))
+	for k := range info.Sets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ImportPath == keys[j].ImportPath {
+			return keys[i].VarName < keys[j].VarName
+		}
+		return keys[i].ImportPath < keys[j].ImportPath
+	})
+	for _, k := range keys {
+		outGroups, imports := wire.Gather(info, info.Sets[k], k)
+		set := &showSet{
+			ID:       k.String(),
+			Imports:  sortSet(imports),
+			Requires: []string{},
+			Outputs:  []*showOutputGroup{},
+		}
+		for _, r := range info.Sets[k].Requires {
+			set.Requires = append(set.Requires, types.TypeString(r.Type, nil))
+		}
+		for i := range outGroups {
+			group := &showOutputGroup{Inputs: []string{}}
+			outGroups[i].Inputs.Iterate(func(t types.Type, _ interface{}) {
+				group.Inputs = append(group.Inputs, types.TypeString(t, nil))
+			})
+			sort.Strings(group.Inputs)
+			out := make(map[string]token.Pos, outGroups[i].Outputs.Len())
+			costs := make(map[string]string)
+			outGroups[i].Outputs.Iterate(func(t types.Type, v interface{}) {
+				switch v := v.(type) {
+				case *wire.Provider:
+					out[types.TypeString(t, nil)] = v.Pos
+					costs[types.TypeString(t, nil)] = v.Cost
+				case *wire.Value:
+					out[types.TypeString(t, nil)] = v.Pos
+				case *wire.Field:
+					out[types.TypeString(t, nil)] = v.Pos
+				default:
+					panic("unreachable")
 				}
-				out := new(typeutil.Map)
-				out.SetHasher(hash)
-				out.Set(curr, f)
-				inputVisited.Set(curr, len(groups))
-				groups = append(groups, outGroup{
-					inputs:  in,
-					outputs: out,
+			})
+			for _, t := range sortSet(out) {
+				p := info.Fset.Position(out[t])
+				group.Outputs = append(group.Outputs, &showOutput{
+					Type:     t,
+					Position: showPosition{File: p.Filename, Line: p.Line, Column: p.Column},
+					Cost:     costs[t],
 				})
-			default:
-				panic("unreachable")
 			}
+			set.Outputs = append(set.Outputs, group)
 		}
+		report.Sets = append(report.Sets, set)
 	}
+	for _, in := range info.Injectors {
+		report.Injectors = append(report.Injectors, in.String())
+	}
+	sort.Strings(report.Injectors)
+	return report
+}
 
-	// Name and sort groups.
-	for i := range groups {
-		if groups[i].inputs.Len() == 0 {
-			groups[i].name = "no inputs"
-			continue
+// printShowReport prints report in the format of show to w.
+func printShowReport(w io.Writer, report *showReport) {
+	for i, set := range report.Sets {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, set.ID)
+		for _, imp := range set.Imports {
+			fmt.Fprintf(w, "\t%s\n", imp)
+		}
+		if len(set.Requires) > 0 {
+			fmt.Fprintln(w, "\tRequires:")
+			for _, r := range set.Requires {
+				fmt.Fprintf(w, "\t\t%s\n", r)
+			}
+		}
+		for _, group := range set.Outputs {
+			name := "no inputs"
+			if len(group.Inputs) > 0 {
+				name = strings.Join(group.Inputs, ", ")
+			}
+			fmt.Fprintf(w, "\tOutputs given %s:\n", name)
+			for _, out := range group.Outputs {
+				fmt.Fprintf(w, "\t\t%s\n", out.Type)
+				fmt.Fprintf(w, "\t\t\tat %v\n", out.Position)
+				if out.Cost != "" {
+					fmt.Fprintf(w, "\t\t\tcost %s\n", out.Cost)
+				}
+			}
 		}
-		instr := make([]string, 0, groups[i].inputs.Len())
-		groups[i].inputs.Iterate(func(k types.Type, _ interface{}) {
-			instr = append(instr, types.TypeString(k, nil))
-		})
-		sort.Strings(instr)
-		groups[i].name = strings.Join(instr, ", ")
 	}
-	sort.Slice(groups, func(i, j int) bool {
-		if groups[i].inputs.Len() == groups[j].inputs.Len() {
-			return groups[i].name < groups[j].name
+	if len(report.Injectors) > 0 {
+		fmt.Fprintln(w, "\nInjectors:")
+		for _, in := range report.Injectors {
+			fmt.Fprintf(w, "\t%s\n", in)
 		}
-		return groups[i].inputs.Len() < groups[j].inputs.Len()
-	})
-	return groups, imports
+	}
 }
 
-func mergeTypeSets(dst, src *typeutil.Map) {
-	src.Iterate(func(k types.Type, _ interface{}) {
-		dst.Set(k, true)
-	})
+type checkCmd struct {
+	sandboxFlags
+	tags    string
+	config  string
+	budgets string
+	json    bool
 }
 
-func sameTypeKeys(a, b *typeutil.Map) bool {
-	if a.Len() != b.Len() {
-		return false
-	}
-	same := true
-	a.Iterate(func(k types.Type, _ interface{}) {
-		if b.At(k) == nil {
-			same = false
-		}
-	})
-	return same
+func (*checkCmd) Name() string { return "check" }
+func (*checkCmd) Synopsis() string {
+	return "print any Wire errors found"
+}
+func (*checkCmd) Usage() string {
+	return `check [-tags tag,list] [packages]
+
+  Given one or more packages, check prints any type-checking or Wire errors
+  found with top-level variable provider sets or injector functions.
+
+  check also fails if the signature of an injector differs from the one of
+  its implementation in the file generated by Wire.
+
+  If the config file has a [budgets] section, check also reports injectors
+  exceeding any of maxDepth, maxFanIn, maxFanOut and maxProvidersPerInjector.
+  Budgets absent from the config file are unlimited.
+
+  With -json, check prints the errors and warnings as an array of objects
+  with the fields "pkgPath", "file", "line", "column", "message" and
+  "severity", either "error" or "warning". The package, file, line and
+  column are empty or zero when unknown. The exit status is unchanged.
+
+  If no packages are listed, it defaults to ".".
+`
+}
+func (cmd *checkCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.StringVar(&cmd.config, "config", "", "path to the config file (defaults to "+wire.ConfigFileName+" if present)")
+	f.StringVar(&cmd.budgets, "budgets", "warn", "report budget violations as warnings (warn) or errors (error)")
+	f.BoolVar(&cmd.json, "json", false, "output the errors and warnings in JSON")
+	cmd.sandboxFlags.setFlags(f)
+}
+func (cmd *checkCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
+	}
+	if cmd.budgets != "warn" && cmd.budgets != "error" {
+		logging.Errorf("invalid -budgets value: %s", cmd.budgets)
+		return subcommands.ExitFailure
+	}
+	cfg, err := loadConfig(cmd.config)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	env, err := cmd.env(ctx)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	return cmd.run(ctx, wd, env, cfg, os.Stdout, packages(f))
+}
+
+// run checks the packages matching patterns in wd, writing the diagnostics
+// to w with -json. Otherwise, they are logged.
+func (cmd *checkCmd) run(ctx context.Context, wd string, env []string, cfg *wire.Config, w io.Writer, patterns []string) subcommands.ExitStatus {
+	diags := []checkDiagnostic{}
+	report := func(severity string, errs ...error) {
+		for _, err := range errs {
+			switch {
+			case cmd.json:
+				diags = append(diags, newCheckDiagnostic(wd, severity, err))
+			case severity == "warning":
+				logging.Warnf("%v", err)
+			default:
+				logging.Errorf("%v", err)
+			}
+		}
+	}
+	status := cmd.check(ctx, wd, env, cfg, patterns, report)
+	if cmd.json {
+		data, err := json.MarshalIndent(diags, "", "  ")
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+		fmt.Fprintln(w, string(data))
+	}
+	return status
+}
+
+// check runs the checks, passing the errors and warnings found to report.
+func (cmd *checkCmd) check(ctx context.Context, wd string, env []string, cfg *wire.Config, patterns []string, report func(severity string, errs ...error)) subcommands.ExitStatus {
+	info, errs := wire.Load(ctx, wd, env, cmd.tags, patterns)
+	if len(errs) > 0 {
+		report("error", errs...)
+		logging.Errorf("error loading packages")
+		return subcommands.ExitFailure
+	}
+	report("warning", info.Warnings...)
+	mismatches, errs := wire.CheckSignatures(ctx, wd, env, cmd.tags, patterns)
+	if len(errs) > 0 {
+		report("error", errs...)
+		logging.Errorf("error checking injector signatures")
+		return subcommands.ExitFailure
+	}
+	if len(mismatches) > 0 {
+		for _, m := range mismatches {
+			report("error", m)
+		}
+		logging.Errorf("injector signatures do not match the generated code")
+		return subcommands.ExitFailure
+	}
+	violations, errs := wire.CheckBudgets(ctx, wd, env, cmd.tags, patterns, cfg.Budgets)
+	if len(errs) > 0 {
+		report("error", errs...)
+		logging.Errorf("error checking budgets")
+		return subcommands.ExitFailure
+	}
+	if len(violations) > 0 {
+		if cmd.budgets == "error" {
+			report("error", violations...)
+			logging.Errorf("budgets exceeded")
+			return subcommands.ExitFailure
+		}
+		report("warning", violations...)
+	}
+	return subcommands.ExitSuccess
+}
+
+// checkDiagnostic is an error or warning printed by check -json. Its fields
+// are part of the output format and must stay stable.
+type checkDiagnostic struct {
+	PkgPath  string `json:"pkgPath"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// newCheckDiagnostic returns the diagnostic for err found in wd.
+func newCheckDiagnostic(wd string, severity string, err error) checkDiagnostic {
+	position, msg := wire.ErrorPosition(wd, err)
+	var pkgPath string
+	switch err := err.(type) {
+	case *wire.WireErr:
+		pkgPath = err.PkgPath()
+	case *wire.SignatureMismatch:
+		pkgPath = err.PkgPath
+	}
+	return checkDiagnostic{
+		PkgPath:  pkgPath,
+		File:     position.Filename,
+		Line:     position.Line,
+		Column:   position.Column,
+		Message:  msg,
+		Severity: severity,
+	}
+}
+
+// loadConfig loads the config file at path. If path is empty, it loads
+// the default config file in the working directory if it exists.
+func loadConfig(path string) (*wire.Config, error) {
+	if path == "" {
+		if _, err := os.Stat(wire.ConfigFileName); err != nil {
+			return new(wire.Config), nil
+		}
+		path = wire.ConfigFileName
+	}
+	cfg, err := wire.LoadConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+	return cfg, nil
+}
+
+func sortSet(set interface{}) []string {
+	rv := reflect.ValueOf(set)
+	a := make([]string, 0, rv.Len())
+	keys := rv.MapKeys()
+	for _, k := range keys {
+		a = append(a, k.String())
+	}
+	sort.Strings(a)
+	return a
+}
+
+func formatProviderSetName(importPath, varName string) string {
+	// Since varName is an identifier, it doesn't make sense to quote.
+	return strconv.Quote(importPath) + "." + varName
+}
+
+// formatProviderSet returns the name of set as printed by show and detail.
+// Anonymous sets are printed as their AnonID, which includes the package.
+func formatProviderSet(set *wire.ProviderSet) string {
+	if set.VarName == "" {
+		return set.AnonID
+	}
+	return formatProviderSetName(set.PkgPath, set.VarName)
+}
+
+func logErrors(errs []error) {
+	for _, err := range errs {
+		logging.Errorf("%v", err)
+	}
+}
+
+type detailCmd struct {
+	tags string
+}
+
+func (*detailCmd) Name() string { return "detail" }
+func (*detailCmd) Synopsis() string {
+	return "describe a single top-level provider set or injector"
+}
+func (*detailCmd) Usage() string {
+	return `detail [package] [name]
+
+  detail is equivalent to show but only describes the provider set or injector
+  with the given name in the given package.
+
+  For an injector, detail prints its signature, the provider set passed to
+  wire.Build with the sets it imports, and the providers it calls in order,
+  followed by the injector parameters it does not use and the types it needs
+  that nothing provides.
+
+  Anonymous provider sets, including the ones passed to wire.Build, are named
+  by their identifier "anon@path/to/pkg/file.go:line:col" as printed by show,
+  or "anon@file.go:line:col" for short.
+
+  If the name matches nothing, or matches declarations in more than one of the
+  packages, detail lists them and exits with a non-zero status.
+`
+}
+func (cmd *detailCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+}
+func (cmd *detailCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
+	}
+	return cmd.run(ctx, wd, os.Environ(), os.Stdout, f.Args())
+}
+
+// run describes the provider set or injector named by args to w.
+func (cmd *detailCmd) run(ctx context.Context, wd string, env []string, w io.Writer, args []string) subcommands.ExitStatus {
+	if len(args) != 2 {
+		logging.Errorf("detail requires two arguments: package and name")
+		return subcommands.ExitFailure
+	}
+	pattern, name := args[0], args[1]
+	pkgs, errs := wire.LoadPackages(ctx, wd, env, cmd.tags, []string{pattern})
+	if len(errs) > 0 {
+		logErrors(errs)
+		return subcommands.ExitFailure
+	}
+	// Errors in other provider sets and injectors do not prevent describing
+	// the named one, and errors in the named injector are found again by
+	// DescribeInjector.
+	info, loadErrs := wire.LoadInfo(pkgs)
+
+	var set *wire.ProviderSet
+	var setKey wire.ProviderSetID
+	var d *wire.InjectorDetail
+	if set = info.AnonSet(name); set != nil {
+		setKey = wire.ProviderSetID{ImportPath: set.PkgPath, VarName: set.AnonID}
+	} else {
+		decl, err := wire.ResolveNamed(pkgs, []string{pattern}, name)
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+		if decl.Injector {
+			d = wire.DescribeInjector(decl.Pkg, name)
+		} else {
+			setKey = wire.ProviderSetID{ImportPath: decl.Pkg.PkgPath, VarName: name}
+			if set = info.Sets[setKey]; set == nil {
+				// The provider set has errors.
+				logErrors(loadErrs)
+				logging.Errorf("failed to load %s", decl)
+				return subcommands.ExitFailure
+			}
+		}
+	}
+	var sb strings.Builder
+	if set != nil {
+		writeDetail(&sb, info, set, setKey)
+		fmt.Fprintln(w, sb.String())
+		return subcommands.ExitSuccess
+	}
+	writeInjectorDetail(&sb, d)
+	fmt.Fprintln(w, sb.String())
+	if len(d.Errs) > 0 {
+		logErrors(d.Errs)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// writeInjectorDetail writes the description of the injector d to sb.
+func writeInjectorDetail(sb *strings.Builder, d *wire.InjectorDetail) {
+	sb.WriteString(d.Injector.String() + "\n")
+	sb.WriteString(fmt.Sprintf("\t%s\n", d.Signature))
+	if set := d.Injector.Set; set != nil {
+		sb.WriteString(fmt.Sprintf("\n\tBuilds from %s:\n", set.AnonID))
+		for _, imp := range set.Imports {
+			sb.WriteString(fmt.Sprintf("\t\t%s\n", formatProviderSet(imp)))
+		}
+	}
+	if len(d.Steps) > 0 {
+		sb.WriteString("\n\tCalls:\n")
+		for _, step := range d.Steps {
+			if step.Name != "" {
+				sb.WriteString(fmt.Sprintf("\t\t%s %s for %s\n", step.Kind, step.Name, step.Type))
+			} else {
+				sb.WriteString(fmt.Sprintf("\t\t%s for %s\n", step.Kind, step.Type))
+			}
+			sb.WriteString(fmt.Sprintf("\t\t\tat %v\n", step.Position))
+		}
+	}
+	if len(d.UnusedInputs) > 0 {
+		sb.WriteString("\n\tUnused inputs:\n")
+		for _, in := range d.UnusedInputs {
+			sb.WriteString(fmt.Sprintf("\t\t%s\n", in))
+		}
+	}
+	if len(d.MissingInputs) > 0 {
+		sb.WriteString("\n\tMissing inputs:\n")
+		for _, t := range d.MissingInputs {
+			sb.WriteString(fmt.Sprintf("\t\t%s\n", t))
+		}
+	}
+}
+
+// writeDetail writes the description of set identified by key to sb.
+func writeDetail(sb *strings.Builder, info *wire.Info, set *wire.ProviderSet, key wire.ProviderSetID) {
+	outGroups, imports := wire.Gather(info, set, key)
+	if set.VarName == "" {
+		sb.WriteString(set.AnonID + "\n")
+	} else {
+		sb.WriteString(key.String() + "\n")
+	}
+	for _, imp := range sortSet(imports) {
+		sb.WriteString(fmt.Sprintf("\t%s\n", imp))
+	}
+	if len(set.Requires) > 0 {
+		sb.WriteString("\n\tRequires:\n")
+		for _, r := range set.Requires {
+			sb.WriteString(fmt.Sprintf("\t\t%s\n", types.TypeString(r.Type, nil)))
+		}
+	}
+	for i := range outGroups {
+		sb.WriteString(fmt.Sprintf("\n\tOutputs given %s:\n", outGroups[i].Name))
+		out := make(map[string]token.Pos, outGroups[i].Outputs.Len())
+		costs := make(map[string]string)
+		outGroups[i].Outputs.Iterate(func(t types.Type, v interface{}) {
+			switch v := v.(type) {
+			case *wire.Provider:
+				out[types.TypeString(t, nil)] = v.Pos
+				costs[types.TypeString(t, nil)] = v.Cost
+			case *wire.Value:
+				out[types.TypeString(t, nil)] = v.Pos
+			case *wire.Field:
+				out[types.TypeString(t, nil)] = v.Pos
+			default:
+				panic("unreachable")
+			}
+		})
+		for _, t := range sortSet(out) {
+			sb.WriteString(fmt.Sprintf("\t\t%s\n", t))
+			sb.WriteString(fmt.Sprintf("\t\t\tat %v\n", info.Fset.Position(out[t])))
+			if costs[t] != "" {
+				sb.WriteString(fmt.Sprintf("\t\t\tcost %s\n", costs[t]))
+			}
+		}
+	}
+}
+
+type graphCmd struct {
+	tags         string
+	format       string
+	compact      bool
+	output       string
+	render       string
+	dot          string
+	rankdir      string
+	size         string
+	browser      bool
+	remote       bool
+	criticalPath bool
+	timings      string
+	slowest      int
+	depth        int
+	focus        string
+	include      string
+	exclude      string
+	collapse     string
+	cluster      string
+	edgeLabels   string
+	split        bool
+	level        string
+	reverse      bool
+}
+
+func (*graphCmd) Name() string { return "graph" }
+func (*graphCmd) Synopsis() string {
+	return "visualize providers as graph using grpahviz, cytospace or d2"
+}
+func (*graphCmd) Usage() string {
+	return `graph [-format graphviz|cytospace|json|d2] [-compact] [-output|-o file] [-render svg|png|pdf] [-rankdir TB|LR|BT|RL] [-size W,H] [-browser [-remote]] [-critical-path] [-timings file] [-slowest N] [-depth N] [-focus prefix|type] [-include regexp] [-exclude regexp] [-collapse set,...] [-cluster set|package] [-edge-labels param|position] [-split] [package] [name]
+graph -reverse [flags] package type [injector]
+graph -level sets [-format graphviz|cytospace|json|d2] [-compact] [-output|-o file] [-render svg|png|pdf] [-rankdir TB|LR|BT|RL] [-size W,H] [-browser [-remote]] [-tags tag,list] [package]
+graph serve [-addr host:port] [-browser] [-editor url] [-cytoscape url] [-tags tag,list] [-critical-path] [-depth N] [-focus prefix|type] [-include regexp] [-exclude regexp] [-collapse set,...] [-cluster set|package] [-edge-labels param|position] [package] [name]
+graph diff [-format graphviz|json] [-output|-o file] [-tags tag,list] rev [package] [name]
+
+  Given a package and name, graph visualizes the dependencies of providers using Graphviz.
+
+  The package pattern may match several packages, e.g. ./..., in which case
+  the graph is drawn from the one declaring name; graph fails if more than
+  one does. Providers from other packages carry their import path.
+
+  Without a name, graph draws every provider set and injector declared in
+  the packages matching the pattern into a single document, in which each
+  is a cluster, a container with -format d2, or a compound node with
+  -format cytospace, and the IDs of its nodes are prefixed by its key, e.g.
+  "initApp#example.com/app:". A rendered document is named after the
+  package. With -split, each is written to a file of its own instead, named
+  after it with the extension of the format, e.g. initApp.dot, or of
+  -render, in the directory -output if set, and next to its package
+  otherwise. Those that cannot be drawn are reported and left out.
+  -timings requires a name.
+
+  With -level sets, graph draws a map of the packages matching the pattern
+  instead, e.g. ./...: a node for each provider set declared at the top
+  level and each injector, grouped by package, with an edge to each
+  provider set it imports, the relation show prints as imports. Anonymous
+  sets, such as a wire.NewSet nested in another, are seen through, and the
+  sets of other packages are drawn dashed as they are imported. It takes no
+  name and none of the flags drawing providers, and a rendered map is
+  written to sets.svg or the like in the current directory.
+
+  With -format cytospace, graph prints the graph as indented cytoscape.js
+  elements instead, or on a single line with -compact. With -format json,
+  graph prints it in a versioned schema independent of any renderer, for
+  other tools to consume: its nodes have a kind, the provider, package and
+  position they come from, and the provider set they belong to, its edges a
+  role, e.g. the index of an argument or the name of a field, and its sets
+  their nesting; without a name, the graphs are listed in a single
+  document. See the README for the schema.
+  With -format d2, graph prints the source of a Terrastruct D2 diagram, in
+  which provider sets are containers, inputs are hexagons, root outputs are
+  double-bordered ovals.
+  In every format, providers carry a tooltip giving their import path if
+  declared in another package, the file:line of their declaration and the
+  first sentence of their doc comment, and Graphviz nodes link to their file.
+  With -output, the graph is written to the given file instead of stdout.
+
+  With -render, graph renders the Graphviz graph to an SVG, PNG or PDF file
+  with the dot command of a local Graphviz installation, see -dot. The file
+  is written to -output if set, and next to the package otherwise, named
+  after the graph, e.g. initApp.svg. Nothing is sent over the network.
+  -rankdir lays the graph out from top to bottom (TB, the default), left
+  to right (LR), bottom to top (BT) or right to left (RL), and -size sets
+  its maximum size in inches, e.g. 10,8, or 10,8! to scale it up to fill
+  that size. Both are passed to dot and require a locally rendered graph.
+
+  With -browser, graph renders the graph as with -render, to a temporary
+  SVG file unless -render or -output is set, and opens it in the default
+  browser. With -remote as well, it opens the graph in the online editor at
+  https://edotor.net instead, which sends the graph, including the package
+  paths and type names in it, to that site.
+
+  Providers annotated with a //wire:cost light, medium or heavy directive are
+  drawn with thicker borders as their cost increases. With -critical-path,
+  the chain of providers with the largest total cost is highlighted.
+
+  With -timings, the JSON file maps provider identifiers, such as
+  "example.com/app.NewDB" as passed to wire.TraceHooks and written by
+  gen -emit-manifest, to measured durations, either as strings like "12ms"
+  or as numbers of nanoseconds. Matching providers are labeled with their
+  duration and filled with a heat color (graphviz) or given a duration and
+  a "heat-1" to "heat-5" class (cytospace), and -critical-path weighs the
+  measured durations instead of the costs. Identifiers matching no provider
+  are reported to stderr. -slowest N also prints the N slowest providers
+  and the critical path by measured durations to stderr.
+
+  In cytospace output, the nodes of providers have a command, a
+  wireplus.openLocation command with the file, line and column of their
+  declaration, which editors can pass to the language server to reveal it.
+
+  With -depth N, only the nodes within N edges of the root outputs are
+  drawn. With -focus, only the providers whose import path starts with the
+  given prefix, the nodes of the given type, e.g. "*example.com/app.DB", and
+  their direct neighbors are drawn. The flags can be combined, and the root
+  outputs are always drawn. Each connected group of hidden nodes is drawn as
+  a single node labeled with the number of hidden providers, and the edges
+  of the hidden nodes point to and from it.
+
+  With -include, only the nodes whose type, e.g. "*example.com/app.DB", or
+  whose provider, e.g. "example.com/app.NewDB", matches the regular
+  expression are drawn; with -exclude, those matching it are not, e.g.
+  -exclude '^context\.' to hide the providers and values of package
+  context. Each chain of nodes hidden this way is drawn as a dashed edge
+  between the nodes it connects. -depth and -focus apply to what is left.
+
+  With -collapse, the providers of each of the comma-separated provider
+  sets, named as InfraSet or example.com/app.InfraSet, are drawn as a single
+  summary node giving the numbers of its providers, of its inputs, the
+  nodes they consume, and of its outputs, those consumed by the rest of
+  the graph. The edges of the providers lead to and from it. Root outputs
+  are always drawn.
+
+  With -reverse, the argument after the package is a type, e.g.
+  "*example.com/app.DB", and only its node and the providers depending on
+  it, directly or transitively, are drawn, in the injector named after the
+  type or, without a name, in each injector of the package depending on
+  it. The other nodes are left out rather than summarized, root outputs
+  included.
+
+  With -edge-labels param, the edges from provider functions and structs
+  to their dependencies are labeled with the parameters or fields consuming
+  them, e.g. "param: conn" or "field: DB"; with -edge-labels position, with
+  their positions as well, e.g. "param 2: conn", which also labels unnamed
+  parameters. The json format always gives both.
+
+  With -cluster package, the providers are grouped by the package declaring
+  them instead of the provider sets they come from, and the values by the
+  package of the set binding them, e.g. to audit the dependencies between
+  layers. The json format gives both, whatever -cluster is.
+
+  If an injector lacks providers, its graph is still drawn, with each type
+  without a provider as a red dashed input named "missing" attached to the
+  providers that need it. Likewise, if the providers of a provider set or
+  injector depend on each other in cycles, they are drawn with the nodes
+  and edges of each cycle in magenta, the edges labeled with their order,
+  e.g. "cycle 1: 2/3", and an error per cycle lists its providers and
+  their positions in the same order. The errors are logged and graph exits
+  with a non-zero status after writing it; graph serve shows it with the
+  errors.
+
+  graph serve serves an interactive page drawing the graph with cytoscape.js
+  at http://localhost:8080/, or -addr, and opens it with -browser. The page
+  pans and zooms, searches the providers and types, collapses and expands
+  provider sets on double-click, and opens the declaration of a provider on
+  click with the -editor URL, by default vscode://file{file}:{line}:{column},
+  or not at all if empty. The graph is drawn again and the page reloads it
+  whenever the files it depends on change, as with gen -watch. The graph
+  itself is only served locally, but cytoscape.js is not bundled with
+  wireplus: the page loads it from unpkg.com, and so needs network access,
+  unless -cytoscape gives another URL or the path of a local copy of the
+  script, which is then served along with the page.
+
+  graph diff draws the difference between the graph at the git revision rev
+  and at HEAD, as a Graphviz graph in which added providers and edges are
+  green, removed ones red and dashed, and providers whose dependencies
+  changed orange, or with -format json as lists of "nodes" and "edges",
+  each with a "status": added, removed, rewired or unchanged. Both
+  revisions are extracted with git archive to temporary directories, so
+  uncommitted changes are left out and the working tree is left alone. The
+  numbers of added, removed and rewired providers are logged to stderr.
+`
+}
+func (cmd *graphCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.StringVar(&cmd.format, "format", "graphviz", "specify the output format (graphviz, cytospace, json or d2)")
+	f.BoolVar(&cmd.compact, "compact", false, "print cytospace or json output on a single line")
+	f.StringVar(&cmd.output, "output", "", "write the graph to the given file instead of stdout")
+	f.StringVar(&cmd.output, "o", "", "alias for -output")
+	f.StringVar(&cmd.render, "render", "", "render the graph with the local dot command to a file (svg, png or pdf)")
+	f.StringVar(&cmd.dot, "dot", "dot", "the Graphviz dot command used by -render and -browser")
+	f.StringVar(&cmd.rankdir, "rankdir", "", "with -render or -browser, the direction of the layout (TB, LR, BT or RL)")
+	f.StringVar(&cmd.size, "size", "", "with -render or -browser, the maximum size of the graph in inches, e.g. 10,8")
+	f.BoolVar(&cmd.browser, "browser", false, "open the rendered graph in the default browser")
+	f.BoolVar(&cmd.remote, "remote", false, "with -browser, open the graph in the online Graphviz editor at edotor.net instead")
+	f.BoolVar(&cmd.criticalPath, "critical-path", false, "highlight the most expensive chain of providers")
+	f.StringVar(&cmd.timings, "timings", "", "overlay the measured provider durations in the given JSON file")
+	f.IntVar(&cmd.slowest, "slowest", 0, "print the N slowest providers and the critical path by measured durations; requires -timings")
+	f.IntVar(&cmd.depth, "depth", 0, "only draw the nodes within N edges of the root outputs")
+	f.StringVar(&cmd.focus, "focus", "", "only draw the providers of packages with the given import path prefix or of the given type, and their neighbors")
+	f.StringVar(&cmd.include, "include", "", "only draw the nodes whose type or provider matches the regular expression, eliding the others")
+	f.StringVar(&cmd.exclude, "exclude", "", "elide the nodes whose type or provider matches the regular expression")
+	f.StringVar(&cmd.collapse, "collapse", "", "draw the comma-separated provider sets, e.g. InfraSet or example.com/app.InfraSet, as summary nodes")
+	f.StringVar(&cmd.cluster, "cluster", "set", "group the providers by the provider set they come from (set) or by the package declaring them (package)")
+	f.StringVar(&cmd.edgeLabels, "edge-labels", "", "label the edges with the parameters or fields consuming them (param), and their positions (position)")
+	f.BoolVar(&cmd.split, "split", false, "without a name, write a file for each provider set and injector instead of a combined document")
+	f.BoolVar(&cmd.reverse, "reverse", false, "draw the providers depending on the type given after the package, in the injector given after it or in every injector")
+	f.StringVar(&cmd.level, "level", "providers", "draw the providers of a provider set or injector (providers), or the provider sets of the packages and their imports (sets)")
+}
+func (cmd *graphCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
+	}
+	switch f.Arg(0) {
+	case "serve":
+		return cmd.serve(ctx, wd, os.Environ(), f.Args()[1:])
+	case "diff":
+		return cmd.diff(ctx, wd, os.Environ(), os.Stdout, f.Args()[1:])
+	}
+	return cmd.run(ctx, wd, os.Environ(), os.Stdout, f.Args())
+}
+
+// run runs the command in wd with the given arguments, writing the graph
+// to w.
+func (cmd *graphCmd) run(ctx context.Context, wd string, env []string, w io.Writer, args []string) subcommands.ExitStatus {
+	// With -reverse, the type follows the package.
+	var reverse string
+	if cmd.reverse {
+		if len(args) != 2 && len(args) != 3 {
+			logging.Errorf("graph -reverse requires a package, a type and optionally an injector")
+			return subcommands.ExitFailure
+		}
+		reverse = args[1]
+		args = append([]string{args[0]}, args[2:]...)
+	}
+	if len(args) != 1 && len(args) != 2 {
+		logging.Errorf("graph requires a package and optionally a name")
+		return subcommands.ExitFailure
+	}
+	if len(args) == 1 {
+		// Every provider set and injector of the package is drawn.
+		if cmd.timings != "" {
+			logging.Errorf("-timings requires a name")
+			return subcommands.ExitFailure
+		}
+		if cmd.split && cmd.browser {
+			logging.Errorf("-browser cannot be combined with -split")
+			return subcommands.ExitFailure
+		}
+	} else if cmd.split {
+		logging.Errorf("-split requires no name, to draw every provider set and injector of the package")
+		return subcommands.ExitFailure
+	}
+	format := cmd.format
+	switch format {
+	case "graphviz", "cytospace", "json", "d2":
+	default:
+		logging.Errorf("unknown -format %q; want graphviz, cytospace, json or d2", cmd.format)
+		return subcommands.ExitFailure
+	}
+	switch cmd.render {
+	case "", "svg", "png", "pdf":
+	default:
+		logging.Errorf("unknown -render %q; want svg, png or pdf", cmd.render)
+		return subcommands.ExitFailure
+	}
+	if cmd.browser && format != "graphviz" {
+		logging.Errorf("-browser requires -format graphviz")
+		return subcommands.ExitFailure
+	}
+	if cmd.render != "" && format != "graphviz" {
+		logging.Errorf("-render requires -format graphviz")
+		return subcommands.ExitFailure
+	}
+	if cmd.compact && format != "cytospace" && format != "json" {
+		logging.Errorf("-compact requires -format cytospace or json")
+		return subcommands.ExitFailure
+	}
+	if cmd.remote && !cmd.browser {
+		logging.Errorf("-remote requires -browser")
+		return subcommands.ExitFailure
+	}
+	if cmd.remote && (cmd.render != "" || cmd.output != "") {
+		logging.Errorf("-remote cannot be combined with -render or -output, as the graph is rendered by edotor.net")
+		return subcommands.ExitFailure
+	}
+	render := cmd.render
+	if cmd.browser && !cmd.remote && render == "" {
+		render = "svg"
+	}
+	switch cmd.rankdir {
+	case "", "TB", "LR", "BT", "RL":
+	default:
+		logging.Errorf("unknown -rankdir %q; want TB, LR, BT or RL", cmd.rankdir)
+		return subcommands.ExitFailure
+	}
+	if cmd.size != "" && !graphSizeRE.MatchString(cmd.size) {
+		logging.Errorf("invalid -size %q; want the width and height in inches, e.g. 10,8", cmd.size)
+		return subcommands.ExitFailure
+	}
+	if (cmd.rankdir != "" || cmd.size != "") && render == "" {
+		logging.Errorf("-rankdir and -size require -render or -browser without -remote")
+		return subcommands.ExitFailure
+	}
+	var dot string
+	if render != "" {
+		// Fail before loading the packages if the graph cannot be rendered.
+		var err error
+		if dot, err = exec.LookPath(cmd.dot); err != nil {
+			logging.Errorf("%s not found: -render and -browser need the dot command of Graphviz, see https://graphviz.org/download/; or pass -output to write the dot source and render it elsewhere", cmd.dot)
+			return subcommands.ExitFailure
+		}
+	}
+	if cmd.slowest > 0 && cmd.timings == "" {
+		logging.Errorf("-slowest requires -timings")
+		return subcommands.ExitFailure
+	}
+	switch cmd.level {
+	case "", "providers":
+	case "sets":
+		return cmd.runSets(ctx, wd, env, w, args, format, render, dot)
+	default:
+		logging.Errorf("unknown -level %q; want providers or sets", cmd.level)
+		return subcommands.ExitFailure
+	}
+	filter, err := cmd.filter()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	filter.Reverse = reverse
+	cluster, err := cmd.clusterBy()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	edgeLabels, err := cmd.labelEdges()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	var timings wire.Timings
+	if cmd.timings != "" {
+		content, err := ioutil.ReadFile(cmd.timings)
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+		timings, err = wire.ParseTimings(content)
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+	}
+	pattern := []string{args[0]}
+	if len(args) == 1 {
+		return cmd.runAll(ctx, wd, env, w, pattern, format, render, dot, filter, cluster, edgeLabels)
+	}
+	name := args[1]
+	data, report, errs := wire.Graph(ctx, wd, env, pattern, name, cmd.tags, format, cmd.criticalPath, timings, filter, cluster, edgeLabels)
+	status := subcommands.ExitSuccess
+	if len(errs) > 0 {
+		logErrors(errs)
+		if data == "" {
+			logging.Errorf("graph failed")
+			return subcommands.ExitFailure
+		}
+		// The injector lacks providers, which are drawn as missing, or its
+		// providers depend on each other in cycles, which are highlighted;
+		// the graph is still written, but the command fails as gen would.
+		logging.Warnf("%s is drawn despite the errors above", name)
+		status = subcommands.ExitFailure
+	}
+	pkgDir := func() (string, error) {
+		return wire.PackageDir(ctx, wd, env, cmd.tags, pattern[0], name)
+	}
+	if !cmd.write(wd, w, data, format, render, dot, name, pkgDir) {
+		return subcommands.ExitFailure
+	}
+	if report != nil {
+		for _, id := range report.Unmatched {
+			logging.Warnf("timings: %s matches no provider in the graph", id)
+		}
+		if cmd.slowest > 0 {
+			printSlowest(os.Stderr, report, cmd.slowest)
+		}
+	}
+	return status
+}
+
+// write writes data, the graph named name in the given format, to w or
+// to the file of -output, or renders it with dot to the file of -output,
+// or next to the package in pkgDir, reporting whether it succeeded.
+func (cmd *graphCmd) write(wd string, w io.Writer, data string, format string, render string, dot string, name string, pkgDir func() (string, error)) bool {
+	switch {
+	case cmd.remote:
+		u := edotorURL(data)
+		if err := openBrowser(u); err != nil {
+			logging.Warnf("failed to open a browser: %v", err)
+		}
+		fmt.Fprintln(w, u)
+	case render != "":
+		var path string
+		if cmd.output == "" && cmd.render == "" {
+			// -browser alone should not leave files in the package.
+			f, err := ioutil.TempFile("", "wireplus-"+name+"-*.svg")
+			if err != nil {
+				logging.Errorf("%v", err)
+				return false
+			}
+			f.Close()
+			path = f.Name()
+		} else {
+			dir := ""
+			if cmd.output == "" {
+				var err error
+				if dir, err = pkgDir(); err != nil {
+					logging.Errorf("%v", err)
+					return false
+				}
+			}
+			path = graphOutputPath(wd, cmd.output, dir, name, render)
+		}
+		if err := renderDot(dot, data, render, path, cmd.dotAttrs()...); err != nil {
+			logging.Errorf("%v", err)
+			return false
+		}
+		logging.Infof("wrote %s", path)
+		if cmd.browser {
+			if err := openBrowser(path); err != nil {
+				logging.Warnf("failed to open a browser: %v", err)
+			}
+		}
+	default:
+		data, ok := cmd.indent(data, format)
+		if !ok {
+			return false
+		}
+		if cmd.output == "" {
+			// Print the graph data to stdout as output
+			fmt.Fprintln(w, data)
+			break
+		}
+		path := graphOutputPath(wd, cmd.output, "", name, "")
+		if err := ioutil.WriteFile(path, []byte(data+"\n"), 0666); err != nil {
+			logging.Errorf("failed to write %s: %v", path, err)
+			return false
+		}
+		logging.Infof("wrote %s", path)
+	}
+	return true
+}
+
+// runAll runs the command without a name, drawing every provider set and
+// injector of the packages matching pattern into a single document written
+// as by write, or with -split into a file each.
+func (cmd *graphCmd) runAll(ctx context.Context, wd string, env []string, w io.Writer, pattern []string, format string, render string, dot string, filter *wire.GraphFilter, cluster wire.GraphCluster, edgeLabels wire.GraphEdgeLabels) subcommands.ExitStatus {
+	graphs, errs := wire.GraphAll(ctx, wd, env, pattern, cmd.tags, format, cmd.criticalPath, filter, cluster, edgeLabels)
+	status := subcommands.ExitSuccess
+	if len(errs) > 0 {
+		logErrors(errs)
+		if len(graphs) == 0 {
+			logging.Errorf("graph failed")
+			return subcommands.ExitFailure
+		}
+		// The provider sets and injectors that can be drawn still are.
+		logging.Warnf("%d provider sets and injectors are drawn despite the errors above", len(graphs))
+		status = subcommands.ExitFailure
+	}
+	if !cmd.split {
+		data, err := wire.CombineGraphs(graphs)
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+		// The combined graph is named after the package.
+		name := filepath.Base(graphs[0].Decl.Pkg.PkgPath)
+		if !cmd.write(wd, w, data, format, render, dot, name, graphs[0].Dir) {
+			return subcommands.ExitFailure
+		}
+		return status
+	}
+	ext := render
+	if ext == "" {
+		ext = graphExts[format]
+	}
+	for _, g := range graphs {
+		dir := cmd.output
+		if dir == "" {
+			var err error
+			if dir, err = g.Dir(); err != nil {
+				logging.Errorf("%v", err)
+				return subcommands.ExitFailure
+			}
+		} else {
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(wd, dir)
+			}
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				logging.Errorf("%v", err)
+				return subcommands.ExitFailure
+			}
+		}
+		path := filepath.Join(dir, g.Decl.Name+"."+ext)
+		if render != "" {
+			if err := renderDot(dot, g.Data, render, path, cmd.dotAttrs()...); err != nil {
+				logging.Errorf("%v", err)
+				return subcommands.ExitFailure
+			}
+		} else {
+			data, ok := cmd.indent(g.Data, format)
+			if !ok {
+				return subcommands.ExitFailure
+			}
+			if err := ioutil.WriteFile(path, []byte(data+"\n"), 0666); err != nil {
+				logging.Errorf("failed to write %s: %v", path, err)
+				return subcommands.ExitFailure
+			}
+		}
+		logging.Infof("wrote %s", path)
+	}
+	return status
+}
+
+// runSets runs the command with -level sets, drawing the provider sets of
+// the packages matching the pattern in args and their imports, written as
+// by write, or rendered to sets.svg or the like in wd.
+func (cmd *graphCmd) runSets(ctx context.Context, wd string, env []string, w io.Writer, args []string, format string, render string, dot string) subcommands.ExitStatus {
+	if len(args) != 1 {
+		logging.Errorf("-level sets draws every provider set of the packages and takes no name")
+		return subcommands.ExitFailure
+	}
+	if cmd.criticalPath || cmd.depth != 0 || cmd.focus != "" || cmd.include != "" || cmd.exclude != "" ||
+		cmd.collapse != "" || cmd.edgeLabels != "" || cmd.cluster != "" && cmd.cluster != string(wire.ClusterBySet) || cmd.split || cmd.reverse {
+		logging.Errorf("-level sets cannot be combined with the flags drawing providers, such as -critical-path, -focus, -reverse or -split")
+		return subcommands.ExitFailure
+	}
+	data, errs := wire.GraphSets(ctx, wd, env, []string{args[0]}, cmd.tags, format)
+	status := subcommands.ExitSuccess
+	if len(errs) > 0 {
+		logErrors(errs)
+		if data == "" {
+			logging.Errorf("graph failed")
+			return subcommands.ExitFailure
+		}
+		logging.Warnf("the provider sets are drawn despite the errors above")
+		status = subcommands.ExitFailure
+	}
+	pkgDir := func() (string, error) {
+		return wd, nil
+	}
+	if !cmd.write(wd, w, data, format, render, dot, "sets", pkgDir) {
+		return subcommands.ExitFailure
+	}
+	return status
+}
+
+// graphExts are the extensions of the files written by graph -split, by
+// format.
+var graphExts = map[string]string{
+	"graphviz":  "dot",
+	"cytospace": "json",
+	"json":      "json",
+	"d2":        "d2",
+}
+
+// indent returns data, a graph in the given format, indented unless it is
+// neither cytospace nor json or -compact is set, reporting whether it
+// succeeded.
+func (cmd *graphCmd) indent(data string, format string) (string, bool) {
+	if format != "cytospace" && format != "json" || cmd.compact {
+		return data, true
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(data), "", "  "); err != nil {
+		logging.Errorf("failed to indent the graph: %v", err)
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// dotAttrs returns the graph attributes set by -rankdir and -size, to pass
+// to renderDot.
+func (cmd *graphCmd) dotAttrs() []string {
+	var attrs []string
+	if cmd.rankdir != "" {
+		attrs = append(attrs, "rankdir="+cmd.rankdir)
+	}
+	if cmd.size != "" {
+		attrs = append(attrs, "size="+cmd.size)
+	}
+	return attrs
+}
+
+// clusterBy returns the clustering set by -cluster.
+func (cmd *graphCmd) clusterBy() (wire.GraphCluster, error) {
+	switch cluster := wire.GraphCluster(cmd.cluster); cluster {
+	case "":
+		return wire.ClusterBySet, nil
+	case wire.ClusterBySet, wire.ClusterByPackage:
+		return cluster, nil
+	}
+	return "", fmt.Errorf("unknown -cluster %q; want set or package", cmd.cluster)
+}
+
+// labelEdges returns the labeling of the edges set by -edge-labels.
+func (cmd *graphCmd) labelEdges() (wire.GraphEdgeLabels, error) {
+	switch labels := wire.GraphEdgeLabels(cmd.edgeLabels); labels {
+	case wire.EdgeLabelsNone, wire.EdgeLabelsParam, wire.EdgeLabelsPosition:
+		return labels, nil
+	}
+	return "", fmt.Errorf("unknown -edge-labels %q; want param or position", cmd.edgeLabels)
+}
+
+// filter returns the filter set by the -depth, -focus, -include, -exclude
+// and -collapse flags.
+func (cmd *graphCmd) filter() (*wire.GraphFilter, error) {
+	if cmd.depth < 0 {
+		return nil, fmt.Errorf("-depth must not be negative")
+	}
+	filter := &wire.GraphFilter{Depth: cmd.depth, Focus: cmd.focus}
+	var err error
+	if cmd.include != "" {
+		if filter.Include, err = regexp.Compile(cmd.include); err != nil {
+			return nil, fmt.Errorf("invalid -include: %v", err)
+		}
+	}
+	if cmd.exclude != "" {
+		if filter.Exclude, err = regexp.Compile(cmd.exclude); err != nil {
+			return nil, fmt.Errorf("invalid -exclude: %v", err)
+		}
+	}
+	for _, set := range strings.Split(cmd.collapse, ",") {
+		if set = strings.TrimSpace(set); set != "" {
+			filter.Collapse = append(filter.Collapse, set)
+		}
+	}
+	return filter, nil
+}
+
+// graphOutputPath returns the file to write the graph named name to: output,
+// relative to wd, if set, or else a file named after the graph with the
+// extension ext in pkgDir.
+func graphOutputPath(wd string, output string, pkgDir string, name string, ext string) string {
+	if output != "" {
+		if filepath.IsAbs(output) {
+			return output
+		}
+		return filepath.Join(wd, output)
+	}
+	return filepath.Join(pkgDir, name+"."+ext)
+}
+
+// graphSizeRE matches the Graphviz size of a graph, in inches, with an
+// optional "!" to scale the graph up to it.
+var graphSizeRE = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(,[0-9]+(\.[0-9]+)?)?!?$`)
+
+// renderDot renders the dot source of a graph to the file at path in the
+// given format, such as svg, with the dot command at dotPath. The graph
+// attributes attrs, such as "rankdir=LR", override those of the source.
+func renderDot(dotPath string, dot string, format string, path string, attrs ...string) error {
+	args := []string{"-T" + format, "-o", path}
+	for _, attr := range attrs {
+		args = append(args, "-G"+attr)
+	}
+	c := exec.Command(dotPath, args...)
+	c.Stdin = strings.NewReader(dot)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("failed to render the graph with %s: %v\n%s", dotPath, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// edotorURL returns the URL of the online Graphviz editor showing the
+// graph in dot.
+func edotorURL(dot string) string {
+	// The editor reads the graph from the fragment, encoded as by
+	// encodeURIComponent in JavaScript.
+	return "https://edotor.net/?engine=dot#" + strings.Replace(url.QueryEscape(dot), "+", "%20", -1)
+}
+
+// openBrowser opens u in the default browser without waiting for it.
+func openBrowser(u string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", u)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		c = exec.Command("xdg-open", u)
+	}
+	return c.Start()
+}
+
+// printSlowest prints the n slowest providers of report and its critical
+// path to w.
+func printSlowest(w io.Writer, report *wire.TimingsReport, n int) {
+	slowest := report.Slowest
+	if len(slowest) > n {
+		slowest = slowest[:n]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "slowest providers:")
+	for _, p := range slowest {
+		fmt.Fprintf(tw, "\t%s\t%v\n", p.ID, p.Duration)
+	}
+	var total time.Duration
+	for _, p := range report.CriticalPath {
+		total += p.Duration
+	}
+	fmt.Fprintf(tw, "critical path (%v):\n", total)
+	for _, p := range report.CriticalPath {
+		fmt.Fprintf(tw, "\t%s\t%v\n", p.ID, p.Duration)
+	}
+	tw.Flush()
+}
+
+type exportCmd struct {
+	tags   string
+	format string
+	json   bool
 }
 
-func sortSet(set interface{}) []string {
-	rv := reflect.ValueOf(set)
-	a := make([]string, 0, rv.Len())
-	keys := rv.MapKeys()
-	for _, k := range keys {
-		a = append(a, k.String())
+func (*exportCmd) Name() string { return "export" }
+func (*exportCmd) Synopsis() string {
+	return "export a report about the injectors in a package"
+}
+func (*exportCmd) Usage() string {
+	return `export [packages]
+
+  Given one or more packages, export solves each injector and prints a report
+  in the requested format.
+
+  The "modules" format lists, for each injector, the modules that contribute
+  at least one provider, value or bound implementation, followed by a rollup
+  over all injectors. The main module and the standard library are listed
+  separately from external modules.
+
+  The "sets" format lists, for each top-level provider set, its inputs: the
+  types it needs but does not provide. Inputs declared by wire.Requires are
+  listed as declared, and the other sets' inputs are inferred.
+
+  If no packages are listed, it defaults to ".".
+`
+}
+func (cmd *exportCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.StringVar(&cmd.format, "format", "modules", "specify the report format (modules or sets)")
+	f.BoolVar(&cmd.json, "json", false, "output the report in JSON")
+}
+func (cmd *exportCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
 	}
-	sort.Strings(a)
-	return a
+	var report interface{}
+	var errs []error
+	switch cmd.format {
+	case "modules":
+		report, errs = wire.ExportModules(ctx, wd, os.Environ(), packages(f), cmd.tags)
+	case "sets":
+		report, errs = wire.ExportSets(ctx, wd, os.Environ(), packages(f), cmd.tags)
+	default:
+		logging.Errorf("unknown format: %s", cmd.format)
+		return subcommands.ExitFailure
+	}
+	if len(errs) > 0 {
+		logErrors(errs)
+		logging.Errorf("export failed")
+		return subcommands.ExitFailure
+	}
+	if cmd.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
+		}
+		fmt.Println(string(data))
+		return subcommands.ExitSuccess
+	}
+	if report, ok := report.(*wire.SetsReport); ok {
+		printSetInputs(report)
+		return subcommands.ExitSuccess
+	}
+	printModulesReport(report.(*wire.ModulesReport))
+	return subcommands.ExitSuccess
 }
 
-func formatProviderSetName(importPath, varName string) string {
-	// Since varName is an identifier, it doesn't make sense to quote.
-	return strconv.Quote(importPath) + "." + varName
+// printModulesReport prints report in the "modules" format.
+func printModulesReport(report *wire.ModulesReport) {
+	for _, im := range report.Injectors {
+		printInjectorModules(im)
+	}
+	fmt.Println("Rollup:")
+	printModuleUsage("main module", report.Rollup.Main, true)
+	printModuleUsage("standard library", report.Rollup.Std, true)
+	for _, u := range report.Rollup.External {
+		printModuleUsage(moduleString(u), u, true)
+	}
 }
 
-func logErrors(errs []error) {
-	for _, err := range errs {
-		log.Println(strings.Replace(err.Error(), "\n", "\n\t", -1))
+// printSetInputs prints report in the "sets" format.
+func printSetInputs(report *wire.SetsReport) {
+	for _, si := range report.Sets {
+		kind := "inferred"
+		if si.Declared {
+			kind = "declared"
+		}
+		fmt.Printf("Set %s (%s inputs):\n", si.Set, kind)
+		if len(si.Inputs) == 0 {
+			fmt.Println("\tno inputs")
+		}
+		for _, in := range si.Inputs {
+			fmt.Printf("\t%s\n", in)
+		}
+		fmt.Println()
 	}
 }
 
-type detailCmd struct {
+// printInjectorModules prints the modules contributing to im.
+func printInjectorModules(im *wire.InjectorModules) {
+	fmt.Printf("Injector %s:\n", im.Injector)
+	printModuleUsage("main module", im.Main, false)
+	printModuleUsage("standard library", im.Std, false)
+	for _, u := range im.External {
+		printModuleUsage(moduleString(u), u, false)
+	}
+	fmt.Println()
+}
+
+// printModuleUsage prints a single line for u, omitting modules that do not
+// contribute anything.
+func printModuleUsage(name string, u *wire.ModuleUsage, rollup bool) {
+	if u.Total() == 0 {
+		return
+	}
+	if rollup {
+		fmt.Printf("\t%s: %s in %d injector(s)\n", name, u, u.Injectors)
+		return
+	}
+	fmt.Printf("\t%s: %s\n", name, u)
+}
+
+// moduleString returns the module path and version of u.
+func moduleString(u *wire.ModuleUsage) string {
+	s := u.Path
+	if u.Version != "" {
+		s += " " + u.Version
+	}
+	if u.Replace != "" {
+		s += " => " + u.Replace
+	}
+	return s
+}
+
+type usageCmd struct {
 	tags string
+	json bool
 }
 
-func (*detailCmd) Name() string { return "detail" }
-func (*detailCmd) Synopsis() string {
-	return "describe a single top-level provider set"
+func (*usageCmd) Name() string { return "usage" }
+func (*usageCmd) Synopsis() string {
+	return "report the injectors that use a provider or type"
 }
-func (*detailCmd) Usage() string {
-	return `detail [package] [name]
+func (*usageCmd) Usage() string {
+	return `usage [packages] target
 
-  detail is equivalent to show but only shows a provider set with the given name
-  and does not describe injectors.
+  Given one or more packages and a target, usage solves each injector and
+  prints whether its graph uses the target, along with the chain of provider
+  sets through which the target is imported.
+
+  The target is either a provider function, as path/to/pkg.Name or just
+  Name, or a fully-qualified type such as *path/to/pkg.Name. A provider
+  whose output is bound to an interface by wire.Bind is listed with the
+  interfaces the injector consumes, and an interface type matches the
+  bindings to it. Values supplied by wire.Value match their type.
+
+  usage exits with a non-zero status if no injector uses the target, so that
+  it can detect dead providers in CI.
+
+  If no packages are listed, it defaults to ".".
 `
 }
-func (cmd *detailCmd) SetFlags(f *flag.FlagSet) {
+func (cmd *usageCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.json, "json", false, "output the report in JSON")
 }
-func (cmd *detailCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+func (cmd *usageCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
 		return subcommands.ExitFailure
 	}
-	if len(f.Args()) != 2 {
-		log.Println("detail requires two arguments: package and name")
+	return cmd.run(ctx, wd, os.Environ(), os.Stdout, f.Args())
+}
+
+// run runs the command in wd with the given arguments, writing the report
+// to w.
+func (cmd *usageCmd) run(ctx context.Context, wd string, env []string, w io.Writer, args []string) subcommands.ExitStatus {
+	if len(args) == 0 {
+		logging.Errorf("usage requires a target")
 		return subcommands.ExitFailure
 	}
-	pattern := []string{f.Args()[0]}
-	name := f.Args()[1]
-	info, errs := wire.Load(ctx, wd, os.Environ(), cmd.tags, pattern)
+	target := args[len(args)-1]
+	patterns := args[:len(args)-1]
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	report, errs := wire.Usage(ctx, wd, env, patterns, cmd.tags, target)
 	if len(errs) > 0 {
 		logErrors(errs)
+		logging.Errorf("usage failed")
 		return subcommands.ExitFailure
 	}
-	var sb strings.Builder
-	for k, set := range info.Sets {
-		if set.VarName != name {
-			continue
+	if cmd.json {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
 		}
-		outGroups, imports := gather(info, k)
-		sb.WriteString(k.String())
-		for _, imp := range sortSet(imports) {
-			sb.WriteString(fmt.Sprintf("\t%s\n", imp))
+		fmt.Fprintln(w, string(data))
+	} else {
+		printUsageReport(w, report)
+	}
+	if report.Used() == 0 {
+		logging.Errorf("%s is not used by any of %d injector(s)", target, len(report.Injectors))
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// printUsageReport prints report as plain text to w.
+func printUsageReport(w io.Writer, report *wire.UsageReport) {
+	for _, iu := range report.Injectors {
+		if len(iu.Matches) == 0 {
+			fmt.Fprintf(w, "Injector %s: not used\n", iu.Injector)
+			continue
 		}
-		for i := range outGroups {
-			sb.WriteString(fmt.Sprintf("\n\tOutputs given %s:\n", outGroups[i].name))
-			out := make(map[string]token.Pos, outGroups[i].outputs.Len())
-			outGroups[i].outputs.Iterate(func(t types.Type, v interface{}) {
-				switch v := v.(type) {
-				case *wire.Provider:
-					out[types.TypeString(t, nil)] = v.Pos
-				case *wire.Value:
-					out[types.TypeString(t, nil)] = v.Pos
-				case *wire.Field:
-					out[types.TypeString(t, nil)] = v.Pos
-				default:
-					panic("unreachable")
-				}
-			})
-			for _, t := range sortSet(out) {
-				sb.WriteString(fmt.Sprintf("\t\t%s\n", t))
-				sb.WriteString(fmt.Sprintf("\t\t\tat %v\n", info.Fset.Position(out[t])))
+		fmt.Fprintf(w, "Injector %s:\n", iu.Injector)
+		for _, m := range iu.Matches {
+			switch m.Kind {
+			case "provider":
+				fmt.Fprintf(w, "\tprovider %s for %s (%s)\n", m.Name, m.Type, m.Position)
+			case "binding":
+				fmt.Fprintf(w, "\tbinding of %s to %s (%s)\n", m.Type, m.Impl, m.Position)
+			default:
+				fmt.Fprintf(w, "\t%s for %s (%s)\n", m.Kind, m.Type, m.Position)
+			}
+			if len(m.Sets) > 0 {
+				fmt.Fprintf(w, "\t\tvia %s\n", strings.Join(m.Sets, " -> "))
+			}
+			for _, iface := range m.BoundTo {
+				fmt.Fprintf(w, "\t\tbound to %s\n", iface)
 			}
 		}
-		// Print data to stdout as output
-		fmt.Println(sb.String())
-		return subcommands.ExitSuccess
 	}
-	return subcommands.ExitFailure
+	fmt.Fprintf(w, "%s is used by %d of %d injector(s)\n", report.Target, report.Used(), len(report.Injectors))
 }
 
-type graphCmd struct {
-	tags   string
-	format string
+type lintCmd struct {
+	tags    string
+	disable string
 }
 
-func (*graphCmd) Name() string { return "graph" }
-func (*graphCmd) Synopsis() string {
-	return "visualize providers as graph using grpahviz or cytospace"
+func (*lintCmd) Name() string { return "lint" }
+func (*lintCmd) Synopsis() string {
+	return "report unused providers, bindings and imports and duplicate bindings"
 }
-func (*graphCmd) Usage() string {
-	return `graph [package] [name]
+func (*lintCmd) Usage() string {
+	return `lint [-disable rule,...] [packages]
 
-  Given a package and name, graph visualizes the dependencies of providers using Graphviz.
+  Given one or more packages, lint solves each injector and reports problems
+  in the provider sets reachable from the injectors that do not prevent
+  generating them, one per line with its position. The rules are:
+
+    unused-provider    a provider that no injector calls
+    duplicate-binding  a type provided more than once to an injector, for
+                       every such type rather than only the first
+    unused-binding     a wire.Bind whose interface no injector consumes
+    unused-import      a provider set imported by another set that provides
+                       nothing any injector uses through that import
+
+  Pass -disable with a comma-separated list of rules to skip them. lint exits
+  with a non-zero status if an enabled rule reports a problem or an injector
+  fails to solve.
+
+  If no packages are listed, it defaults to ".".
 `
 }
-func (cmd *graphCmd) SetFlags(f *flag.FlagSet) {
+func (cmd *lintCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
-	f.StringVar(&cmd.format, "format", "graphviz", "specify the output format (graphviz or cytospace)")
+	f.StringVar(&cmd.disable, "disable", "", "comma-separated list of rules to disable: "+strings.Join(wire.LintRules, ", "))
 }
-func (cmd *graphCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+func (cmd *lintCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	wd, err := os.Getwd()
 	if err != nil {
-		log.Println("failed to get working directory: ", err)
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
+	}
+	return cmd.run(ctx, wd, os.Environ(), os.Stdout, packages(f))
+}
+
+// run lints the packages matching patterns in wd, writing the findings to w.
+func (cmd *lintCmd) run(ctx context.Context, wd string, env []string, w io.Writer, patterns []string) subcommands.ExitStatus {
+	enabled := make(map[string]bool)
+	for _, rule := range wire.LintRules {
+		enabled[rule] = true
+	}
+	if cmd.disable != "" {
+		for _, rule := range strings.Split(cmd.disable, ",") {
+			rule = strings.TrimSpace(rule)
+			if _, ok := enabled[rule]; !ok {
+				logging.Errorf("unknown lint rule %q; want one of %s", rule, strings.Join(wire.LintRules, ", "))
+				return subcommands.ExitFailure
+			}
+			enabled[rule] = false
+		}
+	}
+	findings, errs := wire.Lint(ctx, wd, env, cmd.tags, patterns, enabled)
+	for _, f := range findings {
+		fmt.Fprintln(w, f.Error())
+	}
+	if len(errs) > 0 {
+		logErrors(errs)
+		logging.Errorf("lint failed")
+		return subcommands.ExitFailure
+	}
+	if len(findings) > 0 {
+		logging.Errorf("lint reported %d problem(s)", len(findings))
 		return subcommands.ExitFailure
 	}
-	if len(f.Args()) != 2 {
-		log.Println("graph requires two arguments: package and name")
+	return subcommands.ExitSuccess
+}
+
+type fmtCmd struct {
+	tags  string
+	check bool
+}
+
+func (*fmtCmd) Name() string { return "fmt" }
+func (*fmtCmd) Synopsis() string {
+	return "normalize provider set declarations"
+}
+func (*fmtCmd) Usage() string {
+	return `fmt [-check] [-tags tag,list] [packages]
+
+  Given one or more packages, fmt rewrites the arguments of wire.NewSet and
+  wire.Build calls to one element per line with a trailing comma, sorted into
+  groups: provider sets, nested sets, function providers, and then wire.Bind,
+  wire.Value, wire.Struct and wire.FieldsOf. Comments move with the element
+  they are attached to.
+
+  With -check, fmt lists the files that would change without writing them
+  and fails if there are any.
+
+  If no packages are listed, it defaults to ".".
+`
+}
+func (cmd *fmtCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.check, "check", false, "list files that would change instead of writing them")
+}
+func (cmd *fmtCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
 		return subcommands.ExitFailure
 	}
-	pattern := []string{f.Args()[0]}
-	name := f.Args()[1]
-	data, errs := wire.Graph(ctx, wd, os.Environ(), pattern, name, cmd.tags, cmd.format)
+	results, errs := wire.Format(ctx, wd, os.Environ(), cmd.tags, packages(f))
 	if len(errs) > 0 {
 		logErrors(errs)
-		log.Println("graph failed")
+		logging.Errorf("fmt failed")
+		return subcommands.ExitFailure
+	}
+	changed := false
+	for _, r := range results {
+		if !r.Changed {
+			continue
+		}
+		changed = true
+		if cmd.check {
+			fmt.Println(r.Path)
+			continue
+		}
+		if err := r.Commit(); err != nil {
+			logging.Errorf("failed to write %s: %v", r.Path, err)
+			return subcommands.ExitFailure
+		}
+		logging.Infof("wrote %s", r.Path)
+	}
+	if cmd.check && changed {
 		return subcommands.ExitFailure
 	}
-	// Print the graph data to stdout as output
-	fmt.Println(data)
 	return subcommands.ExitSuccess
 }
 
 type lspCmd struct {
-	tags string
+	// opts configures the server of each client, as set by the flags.
+	opts lsp.Options
+	// listen is the address to accept clients on, as tcp://host:port or
+	// ws://host:port, rather than serving a single client over stdio.
+	listen string
+	// allowOrigins are the origins of the web pages, besides loopback ones,
+	// whose WebSocket clients are accepted.
+	allowOrigins stringsFlag
+	// logLevelName and logPath are the -log_level and -log_file flags, see
+	// opts.
+	logLevelName string
+	logPath      string
 }
 
 func (*lspCmd) Name() string { return "lsp" }
@@ -756,247 +2535,272 @@ func (*lspCmd) Synopsis() string {
 	return "lsp starts interactive language server"
 }
 func (*lspCmd) Usage() string {
-	return `lsp
+	return `lsp [-tags tag,list] [-listen tcp://host:port|ws://host:port] [-allow_origin origin,list] [-verbose]
 
   lsp starts an interactive language server that exchanges data in JSON.
+
+  By default, the server talks to a single client over stdio. With -listen,
+  it accepts clients, such as editors in remote containers, on a TCP port,
+  exchanging messages with Content-Length headers as over stdio, or on a
+  WebSocket, one message per text frame, for browser-based editors. Each
+  client gets a server of its own, and the command runs until killed.
+
+  Clients may run the go command with environment variables and flags of
+  their choosing, so the server listens on the loopback interface unless
+  -listen names a host, and warns if that host is not a loopback one. A
+  WebSocket client opened by a web page is refused unless the page is on a
+  loopback host or its origin, such as https://editor.example.com, is
+  listed with -allow_origin; "*" allows any page.
+
+  The client may replace the build tags of -tags, add environment variables
+  and go command flags, and set the header of generated files and the
+  severity of diagnostics, in its initialization options and later with
+  workspace/didChangeConfiguration.
+
+  Loaded packages are cached until a document in the package or one of its
+  dependencies is opened, changed, saved or closed. With -verbose, cache
+  hits and misses, load durations and the messages received are logged.
+
+  The server logs to the client with window/logMessage, at -log_level and
+  above, and to -log_file if set. Nothing is logged to stderr while a
+  client is served.
 `
 }
 func (cmd *lspCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&cmd.tags, "tags", "", "append build tags to the default wirebuild")
+	f.StringVar(&cmd.opts.Tags, "tags", "", "append build tags to the default wirebuild")
+	f.BoolVar(&cmd.opts.Verbose, "verbose", false, "log cache hits and misses, load durations and received messages")
+	f.StringVar(&cmd.listen, "listen", "", "accept clients on tcp://host:port or ws://host:port instead of serving stdio; the host defaults to 127.0.0.1")
+	f.Var(&cmd.allowOrigins, "allow_origin", "also accept WebSocket clients from web pages of these origins; repeatable or comma-separated")
+	f.StringVar(&cmd.logLevelName, "log_level", "info", "log the messages at this level and above to the client: error, warn, info or debug")
+	f.StringVar(&cmd.logPath, "log_file", "", "also append the log of the server to this file")
 }
 func (cmd *lspCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	if len(f.Args()) != 0 {
-		log.Println("lsp takes no arguments")
+		logging.Errorf("lsp takes no arguments")
 		return subcommands.ExitFailure
 	}
-
-	resCh := make(chan interface{})
-	go func() {
-		for {
-			res := <-resCh
-			lsp.SendMessage(res)
-		}
-	}()
-
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		buf, ok := lsp.ReadBuffer(reader)
-		if !ok {
-			lsp.SendError("failed to read buffer")
-			continue
-		}
-		msg, ok := lsp.ParseMessage(buf)
-		if !ok {
-			lsp.SendError("failed to parse message")
-			continue
+	level, err := logging.ParseLevel(cmd.logLevelName)
+	if err != nil {
+		logging.Errorf("invalid -log_level: %v", err)
+		return subcommands.ExitFailure
+	}
+	if cmd.opts.Verbose && level < logging.LevelInfo {
+		// The messages of -verbose are informational.
+		level = logging.LevelInfo
+	}
+	cmd.opts.LogLevel = level
+	if cmd.logPath != "" {
+		f, err := os.OpenFile(cmd.logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			logging.Errorf("failed to open -log_file: %v", err)
+			return subcommands.ExitFailure
 		}
-		method, ok := msg["method"]
-		if !ok {
-			lsp.SendError("message does not specify method")
-			continue
+		defer f.Close()
+		cmd.opts.LogFile = logging.New(f, "wireplus: ", level)
+		// The messages of the listener and of the default logger, e.g.
+		// with -debug, go to the file too.
+		logging.SetOutput(io.MultiWriter(os.Stderr, f))
+		defer logging.SetOutput(os.Stderr)
+	}
+	if cmd.listen == "" {
+		if err := lsp.NewServer(cmd.opts).Serve(ctx, os.Stdin, os.Stdout); err != nil {
+			logging.Errorf("%v", err)
+			return subcommands.ExitFailure
 		}
-		if _, ok := msg["id"]; !ok {
-			// Notification received
-			// TODO: Sending as error for debugging purposes.
-			lsp.SendError("received notification: %v\n", string(buf))
-			switch method {
-			case "initialized":
-				// Ignore initialized notification.
-			case "exit":
-				return subcommands.ExitFailure
-			// TODO: Support client with autosave disabled.
-			case "textDocument/didOpen", "textDocument/didSave":
-				notif := &lsp.TextDocumentNotification{}
-				if ok := lsp.ParseRequest(buf, notif); !ok {
-					continue
-				}
-				go cmd.handlePublishDiagnosticsNotification(ctx, notif, resCh)
-			default:
-				lsp.SendError("invalid notification: %v\n", string(buf))
-			}
-		} else {
-			// TODO: Sending as error for debugging purposes.
-			lsp.SendError("received request: %v\n", string(buf))
-			switch method {
-			case "initialize":
-				req := &lsp.InitializeRequest{}
-				if ok := lsp.ParseRequest(buf, req); !ok {
-					continue
-				}
-				go cmd.handleInitializeRequest(req, resCh)
-			case "shutdown":
-				req := &lsp.ShutdownRequest{}
-				if ok := lsp.ParseRequest(buf, req); !ok {
-					continue
-				}
-				go cmd.handleShutdownRequest(req, resCh)
-			case "textDocument/codeLens":
-				req := &lsp.CodeLensRequest{}
-				if ok := lsp.ParseRequest(buf, req); !ok {
-					continue
-				}
-				go cmd.handleCodeLensRequest(ctx, req, resCh)
-			default:
-				lsp.SendError("invalid method: %v\n", method)
+		return subcommands.ExitSuccess
+	}
+	u, err := url.Parse(cmd.listen)
+	if err != nil || u.Host == "" || (u.Scheme != "tcp" && u.Scheme != "ws") {
+		logging.Errorf("invalid -listen %q; want tcp://host:port or ws://host:port", cmd.listen)
+		return subcommands.ExitFailure
+	}
+	addr, loopback, err := listenAddr(u.Host)
+	if err != nil {
+		logging.Errorf("invalid -listen %q: %v", cmd.listen, err)
+		return subcommands.ExitFailure
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	logging.Infof("listening on %s://%s", u.Scheme, l.Addr())
+	if !loopback {
+		logging.Warnf("%s is not a loopback address: any client that can connect may run the go command with environment variables and flags of its choosing", l.Addr())
+	}
+	if u.Scheme == "ws" {
+		err = http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t, err := lsp.UpgradeWebSocket(w, r, cmd.allowOrigins)
+			if err != nil {
+				logging.Errorf("%s: %v", r.RemoteAddr, err)
+				return
 			}
-		}
+			cmd.serveClient(ctx, r.RemoteAddr, t)
+		}))
+	} else {
+		err = cmd.acceptTCP(ctx, l)
 	}
+	logging.Errorf("%v", err)
+	return subcommands.ExitFailure
 }
 
-func (cmd *lspCmd) handleInitializeRequest(req *lsp.InitializeRequest, resCh chan interface{}) {
-	res := &lsp.InitializeResponse{
-		Jsonrpc: "2.0",
-		Id:      req.Id,
-		Result: &lsp.InitializeResult{
-			Capabilities: lsp.ServerCapabilities{
-				TextDocumentSync: 2, // 2: Incremental
-				CodeLensProvider: true,
-			},
-		},
+// listenAddr returns the address to listen on for the host:port of -listen,
+// on the loopback interface if the host is empty, and whether it is on a
+// loopback host.
+func listenAddr(hostport string) (string, bool, error) {
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", false, err
 	}
-	wsClientCap := req.Params.Capabilities.Workspace
-	wsConfigCap := wsClientCap.WorkspaceFolders
-	if wsConfigCap {
-		wsServerCap := res.Result.Capabilities.Workspace
-		wsServerCap.WorkspaceFolders.Supported = true
+	if host == "" {
+		host = "127.0.0.1"
 	}
-	resCh <- res
+	return net.JoinHostPort(host, port), lsp.IsLoopback(host), nil
 }
 
-func (cmd *lspCmd) handleShutdownRequest(req *lsp.ShutdownRequest, resCh chan interface{}) {
-	res := &lsp.ShutdownResponse{
-		Jsonrpc: "2.0",
-		Id:      req.Id,
-		Result:  nil,
+// acceptTCP serves each client connecting to l with a server of its own,
+// until l fails.
+func (cmd *lspCmd) acceptTCP(ctx context.Context, l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go cmd.serveClient(ctx, conn.RemoteAddr().String(), lsp.NewStreamTransport(conn, conn))
 	}
-	resCh <- res
 }
 
-func (cmd *lspCmd) handleCodeLensRequest(ctx context.Context, req *lsp.CodeLensRequest, resCh chan interface{}) {
-	res := &lsp.CodeLensResponse{
-		Jsonrpc: "2.0",
-		Id:      req.Id,
-		Result:  nil,
-	}
-	url := lsp.ParseDocumentUri(req.Params.TextDocument.Uri)
-	if url == nil {
-		resCh <- res
+// serveClient serves the client at addr over t with a new server,
+// configured by the flags of cmd, and closes t once the client exits.
+func (cmd *lspCmd) serveClient(ctx context.Context, addr string, t lsp.Transport) {
+	defer t.Close()
+	logging.Infof("client %s connected", addr)
+	if err := lsp.NewServer(cmd.opts).ServeTransport(ctx, t); err != nil {
+		logging.Infof("client %s disconnected: %v", addr, err)
 		return
 	}
-	wd := filepath.Dir(url.Path)
-	pattern := []string{"."}
-	info, errs := wire.Load(ctx, wd, os.Environ(), cmd.tags, pattern)
+	logging.Infof("client %s disconnected", addr)
+}
+
+type debugCmd struct{}
+
+func (*debugCmd) Name() string { return "debug" }
+func (*debugCmd) Synopsis() string {
+	return "dump and replay the analysis of a package for bug reports"
+}
+func (*debugCmd) Usage() string {
+	return `debug dump [-o file] [-redact] [-tags tag,list] [package] [name]
+debug replay file
+
+  debug dump writes a snapshot of the analysis of a package to a zip archive
+  (state.zip by default) that can be attached to a bug report. Given a name,
+  the analysis is the graph of that injector or provider set; otherwise it is
+  the code generated for the package. The snapshot holds the sources of the
+  files the analysis depends on, the go.mod files of their modules, the
+  provider sets of the package and the result. Files and packages that do not
+  contribute to the result are left out. With -redact, the contents of string
+  literals that do not affect the analysis are replaced by "x".
+
+  debug replay runs the analysis recorded in a snapshot again without network
+  access, prints its result and fails if it differs from the recorded one.
+
+  If no package is listed, it defaults to ".".
+`
+}
+func (*debugCmd) SetFlags(f *flag.FlagSet) {}
+func (cmd *debugCmd) Execute(ctx context.Context, f *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	if len(f.Args()) == 0 {
+		logging.Errorf("debug requires an action: dump or replay")
+		return subcommands.ExitUsageError
+	}
+	switch action := f.Args()[0]; action {
+	case "dump":
+		return cmd.dump(ctx, f.Args()[1:])
+	case "replay":
+		return cmd.replay(ctx, f.Args()[1:])
+	default:
+		logging.Errorf("unknown debug action %q; want dump or replay", action)
+		return subcommands.ExitUsageError
+	}
+}
+
+func (cmd *debugCmd) dump(ctx context.Context, args []string) subcommands.ExitStatus {
+	fs := flag.NewFlagSet("debug dump", flag.ContinueOnError)
+	out := fs.String("o", "state.zip", "write the snapshot to this file")
+	redact := fs.Bool("redact", false, "replace the contents of string literals")
+	tags := fs.String("tags", "", "append build tags to the default wirebuild")
+	if err := fs.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if fs.NArg() > 2 {
+		logging.Errorf("debug dump takes at most two arguments: package and name")
+		return subcommands.ExitUsageError
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		logging.Errorf("failed to get working directory: %v", err)
+		return subcommands.ExitFailure
+	}
+	pattern, name := ".", ""
+	if fs.NArg() > 0 {
+		pattern = fs.Arg(0)
+	}
+	if fs.NArg() > 1 {
+		name = fs.Arg(1)
+	}
+	s, errs := wire.Dump(ctx, wd, os.Environ(), *tags, pattern, name, *redact)
 	if len(errs) > 0 {
-		lsp.SendErrors(errs)
-		resCh <- res
-		return
+		logErrors(errs)
+		logging.Errorf("debug dump failed")
+		return subcommands.ExitFailure
 	}
-	if info == nil {
-		resCh <- res
-		return
+	var buf bytes.Buffer
+	if err := s.WriteZip(&buf); err != nil {
+		logging.Errorf("failed to write snapshot: %v", err)
+		return subcommands.ExitFailure
 	}
-	var codeLenses []lsp.CodeLens
-	for _, inj := range info.Injectors {
-		file := info.Fset.File(inj.Pos)
-		if file.Name() != url.Path {
-			continue
-		}
-		codeLenses = append(codeLenses, makeCodeLens(
-			info,
-			inj.Pos,
-			"Show Graph",
-			"wireplus.showGraph",
-			[]interface{}{wd, inj.FuncName}),
-		)
-	}
-	for _, set := range info.Sets {
-		file := info.Fset.File(set.Pos)
-		if file.Name() != url.Path {
-			continue
-		}
-		codeLenses = append(codeLenses, makeCodeLens(
-			info,
-			set.Pos,
-			"Show Graph",
-			"wireplus.showGraph",
-			[]interface{}{wd, set.VarName}),
-		)
-		codeLenses = append(codeLenses, makeCodeLens(
-			info,
-			set.Pos,
-			"Show Detail",
-			"wireplus.showDetail",
-			[]interface{}{wd, set.VarName}),
-		)
-	}
-	res.Result = codeLenses
-	resCh <- res
-}
-
-func makeCodeLens(info *wire.Info, pos token.Pos, title string, cmd string, args []interface{}) lsp.CodeLens {
-	position := info.Fset.Position(pos)
-	line := position.Line - 1
-	char := position.Column - 1
-	return lsp.CodeLens{
-		Range: lsp.Range{
-			Start: lsp.Position{
-				Line:      line,
-				Character: char,
-			},
-			End: lsp.Position{
-				Line:      line,
-				Character: char,
-			},
-		},
-		Command: lsp.Command{
-			Title:     title,
-			Command:   cmd,
-			Arguments: args,
-		},
-	}
-}
-
-func (cmd *lspCmd) handlePublishDiagnosticsNotification(ctx context.Context, event *lsp.TextDocumentNotification, resCh chan interface{}) {
-	url := lsp.ParseDocumentUri(event.Params.TextDocument.Uri)
-	if url == nil {
-		resCh <- nil
-		return
+	if err := ioutil.WriteFile(*out, buf.Bytes(), 0666); err != nil {
+		logging.Errorf("failed to write %s: %v", *out, err)
+		return subcommands.ExitFailure
 	}
-	wd := filepath.Dir(url.Path)
-	pattern := []string{"."}
-	_, errs := wire.Load(ctx, wd, os.Environ(), cmd.tags, pattern)
-	// Need to return an empty slice when no error exists
-	// to clear existing diagnostics
-	diags := make([]lsp.Diagnostic, 0)
-	for _, err := range errs {
-		wireErr := err.(*wire.WireErr)
-		position := wireErr.Position()
-		if position.Filename != url.Path {
-			continue
+	logging.Infof("wrote %s (%d files)", *out, len(s.Files))
+	return subcommands.ExitSuccess
+}
+
+func (cmd *debugCmd) replay(ctx context.Context, args []string) subcommands.ExitStatus {
+	if len(args) != 1 {
+		logging.Errorf("debug replay requires one argument: the snapshot file")
+		return subcommands.ExitUsageError
+	}
+	s, err := wire.ReadSnapshot(args[0])
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	dir, err := ioutil.TempDir("", "wireplus-replay")
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	defer os.RemoveAll(dir)
+	result, errs := wire.Replay(ctx, os.Environ(), s, dir)
+	if len(errs) > 0 {
+		logErrors(errs)
+		logging.Errorf("debug replay failed")
+		return subcommands.ExitFailure
+	}
+	if len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			logging.Errorf("%s", e)
 		}
-		line := wireErr.Position().Line - 1
-		char := wireErr.Position().Column - 1
-		diags = append(diags, lsp.Diagnostic{
-			Range: lsp.Range{
-				Start: lsp.Position{
-					Line:      line,
-					Character: char,
-				},
-				End: lsp.Position{
-					Line:      line + 1,
-					Character: 0,
-				},
-			},
-			Message: wireErr.Message(),
-		})
+	} else if s.Manifest.Name != "" {
+		fmt.Println(result.Output)
+	} else {
+		fmt.Print(result.Output)
 	}
-	res := &lsp.PublishDiagnosticsNotification{
-		Jsonrpc: "2.0",
-		Method:  "textDocument/publishDiagnostics",
-		Params: lsp.PublishDiagnosticsParams{
-			Uri:         event.Params.TextDocument.Uri,
-			Diagnostics: diags,
-		},
+	if !result.Equal(s.Manifest.Result) {
+		logging.Errorf("the replayed result differs from the recorded one")
+		return subcommands.ExitFailure
 	}
-	resCh <- res
+	return subcommands.ExitSuccess
 }
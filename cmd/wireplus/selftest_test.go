@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// TestSelfTestCorpus runs the examples in testdata/selftest, which must all
+// pass against the current tree.
+func TestSelfTestCorpus(t *testing.T) {
+	// The corpus resolves github.com/google/wire to its own copy of the
+	// marker package, which must not fall behind.
+	want, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join("testdata", "selftest", "wire", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("testdata/selftest/wire/wire.go differs from wire.go; copy it over")
+	}
+	root, err := filepath.Abs(filepath.Join("testdata", "selftest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, errs := wire.SelfTest(context.Background(), root, lsptest.ModuleEnv())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(results) < 12 {
+		t.Errorf("got %d examples; want at least 12", len(results))
+	}
+	for _, r := range results {
+		for _, m := range r.Mismatches {
+			t.Errorf("%s: %s does not match:\ngot:\n%s\nwant:\n%s", r.Dir, filepath.Base(m.Path), m.Got, m.Want)
+		}
+	}
+}
+
+func TestSelfTestMismatch(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "wireplus_selftest_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const goMod = `module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`
+	const wireGoFile = `//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initFoo() Foo {
+	wire.Build(NewFoo)
+	return 0
+}
+`
+	lsptest.WriteFiles(t, root, map[string]string{
+		"wire/go.mod":             "module github.com/google/wire\n",
+		"wire/wire.go":            string(wireGo),
+		"app/go.mod":              goMod,
+		"app/selftest.json":       `{"command": "gen"}`,
+		"app/expected_output.txt": "",
+		"app/main.go": `package main
+
+type Foo int
+
+func NewFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": wireGoFile,
+		// broken expects an error, but generation succeeds.
+		"broken/go.mod":              strings.Replace(goMod, "example.com/app", "example.com/broken", 1),
+		"broken/selftest.json":       `{"command": "gen"}`,
+		"broken/expected_output.txt": "wire.go:8:1: inject initFoo: no provider found for example.com/broken.Foo\n",
+		"broken/main.go": `package main
+
+type Foo int
+
+func NewFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"broken/wire.go": wireGoFile,
+	})
+
+	results, errs := wire.SelfTest(context.Background(), root, lsptest.ModuleEnv())
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results; want 2", len(results))
+	}
+	if r := results[0]; r.Dir != "app" || len(r.Mismatches) != 0 {
+		t.Errorf("app: got %d mismatches; want 0", len(r.Mismatches))
+	}
+	r := results[1]
+	if r.Dir != "broken" || len(r.Mismatches) != 1 {
+		t.Fatalf("broken: got %d mismatches; want 1", len(r.Mismatches))
+	}
+	if m := r.Mismatches[0]; filepath.Base(m.Path) != wire.SelfTestOutputFile || m.Got != "" {
+		t.Errorf("broken: got mismatch of %s with output %q; want %s with no output", m.Path, m.Got, wire.SelfTestOutputFile)
+	}
+
+	// -update rewrites the expected output, after which the corpus passes.
+	// The command loads the examples with the environment of the process.
+	for _, kv := range lsptest.ModuleEnv()[len(os.Environ()):] {
+		i := strings.Index(kv, "=")
+		old, ok := os.LookupEnv(kv[:i])
+		os.Setenv(kv[:i], kv[i+1:])
+		if ok {
+			defer os.Setenv(kv[:i], old)
+		} else {
+			defer os.Unsetenv(kv[:i])
+		}
+	}
+	f := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	f.Parse([]string{root})
+	if status := (&selftestCmd{update: true}).Execute(context.Background(), f); status != subcommands.ExitSuccess {
+		t.Fatalf("selftest -update exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(root, "broken", wire.SelfTestOutputFile)); err != nil || len(data) != 0 {
+		t.Errorf("updated %s = %q, %v; want empty", wire.SelfTestOutputFile, data, err)
+	}
+}
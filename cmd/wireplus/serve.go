@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire"
+)
+
+const (
+	// defaultServeAddr is the address graph serve listens on by default,
+	// reachable from the local machine only.
+	defaultServeAddr = "localhost:8080"
+	// defaultEditorURL opens a file at a line and column in VS Code.
+	defaultEditorURL = "vscode://file{file}:{line}:{column}"
+	// defaultCytoscapeURL is the script of cytoscape.js the page loads.
+	// The script is not bundled, as go 1.12 cannot embed it, so the page
+	// needs network access unless -cytoscape names a local copy.
+	defaultCytoscapeURL = "https://unpkg.com/cytoscape@3.26.0/dist/cytoscape.min.js"
+)
+
+// serve runs graph serve with the given arguments, the flags of the action
+// followed by the package and name, in wd.
+func (cmd *graphCmd) serve(ctx context.Context, wd string, env []string, args []string) subcommands.ExitStatus {
+	fs := flag.NewFlagSet("graph serve", flag.ContinueOnError)
+	addr := fs.String("addr", defaultServeAddr, "serve the page on this host:port")
+	browser := fs.Bool("browser", false, "open the page in the default browser")
+	editor := fs.String("editor", defaultEditorURL, "the URL opening a provider in an editor, with {file}, {line} and {column}; empty to disable")
+	cytoscape := fs.String("cytoscape", defaultCytoscapeURL, "the URL of the cytoscape.js script loaded by the page, or the path of a local copy to serve")
+	fs.StringVar(&cmd.tags, "tags", cmd.tags, "append build tags to the default wirebuild")
+	fs.BoolVar(&cmd.criticalPath, "critical-path", cmd.criticalPath, "highlight the most expensive chain of providers")
+	fs.IntVar(&cmd.depth, "depth", cmd.depth, "only draw the nodes within N edges of the root outputs")
+	fs.StringVar(&cmd.focus, "focus", cmd.focus, "only draw the providers of packages with the given import path prefix or of the given type, and their neighbors")
+	fs.StringVar(&cmd.include, "include", cmd.include, "only draw the nodes whose type or provider matches the regular expression, eliding the others")
+	fs.StringVar(&cmd.exclude, "exclude", cmd.exclude, "elide the nodes whose type or provider matches the regular expression")
+	fs.StringVar(&cmd.collapse, "collapse", cmd.collapse, "draw the comma-separated provider sets, e.g. InfraSet or example.com/app.InfraSet, as summary nodes")
+	fs.StringVar(&cmd.edgeLabels, "edge-labels", cmd.edgeLabels, "label the edges with the parameters or fields consuming them (param), and their positions (position)")
+	fs.StringVar(&cmd.cluster, "cluster", cmd.cluster, "group the providers by the provider set they come from (set) or by the package declaring them (package)")
+	if err := fs.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if fs.NArg() != 2 {
+		logging.Errorf("graph serve requires two arguments: package and name")
+		return subcommands.ExitUsageError
+	}
+	filter, err := cmd.filter()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	cluster, err := cmd.clusterBy()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	edgeLabels, err := cmd.labelEdges()
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	srv := newGraphServer(cmd, wd, env, []string{fs.Arg(0)}, fs.Arg(1))
+	srv.filter = filter
+	srv.cluster = cluster
+	srv.edgeLabels = edgeLabels
+	srv.editor = *editor
+	if err := srv.setCytoscape(*cytoscape); err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	// Fail before listening if the graph cannot be drawn at all.
+	if errs := srv.update(ctx); len(errs) > 0 {
+		logErrors(errs)
+		if srv.elems == nil {
+			logging.Errorf("graph failed")
+			return subcommands.ExitFailure
+		}
+		logging.Warnf("%s is drawn despite the errors above", srv.name)
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return subcommands.ExitFailure
+	}
+	u := "http://" + l.Addr().String() + "/"
+	logging.Infof("serving the graph of %s at %s", srv.name, u)
+	if *browser {
+		if err := openBrowser(u); err != nil {
+			logging.Warnf("failed to open a browser: %v", err)
+		}
+	}
+	go srv.watch(ctx, defaultPollInterval, defaultDebounce)
+	logging.Errorf("%v", http.Serve(l, srv.handler()))
+	return subcommands.ExitFailure
+}
+
+// graphServer serves the graph of an injector or provider set as a page
+// drawing it with cytoscape.js, and draws it again whenever the files it
+// depends on change.
+type graphServer struct {
+	cmd     *graphCmd
+	wd      string
+	env     []string
+	pattern []string
+	name    string
+	// editor is the URL template opening a provider in an editor, see
+	// defaultEditorURL, or empty if providers are not linked.
+	editor string
+	// cytoscape is the URL of the cytoscape.js script.
+	cytoscape string
+	// cytoscapeFile is the local copy of the script served at
+	// /cytoscape.js, or empty if the page loads it from elsewhere.
+	cytoscapeFile string
+	// filter limits the nodes drawn, or is nil to draw them all.
+	filter *wire.GraphFilter
+	// cluster is how the providers are grouped into compound nodes.
+	cluster wire.GraphCluster
+	// edgeLabels is how the edges are labeled.
+	edgeLabels wire.GraphEdgeLabels
+
+	mu sync.Mutex
+	// elems is the graph last drawn, as cytoscape.js elements, which may
+	// be partial if providers are missing, or have cycles.
+	elems json.RawMessage
+	// errs are the errors of the last attempt to draw the graph, if it
+	// failed, in which case elems is kept from before unless it was drawn
+	// anyway.
+	errs []string
+	// version is incremented each time the graph is drawn or fails to.
+	version int
+	// updated is closed and replaced when version is incremented.
+	updated chan struct{}
+}
+
+func newGraphServer(cmd *graphCmd, wd string, env []string, pattern []string, name string) *graphServer {
+	return &graphServer{
+		cmd:       cmd,
+		wd:        wd,
+		env:       env,
+		pattern:   pattern,
+		name:      name,
+		editor:    defaultEditorURL,
+		cytoscape: defaultCytoscapeURL,
+		updated:   make(chan struct{}),
+	}
+}
+
+// setCytoscape sets the script of cytoscape.js the page loads to the URL
+// or, if it has no scheme, the local file script, which is then served
+// along with the page so that it works offline.
+func (srv *graphServer) setCytoscape(script string) error {
+	if strings.Contains(script, "://") {
+		srv.cytoscape, srv.cytoscapeFile = script, ""
+		return nil
+	}
+	if _, err := os.Stat(script); err != nil {
+		return fmt.Errorf("-cytoscape: %v", err)
+	}
+	srv.cytoscape, srv.cytoscapeFile = "/cytoscape.js", script
+	return nil
+}
+
+// update draws the graph again and notifies the pages, returning the
+// errors if it fails.
+func (srv *graphServer) update(ctx context.Context) []error {
+	cmd := srv.cmd
+	data, _, errs := wire.Graph(ctx, srv.wd, srv.env, srv.pattern, srv.name, cmd.tags, "cytospace", cmd.criticalPath, nil, srv.filter, srv.cluster, srv.edgeLabels)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.errs = nil
+	for _, err := range errs {
+		srv.errs = append(srv.errs, err.Error())
+	}
+	// A graph drawn with missing providers or cycles is shown along with
+	// the errors.
+	if data != "" {
+		srv.elems = json.RawMessage(data)
+	}
+	srv.version++
+	close(srv.updated)
+	srv.updated = make(chan struct{})
+	return errs
+}
+
+// watch polls the files the graph depends on, as gen -watch does, and
+// draws the graph again once changes settle, until ctx is done.
+func (srv *graphServer) watch(ctx context.Context, interval, debounce time.Duration) {
+	files := srv.watchFiles(ctx, nil)
+	stats := statFiles(files)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var changed bool
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := statFiles(files)
+		for path := range files {
+			if cur[path] != stats[path] {
+				changed = true
+				lastChange = time.Now()
+			}
+		}
+		stats = cur
+		if !changed || time.Since(lastChange) < debounce {
+			continue
+		}
+		changed = false
+		start := time.Now()
+		if errs := srv.update(ctx); len(errs) > 0 {
+			logErrors(errs)
+			logging.Errorf("failed to draw the graph of %s in %v", srv.name, time.Since(start))
+		} else {
+			logging.Infof("redrew the graph of %s in %v", srv.name, time.Since(start))
+		}
+		// The changes may have added or removed files or dependencies.
+		prev := stats
+		files = srv.watchFiles(ctx, files)
+		stats = statFiles(files)
+		for path := range stats {
+			if st, ok := prev[path]; ok {
+				stats[path] = st
+			}
+		}
+	}
+}
+
+// watchFiles returns the files the graph depends on, as returned by
+// wire.WatchFiles, or prev if the packages fail to load.
+func (srv *graphServer) watchFiles(ctx context.Context, prev map[string][]string) map[string][]string {
+	files, errs := wire.WatchFiles(ctx, srv.wd, srv.env, srv.cmd.tags, srv.pattern)
+	if len(errs) > 0 {
+		return prev
+	}
+	return files
+}
+
+// graphState is the response of /graph.json.
+type graphState struct {
+	Name     string          `json:"name"`
+	Version  int             `json:"version"`
+	Elements json.RawMessage `json:"elements"`
+	Errors   []string        `json:"errors,omitempty"`
+}
+
+// handler returns the handler of the page at /, the graph at /graph.json,
+// the server-sent events at /events, whose data is the version of the
+// graph, sent once connected and whenever the graph is drawn again, and
+// the local copy of cytoscape.js at /cytoscape.js if there is one.
+func (srv *graphServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	if srv.cytoscapeFile != "" {
+		mux.HandleFunc("/cytoscape.js", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/javascript")
+			http.ServeFile(w, r, srv.cytoscapeFile)
+		})
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		graphPage.Execute(w, map[string]string{
+			"Name":      srv.name,
+			"Editor":    srv.editor,
+			"Cytoscape": srv.cytoscape,
+		})
+	})
+	mux.HandleFunc("/graph.json", func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		state := graphState{Name: srv.name, Version: srv.version, Elements: srv.elems, Errors: srv.errs}
+		srv.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		for {
+			srv.mu.Lock()
+			version, updated := srv.version, srv.updated
+			srv.mu.Unlock()
+			fmt.Fprintf(w, "data: %d\n\n", version)
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-updated:
+			}
+		}
+	})
+	return mux
+}
+
+// graphPage draws the graph of /graph.json with cytoscape.js, and draws it
+// again on each event of /events with a new version.
+var graphPage = template.Must(template.New("graph").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - wireplus graph</title>
+<script src="{{.Cytoscape}}"></script>
+<style>
+  html, body { margin: 0; height: 100%; font-family: sans-serif; }
+  #bar { position: absolute; top: 0; left: 0; right: 0; z-index: 1; padding: 8px; background: #f4f4f4; border-bottom: 1px solid #ccc; }
+  #bar input { width: 20em; }
+  #bar span { margin-left: 1em; color: #666; font-size: small; }
+  #errors { display: none; white-space: pre-wrap; color: #b00; margin: 8px 0 0; font-size: small; }
+  #cy { position: absolute; top: 40px; left: 0; right: 0; bottom: 0; }
+</style>
+</head>
+<body>
+<div id="bar">
+  <input id="search" type="search" placeholder="Search providers and types" autofocus>
+  <span>Enter zooms to the matches; double-click a provider set to collapse or expand it; click a provider to open it in the editor.</span>
+  <pre id="errors"></pre>
+</div>
+<div id="cy"></div>
+<script>
+var editor = {{.Editor}};
+var version = -1;
+var cy = cytoscape({
+  container: document.getElementById('cy'),
+  wheelSensitivity: 0.2,
+  style: [
+    {selector: 'node', style: {
+      'label': 'data(content)', 'shape': 'data(shape)', 'text-wrap': 'wrap',
+      'text-valign': 'center', 'text-halign': 'center', 'font-size': 10,
+      'width': 'label', 'height': 'label', 'padding': 8,
+      'background-color': '#fff', 'border-width': 1, 'border-color': '#333'}},
+    {selector: 'node[?subgraph]', style: {
+      'text-valign': 'top', 'background-color': '#f0f4ff', 'border-style': 'dashed'}},
+    {selector: 'node[cost = "medium"]', style: {'border-width': 2}},
+    {selector: 'node[cost = "heavy"]', style: {'border-width': 4}},
+    {selector: 'node[?critical], edge[?critical]', style: {'border-color': 'blue', 'line-color': 'blue', 'target-arrow-color': 'blue'}},
+    {selector: '.declared', style: {'background-color': 'lightyellow'}},
+    {selector: '.conditional', style: {'border-style': 'dashed'}},
+    {selector: 'node[?missing]', style: {'color': 'red', 'border-color': 'red', 'border-style': 'dashed'}},
+    {selector: 'node[?cycle]', style: {'color': 'magenta', 'border-color': 'magenta'}},
+    {selector: '.collapsed, .folded', style: {'border-style': 'dotted', 'background-color': '#eee'}},
+    {selector: '.heat-1', style: {'background-color': '#ffe5e5'}},
+    {selector: '.heat-2', style: {'background-color': '#ffbfbf'}},
+    {selector: '.heat-3', style: {'background-color': '#ff9999'}},
+    {selector: '.heat-4', style: {'background-color': '#ff7272'}},
+    {selector: '.heat-5', style: {'background-color': '#ff4c4c'}},
+    {selector: 'edge', style: {
+      'width': 1, 'curve-style': 'bezier', 'target-arrow-shape': 'triangle',
+      'line-color': '#666', 'target-arrow-color': '#666'}},
+    {selector: 'edge.folded', style: {'line-style': 'dotted'}},
+    {selector: 'edge[?elided]', style: {'line-style': 'dashed'}},
+    {selector: 'edge[cycle]', style: {'label': 'data(cycle)', 'color': 'magenta', 'line-color': 'magenta', 'target-arrow-color': 'magenta', 'text-wrap': 'wrap'}},
+    {selector: 'edge[label]', style: {'label': 'data(label)', 'font-size': 10, 'text-wrap': 'wrap'}},
+    {selector: '.match', style: {'border-color': '#e08000', 'border-width': 3}},
+    {selector: '.faded', style: {'opacity': 0.25}}
+  ]
+});
+
+// Folded provider sets keep their removed elements until expanded.
+var folded = {};
+
+function fold(set) {
+  var inner = set.descendants();
+  inner.connectedEdges().forEach(function (e) {
+    var s = inner.contains(e.source()) ? set : e.source();
+    var t = inner.contains(e.target()) ? set : e.target();
+    var id = 'folded:' + s.id() + '->' + t.id();
+    if (s !== t && cy.getElementById(id).empty()) {
+      cy.add({group: 'edges', data: {id: id, source: s.id(), target: t.id()}, classes: 'folded'});
+    }
+  });
+  folded[set.id()] = inner.union(inner.connectedEdges()).remove();
+  set.addClass('folded');
+}
+
+function unfold(set) {
+  set.connectedEdges('.folded').remove();
+  folded[set.id()].restore();
+  delete folded[set.id()];
+  set.removeClass('folded');
+}
+
+cy.on('dbltap', 'node[?subgraph]', function (evt) {
+  var set = evt.target;
+  if (folded[set.id()]) {
+    unfold(set);
+  } else {
+    fold(set);
+  }
+});
+
+cy.on('tap', 'node', function (evt) {
+  var command = evt.target.data('command');
+  if (!editor || !command || evt.target.data('subgraph')) {
+    return;
+  }
+  var args = command.arguments;
+  window.location.href = editor.replace('{file}', encodeURI(args[0]))
+    .replace('{line}', args[1]).replace('{column}', args[2]);
+});
+
+// Hovering a provider shows its tooltip.
+cy.on('mouseover', 'node[tooltip]', function (evt) {
+  cy.container().title = evt.target.data('tooltip');
+});
+cy.on('mouseout', 'node', function () {
+  cy.container().title = '';
+});
+
+function search(query) {
+  cy.elements().removeClass('match faded');
+  query = query.trim().toLowerCase();
+  if (!query) {
+    return cy.collection();
+  }
+  var matches = cy.nodes().filter(function (n) {
+    return n.id().toLowerCase().indexOf(query) >= 0 ||
+      String(n.data('content')).toLowerCase().indexOf(query) >= 0;
+  });
+  matches.addClass('match');
+  var near = matches.closedNeighborhood().union(matches.ancestors());
+  cy.elements().not(near).addClass('faded');
+  return matches;
+}
+
+var input = document.getElementById('search');
+input.addEventListener('input', function () { search(input.value); });
+input.addEventListener('keydown', function (evt) {
+  if (evt.key === 'Enter') {
+    var matches = search(input.value);
+    cy.fit(matches.nonempty() ? matches : undefined, 50);
+  }
+});
+
+function load() {
+  fetch('graph.json').then(function (res) { return res.json(); }).then(function (state) {
+    var errors = document.getElementById('errors');
+    errors.textContent = (state.errors || []).join('\n');
+    errors.style.display = state.errors ? 'block' : 'none';
+    version = state.version;
+    folded = {};
+    cy.elements().remove();
+    cy.add(state.elements.nodes.map(function (n) { return Object.assign({group: 'nodes'}, n); }));
+    cy.add(state.elements.edges.map(function (e) { return Object.assign({group: 'edges'}, e); }));
+    cy.layout({name: 'breadthfirst', directed: true, spacingFactor: 1.2}).run();
+    search(input.value);
+  });
+}
+
+new EventSource('events').onmessage = function (evt) {
+  if (Number(evt.data) !== version) {
+    load();
+  }
+};
+</script>
+</body>
+</html>
+`))
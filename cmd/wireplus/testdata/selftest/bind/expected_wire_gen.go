@@ -0,0 +1,14 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initGreeter() Greeter {
+	mainEnglishGreeter := NewEnglishGreeter()
+	return mainEnglishGreeter
+}
@@ -0,0 +1,17 @@
+package main
+
+import "fmt"
+
+type Greeter interface {
+	Greet() string
+}
+
+type englishGreeter struct{}
+
+func (englishGreeter) Greet() string { return "hello" }
+
+func NewEnglishGreeter() *englishGreeter { return new(englishGreeter) }
+
+func main() {
+	fmt.Println(initGreeter().Greet())
+}
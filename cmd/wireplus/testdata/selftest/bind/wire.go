@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initGreeter() Greeter {
+	wire.Build(NewEnglishGreeter, wire.Bind(new(Greeter), new(*englishGreeter)))
+	return nil
+}
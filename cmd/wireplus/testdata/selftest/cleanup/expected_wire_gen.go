@@ -0,0 +1,21 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initServer() (*Server, func(), error) {
+	db, cleanup, err := OpenDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	server, cleanup2 := NewServer(db)
+	return server, func() {
+		cleanup2()
+		cleanup()
+	}, nil
+}
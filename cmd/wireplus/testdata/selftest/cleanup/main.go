@@ -0,0 +1,18 @@
+package main
+
+type DB struct{}
+
+type Server struct {
+	db *DB
+}
+
+func OpenDB() (*DB, func(), error) { return new(DB), func() {}, nil }
+
+func NewServer(db *DB) (*Server, func()) { return &Server{db: db}, func() {} }
+
+func main() {
+	_, cleanup, err := initServer()
+	if err == nil {
+		cleanup()
+	}
+}
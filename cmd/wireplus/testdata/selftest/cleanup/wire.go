@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initServer() (*Server, func(), error) {
+	wire.Build(OpenDB, NewServer)
+	return nil, nil, nil
+}
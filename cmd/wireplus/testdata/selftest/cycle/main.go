@@ -0,0 +1,13 @@
+package main
+
+type A struct{}
+
+type B struct{}
+
+func NewA(b *B) *A { return new(A) }
+
+func NewB(a *A) *B { return new(B) }
+
+func main() {
+	initA()
+}
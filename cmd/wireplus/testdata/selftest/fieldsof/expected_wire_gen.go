@@ -0,0 +1,16 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initServer() *Server {
+	options := NewOptions()
+	string2 := options.Addr
+	server := NewServer(string2)
+	return server
+}
@@ -0,0 +1,18 @@
+package main
+
+type Options struct {
+	Addr    string
+	Verbose bool
+}
+
+type Server struct {
+	addr string
+}
+
+func NewOptions() Options { return Options{Addr: ":8080"} }
+
+func NewServer(addr string) *Server { return &Server{addr: addr} }
+
+func main() {
+	initServer()
+}
@@ -0,0 +1,15 @@
+package main
+
+import "context"
+
+type Config struct {
+	Addr string
+}
+
+type Client struct{}
+
+func NewClient(ctx context.Context, cfg *Config) (*Client, error) { return new(Client), nil }
+
+func main() {
+	initClient(context.Background(), &Config{Addr: ":8080"})
+}
@@ -0,0 +1,15 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import (
+	"context"
+
+	"github.com/google/wire"
+)
+
+func initClient(ctx context.Context, cfg *Config) (*Client, error) {
+	wire.Build(NewClient)
+	return nil, nil
+}
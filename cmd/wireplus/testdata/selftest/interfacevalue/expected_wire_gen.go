@@ -0,0 +1,23 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+import (
+	"os"
+)
+
+// Injectors from wire.go:
+
+func initLogger() *Logger {
+	writer := _wireFileValue
+	logger := NewLogger(writer)
+	return logger
+}
+
+var (
+	_wireFileValue = os.Stdout
+)
@@ -0,0 +1,13 @@
+package main
+
+import "io"
+
+type Logger struct {
+	w io.Writer
+}
+
+func NewLogger(w io.Writer) *Logger { return &Logger{w: w} }
+
+func main() {
+	initLogger()
+}
@@ -0,0 +1,16 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/google/wire"
+)
+
+func initLogger() *Logger {
+	wire.Build(NewLogger, wire.InterfaceValue(new(io.Writer), os.Stdout))
+	return nil
+}
@@ -0,0 +1,11 @@
+package main
+
+type Config struct{}
+
+type Server struct{}
+
+func NewServer(cfg *Config) *Server { return new(Server) }
+
+func main() {
+	initServer()
+}
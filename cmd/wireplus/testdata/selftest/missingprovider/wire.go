@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(NewServer)
+	return nil
+}
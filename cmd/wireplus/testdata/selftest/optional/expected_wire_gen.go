@@ -0,0 +1,18 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initApp() *App {
+	cache, ok := LookupCache()
+	if !ok {
+		cache = nil
+	}
+	app := NewApp(cache)
+	return app
+}
@@ -0,0 +1,15 @@
+package main
+
+type Cache struct{}
+
+type App struct {
+	cache *Cache
+}
+
+func LookupCache() (*Cache, bool) { return nil, false }
+
+func NewApp(cache *Cache) *App { return &App{cache: cache} }
+
+func main() {
+	initApp()
+}
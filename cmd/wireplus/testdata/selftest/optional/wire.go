@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initApp() *App {
+	wire.Build(wire.Optional(new(*Cache)), LookupCache, NewApp)
+	return nil
+}
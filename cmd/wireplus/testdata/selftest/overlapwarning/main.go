@@ -0,0 +1,15 @@
+package main
+
+type Config struct{}
+
+type App struct{}
+
+func NewConfig() Config { return Config{} }
+
+func NewConfigPtr() *Config { return new(Config) }
+
+func NewApp(c Config, p *Config) *App { return new(App) }
+
+func main() {
+	initApp()
+}
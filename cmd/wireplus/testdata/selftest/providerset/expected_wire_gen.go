@@ -0,0 +1,16 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initApp() *App {
+	config := NewConfig()
+	store := NewStore(config)
+	app := NewApp(store)
+	return app
+}
@@ -0,0 +1,25 @@
+package main
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type Store struct{}
+
+type App struct {
+	store *Store
+}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewStore(cfg *Config) *Store { return new(Store) }
+
+func NewApp(store *Store) *App { return &App{store: store} }
+
+var StoreSet = wire.NewSet(NewConfig, NewStore)
+
+var AppSet = wire.NewSet(StoreSet, NewApp)
+
+func main() {
+	initApp()
+}
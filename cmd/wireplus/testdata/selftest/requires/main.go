@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/wire"
+)
+
+type Config struct{}
+
+type Server struct{}
+
+func NewServer(ctx context.Context, cfg *Config) *Server { return new(Server) }
+
+var ServerSet = wire.NewSet(wire.Requires(new(*Config)), NewServer)
+
+func main() {}
@@ -0,0 +1,19 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initService() *Service {
+	config := NewConfig()
+	cache := NewCache()
+	service := &Service{
+		Config: config,
+		Cache:  cache,
+	}
+	return service
+}
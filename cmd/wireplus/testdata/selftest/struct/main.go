@@ -0,0 +1,19 @@
+package main
+
+type Config struct{}
+
+type Cache struct{}
+
+type Service struct {
+	Config *Config
+	Cache  *Cache
+	name   string
+}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewCache() *Cache { return new(Cache) }
+
+func main() {
+	initService()
+}
@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initService() *Service {
+	wire.Build(NewConfig, NewCache, wire.Struct(new(Service), "Config", "Cache"))
+	return nil
+}
@@ -0,0 +1,13 @@
+package main
+
+type Config struct{}
+
+type Logger struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewLogger() *Logger { return new(Logger) }
+
+func main() {
+	initConfig()
+}
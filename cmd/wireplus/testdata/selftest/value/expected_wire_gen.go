@@ -0,0 +1,19 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func initServer() *Server {
+	config := _wireConfigValue
+	server := NewServer(config)
+	return server
+}
+
+var (
+	_wireConfigValue = Config{Addr: ":8080", Retries: 3}
+)
@@ -0,0 +1,7 @@
+module example.com/value
+
+go 1.12
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+type Config struct {
+	Addr    string
+	Retries int
+}
+
+type Server struct {
+	cfg Config
+}
+
+func NewServer(cfg Config) *Server { return &Server{cfg: cfg} }
+
+func main() {
+	fmt.Println(initServer().cfg.Addr)
+}
@@ -0,0 +1,11 @@
+//go:build wireinject
+// +build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(NewServer, wire.Value(Config{Addr: ":8080", Retries: 3}))
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/subcommands"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+func TestUsage(t *testing.T) {
+	root, wd := writeGraphModule(t)
+	defer os.RemoveAll(root)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	cmd := usageCmd{}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{"NewConfig"}); status != subcommands.ExitSuccess {
+		t.Fatalf("usage exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	want := "Injector \"example.com/app\".initApp:\n" +
+		"\tprovider example.com/app.NewConfig for *example.com/app.Config (" + filepath.Join(wd, "app.go") + ":9:6)\n" +
+		"\t\tvia \"example.com/app\".AppSet\n" +
+		"NewConfig is used by 1 of 1 injector(s)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("usage printed:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	cmd = usageCmd{json: true}
+	if status := cmd.run(ctx, wd, lsptest.ModuleEnv(), &buf, []string{".", "*example.com/app.App"}); status != subcommands.ExitSuccess {
+		t.Fatalf("usage -json exited with status %d; want %d", status, subcommands.ExitSuccess)
+	}
+	var report wire.UsageReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if report.Used() != 1 || report.Injectors[0].Matches[0].Name != "example.com/app.NewApp" {
+		t.Errorf("usage -json printed %s; want NewApp used by initApp", buf.String())
+	}
+
+	// A provider that no injector uses fails, as does a missing target.
+	for _, args := range [][]string{{".", "NewServer"}, {}} {
+		buf.Reset()
+		if status := (&usageCmd{}).run(ctx, wd, lsptest.ModuleEnv(), &buf, args); status != subcommands.ExitFailure {
+			t.Errorf("usage %q exited with status %d; want %d", args, status, subcommands.ExitFailure)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+// Package logging provides the leveled logger used by wireplus.
+//
+// Messages are written to stderr by default, one per line, after the
+// "wireplus: " prefix, so that output meant for other tools, such as the
+// -json modes of the subcommands, stays on stdout. Warnings are marked with
+// "warning: " and debug messages with "debug: ".
+//
+// Debug messages are structured as an event name followed by key=value
+// pairs, e.g.
+//
+//	wireplus: debug: phase name=load duration=1.2s
+//
+// The events logged by wireplus are:
+//
+//	load.config  dir, tags, mode and env: the config passed to packages.Load
+//	load.result  patterns and packages: the expansion of the patterns
+//	cache        name, hits and misses: the decisions of a cache
+//	phase        name and duration: the time spent in a phase of a command
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Level is the severity of a message.
+type Level int
+
+// The levels of messages, from the most to the least severe.
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	}
+	return "unknown"
+}
+
+// ParseLevel returns the level named s, as returned by Level.String.
+func ParseLevel(s string) (Level, error) {
+	for l := LevelError; l <= LevelDebug; l++ {
+		if s == l.String() {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q; want error, warn, info or debug", s)
+}
+
+// tags holds the tag written before the messages of each level.
+var tags = [...]string{
+	LevelError: "",
+	LevelWarn:  "warning: ",
+	LevelInfo:  "",
+	LevelDebug: "debug: ",
+}
+
+// A Logger writes the messages at or above its level to a writer. A Logger
+// is safe for concurrent use.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	level  Level
+	// handle, if not nil, is passed the messages instead of w.
+	handle func(Level, string)
+}
+
+// New returns a Logger writing the messages at or above level to w, each
+// after prefix.
+func New(w io.Writer, prefix string, level Level) *Logger {
+	return &Logger{w: w, prefix: prefix, level: level}
+}
+
+// NewHandler returns a Logger passing the messages at or above level to
+// handle, without prefix or tag, e.g. to forward them to a client as
+// notifications. Calls to handle are serialized.
+func NewHandler(handle func(level Level, msg string), level Level) *Logger {
+	return &Logger{handle: handle, level: level}
+}
+
+// SetOutput sets the writer of l.
+func (l *Logger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w = w
+}
+
+// SetLevel sets the least severe level of the messages written by l.
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Enabled reports whether l writes the messages at level.
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level <= l.level
+}
+
+// Errorf writes an error message.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(LevelError, fmt.Sprintf(format, args...))
+}
+
+// Warnf writes a warning message.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.output(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+// Infof writes an informational message.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Debug writes the debug event with the given key and value pairs.
+// Values containing spaces or quotes are quoted.
+func (l *Logger) Debug(event string, kv ...interface{}) {
+	if !l.Enabled(LevelDebug) {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(event)
+	for i := 0; i < len(kv); i += 2 {
+		var v interface{} = "<missing>"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		s := fmt.Sprint(v)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(&sb, " %v=%s", kv[i], s)
+	}
+	l.output(LevelDebug, sb.String())
+}
+
+// Phase starts timing the phase name and returns a function that writes
+// its duration as a debug "phase" event.
+func (l *Logger) Phase(name string) func() {
+	if !l.Enabled(LevelDebug) {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		l.Debug("phase", "name", name, "duration", time.Since(start))
+	}
+}
+
+// Log writes msg at level, as formatted by the other methods, e.g. to
+// copy the messages passed to the handler of another Logger.
+func (l *Logger) Log(level Level, msg string) {
+	if level < LevelError || level > LevelDebug {
+		return
+	}
+	l.output(level, msg)
+}
+
+// output writes msg at level after the tag of level. Multi-line messages
+// are indented after the first line.
+func (l *Logger) output(level Level, msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if level > l.level {
+		return
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+	if l.handle != nil {
+		l.handle(level, msg)
+		return
+	}
+	msg = strings.Replace(msg, "\n", "\n\t", -1)
+	io.WriteString(l.w, l.prefix+tags[level]+msg+"\n")
+}
+
+var std = New(os.Stderr, "wireplus: ", LevelInfo)
+
+// Default returns the logger used by the package-level functions.
+func Default() *Logger {
+	return std
+}
+
+// SetOutput sets the writer of the default logger.
+func SetOutput(w io.Writer) {
+	std.SetOutput(w)
+}
+
+// SetLevel sets the level of the default logger.
+func SetLevel(level Level) {
+	std.SetLevel(level)
+}
+
+// Errorf writes an error message with the default logger.
+func Errorf(format string, args ...interface{}) {
+	std.Errorf(format, args...)
+}
+
+// Warnf writes a warning message with the default logger.
+func Warnf(format string, args ...interface{}) {
+	std.Warnf(format, args...)
+}
+
+// Infof writes an informational message with the default logger.
+func Infof(format string, args ...interface{}) {
+	std.Infof(format, args...)
+}
+
+// Debug writes a debug event with the default logger.
+func Debug(event string, kv ...interface{}) {
+	std.Debug(event, kv...)
+}
+
+// Phase starts timing a phase with the default logger.
+func Phase(name string) func() {
+	return std.Phase(name)
+}
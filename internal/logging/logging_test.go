@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLevels(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+	}{
+		{LevelError, []string{
+			"test: error",
+		}},
+		{LevelWarn, []string{
+			"test: error",
+			"test: warning: warn",
+		}},
+		{LevelInfo, []string{
+			"test: error",
+			"test: warning: warn",
+			"test: info",
+		}},
+		{LevelDebug, []string{
+			"test: error",
+			"test: warning: warn",
+			"test: info",
+			"test: debug: event key=value",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, "test: ", test.level)
+			l.Errorf("error")
+			l.Warnf("warn")
+			l.Infof("info")
+			l.Debug("event", "key", "value")
+			got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("output diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "test: ", LevelDebug)
+	l.Errorf("first line\nsecond line\n")
+	l.Debug("event", "plain", 42, "spaced", "a b", "empty", "", "odd")
+	want := "test: first line\n" +
+		"\tsecond line\n" +
+		"test: debug: event plain=42 spaced=\"a b\" empty=\"\" odd=<missing>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("output = %q; want %q", got, want)
+	}
+}
+
+func TestPhase(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "test: ", LevelInfo)
+	l.Phase("quiet")()
+	if buf.Len() > 0 {
+		t.Errorf("Phase wrote %q at LevelInfo; want nothing", buf.String())
+	}
+	l.SetLevel(LevelDebug)
+	l.Phase("load")()
+	if got := buf.String(); !regexp.MustCompile(`^test: debug: phase name=load duration=\S+\n$`).MatchString(got) {
+		t.Errorf("Phase wrote %q; want a phase event with name and duration", got)
+	}
+}
+
+func TestDefaultStderr(t *testing.T) {
+	// Logs must not mix with the output of the subcommands on stdout,
+	// such as the -json reports.
+	if Default().w != os.Stderr {
+		t.Error("the default logger does not write to stderr")
+	}
+	if Default().Enabled(LevelDebug) {
+		t.Error("the default logger writes debug messages without -debug")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	type message struct {
+		Level Level
+		Msg   string
+	}
+	var got []message
+	l := NewHandler(func(level Level, msg string) {
+		got = append(got, message{level, msg})
+	}, LevelWarn)
+	l.Errorf("error\n")
+	l.Warnf("warn")
+	l.Infof("info")
+	l.Debug("event", "key", "value")
+	want := []message{{LevelError, "error"}, {LevelWarn, "warn"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("handled messages diff (-want +got):\n%s", diff)
+	}
+
+	// Log formats the handled messages as the other methods.
+	var buf bytes.Buffer
+	copied := New(&buf, "test: ", LevelDebug)
+	for _, m := range got {
+		copied.Log(m.Level, m.Msg)
+	}
+	if got, want := buf.String(), "test: error\ntest: warning: warn\n"; got != want {
+		t.Errorf("Log wrote %q; want %q", got, want)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for l := LevelError; l <= LevelDebug; l++ {
+		if got, err := ParseLevel(l.String()); err != nil || got != l {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", l.String(), got, err, l)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") succeeded; want an error")
+	}
+}
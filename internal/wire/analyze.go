@@ -53,6 +53,10 @@ type call struct {
 	pkg  *types.Package
 	name string
 
+	// pos is the position of the declaration of the provider, value or
+	// field.
+	pos token.Pos
+
 	// args is a list of arguments to call the provider with. Each element is:
 	// a) one of the givens (args[i] < len(given)),
 	// b) the result of a previous provider call (args[i] >= len(given))
@@ -70,6 +74,15 @@ type call struct {
 	// This will only be set if kind == structProvider.
 	fieldNames []string
 
+	// paramNames maps the arguments to the names of the parameters, empty
+	// if unnamed. This will only be set if kind == funcProviderCall.
+	paramNames []string
+
+	// argIndices maps the arguments of a call drawn by filterGraph to the
+	// indices of its original arguments, or -1 for those standing for
+	// elided nodes. It is nil for the calls of a solution.
+	argIndices []int
+
 	// ins is the list of types this call receives as arguments.
 	// This will be nil for kind == valueExpr.
 	ins []types.Type
@@ -80,6 +93,13 @@ type call struct {
 	hasCleanup bool
 	// hasErr is true if the provider call returns an error.
 	hasErr bool
+	// conditional is true if the provider call returns a bool reporting
+	// whether its output was found.
+	conditional bool
+	// cost is the cost category of the provider, if any.
+	cost string
+	// doc is the first sentence of the doc comment of the provider, if any.
+	doc string
 
 	// The following are only set for kind == valueExpr:
 
@@ -91,10 +111,77 @@ type call struct {
 	ptrToField bool
 }
 
+// argIndex returns the index of the original argument of c that its j-th
+// argument stands for, see argIndices.
+func (c *call) argIndex(j int) int {
+	if c.argIndices == nil {
+		return j
+	}
+	return c.argIndices[j]
+}
+
 // solve finds the sequence of calls required to produce an output type
 // with an optional set of provided inputs.
 func solve(fset *token.FileSet, out types.Type, given *types.Tuple, set *ProviderSet) ([]call, []error) {
+	calls, used, errs := solveUsed(fset, out, given, set)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if errs := verifyArgsUsed(fset, set, used); len(errs) > 0 {
+		return nil, errs
+	}
+	return calls, nil
+}
+
+// solveUsed is like solve, but also returns the sources in set that the
+// calls use, without verifying that all of set is used.
+func solveUsed(fset *token.FileSet, out types.Type, given *types.Tuple, set *ProviderSet) ([]call, []*providerSetSrc, []error) {
+	calls, used, errs := solveCalls(fset, out, nil, given, set)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	if hooks := traceHooksType(set); hooks != nil {
+		// The providers of wire.TraceHooks are only called by injectors
+		// generated with the TraceSpans option, but are not unused otherwise.
+		_, hooksUsed, errs := solveCalls(fset, hooks, nil, given, set)
+		if len(errs) > 0 {
+			return nil, nil, errs
+		}
+		used = append(used, hooksUsed...)
+	}
+	return calls, used, nil
+}
+
+// solveWithRoots is like solve, but also produces the types in roots, in
+// order, before producing out. Unless one of the roots depends on out, the
+// last call produces out.
+func solveWithRoots(fset *token.FileSet, out types.Type, roots []types.Type, given *types.Tuple, set *ProviderSet) ([]call, []error) {
+	calls, used, errs := solveCalls(fset, out, roots, given, set)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if errs := verifyArgsUsed(fset, set, used); len(errs) > 0 {
+		return nil, errs
+	}
+	return calls, nil
+}
+
+// solveCalls finds the calls for solveWithRoots along with the sources in
+// set that they use, without verifying that all of set is used.
+func solveCalls(fset *token.FileSet, out types.Type, roots []types.Type, given *types.Tuple, set *ProviderSet) ([]call, []*providerSetSrc, []error) {
+	calls, used, _, errs := solveCallsMissing(fset, out, roots, given, set, false)
+	return calls, used, errs
+}
+
+// solveCallsMissing is like solveCalls, but if tolerateMissing is true,
+// the types without a provider do not fail the solution. They are returned
+// instead, in the order they are needed, and numbered as if they followed
+// the given types: the arguments of the calls are offset accordingly.
+func solveCallsMissing(fset *token.FileSet, out types.Type, roots []types.Type, given *types.Tuple, set *ProviderSet, tolerateMissing bool) ([]call, []*providerSetSrc, []types.Type, []error) {
 	ec := new(errorCollector)
+	// The missing types are indexed by negative numbers until the calls
+	// are renumbered: -1 for the first one.
+	var missing []types.Type
 
 	// Start building the mapping of type to local variable of the given type.
 	// The first len(given) local variables are the given types.
@@ -116,6 +203,9 @@ func solve(fset *token.FileSet, out types.Type, given *types.Tuple, set *Provide
 		up   *frame
 	}
 	stk := []frame{{t: out}}
+	for i := len(roots) - 1; i >= 0; i-- {
+		stk = append(stk, frame{t: roots[i]})
+	}
 dfs:
 	for len(stk) > 0 {
 		curr := stk[len(stk)-1]
@@ -126,17 +216,28 @@ dfs:
 
 		pv := set.For(curr.t)
 		if pv.IsNil() {
+			if tolerateMissing {
+				missing = append(missing, curr.t)
+				index.Set(curr.t, -len(missing))
+				continue
+			}
 			if curr.from == nil {
-				ec.add(fmt.Errorf("no provider found for %s, output of injector", types.TypeString(curr.t, nil)))
+				ec.add(categorized(CategoryNoProvider, fmt.Sprintf("no provider found for %s, output of injector", types.TypeString(curr.t, nil))))
 				index.Set(curr.t, errAbort)
 				continue
 			}
 			sb := new(strings.Builder)
 			fmt.Fprintf(sb, "no provider found for %s", types.TypeString(curr.t, nil))
+			var related []RelatedPosition
 			for f := curr.up; f != nil; f = f.up {
-				fmt.Fprintf(sb, "\nneeded by %s in %s", types.TypeString(f.t, nil), set.srcMap.At(f.t).(*providerSetSrc).description(fset, f.t))
+				src := set.srcMap.At(f.t).(*providerSetSrc)
+				fmt.Fprintf(sb, "\nneeded by %s in %s", types.TypeString(f.t, nil), src.description(fset, f.t))
+				related = append(related, RelatedPosition{
+					Position: fset.Position(src.pos()),
+					Message:  "needed by " + types.TypeString(f.t, nil),
+				})
 			}
-			ec.add(errors.New(sb.String()))
+			ec.add(categorized(CategoryNoProvider, sb.String(), related...))
 			index.Set(curr.t, errAbort)
 			continue
 		}
@@ -176,6 +277,14 @@ dfs:
 			if !visitedArgs {
 				continue
 			}
+			if p.Conditional && !set.isOptional(curr.t) {
+				t := types.TypeString(curr.t, nil)
+				ec.add(fmt.Errorf("provider %s (%v) returns (%s, bool), but %s is not marked by wire.Optional; "+
+					"mark it with wire.Optional to use its zero value when it is not found, or return (%s, error) to fail instead",
+					p.Name, fset.Position(p.Pos), t, t, t))
+				index.Set(curr.t, errAbort)
+				continue
+			}
 			args := make([]int, len(p.Args))
 			ins := make([]types.Type, len(p.Args))
 			for i := range p.Args {
@@ -189,24 +298,33 @@ dfs:
 			}
 			index.Set(curr.t, given.Len()+len(calls))
 			kind := funcProviderCall
-			fieldNames := []string(nil)
+			fieldNames, paramNames := []string(nil), []string(nil)
 			if p.IsStruct {
 				kind = structProvider
 				for _, arg := range p.Args {
 					fieldNames = append(fieldNames, arg.FieldName)
 				}
+			} else {
+				for _, arg := range p.Args {
+					paramNames = append(paramNames, arg.ParamName)
+				}
 			}
 			calls = append(calls, call{
-				kind:       kind,
-				pkg:        p.Pkg,
-				name:       p.Name,
-				args:       args,
-				varargs:    p.Varargs,
-				fieldNames: fieldNames,
-				ins:        ins,
-				out:        curr.t,
-				hasCleanup: p.HasCleanup,
-				hasErr:     p.HasErr,
+				kind:        kind,
+				pkg:         p.Pkg,
+				name:        p.Name,
+				pos:         p.Pos,
+				args:        args,
+				varargs:     p.Varargs,
+				fieldNames:  fieldNames,
+				paramNames:  paramNames,
+				ins:         ins,
+				out:         curr.t,
+				hasCleanup:  p.HasCleanup,
+				hasErr:      p.HasErr,
+				conditional: p.Conditional,
+				cost:        p.Cost,
+				doc:         p.Doc,
 			})
 		case pv.IsValue():
 			v := pv.Value()
@@ -214,6 +332,7 @@ dfs:
 			calls = append(calls, call{
 				kind:          valueExpr,
 				out:           curr.t,
+				pos:           v.Pos,
 				valueExpr:     v.expr,
 				valueTypeInfo: v.info,
 			})
@@ -240,6 +359,7 @@ dfs:
 				kind:       selectorExpr,
 				pkg:        f.Pkg,
 				name:       f.Name,
+				pos:        f.Pos,
 				out:        curr.t,
 				args:       args,
 				ptrToField: ptrToField,
@@ -249,12 +369,54 @@ dfs:
 		}
 	}
 	if len(ec.errors) > 0 {
-		return nil, ec.errors
+		return nil, nil, nil, ec.errors
 	}
-	if errs := verifyArgsUsed(set, used); len(errs) > 0 {
-		return nil, errs
+	if len(missing) > 0 {
+		n := given.Len()
+		for i := range calls {
+			for j, arg := range calls[i].args {
+				if arg < 0 {
+					calls[i].args[j] = n - arg - 1
+				} else if arg >= n {
+					calls[i].args[j] = arg + len(missing)
+				}
+			}
+		}
 	}
-	return calls, nil
+	return calls, used, missing, nil
+}
+
+// traceHooksType returns the wire.TraceHooks type if set provides it, or
+// nil otherwise.
+func traceHooksType(set *ProviderSet) types.Type {
+	for _, t := range set.Outputs() {
+		if n, ok := t.(*types.Named); ok && n.Obj().Name() == "TraceHooks" && n.Obj().Pkg() != nil && isWireImport(n.Obj().Pkg().Path()) {
+			return t
+		}
+	}
+	return nil
+}
+
+// isOptional reports whether t is marked by wire.Optional in set or in one
+// of the sets it imports.
+func (set *ProviderSet) isOptional(t types.Type) bool {
+	visited := make(map[*ProviderSet]bool)
+	next := []*ProviderSet{set}
+	for len(next) > 0 {
+		curr := next[len(next)-1]
+		next = next[:len(next)-1]
+		if visited[curr] {
+			continue
+		}
+		visited[curr] = true
+		for _, o := range curr.Optionals {
+			if types.Identical(o.Type, t) {
+				return true
+			}
+		}
+		next = append(next, curr.Imports...)
+	}
+	return false
 }
 
 // solvePartial finds the sequence of calls required to produce an output type
@@ -269,7 +431,7 @@ func solvePartial(fset *token.FileSet, set *ProviderSet) ([]call, []*types.Type)
 	outs := set.Outputs()
 	for _, out := range outs {
 		pv := set.For(out)
-		if concrete := pv.Type(); !types.Identical(concrete, out) {
+		if concrete := pv.Type(); !types.Identical(concrete, out) || pv.IsArg() {
 			// Interface binding does not create a call.
 			continue
 		}
@@ -290,6 +452,16 @@ func solvePartial(fset *token.FileSet, set *ProviderSet) ([]call, []*types.Type)
 			}
 			continue
 		}
+		if pv.IsArg() {
+			// The arguments of an injector, whose set is solved by
+			// solveCyclic, are inputs.
+			if index.At(out) == nil {
+				t := out
+				index.Set(t, len(calls)+len(missing))
+				missing = append(missing, &t)
+			}
+			continue
+		}
 
 		curr := index.At(out).(int)
 		switch pv := set.For(out); {
@@ -309,30 +481,40 @@ func solvePartial(fset *token.FileSet, set *ProviderSet) ([]call, []*types.Type)
 				}
 			}
 			kind := funcProviderCall
-			fieldNames := []string(nil)
+			fieldNames, paramNames := []string(nil), []string(nil)
 			if p.IsStruct {
 				kind = structProvider
 				for _, arg := range p.Args {
 					fieldNames = append(fieldNames, arg.FieldName)
 				}
+			} else {
+				for _, arg := range p.Args {
+					paramNames = append(paramNames, arg.ParamName)
+				}
 			}
 			calls[curr] = call{
-				kind:       kind,
-				pkg:        p.Pkg,
-				name:       p.Name,
-				args:       args,
-				varargs:    p.Varargs,
-				fieldNames: fieldNames,
-				ins:        ins,
-				out:        out,
-				hasCleanup: p.HasCleanup,
-				hasErr:     p.HasErr,
+				kind:        kind,
+				pkg:         p.Pkg,
+				name:        p.Name,
+				pos:         p.Pos,
+				args:        args,
+				varargs:     p.Varargs,
+				fieldNames:  fieldNames,
+				paramNames:  paramNames,
+				ins:         ins,
+				out:         out,
+				hasCleanup:  p.HasCleanup,
+				hasErr:      p.HasErr,
+				conditional: p.Conditional,
+				cost:        p.Cost,
+				doc:         p.Doc,
 			}
 		case pv.IsValue():
 			v := pv.Value()
 			calls[curr] = call{
 				kind:          valueExpr,
 				out:           out,
+				pos:           v.Pos,
 				valueExpr:     v.expr,
 				valueTypeInfo: v.info,
 			}
@@ -355,6 +537,7 @@ func solvePartial(fset *token.FileSet, set *ProviderSet) ([]call, []*types.Type)
 				kind:       selectorExpr,
 				pkg:        f.Pkg,
 				name:       f.Name,
+				pos:        f.Pos,
 				out:        out,
 				args:       args,
 				ptrToField: ptrToField,
@@ -367,9 +550,22 @@ func solvePartial(fset *token.FileSet, set *ProviderSet) ([]call, []*types.Type)
 }
 
 // verifyArgsUsed ensures that all of the arguments in set were used during solve.
-func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
+func verifyArgsUsed(fset *token.FileSet, set *ProviderSet, used []*providerSetSrc) []error {
 	var errs []error
-	for _, imp := range set.Imports {
+	for _, key := range unusedElements(set, used) {
+		errs = append(errs, categorized(CategoryUnused, set.describeUnused(key), RelatedPosition{
+			Position: fset.Position(set.elementPos(key)),
+			Message:  "declared here",
+		}))
+	}
+	return errs
+}
+
+// unusedElements returns the imports, providers, values, bindings and
+// fields of set, in this order, that are not among used.
+func unusedElements(set *ProviderSet, used []*providerSetSrc) []splicedKey {
+	var unused []splicedKey
+	for i, imp := range set.Imports {
 		found := false
 		for _, u := range used {
 			if u.Import == imp {
@@ -378,14 +574,10 @@ func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
 			}
 		}
 		if !found {
-			if imp.VarName == "" {
-				errs = append(errs, errors.New("unused provider set"))
-			} else {
-				errs = append(errs, fmt.Errorf("unused provider set %q", imp.VarName))
-			}
+			unused = append(unused, splicedKey{"import", i})
 		}
 	}
-	for _, p := range set.Providers {
+	for i, p := range set.Providers {
 		found := false
 		for _, u := range used {
 			if u.Provider == p {
@@ -394,10 +586,10 @@ func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
 			}
 		}
 		if !found {
-			errs = append(errs, fmt.Errorf("unused provider %q", p.Pkg.Name()+"."+p.Name))
+			unused = append(unused, splicedKey{"provider", i})
 		}
 	}
-	for _, v := range set.Values {
+	for i, v := range set.Values {
 		found := false
 		for _, u := range used {
 			if u.Value == v {
@@ -406,10 +598,10 @@ func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
 			}
 		}
 		if !found {
-			errs = append(errs, fmt.Errorf("unused value of type %s", types.TypeString(v.Out, nil)))
+			unused = append(unused, splicedKey{"value", i})
 		}
 	}
-	for _, b := range set.Bindings {
+	for i, b := range set.Bindings {
 		found := false
 		for _, u := range used {
 			if u.Binding == b {
@@ -418,10 +610,10 @@ func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
 			}
 		}
 		if !found {
-			errs = append(errs, fmt.Errorf("unused interface binding to type %s", types.TypeString(b.Iface, nil)))
+			unused = append(unused, splicedKey{"binding", i})
 		}
 	}
-	for _, f := range set.Fields {
+	for i, f := range set.Fields {
 		found := false
 		for _, u := range used {
 			if u.Field == f {
@@ -430,10 +622,50 @@ func verifyArgsUsed(set *ProviderSet, used []*providerSetSrc) []error {
 			}
 		}
 		if !found {
-			errs = append(errs, fmt.Errorf("unused field %q.%s", f.Parent, f.Name))
+			unused = append(unused, splicedKey{"field", i})
 		}
 	}
-	return errs
+	return unused
+}
+
+// describeUnused returns the error message for the unused element of set
+// identified by key.
+func (set *ProviderSet) describeUnused(key splicedKey) string {
+	switch key.kind {
+	case "import":
+		return fmt.Sprintf("unused provider set %q", set.Imports[key.index].Name())
+	case "provider":
+		p := set.Providers[key.index]
+		return fmt.Sprintf("unused provider %q", p.Pkg.Name()+"."+p.Name)
+	case "value":
+		return fmt.Sprintf("unused value of type %s", types.TypeString(set.Values[key.index].Out, nil))
+	case "binding":
+		return fmt.Sprintf("unused interface binding to type %s", types.TypeString(set.Bindings[key.index].Iface, nil))
+	case "field":
+		f := set.Fields[key.index]
+		return fmt.Sprintf("unused field %q.%s", f.Parent, f.Name)
+	default:
+		panic("unknown element kind " + key.kind)
+	}
+}
+
+// elementPos returns the position of the element of set identified by key,
+// as in describeUnused.
+func (set *ProviderSet) elementPos(key splicedKey) token.Pos {
+	switch key.kind {
+	case "import":
+		return set.Imports[key.index].Pos
+	case "provider":
+		return set.Providers[key.index].Pos
+	case "value":
+		return set.Values[key.index].Pos
+	case "binding":
+		return set.Bindings[key.index].Pos
+	case "field":
+		return set.Fields[key.index].Pos
+	default:
+		panic("unknown element kind " + key.kind)
+	}
 }
 
 // buildProviderMap creates the providerMap and srcMap fields for a given
@@ -462,8 +694,8 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 		}
 	}
 	// Process imports, verifying that there are no conflicts between sets.
-	for _, imp := range set.Imports {
-		src := &providerSetSrc{Import: imp}
+	for i, imp := range set.Imports {
+		src := &providerSetSrc{Import: imp, Splice: set.spliceOf("import", i)}
 		imp.providerMap.Iterate(func(k types.Type, v interface{}) {
 			if prevSrc := srcMap.At(k); prevSrc != nil {
 				ec.add(bindingConflictError(fset, k, set, src, prevSrc.(*providerSetSrc)))
@@ -478,8 +710,8 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 	}
 
 	// Process non-binding providers in new set.
-	for _, p := range set.Providers {
-		src := &providerSetSrc{Provider: p}
+	for i, p := range set.Providers {
+		src := &providerSetSrc{Provider: p, Splice: set.spliceOf("provider", i)}
 		for _, typ := range p.Out {
 			if prevSrc := srcMap.At(typ); prevSrc != nil {
 				ec.add(bindingConflictError(fset, typ, set, src, prevSrc.(*providerSetSrc)))
@@ -489,8 +721,8 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 			srcMap.Set(typ, src)
 		}
 	}
-	for _, v := range set.Values {
-		src := &providerSetSrc{Value: v}
+	for i, v := range set.Values {
+		src := &providerSetSrc{Value: v, Splice: set.spliceOf("value", i)}
 		if prevSrc := srcMap.At(v.Out); prevSrc != nil {
 			ec.add(bindingConflictError(fset, v.Out, set, src, prevSrc.(*providerSetSrc)))
 			continue
@@ -498,8 +730,8 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 		providerMap.Set(v.Out, &ProvidedType{t: v.Out, v: v})
 		srcMap.Set(v.Out, src)
 	}
-	for _, f := range set.Fields {
-		src := &providerSetSrc{Field: f}
+	for i, f := range set.Fields {
+		src := &providerSetSrc{Field: f, Splice: set.spliceOf("field", i)}
 		for _, typ := range f.Out {
 			if prevSrc := srcMap.At(typ); prevSrc != nil {
 				ec.add(bindingConflictError(fset, typ, set, src, prevSrc.(*providerSetSrc)))
@@ -515,8 +747,8 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 
 	// Process bindings in set. Must happen after the other providers to
 	// ensure the concrete type is being provided.
-	for _, b := range set.Bindings {
-		src := &providerSetSrc{Binding: b}
+	for i, b := range set.Bindings {
+		src := &providerSetSrc{Binding: b, Splice: set.spliceOf("binding", i)}
 		if prevSrc := srcMap.At(b.Iface); prevSrc != nil {
 			ec.add(bindingConflictError(fset, b.Iface, set, src, prevSrc.(*providerSetSrc)))
 			continue
@@ -525,7 +757,7 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 		if concrete == nil {
 			setName := set.VarName
 			if setName == "" {
-				setName = "provider set"
+				setName = fmt.Sprintf("provider set %q", set.AnonID)
 			}
 			ec.add(notePosition(fset.Position(b.Pos), fmt.Errorf("wire.Bind of concrete type %q to interface %q, but %s does not include a provider for %q", b.Provided, b.Iface, setName, b.Provided)))
 			continue
@@ -539,7 +771,7 @@ func buildProviderMap(fset *token.FileSet, hasher typeutil.Hasher, set *Provider
 	return providerMap, srcMap, nil
 }
 
-func verifyAcyclic(providerMap *typeutil.Map, hasher typeutil.Hasher) []error {
+func verifyAcyclic(fset *token.FileSet, providerMap *typeutil.Map, hasher typeutil.Hasher) []error {
 	// We must visit every provider type inside provider map, but we don't
 	// have a well-defined starting point and there may be several
 	// distinct graphs. Thus, we start a depth-first search at every
@@ -588,18 +820,26 @@ func verifyAcyclic(providerMap *typeutil.Map, hasher typeutil.Hasher) []error {
 						if types.Identical(a, b) {
 							sb := new(strings.Builder)
 							fmt.Fprintf(sb, "cycle for %s:\n", types.TypeString(a, nil))
+							var related []RelatedPosition
 							for j := i; j < len(curr); j++ {
 								t := providerMap.At(curr[j]).(*ProvidedType)
+								var pos token.Pos
 								if t.IsProvider() {
 									p := t.Provider()
 									fmt.Fprintf(sb, "%s (%s.%s) ->\n", types.TypeString(curr[j], nil), p.Pkg.Path(), p.Name)
+									pos = p.Pos
 								} else {
 									p := t.Field()
 									fmt.Fprintf(sb, "%s (%s.%s) ->\n", types.TypeString(curr[j], nil), p.Parent, p.Name)
+									pos = p.Pos
 								}
+								related = append(related, RelatedPosition{
+									Position: fset.Position(pos),
+									Message:  "provider of " + types.TypeString(curr[j], nil),
+								})
 							}
 							fmt.Fprintf(sb, "%s", types.TypeString(a, nil))
-							ec.add(errors.New(sb.String()))
+							ec.add(categorized(CategoryCycle, sb.String(), related...))
 							hasCycle = true
 							break
 						}
@@ -627,16 +867,49 @@ func bindingConflictError(fset *token.FileSet, typ types.Type, set *ProviderSet,
 	fmt.Fprintf(sb, "multiple bindings for %s\n", types.TypeString(typ, nil))
 	fmt.Fprintf(sb, "current:\n<- %s\n", strings.Join(cur.trace(fset, typ), "\n<- "))
 	fmt.Fprintf(sb, "previous:\n<- %s", strings.Join(prev.trace(fset, typ), "\n<- "))
-	return notePosition(fset.Position(set.Pos), errors.New(sb.String()))
+	return &WireErr{
+		error:    &bindingConflict{msg: sb.String()},
+		position: fset.Position(set.Pos),
+		category: CategoryConflict,
+		related: []RelatedPosition{
+			{Position: fset.Position(cur.pos()), Message: "current binding for " + types.TypeString(typ, nil)},
+			{Position: fset.Position(prev.pos()), Message: "previous binding for " + types.TypeString(typ, nil)},
+		},
+	}
 }
 
+// bindingConflict is the error returned by bindingConflictError, which lint
+// reports as a finding of RuleDuplicateBinding.
+type bindingConflict struct {
+	msg string
+}
+
+func (e *bindingConflict) Error() string { return e.msg }
+
 type buildSolution struct {
 	calls []call
 	ins   []*types.Var
+	out   types.Type
 	pset  *ProviderSet
+	// missing are the types no provider was found for, if the injector was
+	// solved by solveForBuildPartial. They are the last inputs of ins.
+	missing []types.Type
 }
 
 func solveForBuild(pkg *packages.Package, name string) (*buildSolution, []error) {
+	return solveInjector(pkg, name, false)
+}
+
+// solveForBuildPartial is like solveForBuild, but solves the injector even
+// if providers are missing, in which case the types without a provider
+// follow the parameters of the injector among the inputs of the solution,
+// each named "missing". It still fails for the other errors.
+func solveForBuildPartial(pkg *packages.Package, name string) (*buildSolution, []error) {
+	return solveInjector(pkg, name, true)
+}
+
+// solveInjector implements solveForBuild and solveForBuildPartial.
+func solveInjector(pkg *packages.Package, name string, partial bool) (*buildSolution, []error) {
 	fn := findFuncDecl(pkg, name)
 	if fn == nil {
 		return nil, []error{fmt.Errorf("no function named %s found", name)}
@@ -651,11 +924,7 @@ func solveForBuild(pkg *packages.Package, name string) (*buildSolution, []error)
 	sig := pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature)
 	params, out, err := injectorFuncSignature(sig)
 	if err != nil {
-		if w, ok := err.(*WireErr); ok {
-			return nil, []error{notePosition(w.position, fmt.Errorf("inject %s: %v", fn.Name.Name, w.error))}
-		} else {
-			return nil, []error{notePosition(pkg.Fset.Position(fn.Pos()), fmt.Errorf("inject %s: %v", fn.Name.Name, err))}
-		}
+		return nil, []error{noteInjector(fn.Name.Name, pkg.Fset.Position(fn.Pos()), err)}
 	}
 	injectorArgs := &InjectorArgs{
 		Name:  fn.Name.Name,
@@ -667,27 +936,86 @@ func solveForBuild(pkg *packages.Package, name string) (*buildSolution, []error)
 	if len(errs) > 0 {
 		return nil, notePositionAll(pkg.Fset.Position(fn.Pos()), errs)
 	}
-	calls, errs := solve(pkg.Fset, out.out, params, pset)
+	var calls []call
+	var missing []types.Type
+	if partial {
+		calls, _, missing, errs = solveCallsMissing(pkg.Fset, out.out, nil, params, pset, true)
+	} else {
+		calls, errs = solve(pkg.Fset, out.out, params, pset)
+	}
 	if len(errs) > 0 {
 		return nil, mapErrors(errs, func(e error) error {
-			if w, ok := e.(*WireErr); ok {
-				return notePosition(w.position, fmt.Errorf("inject %s: %v", fn.Name.Name, w.error))
-			}
-			return notePosition(pkg.Fset.Position(fn.Pos()), fmt.Errorf("inject %s: %v", fn.Name.Name, e))
+			return noteInjector(fn.Name.Name, pkg.Fset.Position(fn.Pos()), e)
 		})
 	}
 	var ins []*types.Var
 	for i := 0; i < params.Len(); i++ {
 		ins = append(ins, params.At(i))
 	}
+	for _, t := range missing {
+		ins = append(ins, types.NewParam(token.NoPos, pkg.Types, "missing", t))
+	}
 	sol := &buildSolution{
-		calls: calls,
-		ins:   ins,
-		pset:  pset,
+		calls:   calls,
+		ins:     ins,
+		out:     out.out,
+		pset:    pset,
+		missing: missing,
 	}
 	return sol, errs
 }
 
+// solveCyclic is like solveForNewSet, but solves the provider set named
+// name, or the set passed to wire.Build by the injector named name, even if
+// its providers depend on each other in cycles, which the calls of the
+// solution then follow. The arguments of an injector are among the missing
+// types. It still fails for the other errors.
+func solveCyclic(pkg *packages.Package, name string, injector bool) (*newSetSolution, []error) {
+	var expr *ast.CallExpr
+	var args *InjectorArgs
+	varName := name
+	if injector {
+		fn := findFuncDecl(pkg, name)
+		if fn == nil {
+			return nil, []error{fmt.Errorf("no function named %s found", name)}
+		}
+		build, err := findInjectorBuild(pkg.TypesInfo, fn)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if build == nil {
+			return nil, []error{fmt.Errorf("no injector build call found")}
+		}
+		sig := pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature)
+		params, _, err := injectorFuncSignature(sig)
+		if err != nil {
+			return nil, []error{err}
+		}
+		expr, args, varName = build, &InjectorArgs{Name: name, Tuple: params, Pos: fn.Pos()}, ""
+	} else {
+		set := findVarExpr(pkg, name)
+		if set == nil {
+			return nil, []error{fmt.Errorf("no value named %s found", name)}
+		}
+		newSet, err := findInjectorNewSet(pkg.TypesInfo, set)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if newSet == nil {
+			return nil, []error{fmt.Errorf("no injector NewSet call found")}
+		}
+		expr = newSet
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	oc.allowCycles = true
+	pset, errs := oc.processNewSet(pkg.TypesInfo, pkg.PkgPath, expr, args, varName)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	calls, missing := solvePartial(pkg.Fset, pset)
+	return &newSetSolution{calls: calls, missing: missing, pset: pset}, nil
+}
+
 type newSetSolution struct {
 	calls   []call
 	missing []*types.Type
@@ -0,0 +1,103 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A Binding is a call to wire.Bind found by AllBindings.
+type Binding struct {
+	Pkg *packages.Package
+	// Pos and End are the positions of the call to wire.Bind.
+	Pos, End token.Pos
+	// Iface is the interface type and Provided the type bound to it, as in
+	// IfaceBinding.
+	Iface    types.Type
+	Provided types.Type
+	// Provider is the position of the provider, value or field of Provided
+	// in the provider set passed the binding, or token.NoPos if the set
+	// is not valid or does not provide Provided, e.g. for a set imported
+	// by another one that does.
+	Provider token.Pos
+}
+
+// AllBindings returns the valid calls to wire.Bind in the syntax of pkgs,
+// but not of their dependencies, in order.
+func AllBindings(pkgs []*packages.Package) []*Binding {
+	var bindings []*Binding
+	var oc *objectCache
+	// processed holds the sets of the calls processed so far, nil if not
+	// valid.
+	processed := make(map[*ast.CallExpr]*ProviderSet)
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || pkg.TypesInfo == nil || isWireImport(pkg.PkgPath) {
+			continue
+		}
+		for _, f := range pkg.Syntax {
+			// sets holds the wire.NewSet and wire.Build calls enclosing
+			// the node being visited.
+			var sets []*ast.CallExpr
+			var stack []ast.Node
+			ast.Inspect(f, func(n ast.Node) bool {
+				if n == nil {
+					if call, ok := stack[len(stack)-1].(*ast.CallExpr); ok && len(sets) > 0 && sets[len(sets)-1] == call {
+						sets = sets[:len(sets)-1]
+					}
+					stack = stack[:len(stack)-1]
+					return false
+				}
+				stack = append(stack, n)
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if isWireCall(pkg.TypesInfo, call, "NewSet", "Build") {
+					sets = append(sets, call)
+					return true
+				}
+				if !isWireCall(pkg.TypesInfo, call, "Bind") {
+					return true
+				}
+				ib, err := processBind(pkg.Fset, pkg.TypesInfo, call)
+				if err != nil {
+					return true
+				}
+				b := &Binding{Pkg: pkg, Pos: ib.Pos, End: call.End(), Iface: ib.Iface, Provided: ib.Provided}
+				if len(sets) > 0 {
+					setCall := sets[len(sets)-1]
+					set, ok := processed[setCall]
+					if !ok {
+						if oc == nil {
+							oc = newObjectCache(pkgs)
+						}
+						set, _ = oc.processNewSet(pkg.TypesInfo, pkg.PkgPath, setCall, nil, "")
+						processed[setCall] = set
+					}
+					if set != nil {
+						b.Provider = providedPos(set.For(ib.Provided))
+					}
+				}
+				bindings = append(bindings, b)
+				return true
+			})
+		}
+	}
+	return bindings
+}
+
+// providedPos returns the position of the provider, value or field of pt,
+// or token.NoPos if pt is nil or an injector argument.
+func providedPos(pt ProvidedType) token.Pos {
+	switch {
+	case pt.IsProvider():
+		return pt.Provider().Pos
+	case pt.IsValue():
+		return pt.Value().Pos
+	case pt.IsField():
+		return pt.Field().Pos
+	}
+	return token.NoPos
+}
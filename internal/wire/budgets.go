@@ -0,0 +1,80 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// CheckBudgets solves every injector in the packages matching patterns and
+// returns an error for each budget in b that an injector exceeds.
+// The second return value holds the errors that prevented the check.
+func CheckBudgets(ctx context.Context, wd string, env []string, tags string, patterns []string, b Budgets) ([]error, []error) {
+	if b.IsZero() {
+		return nil, nil
+	}
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	var violations []error
+	errs = solveInjectors(pkgs, func(in *Injector, sol *buildSolution) {
+		pos := pkgs[0].Fset.Position(in.Pos)
+		for _, err := range checkBudgets(sol, b) {
+			err = notePosition(pos, fmt.Errorf("inject %s: %v", in.FuncName, err))
+			violations = append(violations, notePkgPath(in.ImportPath, []error{err})...)
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return violations, nil
+}
+
+// checkBudgets returns an error for each budget in b that sol exceeds.
+func checkBudgets(sol *buildSolution, b Budgets) []error {
+	st := computeStats(sol)
+	ec := new(errorCollector)
+	if b.MaxProvidersPerInjector > 0 && st.providers > b.MaxProvidersPerInjector {
+		ec.add(fmt.Errorf("uses %d providers, budget is %d", st.providers, b.MaxProvidersPerInjector))
+	}
+	if b.MaxDepth > 0 && st.depth > b.MaxDepth {
+		names := make([]string, len(st.chain))
+		for i, j := range st.chain {
+			names[i] = callName(&sol.calls[j])
+		}
+		ec.add(fmt.Errorf("dependency depth %d exceeds budget %d: %s", st.depth, b.MaxDepth, strings.Join(names, " -> ")))
+	}
+	if b.MaxFanIn > 0 {
+		// Iterate over the calls rather than the map to report in a
+		// deterministic order.
+		seen := make(map[string]bool)
+		for i := range sol.calls {
+			for _, in := range sol.calls[i].ins {
+				key := types.TypeString(in, nil)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				consumers := st.consumers.At(in).([]int)
+				if len(consumers) > b.MaxFanIn {
+					ec.add(fmt.Errorf("%s is consumed by %d providers, budget is %d: %s", key, len(consumers), b.MaxFanIn, callNames(sol.calls, consumers)))
+				}
+			}
+		}
+	}
+	if b.MaxFanOut > 0 {
+		for i := range sol.calls {
+			c := &sol.calls[i]
+			if len(c.ins) > b.MaxFanOut {
+				ins := make([]string, len(c.ins))
+				for j, in := range c.ins {
+					ins[j] = types.TypeString(in, nil)
+				}
+				ec.add(fmt.Errorf("%s consumes %d inputs, budget is %d: %s", callName(c), len(c.ins), b.MaxFanOut, strings.Join(ins, ", ")))
+			}
+		}
+	}
+	return ec.errors
+}
@@ -0,0 +1,332 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A ProviderIndex holds the exported provider functions of a workspace, as
+// built by IndexProviders, so that injectors can be offered providers of
+// packages they do not depend on yet. Types are kept as strings qualified
+// by package path, so that the index can be queried with the packages of
+// another load.
+type ProviderIndex struct {
+	// Candidates lists the provider functions, sorted by package path and
+	// name.
+	Candidates []*ProviderCandidate
+	// Packages maps the path of each loaded package, including the
+	// dependencies of the indexed ones, to its name and imports.
+	Packages map[string]*IndexedPackage
+}
+
+// A ProviderCandidate is an exported provider function in a ProviderIndex.
+type ProviderCandidate struct {
+	// PkgPath is the path of the package of the function, and Name its
+	// name.
+	PkgPath string
+	Name    string
+	// Out is the type provided, e.g. "*example.com/foo.Logger".
+	Out string
+	// Implements lists the non-empty interfaces declared at the top level
+	// of the indexed packages that Out implements without being one,
+	// sorted.
+	Implements []string
+}
+
+// An IndexedPackage is a package in a ProviderIndex.
+type IndexedPackage struct {
+	Name string
+	// Imports lists the paths of the packages it imports, sorted.
+	Imports []string
+}
+
+// IndexProviders returns the index of the exported provider functions
+// declared at the top level of pkgs, but not of their dependencies.
+// Injectors and functions that are not valid providers are left out.
+func IndexProviders(pkgs []*packages.Package) *ProviderIndex {
+	idx := &ProviderIndex{Packages: make(map[string]*IndexedPackage)}
+	if len(pkgs) == 0 {
+		return idx
+	}
+	oc := newObjectCache(pkgs)
+	for path, p := range oc.packages {
+		ip := &IndexedPackage{Name: p.Name}
+		for imp := range p.Imports {
+			ip.Imports = append(ip.Imports, imp)
+		}
+		sort.Strings(ip.Imports)
+		idx.Packages[path] = ip
+	}
+	var ifaces []*types.TypeName
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || isWireImport(pkg.PkgPath) {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if iface, ok := tn.Type().Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				ifaces = append(ifaces, tn)
+			}
+		}
+	}
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || isWireImport(pkg.PkgPath) {
+			continue
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			fn, ok := scope.Lookup(name).(*types.Func)
+			if !ok || !fn.Exported() {
+				continue
+			}
+			v, errs := oc.get(fn)
+			p, ok := v.(*Provider)
+			if len(errs) > 0 || !ok || isInjector(oc, fn) {
+				continue
+			}
+			c := &ProviderCandidate{PkgPath: pkg.PkgPath, Name: name, Out: types.TypeString(p.Out[0], nil)}
+			for _, tn := range ifaces {
+				iface := tn.Type().Underlying().(*types.Interface)
+				if !types.Identical(p.Out[0], tn.Type()) && types.Implements(p.Out[0], iface) {
+					c.Implements = append(c.Implements, types.TypeString(tn.Type(), nil))
+				}
+			}
+			sort.Strings(c.Implements)
+			idx.Candidates = append(idx.Candidates, c)
+		}
+	}
+	sort.Slice(idx.Candidates, func(i, j int) bool {
+		ci, cj := idx.Candidates[i], idx.Candidates[j]
+		if ci.PkgPath != cj.PkgPath {
+			return ci.PkgPath < cj.PkgPath
+		}
+		return ci.Name < cj.Name
+	})
+	return idx
+}
+
+// Merge adds the candidates and packages of other to idx, skipping those
+// it already has, e.g. for nested workspace folders.
+func (idx *ProviderIndex) Merge(other *ProviderIndex) {
+	if idx.Packages == nil {
+		idx.Packages = make(map[string]*IndexedPackage)
+	}
+	seen := make(map[string]bool, len(idx.Candidates))
+	for _, c := range idx.Candidates {
+		seen[c.PkgPath+"."+c.Name] = true
+	}
+	for _, c := range other.Candidates {
+		if !seen[c.PkgPath+"."+c.Name] {
+			seen[c.PkgPath+"."+c.Name] = true
+			idx.Candidates = append(idx.Candidates, c)
+		}
+	}
+	sort.SliceStable(idx.Candidates, func(i, j int) bool {
+		ci, cj := idx.Candidates[i], idx.Candidates[j]
+		if ci.PkgPath != cj.PkgPath {
+			return ci.PkgPath < cj.PkgPath
+		}
+		return ci.Name < cj.Name
+	})
+	for path, p := range other.Packages {
+		if idx.Packages[path] == nil {
+			idx.Packages[path] = p
+		}
+	}
+}
+
+// CandidateFixesAt is like ProviderFixesAt, but offers the candidates of
+// idx that ProviderFixesAt does not: the providers of packages pkg does not
+// depend on, and the providers of a type implementing a missing interface,
+// which are added along with a wire.Bind call. Candidates whose package
+// cannot be imported by pkg, or imports it, are left out. The fixes are
+// sorted by type, then by import distance: the packages pkg depends on by
+// the length of the shortest chain of imports to them, followed by the
+// others by the number of path elements between them and pkg.
+func CandidateFixesAt(pkg *packages.Package, pos token.Pos, idx *ProviderIndex) []*ProviderFix {
+	path, _, build := injectorAt(pkg, pos)
+	if build == nil || idx == nil {
+		return nil
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	missing := buildMissing(oc, pkg, path, build)
+	if len(missing) == 0 {
+		return nil
+	}
+	file := path[len(path)-1].(*ast.File)
+	deps := importDistances(pkg)
+	wireName := "Bind"
+	if sel, ok := build.Fun.(*ast.SelectorExpr); ok {
+		wireName = types.ExprString(sel.X) + ".Bind"
+	}
+
+	// qualify returns the expression naming the type or function name of
+	// the package path in file, adding the import of path to fix if
+	// needed. It returns false if the name of the package is taken.
+	qualify := func(fix *ProviderFix, path, name string) (string, bool) {
+		if path == pkg.PkgPath {
+			return name, true
+		}
+		for _, imp := range file.Imports {
+			pkgName := importedPkgName(pkg.TypesInfo, imp)
+			if pkgName == nil || pkgName.Name() == "_" || pkgName.Imported().Path() != path {
+				continue
+			}
+			if pkgName.Name() == "." {
+				return name, true
+			}
+			return pkgName.Name() + "." + name, true
+		}
+		ip := idx.Packages[path]
+		if ip == nil {
+			return "", false
+		}
+		for _, imp := range fix.Imports {
+			if imp == path {
+				return ip.Name + "." + name, true
+			}
+		}
+		if nameInFile(pkg, file, ip.Name) {
+			return "", false
+		}
+		for _, imp := range fix.Imports {
+			if idx.Packages[imp].Name == ip.Name {
+				return "", false
+			}
+		}
+		fix.Imports = append(fix.Imports, path)
+		fix.Edits = append(fix.Edits, importEdit(file, path))
+		return ip.Name + "." + name, true
+	}
+	// typeExpr is like qualify for a named type or a pointer to one,
+	// e.g. "*example.com/foo.Logger".
+	typeExpr := func(fix *ProviderFix, typ string) (string, bool) {
+		name := strings.TrimLeft(typ, "*")
+		stars := typ[:len(typ)-len(name)]
+		i := strings.LastIndex(name, ".")
+		if i < 0 || strings.ContainsAny(name, "[]{}() ,") {
+			return "", false
+		}
+		expr, ok := qualify(fix, name[:i], name[i+1:])
+		return stars + expr, ok
+	}
+
+	type rankedFix struct {
+		fix  *ProviderFix
+		rank int
+	}
+	var fixes []*ProviderFix
+	for _, typ := range missing {
+		var ranked []rankedFix
+		for _, c := range idx.Candidates {
+			iface := ""
+			if c.Out != typ {
+				i := sort.SearchStrings(c.Implements, typ)
+				if i == len(c.Implements) || c.Implements[i] != typ {
+					continue
+				}
+				iface = typ
+			}
+			dist, isDep := deps[c.PkgPath]
+			if iface == "" && isDep {
+				// ProviderFixesAt offers it.
+				continue
+			}
+			if !canImport(pkg.PkgPath, c.PkgPath) || idx.imports(c.PkgPath, pkg.PkgPath) {
+				continue
+			}
+			fix := &ProviderFix{Type: typ}
+			expr, ok := qualify(fix, c.PkgPath, c.Name)
+			if !ok {
+				continue
+			}
+			fix.Expr = expr
+			newText := expr
+			if iface != "" {
+				ifaceExpr, ok := typeExpr(fix, iface)
+				if !ok {
+					continue
+				}
+				outExpr, ok := typeExpr(fix, c.Out)
+				if !ok {
+					continue
+				}
+				fix.Bind = wireName + "(new(" + ifaceExpr + "), new(" + outExpr + "))"
+				newText += ", " + fix.Bind
+			}
+			fix.Edits = append(fix.Edits, appendArgEdit(build, newText))
+			if !isDep {
+				dist = len(deps) + pathDistance(pkg.PkgPath, c.PkgPath)
+			}
+			ranked = append(ranked, rankedFix{fix, dist})
+		}
+		sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].rank < ranked[j].rank })
+		for _, r := range ranked {
+			fixes = append(fixes, r.fix)
+		}
+	}
+	return fixes
+}
+
+// importDistances maps pkg and the packages it depends on to the length of
+// the shortest chain of imports from pkg to them.
+func importDistances(pkg *packages.Package) map[string]int {
+	dist := map[string]int{pkg.PkgPath: 0}
+	queue := []*packages.Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		for _, imp := range p.Imports {
+			if _, ok := dist[imp.PkgPath]; !ok {
+				dist[imp.PkgPath] = dist[p.PkgPath] + 1
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return dist
+}
+
+// imports reports whether the package from depends on the package to in
+// idx.
+func (idx *ProviderIndex) imports(from, to string) bool {
+	seen := map[string]bool{from: true}
+	stk := []string{from}
+	for len(stk) > 0 {
+		p := stk[len(stk)-1]
+		stk = stk[:len(stk)-1]
+		ip := idx.Packages[p]
+		if ip == nil {
+			continue
+		}
+		for _, imp := range ip.Imports {
+			if imp == to {
+				return true
+			}
+			if !seen[imp] {
+				seen[imp] = true
+				stk = append(stk, imp)
+			}
+		}
+	}
+	return false
+}
+
+// pathDistance returns the number of path elements to go up from a and
+// down to b, e.g. 2 from "example.com/foo" to "example.com/bar".
+func pathDistance(a, b string) int {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return len(as) - n + len(bs) - n
+}
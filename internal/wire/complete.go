@@ -0,0 +1,244 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of Completion.
+const (
+	CompletionProvider    = "provider"
+	CompletionProviderSet = "provider set"
+	CompletionHelper      = "helper"
+)
+
+// A Completion is a candidate argument of a wire.Build or wire.NewSet call.
+type Completion struct {
+	// Label is the text to insert, qualified by the name of its import if
+	// declared in another package, e.g. "NewConfig", "config.Set" or
+	// "wire.Bind".
+	Label string
+	// Kind is one of CompletionProvider, CompletionProviderSet and
+	// CompletionHelper.
+	Kind string
+	// Detail is the declaration of a provider or helper, or the types a
+	// provider set provides, with the types of the package of the call
+	// unqualified.
+	Detail string
+	// Provides lists the missing types of the call that the candidate
+	// provides, sorted.
+	Provides []string
+	// Pos is the position of the declaration of the candidate.
+	Pos token.Pos
+}
+
+// Completions lists the candidate arguments of a wire.Build or wire.NewSet
+// call, as found by CompletionsAt.
+type Completions struct {
+	// Call is the wire.Build or wire.NewSet call.
+	Call *ast.CallExpr
+	// Missing lists the types needed by the injector, for wire.Build, or by
+	// the provider set, for wire.NewSet, that the other arguments of the
+	// call do not provide, sorted. It is nil if the other arguments do not
+	// form a valid provider set.
+	Missing []string
+	// Items lists the providers and provider sets that provide a missing
+	// type, or all of them if no type is known to be missing, followed by
+	// the helpers of the wire package, each sorted by label.
+	Items []*Completion
+}
+
+// CompletionsAt returns the candidate arguments of the wire.Build or
+// wire.NewSet call whose parentheses enclose pos, or nil if there is none.
+// The candidates are the providers and provider sets in scope at pos,
+// declared in pkg or in the packages imported by the file, that the call
+// does not already use, and the helpers of the wire package such as
+// wire.Bind. The argument at pos, which is being typed, is ignored.
+func CompletionsAt(pkg *packages.Package, pos token.Pos) *Completions {
+	path := pathEnclosingPos(pkg, pos)
+	var call *ast.CallExpr
+	for _, n := range path {
+		if _, ok := n.(*ast.Ident); ok {
+			continue
+		}
+		if _, ok := n.(*ast.SelectorExpr); ok {
+			continue
+		}
+		call, _ = n.(*ast.CallExpr)
+		break
+	}
+	if call == nil || pos <= call.Lparen || pos > call.Rparen || !isWireCall(pkg.TypesInfo, call, "Build", "NewSet") {
+		return nil
+	}
+	file := path[len(path)-1].(*ast.File)
+	c := &Completions{Call: call}
+
+	// Build the provider set of the other arguments to find what is missing.
+	partial := *call
+	partial.Args = nil
+	used := make(map[types.Object]bool)
+	for _, arg := range call.Args {
+		if arg.Pos() <= pos && pos <= arg.End() {
+			continue
+		}
+		if t := pkg.TypesInfo.TypeOf(arg); t == nil || t == types.Typ[types.Invalid] {
+			continue
+		}
+		partial.Args = append(partial.Args, arg)
+		if obj := qualifiedIdentObject(pkg.TypesInfo, arg); obj != nil {
+			used[obj] = true
+		}
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	if isWireCall(pkg.TypesInfo, call, "Build") {
+		c.Missing = buildMissing(oc, pkg, path, &partial)
+	} else if pset, errs := oc.processNewSet(pkg.TypesInfo, pkg.PkgPath, &partial, nil, ""); len(errs) == 0 {
+		_, missing := solvePartial(pkg.Fset, pset)
+		c.Missing = []string{}
+		for _, t := range missing {
+			c.Missing = append(c.Missing, types.TypeString(*t, nil))
+		}
+		sort.Strings(c.Missing)
+	}
+
+	// Variables and injectors enclosing the call cannot be passed to it.
+	for _, n := range path {
+		switch n := n.(type) {
+		case *ast.ValueSpec:
+			for _, id := range n.Names {
+				used[pkg.TypesInfo.Defs[id]] = true
+			}
+		case *ast.FuncDecl:
+			used[pkg.TypesInfo.Defs[n.Name]] = true
+		}
+	}
+	missing := make(map[string]bool)
+	for _, t := range c.Missing {
+		missing[t] = true
+	}
+	qualifier := types.RelativeTo(pkg.Types)
+	var items, helpers []*Completion
+	add := func(prefix string, obj types.Object) {
+		if used[obj] {
+			return
+		}
+		item := &Completion{Label: prefix + obj.Name(), Pos: obj.Pos()}
+		var outs []types.Type
+		switch obj := obj.(type) {
+		case *types.Func:
+			v, errs := oc.get(obj)
+			if len(errs) > 0 || isInjector(oc, obj) {
+				return
+			}
+			item.Kind = CompletionProvider
+			item.Detail = types.ObjectString(obj, qualifier)
+			outs = v.(*Provider).Out
+		case *types.Var:
+			if !isProviderSetType(obj.Type()) {
+				return
+			}
+			v, errs := oc.get(obj)
+			if len(errs) > 0 {
+				return
+			}
+			item.Kind = CompletionProviderSet
+			outs = v.(*ProviderSet).Outputs()
+			var provided []string
+			for _, t := range outs {
+				provided = append(provided, types.TypeString(t, qualifier))
+			}
+			sort.Strings(provided)
+			item.Detail = "provides " + strings.Join(provided, ", ")
+		default:
+			return
+		}
+		for _, t := range outs {
+			if s := types.TypeString(t, nil); missing[s] {
+				item.Provides = append(item.Provides, s)
+			}
+		}
+		if len(missing) > 0 && len(item.Provides) == 0 {
+			return
+		}
+		sort.Strings(item.Provides)
+		items = append(items, item)
+	}
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		add("", scope.Lookup(name))
+	}
+	for _, imp := range file.Imports {
+		var pkgName *types.PkgName
+		if imp.Name != nil {
+			pkgName, _ = pkg.TypesInfo.Defs[imp.Name].(*types.PkgName)
+		} else {
+			pkgName, _ = pkg.TypesInfo.Implicits[imp].(*types.PkgName)
+		}
+		if pkgName == nil || pkgName.Name() == "_" || pkgName.Name() == "." {
+			continue
+		}
+		imported := pkgName.Imported()
+		scope := imported.Scope()
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if !obj.Exported() {
+				continue
+			}
+			if !isWireImport(imported.Path()) {
+				add(pkgName.Name()+".", obj)
+				continue
+			}
+			if fn, ok := obj.(*types.Func); ok && fn.Name() != "Build" {
+				helpers = append(helpers, &Completion{
+					Label:  pkgName.Name() + "." + fn.Name(),
+					Kind:   CompletionHelper,
+					Detail: types.ObjectString(fn, types.RelativeTo(imported)),
+					Pos:    fn.Pos(),
+				})
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Label < items[j].Label })
+	sort.Slice(helpers, func(i, j int) bool { return helpers[i].Label < helpers[j].Label })
+	c.Items = append(items, helpers...)
+	return c
+}
+
+// buildMissing returns the types needed by the injector calling the
+// wire.Build call partial that its arguments and the injector parameters
+// do not provide, or nil if they do not form a valid provider set. path is
+// the path from the call to the root of the file.
+func buildMissing(oc *objectCache, pkg *packages.Package, path []ast.Node, partial *ast.CallExpr) []string {
+	var fn *ast.FuncDecl
+	for _, n := range path {
+		if decl, ok := n.(*ast.FuncDecl); ok {
+			fn = decl
+			break
+		}
+	}
+	if fn == nil {
+		return nil
+	}
+	pset, _, out := injectorSet(oc, pkg, fn, partial)
+	if pset == nil {
+		return nil
+	}
+	return append([]string{}, missingInputs(pset, out)...)
+}
+
+// isInjector reports whether fn is a function calling wire.Build, which
+// is a valid provider but cannot be used as one.
+func isInjector(oc *objectCache, fn *types.Func) bool {
+	decl := oc.funcDecl(fn)
+	if decl == nil {
+		return false
+	}
+	p := oc.packages[fn.Pkg().Path()]
+	build, err := findInjectorBuild(p.TypesInfo, decl)
+	return build != nil || err != nil
+}
@@ -0,0 +1,101 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ConfigFileName is the default name of the wireplus configuration file.
+const ConfigFileName = ".wireplus.toml"
+
+// Config holds the settings read from a configuration file.
+type Config struct {
+	Budgets Budgets
+}
+
+// Budgets limits the shape of the graph of each injector. A zero value
+// means unlimited.
+type Budgets struct {
+	// MaxDepth is the maximum length of a chain of providers.
+	MaxDepth int
+	// MaxFanIn is the maximum number of providers consuming a single type.
+	MaxFanIn int
+	// MaxFanOut is the maximum number of inputs consumed by a single provider.
+	MaxFanOut int
+	// MaxProvidersPerInjector is the maximum number of providers used by
+	// a single injector.
+	MaxProvidersPerInjector int
+}
+
+// IsZero reports whether b does not limit anything.
+func (b Budgets) IsZero() bool {
+	return b == Budgets{}
+}
+
+// LoadConfig reads the configuration file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%v", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses the content of a configuration file. The file consists
+// of [section] headers followed by key = value lines, as in TOML; only the
+// subset needed by wireplus is supported. Unknown sections are ignored so
+// that the file can be shared with other tools.
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := new(Config)
+	budgets := map[string]*int{
+		"maxDepth":                &cfg.Budgets.MaxDepth,
+		"maxFanIn":                &cfg.Budgets.MaxFanIn,
+		"maxFanOut":               &cfg.Budgets.MaxFanOut,
+		"maxProvidersPerInjector": &cfg.Budgets.MaxProvidersPerInjector,
+	}
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%d: expected key = value", n)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if section != "budgets" {
+			continue
+		}
+		dst, ok := budgets[key]
+		if !ok {
+			return nil, fmt.Errorf("%d: unknown budget %q", n, key)
+		}
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("%d: budget %s must be a non-negative integer", n, key)
+		}
+		*dst = v
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,149 @@
+package wire
+
+import (
+	"fmt"
+	"go/ast"
+	"sort"
+	"strings"
+)
+
+// Cost categories recognized in //wire:cost directives.
+const (
+	CostLight  = "light"
+	CostMedium = "medium"
+	CostHeavy  = "heavy"
+)
+
+// costDirective is the prefix of the directive annotating the estimated
+// construction cost of a provider function, e.g. "//wire:cost heavy".
+const costDirective = "//wire:cost"
+
+// costWeights maps each cost category to the weight used when summing
+// costs along a chain of providers.
+var costWeights = map[string]int{
+	CostLight:  1,
+	CostMedium: 3,
+	CostHeavy:  9,
+}
+
+// isKnownCost reports whether cost is empty or a known cost category.
+func isKnownCost(cost string) bool {
+	_, ok := costWeights[cost]
+	return cost == "" || ok
+}
+
+// costWeight returns the weight of cost, or 0 if cost is not a known
+// cost category.
+func costWeight(cost string) int {
+	return costWeights[cost]
+}
+
+// parseCostDirective returns the value of the last //wire:cost directive
+// in doc, or the empty string if there is none.
+func parseCostDirective(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	var cost string
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, costDirective) {
+			continue
+		}
+		rest := c.Text[len(costDirective):]
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			// e.g. "//wire:costly" is not a cost directive.
+			continue
+		}
+		cost = strings.TrimSpace(rest)
+	}
+	return cost
+}
+
+// costWarnings returns a warning for each provider in oc with an unknown
+// cost category, sorted by position.
+func (oc *objectCache) costWarnings() []error {
+	var providers []*Provider
+	for _, ent := range oc.objects {
+		if p, ok := ent.val.(*Provider); ok && !isKnownCost(p.Cost) {
+			providers = append(providers, p)
+		}
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Pos < providers[j].Pos
+	})
+	var warnings []error
+	for _, p := range providers {
+		warnings = append(warnings, notePosition(oc.fset.Position(p.Pos),
+			fmt.Errorf("provider %s has unknown cost %q; want %s, %s or %s", p.Name, p.Cost, CostLight, CostMedium, CostHeavy)))
+	}
+	return warnings
+}
+
+// criticalPath finds the chain of calls from a root to a leaf whose cost
+// weights sum to the largest total. index maps an argument of a call to
+// the index of the call producing it, or -1 if the argument is an input.
+//
+// The returned map holds an entry for each call on the chain, whose value
+// is the index of the next call on the chain or -1 for the last call.
+// It returns nil if no call on any chain has a known cost.
+func criticalPath(calls []call, index func(arg int) int) map[int]int {
+	return heaviestPath(calls, index, func(i int) int64 {
+		return int64(costWeight(calls[i].cost))
+	})
+}
+
+// heaviestPath is like criticalPath, but weighs call i with weight(i).
+func heaviestPath(calls []call, index func(arg int) int, weight func(i int) int64) map[int]int {
+	total := make([]int64, len(calls))
+	next := make([]int, len(calls))
+	done := make([]bool, len(calls))
+	var visit func(i int) int64
+	visit = func(i int) int64 {
+		if done[i] {
+			return total[i]
+		}
+		done[i] = true
+		next[i] = -1
+		var best int64
+		for _, arg := range calls[i].args {
+			j := index(arg)
+			if j < 0 {
+				continue
+			}
+			if t := visit(j); t > best || next[i] == -1 {
+				best, next[i] = t, j
+			}
+		}
+		total[i] = weight(i) + best
+		return total[i]
+	}
+	used := make(map[int]bool)
+	for _, c := range calls {
+		for _, arg := range c.args {
+			if j := index(arg); j >= 0 {
+				used[j] = true
+			}
+		}
+	}
+	root := -1
+	for i := range calls {
+		if used[i] {
+			continue
+		}
+		if t := visit(i); root == -1 || t > total[root] {
+			root = i
+		}
+	}
+	if root == -1 || total[root] == 0 {
+		return nil
+	}
+	path := make(map[int]int)
+	for i := root; i != -1; i = next[i] {
+		// The calls of a graph drawn with its cycles may lead back.
+		if _, ok := path[i]; ok {
+			break
+		}
+		path[i] = next[i]
+	}
+	return path
+}
@@ -0,0 +1,123 @@
+package wire
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// graphCycle is a cycle of the calls of a graph solved by solveCyclic, by
+// index: each call depends on the next one, and the last on the first.
+type graphCycle []int
+
+// findCycles returns the cycles of calls, one for each dependency leading
+// back to a call being visited by a depth-first search from each call in
+// the order of their output types, as verifyAcyclic does, so that they do
+// not depend on the order of calls. Each cycle starts at the call whose
+// output type comes first. Arguments that are not calls are left out.
+func findCycles(calls []call) []graphCycle {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(calls))
+	var stack []int
+	var cycles []graphCycle
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, arg := range calls[i].args {
+			if arg >= len(calls) {
+				continue
+			}
+			switch state[arg] {
+			case unvisited:
+				visit(arg)
+			case visiting:
+				j := len(stack) - 1
+				for stack[j] != arg {
+					j--
+				}
+				cycles = append(cycles, rotateCycle(stack[j:], calls))
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+	order := make([]int, len(calls))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return types.TypeString(calls[order[i]].out, nil) < types.TypeString(calls[order[j]].out, nil)
+	})
+	for _, i := range order {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return cycles
+}
+
+// rotateCycle returns a copy of the cycle c starting at the call whose
+// output type comes first.
+func rotateCycle(c []int, calls []call) graphCycle {
+	first := 0
+	for k, i := range c {
+		if types.TypeString(calls[i].out, nil) < types.TypeString(calls[c[first]].out, nil) {
+			first = k
+		}
+	}
+	return append(append(graphCycle(nil), c[first:]...), c[:first]...)
+}
+
+// cycleMarks returns the keys of the calls on cycles, and the labels of the
+// dependencies on cycles by the keys of their ends, giving their order,
+// e.g. "cycle 1: 2/3" for the second of the three dependencies of the
+// first cycle. A dependency on several cycles has a line for each.
+func cycleMarks(cycles []graphCycle, calls []call, fset *token.FileSet) (map[string]bool, map[[2]string]string) {
+	nodes := make(map[string]bool)
+	edges := make(map[[2]string]string)
+	for n, c := range cycles {
+		for k, i := range c {
+			from := callKey(&calls[i], fset)
+			to := callKey(&calls[c[(k+1)%len(c)]], fset)
+			nodes[from] = true
+			label := fmt.Sprintf("cycle %d: %d/%d", n+1, k+1, len(c))
+			if prev := edges[[2]string{from, to}]; prev != "" {
+				label = prev + "\n" + label
+			}
+			edges[[2]string{from, to}] = label
+		}
+	}
+	return nodes, edges
+}
+
+// cycleErrors returns an error for each of cycles, numbered as by
+// cycleMarks, listing the providers on it with their positions in the
+// order they depend on each other, like the errors of verifyAcyclic.
+func cycleErrors(cycles []graphCycle, calls []call, pset *ProviderSet, fset *token.FileSet) []error {
+	var errs []error
+	for n, c := range cycles {
+		first := types.TypeString(calls[c[0]].out, nil)
+		sb := new(strings.Builder)
+		fmt.Fprintf(sb, "cycle %d for %s:\n", n+1, first)
+		var related []RelatedPosition
+		for _, i := range c {
+			call := &calls[i]
+			out := types.TypeString(call.out, nil)
+			fmt.Fprintf(sb, "%s (%s.%s) at %v ->\n", out, call.pkg.Path(), call.name, fset.Position(call.pos))
+			related = append(related, RelatedPosition{
+				Position: fset.Position(call.pos),
+				Message:  "provider of " + out,
+			})
+		}
+		sb.WriteString(first)
+		errs = append(errs, notePosition(fset.Position(pset.Pos), categorized(CategoryCycle, sb.String(), related...)))
+	}
+	return errs
+}
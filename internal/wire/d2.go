@@ -0,0 +1,316 @@
+package wire
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"time"
+)
+
+// D2Builder draws a graph as the source of a Terrastruct D2 diagram. The
+// provider sets are containers, and the nodes of inputs and root outputs
+// have shapes of their own. Providers carry the position of their
+// declaration and the first sentence of their doc comment as a tooltip.
+type D2Builder struct {
+	root          *d2Container
+	containers    map[string]*d2Container // containers by parent key
+	paths         map[string]string       // D2 paths of the nodes by key
+	edges         []d2Edge
+	path          map[int]int           // critical path, see criticalPath
+	durations     map[int]time.Duration // measured durations of calls, by index
+	collapsedDeps map[string]bool       // keys of the nodes consumed by collapsed nodes
+	elided        map[[2]string]bool    // edges standing for elided nodes, see setElided
+	missing       map[string]bool       // keys of the inputs without a provider, see setMissing
+	cycleNodes    map[string]bool       // keys of the nodes on cycles, see setCycles
+	cycleEdges    map[[2]string]string  // labels of the edges on cycles, see setCycles
+	cluster       GraphCluster          // grouping of the providers, see setCluster
+	edgeLabels    GraphEdgeLabels       // labeling of the edges, see setEdgeLabels
+}
+
+// d2Container is a provider set drawn as a D2 container, or the diagram
+// itself.
+type d2Container struct {
+	key        string
+	path       string // D2 path of the container, empty for the diagram
+	containers []*d2Container
+	nodes      []*d2Node
+}
+
+type d2Node struct {
+	key string
+	// attrs are the fields of the node, e.g. "shape: hexagon", in order.
+	attrs []string
+}
+
+type d2Edge struct {
+	from, to string // keys of the nodes
+	// attrs are the fields of the edge, e.g. "style.stroke: blue".
+	attrs []string
+}
+
+func newD2Builder() GraphBuilder {
+	return &D2Builder{
+		root:       &d2Container{},
+		containers: map[string]*d2Container{},
+		paths:      map[string]string{},
+	}
+}
+
+func (builder *D2Builder) setCriticalPath(path map[int]int) {
+	builder.path = path
+}
+
+func (builder *D2Builder) setTimings(durations map[int]time.Duration) {
+	builder.durations = durations
+}
+
+func (builder *D2Builder) setElided(edges map[[2]string]bool) {
+	builder.elided = edges
+}
+
+func (builder *D2Builder) setMissing(keys map[string]bool) {
+	builder.missing = keys
+}
+
+func (builder *D2Builder) setCycles(nodes map[string]bool, edges map[[2]string]string) {
+	builder.cycleNodes, builder.cycleEdges = nodes, edges
+}
+
+func (builder *D2Builder) setCluster(cluster GraphCluster) {
+	builder.cluster = cluster
+}
+
+func (builder *D2Builder) setEdgeLabels(labels GraphEdgeLabels) {
+	builder.edgeLabels = labels
+}
+
+// addNode adds the node key to c, labeled with label.
+func (builder *D2Builder) addNode(c *d2Container, key string, label string, attrs ...string) {
+	path := d2Quote(key)
+	if c.path != "" {
+		path = c.path + "." + path
+	}
+	builder.paths[key] = path
+	c.nodes = append(c.nodes, &d2Node{
+		key:   key,
+		attrs: append([]string{"label: " + d2Quote(label)}, attrs...),
+	})
+}
+
+func (builder *D2Builder) addInputsForNewSet(missing []*types.Type, pset *ProviderSet) {
+	for _, m := range missing {
+		key := (*m).String()
+		attrs := []string{"shape: hexagon"}
+		// Inputs declared by wire.Requires are filled.
+		if pset.Declares(*m) {
+			attrs = append(attrs, `style.fill: "lightyellow"`)
+		}
+		builder.addNode(builder.root, key, formatKey(key), attrs...)
+	}
+}
+
+func (builder *D2Builder) addInputsForBuild(ins []*types.Var) {
+	for _, in := range ins {
+		key := inputKey(in)
+		attrs := []string{"shape: hexagon"}
+		if builder.missing[key] {
+			attrs = append(attrs, `style.stroke: "red"`, `style.font-color: "red"`, "style.stroke-dash: 3")
+		}
+		builder.addNode(builder.root, key, formatKey(key), attrs...)
+	}
+}
+
+func (builder *D2Builder) addOutputs(calls []call, pset *ProviderSet, fset *token.FileSet) {
+	// Collect all the calls whose output is used by other calls.
+	usedCalls := map[int]bool{}
+	for _, call := range calls {
+		for _, arg := range call.args {
+			usedCalls[arg] = true
+		}
+	}
+	max := maxDuration(builder.durations)
+	for i, call := range calls {
+		// Create the containers of the provider sets or package the call
+		// comes from.
+		parent := builder.root
+		for _, key := range clusterKeys(builder.cluster, pset, &call) {
+			c, ok := builder.containers[key]
+			if !ok {
+				c = &d2Container{key: key, path: d2Quote(key)}
+				if parent.path != "" {
+					c.path = parent.path + "." + c.path
+				}
+				builder.containers[key] = c
+				parent.containers = append(parent.containers, c)
+			}
+			parent = c
+		}
+
+		key := callKey(&call, fset)
+		label := formatKey(key)
+		d, timed := builder.durations[i]
+		if timed {
+			label += "\n" + d.String()
+		}
+		// Conditional providers are badged, as their output may be absent.
+		if call.conditional {
+			label += "\n[conditional]"
+		}
+		var attrs []string
+		if !usedCalls[i] && !builder.collapsedDeps[key] {
+			// The output of this call is what wire.Build ultimately returns.
+			attrs = append(attrs, "shape: oval", "style.double-border: true")
+		} else {
+			attrs = append(attrs, "shape: rectangle")
+		}
+		// Warmer fill colors indicate slower providers.
+		if timed {
+			attrs = append(attrs, "style.fill: "+d2Quote(d2HeatColor(heat(d, max))))
+		}
+		if call.conditional {
+			attrs = append(attrs, "style.stroke-dash: 3")
+		}
+		// Thicker borders indicate more expensive providers.
+		if width, ok := penWidths[call.cost]; ok {
+			attrs = append(attrs, "style.stroke-width: "+width)
+		}
+		if _, ok := builder.path[i]; ok {
+			attrs = append(attrs, `style.stroke: "blue"`)
+		}
+		if builder.cycleNodes[key] {
+			attrs = append(attrs, `style.stroke: "magenta"`, `style.font-color: "magenta"`)
+		}
+		// The tooltip locates and explains the provider.
+		if t := tooltip(&call, pset.PkgPath, fset); t != "" {
+			attrs = append(attrs, "tooltip: "+d2Quote(t))
+		}
+		builder.addNode(parent, key, label, attrs...)
+	}
+}
+
+func (builder *D2Builder) addDepsForNewSet(calls []call, missing []*types.Type, fset *token.FileSet) {
+	for i, call := range calls {
+		for j, arg := range call.args {
+			var to string
+			if arg >= len(calls) {
+				to = (*missing[arg-len(calls)]).String()
+			} else {
+				to = callKey(&calls[arg], fset)
+			}
+			from := callKey(&call, fset)
+			builder.edges = append(builder.edges, d2Edge{
+				from:  from,
+				to:    to,
+				attrs: builder.edgeAttrs(edgeLabel(builder.edgeLabels, &call, j), onPath(builder.path, i, arg), builder.elided[[2]string{from, to}], builder.cycleEdges[[2]string{from, to}]),
+			})
+		}
+	}
+}
+
+func (builder *D2Builder) addDepsForBuild(calls []call, ins []*types.Var, fset *token.FileSet) {
+	for i, call := range calls {
+		for j, arg := range call.args {
+			var to string
+			if arg < len(ins) {
+				to = inputKey(ins[arg])
+			} else {
+				to = callKey(&calls[arg-len(ins)], fset)
+			}
+			from := callKey(&call, fset)
+			builder.edges = append(builder.edges, d2Edge{
+				from:  from,
+				to:    to,
+				attrs: builder.edgeAttrs(edgeLabel(builder.edgeLabels, &call, j), onPath(builder.path, i, arg-len(ins)), builder.elided[[2]string{from, to}], builder.cycleEdges[[2]string{from, to}]),
+			})
+		}
+	}
+}
+
+func (builder *D2Builder) addCollapsed(collapsed []*collapsedNode) {
+	builder.collapsedDeps = collapsedDeps(collapsed)
+	for _, c := range collapsed {
+		// Collapsed nodes stand for nodes of any container.
+		builder.addNode(builder.root, c.key, c.label(), "shape: package", "style.stroke-dash: 3")
+		for _, from := range c.consumers {
+			builder.edges = append(builder.edges, d2Edge{from: from, to: c.key})
+		}
+		for _, to := range c.deps {
+			builder.edges = append(builder.edges, d2Edge{from: c.key, to: to})
+		}
+	}
+}
+
+// edgeAttrs returns the fields of an edge, which is labeled with label,
+// highlighted if it is on the critical path, dashed if it stands for elided
+// nodes, and magenta and labeled with cycle as well if it is on a cycle.
+func (builder *D2Builder) edgeAttrs(label string, critical bool, elided bool, cycle string) []string {
+	var attrs []string
+	if label != "" && cycle == "" {
+		attrs = append(attrs, "label: "+d2Quote(label))
+	}
+	if critical {
+		attrs = append(attrs, `style.stroke: "blue"`, "style.stroke-width: 2")
+	}
+	if elided {
+		attrs = append(attrs, "style.stroke-dash: 3")
+	}
+	if cycle != "" {
+		attrs = append(attrs, "label: "+d2Quote(joinLabels(label, cycle)), `style.stroke: "magenta"`, `style.font-color: "magenta"`)
+	}
+	return attrs
+}
+
+func (builder *D2Builder) String() string {
+	var b strings.Builder
+	builder.writeContainer(&b, builder.root, "")
+	for _, e := range builder.edges {
+		fmt.Fprintf(&b, "%s -> %s", builder.nodePath(e.from), builder.nodePath(e.to))
+		if len(e.attrs) > 0 {
+			fmt.Fprintf(&b, ": {%s}", strings.Join(e.attrs, "; "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// writeContainer writes the nodes and containers of c to b, indented by
+// indent.
+func (builder *D2Builder) writeContainer(b *strings.Builder, c *d2Container, indent string) {
+	for _, n := range c.nodes {
+		fmt.Fprintf(b, "%s%s: {\n", indent, d2Quote(n.key))
+		for _, attr := range n.attrs {
+			fmt.Fprintf(b, "%s  %s\n", indent, attr)
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+	for _, child := range c.containers {
+		fmt.Fprintf(b, "%s%s: {\n", indent, d2Quote(child.key))
+		fmt.Fprintf(b, "%s  label: %s\n", indent, d2Quote(formatKey(child.key)))
+		builder.writeContainer(b, child, indent+"  ")
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+}
+
+// nodePath returns the D2 path of the node key, which is at the top level
+// if it was not added.
+func (builder *D2Builder) nodePath(key string) string {
+	if path, ok := builder.paths[key]; ok {
+		return path
+	}
+	return d2Quote(key)
+}
+
+// d2Quote returns str as a double-quoted D2 string, in which "." does not
+// separate the keys of a path.
+func d2Quote(str string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(str) + `"`
+}
+
+// d2HeatColor returns the D2 fill color of a node whose duration has heat
+// h, from white to red, as heatColor does for graphviz.
+func d2HeatColor(h float64) string {
+	c := int((1-h)*255 + 0.5)
+	return fmt.Sprintf("#ff%02x%02x", c, c)
+}
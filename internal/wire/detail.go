@@ -0,0 +1,208 @@
+package wire
+
+import (
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// InjectorDetail describes an injector as printed by the detail command.
+type InjectorDetail struct {
+	// Injector is the described injector. Its Set is nil if the provider
+	// set passed to wire.Build could not be built.
+	Injector *Injector
+	// Signature is the declaration of the injector function, with types
+	// of the injector's package unqualified.
+	Signature string
+	// Steps lists the steps of the solved graph in call order. It is empty
+	// if the injector could not be solved.
+	Steps []*InjectorStep
+	// UnusedInputs lists the parameters of the injector that no step
+	// consumes, as "name type".
+	UnusedInputs []string
+	// MissingInputs lists the types needed to produce the output of the
+	// injector that nothing in its provider set or parameters provides,
+	// sorted.
+	MissingInputs []string
+	// Errs holds the errors found while building the provider set and
+	// solving the graph.
+	Errs []error
+}
+
+// InjectorStep describes a single step of a solved injector.
+type InjectorStep struct {
+	// Kind is "provider", "struct provider", "value" or "field".
+	Kind string
+	// Name is the provider as "path/to/pkg.Name". It is only set for
+	// providers.
+	Name string
+	// Type is the type provided by the step.
+	Type string
+	// Position is the position of the declaration of the provider, value or
+	// field.
+	Position token.Position
+	// Args lists the arguments the step is called with, in order. It is
+	// empty for values.
+	Args []StepArg
+}
+
+// A StepArg is an argument of an InjectorStep: either a parameter of the
+// injector or the result of an earlier step.
+type StepArg struct {
+	// Type is the type of the argument.
+	Type string
+	// Param is the index of the injector parameter passed as the argument,
+	// or -1 if the argument is the result of Steps[Step].
+	Param int
+	// Name is the name of the parameter, if Param is not -1.
+	Name string
+	// Step is the index in Steps of the step whose result is passed as the
+	// argument, if Param is -1.
+	Step int
+}
+
+// DescribeInjector returns the detail of the injector named name in pkg, or
+// nil if pkg declares no injector by that name. Errors in the injector are
+// reported in the Errs field of the result, along with as much of the
+// detail as could be found.
+func DescribeInjector(pkg *packages.Package, name string) *InjectorDetail {
+	fn := findFuncDecl(pkg, name)
+	if fn == nil {
+		return nil
+	}
+	build, err := findInjectorBuild(pkg.TypesInfo, fn)
+	if err == nil && build == nil {
+		return nil
+	}
+	obj := pkg.TypesInfo.ObjectOf(fn.Name)
+	d := &InjectorDetail{
+		Injector:  &Injector{Pos: fn.Pos(), ImportPath: pkg.PkgPath, FuncName: name},
+		Signature: types.ObjectString(obj, types.RelativeTo(pkg.Types)),
+	}
+	note := func(e error) error {
+		return noteInjector(name, pkg.Fset.Position(fn.Pos()), e)
+	}
+	if err != nil {
+		d.Errs = []error{note(err)}
+		return d
+	}
+	params, out, err := injectorFuncSignature(obj.Type().(*types.Signature))
+	if err != nil {
+		d.Errs = []error{note(err)}
+		return d
+	}
+	injectorArgs := &InjectorArgs{
+		Name:  name,
+		Tuple: params,
+		Pos:   fn.Pos(),
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	set, errs := oc.processNewSet(pkg.TypesInfo, pkg.PkgPath, build, injectorArgs, "")
+	if len(errs) > 0 {
+		d.Errs = notePositionAll(pkg.Fset.Position(fn.Pos()), errs)
+		return d
+	}
+	d.Injector.Set = set
+	d.MissingInputs = missingInputs(set, out.out)
+	calls, errs := solve(pkg.Fset, out.out, params, set)
+	if len(errs) > 0 {
+		d.Errs = mapErrors(errs, note)
+		return d
+	}
+	used := make([]bool, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		used[i] = types.Identical(params.At(i).Type(), out.out)
+	}
+	for i := range calls {
+		c := &calls[i]
+		for _, a := range c.args {
+			if a < params.Len() {
+				used[a] = true
+			}
+		}
+		kind, providerName := describeCall(c)
+		step := &InjectorStep{
+			Kind:     kind,
+			Name:     providerName,
+			Type:     types.TypeString(c.out, nil),
+			Position: pkg.Fset.Position(c.pos),
+		}
+		for j, a := range c.args {
+			arg := StepArg{Param: -1}
+			var t types.Type
+			if a < params.Len() {
+				arg.Param, arg.Name = a, params.At(a).Name()
+				t = params.At(a).Type()
+			} else {
+				arg.Step = a - params.Len()
+				t = calls[arg.Step].out
+			}
+			// Fields have no ins: their single argument is the struct.
+			if j < len(c.ins) {
+				t = c.ins[j]
+			}
+			arg.Type = types.TypeString(t, nil)
+			step.Args = append(step.Args, arg)
+		}
+		d.Steps = append(d.Steps, step)
+	}
+	for i := 0; i < params.Len(); i++ {
+		if !used[i] {
+			p := params.At(i)
+			d.UnusedInputs = append(d.UnusedInputs, p.Name()+" "+types.TypeString(p.Type(), nil))
+		}
+	}
+	return d
+}
+
+// describeCall returns the kind of step c, as in InjectorStep.Kind, and the
+// name of its provider as "path/to/pkg.Name", if it calls one.
+func describeCall(c *call) (kind, name string) {
+	switch c.kind {
+	case funcProviderCall:
+		return "provider", c.pkg.Path() + "." + c.name
+	case structProvider:
+		return "struct provider", ""
+	case valueExpr:
+		return "value", ""
+	case selectorExpr:
+		return "field", ""
+	}
+	panic("unreachable")
+}
+
+// missingInputs returns the types that out depends on in set but that set
+// does not provide, sorted. Unlike solve, it does not stop at the first
+// missing type, so that all of them can be reported at once.
+func missingInputs(set *ProviderSet, out types.Type) []string {
+	var missing []string
+	var visited typeutil.Map
+	stk := []types.Type{out}
+	for len(stk) > 0 {
+		t := stk[len(stk)-1]
+		stk = stk[:len(stk)-1]
+		if visited.At(t) != nil {
+			continue
+		}
+		visited.Set(t, true)
+		pv := set.For(t)
+		switch {
+		case pv.IsNil():
+			missing = append(missing, types.TypeString(t, nil))
+		case !types.Identical(pv.Type(), t):
+			// Interface binding.
+			stk = append(stk, pv.Type())
+		case pv.IsProvider():
+			for _, a := range pv.Provider().Args {
+				stk = append(stk, a.Type)
+			}
+		case pv.IsField():
+			stk = append(stk, pv.Field().Parent)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
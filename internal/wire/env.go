@@ -0,0 +1,112 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// TmpDirEnv is the environment variable naming a writable directory that
+// wireplus uses for the Go build cache when GOCACHE is not writable.
+const TmpDirEnv = "WIREPLUS_TMPDIR"
+
+// SandboxEnv returns env with GOCACHE and GOPATH overridden by gocache and
+// gopath when they are non-empty. If gocache is empty and env sets
+// WIREPLUS_TMPDIR, the build cache is placed in a subdirectory of it.
+//
+// SandboxEnv then verifies that the effective GOCACHE is writable, so that
+// a read-only cache is reported once with an actionable message instead of
+// once per package by go/packages.
+func SandboxEnv(ctx context.Context, env []string, gocache, gopath string) ([]string, error) {
+	if gocache == "" {
+		if tmp := lookupEnv(env, TmpDirEnv); tmp != "" {
+			gocache = filepath.Join(tmp, "gocache")
+		}
+	}
+	env = append([]string(nil), env...)
+	for _, kv := range []struct{ key, dir string }{{"GOCACHE", gocache}, {"GOPATH", gopath}} {
+		if kv.dir == "" {
+			continue
+		}
+		dir, err := filepath.Abs(kv.dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %v", kv.key, err)
+		}
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, fmt.Errorf("create %s directory: %v", kv.key, err)
+		}
+		env = append(env, kv.key+"="+dir)
+	}
+	cache, err := effectiveGoCache(ctx, env)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(cache) {
+		// The go command rejects relative paths and "off" with its own error.
+		return env, nil
+	}
+	if err := checkWritable(cache); err != nil {
+		return nil, fmt.Errorf("GOCACHE directory %s is not writable (%v); "+
+			"point GOCACHE at a writable directory, pass -gocache, or set %s", cache, err, TmpDirEnv)
+	}
+	return env, nil
+}
+
+// lookupEnv returns the value of key in env. As with os/exec, the last
+// occurrence of key takes precedence.
+func lookupEnv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], key+"=") {
+			return env[i][len(key)+1:]
+		}
+	}
+	return ""
+}
+
+// debugEnvKeys are the variables of the environment that affect how
+// packages are loaded, as logged for debugging.
+var debugEnvKeys = []string{"GOFLAGS", "GO111MODULE", "GOOS", "GOARCH", "GOPATH", "GOCACHE", "GOPROXY", "CGO_ENABLED"}
+
+// debugEnv returns the variables of env among debugEnvKeys that are set, as
+// a comma-separated list of key=value pairs.
+func debugEnv(env []string) string {
+	var kvs []string
+	for _, key := range debugEnvKeys {
+		if v := lookupEnv(env, key); v != "" {
+			kvs = append(kvs, key+"="+v)
+		}
+	}
+	return strings.Join(kvs, ",")
+}
+
+// effectiveGoCache returns the build cache directory the go command would
+// use with env.
+func effectiveGoCache(ctx context.Context, env []string) (string, error) {
+	if cache := lookupEnv(env, "GOCACHE"); cache != "" {
+		return cache, nil
+	}
+	cmd := exec.CommandContext(ctx, "go", "env", "GOCACHE")
+	cmd.Env = env
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env GOCACHE: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkWritable reports an error if a file cannot be created in dir.
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "wireplus-preflight")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -15,7 +15,16 @@
 package wire
 
 import (
+	"errors"
+	"fmt"
 	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
 )
 
 // errorCollector manages a list of errors. The zero value is an empty list.
@@ -44,10 +53,55 @@ func mapErrors(errs []error, f func(error) error) []error {
 	return newErrs
 }
 
+// Categories of WireErr, as returned by its Category method. They are
+// stable, so that tools can tell errors apart without parsing messages.
+const (
+	// CategoryInvalid is the category of the errors without a more
+	// specific one, such as an invalid provider or injector.
+	CategoryInvalid = "invalid"
+	// CategoryLoad is the category of the errors loading packages, such
+	// as syntax and type errors.
+	CategoryLoad = "load"
+	// CategoryNoProvider is the category of an injector missing a
+	// provider for a type.
+	CategoryNoProvider = "no-provider"
+	// CategoryCycle is the category of providers depending on each other.
+	CategoryCycle = "cycle"
+	// CategoryConflict is the category of a type provided more than once
+	// in a provider set.
+	CategoryConflict = "multiple-bindings"
+	// CategoryUnused is the category of an argument of wire.Build that the
+	// injector does not need.
+	CategoryUnused = "unused"
+)
+
+// A RelatedPosition is a position involved in a WireErr other than its
+// own, such as a provider of a cycle.
+type RelatedPosition struct {
+	Position token.Position
+	// Message describes the role of the position in the error, e.g.
+	// "provider of *Config".
+	Message string
+}
+
 // WireErr is an error with an optional position.
 type WireErr struct {
 	error    error
 	position token.Position
+	// pkgPath is the import path of the package being analyzed when the
+	// error was found, if known.
+	pkgPath string
+	// category is one of the Category constants, or empty for
+	// CategoryInvalid.
+	category string
+	related  []RelatedPosition
+}
+
+// categorized returns the error with message msg, of the given category
+// and related positions. Its position is noted by the callers, as for
+// other errors.
+func categorized(category string, msg string, related ...RelatedPosition) error {
+	return &WireErr{error: errors.New(msg), category: category, related: related}
 }
 
 // notePosition wraps an error with position information if it doesn't already
@@ -56,18 +110,38 @@ type WireErr struct {
 // notePosition is usually called multiple times as an error goes up the call
 // stack, so calling notePosition on an existing *wireErr will not modify the
 // position, as the assumption is that deeper calls have more precise position
-// information about the source of the error.
+// information about the source of the error. A *WireErr without a position,
+// such as one returned by categorized, gets p.
 func notePosition(p token.Position, e error) error {
-	switch e.(type) {
+	switch e := e.(type) {
 	case nil:
 		return nil
 	case *WireErr:
-		return e
+		if e.position.IsValid() || !p.IsValid() {
+			return e
+		}
+		c := *e
+		c.position = p
+		return &c
 	default:
 		return &WireErr{error: e, position: p}
 	}
 }
 
+// noteInjector prefixes the message of e with the name of the injector it
+// was found in, keeping its position, category and related positions if it
+// is a *WireErr. Other errors, and a *WireErr without a position, get the
+// position p of the injector.
+func noteInjector(name string, p token.Position, e error) error {
+	w, ok := notePosition(p, e).(*WireErr)
+	if !ok {
+		return e
+	}
+	c := *w
+	c.error = fmt.Errorf("inject %s: %v", name, w.error)
+	return &c
+}
+
 // notePositionAll wraps a list of errors with the given position.
 func notePositionAll(p token.Position, errs []error) []error {
 	return mapErrors(errs, func(e error) error {
@@ -75,6 +149,22 @@ func notePositionAll(p token.Position, errs []error) []error {
 	})
 }
 
+// notePkgPath returns errs with the package being analyzed set to pkgPath,
+// wrapping the errors that are not a *WireErr without a position. Errors
+// that already have a package keep it. The errors are copied rather than
+// modified, as they may be shared by several packages.
+func notePkgPath(pkgPath string, errs []error) []error {
+	return mapErrors(errs, func(e error) error {
+		w, ok := notePosition(token.Position{}, e).(*WireErr)
+		if !ok || w.pkgPath != "" {
+			return e
+		}
+		c := *w
+		c.pkgPath = pkgPath
+		return &c
+	})
+}
+
 // Error returns the error message prefixed by the position if valid.
 func (w *WireErr) Error() string {
 	if !w.position.IsValid() {
@@ -92,3 +182,70 @@ func (w *WireErr) Message() string {
 func (w *WireErr) Position() token.Position {
 	return w.position
 }
+
+// Category returns the category of the error, one of the Category
+// constants.
+func (w *WireErr) Category() string {
+	if w.category == "" {
+		return CategoryInvalid
+	}
+	return w.category
+}
+
+// Related returns the positions involved in the error other than its own,
+// in order.
+func (w *WireErr) Related() []RelatedPosition {
+	return w.related
+}
+
+// PkgPath returns the import path of the package being analyzed when the
+// error was found, or the empty string if unknown.
+func (w *WireErr) PkgPath() string {
+	return w.pkgPath
+}
+
+// errorLinePattern matches a line of an error mentioning a position, such
+// as "/src/app/go.mod:3: unknown directive: requir".
+var errorLinePattern = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?: (.*)$`)
+
+// ErrorPosition returns the position err is about, if any, and its message
+// without the position. Relative paths in errors, as reported by the go
+// command, are relative to dir.
+func ErrorPosition(dir string, err error) (token.Position, string) {
+	switch err := err.(type) {
+	case *WireErr:
+		if p := err.Position(); p.IsValid() {
+			return p, err.Message()
+		}
+	case packages.Error:
+		if pos, ok := matchPosition(dir, err.Pos+": "+err.Msg); ok {
+			return pos, err.Msg
+		}
+	}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		line = strings.TrimSpace(line)
+		if pos, ok := matchPosition(dir, line); ok {
+			return pos, errorLinePattern.FindStringSubmatch(line)[4]
+		}
+	}
+	return token.Position{}, err.Error()
+}
+
+// matchPosition returns the position at the start of line, if it matches
+// errorLinePattern and mentions an existing file.
+func matchPosition(dir string, line string) (token.Position, bool) {
+	m := errorLinePattern.FindStringSubmatch(line)
+	if m == nil {
+		return token.Position{}, false
+	}
+	path := m[1]
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+		return token.Position{}, false
+	}
+	n, _ := strconv.Atoi(m[2])
+	col, _ := strconv.Atoi(m[3])
+	return token.Position{Filename: path, Line: n, Column: col}, true
+}
@@ -0,0 +1,315 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// ModuleUsage counts the providers, values and bound implementations
+// that a single module contributes to one or more solved injectors.
+type ModuleUsage struct {
+	// Path is the module path. It is empty for the main module and the
+	// standard library.
+	Path string `json:"path,omitempty"`
+	// Version is the required version of the module.
+	Version string `json:"version,omitempty"`
+	// Replace is the replacement of the module, if any.
+	Replace string `json:"replace,omitempty"`
+	// Injectors is the number of injectors the module contributes to.
+	// It is only set in the rollup of ModulesReport.
+	Injectors int `json:"injectors,omitempty"`
+
+	Providers int `json:"providers"`
+	Values    int `json:"values"`
+	Bindings  int `json:"bindings"`
+}
+
+// Total returns the number of contributions counted in m.
+func (m *ModuleUsage) Total() int {
+	return m.Providers + m.Values + m.Bindings
+}
+
+// InjectorModules describes the modules contributing to a single injector.
+type InjectorModules struct {
+	// Injector is the injector name as ""path/to/pkg".Foo".
+	Injector string `json:"injector"`
+	// Main counts contributions from the main module.
+	Main *ModuleUsage `json:"main"`
+	// Std counts contributions from the standard library.
+	Std *ModuleUsage `json:"std"`
+	// External counts contributions from other modules, sorted by path.
+	External []*ModuleUsage `json:"external"`
+}
+
+// ModulesReport is the result of ExportModules.
+type ModulesReport struct {
+	// Injectors is the list of injectors, sorted by name.
+	Injectors []*InjectorModules `json:"injectors"`
+	// Rollup aggregates Injectors over all injectors.
+	Rollup *InjectorModules `json:"rollup"`
+}
+
+// ExportModules solves every injector in the packages matching patterns and
+// attributes each provider, value and bound implementation in the solved
+// graph to the module that declares it.
+func ExportModules(ctx context.Context, wd string, env []string, patterns []string, tags string) (*ModulesReport, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	a := newModuleAttributor(pkgs)
+	report := &ModulesReport{
+		Rollup: newInjectorModules("<rollup>"),
+	}
+	errs = solveInjectors(pkgs, func(in *Injector, sol *buildSolution) {
+		report.Injectors = append(report.Injectors, a.attribute(in.String(), sol))
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	sort.Slice(report.Injectors, func(i, j int) bool {
+		return report.Injectors[i].Injector < report.Injectors[j].Injector
+	})
+	for _, im := range report.Injectors {
+		report.Rollup.merge(im)
+	}
+	return report, nil
+}
+
+// SetInputs describes the inputs of a provider set.
+type SetInputs struct {
+	// Set is the provider set name as ""path/to/pkg".Set".
+	Set string `json:"set"`
+	// Inputs lists the types that the set needs but does not provide: the
+	// ones declared by wire.Requires in order if Declared, or else the ones
+	// inferred from its providers, sorted.
+	Inputs []string `json:"inputs"`
+	// Declared reports whether the set declares its inputs with
+	// wire.Requires.
+	Declared bool `json:"declared"`
+}
+
+// SetsReport is the result of ExportSets.
+type SetsReport struct {
+	// Sets is the list of provider sets, sorted by name.
+	Sets []*SetInputs `json:"sets"`
+}
+
+// ExportSets lists the inputs of every top-level provider set in the
+// packages matching patterns.
+func ExportSets(ctx context.Context, wd string, env []string, patterns []string, tags string) (*SetsReport, []error) {
+	info, errs := Load(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	report := new(SetsReport)
+	for id, set := range info.Sets {
+		si := &SetInputs{
+			Set:      id.String(),
+			Inputs:   []string{},
+			Declared: len(set.Requires) > 0,
+		}
+		if si.Declared {
+			for _, r := range set.Requires {
+				si.Inputs = append(si.Inputs, types.TypeString(r.Type, nil))
+			}
+		} else {
+			for _, t := range set.Inputs() {
+				si.Inputs = append(si.Inputs, types.TypeString(t, nil))
+			}
+		}
+		report.Sets = append(report.Sets, si)
+	}
+	sort.Slice(report.Sets, func(i, j int) bool {
+		return report.Sets[i].Set < report.Sets[j].Set
+	})
+	return report, nil
+}
+
+func newInjectorModules(name string) *InjectorModules {
+	return &InjectorModules{
+		Injector: name,
+		Main:     new(ModuleUsage),
+		Std:      new(ModuleUsage),
+	}
+}
+
+// usage returns the ModuleUsage for mod, adding it to im if necessary.
+func (im *InjectorModules) usage(mod *packages.Module) *ModuleUsage {
+	for _, u := range im.External {
+		if u.Path == mod.Path {
+			return u
+		}
+	}
+	u := &ModuleUsage{
+		Path:    mod.Path,
+		Version: mod.Version,
+	}
+	if r := mod.Replace; r != nil {
+		u.Replace = strings.TrimSpace(r.Path + " " + r.Version)
+	}
+	im.External = append(im.External, u)
+	sort.Slice(im.External, func(i, j int) bool {
+		return im.External[i].Path < im.External[j].Path
+	})
+	return u
+}
+
+// merge adds the counts of other to im and increments the number of
+// injectors for each module that other has contributions from.
+func (im *InjectorModules) merge(other *InjectorModules) {
+	add := func(dst, src *ModuleUsage) {
+		if src.Total() == 0 {
+			return
+		}
+		dst.Injectors++
+		dst.Providers += src.Providers
+		dst.Values += src.Values
+		dst.Bindings += src.Bindings
+	}
+	add(im.Main, other.Main)
+	add(im.Std, other.Std)
+	for _, u := range other.External {
+		dst := im.usage(&packages.Module{Path: u.Path, Version: u.Version})
+		if dst.Replace == "" {
+			dst.Replace = u.Replace
+		}
+		add(dst, u)
+	}
+}
+
+// moduleAttributor maps packages in the import graph to their modules.
+type moduleAttributor struct {
+	byPath map[string]*packages.Package
+	byInfo map[*types.Info]*packages.Package
+}
+
+func newModuleAttributor(pkgs []*packages.Package) *moduleAttributor {
+	a := &moduleAttributor{
+		byPath: make(map[string]*packages.Package),
+		byInfo: make(map[*types.Info]*packages.Package),
+	}
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		a.byPath[p.PkgPath] = p
+		if p.TypesInfo != nil {
+			a.byInfo[p.TypesInfo] = p
+		}
+	})
+	return a
+}
+
+// attribute counts the contributions of each module to sol.
+func (a *moduleAttributor) attribute(name string, sol *buildSolution) *InjectorModules {
+	im := newInjectorModules(name)
+	// Interface bindings do not create calls, so they are found by looking
+	// at the types consumed by the calls and the injector itself.
+	var bound typeutil.Map
+	bind := func(t types.Type) {
+		if bound.At(t) != nil {
+			return
+		}
+		bound.Set(t, true)
+		if src := leafSrc(sol.pset, t); src != nil && src.Binding != nil {
+			a.usage(im, typePackage(src.Binding.Provided)).Bindings++
+		}
+	}
+	bind(sol.out)
+	for i := range sol.calls {
+		c := &sol.calls[i]
+		for _, in := range c.ins {
+			bind(in)
+		}
+		switch c.kind {
+		case funcProviderCall, structProvider, selectorExpr:
+			a.usage(im, c.pkg).Providers++
+		case valueExpr:
+			var pkg *types.Package
+			if p := a.byInfo[c.valueTypeInfo]; p != nil {
+				pkg = p.Types
+			}
+			a.usage(im, pkg).Values++
+		}
+	}
+	return im
+}
+
+// usage returns the ModuleUsage in im that pkg should be attributed to.
+func (a *moduleAttributor) usage(im *InjectorModules, pkg *types.Package) *ModuleUsage {
+	if pkg == nil {
+		// Values and bindings of unnamed types are declared by the main module.
+		return im.Main
+	}
+	p := a.byPath[pkg.Path()]
+	switch {
+	case p != nil && p.Module != nil && !p.Module.Main:
+		return im.usage(p.Module)
+	case p != nil && p.Module != nil:
+		return im.Main
+	case isStdlib(pkg.Path()):
+		return im.Std
+	default:
+		// Packages outside of module mode are attributed to the main module.
+		return im.Main
+	}
+}
+
+// leafSrc returns the providerSetSrc that provides t in set, following
+// imported provider sets, or nil if t is not provided by set.
+func leafSrc(set *ProviderSet, t types.Type) *providerSetSrc {
+	for set != nil {
+		v := set.srcMap.At(t)
+		if v == nil {
+			return nil
+		}
+		src := v.(*providerSetSrc)
+		if src.Import == nil {
+			return src
+		}
+		set = src.Import
+	}
+	return nil
+}
+
+// typePackage returns the package declaring t, after removing any pointer
+// indirections, or nil if t is not a named type.
+func typePackage(t types.Type) *types.Package {
+	for {
+		switch u := t.(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Named:
+			return u.Obj().Pkg()
+		default:
+			return nil
+		}
+	}
+}
+
+// isStdlib reports whether path is the import path of a standard library
+// package. As with the go command, these are the paths whose first element
+// does not contain a dot.
+func isStdlib(path string) bool {
+	if i := strings.Index(path, "/"); i >= 0 {
+		path = path[:i]
+	}
+	return !strings.Contains(path, ".")
+}
+
+// String returns a human-readable summary of the counts in m.
+func (m *ModuleUsage) String() string {
+	return fmt.Sprintf("%s, %s, %s",
+		plural(m.Providers, "provider"), plural(m.Values, "value"), plural(m.Bindings, "binding"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,113 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A SetExtraction moves arguments of a wire.Build or wire.NewSet call to a
+// new provider set, as found by ExtractSetAt.
+type SetExtraction struct {
+	// Name is the name of the package variable declared for the new set,
+	// e.g. "extractedSet".
+	Name string
+	// Call is the wire.Build or wire.NewSet call, and Args the arguments
+	// moved out of it.
+	Call *ast.CallExpr
+	Args []ast.Expr
+	// Edits are the edits to make to the file of Call, in order: the
+	// declaration of the set before the top-level declaration enclosing
+	// Call, and the replacement of Args by Name.
+	Edits []Edit
+}
+
+// ExtractSetAt returns the extraction of the arguments that the selection
+// between pos and end overlaps, in the innermost wire.Build or wire.NewSet
+// call enclosing it. It returns nil if the selection is empty, is not
+// within the parentheses of such a call or overlaps none of its arguments,
+// or if it covers all the arguments of a wire.NewSet call, which would
+// only be renamed.
+func ExtractSetAt(pkg *packages.Package, pos, end token.Pos) *SetExtraction {
+	if pos >= end {
+		return nil
+	}
+	path := pathEnclosingPos(pkg, pos)
+	if len(path) < 2 {
+		return nil
+	}
+	var call *ast.CallExpr
+	for _, n := range path {
+		c, ok := n.(*ast.CallExpr)
+		if ok && c.Lparen < pos && end <= c.Rparen && isWireCall(pkg.TypesInfo, c, "Build", "NewSet") {
+			call = c
+			break
+		}
+	}
+	if call == nil {
+		return nil
+	}
+	var args []ast.Expr
+	for _, arg := range call.Args {
+		if arg.Pos() < end && pos < arg.End() {
+			args = append(args, arg)
+		}
+	}
+	if len(args) == 0 || len(args) == len(call.Args) && isWireCall(pkg.TypesInfo, call, "NewSet") {
+		return nil
+	}
+	file := path[len(path)-1].(*ast.File)
+	name := "extractedSet"
+	// The set must not be shadowed where it replaces the arguments.
+	scope := pkg.Types.Scope().Innermost(pos)
+	if scope == nil {
+		return nil
+	}
+	for i := 2; ; i++ {
+		if _, obj := scope.LookupParent(name, token.NoPos); obj == nil && !nameInFile(pkg, file, name) {
+			break
+		}
+		name = fmt.Sprintf("extractedSet%d", i)
+	}
+
+	// Qualify wire.NewSet as the call does, e.g. for a renamed import.
+	newSet := "NewSet"
+	if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+		newSet = types.ExprString(sel.X) + ".NewSet"
+	}
+	srcs := make([]string, len(args))
+	for i, arg := range args {
+		var buf bytes.Buffer
+		if err := format.Node(&buf, pkg.Fset, arg); err != nil {
+			return nil
+		}
+		srcs[i] = buf.String()
+	}
+	decl := path[len(path)-2]
+	at := decl.Pos()
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		if decl.Doc != nil {
+			at = decl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if decl.Doc != nil {
+			at = decl.Doc.Pos()
+		}
+	}
+	return &SetExtraction{
+		Name: name,
+		Call: call,
+		Args: args,
+		Edits: []Edit{
+			{Pos: at, End: at, NewText: fmt.Sprintf("var %s = %s(%s)\n\n", name, newSet, strings.Join(srcs, ", "))},
+			{Pos: args[0].Pos(), End: args[len(args)-1].End(), NewText: name},
+		},
+	}
+}
@@ -0,0 +1,350 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A ProviderFix adds a provider of a type that an injector is missing to
+// its wire.Build call, as found by ProviderFixesAt.
+type ProviderFix struct {
+	// Type is the missing type, as in the "no provider found" error of the
+	// injector.
+	Type string
+	// Provider is the function returning Type. It is nil for the fixes of
+	// CandidateFixesAt, whose packages may not be loaded with the
+	// injector's.
+	Provider *types.Func
+	// Expr is the expression inserted in the call, e.g. "NewConfig" or
+	// "config.NewConfig".
+	Expr string
+	// Bind is the wire.Bind call inserted after Expr if the provider
+	// returns a type implementing Type rather than Type, e.g.
+	// "wire.Bind(new(Fooer), new(*foo.Foo))".
+	Bind string
+	// Imports lists the paths of the packages to import for Expr and Bind
+	// that the file of the injector does not import yet.
+	Imports []string
+	// Edits are the edits to make to the file of the injector, in order.
+	Edits []Edit
+}
+
+// An Edit replaces the text between Pos and End with NewText. Pos equals
+// End for an insertion.
+type Edit struct {
+	Pos, End token.Pos
+	NewText  string
+}
+
+// ProviderFixesAt returns the fixes for the injector enclosing pos: for
+// each type the injector is missing, a fix per function of pkg or of its
+// dependencies that provides it. Functions of other packages must be
+// exported and importable from pkg. The fixes are sorted by type, with the
+// functions of pkg first and the others by package path and name. It
+// returns nil if pos is not in an injector or its wire.Build call does not
+// form a valid provider set.
+func ProviderFixesAt(pkg *packages.Package, pos token.Pos) []*ProviderFix {
+	path, fn, build := injectorAt(pkg, pos)
+	if build == nil {
+		return nil
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	missing := buildMissing(oc, pkg, path, build)
+	if len(missing) == 0 {
+		return nil
+	}
+	file := path[len(path)-1].(*ast.File)
+	injector := pkg.TypesInfo.Defs[fn.Name]
+
+	// The packages are visited in dependency order, so sort the others
+	// by path to keep the fixes stable.
+	var others []*packages.Package
+	packages.Visit([]*packages.Package{pkg}, nil, func(p *packages.Package) {
+		if p != pkg && p.Types != nil && !isWireImport(p.PkgPath) && canImport(pkg.PkgPath, p.PkgPath) {
+			others = append(others, p)
+		}
+	})
+	sort.Slice(others, func(i, j int) bool { return others[i].PkgPath < others[j].PkgPath })
+
+	var fixes []*ProviderFix
+	for _, typ := range missing {
+		for _, p := range append([]*packages.Package{pkg}, others...) {
+			scope := p.Types.Scope()
+			for _, name := range scope.Names() {
+				provider, ok := scope.Lookup(name).(*types.Func)
+				if !ok || provider == injector || (p != pkg && !provider.Exported()) {
+					continue
+				}
+				if !providesType(oc, provider, typ) {
+					continue
+				}
+				fix := &ProviderFix{Type: typ, Provider: provider, Expr: name}
+				if p != pkg {
+					qual, imported := importName(pkg, file, p.Types)
+					if !imported && nameInFile(pkg, file, qual) {
+						// The name of the package is taken in the file.
+						continue
+					}
+					if qual != "." {
+						fix.Expr = qual + "." + name
+					}
+					if !imported {
+						fix.Imports = []string{p.PkgPath}
+						fix.Edits = append(fix.Edits, importEdit(file, p.PkgPath))
+					}
+				}
+				fix.Edits = append(fix.Edits, appendArgEdit(build, fix.Expr))
+				fixes = append(fixes, fix)
+			}
+		}
+	}
+	return fixes
+}
+
+// An UnusedArg is an argument of the wire.Build call of an injector that
+// provides nothing the injector uses, as found by UnusedArgsAt.
+type UnusedArg struct {
+	// Arg is the argument.
+	Arg ast.Expr
+	// Messages are the errors reported for the elements of the provider set
+	// that Arg adds, without the name of the injector, e.g.
+	// `unused provider "main.NewLogger"`.
+	Messages []string
+	// Edit deletes Arg and the comma separating it from the other
+	// arguments.
+	Edit Edit
+}
+
+// UnusedArgsAt returns the unused arguments of the wire.Build call of the
+// injector enclosing pos, in order. An argument is unused if none of the
+// providers, bindings, values, fields and provider sets it adds are used.
+// It returns nil if pos is not in an injector or the injector cannot be
+// solved for another reason.
+func UnusedArgsAt(pkg *packages.Package, pos token.Pos) []*UnusedArg {
+	_, fn, build := injectorAt(pkg, pos)
+	if build == nil {
+		return nil
+	}
+	oc := newObjectCache([]*packages.Package{pkg})
+	set, params, out := injectorSet(oc, pkg, fn, build)
+	if set == nil {
+		return nil
+	}
+	_, used, errs := solveUsed(pkg.Fset, out, params, set)
+	if len(errs) > 0 {
+		return nil
+	}
+	unused := make(map[splicedKey]bool)
+	for _, key := range unusedElements(set, used) {
+		unused[key] = true
+	}
+	var args []*UnusedArg
+	for i, arg := range build.Args {
+		ua := &UnusedArg{Arg: arg}
+		for _, key := range argKeys(set, arg) {
+			if !unused[key] {
+				ua = nil
+				break
+			}
+			ua.Messages = append(ua.Messages, set.describeUnused(key))
+		}
+		if ua == nil || len(ua.Messages) == 0 {
+			// wire.Requires and wire.Optional add nothing to be used.
+			continue
+		}
+		switch {
+		case len(build.Args) == 1:
+			ua.Edit = Edit{Pos: arg.Pos(), End: arg.End()}
+		case i == len(build.Args)-1:
+			// Keep any trailing comma of a call split across lines.
+			ua.Edit = Edit{Pos: build.Args[i-1].End(), End: arg.End()}
+		default:
+			ua.Edit = Edit{Pos: arg.Pos(), End: build.Args[i+1].Pos()}
+		}
+		args = append(args, ua)
+	}
+	return args
+}
+
+// argKeys returns the elements of set added by arg, one of the arguments
+// of its wire.Build call, in the order of unusedElements.
+func argKeys(set *ProviderSet, arg ast.Expr) []splicedKey {
+	var keys []splicedKey
+	for _, kind := range []string{"import", "provider", "value", "binding", "field"} {
+		var n int
+		switch kind {
+		case "import":
+			n = len(set.Imports)
+		case "provider":
+			n = len(set.Providers)
+		case "value":
+			n = len(set.Values)
+		case "binding":
+			n = len(set.Bindings)
+		case "field":
+			n = len(set.Fields)
+		}
+		for i := 0; i < n; i++ {
+			if key := (splicedKey{kind, i}); set.args[key] == arg {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// injectorSet returns the provider set of call, the wire.Build call of the
+// injector fn or a copy of it with other arguments, along with the
+// parameters and output type of fn. The set is nil if the signature of fn
+// or call is invalid.
+func injectorSet(oc *objectCache, pkg *packages.Package, fn *ast.FuncDecl, call *ast.CallExpr) (*ProviderSet, *types.Tuple, types.Type) {
+	sig := pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature)
+	params, out, err := injectorFuncSignature(sig)
+	if err != nil {
+		return nil, nil, nil
+	}
+	injectorArgs := &InjectorArgs{
+		Name:  fn.Name.Name,
+		Tuple: params,
+		Pos:   fn.Pos(),
+	}
+	set, errs := oc.processNewSet(pkg.TypesInfo, pkg.PkgPath, call, injectorArgs, "")
+	if len(errs) > 0 {
+		return nil, nil, nil
+	}
+	return set, params, out.out
+}
+
+// injectorAt returns the path from pos to the root of its file, the
+// injector enclosing pos and its wire.Build call, or a nil call if pos is
+// not in an injector calling wire.Build correctly.
+func injectorAt(pkg *packages.Package, pos token.Pos) ([]ast.Node, *ast.FuncDecl, *ast.CallExpr) {
+	path := pathEnclosingPos(pkg, pos)
+	var fn *ast.FuncDecl
+	for _, n := range path {
+		if decl, ok := n.(*ast.FuncDecl); ok {
+			fn = decl
+			break
+		}
+	}
+	if fn == nil || fn.Recv != nil {
+		return path, fn, nil
+	}
+	build, err := findInjectorBuild(pkg.TypesInfo, fn)
+	if err != nil {
+		return path, fn, nil
+	}
+	return path, fn, build
+}
+
+// providesType reports whether fn is a provider, other than an injector,
+// of typ.
+func providesType(oc *objectCache, fn *types.Func, typ string) bool {
+	// A function provides its first result, so check it before the
+	// function is processed as a provider.
+	results := fn.Type().(*types.Signature).Results()
+	if results.Len() == 0 || types.TypeString(results.At(0).Type(), nil) != typ {
+		return false
+	}
+	v, errs := oc.get(fn)
+	if len(errs) > 0 || isInjector(oc, fn) {
+		return false
+	}
+	_, ok := v.(*Provider)
+	return ok
+}
+
+// importName returns the name under which file imports imported, and
+// true, or the name of imported and false if file does not import it.
+func importName(pkg *packages.Package, file *ast.File, imported *types.Package) (string, bool) {
+	for _, imp := range file.Imports {
+		pkgName := importedPkgName(pkg.TypesInfo, imp)
+		if pkgName != nil && pkgName.Name() != "_" && pkgName.Imported() == imported {
+			return pkgName.Name(), true
+		}
+	}
+	return imported.Name(), false
+}
+
+// nameInFile reports whether name is declared in the scope of pkg or is
+// the name of an import of file.
+func nameInFile(pkg *packages.Package, file *ast.File, name string) bool {
+	if pkg.Types.Scope().Lookup(name) != nil {
+		return true
+	}
+	for _, imp := range file.Imports {
+		pkgName := importedPkgName(pkg.TypesInfo, imp)
+		if pkgName != nil && pkgName.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importedPkgName returns the package name declared by imp, or nil if
+// the import failed.
+func importedPkgName(info *types.Info, imp *ast.ImportSpec) *types.PkgName {
+	var obj types.Object
+	if imp.Name != nil {
+		obj = info.Defs[imp.Name]
+	} else {
+		obj = info.Implicits[imp]
+	}
+	pkgName, _ := obj.(*types.PkgName)
+	return pkgName
+}
+
+// importEdit returns the edit adding the import of path to file: in the
+// last import declaration if it has parentheses, or as a new declaration
+// after it or after the package clause.
+func importEdit(file *ast.File, path string) Edit {
+	spec := strconv.Quote(path)
+	var last *ast.GenDecl
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			last = d
+		}
+	}
+	switch {
+	case last == nil:
+		return Edit{Pos: file.Name.End(), End: file.Name.End(), NewText: "\n\nimport " + spec}
+	case last.Lparen.IsValid():
+		return Edit{Pos: last.Rparen, End: last.Rparen, NewText: "\t" + spec + "\n"}
+	default:
+		return Edit{Pos: last.End(), End: last.End(), NewText: "\nimport " + spec}
+	}
+}
+
+// appendArgEdit returns the edit appending expr to the arguments of call.
+// It is inserted after the last argument, before any trailing comma, so
+// that calls split across lines stay valid.
+func appendArgEdit(call *ast.CallExpr, expr string) Edit {
+	if len(call.Args) == 0 {
+		return Edit{Pos: call.Rparen, End: call.Rparen, NewText: expr}
+	}
+	end := call.Args[len(call.Args)-1].End()
+	return Edit{Pos: end, End: end, NewText: ", " + expr}
+}
+
+// canImport reports whether the package importer may import path, which
+// is only restricted if path is an internal package.
+func canImport(importer, path string) bool {
+	var parent string
+	switch {
+	case path == "internal" || strings.HasPrefix(path, "internal/"):
+		return false
+	case strings.HasSuffix(path, "/internal"):
+		parent = strings.TrimSuffix(path, "/internal")
+	case strings.Contains(path, "/internal/"):
+		parent = path[:strings.LastIndex(path, "/internal/")]
+	default:
+		return true
+	}
+	return importer == parent || strings.HasPrefix(importer, parent+"/")
+}
@@ -0,0 +1,287 @@
+package wire
+
+import (
+	"context"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// FormatResult is the result of formatting a single file.
+type FormatResult struct {
+	// Path is the path of the file.
+	Path string
+	// Content is the formatted content of the file.
+	Content []byte
+	// Changed reports whether Content differs from the file on disk.
+	Changed bool
+}
+
+// Commit writes the formatted content to disk if it changed.
+func (r FormatResult) Commit() error {
+	if !r.Changed {
+		return nil
+	}
+	return ioutil.WriteFile(r.Path, r.Content, 0666)
+}
+
+// Format rewrites the argument lists of the calls to wire.NewSet and
+// wire.Build in the packages matching patterns to a canonical form: one
+// element per line with a trailing comma, and elements sorted into groups.
+//
+// The groups are, in order: calls to wire.Requires, provider sets by name,
+// nested calls to wire.NewSet and wire.Splice, function providers by name,
+// any other elements, and calls to wire.Bind, wire.Value or
+// wire.InterfaceValue, wire.Struct and wire.FieldsOf. Groups not sorted by name keep their
+// order. Comments before an element or after it on the same line move
+// with the element. Source outside the argument lists is left untouched.
+func Format(ctx context.Context, wd string, env []string, tags string, patterns []string) ([]FormatResult, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	var results []FormatResult
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			path := pkg.Fset.File(f.Pos()).Name()
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, []error{err}
+			}
+			content := formatFile(pkg.Fset, pkg.TypesInfo, f, src)
+			results = append(results, FormatResult{
+				Path:    path,
+				Content: content,
+				Changed: string(content) != string(src),
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results, nil
+}
+
+// formatFile returns src with the calls to wire.NewSet and wire.Build in f
+// formatted.
+func formatFile(fset *token.FileSet, info *types.Info, f *ast.File, src []byte) []byte {
+	ff := &fileFormatter{
+		fset: fset,
+		info: info,
+		file: fset.File(f.Pos()),
+		src:  src,
+	}
+	for _, cg := range f.Comments {
+		ff.comments = append(ff.comments, cg.List...)
+	}
+	// Collect the outermost calls, which format the calls nested in them.
+	var calls []*ast.CallExpr
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !ff.isSetCall(call) {
+			return true
+		}
+		calls = append(calls, call)
+		return false
+	})
+	var sb strings.Builder
+	last := 0
+	for _, call := range calls {
+		start, end := ff.offset(call.Pos()), ff.offset(call.End())
+		sb.Write(src[last:start])
+		sb.WriteString(ff.formatCall(call, ff.lineIndent(call.Pos())))
+		last = end
+	}
+	sb.Write(src[last:])
+	return []byte(sb.String())
+}
+
+type fileFormatter struct {
+	fset     *token.FileSet
+	info     *types.Info
+	file     *token.File
+	src      []byte
+	comments []*ast.Comment
+}
+
+// formatElem is an element of the argument list of a call being formatted.
+type formatElem struct {
+	expr  ast.Expr
+	group int
+	// name is the sort key of the element in groups sorted by name.
+	name string
+	// leading holds the comments on the lines before the element, inline
+	// the ones before it on the same line and trailing the ones after it on
+	// the same line.
+	leading  []*ast.Comment
+	inline   []*ast.Comment
+	trailing []*ast.Comment
+}
+
+// Groups of elements in the order they are formatted.
+const (
+	groupRequires = iota
+	groupSet
+	groupNestedSet
+	groupFunc
+	groupOther
+	groupBind
+	groupValue
+	groupStruct
+	groupFieldsOf
+)
+
+// isSetCall reports whether call is a call to wire.NewSet or wire.Build
+// that can be formatted.
+func (ff *fileFormatter) isSetCall(call *ast.CallExpr) bool {
+	return isWireCall(ff.info, call, "NewSet", "Build") && call.Ellipsis == token.NoPos && len(call.Args) > 0
+}
+
+// formatCall returns the formatted source of call, whose closing
+// parenthesis is indented by indent.
+func (ff *fileFormatter) formatCall(call *ast.CallExpr, indent string) string {
+	elems := make([]*formatElem, len(call.Args))
+	for i, arg := range call.Args {
+		elems[i] = ff.classify(arg)
+	}
+	var dangling []*ast.Comment
+	for _, c := range ff.comments {
+		if c.Pos() <= call.Lparen || c.End() > call.Rparen {
+			continue
+		}
+		// i is the index of the first argument after c.
+		i := sort.Search(len(call.Args), func(i int) bool {
+			return call.Args[i].End() > c.Pos()
+		})
+		switch {
+		case i < len(call.Args) && call.Args[i].Pos() <= c.Pos():
+			// Inside an argument, which is formatted as part of it.
+		case i > 0 && ff.line(c.Pos()) == ff.line(call.Args[i-1].End()) &&
+			(i == len(call.Args) || ff.line(c.End()) != ff.line(call.Args[i].Pos())):
+			elems[i-1].trailing = append(elems[i-1].trailing, c)
+		case i < len(call.Args) && ff.line(c.End()) == ff.line(call.Args[i].Pos()):
+			elems[i].inline = append(elems[i].inline, c)
+		case i < len(call.Args):
+			elems[i].leading = append(elems[i].leading, c)
+		default:
+			dangling = append(dangling, c)
+		}
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		if elems[i].group != elems[j].group {
+			return elems[i].group < elems[j].group
+		}
+		return elems[i].name < elems[j].name
+	})
+
+	elemIndent := indent + "\t"
+	var sb strings.Builder
+	sb.Write(ff.src[ff.offset(call.Pos()) : ff.offset(call.Lparen)+1])
+	sb.WriteString("\n")
+	for _, e := range elems {
+		for _, c := range e.leading {
+			sb.WriteString(elemIndent + ff.reindent(c, elemIndent) + "\n")
+		}
+		sb.WriteString(elemIndent)
+		for _, c := range e.inline {
+			sb.WriteString(ff.reindent(c, elemIndent) + " ")
+		}
+		if call, ok := e.expr.(*ast.CallExpr); ok && ff.isSetCall(call) {
+			sb.WriteString(ff.formatCall(call, elemIndent))
+		} else {
+			sb.WriteString(ff.reindent(e.expr, elemIndent))
+		}
+		sb.WriteString(",")
+		for _, c := range e.trailing {
+			sb.WriteString(" " + ff.reindent(c, elemIndent))
+		}
+		sb.WriteString("\n")
+	}
+	for _, c := range dangling {
+		sb.WriteString(elemIndent + ff.reindent(c, elemIndent) + "\n")
+	}
+	sb.WriteString(indent + ")")
+	return sb.String()
+}
+
+// classify returns the element for expr with its group and sort key.
+func (ff *fileFormatter) classify(expr ast.Expr) *formatElem {
+	e := &formatElem{expr: expr}
+	if call, ok := astutil.Unparen(expr).(*ast.CallExpr); ok {
+		switch {
+		case isWireCall(ff.info, call, "Requires"):
+			e.group = groupRequires
+		case isWireCall(ff.info, call, "NewSet", "Splice"):
+			e.group = groupNestedSet
+		case isWireCall(ff.info, call, "Bind"):
+			e.group = groupBind
+		case isWireCall(ff.info, call, "Value", "InterfaceValue"):
+			e.group = groupValue
+		case isWireCall(ff.info, call, "Struct"):
+			e.group = groupStruct
+		case isWireCall(ff.info, call, "FieldsOf"):
+			e.group = groupFieldsOf
+		default:
+			e.group = groupOther
+		}
+		return e
+	}
+	t := ff.info.TypeOf(expr)
+	switch {
+	case t != nil && isProviderSetType(t):
+		e.group = groupSet
+		e.name = ff.text(expr)
+	case t != nil && isSignature(t):
+		e.group = groupFunc
+		e.name = ff.text(expr)
+	default:
+		e.group = groupOther
+	}
+	return e
+}
+
+func isSignature(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Signature)
+	return ok
+}
+
+func (ff *fileFormatter) offset(pos token.Pos) int {
+	return ff.file.Offset(pos)
+}
+
+func (ff *fileFormatter) line(pos token.Pos) int {
+	return ff.file.Line(pos)
+}
+
+// text returns the source of n.
+func (ff *fileFormatter) text(n ast.Node) string {
+	return string(ff.src[ff.offset(n.Pos()):ff.offset(n.End())])
+}
+
+// lineIndent returns the leading whitespace of the line containing pos.
+func (ff *fileFormatter) lineIndent(pos token.Pos) string {
+	start := ff.offset(ff.file.LineStart(ff.line(pos)))
+	end := start
+	for end < len(ff.src) && (ff.src[end] == ' ' || ff.src[end] == '\t') {
+		end++
+	}
+	return string(ff.src[start:end])
+}
+
+// reindent returns the source of n with the indentation of its lines
+// after the first changed from that of the line n starts on to indent.
+func (ff *fileFormatter) reindent(n ast.Node, indent string) string {
+	old := ff.lineIndent(n.Pos())
+	lines := strings.Split(ff.text(n), "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], old) {
+			lines[i] = indent + lines[i][len(old):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,215 @@
+package wire
+
+import (
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// An OutputGroup is a group of the outputs of a provider set created from
+// the same inputs, as returned by Gather.
+type OutputGroup struct {
+	// Name is the inputs, sorted and separated by commas, or "no inputs".
+	Name    string
+	Inputs  *typeutil.Map // values are not important
+	Outputs *typeutil.Map // values are *Provider, *Value, or *Field
+}
+
+// Gather flattens a provider set identified by key into outputs grouped by
+// the inputs required to create them. As it flattens the provider set, it
+// records the visited provider sets other than key as imports. The VarName
+// of key is the AnonID of set if it is anonymous.
+func Gather(info *Info, set *ProviderSet, key ProviderSetID) (_ []OutputGroup, imports map[string]struct{}) {
+	hash := typeutil.MakeHasher()
+
+	// Find imports.
+	next := []*ProviderSet{set}
+	visited := make(map[*ProviderSet]struct{})
+	imports = make(map[string]struct{})
+	for len(next) > 0 {
+		curr := next[len(next)-1]
+		next = next[:len(next)-1]
+		if _, found := visited[curr]; found {
+			continue
+		}
+		visited[curr] = struct{}{}
+		if curr.Name() != "" && !(curr.PkgPath == key.ImportPath && curr.Name() == key.VarName) {
+			name := curr.AnonID
+			if curr.VarName != "" {
+				name = ProviderSetID{ImportPath: curr.PkgPath, VarName: curr.VarName}.String()
+			}
+			imports[name] = struct{}{}
+		}
+		next = append(next, curr.Imports...)
+	}
+
+	// Depth-first search to build groups.
+	var groups []OutputGroup
+	inputVisited := new(typeutil.Map) // values are int, indices into groups or -1 for input.
+	inputVisited.SetHasher(hash)
+	var stk []types.Type
+	for _, k := range set.Outputs() {
+		// Start a DFS by picking a random unvisited node.
+		if inputVisited.At(k) == nil {
+			stk = append(stk, k)
+		}
+
+		// Run DFS
+	dfs:
+		for len(stk) > 0 {
+			curr := stk[len(stk)-1]
+			stk = stk[:len(stk)-1]
+			if inputVisited.At(curr) != nil {
+				continue
+			}
+			switch pv := set.For(curr); {
+			case pv.IsNil():
+				// This is an input.
+				inputVisited.Set(curr, -1)
+			case pv.IsArg():
+				// This is an injector argument.
+				inputVisited.Set(curr, -1)
+			case pv.IsProvider():
+				// Try to see if any args haven't been visited.
+				p := pv.Provider()
+				allPresent := true
+				for _, arg := range p.Args {
+					if inputVisited.At(arg.Type) == nil {
+						allPresent = false
+					}
+				}
+				if !allPresent {
+					stk = append(stk, curr)
+					for _, arg := range p.Args {
+						if inputVisited.At(arg.Type) == nil {
+							stk = append(stk, arg.Type)
+						}
+					}
+					continue dfs
+				}
+
+				// Build up set of input types, match to a group.
+				in := new(typeutil.Map)
+				in.SetHasher(hash)
+				for _, arg := range p.Args {
+					i := inputVisited.At(arg.Type).(int)
+					if i == -1 {
+						in.Set(arg.Type, true)
+					} else {
+						mergeTypeSets(in, groups[i].Inputs)
+					}
+				}
+				for i := range groups {
+					if sameTypeKeys(groups[i].Inputs, in) {
+						groups[i].Outputs.Set(curr, p)
+						inputVisited.Set(curr, i)
+						continue dfs
+					}
+				}
+				out := new(typeutil.Map)
+				out.SetHasher(hash)
+				out.Set(curr, p)
+				inputVisited.Set(curr, len(groups))
+				groups = append(groups, OutputGroup{
+					Inputs:  in,
+					Outputs: out,
+				})
+			case pv.IsValue():
+				v := pv.Value()
+				for i := range groups {
+					if groups[i].Inputs.Len() == 0 {
+						groups[i].Outputs.Set(curr, v)
+						inputVisited.Set(curr, i)
+						continue dfs
+					}
+				}
+				in := new(typeutil.Map)
+				in.SetHasher(hash)
+				out := new(typeutil.Map)
+				out.SetHasher(hash)
+				out.Set(curr, v)
+				inputVisited.Set(curr, len(groups))
+				groups = append(groups, OutputGroup{
+					Inputs:  in,
+					Outputs: out,
+				})
+			case pv.IsField():
+				// Try to see if the parent struct hasn't been visited.
+				f := pv.Field()
+				if inputVisited.At(f.Parent) == nil {
+					stk = append(stk, curr, f.Parent)
+					continue
+				}
+				// Build the input map for the parent struct.
+				in := new(typeutil.Map)
+				in.SetHasher(hash)
+				i := inputVisited.At(f.Parent).(int)
+				if i == -1 {
+					in.Set(f.Parent, true)
+				} else {
+					mergeTypeSets(in, groups[i].Inputs)
+				}
+				// Group all fields together under the same parent struct.
+				for i := range groups {
+					if sameTypeKeys(groups[i].Inputs, in) {
+						groups[i].Outputs.Set(curr, f)
+						inputVisited.Set(curr, i)
+						continue dfs
+					}
+				}
+				out := new(typeutil.Map)
+				out.SetHasher(hash)
+				out.Set(curr, f)
+				inputVisited.Set(curr, len(groups))
+				groups = append(groups, OutputGroup{
+					Inputs:  in,
+					Outputs: out,
+				})
+			default:
+				panic("unreachable")
+			}
+		}
+	}
+
+	// Name and sort groups.
+	for i := range groups {
+		if groups[i].Inputs.Len() == 0 {
+			groups[i].Name = "no inputs"
+			continue
+		}
+		instr := make([]string, 0, groups[i].Inputs.Len())
+		groups[i].Inputs.Iterate(func(k types.Type, _ interface{}) {
+			instr = append(instr, types.TypeString(k, nil))
+		})
+		sort.Strings(instr)
+		groups[i].Name = strings.Join(instr, ", ")
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Inputs.Len() == groups[j].Inputs.Len() {
+			return groups[i].Name < groups[j].Name
+		}
+		return groups[i].Inputs.Len() < groups[j].Inputs.Len()
+	})
+	return groups, imports
+}
+
+func mergeTypeSets(dst, src *typeutil.Map) {
+	src.Iterate(func(k types.Type, _ interface{}) {
+		dst.Set(k, true)
+	})
+}
+
+func sameTypeKeys(a, b *typeutil.Map) bool {
+	if a.Len() != b.Len() {
+		return false
+	}
+	same := true
+	a.Iterate(func(k types.Type, _ interface{}) {
+		if b.At(k) == nil {
+			same = false
+		}
+	})
+	return same
+}
@@ -9,64 +9,834 @@ import (
 	"go/format"
 	"go/token"
 	"go/types"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/awalterschulze/gographviz"
+	"golang.org/x/tools/go/packages"
 )
 
 // Graph returns a string representation of the given wire.NewSet or wire.Build.
-// pattern is a singleton slice containing the pattern of the target package.
-// name is the name of the function calling wire.Build.
-// format is either "graphviz" or "cytospace".
-// Returns graphviz or cytospace data in string.
-func Graph(ctx context.Context, wd string, env []string, pattern []string, name string, tags string, format string) (string, []error) {
-	pkgs, errs := LoadPackages(ctx, wd, env, tags, pattern)
+// pattern contains the patterns of the packages to search for name, which
+// is the name of the function calling wire.Build or of the variable
+// wire.NewSet is assigned to. It is an error if name is declared in none of
+// the packages or in more than one of them, see ResolveNamed.
+// format is "graphviz", "cytospace", "json" or "d2".
+// If critical is true, the chain of providers with the largest total
+// //wire:cost weight is highlighted.
+// If timings is not nil, the providers found in it are annotated with their
+// measured duration and a heat color, the critical path is weighted by the
+// measured durations instead of the costs, and a report of the timings is
+// returned.
+// Inputs of a wire.NewSet declared by wire.Requires are drawn filled, and
+// conditional providers, which return (T, bool), are badged and dashed.
+// Cytospace nodes of providers carry a wireplus.openLocation command
+// revealing their declaration. Providers carry a tooltip giving their import
+// path if declared outside the package of name, their position and the first
+// sentence of their doc comment, and Graphviz nodes link to their file.
+// If filter is not nil, only the nodes passing it are drawn, see
+// GraphFilter. The critical path and the timings report still cover the
+// whole graph.
+// Providers are drawn in clusters by the provider sets they come from,
+// nested as the sets include each other, or by the packages declaring them
+// if cluster is ClusterByPackage, see GraphCluster.
+// Edges are labeled with the parameters or fields consuming them as set by
+// edgeLabels, see GraphEdgeLabels.
+// If an injector lacks providers, it is drawn anyway, with the types
+// without a provider as red dashed inputs named "missing", and the graph is
+// returned along with the errors. Likewise, a provider set or injector
+// whose providers depend on each other in cycles is drawn with the cycles
+// highlighted, along with an error per cycle, see cycleErrors. Otherwise
+// the graph is empty if there are errors.
+// Returns graphviz, cytospace, json or D2 data in string.
+func Graph(ctx context.Context, wd string, env []string, pattern []string, name string, tags string, format string, critical bool, timings Timings, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels) (string, *TimingsReport, []error) {
+	return GraphWithOverlay(ctx, wd, env, pattern, name, tags, format, critical, timings, filter, cluster, edgeLabels, nil)
+}
+
+// GraphWithOverlay is like Graph, but loads the packages with the overlay
+// files as LoadPackagesWithOverlay does.
+func GraphWithOverlay(ctx context.Context, wd string, env []string, pattern []string, name string, tags string, format string, critical bool, timings Timings, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels, files map[string][]byte) (string, *TimingsReport, []error) {
+	pkgs, errs := LoadPackagesWithOverlay(ctx, wd, env, tags, pattern, files)
 	if len(errs) > 0 {
-		return "", errs
+		return "", nil, errs
 	}
-	if len(pkgs) != 1 {
-		return "", []error{fmt.Errorf("expected exactly one package")}
+	return GraphPackages(pkgs, pattern, name, format, critical, timings, filter, cluster, edgeLabels)
+}
+
+// GraphPackages is like Graph, but draws the provider set or injector name
+// in pkgs, the packages matching pattern loaded by LoadPackages, e.g. to
+// reuse the packages kept by a long-running process.
+func GraphPackages(pkgs []*packages.Package, pattern []string, name string, format string, critical bool, timings Timings, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels) (string, *TimingsReport, []error) {
+	decl, err := ResolveNamed(pkgs, pattern, name)
+	if err != nil {
+		return "", nil, []error{err}
+	}
+	builder, err := newGraphBuilder(format)
+	if err != nil {
+		return "", nil, []error{err}
 	}
-	pkg := pkgs[0]
+	report, drawn, errs := drawNamed(builder, decl, critical, timings, filter, cluster, edgeLabels)
+	if !drawn {
+		return "", nil, errs
+	}
+	return builder.String(), report, errs
+}
 
-	// Create a graph builder according to the requested format.
-	var builder GraphBuilder
-	if format == "graphviz" {
-		builder = newGraphvizBuilder()
-	} else if format == "cytospace" {
-		builder = newCytospaceBuilder()
-	} else {
-		return "", []error{fmt.Errorf("unknown format: %s", format)}
+// newGraphBuilder creates a graph builder according to the requested
+// format.
+func newGraphBuilder(format string) (GraphBuilder, error) {
+	switch format {
+	case "graphviz":
+		return newGraphvizBuilder(), nil
+	case "cytospace":
+		return newCytospaceBuilder(), nil
+	case "d2":
+		return newD2Builder(), nil
+	case "json":
+		return newJSONBuilder(), nil
+	}
+	return nil, fmt.Errorf("unknown format: %s", format)
+}
+
+// drawNamed draws the provider set or injector decl with builder for
+// GraphPackages, reporting whether it is drawn. It may be drawn despite
+// errors, which are returned along with the timings report.
+func drawNamed(builder GraphBuilder, decl *NamedDecl, critical bool, timings Timings, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels) (*TimingsReport, bool, []error) {
+	pkg, name := decl.Pkg, decl.Name
+	if b, ok := builder.(*JSONBuilder); ok {
+		b.setDecl(decl)
 	}
+	builder.setCluster(cluster)
+	builder.setEdgeLabels(edgeLabels)
 
 	// Build the graph data for the given wire.NewSet or wire.Build.
-	if sol, errs := solveForNewSet(pkg, name); len(errs) == 0 {
+	var sol *newSetSolution
+	var errs []error
+	if decl.Injector {
+		// name corresponds to the function that calls wire.Build internally.
+		var bsol *buildSolution
+		bsol, errs = solveForBuild(pkg, name)
+		if !hasCategory(errs, CategoryCycle) {
+			return graphBuild(builder, pkg, name, bsol, errs, critical, timings, filter)
+		}
+	} else {
 		// name corresponds to the variable wire.NewSet is assigned to.
-		builder.addInputsForNewSet(sol.missing)
-		builder.addOutputs(sol.calls, sol.pset, pkg.Fset)
-		builder.addDepsForNewSet(sol.calls, sol.missing, pkg.Fset)
-		return builder.String(), nil
+		sol, errs = solveForNewSet(pkg, name)
 	}
-	if sol, errs := solveForBuild(pkg, name); len(errs) == 0 {
-		// name corresponds to the function that calls wire.Build internally.
-		builder.addInputsForBuild(sol.ins)
-		builder.addOutputs(sol.calls, sol.pset, pkg.Fset)
-		builder.addDepsForBuild(sol.calls, sol.ins, pkg.Fset)
-		return builder.String(), nil
+	if len(errs) > 0 {
+		// Draw the providers along with their cycles, the set of an
+		// injector being drawn as a provider set.
+		cyclic, cyclicErrs := solveCyclic(pkg, name, decl.Injector)
+		if !hasCategory(errs, CategoryCycle) || len(cyclicErrs) > 0 {
+			return nil, false, errs
+		}
+		cycles := findCycles(cyclic.calls)
+		if len(cycles) == 0 {
+			return nil, false, errs
+		}
+		sol = cyclic
+		builder.setCycles(cycleMarks(cycles, sol.calls, pkg.Fset))
+		errs = cycleErrors(cycles, sol.calls, sol.pset, pkg.Fset)
+	}
+	calls, missing := sol.calls, sol.missing
+	var callIndex map[int]int
+	if filter.active() {
+		inputTypes := make([]types.Type, len(missing))
+		inputKeys := make([]string, len(missing))
+		for i, m := range missing {
+			inputTypes[i] = *m
+			inputKeys[i] = (*m).String()
+		}
+		view := filterGraph(filter, calls, inputTypes, inputKeys, false, sol.pset, pkg.Fset)
+		if errs := reverseEmpty(filter, view, name); errs != nil {
+			return nil, false, errs
+		}
+		calls, callIndex = view.calls, view.callIndex
+		missing = nil
+		for _, i := range view.inputs {
+			missing = append(missing, sol.missing[i])
+		}
+		builder.setElided(view.elided)
+		builder.addCollapsed(view.collapsed)
+	}
+	report := overlay(builder, sol.calls, sol.pset, func(arg int) int {
+		if arg >= len(sol.calls) {
+			return -1
+		}
+		return arg
+	}, critical, timings, callIndex)
+	builder.addInputsForNewSet(missing, sol.pset)
+	builder.addOutputs(calls, sol.pset, pkg.Fset)
+	builder.addDepsForNewSet(calls, missing, pkg.Fset)
+	// The errors of a set drawn despite its cycles list them.
+	return report, true, errs
+}
+
+// graphBuild draws the injector name in pkg with builder for drawNamed,
+// given the solution and errors of solveForBuild.
+func graphBuild(builder GraphBuilder, pkg *packages.Package, name string, sol *buildSolution, errs []error, critical bool, timings Timings, filter *GraphFilter) (*TimingsReport, bool, []error) {
+	if len(errs) > 0 {
+		// Draw what the injector would be with the missing providers.
+		partial, partialErrs := solveForBuildPartial(pkg, name)
+		if !hasCategory(errs, CategoryNoProvider) || len(partialErrs) > 0 {
+			return nil, false, errs
+		}
+		sol = partial
+		missing := make(map[string]bool)
+		for _, in := range sol.ins[len(sol.ins)-len(sol.missing):] {
+			missing[inputKey(in)] = true
+		}
+		builder.setMissing(missing)
+	}
+	calls, ins := sol.calls, sol.ins
+	var callIndex map[int]int
+	if filter.active() {
+		inputTypes := make([]types.Type, len(ins))
+		inputKeys := make([]string, len(ins))
+		for i, in := range ins {
+			inputTypes[i] = in.Type()
+			inputKeys[i] = inputKey(in)
+		}
+		view := filterGraph(filter, calls, inputTypes, inputKeys, true, sol.pset, pkg.Fset)
+		if errs := reverseEmpty(filter, view, name); errs != nil {
+			return nil, false, errs
+		}
+		calls, callIndex = view.calls, view.callIndex
+		ins = nil
+		for _, i := range view.inputs {
+			ins = append(ins, sol.ins[i])
+		}
+		builder.setElided(view.elided)
+		builder.addCollapsed(view.collapsed)
+	}
+	report := overlay(builder, sol.calls, sol.pset, func(arg int) int {
+		return arg - len(sol.ins)
+	}, critical, timings, callIndex)
+	builder.addInputsForBuild(ins)
+	builder.addOutputs(calls, sol.pset, pkg.Fset)
+	builder.addDepsForBuild(calls, ins, pkg.Fset)
+	// The errors of an injector drawn despite missing providers are
+	// returned along with it.
+	return report, true, errs
+}
+
+// hasCategory reports whether errs are all *WireErr of the given category.
+func hasCategory(errs []error, category string) bool {
+	for _, err := range errs {
+		if w, ok := err.(*WireErr); !ok || w.Category() != category {
+			return false
+		}
 	}
-	return "", errs
+	return len(errs) > 0
+}
+
+// PackageDir returns the directory of the package matching pattern, loaded
+// with the wireinject build tag as by Graph. If pattern matches more than
+// one package, the one declaring the provider set or injector name is used.
+func PackageDir(ctx context.Context, wd string, env []string, tags string, pattern string, name string) (string, error) {
+	cfg := &packages.Config{
+		Context:    ctx,
+		Mode:       packages.NeedName | packages.NeedFiles,
+		Dir:        wd,
+		Env:        env,
+		BuildFlags: []string{"-tags=wireinject"},
+	}
+	if len(tags) > 0 {
+		cfg.BuildFlags[0] += " " + tags
+	}
+	pkgs, err := packages.Load(cfg, "pattern="+pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(pkgs) > 1 {
+		// Finding name needs the syntax and types of the packages.
+		var errs []error
+		if pkgs, errs = LoadPackages(ctx, wd, env, tags, []string{pattern}); len(errs) > 0 {
+			return "", errs[0]
+		}
+		decl, err := ResolveNamed(pkgs, []string{pattern}, name)
+		if err != nil {
+			return "", err
+		}
+		pkgs = []*packages.Package{decl.Pkg}
+	}
+	if len(pkgs) != 1 {
+		return "", fmt.Errorf("expected exactly one package")
+	}
+	if errs := pkgs[0].Errors; len(errs) > 0 {
+		return "", errs[0]
+	}
+	return detectOutputDir(pkgs[0].GoFiles)
+}
+
+// overlay sets the critical path and the timings of calls on builder, as
+// described in Graph, and returns the report of the timings, if any.
+// index is as for criticalPath. If callIndex is not nil, only some calls
+// are drawn, and callIndex maps their indices in calls to those in the
+// builder, see graphView.
+func overlay(builder GraphBuilder, calls []call, set *ProviderSet, index func(arg int) int, critical bool, timings Timings, callIndex map[int]int) *TimingsReport {
+	if timings == nil {
+		if critical {
+			builder.setCriticalPath(remapPath(criticalPath(calls, index), callIndex))
+		}
+		return nil
+	}
+	durations, report := matchTimings(timings, calls, set, index)
+	builder.setTimings(remapCalls(durations, callIndex))
+	if critical {
+		builder.setCriticalPath(remapPath(heaviestPath(calls, index, func(i int) int64 {
+			return int64(durations[i])
+		}), callIndex))
+	}
+	return report
 }
 
 type GraphBuilder interface {
-	addInputsForNewSet(missing []*types.Type)
+	setCriticalPath(path map[int]int)
+	setTimings(durations map[int]time.Duration)
+	// setElided sets the edges standing for chains of elided nodes, by the
+	// keys of their ends, which are drawn dashed.
+	setElided(edges map[[2]string]bool)
+	// setMissing sets the keys of the inputs standing for types without a
+	// provider, which are drawn red and dashed.
+	setMissing(keys map[string]bool)
+	// setCycles sets the keys of the nodes on cycles, and the labels of the
+	// edges on cycles by the keys of their ends, see cycleMarks. They are
+	// drawn magenta.
+	setCycles(nodes map[string]bool, edges map[[2]string]string)
+	// setCluster sets how the providers are grouped into clusters, see
+	// clusterKeys.
+	setCluster(cluster GraphCluster)
+	// setEdgeLabels sets how the edges of providers are labeled, see
+	// edgeLabel.
+	setEdgeLabels(labels GraphEdgeLabels)
+	addInputsForNewSet(missing []*types.Type, pset *ProviderSet)
 	addInputsForBuild(ins []*types.Var)
 	addOutputs(calls []call, pset *ProviderSet, fset *token.FileSet)
 	addDepsForNewSet(calls []call, missing []*types.Type, fset *token.FileSet)
 	addDepsForBuild(calls []call, ins []*types.Var, fset *token.FileSet)
+	// addCollapsed is called before addOutputs, which draws the calls
+	// consumed by collapsed nodes as used.
+	addCollapsed(collapsed []*collapsedNode)
 
 	String() string
 }
 
+// GraphFilter limits the nodes Graph draws, to make the graphs of large
+// injectors readable. The filters compose: a node is drawn if it passes
+// all of them. The root outputs, the calls whose output no other call
+// consumes, are always drawn. Each connected group of nodes hidden by
+// Depth or Focus is collapsed into a single node labeled with the number
+// of hidden providers, to and from which the edges of the hidden nodes are
+// drawn instead. If the filters hide every node but the roots, only the
+// roots are drawn.
+//
+// The nodes hidden by Include and Exclude are elided instead: each chain
+// of elided nodes between two other nodes is drawn as a dashed edge, and
+// the elided nodes consumed by no other node disappear. Depth and Focus
+// apply to the graph left once the nodes are elided.
+//
+// The providers of the sets named by Collapse are drawn as a single summary
+// node per set, giving the numbers of its providers, of the nodes it
+// consumes and of its providers consumed by the rest of the graph, unless
+// they are root outputs.
+type GraphFilter struct {
+	// Depth, if positive, hides the nodes more than Depth edges away from
+	// the root outputs.
+	Depth int
+	// Focus, if not empty, hides the nodes other than the providers whose
+	// import path has the prefix Focus, the nodes whose type, as formatted
+	// by types.TypeString, is Focus, and their direct neighbors.
+	Focus string
+	// Include, if not nil, elides the nodes it does not match. A node
+	// matches if the regular expression matches its type, as formatted by
+	// types.TypeString, or the import path and name of its provider, e.g.
+	// "example.com/app.NewDB".
+	Include *regexp.Regexp
+	// Exclude, if not nil, elides the nodes it matches, as for Include,
+	// e.g. "^context\\." for the providers and values of package context.
+	Exclude *regexp.Regexp
+	// Collapse are the provider sets drawn as summary nodes, by name, e.g.
+	// "InfraSet", or by import path and name, e.g.
+	// "example.com/app.InfraSet". A provider of nested sets is summarized
+	// by the outermost set named.
+	Collapse []string
+	// Reverse, if not empty, leaves out the nodes other than those whose
+	// type, as formatted by types.TypeString, is Reverse, and the providers
+	// depending on them, directly or transitively. Unlike the nodes hidden
+	// by the other fields, they are not summarized, and neither are the
+	// root outputs drawn if they do not depend on it.
+	Reverse string
+}
+
+// active reports whether filter hides any node.
+func (filter *GraphFilter) active() bool {
+	return filter != nil && (filter.Depth > 0 || filter.Focus != "" || filter.Include != nil || filter.Exclude != nil || len(filter.Collapse) > 0 || filter.Reverse != "")
+}
+
+// noDependentsError reports that nothing in the graph of name depends on
+// the type of GraphFilter.Reverse.
+type noDependentsError struct {
+	name string
+	typ  string
+}
+
+func (e *noDependentsError) Error() string {
+	return fmt.Sprintf("%s does not depend on %s", e.name, e.typ)
+}
+
+// reverseEmpty returns the error of drawNamed for the graph of name if
+// filter.Reverse leaves nothing of view, or nil.
+func reverseEmpty(filter *GraphFilter, view *graphView, name string) []error {
+	if filter.Reverse == "" || len(view.calls) > 0 || len(view.inputs) > 0 {
+		return nil
+	}
+	return []error{&noDependentsError{name: name, typ: filter.Reverse}}
+}
+
+// collapses reports whether filter collapses the provider set whose key,
+// as returned by parentKeys, is key.
+func (filter *GraphFilter) collapses(key string) bool {
+	i := strings.Index(key, "#")
+	if i < 0 {
+		return false
+	}
+	name, pkgPath := key[:i], key[i+1:]
+	for _, c := range filter.Collapse {
+		if c == name || c == pkgPath+"."+name {
+			return true
+		}
+	}
+	return false
+}
+
+// collapsedNode is a node standing for a connected group of nodes hidden
+// by a GraphFilter, or for the providers of a collapsed provider set.
+type collapsedNode struct {
+	key       string
+	set       string   // key of the collapsed provider set, if any
+	providers int      // number of hidden calls
+	inputs    int      // number of hidden inputs
+	outputs   int      // number of hidden calls consumed by other nodes
+	consumers []string // keys of the drawn calls consuming hidden nodes
+	deps      []string // keys of the drawn nodes consumed by hidden calls
+}
+
+// label returns the label of the node.
+func (c *collapsedNode) label() string {
+	if c.set != "" {
+		return formatKey(c.set) + "\n" + plural(c.providers, "provider") + ", " + plural(len(c.deps), "input") + ", " + plural(c.outputs, "output")
+	}
+	label := plural(c.providers, "hidden provider")
+	if c.inputs > 0 {
+		label += ", " + plural(c.inputs, "input")
+	}
+	return label
+}
+
+// graphView is the part of a graph drawn by Graph.
+type graphView struct {
+	// calls are the drawn calls, whose args are numbered as those of the
+	// original calls, but counting only the drawn nodes.
+	calls []call
+	// inputs are the indices of the drawn inputs.
+	inputs []int
+	// callIndex maps the index of each drawn call in the original calls to
+	// its index in calls.
+	callIndex map[int]int
+	collapsed []*collapsedNode
+	// elided holds the keys of the drawn edges standing for chains of
+	// nodes elided by the filter, from the consumer to the dependency.
+	elided map[[2]string]bool
+}
+
+// filterGraph applies filter to the graph of calls and of inputs whose
+// types are inputTypes and whose keys are inputKeys. The nodes are numbered
+// as the args of calls: the inputs come before the calls if inputsFirst, as
+// for wire.Build, and after them otherwise, as for wire.NewSet. The calls
+// come from pset.
+func filterGraph(filter *GraphFilter, calls []call, inputTypes []types.Type, inputKeys []string, inputsFirst bool, pset *ProviderSet, fset *token.FileSet) *graphView {
+	nIns, n := len(inputTypes), len(inputTypes)+len(calls)
+	callOffset, inputOffset := nIns, 0
+	if !inputsFirst {
+		callOffset, inputOffset = 0, len(calls)
+	}
+	// callAt returns the index of the call of node v, or -1 if v is an input.
+	callAt := func(v int) int {
+		if v < callOffset || v >= callOffset+len(calls) {
+			return -1
+		}
+		return v - callOffset
+	}
+	key := func(v int) string {
+		if i := callAt(v); i >= 0 {
+			return callKey(&calls[i], fset)
+		}
+		return inputKeys[v-inputOffset]
+	}
+	typeString := func(v int) string {
+		if i := callAt(v); i >= 0 {
+			return types.TypeString(calls[i].out, nil)
+		}
+		return types.TypeString(inputTypes[v-inputOffset], nil)
+	}
+	matches := func(v int) bool {
+		if i := callAt(v); i >= 0 {
+			c := &calls[i]
+			if c.pkg != nil && strings.HasPrefix(c.pkg.Path(), filter.Focus) {
+				return true
+			}
+		}
+		return typeString(v) == filter.Focus
+	}
+	// matchesRE reports whether re matches the type of node v or the
+	// qualified name of its provider.
+	matchesRE := func(re *regexp.Regexp, v int) bool {
+		if i := callAt(v); i >= 0 {
+			c := &calls[i]
+			return (c.pkg != nil && re.MatchString(c.pkg.Path()+"."+c.name)) || re.MatchString(types.TypeString(c.out, nil))
+		}
+		return re.MatchString(types.TypeString(inputTypes[v-inputOffset], nil))
+	}
+
+	var roots []int
+	used := make([]bool, n)
+	for i := range calls {
+		for _, arg := range calls[i].args {
+			used[arg] = true
+		}
+	}
+	for i := range calls {
+		if !used[callOffset+i] {
+			roots = append(roots, callOffset+i)
+		}
+	}
+
+	// Elide the nodes failing Include or Exclude, linking each drawn node
+	// to the nearest drawn nodes its elided dependencies lead to.
+	kept := make([]bool, n)
+	for v := range kept {
+		kept[v] = (filter.Include == nil || matchesRE(filter.Include, v)) && (filter.Exclude == nil || !matchesRE(filter.Exclude, v))
+	}
+	for _, v := range roots {
+		kept[v] = true
+	}
+	adj := make([][]int, n)
+	elided := make(map[[2]int]bool)
+	for i := range calls {
+		v := callOffset + i
+		if !kept[v] {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, w := range calls[i].args {
+			if kept[w] && !seen[w] {
+				seen[w] = true
+				adj[v] = append(adj[v], w)
+			}
+		}
+		var stack []int
+		for _, w := range calls[i].args {
+			if !kept[w] {
+				stack = append(stack, w)
+			}
+		}
+		for visited := make(map[int]bool); len(stack) > 0; {
+			u := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[u] {
+				continue
+			}
+			visited[u] = true
+			if kept[u] {
+				if !seen[u] {
+					seen[u] = true
+					adj[v] = append(adj[v], u)
+					elided[[2]int{v, u}] = true
+				}
+				continue
+			}
+			if j := callAt(u); j >= 0 {
+				stack = append(stack, calls[j].args...)
+			}
+		}
+	}
+	consumers := make([][]int, n)
+	for v := range adj {
+		for _, w := range adj[v] {
+			consumers[w] = append(consumers[w], v)
+		}
+	}
+	args := func(v int) []int {
+		return adj[v]
+	}
+
+	visible := make([]bool, n)
+	for v := range visible {
+		visible[v] = kept[v]
+	}
+	if filter.Depth > 0 {
+		dist := make([]int, n)
+		for v := range dist {
+			dist[v] = -1
+		}
+		queue := append([]int(nil), roots...)
+		for _, v := range roots {
+			dist[v] = 0
+		}
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			for _, w := range args(v) {
+				if dist[w] < 0 {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+			}
+		}
+		for v := range visible {
+			visible[v] = visible[v] && dist[v] >= 0 && dist[v] <= filter.Depth
+		}
+	}
+	if filter.Focus != "" {
+		focused := make([]bool, n)
+		for v := 0; v < n; v++ {
+			if !kept[v] || !matches(v) {
+				continue
+			}
+			focused[v] = true
+			for _, w := range args(v) {
+				focused[w] = true
+			}
+			for _, w := range consumers[v] {
+				focused[w] = true
+			}
+		}
+		for v := range visible {
+			visible[v] = visible[v] && focused[v]
+		}
+	}
+	// dropped marks the nodes left out by Reverse, which are neither drawn
+	// nor summarized.
+	dropped := make([]bool, n)
+	if filter.Reverse != "" {
+		dependent := make([]bool, n)
+		var stack []int
+		for v := 0; v < n; v++ {
+			if kept[v] && typeString(v) == filter.Reverse {
+				dependent[v] = true
+				stack = append(stack, v)
+			}
+		}
+		for len(stack) > 0 {
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, w := range consumers[v] {
+				if !dependent[w] {
+					dependent[w] = true
+					stack = append(stack, w)
+				}
+			}
+		}
+		for v := range visible {
+			visible[v] = visible[v] && dependent[v]
+			dropped[v] = !dependent[v]
+		}
+	}
+	onlyRoots := true
+	for v := range visible {
+		if visible[v] && len(consumers[v]) > 0 {
+			onlyRoots = false
+		}
+	}
+	for _, v := range roots {
+		visible[v] = !dropped[v]
+	}
+
+	// Group the providers of collapsed sets by set, and the other hidden
+	// nodes connected by edges between hidden nodes.
+	group := make([]int, n)
+	for v := range group {
+		group[v] = -1
+	}
+	var groups []*collapsedNode
+	if len(filter.Collapse) > 0 {
+		bySet := make(map[string]int)
+		for i := range calls {
+			// The root outputs stay drawn.
+			v := callOffset + i
+			if !kept[v] || !used[v] || dropped[v] {
+				continue
+			}
+			set := ""
+			for _, key := range parentKeys(pset.srcMap.At(calls[i].out).(*providerSetSrc), &calls[i].out) {
+				if filter.collapses(key) {
+					set = key
+					break
+				}
+			}
+			if set == "" {
+				continue
+			}
+			g, ok := bySet[set]
+			if !ok {
+				g = len(groups)
+				bySet[set] = g
+				groups = append(groups, &collapsedNode{key: "collapsed-" + set, set: set})
+			}
+			visible[v] = false
+			group[v] = g
+			groups[g].providers++
+		}
+	}
+	if !onlyRoots {
+		for v := 0; v < n; v++ {
+			if visible[v] || !kept[v] || group[v] >= 0 || dropped[v] {
+				continue
+			}
+			c := &collapsedNode{key: fmt.Sprintf("collapsed-%d", len(groups)+1)}
+			group[v] = len(groups)
+			groups = append(groups, c)
+			for stack := []int{v}; len(stack) > 0; {
+				u := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if callAt(u) >= 0 {
+					c.providers++
+				} else {
+					c.inputs++
+				}
+				for _, w := range append(append([]int(nil), args(u)...), consumers[u]...) {
+					if !visible[w] && group[w] < 0 && !dropped[w] {
+						group[w] = group[v]
+						stack = append(stack, w)
+					}
+				}
+			}
+		}
+	}
+
+	// Number the visible nodes as the args of the visible calls.
+	view := &graphView{callIndex: make(map[int]int), elided: make(map[[2]string]bool)}
+	index := make([]int, n)
+	for j := range inputTypes {
+		if visible[inputOffset+j] {
+			view.inputs = append(view.inputs, j)
+		}
+	}
+	nCalls := 0
+	for i := range calls {
+		if visible[callOffset+i] {
+			view.callIndex[i] = nCalls
+			nCalls++
+		}
+	}
+	newCallOffset, newInputOffset := len(view.inputs), 0
+	if !inputsFirst {
+		newCallOffset, newInputOffset = 0, nCalls
+	}
+	for k, j := range view.inputs {
+		index[inputOffset+j] = newInputOffset + k
+	}
+	for i, k := range view.callIndex {
+		index[callOffset+i] = newCallOffset + k
+	}
+	view.calls = make([]call, nCalls)
+	seen := make(map[[2]int]bool)
+	output := make([]bool, n)
+	for i := range calls {
+		v := callOffset + i
+		for _, w := range args(v) {
+			if group[w] >= 0 && group[v] != group[w] && !output[w] {
+				output[w] = true
+				groups[group[w]].outputs++
+			}
+			switch {
+			case visible[v] && visible[w]:
+				continue
+			case visible[v] && group[w] >= 0:
+				if e := [2]int{v, n + group[w]}; !seen[e] {
+					seen[e] = true
+					groups[group[w]].consumers = append(groups[group[w]].consumers, key(v))
+				}
+			case group[v] >= 0 && visible[w]:
+				if e := [2]int{n + group[v], w}; !seen[e] {
+					seen[e] = true
+					groups[group[v]].deps = append(groups[group[v]].deps, key(w))
+				}
+			case group[v] >= 0 && group[w] >= 0 && group[v] != group[w]:
+				// A collapsed set consumes another collapsed node.
+				if e := [2]int{n + group[v], n + group[w]}; !seen[e] {
+					seen[e] = true
+					groups[group[v]].deps = append(groups[group[v]].deps, groups[group[w]].key)
+				}
+			}
+		}
+		if !visible[v] {
+			continue
+		}
+		c := calls[i]
+		c.args, c.argIndices = nil, nil
+		for _, w := range args(v) {
+			if visible[w] {
+				c.args = append(c.args, index[w])
+				k := -1
+				if elided[[2]int{v, w}] {
+					view.elided[[2]string{key(v), key(w)}] = true
+				} else {
+					for k = range calls[i].args {
+						if calls[i].args[k] == w {
+							break
+						}
+					}
+				}
+				c.argIndices = append(c.argIndices, k)
+			}
+		}
+		view.calls[view.callIndex[i]] = c
+	}
+	view.collapsed = groups
+	return view
+}
+
+// remapCalls returns m with its keys, the indices of calls, mapped by
+// callIndex, leaving out the calls that are not drawn.
+func remapCalls(m map[int]time.Duration, callIndex map[int]int) map[int]time.Duration {
+	if m == nil || callIndex == nil {
+		return m
+	}
+	remapped := make(map[int]time.Duration)
+	for i, d := range m {
+		if k, ok := callIndex[i]; ok {
+			remapped[k] = d
+		}
+	}
+	return remapped
+}
+
+// remapPath returns path, as returned by criticalPath, with the indices of
+// calls mapped by callIndex, leaving out the calls that are not drawn.
+func remapPath(path map[int]int, callIndex map[int]int) map[int]int {
+	if path == nil || callIndex == nil {
+		return path
+	}
+	remapped := make(map[int]int)
+	for i, j := range path {
+		k, ok := callIndex[i]
+		if !ok {
+			continue
+		}
+		next, ok := callIndex[j]
+		if !ok {
+			next = -1
+		}
+		remapped[k] = next
+	}
+	return remapped
+}
+
 // inputKey returns a string representation of the node for the input variable given to wire.Build.
 func inputKey(input *types.Var) string {
 	// Each input is identified by its name and type.
@@ -93,6 +863,93 @@ func callKey(call *call, fset *token.FileSet) string {
 	panic("unknown kind")
 }
 
+// collapsedDeps returns the set of keys of the nodes consumed by collapsed.
+func collapsedDeps(collapsed []*collapsedNode) map[string]bool {
+	deps := make(map[string]bool)
+	for _, c := range collapsed {
+		for _, key := range c.deps {
+			deps[key] = true
+		}
+	}
+	return deps
+}
+
+// penWidths maps each cost category to the border width of its nodes.
+var penWidths = map[string]string{
+	CostLight:  "1",
+	CostMedium: "2",
+	CostHeavy:  "4",
+}
+
+// onPath reports whether the edge from call i to call j is on path.
+// j is negative if the edge points to an input.
+func onPath(path map[int]int, i, j int) bool {
+	next, ok := path[i]
+	return ok && j >= 0 && next == j
+}
+
+// externalPath returns the import path of the provider called by call if
+// it is declared outside the package at pkgPath, or "" otherwise.
+func externalPath(call *call, pkgPath string) string {
+	if call.kind == valueExpr || call.pkg == nil || call.pkg.Path() == pkgPath {
+		return ""
+	}
+	return call.pkg.Path()
+}
+
+// tooltip describes the provider called by call: its name qualified by its
+// import path if it is declared outside the package at pkgPath, the position
+// of its declaration and the first sentence of its doc comment, one per line.
+// It is "" for values.
+func tooltip(call *call, pkgPath string, fset *token.FileSet) string {
+	var lines []string
+	if path := externalPath(call, pkgPath); path != "" {
+		lines = append(lines, path+"."+call.name)
+	}
+	if call.kind != valueExpr && call.pos.IsValid() {
+		lines = append(lines, fset.Position(call.pos).String())
+	}
+	if call.doc != "" {
+		lines = append(lines, call.doc)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// declURL returns the file URL of the declaration of the provider called by
+// call, or "" if it is not known.
+func declURL(call *call, fset *token.FileSet) string {
+	if call.kind == valueExpr || !call.pos.IsValid() {
+		return ""
+	}
+	return fileURL(filepath.ToSlash(fset.Position(call.pos).Filename))
+}
+
+// fileURL returns the file URL of path, whose separators are slashes. As in
+// the URIs of the language server, a UNC path, e.g. "//host/share/x.go",
+// gives the host, and the other paths are rooted, so that neither a drive
+// letter, e.g. in "C:/app/x.go", nor the first element of a relative path
+// is read as the host.
+func fileURL(path string) string {
+	u := url.URL{Scheme: "file", Path: path}
+	switch {
+	case strings.HasPrefix(path, "//"):
+		host, rest := path[2:], "/"
+		if i := strings.Index(host, "/"); i >= 0 {
+			host, rest = host[:i], host[i:]
+		}
+		u.Host, u.Path = host, rest
+	case !strings.HasPrefix(path, "/"):
+		u.Path = "/" + path
+	}
+	return u.String()
+}
+
+// escapeString escapes the backslashes and double quotes of str for a DOT
+// quoted string.
+func escapeString(str string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(str)
+}
+
 func formatKey(key string) string {
 	return strings.Replace(key, "#", "\n", -1)
 }
@@ -101,6 +958,101 @@ func quoteString(str string) string {
 	return `"` + str + `"`
 }
 
+// GraphCluster is how the providers of a graph are grouped into clusters:
+// subgraphs in Graphviz, compound nodes in cytospace and containers in D2.
+type GraphCluster string
+
+const (
+	// ClusterBySet groups the providers by the provider sets they come
+	// from, nested as the sets include each other.
+	ClusterBySet GraphCluster = "set"
+	// ClusterByPackage groups the providers by the packages declaring them,
+	// and the values by the packages of the sets binding them, e.g. to spot
+	// the dependencies crossing layers.
+	ClusterByPackage GraphCluster = "package"
+)
+
+// GraphEdgeLabels is how the edges from providers to their dependencies
+// are labeled, e.g. to map them back to the signatures of the providers.
+type GraphEdgeLabels string
+
+const (
+	// EdgeLabelsNone leaves the edges unlabeled.
+	EdgeLabelsNone GraphEdgeLabels = ""
+	// EdgeLabelsParam labels the edges with the names of the parameters
+	// or fields consuming them, e.g. "param: conn" or "field: DB".
+	EdgeLabelsParam GraphEdgeLabels = "param"
+	// EdgeLabelsPosition labels the edges with the positions of the
+	// parameters or fields as well, from 1, e.g. "param 2: conn".
+	EdgeLabelsPosition GraphEdgeLabels = "position"
+)
+
+// edgeLabel returns the label of the edge from c to its j-th argument, as
+// set by labels: the parameter or field consuming it, if c is a provider
+// function or struct and the edge does not stand for elided nodes, with
+// its position for EdgeLabelsPosition. An unnamed parameter has a label
+// only with its position.
+func edgeLabel(labels GraphEdgeLabels, c *call, j int) string {
+	if labels == EdgeLabelsNone {
+		return ""
+	}
+	k := c.argIndex(j)
+	if k < 0 {
+		return ""
+	}
+	var kind, name string
+	switch c.kind {
+	case funcProviderCall:
+		kind, name = "param", c.paramNames[k]
+	case structProvider:
+		kind, name = "field", c.fieldNames[k]
+	default:
+		return ""
+	}
+	if name == "_" {
+		name = ""
+	}
+	if labels == EdgeLabelsPosition {
+		kind = fmt.Sprintf("%s %d", kind, k+1)
+		if name == "" {
+			return kind
+		}
+	} else if name == "" {
+		return ""
+	}
+	return kind + ": " + name
+}
+
+// joinLabels returns the non-empty labels, one per line.
+func joinLabels(labels ...string) string {
+	var lines []string
+	for _, l := range labels {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// clusterKeys returns the keys of the clusters of the call c of pset, from
+// the outermost to the innermost: those of parentKeys with ClusterBySet,
+// and the import path of the package of c with ClusterByPackage.
+func clusterKeys(cluster GraphCluster, pset *ProviderSet, c *call) []string {
+	keys := parentKeys(pset.srcMap.At(c.out).(*providerSetSrc), &c.out)
+	if cluster != ClusterByPackage {
+		return keys
+	}
+	if c.pkg != nil {
+		return []string{c.pkg.Path()}
+	}
+	// A value belongs to the package of the nearest set binding it.
+	if len(keys) > 0 {
+		key := keys[len(keys)-1]
+		return []string{key[strings.Index(key, "#")+1:]}
+	}
+	return []string{pset.PkgPath}
+}
+
 // parentKeys the parent provider sets as a slice of keys, from the furtherest to the nearest.
 // e.g.
 // setA := wire.NewSet(MyProvider)
@@ -113,10 +1065,7 @@ func parentKeys(p *providerSetSrc, t *types.Type) []string {
 	if p.Import != nil {
 		if parent := p.Import.srcMap.At(*t); parent != nil {
 			parentKeys := parentKeys(parent.(*providerSetSrc), t)
-			key := p.Import.VarName + "#" + p.Import.PkgPath
-			if p.Import.VarName == "" {
-				key = "<anonymous>" + "#" + p.Import.PkgPath
-			}
+			key := p.Import.Name() + "#" + p.Import.PkgPath
 			// Recursively find the parent provider sets.
 			return append([]string{key}, parentKeys...)
 		} else {
@@ -127,7 +1076,16 @@ func parentKeys(p *providerSetSrc, t *types.Type) []string {
 }
 
 type GraphvizBuilder struct {
-	gviz *gographviz.Escape
+	gviz          *gographviz.Escape
+	path          map[int]int           // critical path, see criticalPath
+	durations     map[int]time.Duration // measured durations of calls, by index
+	collapsedDeps map[string]bool       // keys of the nodes consumed by collapsed nodes
+	elided        map[[2]string]bool    // edges standing for elided nodes, see setElided
+	missing       map[string]bool       // keys of the inputs without a provider, see setMissing
+	cycleNodes    map[string]bool       // keys of the nodes on cycles, see setCycles
+	cycleEdges    map[[2]string]string  // labels of the edges on cycles, see setCycles
+	cluster       GraphCluster          // grouping of the providers, see setCluster
+	edgeLabels    GraphEdgeLabels       // labeling of the edges, see setEdgeLabels
 }
 
 func newGraphvizBuilder() GraphBuilder {
@@ -136,18 +1094,52 @@ func newGraphvizBuilder() GraphBuilder {
 	// Configure the root graph.
 	gviz.SetName("cluster-all")
 	gviz.SetDir(true)
-	return &GraphvizBuilder{gviz}
+	return &GraphvizBuilder{gviz: gviz}
+}
+
+func (builder *GraphvizBuilder) setCriticalPath(path map[int]int) {
+	builder.path = path
+}
+
+func (builder *GraphvizBuilder) setTimings(durations map[int]time.Duration) {
+	builder.durations = durations
+}
+
+func (builder *GraphvizBuilder) setElided(edges map[[2]string]bool) {
+	builder.elided = edges
+}
+
+func (builder *GraphvizBuilder) setMissing(keys map[string]bool) {
+	builder.missing = keys
 }
 
-func (builder *GraphvizBuilder) addInputsForNewSet(missing []*types.Type) {
+func (builder *GraphvizBuilder) setCycles(nodes map[string]bool, edges map[[2]string]string) {
+	builder.cycleNodes, builder.cycleEdges = nodes, edges
+}
+
+func (builder *GraphvizBuilder) setCluster(cluster GraphCluster) {
+	builder.cluster = cluster
+}
+
+func (builder *GraphvizBuilder) setEdgeLabels(labels GraphEdgeLabels) {
+	builder.edgeLabels = labels
+}
+
+func (builder *GraphvizBuilder) addInputsForNewSet(missing []*types.Type, pset *ProviderSet) {
 	for _, m := range missing {
 		key := (*m).String()
 		label := quoteString(formatKey(key))
 		// Each missing input in wire.NewSet has no dependency and thus becomes a terminating node.
-		builder.gviz.AddNode("cluster-all", key, map[string]string{
+		attrs := map[string]string{
 			"label": label,
 			"shape": "octagon",
-		})
+		}
+		// Inputs declared by wire.Requires are filled.
+		if pset.Declares(*m) {
+			attrs["style"] = "filled"
+			attrs["fillcolor"] = "lightyellow"
+		}
+		builder.gviz.AddNode("cluster-all", key, attrs)
 	}
 }
 
@@ -156,10 +1148,16 @@ func (builder *GraphvizBuilder) addInputsForBuild(ins []*types.Var) {
 		key := inputKey(in)
 		label := quoteString(formatKey(key))
 		// Each input for wire.Build has no dependency and thus becomes a terminating node.
-		builder.gviz.AddNode("cluster-all", key, map[string]string{
+		attrs := map[string]string{
 			"label": label,
 			"shape": "octagon",
-		})
+		}
+		if builder.missing[key] {
+			attrs["color"] = "red"
+			attrs["fontcolor"] = "red"
+			attrs["style"] = "dashed"
+		}
+		builder.gviz.AddNode("cluster-all", key, attrs)
 	}
 }
 
@@ -171,10 +1169,10 @@ func (builder *GraphvizBuilder) addOutputs(calls []call, pset *ProviderSet, fset
 			usedCalls[arg] = true
 		}
 	}
+	max := maxDuration(builder.durations)
 	for i, call := range calls {
 		// Sort out the subgraph relationships.
-		src := pset.srcMap.At(call.out)
-		parentKeys := parentKeys(src.(*providerSetSrc), &call.out)
+		parentKeys := clusterKeys(builder.cluster, pset, &call)
 		parentKeys = append([]string{"all"}, parentKeys...)
 		for j := range parentKeys {
 			if j == 0 {
@@ -196,11 +1194,19 @@ func (builder *GraphvizBuilder) addOutputs(calls []call, pset *ProviderSet, fset
 
 		// Find information about the current provider.
 		key := callKey(&call, fset)
-		label := quoteString(formatKey(key))
+		label := formatKey(key)
+		d, timed := builder.durations[i]
+		if timed {
+			label += "\n" + d.String()
+		}
+		// Conditional providers are badged, as their output may be absent.
+		if call.conditional {
+			label += "\n[conditional]"
+		}
 		parent := "cluster-" + parentKeys[len(parentKeys)-1]
 		// Find the shape for this node.
 		var shape string
-		if _, ok := usedCalls[i]; !ok {
+		if _, ok := usedCalls[i]; !ok && !builder.collapsedDeps[key] {
 			// This call is not used and thus becomes a starting node.
 			// The output of this call is what wire.Build ultimately returns.
 			shape = "doubleoctagon"
@@ -208,17 +1214,45 @@ func (builder *GraphvizBuilder) addOutputs(calls []call, pset *ProviderSet, fset
 			// Otherwise it becomes a normal node.
 			shape = "box"
 		}
-		builder.gviz.AddNode(parent, key, map[string]string{
-			"label": label,
+		attrs := map[string]string{
+			"label": quoteString(label),
 			"shape": shape,
-		})
+		}
+		// Warmer fill colors indicate slower providers.
+		if timed {
+			attrs["style"] = "filled"
+			attrs["fillcolor"] = quoteString(heatColor(heat(d, max)))
+		}
+		if call.conditional {
+			attrs["style"] = quoteString(strings.TrimPrefix(attrs["style"]+",dashed", ","))
+		}
+		// Thicker borders indicate more expensive providers.
+		if width, ok := penWidths[call.cost]; ok {
+			attrs["penwidth"] = width
+		}
+		if _, ok := builder.path[i]; ok {
+			attrs["color"] = "blue"
+		}
+		if builder.cycleNodes[key] {
+			attrs["color"] = "magenta"
+			attrs["fontcolor"] = "magenta"
+		}
+		// Hovering a provider locates and explains it, and clicking it
+		// opens its file.
+		if t := tooltip(&call, pset.PkgPath, fset); t != "" {
+			attrs["tooltip"] = quoteString(escapeString(t))
+		}
+		if u := declURL(&call, fset); u != "" {
+			attrs["URL"] = quoteString(escapeString(u))
+		}
+		builder.gviz.AddNode(parent, key, attrs)
 	}
 }
 
 func (builder *GraphvizBuilder) addDepsForNewSet(calls []call, missing []*types.Type, fset *token.FileSet) {
 	// Add call dependencies as edges between nodes.
-	for _, call := range calls {
-		for _, arg := range call.args {
+	for i, call := range calls {
+		for j, arg := range call.args {
 			from := callKey(&call, fset)
 			var to string
 			if arg >= len(calls) {
@@ -228,15 +1262,15 @@ func (builder *GraphvizBuilder) addDepsForNewSet(calls []call, missing []*types.
 			} else {
 				to = callKey(&calls[arg], fset)
 			}
-			builder.gviz.AddEdge(from, to, true, nil)
+			builder.gviz.AddEdge(from, to, true, builder.edgeAttrs(edgeLabel(builder.edgeLabels, &call, j), onPath(builder.path, i, arg), builder.elided[[2]string{from, to}], builder.cycleEdges[[2]string{from, to}]))
 		}
 	}
 }
 
 func (builder *GraphvizBuilder) addDepsForBuild(calls []call, ins []*types.Var, fset *token.FileSet) {
 	// Add call dependencies as edges between nodes.
-	for _, call := range calls {
-		for _, arg := range call.args {
+	for i, call := range calls {
+		for j, arg := range call.args {
 			from := callKey(&call, fset)
 			var to string
 			if arg < len(ins) {
@@ -244,26 +1278,109 @@ func (builder *GraphvizBuilder) addDepsForBuild(calls []call, ins []*types.Var,
 			} else {
 				to = callKey(&calls[arg-len(ins)], fset)
 			}
-			builder.gviz.AddEdge(from, to, true, nil)
+			builder.gviz.AddEdge(from, to, true, builder.edgeAttrs(edgeLabel(builder.edgeLabels, &call, j), onPath(builder.path, i, arg-len(ins)), builder.elided[[2]string{from, to}], builder.cycleEdges[[2]string{from, to}]))
+		}
+	}
+}
+
+func (builder *GraphvizBuilder) addCollapsed(collapsed []*collapsedNode) {
+	builder.collapsedDeps = collapsedDeps(collapsed)
+	for _, c := range collapsed {
+		// Collapsed nodes stand for nodes of any subgraph.
+		builder.gviz.AddNode("cluster-all", c.key, map[string]string{
+			"label": quoteString(c.label()),
+			"shape": "folder",
+			"style": "dashed",
+		})
+		for _, from := range c.consumers {
+			builder.gviz.AddEdge(from, c.key, true, nil)
+		}
+		for _, to := range c.deps {
+			builder.gviz.AddEdge(c.key, to, true, nil)
 		}
 	}
 }
 
+// edgeAttrs returns the attributes of an edge, which is labeled with label,
+// highlighted if it is on the critical path, dashed if it stands for elided
+// nodes, and magenta and labeled with cycle as well if it is on a cycle.
+func (builder *GraphvizBuilder) edgeAttrs(label string, critical bool, elided bool, cycle string) map[string]string {
+	if label == "" && !critical && !elided && cycle == "" {
+		return nil
+	}
+	attrs := map[string]string{}
+	if label != "" {
+		attrs["label"] = quoteString(label)
+	}
+	if critical {
+		attrs["color"] = "blue"
+		attrs["penwidth"] = "2"
+	}
+	if elided {
+		attrs["style"] = "dashed"
+	}
+	if cycle != "" {
+		attrs["color"] = "magenta"
+		attrs["fontcolor"] = "magenta"
+		attrs["label"] = quoteString(joinLabels(label, cycle))
+	}
+	return attrs
+}
+
 func (builder *GraphvizBuilder) String() string {
 	return builder.gviz.String()
 }
 
 type CytospaceNode struct {
-	Data CytospaceNodeData `json:"data"`
+	Data    CytospaceNodeData `json:"data"`
+	Classes string            `json:"classes,omitempty"` // e.g. "heat-5" for the slowest providers or "declared" for declared inputs
 }
 
 type CytospaceNodeData struct {
 	Id     string  `json:"id"`
 	Parent *string `json:"parent"` // optional
 	// These are custom fields and are not required by cytospace.
-	Content  string `json:"content"`
-	Subgraph bool   `json:"subgraph"`
-	Shape    string `json:"shape"`
+	Content     string `json:"content"`
+	Subgraph    bool   `json:"subgraph"`
+	Shape       string `json:"shape"`
+	Cost        string `json:"cost,omitempty"`        // cost category of the provider, if any
+	Critical    bool   `json:"critical,omitempty"`    // whether the node is on the critical path
+	Duration    string `json:"duration,omitempty"`    // measured duration of the provider, if any
+	Declared    bool   `json:"declared,omitempty"`    // whether the node is an input declared by wire.Requires
+	Missing     bool   `json:"missing,omitempty"`     // whether the node is an input standing for a type without a provider
+	Cycle       bool   `json:"cycle,omitempty"`       // whether the node is a provider on a cycle
+	Conditional bool   `json:"conditional,omitempty"` // whether the node is a provider returning (T, bool)
+	Collapsed   int    `json:"collapsed,omitempty"`   // number of hidden providers the node stands for
+	Package     string `json:"package,omitempty"`     // import path of the provider, if declared outside the root package
+	Tooltip     string `json:"tooltip,omitempty"`     // qualified name, position and doc sentence of the provider, one per line
+	// Command opens the declaration of the provider in an editor, if known.
+	Command *CytospaceCommand `json:"command,omitempty"`
+}
+
+// OpenLocationCommand is the command revealing a source location in an
+// editor. Its arguments are the file name and the 1-based line and column.
+const OpenLocationCommand = "wireplus.openLocation"
+
+// A CytospaceCommand is an editor command attached to a node, in the form of
+// an LSP command.
+type CytospaceCommand struct {
+	Title     string        `json:"title"`
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments"`
+}
+
+// openLocation returns the command revealing pos, or nil if pos is not
+// known.
+func openLocation(fset *token.FileSet, pos token.Pos) *CytospaceCommand {
+	if !pos.IsValid() {
+		return nil
+	}
+	p := fset.Position(pos)
+	return &CytospaceCommand{
+		Title:     "Go to Declaration",
+		Command:   OpenLocationCommand,
+		Arguments: []interface{}{p.Filename, p.Line, p.Column},
+	}
 }
 
 type CytospaceEdge struct {
@@ -274,6 +1391,13 @@ type CytospaceEdgeData struct {
 	Id     string `json:"id"`
 	Source string `json:"source"`
 	Target string `json:"target"`
+	// These are custom fields and are not required by cytospace.
+	Critical bool   `json:"critical,omitempty"`
+	Elided   bool   `json:"elided,omitempty"` // whether the edge stands for a chain of elided nodes
+	Cycle    string `json:"cycle,omitempty"`  // the order of the edge on the cycles it is on, e.g. "cycle 1: 2/3"
+	// Label is the label of the edge set by GraphEdgeLabels, followed by
+	// Cycle if any.
+	Label string `json:"label,omitempty"`
 }
 
 type CytospaceElements struct {
@@ -283,7 +1407,16 @@ type CytospaceElements struct {
 
 type CytospaceBuilder struct {
 	elems          CytospaceElements
-	usedParentKeys map[string]bool // set of already added parent keys
+	usedParentKeys map[string]bool       // set of already added parent keys
+	path           map[int]int           // critical path, see criticalPath
+	durations      map[int]time.Duration // measured durations of calls, by index
+	collapsedDeps  map[string]bool       // keys of the nodes consumed by collapsed nodes
+	elided         map[[2]string]bool    // edges standing for elided nodes, see setElided
+	missing        map[string]bool       // keys of the inputs without a provider, see setMissing
+	cycleNodes     map[string]bool       // keys of the nodes on cycles, see setCycles
+	cycleEdges     map[[2]string]string  // labels of the edges on cycles, see setCycles
+	cluster        GraphCluster          // grouping of the providers, see setCluster
+	edgeLabels     GraphEdgeLabels       // labeling of the edges, see setEdgeLabels
 }
 
 func newCytospaceBuilder() GraphBuilder {
@@ -296,18 +1429,51 @@ func newCytospaceBuilder() GraphBuilder {
 	}
 }
 
-func (builder *CytospaceBuilder) addInputsForNewSet(missing []*types.Type) {
+func (builder *CytospaceBuilder) setCriticalPath(path map[int]int) {
+	builder.path = path
+}
+
+func (builder *CytospaceBuilder) setTimings(durations map[int]time.Duration) {
+	builder.durations = durations
+}
+
+func (builder *CytospaceBuilder) setElided(edges map[[2]string]bool) {
+	builder.elided = edges
+}
+
+func (builder *CytospaceBuilder) setMissing(keys map[string]bool) {
+	builder.missing = keys
+}
+
+func (builder *CytospaceBuilder) setCycles(nodes map[string]bool, edges map[[2]string]string) {
+	builder.cycleNodes, builder.cycleEdges = nodes, edges
+}
+
+func (builder *CytospaceBuilder) setCluster(cluster GraphCluster) {
+	builder.cluster = cluster
+}
+
+func (builder *CytospaceBuilder) setEdgeLabels(labels GraphEdgeLabels) {
+	builder.edgeLabels = labels
+}
+
+func (builder *CytospaceBuilder) addInputsForNewSet(missing []*types.Type, pset *ProviderSet) {
 	for _, m := range missing {
 		key := (*m).String()
 		content := formatKey(key)
 		// Each missing input in wire.NewSet has no dependency and thus becomes a terminating node.
-		builder.elems.Nodes = append(builder.elems.Nodes, CytospaceNode{
+		node := CytospaceNode{
 			Data: CytospaceNodeData{
-				Id:      key,
-				Content: content,
-				Shape:   "octagon",
+				Id:       key,
+				Content:  content,
+				Shape:    "octagon",
+				Declared: pset.Declares(*m),
 			},
-		})
+		}
+		if node.Data.Declared {
+			node.Classes = "declared"
+		}
+		builder.elems.Nodes = append(builder.elems.Nodes, node)
 	}
 }
 
@@ -316,13 +1482,18 @@ func (builder *CytospaceBuilder) addInputsForBuild(ins []*types.Var) {
 		key := inputKey(in)
 		content := formatKey(key)
 		// Each input for wire.Build has no dependency and thus becomes a terminating node.
-		builder.elems.Nodes = append(builder.elems.Nodes, CytospaceNode{
+		node := CytospaceNode{
 			Data: CytospaceNodeData{
 				Id:      key,
 				Content: content,
 				Shape:   "octagon",
+				Missing: builder.missing[key],
 			},
-		})
+		}
+		if node.Data.Missing {
+			node.Classes = "missing"
+		}
+		builder.elems.Nodes = append(builder.elems.Nodes, node)
 	}
 }
 
@@ -334,10 +1505,10 @@ func (builder *CytospaceBuilder) addOutputs(calls []call, pset *ProviderSet, fse
 			usedCalls[arg] = true
 		}
 	}
+	max := maxDuration(builder.durations)
 	for i, call := range calls {
 		// Sort out the subgraph relationships.
-		src := pset.srcMap.At(call.out)
-		parentKeys := parentKeys(src.(*providerSetSrc), &call.out)
+		parentKeys := clusterKeys(builder.cluster, pset, &call)
 		for j := range parentKeys {
 			// Create parent subgraphs if not present.
 			curKey := parentKeys[j]
@@ -372,28 +1543,49 @@ func (builder *CytospaceBuilder) addOutputs(calls []call, pset *ProviderSet, fse
 		}
 		// Find the shape for this node.
 		var shape string
-		if _, ok := usedCalls[i]; !ok {
+		if _, ok := usedCalls[i]; !ok && !builder.collapsedDeps[key] {
 			// call is not used and thus becomes a starting node.
 			shape = "round-octagon"
 		} else {
 			// Otherwise becomes a normal node.
 			shape = "rectangle"
 		}
-		builder.elems.Nodes = append(builder.elems.Nodes, CytospaceNode{
+		_, critical := builder.path[i]
+		node := CytospaceNode{
 			Data: CytospaceNodeData{
-				Id:      key,
-				Parent:  parent,
-				Content: content,
-				Shape:   shape,
+				Id:          key,
+				Parent:      parent,
+				Content:     content,
+				Shape:       shape,
+				Cost:        call.cost,
+				Critical:    critical,
+				Cycle:       builder.cycleNodes[key],
+				Conditional: call.conditional,
+				Package:     externalPath(&call, pset.PkgPath),
+				Tooltip:     tooltip(&call, pset.PkgPath, fset),
+				Command:     openLocation(fset, call.pos),
 			},
-		})
+		}
+		var classes []string
+		if d, ok := builder.durations[i]; ok {
+			node.Data.Duration = d.String()
+			classes = append(classes, heatClass(heat(d, max)))
+		}
+		if call.conditional {
+			classes = append(classes, "conditional")
+		}
+		if node.Data.Cycle {
+			classes = append(classes, "cycle")
+		}
+		node.Classes = strings.Join(classes, " ")
+		builder.elems.Nodes = append(builder.elems.Nodes, node)
 	}
 }
 
 func (builder *CytospaceBuilder) addDepsForNewSet(calls []call, missing []*types.Type, fset *token.FileSet) {
 	// Add call dependencies as edges between nodes.
-	for _, call := range calls {
-		for _, arg := range call.args {
+	for i, call := range calls {
+		for j, arg := range call.args {
 			from := callKey(&call, fset)
 			var to string
 			if arg >= len(calls) {
@@ -405,9 +1597,13 @@ func (builder *CytospaceBuilder) addDepsForNewSet(calls []call, missing []*types
 			}
 			builder.elems.Edges = append(builder.elems.Edges, CytospaceEdge{
 				Data: CytospaceEdgeData{
-					Id:     from + "->" + to,
-					Source: from,
-					Target: to,
+					Id:       from + "->" + to,
+					Source:   from,
+					Target:   to,
+					Critical: onPath(builder.path, i, arg),
+					Elided:   builder.elided[[2]string{from, to}],
+					Cycle:    builder.cycleEdges[[2]string{from, to}],
+					Label:    builder.edgeLabel(&call, j, builder.cycleEdges[[2]string{from, to}]),
 				},
 			})
 		}
@@ -415,8 +1611,8 @@ func (builder *CytospaceBuilder) addDepsForNewSet(calls []call, missing []*types
 }
 
 func (builder *CytospaceBuilder) addDepsForBuild(calls []call, ins []*types.Var, fset *token.FileSet) {
-	for _, call := range calls {
-		for _, arg := range call.args {
+	for i, call := range calls {
+		for j, arg := range call.args {
 			from := callKey(&call, fset)
 			var to string
 			if arg < len(ins) {
@@ -426,15 +1622,54 @@ func (builder *CytospaceBuilder) addDepsForBuild(calls []call, ins []*types.Var,
 			}
 			builder.elems.Edges = append(builder.elems.Edges, CytospaceEdge{
 				Data: CytospaceEdgeData{
-					Id:     from + "->" + to,
-					Source: from,
-					Target: to,
+					Id:       from + "->" + to,
+					Source:   from,
+					Target:   to,
+					Critical: onPath(builder.path, i, arg-len(ins)),
+					Elided:   builder.elided[[2]string{from, to}],
+					Cycle:    builder.cycleEdges[[2]string{from, to}],
+					Label:    builder.edgeLabel(&call, j, builder.cycleEdges[[2]string{from, to}]),
 				},
 			})
 		}
 	}
 }
 
+// edgeLabel returns the label of the edge from c to its j-th argument,
+// whose cycle label is cycle, or "" if the edge is not labeled.
+func (builder *CytospaceBuilder) edgeLabel(c *call, j int, cycle string) string {
+	label := edgeLabel(builder.edgeLabels, c, j)
+	if label == "" {
+		return ""
+	}
+	return joinLabels(label, cycle)
+}
+
+func (builder *CytospaceBuilder) addCollapsed(collapsed []*collapsedNode) {
+	builder.collapsedDeps = collapsedDeps(collapsed)
+	for _, c := range collapsed {
+		builder.elems.Nodes = append(builder.elems.Nodes, CytospaceNode{
+			Data: CytospaceNodeData{
+				Id:        c.key,
+				Content:   c.label(),
+				Shape:     "rectangle",
+				Collapsed: c.providers,
+			},
+			Classes: "collapsed",
+		})
+		for _, from := range c.consumers {
+			builder.elems.Edges = append(builder.elems.Edges, CytospaceEdge{
+				Data: CytospaceEdgeData{Id: from + "->" + c.key, Source: from, Target: c.key},
+			})
+		}
+		for _, to := range c.deps {
+			builder.elems.Edges = append(builder.elems.Edges, CytospaceEdge{
+				Data: CytospaceEdgeData{Id: c.key + "->" + to, Source: c.key, Target: to},
+			})
+		}
+	}
+}
+
 func (builder *CytospaceBuilder) String() string {
 	bytes, _ := json.Marshal(builder.elems)
 	return string(bytes)
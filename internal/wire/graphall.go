@@ -0,0 +1,224 @@
+package wire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"golang.org/x/tools/go/packages"
+)
+
+// A NamedGraph is the graph of a provider set or injector drawn by
+// GraphAll.
+type NamedGraph struct {
+	Decl *NamedDecl
+	// Data is the graph in the requested format, as Graph returns it.
+	Data string
+
+	builder GraphBuilder
+}
+
+// Key returns the key of the graph in a document combining graphs, e.g.
+// "initApp#example.com/foo", which is unique among the packages loaded.
+func (g *NamedGraph) Key() string {
+	return g.Decl.Name + "#" + g.Decl.Pkg.PkgPath
+}
+
+// Dir returns the directory of the package declaring the graph.
+func (g *NamedGraph) Dir() (string, error) {
+	return detectOutputDir(g.Decl.Pkg.GoFiles)
+}
+
+// GraphAll draws each provider set and injector declared at the top level
+// of the packages matching pattern, in the order of AllNamed, as Graph
+// draws one. The graphs that cannot be drawn are left out, and the errors
+// of all of them are returned. If filter.Reverse is set, only the injectors
+// depending on its type are drawn.
+func GraphAll(ctx context.Context, wd string, env []string, pattern []string, tags string, format string, critical bool, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels) ([]*NamedGraph, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, pattern)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return GraphAllPackages(pkgs, format, critical, filter, cluster, edgeLabels)
+}
+
+// GraphAllPackages is like GraphAll, but draws the declarations of pkgs,
+// the packages loaded by LoadPackages.
+func GraphAllPackages(pkgs []*packages.Package, format string, critical bool, filter *GraphFilter, cluster GraphCluster, edgeLabels GraphEdgeLabels) ([]*NamedGraph, []error) {
+	decls := AllNamed(pkgs)
+	if len(decls) == 0 {
+		return nil, []error{fmt.Errorf("no provider sets or injectors found")}
+	}
+	reverse := filter != nil && filter.Reverse != ""
+	var graphs []*NamedGraph
+	var errs []error
+	for _, decl := range decls {
+		if reverse && !decl.Injector {
+			continue
+		}
+		builder, err := newGraphBuilder(format)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, drawn, declErrs := drawNamed(builder, decl, critical, nil, filter, cluster, edgeLabels)
+		if len(declErrs) == 1 {
+			if _, ok := declErrs[0].(*noDependentsError); ok {
+				// The injectors that do not depend on the type are left
+				// out silently.
+				continue
+			}
+		}
+		errs = append(errs, declErrs...)
+		if drawn {
+			graphs = append(graphs, &NamedGraph{Decl: decl, Data: builder.String(), builder: builder})
+		}
+	}
+	if reverse && len(graphs) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("no injector depends on %s", filter.Reverse))
+	}
+	return graphs, errs
+}
+
+// CombineGraphs returns graphs drawn by GraphAll as a single document, in
+// which each graph is a subgraph, cluster or container, depending on the
+// format, keyed by the Key of the graph. The keys of its nodes are
+// prefixed by it, so that the providers shared by several graphs are drawn
+// in each.
+func CombineGraphs(graphs []*NamedGraph) (string, error) {
+	if len(graphs) == 0 {
+		return "", fmt.Errorf("no graphs to combine")
+	}
+	switch graphs[0].builder.(type) {
+	case *GraphvizBuilder:
+		return combineGraphviz(graphs), nil
+	case *CytospaceBuilder:
+		return combineCytospace(graphs)
+	case *D2Builder:
+		return combineD2(graphs), nil
+	case *JSONBuilder:
+		return combineJSON(graphs)
+	}
+	return "", fmt.Errorf("graphs cannot be combined")
+}
+
+// combineGraphviz implements CombineGraphs for the graphviz format.
+func combineGraphviz(graphs []*NamedGraph) string {
+	gviz := gographviz.NewEscape()
+	gviz.SetName("all")
+	gviz.SetDir(true)
+	for _, g := range graphs {
+		prefix := g.Key() + ":"
+		src := g.builder.(*GraphvizBuilder).gviz.Graph
+		cluster := "cluster-" + g.Key()
+		gviz.AddSubGraph("all", cluster, map[string]string{
+			"label": quoteString(formatKey(g.Key())),
+		})
+		// The names in src are escaped, and stay so once prefixed.
+		var add func(parent string, name string)
+		add = func(parent string, name string) {
+			for _, child := range src.Relations.SortedChildren(name) {
+				if src.IsSubGraph(child) {
+					// The names of subgraphs start with "cluster", to be
+					// drawn as clusters, and are quoted for the "-".
+					sub := `"cluster-` + prefix + strings.TrimPrefix(child, `"cluster-`)
+					gviz.AddSubGraph(parent, sub, attrsOf(src.SubGraphs.SubGraphs[child].Attrs))
+					add(sub, child)
+					continue
+				}
+				gviz.AddNode(parent, prefixID(prefix, child), attrsOf(src.Nodes.Lookup[child].Attrs))
+			}
+		}
+		add(cluster, src.Name)
+		for _, e := range src.Edges.Edges {
+			gviz.AddEdge(prefixID(prefix, e.Src), prefixID(prefix, e.Dst), true, attrsOf(e.Attrs))
+		}
+	}
+	return gviz.String()
+}
+
+// prefixID returns the escaped graphviz ID id prefixed by prefix.
+func prefixID(prefix string, id string) string {
+	if strings.HasPrefix(id, `"`) {
+		return `"` + prefix + id[1:]
+	}
+	return quoteString(prefix + id)
+}
+
+// attrsOf returns attrs as a map to pass to gographviz.
+func attrsOf(attrs gographviz.Attrs) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		m[string(k)] = v
+	}
+	return m
+}
+
+// combineCytospace implements CombineGraphs for the cytospace format,
+// in which each graph is a node with subgraph set, the parent of its nodes.
+func combineCytospace(graphs []*NamedGraph) (string, error) {
+	all := CytospaceElements{Nodes: []CytospaceNode{}, Edges: []CytospaceEdge{}}
+	for _, g := range graphs {
+		key := g.Key()
+		prefix := key + ":"
+		all.Nodes = append(all.Nodes, CytospaceNode{
+			Data: CytospaceNodeData{
+				Id:       key,
+				Content:  formatKey(key),
+				Subgraph: true,
+				Shape:    "rectangle",
+			},
+		})
+		elems := g.builder.(*CytospaceBuilder).elems
+		for _, n := range elems.Nodes {
+			parent := key
+			if n.Data.Parent != nil {
+				parent = prefix + *n.Data.Parent
+			}
+			n.Data.Id = prefix + n.Data.Id
+			n.Data.Parent = &parent
+			all.Nodes = append(all.Nodes, n)
+		}
+		for _, e := range elems.Edges {
+			e.Data.Id = prefix + e.Data.Id
+			e.Data.Source = prefix + e.Data.Source
+			e.Data.Target = prefix + e.Data.Target
+			all.Edges = append(all.Edges, e)
+		}
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// combineD2 implements CombineGraphs for the d2 format, in which each graph
+// is a container. The paths of its nodes and edges are relative to it.
+func combineD2(graphs []*NamedGraph) string {
+	var b strings.Builder
+	for _, g := range graphs {
+		fmt.Fprintf(&b, "%s: {\n", d2Quote(g.Key()))
+		fmt.Fprintf(&b, "  label: %s\n", d2Quote(formatKey(g.Key())))
+		for _, line := range strings.Split(strings.TrimSuffix(g.Data, "\n"), "\n") {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// combineJSON implements CombineGraphs for the json format, in which the
+// graphs are listed as they are, since their nodes are not shared.
+func combineJSON(graphs []*NamedGraph) (string, error) {
+	all := JSONGraphs{Version: GraphSchemaVersion, Graphs: []JSONGraph{}}
+	for _, g := range graphs {
+		all.Graphs = append(all.Graphs, g.builder.(*JSONBuilder).graph)
+	}
+	data, err := json.Marshal(all)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,163 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// Statuses of the nodes and edges of a GraphDiff.
+const (
+	DiffUnchanged = "unchanged"
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+	// DiffRewired is the status of a node drawn in both graphs whose
+	// dependencies changed.
+	DiffRewired = "rewired"
+)
+
+// GraphDiff is the difference between two graphs of an injector or
+// provider set, such as at two revisions. Its fields are part of the output
+// of graph diff -format json and must stay stable.
+type GraphDiff struct {
+	Nodes []GraphDiffNode `json:"nodes"`
+	Edges []GraphDiffEdge `json:"edges"`
+}
+
+// GraphDiffNode is a node of either graph, sorted by Id.
+type GraphDiffNode struct {
+	Id      string `json:"id"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+// GraphDiffEdge is an edge of either graph, from a consumer to its
+// dependency, sorted by Source and Target.
+type GraphDiffEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+}
+
+// DiffGraphs returns the difference from the graph old to the graph new,
+// both drawn by Graph in the cytospace format without a filter. Nodes are
+// matched by their keys, which do not depend on positions, and provider
+// sets are left out.
+func DiffGraphs(old, new string) (*GraphDiff, error) {
+	var oldElems, newElems CytospaceElements
+	if err := json.Unmarshal([]byte(old), &oldElems); err != nil {
+		return nil, fmt.Errorf("invalid old graph: %v", err)
+	}
+	if err := json.Unmarshal([]byte(new), &newElems); err != nil {
+		return nil, fmt.Errorf("invalid new graph: %v", err)
+	}
+	nodes := make(map[string]*GraphDiffNode)
+	for _, n := range oldElems.Nodes {
+		if !n.Data.Subgraph {
+			nodes[n.Data.Id] = &GraphDiffNode{Id: n.Data.Id, Content: n.Data.Content, Status: DiffRemoved}
+		}
+	}
+	for _, n := range newElems.Nodes {
+		if n.Data.Subgraph {
+			continue
+		}
+		if d, ok := nodes[n.Data.Id]; ok {
+			d.Status = DiffUnchanged
+		} else {
+			nodes[n.Data.Id] = &GraphDiffNode{Id: n.Data.Id, Content: n.Data.Content, Status: DiffAdded}
+		}
+	}
+	type edgeKey struct{ source, target string }
+	edges := make(map[edgeKey]string)
+	for _, e := range oldElems.Edges {
+		edges[edgeKey{e.Data.Source, e.Data.Target}] = DiffRemoved
+	}
+	for _, e := range newElems.Edges {
+		k := edgeKey{e.Data.Source, e.Data.Target}
+		if _, ok := edges[k]; ok {
+			edges[k] = DiffUnchanged
+		} else {
+			edges[k] = DiffAdded
+		}
+	}
+
+	diff := &GraphDiff{Nodes: []GraphDiffNode{}, Edges: []GraphDiffEdge{}}
+	for k, status := range edges {
+		diff.Edges = append(diff.Edges, GraphDiffEdge{Source: k.source, Target: k.target, Status: status})
+		// A consumer kept in both graphs is rewired if its dependencies
+		// changed.
+		if n := nodes[k.source]; status != DiffUnchanged && n != nil && n.Status == DiffUnchanged {
+			n.Status = DiffRewired
+		}
+	}
+	sort.Slice(diff.Edges, func(i, j int) bool {
+		ei, ej := diff.Edges[i], diff.Edges[j]
+		if ei.Source != ej.Source {
+			return ei.Source < ej.Source
+		}
+		return ei.Target < ej.Target
+	})
+	for _, n := range nodes {
+		diff.Nodes = append(diff.Nodes, *n)
+	}
+	sort.Slice(diff.Nodes, func(i, j int) bool {
+		return diff.Nodes[i].Id < diff.Nodes[j].Id
+	})
+	return diff, nil
+}
+
+// Count returns the number of nodes with the given status.
+func (diff *GraphDiff) Count(status string) int {
+	n := 0
+	for _, node := range diff.Nodes {
+		if node.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// diffColors maps the statuses of a GraphDiff to the colors of their
+// nodes and edges in Graphviz.
+var diffColors = map[string]string{
+	DiffAdded:   "green3",
+	DiffRemoved: "red",
+	DiffRewired: "orange",
+}
+
+// Graphviz returns diff drawn as a Graphviz graph, in which added nodes
+// and edges are green, removed ones red and dashed, rewired nodes orange
+// and the others black.
+func (diff *GraphDiff) Graphviz() string {
+	gviz := gographviz.NewEscape()
+	gviz.SetName("diff")
+	gviz.SetDir(true)
+	for _, n := range diff.Nodes {
+		attrs := map[string]string{
+			"label": quoteString(n.Content),
+			"shape": "box",
+		}
+		if color, ok := diffColors[n.Status]; ok {
+			attrs["color"] = color
+			attrs["fontcolor"] = color
+			attrs["penwidth"] = "2"
+		}
+		if n.Status == DiffRemoved {
+			attrs["style"] = "dashed"
+		}
+		gviz.AddNode("diff", n.Id, attrs)
+	}
+	for _, e := range diff.Edges {
+		var attrs map[string]string
+		if color, ok := diffColors[e.Status]; ok {
+			attrs = map[string]string{"color": color, "penwidth": "2"}
+			if e.Status == DiffRemoved {
+				attrs["style"] = "dashed"
+			}
+		}
+		gviz.AddEdge(e.Source, e.Target, true, attrs)
+	}
+	return gviz.String()
+}
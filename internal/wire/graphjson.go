@@ -0,0 +1,402 @@
+package wire
+
+import (
+	"encoding/json"
+	"go/token"
+	"go/types"
+	"strings"
+	"time"
+)
+
+// GraphSchemaVersion is the version of the schema of the graphs drawn in
+// the json format, JSONGraph. It is incremented whenever a field changes
+// meaning or is removed; fields may be added without incrementing it.
+const GraphSchemaVersion = 1
+
+// Kinds of the nodes of a JSONGraph.
+const (
+	// JSONNodeFunction is a provider function.
+	JSONNodeFunction = "function"
+	// JSONNodeStruct is a struct provider, declared by wire.Struct.
+	JSONNodeStruct = "struct"
+	// JSONNodeValue is a value, bound by wire.Value or wire.InterfaceValue.
+	JSONNodeValue = "value"
+	// JSONNodeField is a field of a struct, provided by wire.FieldsOf.
+	JSONNodeField = "field"
+	// JSONNodeInput is an argument of the injector, or a type the provider
+	// set needs but does not provide.
+	JSONNodeInput = "input"
+	// JSONNodeMissing is a type without a provider in an injector drawn
+	// despite it.
+	JSONNodeMissing = "missing"
+	// JSONNodeCollapsed stands for nodes hidden by a filter, or for the
+	// providers of a collapsed provider set.
+	JSONNodeCollapsed = "collapsed"
+)
+
+// Roles of the edges of a JSONGraph.
+const (
+	// JSONEdgeArgument is an argument of a provider function, see Index.
+	JSONEdgeArgument = "argument"
+	// JSONEdgeField is a field set by a struct provider, see Field.
+	JSONEdgeField = "field"
+	// JSONEdgeParent is the struct a field is selected from.
+	JSONEdgeParent = "parent"
+	// JSONEdgeCollapsed leads to or from a collapsed node.
+	JSONEdgeCollapsed = "collapsed"
+)
+
+// JSONGraph is the graph of an injector or provider set drawn in the json
+// format. Unlike the cytospace format, it does not depend on a renderer,
+// and its fields are stable within a GraphSchemaVersion.
+type JSONGraph struct {
+	Version int `json:"version"`
+	// Kind is "injector" or "set", or "sets" for the graph of provider
+	// sets drawn by GraphSets.
+	Kind    string     `json:"kind"`
+	Name    string     `json:"name"`
+	Package string     `json:"package"`
+	Nodes   []JSONNode `json:"nodes"`
+	// Edges lead from consumers to their dependencies.
+	Edges []JSONEdge `json:"edges"`
+	// Sets are the provider sets the providers come from, outer sets
+	// first.
+	Sets []JSONSet `json:"sets"`
+}
+
+// JSONNode is a provider, input or other node of a JSONGraph.
+type JSONNode struct {
+	// ID is the key of the node, as in the other formats, e.g.
+	// "NewDB#example.com/app".
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// Type is the type the node provides.
+	Type string `json:"type"`
+	// Provider is the name of the provider function, struct type or field,
+	// and Package the import path declaring it.
+	Provider string `json:"provider,omitempty"`
+	Package  string `json:"package,omitempty"`
+	// Doc is the first sentence of the doc comment of the provider.
+	Doc string `json:"doc,omitempty"`
+	// Name is the name of a provider set or injector, in the graph of
+	// provider sets drawn by GraphSets.
+	Name string `json:"name,omitempty"`
+	// External is set, in the graph of provider sets, for the sets declared
+	// outside the packages drawn.
+	External bool `json:"external,omitempty"`
+	// Expr is the expression of a value.
+	Expr string `json:"expr,omitempty"`
+	// Param is the name of an argument of the injector.
+	Param string `json:"param,omitempty"`
+	// Position is the declaration of the provider, value, field or binding.
+	Position *JSONPosition `json:"position,omitempty"`
+	// Set is the ID of the innermost provider set the provider comes from,
+	// if it is not the one drawn, or of the set a collapsed node stands for.
+	Set string `json:"set,omitempty"`
+	// Root is set for the outputs of the graph, which nothing consumes.
+	Root        bool   `json:"root,omitempty"`
+	Cost        string `json:"cost,omitempty"`
+	Conditional bool   `json:"conditional,omitempty"`
+	// Declared is set for the inputs declared by wire.Requires.
+	Declared bool `json:"declared,omitempty"`
+	// Critical is set for the nodes on the critical path.
+	Critical bool `json:"critical,omitempty"`
+	// Cycle is set for the providers on a cycle.
+	Cycle bool `json:"cycle,omitempty"`
+	// Duration is the measured duration of the provider, e.g. "1.5ms".
+	Duration string `json:"duration,omitempty"`
+	// Collapsed is the number of hidden providers a collapsed node stands
+	// for.
+	Collapsed int `json:"collapsed,omitempty"`
+}
+
+// JSONPosition is a position in a source file. Line and Column are 1-based.
+type JSONPosition struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// JSONEdge is a dependency of a JSONGraph, from the consumer Source to the
+// node Target it consumes.
+type JSONEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Role   string `json:"role"`
+	// Index is the 0-based index of the parameter or field, for the
+	// argument and field roles, or -1 for an elided edge.
+	Index int `json:"index"`
+	// Param is the name of the parameter, if any, for the argument role.
+	Param string `json:"param,omitempty"`
+	// Field is the name of the field, for the field role.
+	Field string `json:"field,omitempty"`
+	// Elided is set for an edge standing for a chain of nodes hidden by a
+	// filter.
+	Elided   bool `json:"elided,omitempty"`
+	Critical bool `json:"critical,omitempty"`
+	// Cycle gives the order of the edge on the cycles it is on, e.g.
+	// "cycle 1: 2/3".
+	Cycle string `json:"cycle,omitempty"`
+}
+
+// JSONSet is a provider set included, directly or not, by the graph.
+type JSONSet struct {
+	// ID is the key of the set, e.g. "DBSet#example.com/app/db".
+	ID      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Package string `json:"package"`
+	// Parent is the ID of the set including it, if it is not the one
+	// drawn.
+	Parent string `json:"parent,omitempty"`
+}
+
+// JSONGraphs are the graphs of GraphAll combined in the json format.
+type JSONGraphs struct {
+	Version int         `json:"version"`
+	Graphs  []JSONGraph `json:"graphs"`
+}
+
+// JSONBuilder draws a graph in the json format, JSONGraph.
+type JSONBuilder struct {
+	graph         JSONGraph
+	fset          *token.FileSet
+	nIns          int                   // number of inputs preceding the calls in args, for wire.Build
+	sets          map[string]bool       // IDs of the sets added
+	path          map[int]int           // critical path, see criticalPath
+	durations     map[int]time.Duration // measured durations of calls, by index
+	collapsedDeps map[string]bool       // keys of the nodes consumed by collapsed nodes
+	elided        map[[2]string]bool    // edges standing for elided nodes, see setElided
+	missing       map[string]bool       // keys of the inputs without a provider, see setMissing
+	cycleNodes    map[string]bool       // keys of the nodes on cycles, see setCycles
+	cycleEdges    map[[2]string]string  // labels of the edges on cycles, see setCycles
+}
+
+func newJSONBuilder() GraphBuilder {
+	return &JSONBuilder{
+		graph: JSONGraph{
+			Version: GraphSchemaVersion,
+			Nodes:   []JSONNode{},
+			Edges:   []JSONEdge{},
+			Sets:    []JSONSet{},
+		},
+		sets: map[string]bool{},
+	}
+}
+
+// setDecl names the graph after decl.
+func (builder *JSONBuilder) setDecl(decl *NamedDecl) {
+	builder.graph.Kind = "set"
+	if decl.Injector {
+		builder.graph.Kind = "injector"
+	}
+	builder.graph.Name = decl.Name
+	builder.graph.Package = decl.Pkg.PkgPath
+}
+
+func (builder *JSONBuilder) setCriticalPath(path map[int]int) {
+	builder.path = path
+}
+
+func (builder *JSONBuilder) setTimings(durations map[int]time.Duration) {
+	builder.durations = durations
+}
+
+func (builder *JSONBuilder) setElided(edges map[[2]string]bool) {
+	builder.elided = edges
+}
+
+func (builder *JSONBuilder) setMissing(keys map[string]bool) {
+	builder.missing = keys
+}
+
+func (builder *JSONBuilder) setCycles(nodes map[string]bool, edges map[[2]string]string) {
+	builder.cycleNodes, builder.cycleEdges = nodes, edges
+}
+
+// setCluster does nothing, as the nodes give both their package and the
+// provider set they come from, whatever the clustering.
+func (builder *JSONBuilder) setCluster(cluster GraphCluster) {}
+
+// setEdgeLabels does nothing, as the edges give the parameters and fields
+// consuming them, whatever the labeling.
+func (builder *JSONBuilder) setEdgeLabels(labels GraphEdgeLabels) {}
+
+func (builder *JSONBuilder) addInputsForNewSet(missing []*types.Type, pset *ProviderSet) {
+	for _, m := range missing {
+		builder.graph.Nodes = append(builder.graph.Nodes, JSONNode{
+			ID:       (*m).String(),
+			Kind:     JSONNodeInput,
+			Type:     (*m).String(),
+			Declared: pset.Declares(*m),
+		})
+	}
+}
+
+func (builder *JSONBuilder) addInputsForBuild(ins []*types.Var) {
+	builder.nIns = len(ins)
+	for _, in := range ins {
+		key := inputKey(in)
+		node := JSONNode{
+			ID:    key,
+			Kind:  JSONNodeInput,
+			Type:  in.Type().String(),
+			Param: in.Name(),
+		}
+		if builder.missing[key] {
+			node.Kind, node.Param = JSONNodeMissing, ""
+		}
+		builder.graph.Nodes = append(builder.graph.Nodes, node)
+	}
+}
+
+func (builder *JSONBuilder) addOutputs(calls []call, pset *ProviderSet, fset *token.FileSet) {
+	builder.fset = fset
+	usedCalls := map[int]bool{}
+	for _, call := range calls {
+		for _, arg := range call.args {
+			usedCalls[arg-builder.nIns] = true
+		}
+	}
+	for i, call := range calls {
+		key := callKey(&call, fset)
+		node := JSONNode{
+			ID:          key,
+			Kind:        jsonNodeKinds[call.kind],
+			Type:        types.TypeString(call.out, nil),
+			Position:    builder.position(call.pos),
+			Root:        !usedCalls[i] && !builder.collapsedDeps[key],
+			Cost:        call.cost,
+			Conditional: call.conditional,
+			Cycle:       builder.cycleNodes[key],
+		}
+		if call.kind == valueExpr {
+			// The key of a value is its expression followed by its type.
+			node.Expr = key[:strings.LastIndex(key, "#")]
+		} else {
+			node.Provider = call.name
+			node.Doc = call.doc
+			if call.pkg != nil {
+				node.Package = call.pkg.Path()
+			}
+		}
+		_, node.Critical = builder.path[i]
+		if d, ok := builder.durations[i]; ok {
+			node.Duration = d.String()
+		}
+		// Add the provider sets the call comes from, outer sets first.
+		src := pset.srcMap.At(call.out)
+		parent := ""
+		for _, setKey := range parentKeys(src.(*providerSetSrc), &call.out) {
+			if !builder.sets[setKey] {
+				builder.sets[setKey] = true
+				set := JSONSet{ID: setKey, Package: setKey, Parent: parent}
+				if i := strings.Index(setKey, "#"); i >= 0 {
+					set.Name, set.Package = setKey[:i], setKey[i+1:]
+				}
+				builder.graph.Sets = append(builder.graph.Sets, set)
+			}
+			parent = setKey
+		}
+		node.Set = parent
+		builder.graph.Nodes = append(builder.graph.Nodes, node)
+	}
+}
+
+// jsonNodeKinds maps the kinds of calls to those of nodes.
+var jsonNodeKinds = map[callKind]string{
+	funcProviderCall: JSONNodeFunction,
+	structProvider:   JSONNodeStruct,
+	valueExpr:        JSONNodeValue,
+	selectorExpr:     JSONNodeField,
+}
+
+// position returns pos as a JSONPosition, or nil if it is not valid.
+func (builder *JSONBuilder) position(pos token.Pos) *JSONPosition {
+	if !pos.IsValid() {
+		return nil
+	}
+	p := builder.fset.Position(pos)
+	return &JSONPosition{File: p.Filename, Line: p.Line, Column: p.Column}
+}
+
+func (builder *JSONBuilder) addDepsForNewSet(calls []call, missing []*types.Type, fset *token.FileSet) {
+	for i, call := range calls {
+		for j, arg := range call.args {
+			var to string
+			if arg >= len(calls) {
+				to = (*missing[arg-len(calls)]).String()
+			} else {
+				to = callKey(&calls[arg], fset)
+			}
+			builder.addDep(&call, j, callKey(&call, fset), to, onPath(builder.path, i, arg))
+		}
+	}
+}
+
+func (builder *JSONBuilder) addDepsForBuild(calls []call, ins []*types.Var, fset *token.FileSet) {
+	for i, call := range calls {
+		for j, arg := range call.args {
+			var to string
+			if arg < len(ins) {
+				to = inputKey(ins[arg])
+			} else {
+				to = callKey(&calls[arg-len(ins)], fset)
+			}
+			builder.addDep(&call, j, callKey(&call, fset), to, onPath(builder.path, i, arg-len(ins)))
+		}
+	}
+}
+
+// addDep adds the edge from the call c, whose key is from, to its j-th
+// argument, whose key is to.
+func (builder *JSONBuilder) addDep(c *call, j int, from string, to string, critical bool) {
+	edge := JSONEdge{
+		Source:   from,
+		Target:   to,
+		Elided:   builder.elided[[2]string{from, to}],
+		Critical: critical,
+		Cycle:    builder.cycleEdges[[2]string{from, to}],
+	}
+	k := c.argIndex(j)
+	switch c.kind {
+	case structProvider:
+		edge.Role, edge.Index = JSONEdgeField, k
+		if k >= 0 {
+			edge.Field = c.fieldNames[k]
+		}
+	case selectorExpr:
+		edge.Role = JSONEdgeParent
+	default:
+		edge.Role, edge.Index = JSONEdgeArgument, k
+		if k >= 0 && c.paramNames[k] != "_" {
+			edge.Param = c.paramNames[k]
+		}
+	}
+	builder.graph.Edges = append(builder.graph.Edges, edge)
+}
+
+func (builder *JSONBuilder) addCollapsed(collapsed []*collapsedNode) {
+	builder.collapsedDeps = collapsedDeps(collapsed)
+	for _, c := range collapsed {
+		builder.graph.Nodes = append(builder.graph.Nodes, JSONNode{
+			ID:        c.key,
+			Kind:      JSONNodeCollapsed,
+			Set:       c.set,
+			Collapsed: c.providers,
+		})
+		for _, from := range c.consumers {
+			builder.graph.Edges = append(builder.graph.Edges, JSONEdge{Source: from, Target: c.key, Role: JSONEdgeCollapsed})
+		}
+		for _, to := range c.deps {
+			builder.graph.Edges = append(builder.graph.Edges, JSONEdge{Source: c.key, Target: to, Role: JSONEdgeCollapsed})
+		}
+	}
+}
+
+func (builder *JSONBuilder) String() string {
+	data, err := json.Marshal(builder.graph)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,360 @@
+package wire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/awalterschulze/gographviz"
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of the nodes and roles of the edges of a JSONGraph drawn by
+// GraphSets.
+const (
+	// JSONNodeSet is a provider set declared at the top level of a
+	// package.
+	JSONNodeSet = "set"
+	// JSONNodeInjector is an injector function.
+	JSONNodeInjector = "injector"
+	// JSONEdgeImport leads from a provider set or injector to a provider
+	// set it imports.
+	JSONEdgeImport = "import"
+)
+
+// setNode is a provider set or injector drawn by GraphSets.
+type setNode struct {
+	// key is "Name#path/to/pkg", as the keys of the provider sets in the
+	// other graphs.
+	key      string
+	name     string
+	pkg      string
+	pos      token.Pos
+	injector bool
+	// external is set for the provider sets declared outside the packages
+	// drawn, which are only drawn as they are imported.
+	external bool
+}
+
+// setGraph is the graph of the provider sets of packages, see GraphSets.
+type setGraph struct {
+	fset *token.FileSet
+	// nodes are sorted by package, then by name.
+	nodes []*setNode
+	// edges lead from the importing node to the imported one, sorted.
+	edges [][2]string
+}
+
+// GraphSets draws the provider sets declared at the top level of the
+// packages matching pattern, and their injectors, with an edge from each
+// to the provider sets it imports, the relation show prints as imports.
+// Anonymous provider sets, such as those nested in a wire.NewSet, are seen
+// through: the sets they import are imported by the set including them.
+// The provider sets of other packages are drawn as they are imported,
+// dashed. The nodes are grouped by the packages declaring them, and carry
+// the position of their declaration as a tooltip. format is "graphviz",
+// "cytospace", "json" or "d2". The graph is drawn despite errors in some
+// packages, which are returned with it.
+func GraphSets(ctx context.Context, wd string, env []string, pattern []string, tags string, format string) (string, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, pattern)
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return GraphSetsPackages(pkgs, format)
+}
+
+// GraphSetsPackages is like GraphSets, but draws the provider sets of pkgs,
+// the packages loaded by LoadPackages.
+func GraphSetsPackages(pkgs []*packages.Package, format string) (string, []error) {
+	switch format {
+	case "graphviz", "cytospace", "json", "d2":
+	default:
+		return "", []error{fmt.Errorf("unknown format %q", format)}
+	}
+	info, errs := LoadInfo(pkgs)
+	if info == nil {
+		return "", errs
+	}
+	if len(info.Sets) == 0 && len(info.Injectors) == 0 {
+		return "", append(errs, fmt.Errorf("no provider sets or injectors found"))
+	}
+	g := newSetGraph(info)
+	var data string
+	var err error
+	switch format {
+	case "graphviz":
+		data = g.graphviz()
+	case "cytospace":
+		data, err = g.cytospace()
+	case "json":
+		data, err = g.json()
+	case "d2":
+		data = g.d2()
+	}
+	if err != nil {
+		return "", append(errs, err)
+	}
+	return data, errs
+}
+
+// newSetGraph returns the graph of the provider sets and injectors of info.
+func newSetGraph(info *Info) *setGraph {
+	g := &setGraph{fset: info.Fset}
+	nodes := make(map[string]*setNode)
+	edges := make(map[[2]string]bool)
+	addImports := func(from string, set *ProviderSet) {
+		for _, imp := range namedImports(set) {
+			to := imp.VarName + "#" + imp.PkgPath
+			if nodes[to] == nil {
+				nodes[to] = &setNode{key: to, name: imp.VarName, pkg: imp.PkgPath, pos: imp.Pos, external: true}
+			}
+			edges[[2]string{from, to}] = true
+		}
+	}
+	for id, set := range info.Sets {
+		key := id.VarName + "#" + id.ImportPath
+		nodes[key] = &setNode{key: key, name: id.VarName, pkg: id.ImportPath, pos: set.Pos}
+	}
+	for _, in := range info.Injectors {
+		key := in.FuncName + "#" + in.ImportPath
+		nodes[key] = &setNode{key: key, name: in.FuncName, pkg: in.ImportPath, pos: in.Pos, injector: true}
+	}
+	// The sets of the packages drawn are marked as such before their
+	// imports are added, whatever the order.
+	for id, set := range info.Sets {
+		addImports(id.VarName+"#"+id.ImportPath, set)
+	}
+	for _, in := range info.Injectors {
+		if in.Set != nil {
+			addImports(in.FuncName+"#"+in.ImportPath, in.Set)
+		}
+	}
+	for _, n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	sort.Slice(g.nodes, func(i, j int) bool {
+		if g.nodes[i].pkg != g.nodes[j].pkg {
+			return g.nodes[i].pkg < g.nodes[j].pkg
+		}
+		return g.nodes[i].name < g.nodes[j].name
+	})
+	for e := range edges {
+		g.edges = append(g.edges, e)
+	}
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i][0] != g.edges[j][0] {
+			return g.edges[i][0] < g.edges[j][0]
+		}
+		return g.edges[i][1] < g.edges[j][1]
+	})
+	return g
+}
+
+// namedImports returns the provider sets declared by package variables that
+// set imports, directly or through anonymous provider sets.
+func namedImports(set *ProviderSet) []*ProviderSet {
+	var named []*ProviderSet
+	visited := make(map[*ProviderSet]bool)
+	var visit func(set *ProviderSet)
+	visit = func(set *ProviderSet) {
+		for _, imp := range set.Imports {
+			if visited[imp] {
+				continue
+			}
+			visited[imp] = true
+			if imp.VarName != "" {
+				named = append(named, imp)
+				continue
+			}
+			visit(imp)
+		}
+	}
+	visit(set)
+	return named
+}
+
+// packages returns the import paths of the packages declaring the nodes of
+// g, in order.
+func (g *setGraph) packages() []string {
+	var pkgs []string
+	for _, n := range g.nodes {
+		if len(pkgs) == 0 || pkgs[len(pkgs)-1] != n.pkg {
+			pkgs = append(pkgs, n.pkg)
+		}
+	}
+	return pkgs
+}
+
+// tooltip returns the position of the declaration of n, or "" if it is not
+// known.
+func (g *setGraph) tooltip(n *setNode) string {
+	if !n.pos.IsValid() {
+		return ""
+	}
+	return g.fset.Position(n.pos).String()
+}
+
+// graphviz draws g in the graphviz format, in which each package is a
+// cluster.
+func (g *setGraph) graphviz() string {
+	gviz := gographviz.NewEscape()
+	gviz.SetName("sets")
+	gviz.SetDir(true)
+	for _, pkg := range g.packages() {
+		gviz.AddSubGraph("sets", quoteString("cluster-"+pkg), map[string]string{
+			"label": quoteString(pkg),
+		})
+	}
+	for _, n := range g.nodes {
+		attrs := map[string]string{
+			"label": quoteString(escapeString(n.name)),
+			"shape": "folder",
+		}
+		if n.injector {
+			attrs["shape"] = "box"
+			attrs["style"] = "bold"
+		}
+		if n.external {
+			attrs["style"] = "dashed"
+		}
+		if t := g.tooltip(n); t != "" {
+			attrs["tooltip"] = quoteString(escapeString(t))
+		}
+		gviz.AddNode(quoteString("cluster-"+n.pkg), quoteString(escapeString(n.key)), attrs)
+	}
+	for _, e := range g.edges {
+		gviz.AddEdge(quoteString(escapeString(e[0])), quoteString(escapeString(e[1])), true, nil)
+	}
+	return gviz.String()
+}
+
+// cytospace draws g in the cytospace format, in which each package is a
+// node with subgraph set, the parent of its nodes.
+func (g *setGraph) cytospace() (string, error) {
+	elems := CytospaceElements{Nodes: []CytospaceNode{}, Edges: []CytospaceEdge{}}
+	for _, pkg := range g.packages() {
+		elems.Nodes = append(elems.Nodes, CytospaceNode{
+			Data: CytospaceNodeData{
+				Id:       pkg,
+				Content:  pkg,
+				Subgraph: true,
+				Shape:    "rectangle",
+			},
+		})
+	}
+	for _, n := range g.nodes {
+		parent := n.pkg
+		shape := "round-rectangle"
+		if n.injector {
+			shape = "rectangle"
+		}
+		node := CytospaceNode{
+			Data: CytospaceNodeData{
+				Id:      n.key,
+				Parent:  &parent,
+				Content: n.name,
+				Shape:   shape,
+				Tooltip: g.tooltip(n),
+				Command: openLocation(g.fset, n.pos),
+			},
+		}
+		if n.external {
+			node.Classes = "external"
+		}
+		elems.Nodes = append(elems.Nodes, node)
+	}
+	for _, e := range g.edges {
+		elems.Edges = append(elems.Edges, CytospaceEdge{
+			Data: CytospaceEdgeData{
+				Id:     e[0] + "->" + e[1],
+				Source: e[0],
+				Target: e[1],
+			},
+		})
+	}
+	data, err := json.Marshal(elems)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// json draws g in the json format, as a JSONGraph of kind "sets" whose
+// nodes are of kind JSONNodeSet or JSONNodeInjector and whose edges have
+// the role JSONEdgeImport.
+func (g *setGraph) json() (string, error) {
+	graph := JSONGraph{
+		Version: GraphSchemaVersion,
+		Kind:    "sets",
+		Nodes:   []JSONNode{},
+		Edges:   []JSONEdge{},
+		Sets:    []JSONSet{},
+	}
+	for _, n := range g.nodes {
+		node := JSONNode{
+			ID:       n.key,
+			Kind:     JSONNodeSet,
+			Name:     n.name,
+			Package:  n.pkg,
+			External: n.external,
+		}
+		if n.injector {
+			node.Kind = JSONNodeInjector
+		}
+		if n.pos.IsValid() {
+			p := g.fset.Position(n.pos)
+			node.Position = &JSONPosition{File: p.Filename, Line: p.Line, Column: p.Column}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	for _, e := range g.edges {
+		graph.Edges = append(graph.Edges, JSONEdge{Source: e[0], Target: e[1], Role: JSONEdgeImport})
+	}
+	data, err := json.Marshal(graph)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// d2 draws g as the source of a D2 diagram, in which each package is a
+// container.
+func (g *setGraph) d2() string {
+	var b strings.Builder
+	paths := make(map[string]string)
+	pkg := ""
+	for _, n := range g.nodes {
+		if n.pkg != pkg {
+			if pkg != "" {
+				b.WriteString("}\n")
+			}
+			pkg = n.pkg
+			fmt.Fprintf(&b, "%s: {\n", d2Quote(pkg))
+		}
+		paths[n.key] = d2Quote(n.pkg) + "." + d2Quote(n.key)
+		fmt.Fprintf(&b, "  %s: {\n", d2Quote(n.key))
+		fmt.Fprintf(&b, "    label: %s\n", d2Quote(n.name))
+		if n.injector {
+			b.WriteString("    style.bold: true\n")
+		} else {
+			b.WriteString("    shape: page\n")
+		}
+		if n.external {
+			b.WriteString("    style.stroke-dash: 3\n")
+		}
+		if t := g.tooltip(n); t != "" {
+			fmt.Fprintf(&b, "    tooltip: %s\n", d2Quote(t))
+		}
+		b.WriteString("  }\n")
+	}
+	if pkg != "" {
+		b.WriteString("}\n")
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "%s -> %s\n", paths[e[0]], paths[e[1]])
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of HierarchyItem.
+const (
+	HierarchyInjector = "injector"
+	HierarchyInput    = "input"
+	HierarchyProvider = "provider"
+	HierarchyStruct   = "struct"
+	HierarchyValue    = "value"
+	HierarchyField    = "field"
+)
+
+// A HierarchyItem is an injector, an argument of an injector or a step of
+// the solution of injectors, as found by HierarchyItemAt, Dependencies and
+// Dependents.
+type HierarchyItem struct {
+	// Kind is one of the Hierarchy constants.
+	Kind string
+	// Key identifies the item among those of the same kind: the name and
+	// package path of a provider, struct, field or injector, e.g.
+	// "NewConfig#example.com/config", the source and type of a value, or
+	// the injector, name and type of an argument.
+	Key string
+	// Name is the name of the provider, struct, field, injector or argument,
+	// or the source of a value.
+	Name string
+	// Detail is the type produced by the item, with the types of the
+	// package unqualified and the others qualified by the name of their
+	// package.
+	Detail string
+	// Pos is the position of the name of the declaration of the item, or of
+	// the call to wire.Value for a value.
+	Pos token.Pos
+}
+
+// HierarchyItemAt returns the item of the injector or provider function
+// declared or referred to at pos, or nil if pos is not on such a function.
+// Providers are functions of pkg or its dependencies returning a value;
+// whether a solution calls them is only known from Dependents.
+func HierarchyItemAt(pkg *packages.Package, pos token.Pos) *HierarchyItem {
+	_, obj := ObjectAt(pkg, pos)
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Type().(*types.Signature).Recv() != nil {
+		return nil
+	}
+	qualifier := nameQualifier(pkg.Types)
+	results := fn.Type().(*types.Signature).Results()
+	if results.Len() == 0 {
+		return nil
+	}
+	item := &HierarchyItem{
+		Kind:   HierarchyProvider,
+		Key:    fn.Name() + "#" + fn.Pkg().Path(),
+		Name:   fn.Name(),
+		Detail: types.TypeString(results.At(0).Type(), qualifier),
+		Pos:    fn.Pos(),
+	}
+	if fn.Pkg() == pkg.Types {
+		if decl := findFuncDecl(pkg, fn.Name()); decl != nil {
+			if build, err := findInjectorBuild(pkg.TypesInfo, decl); build != nil && err == nil {
+				item.Kind = HierarchyInjector
+			}
+		}
+	}
+	return item
+}
+
+// Dependencies returns the items whose outputs item takes as arguments in
+// the solutions of the injectors of pkg, in order of first appearance. The
+// dependency of an injector is the step producing its output.
+func Dependencies(pkg *packages.Package, item *HierarchyItem) []*HierarchyItem {
+	var deps []*HierarchyItem
+	walkSolutions(pkg, func(g *solutionGraph) {
+		for i, node := range g.nodes {
+			if !node.is(item) {
+				continue
+			}
+			switch {
+			case node.Kind == HierarchyInjector:
+				if g.output >= 0 {
+					deps = appendItem(deps, g.nodes[g.output])
+				}
+			case i >= len(g.sol.ins):
+				for _, arg := range g.sol.calls[i-len(g.sol.ins)].args {
+					deps = appendItem(deps, g.nodes[arg])
+				}
+			}
+		}
+	})
+	return deps
+}
+
+// Dependents returns the items taking the output of item as an argument in
+// the solutions of the injectors of pkg, in order of first appearance. The
+// injector whose output is produced by item is one of them.
+func Dependents(pkg *packages.Package, item *HierarchyItem) []*HierarchyItem {
+	var deps []*HierarchyItem
+	walkSolutions(pkg, func(g *solutionGraph) {
+		for i, node := range g.nodes {
+			if !node.is(item) || node.Kind == HierarchyInjector {
+				continue
+			}
+			for j, c := range g.sol.calls {
+				for _, arg := range c.args {
+					if arg == i {
+						deps = appendItem(deps, g.nodes[len(g.sol.ins)+j])
+						break
+					}
+				}
+			}
+			if i == g.output {
+				deps = appendItem(deps, g.nodes[len(g.nodes)-1])
+			}
+		}
+	})
+	return deps
+}
+
+// solutionGraph holds the items of the solution of an injector. The nodes
+// are the arguments of the injector, then its calls as indexed by the args
+// of a call, then the injector itself.
+type solutionGraph struct {
+	sol   *buildSolution
+	nodes []*HierarchyItem
+	// output is the index of the node producing the output of the
+	// injector, or -1 if there is none.
+	output int
+}
+
+// walkSolutions calls f with the graph of each injector of pkg that can be
+// solved, in source order.
+func walkSolutions(pkg *packages.Package, f func(*solutionGraph)) {
+	qualifier := nameQualifier(pkg.Types)
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil {
+				continue
+			}
+			if build, err := findInjectorBuild(pkg.TypesInfo, fn); build == nil || err != nil {
+				continue
+			}
+			sol, errs := solveForBuild(pkg, fn.Name.Name)
+			if len(errs) > 0 {
+				continue
+			}
+			g := &solutionGraph{sol: sol, output: -1}
+			for _, in := range sol.ins {
+				g.nodes = append(g.nodes, &HierarchyItem{
+					Kind:   HierarchyInput,
+					Key:    fn.Name.Name + "." + inputKey(in),
+					Name:   in.Name(),
+					Detail: types.TypeString(in.Type(), qualifier),
+					Pos:    in.Pos(),
+				})
+			}
+			for i := range sol.calls {
+				g.nodes = append(g.nodes, callItem(pkg.Fset, qualifier, &sol.calls[i]))
+			}
+			for i := range g.nodes {
+				var t types.Type
+				if i < len(sol.ins) {
+					t = sol.ins[i].Type()
+				} else {
+					t = sol.calls[i-len(sol.ins)].out
+				}
+				if types.Identical(t, sol.out) {
+					g.output = i
+				}
+			}
+			g.nodes = append(g.nodes, &HierarchyItem{
+				Kind:   HierarchyInjector,
+				Key:    fn.Name.Name + "#" + pkg.PkgPath,
+				Name:   fn.Name.Name,
+				Detail: types.TypeString(sol.out, qualifier),
+				Pos:    fn.Name.Pos(),
+			})
+			f(g)
+		}
+	}
+}
+
+// callItem returns the item of c, a step of the solution of an injector.
+func callItem(fset *token.FileSet, qualifier types.Qualifier, c *call) *HierarchyItem {
+	item := &HierarchyItem{
+		Key:    callKey(c, fset),
+		Name:   c.name,
+		Detail: types.TypeString(c.out, qualifier),
+		Pos:    c.pos,
+	}
+	switch c.kind {
+	case funcProviderCall:
+		item.Kind = HierarchyProvider
+	case structProvider:
+		item.Kind = HierarchyStruct
+	case valueExpr:
+		item.Kind = HierarchyValue
+		item.Name = types.ExprString(c.valueExpr)
+	case selectorExpr:
+		item.Kind = HierarchyField
+	}
+	return item
+}
+
+// is reports whether item and other are the same item.
+func (item *HierarchyItem) is(other *HierarchyItem) bool {
+	return item.Kind == other.Kind && item.Key == other.Key
+}
+
+// appendItem appends item to items unless it is already there.
+func appendItem(items []*HierarchyItem, item *HierarchyItem) []*HierarchyItem {
+	for _, i := range items {
+		if i.is(item) {
+			return items
+		}
+	}
+	return append(items, item)
+}
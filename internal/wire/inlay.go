@@ -0,0 +1,111 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// An InlayHint is a label shown after an expression in a call to the wire
+// package, as found by InlayHints.
+type InlayHint struct {
+	Pos token.Pos
+	// Label lists types, with the types of the package unqualified and the
+	// others qualified by the name of their package, e.g. ": *Foo, Bar".
+	Label string
+}
+
+// InlayHints returns the hints of the file of pkg named filename, sorted
+// by position, or nil if pkg has no such file. The interface argument of
+// each wire.Bind call is followed by the concrete type bound to it, and
+// each other argument of the wire.Build call of an injector by the types
+// it provides. The arguments of a wire.Build call that does not form a
+// valid provider set have no hints.
+func InlayHints(pkg *packages.Package, filename string) []*InlayHint {
+	var file *ast.File
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			file = f
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	info := pkg.TypesInfo
+	qualifier := nameQualifier(pkg.Types)
+	label := func(ts []types.Type) string {
+		names := make([]string, len(ts))
+		for i, t := range ts {
+			names[i] = types.TypeString(t, qualifier)
+		}
+		return ": " + strings.Join(names, ", ")
+	}
+
+	var hints []*InlayHint
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isWireCall(info, call, "Bind") || len(call.Args) != 2 {
+			return true
+		}
+		ptr, ok := info.TypeOf(call.Args[1]).(*types.Pointer)
+		if !ok {
+			return true
+		}
+		hints = append(hints, &InlayHint{Pos: call.Args[0].End(), Label: label([]types.Type{ptr.Elem()})})
+		return true
+	})
+
+	oc := newObjectCache([]*packages.Package{pkg})
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		build, err := findInjectorBuild(info, fn)
+		if build == nil || err != nil {
+			continue
+		}
+		set, _, _ := injectorSet(oc, pkg, fn, build)
+		if set == nil {
+			continue
+		}
+		for _, arg := range build.Args {
+			if c, ok := astutil.Unparen(arg).(*ast.CallExpr); ok && isWireCall(info, c, "Bind") {
+				// The binding has its own hint.
+				continue
+			}
+			var out []types.Type
+			imported := false
+			for _, key := range argKeys(set, arg) {
+				switch key.kind {
+				case "import":
+					out = append(out, set.Imports[key.index].Outputs()...)
+					imported = true
+				case "provider":
+					out = append(out, set.Providers[key.index].Out...)
+				case "value":
+					out = append(out, set.Values[key.index].Out)
+				case "field":
+					out = append(out, set.Fields[key.index].Out...)
+				}
+			}
+			if len(out) == 0 {
+				continue
+			}
+			if imported {
+				// The outputs of an imported set are unordered.
+				sort.Slice(out, func(i, j int) bool {
+					return types.TypeString(out[i], qualifier) < types.TypeString(out[j], qualifier)
+				})
+			}
+			hints = append(hints, &InlayHint{Pos: arg.End(), Label: label(out)})
+		}
+	}
+	sort.SliceStable(hints, func(i, j int) bool { return hints[i].Pos < hints[j].Pos })
+	return hints
+}
@@ -0,0 +1,61 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// A SetLink is a reference to a provider set of another package in a call
+// to wire.NewSet or wire.Build, as found by SetLinks.
+type SetLink struct {
+	// Pos and End delimit the reference, e.g. "config.Set".
+	Pos, End token.Pos
+	// Target is the position of the name of the provider set variable.
+	Target token.Position
+}
+
+// SetLinks returns the references to provider sets declared in other
+// packages among the arguments of the wire.NewSet and wire.Build calls in
+// the file of pkg named filename, in source order, or nil if pkg has no
+// such file. Unlike FindReferences, it only needs the type information of
+// pkg, so the links are available as soon as pkg is loaded.
+func SetLinks(pkg *packages.Package, filename string) []*SetLink {
+	var file *ast.File
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			file = f
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	info := pkg.TypesInfo
+	var links []*SetLink
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isWireCall(info, call, "NewSet", "Build") {
+			return true
+		}
+		for _, arg := range call.Args {
+			sel, ok := astutil.Unparen(arg).(*ast.SelectorExpr)
+			if !ok {
+				continue
+			}
+			obj, ok := info.ObjectOf(sel.Sel).(*types.Var)
+			if !ok || obj.Pkg() == nil || obj.Pkg() == pkg.Types || !isProviderSetType(obj.Type()) {
+				continue
+			}
+			links = append(links, &SetLink{
+				Pos:    sel.Pos(),
+				End:    sel.End(),
+				Target: pkg.Fset.Position(obj.Pos()),
+			})
+		}
+		return true
+	})
+	return links
+}
@@ -0,0 +1,247 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// The lint rules reported by Lint.
+const (
+	// RuleUnusedProvider reports providers in the provider sets of the
+	// injectors that no injector calls.
+	RuleUnusedProvider = "unused-provider"
+	// RuleDuplicateBinding reports types provided more than once in the
+	// provider set of an injector, which prevents solving it.
+	RuleDuplicateBinding = "duplicate-binding"
+	// RuleUnusedBinding reports wire.Bind bindings in the provider sets of
+	// the injectors whose interface no injector consumes.
+	RuleUnusedBinding = "unused-binding"
+	// RuleUnusedImport reports provider sets imported by another set that
+	// provide nothing any injector uses through that import.
+	RuleUnusedImport = "unused-import"
+)
+
+// LintRules lists all lint rules in the order they are documented.
+var LintRules = []string{RuleUnusedProvider, RuleDuplicateBinding, RuleUnusedBinding, RuleUnusedImport}
+
+// LintFinding is a problem reported by a lint rule.
+type LintFinding struct {
+	// Rule is one of LintRules.
+	Rule string
+	// Position is the position of the provider, binding or provider set
+	// the finding is about.
+	Position token.Position
+	// Message describes the problem.
+	Message string
+}
+
+// Error returns the finding as "position: rule: message".
+func (f *LintFinding) Error() string {
+	return fmt.Sprintf("%v: %s: %s", f.Position, f.Rule, f.Message)
+}
+
+// Lint loads the packages matching patterns and returns the findings of the
+// rules in enabled, as LintPackages does.
+func Lint(ctx context.Context, wd string, env []string, tags string, patterns []string, enabled map[string]bool) ([]*LintFinding, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return LintPackages(pkgs, enabled)
+}
+
+// LintPackages solves every injector in pkgs and returns the findings of
+// the rules in enabled, sorted by position, along with the errors that
+// prevented solving an injector. Only the provider sets reachable from the
+// injectors are linted, since the other sets may be used by injectors
+// elsewhere. A type provided more than once is reported as a finding of
+// RuleDuplicateBinding rather than as an error if that rule is enabled.
+func LintPackages(pkgs []*packages.Package, enabled map[string]bool) ([]*LintFinding, []error) {
+	if len(pkgs) == 0 {
+		return nil, nil
+	}
+	fset := pkgs[0].Fset
+	l := &linter{
+		fset:      fset,
+		providers: make(map[string]*lintItem),
+		bindings:  make(map[string]*lintItem),
+		imports:   make(map[string]*lintItem),
+		used:      make(map[string]bool),
+	}
+	solveErrs := solveInjectors(pkgs, func(in *Injector, sol *buildSolution) {
+		l.add(sol)
+	})
+	var findings []*LintFinding
+	var errs []error
+	seen := make(map[string]bool)
+	for _, err := range solveErrs {
+		w, ok := err.(*WireErr)
+		if !ok {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := w.error.(*bindingConflict); !ok || !enabled[RuleDuplicateBinding] {
+			errs = append(errs, err)
+			continue
+		}
+		// Every injector using a set reports the conflicts in it.
+		if key := err.Error(); !seen[key] {
+			seen[key] = true
+			findings = append(findings, &LintFinding{Rule: RuleDuplicateBinding, Position: w.position, Message: w.error.Error()})
+		}
+	}
+	for rule, items := range map[string]map[string]*lintItem{
+		RuleUnusedProvider: l.providers,
+		RuleUnusedBinding:  l.bindings,
+		RuleUnusedImport:   l.imports,
+	} {
+		if !enabled[rule] {
+			continue
+		}
+		for key, item := range items {
+			if !l.used[key] {
+				findings = append(findings, &LintFinding{Rule: rule, Position: fset.Position(item.pos), Message: item.message})
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		pi, pj := findings[i].Position, findings[j].Position
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		if pi.Offset != pj.Offset {
+			return pi.Offset < pj.Offset
+		}
+		if findings[i].Rule != findings[j].Rule {
+			return findings[i].Rule < findings[j].Rule
+		}
+		return findings[i].Message < findings[j].Message
+	})
+	return findings, errs
+}
+
+// lintItem is a provider, binding or import that a lint rule reports unless
+// an injector uses it.
+type lintItem struct {
+	pos     token.Pos
+	message string
+}
+
+// linter collects the providers, bindings and imports of the provider sets
+// of solved injectors and the ones the injectors use. Each injector is
+// solved with its own objectCache, so items are identified by keys built
+// from names rather than by pointers.
+type linter struct {
+	fset      *token.FileSet
+	providers map[string]*lintItem
+	bindings  map[string]*lintItem
+	imports   map[string]*lintItem
+	used      map[string]bool
+}
+
+// add records the items of the provider sets of sol and the ones it uses.
+func (l *linter) add(sol *buildSolution) {
+	visited := make(map[*ProviderSet]bool)
+	var walk func(set *ProviderSet)
+	walk = func(set *ProviderSet) {
+		if visited[set] {
+			return
+		}
+		visited[set] = true
+		name := lintSetName(set)
+		for _, p := range set.Providers {
+			key := lintProviderKey(p.Pkg, p.Name)
+			if l.providers[key] == nil {
+				l.providers[key] = &lintItem{pos: p.Pos, message: fmt.Sprintf("provider %s.%s in %s is not used by any injector", p.Pkg.Path(), p.Name, name)}
+			}
+		}
+		for _, b := range set.Bindings {
+			key := lintBindingKey(set, b.Iface)
+			if l.bindings[key] == nil {
+				l.bindings[key] = &lintItem{pos: b.Pos, message: fmt.Sprintf("wire.Bind of %s to %s in %s is not used by any injector",
+					types.TypeString(b.Iface, nil), types.TypeString(b.Provided, nil), name)}
+			}
+		}
+		for _, imp := range set.Imports {
+			key := lintImportKey(set, imp)
+			if l.imports[key] == nil {
+				l.imports[key] = &lintItem{pos: set.Pos, message: fmt.Sprintf("%s imports %s, which provides nothing used by any injector", name, lintSetName(imp))}
+			}
+			walk(imp)
+		}
+	}
+	walk(sol.pset)
+
+	calls := sol.calls
+	if hooks := traceHooksType(sol.pset); hooks != nil {
+		// The providers of wire.TraceHooks are used by injectors generated
+		// with the TraceSpans option.
+		hookCalls, _, errs := solveCalls(l.fset, hooks, nil, types.NewTuple(sol.ins...), sol.pset)
+		if len(errs) == 0 {
+			calls = append(append([]call(nil), calls...), hookCalls...)
+		}
+	}
+	used := consumedTypes(calls, sol.out)
+	for i := range calls {
+		if calls[i].kind == funcProviderCall || calls[i].kind == structProvider {
+			l.used[lintProviderKey(calls[i].pkg, calls[i].name)] = true
+		}
+		used = append(used, calls[i].out)
+	}
+	for _, t := range used {
+		// Follow the imports to the set declaring the source of t, as
+		// leafSrc does.
+		for set := sol.pset; set != nil; {
+			v := set.srcMap.At(t)
+			if v == nil {
+				break
+			}
+			src := v.(*providerSetSrc)
+			if src.Binding != nil {
+				l.used[lintBindingKey(set, t)] = true
+			}
+			if src.Import != nil {
+				l.used[lintImportKey(set, src.Import)] = true
+			}
+			set = src.Import
+		}
+	}
+}
+
+// lintSetName returns the name of set as printed in findings.
+func lintSetName(set *ProviderSet) string {
+	if set.VarName == "" {
+		return set.AnonID
+	}
+	return ProviderSetID{ImportPath: set.PkgPath, VarName: set.VarName}.String()
+}
+
+func lintProviderKey(pkg *types.Package, name string) string {
+	return "provider " + pkg.Path() + "." + name
+}
+
+func lintBindingKey(set *ProviderSet, iface types.Type) string {
+	return "binding " + lintSetName(set) + " " + types.TypeString(iface, nil)
+}
+
+func lintImportKey(set, imp *ProviderSet) string {
+	return "import " + lintSetName(set) + " " + lintSetName(imp)
+}
+
+// consumedTypes returns the types consumed by calls and out, the output of
+// the graph, if not nil.
+func consumedTypes(calls []call, out types.Type) []types.Type {
+	var consumed []types.Type
+	if out != nil {
+		consumed = append(consumed, out)
+	}
+	for i := range calls {
+		consumed = append(consumed, calls[i].ins...)
+	}
+	return consumed
+}
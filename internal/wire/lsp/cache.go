@@ -0,0 +1,298 @@
+package lsp
+
+import (
+	"context"
+	"sync"
+)
+
+// A State is the state of a key in a Cache.
+type State int
+
+// The states of a key in a Cache. A successful load moves a key to
+// StateFresh. A failed load moves a key to StateStale if an earlier load
+// succeeded, and to StateFailed otherwise.
+const (
+	// StateUnloaded is the state of a key that was never loaded.
+	StateUnloaded State = iota
+	// StateFresh is the state of a key whose latest load succeeded.
+	StateFresh
+	// StateStale is the state of a key whose latest load failed after an
+	// earlier one succeeded. The value of the earlier load is kept.
+	StateStale
+	// StateFailed is the state of a key with no successful load.
+	StateFailed
+)
+
+func (s State) String() string {
+	switch s {
+	case StateUnloaded:
+		return "unloaded"
+	case StateFresh:
+		return "fresh"
+	case StateStale:
+		return "stale"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// A Cache holds the value of the latest successful load of each key, such
+// as a package directory, so that read-only features keep serving it while
+// the key fails to load, e.g. after a syntax error in go.mod.
+//
+// Fetch serves the recorded state of a key until it is invalidated, and
+// shares a load between concurrent callers, which FetchContext lets give up
+// on it. Load always loads.
+//
+// The zero Cache is empty, unbounded and ready to use. A Cache is safe for
+// concurrent use; when loads of a key overlap, the one started last wins.
+type Cache struct {
+	// MaxEntries is the number of keys kept, beyond which the least
+	// recently used key is evicted. Zero means no limit.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	// clock is incremented on every use of a key.
+	clock int
+}
+
+type cacheEntry struct {
+	state State
+	value interface{}
+	errs  []error
+	// started is the number of loads started, and applied the number of
+	// the latest load recorded.
+	started int
+	applied int
+	// gen is incremented on every invalidation, and valid reports whether
+	// the latest load recorded started after the last one.
+	gen   int
+	valid bool
+	// flight is the load started by Fetch that is in progress, if any.
+	flight *flight
+	// used is the clock of the last use of the key.
+	used int
+}
+
+// A flight is a load shared by concurrent calls to Fetch.
+type flight struct {
+	gen  int
+	done chan struct{}
+	snap Snapshot
+	// waiters is the number of calls waiting for the load, which is
+	// canceled once all of them gave up.
+	waiters int
+	cancel  context.CancelFunc
+	// claimed reports whether a call returned the result, which only the
+	// first one reports as changed.
+	claimed bool
+}
+
+// A Snapshot is the state of a key in a Cache after a load.
+type Snapshot struct {
+	State State
+	// Value is the value of the latest successful load, or nil if there is
+	// none.
+	Value interface{}
+	// Errs holds the errors of the latest load if it failed.
+	Errs []error
+	// Changed reports whether the load changed the state of the key,
+	// e.g. from StateFresh to StateStale.
+	Changed bool
+	// Cached reports whether Fetch returned without loading, either the
+	// recorded state or the result of a load started by another call.
+	Cached bool
+}
+
+// Load calls load and records its result for key. load fails if it returns
+// errors, in which case its value is ignored, and returns a non-nil value
+// otherwise.
+//
+// The returned snapshot is the state of key once the load is recorded. If
+// a load of key started later has already been recorded, the result of
+// load is discarded and the snapshot is the current state of key.
+func (c *Cache) Load(key string, load func() (interface{}, []error)) Snapshot {
+	snap, _ := c.load(context.Background(), key, func(context.Context) (interface{}, []error) {
+		return load()
+	})
+	return snap
+}
+
+// load is like Load, but passes ctx to load and discards its result if ctx
+// is done once it returns, as the load may have stopped short. It reports
+// whether the result was recorded.
+func (c *Cache) load(ctx context.Context, key string, load func(ctx context.Context) (interface{}, []error)) (Snapshot, bool) {
+	c.mu.Lock()
+	e := c.entry(key)
+	e.started++
+	seq, gen := e.started, e.gen
+	c.mu.Unlock()
+
+	value, errs := load(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctx.Err() != nil {
+		return Snapshot{}, false
+	}
+	if seq < e.applied {
+		return e.snapshot(false), true
+	}
+	e.applied = seq
+	e.valid = gen == e.gen
+	prev := e.state
+	if len(errs) == 0 {
+		e.state, e.value, e.errs = StateFresh, value, nil
+	} else {
+		e.errs = errs
+		if e.value != nil {
+			e.state = StateStale
+		} else {
+			e.state = StateFailed
+		}
+	}
+	return e.snapshot(e.state != prev), true
+}
+
+// Fetch returns the recorded state of key if it was loaded and has not been
+// invalidated since, and loads it as Load does otherwise. Calls for the
+// same key while a load is in progress wait for it and share its result,
+// unless the key was invalidated after it started.
+func (c *Cache) Fetch(key string, load func() (interface{}, []error)) Snapshot {
+	snap, _ := c.FetchContext(context.Background(), key, func(context.Context) (interface{}, []error) {
+		return load()
+	})
+	return snap
+}
+
+// FetchContext is like Fetch, but returns ctx.Err() as soon as ctx is done
+// instead of waiting for the load. The load runs with a context of its own,
+// which is canceled once every call waiting for it has given up; the
+// result of a canceled load is discarded, so the next call loads again.
+func (c *Cache) FetchContext(ctx context.Context, key string, load func(ctx context.Context) (interface{}, []error)) (Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	c.mu.Lock()
+	e := c.entry(key)
+	if e.valid {
+		snap := e.snapshot(false)
+		snap.Cached = true
+		c.mu.Unlock()
+		return snap, nil
+	}
+	f := e.flight
+	started := f == nil || f.gen != e.gen
+	if started {
+		lctx, cancel := context.WithCancel(context.Background())
+		f = &flight{gen: e.gen, done: make(chan struct{}), cancel: cancel}
+		e.flight = f
+		go func() {
+			snap, _ := c.load(lctx, key, load)
+			c.mu.Lock()
+			if e.flight == f {
+				e.flight = nil
+			}
+			f.snap = snap
+			c.mu.Unlock()
+			cancel()
+			close(f.done)
+		}()
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Later calls start a load of their own rather than waiting
+			// for the canceled one.
+			if e.flight == f {
+				e.flight = nil
+			}
+			f.cancel()
+		}
+		return Snapshot{}, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := f.snap
+	snap.Changed = snap.Changed && !f.claimed
+	snap.Cached = !started
+	f.claimed = true
+	return snap, nil
+}
+
+// Get returns the state of key without loading it.
+func (c *Cache) Get(key string) Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil {
+		return Snapshot{State: StateUnloaded}
+	}
+	return e.snapshot(false)
+}
+
+// Invalidate makes the next Fetch of key load it again. The recorded state
+// is kept, so that a failed load still keeps the last good value.
+func (c *Cache) Invalidate(key string) {
+	c.InvalidateFunc(func(k string, _ Snapshot) bool { return k == key })
+}
+
+// InvalidateFunc invalidates the keys for which f returns true. f is
+// called with the recorded state of each key, and must not use c.
+func (c *Cache) InvalidateFunc(f func(key string, snap Snapshot) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if f(k, e.snapshot(false)) {
+			e.gen++
+			e.valid = false
+		}
+	}
+}
+
+// entry returns the entry of key, adding it if needed and evicting the
+// least recently used key beyond MaxEntries. Keys with a load in progress
+// by Fetch are not evicted. c.mu must be held.
+func (c *Cache) entry(key string) *cacheEntry {
+	if c.entries == nil {
+		c.entries = make(map[string]*cacheEntry)
+	}
+	c.clock++
+	e := c.entries[key]
+	if e == nil {
+		if c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+			var oldest *cacheEntry
+			var oldestKey string
+			for k, o := range c.entries {
+				if o.flight == nil && (oldest == nil || o.used < oldest.used) {
+					oldest, oldestKey = o, k
+				}
+			}
+			if oldest != nil {
+				delete(c.entries, oldestKey)
+			}
+		}
+		e = new(cacheEntry)
+		c.entries[key] = e
+	}
+	e.used = c.clock
+	return e
+}
+
+func (e *cacheEntry) snapshot(changed bool) Snapshot {
+	return Snapshot{
+		State:   e.state,
+		Value:   e.value,
+		Errs:    e.errs,
+		Changed: changed,
+	}
+}
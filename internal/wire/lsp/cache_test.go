@@ -0,0 +1,269 @@
+package lsp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheTransitions(t *testing.T) {
+	errLoad := errors.New("go.mod:3: unknown directive: requir")
+	ok := func(v string) func() (interface{}, []error) {
+		return func() (interface{}, []error) { return v, nil }
+	}
+	fail := func() (interface{}, []error) { return nil, []error{errLoad} }
+	steps := []struct {
+		key     string
+		load    func() (interface{}, []error)
+		state   State
+		value   interface{}
+		errs    int
+		changed bool
+	}{
+		{"a", ok("a1"), StateFresh, "a1", 0, true},
+		{"a", ok("a2"), StateFresh, "a2", 0, false},
+		// A failed reload keeps the previous value.
+		{"a", fail, StateStale, "a2", 1, true},
+		{"a", fail, StateStale, "a2", 1, false},
+		// A later successful load clears the stale state.
+		{"a", ok("a3"), StateFresh, "a3", 0, true},
+		// Keys are independent.
+		{"b", fail, StateFailed, nil, 1, true},
+		{"b", fail, StateFailed, nil, 1, false},
+		{"b", ok("b1"), StateFresh, "b1", 0, true},
+		{"a", fail, StateStale, "a3", 1, true},
+	}
+	var c Cache
+	if got := c.Get("a").State; got != StateUnloaded {
+		t.Fatalf("Get of a new key = %v; want %v", got, StateUnloaded)
+	}
+	for i, step := range steps {
+		got := c.Load(step.key, step.load)
+		if got.State != step.state || got.Value != step.value || len(got.Errs) != step.errs || got.Changed != step.changed {
+			t.Errorf("step %d: Load(%q) = {%v %v %d errors changed=%t}; want {%v %v %d errors changed=%t}",
+				i, step.key, got.State, got.Value, len(got.Errs), got.Changed, step.state, step.value, step.errs, step.changed)
+		}
+		if g := c.Get(step.key); g.State != got.State || g.Value != got.Value || g.Changed {
+			t.Errorf("step %d: Get(%q) = %+v; want state of Load %+v", i, step.key, g, got)
+		}
+	}
+}
+
+func TestCacheOverlappingLoads(t *testing.T) {
+	var c Cache
+	c.Load("a", func() (interface{}, []error) { return "a1", nil })
+
+	// The first load finishes after the second, which started later and
+	// wins.
+	started := make(chan bool)
+	release := make(chan bool)
+	done := make(chan Snapshot)
+	go func() {
+		done <- c.Load("a", func() (interface{}, []error) {
+			started <- true
+			<-release
+			return "a2", nil
+		})
+	}()
+	<-started
+	second := c.Load("a", func() (interface{}, []error) {
+		return nil, []error{errors.New("no Go files")}
+	})
+	if second.State != StateStale || second.Value != "a1" {
+		t.Errorf("second Load = %+v; want stale a1", second)
+	}
+	close(release)
+	first := <-done
+	if first.State != StateStale || first.Value != "a1" || first.Changed {
+		t.Errorf("first Load = %+v; want unchanged stale a1", first)
+	}
+	if got := c.Get("a"); got.State != StateStale || got.Value != "a1" {
+		t.Errorf("Get = %+v; want stale a1", got)
+	}
+}
+
+func TestCacheFetch(t *testing.T) {
+	var c Cache
+	loads := 0
+	load := func() (interface{}, []error) {
+		loads++
+		return loads, nil
+	}
+	if got := c.Fetch("a", load); got.Cached || got.Value != 1 {
+		t.Errorf("first Fetch = %+v; want a load of 1", got)
+	}
+	if got := c.Fetch("a", load); !got.Cached || got.Value != 1 || loads != 1 {
+		t.Errorf("second Fetch = %+v after %d loads; want cached 1", got, loads)
+	}
+	// Invalidating another key does not affect a.
+	c.Invalidate("b")
+	if got := c.Fetch("a", load); !got.Cached || got.Value != 1 {
+		t.Errorf("Fetch after invalidating b = %+v; want cached 1", got)
+	}
+	c.Invalidate("a")
+	if got := c.Fetch("a", load); got.Cached || got.Value != 2 {
+		t.Errorf("Fetch after invalidating a = %+v; want a load of 2", got)
+	}
+	// A failed load is cached too, keeping the last good value, until the
+	// key is invalidated.
+	c.Invalidate("a")
+	fail := func() (interface{}, []error) {
+		loads++
+		return nil, []error{errors.New("no Go files")}
+	}
+	if got := c.Fetch("a", fail); got.State != StateStale || got.Value != 2 || !got.Changed {
+		t.Errorf("failed Fetch = %+v; want changed to stale 2", got)
+	}
+	if got := c.Fetch("a", load); !got.Cached || got.State != StateStale || loads != 3 {
+		t.Errorf("Fetch after a failed load = %+v after %d loads; want cached stale", got, loads)
+	}
+	c.InvalidateFunc(func(key string, snap Snapshot) bool { return snap.State != StateFresh })
+	if got := c.Fetch("a", load); got.Cached || got.State != StateFresh || got.Value != 4 {
+		t.Errorf("Fetch after InvalidateFunc = %+v; want a fresh load of 4", got)
+	}
+}
+
+func TestCacheFetchConcurrent(t *testing.T) {
+	var c Cache
+	var mu sync.Mutex
+	loads := 0
+	started := make(chan bool, 1)
+	release := make(chan bool)
+	load := func() (interface{}, []error) {
+		mu.Lock()
+		loads++
+		n := loads
+		mu.Unlock()
+		started <- true
+		<-release
+		return n, nil
+	}
+
+	// Concurrent fetches share the load in progress.
+	const n = 8
+	results := make(chan Snapshot, n)
+	go func() { results <- c.Fetch("a", load) }()
+	<-started
+	var wg sync.WaitGroup
+	for i := 1; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			wg.Done()
+			results <- c.Fetch("a", load)
+		}()
+	}
+	wg.Wait()
+	close(release)
+	cached := 0
+	for i := 0; i < n; i++ {
+		got := <-results
+		if got.Value != 1 {
+			t.Errorf("Fetch = %+v; want 1", got)
+		}
+		if got.Cached {
+			cached++
+		}
+	}
+	if loads != 1 || cached != n-1 {
+		t.Errorf("got %d loads and %d cached results; want 1 and %d", loads, cached, n-1)
+	}
+
+	// A fetch after an invalidation does not share the load in progress,
+	// whose result may predate the change, and the load it starts is
+	// the one recorded.
+	c.Invalidate("a")
+	release = make(chan bool)
+	first := make(chan Snapshot)
+	go func() { first <- c.Fetch("a", load) }()
+	<-started
+	c.Invalidate("a")
+	second := make(chan Snapshot)
+	go func() { second <- c.Fetch("a", load) }()
+	<-started
+	close(release)
+	<-first
+	if got := <-second; got.Cached || got.Value != 3 {
+		t.Errorf("Fetch after an invalidation during a load = %+v; want a load of 3", got)
+	}
+	if got := c.Fetch("a", load); !got.Cached || got.Value != 3 {
+		t.Errorf("Fetch = %+v; want cached 3", got)
+	}
+}
+
+func TestCacheFetchContext(t *testing.T) {
+	var c Cache
+	loads := 0
+	started := make(chan bool)
+	canceled := make(chan bool)
+	block := func(ctx context.Context) (interface{}, []error) {
+		loads++
+		started <- true
+		<-ctx.Done()
+		canceled <- true
+		return nil, []error{ctx.Err()}
+	}
+
+	// A load is canceled once every call waiting for it has given up, and
+	// its result is discarded.
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := c.FetchContext(ctx1, "a", block)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := c.FetchContext(ctx2, "a", block)
+		errs <- err
+	}()
+	for waiters := 0; waiters < 2; {
+		time.Sleep(time.Millisecond)
+		c.mu.Lock()
+		waiters = c.entries["a"].flight.waiters
+		c.mu.Unlock()
+	}
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("FetchContext after cancel = %v; want %v", err, context.Canceled)
+	}
+	select {
+	case <-canceled:
+		t.Fatal("load canceled while a call is still waiting for it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("FetchContext after cancel = %v; want %v", err, context.Canceled)
+	}
+	<-canceled
+	if got := c.Get("a"); got.State != StateUnloaded {
+		t.Errorf("Get after a canceled load = %+v; want unloaded", got)
+	}
+
+	// The next call loads again.
+	got, err := c.FetchContext(context.Background(), "a", func(context.Context) (interface{}, []error) {
+		loads++
+		return loads, nil
+	})
+	if err != nil || got.Cached || got.Value != 2 {
+		t.Errorf("FetchContext after a canceled load = %+v, %v; want a load of 2", got, err)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := Cache{MaxEntries: 2}
+	load := func() (interface{}, []error) { return "v", nil }
+	c.Fetch("a", load)
+	c.Fetch("b", load)
+	// Using a makes b the least recently used key.
+	c.Fetch("a", load)
+	c.Fetch("c", load)
+	for key, want := range map[string]State{"a": StateFresh, "b": StateUnloaded, "c": StateFresh} {
+		if got := c.Get(key).State; got != want {
+			t.Errorf("Get(%q).State = %v; want %v", key, got, want)
+		}
+	}
+}
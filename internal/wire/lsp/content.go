@@ -0,0 +1,140 @@
+package lsp
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+	"text/tabwriter"
+)
+
+// Markup kinds supported by MarkupContent.
+const (
+	PlainText = "plaintext"
+	Markdown  = "markdown"
+)
+
+// PreferredFormat returns the first markup kind in formats that the server
+// supports. Clients list formats in order of preference, and plaintext is
+// assumed if none is supported.
+func PreferredFormat(formats []string) string {
+	for _, f := range formats {
+		if f == Markdown || f == PlainText {
+			return f
+		}
+	}
+	return PlainText
+}
+
+// ContentBuilder builds MarkupContent of a given kind, so that the same
+// content can be rendered for clients with and without markdown support.
+type ContentBuilder struct {
+	kind string
+	sb   strings.Builder
+}
+
+// NewContentBuilder returns a builder for content of the given kind.
+func NewContentBuilder(kind string) *ContentBuilder {
+	return &ContentBuilder{kind: kind}
+}
+
+// Code adds a block of code in the given language.
+func (b *ContentBuilder) Code(lang string, code string) {
+	b.separate()
+	if b.kind == Markdown {
+		fmt.Fprintf(&b.sb, "```%s\n%s\n```", lang, code)
+		return
+	}
+	b.sb.WriteString(code)
+}
+
+// Text adds a paragraph of text, escaped as needed.
+func (b *ContentBuilder) Text(text string) {
+	b.separate()
+	b.sb.WriteString(b.escape(text))
+}
+
+// Link adds a paragraph with text followed by a link to pos.
+func (b *ContentBuilder) Link(text string, pos token.Position) {
+	b.separate()
+	if b.kind == Markdown {
+		fmt.Fprintf(&b.sb, "%s [%s](%s#L%d)", b.escape(text), b.escape(pos.String()), DocumentUri(pos.Filename), pos.Line)
+		return
+	}
+	fmt.Fprintf(&b.sb, "%s %s", text, pos)
+}
+
+// A TableRow is a row of a table added by ContentBuilder.Table.
+type TableRow struct {
+	// Cells holds the text of every column but the last.
+	Cells []string
+	// Pos is the position the last column links to, if valid.
+	Pos token.Position
+}
+
+// Table adds a table with the given column headers, whose last column
+// links to the position of each row.
+func (b *ContentBuilder) Table(header []string, rows []TableRow) {
+	b.separate()
+	if b.kind == Markdown {
+		b.tableRow(header[:len(header)-1], b.escape(header[len(header)-1]))
+		b.sb.WriteString("\n|" + strings.Repeat("---|", len(header)))
+		for _, row := range rows {
+			var link string
+			if row.Pos.IsValid() {
+				link = fmt.Sprintf("[%s](%s#L%d)", b.escape(row.Pos.String()), DocumentUri(row.Pos.Filename), row.Pos.Line)
+			}
+			b.sb.WriteString("\n")
+			b.tableRow(row.Cells, link)
+		}
+		return
+	}
+	tw := tabwriter.NewWriter(&b.sb, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		var pos string
+		if row.Pos.IsValid() {
+			pos = row.Pos.String()
+		}
+		fmt.Fprintf(tw, "\n%s\t%s", strings.Join(row.Cells, "\t"), pos)
+	}
+	tw.Flush()
+}
+
+// tableRow writes a row of a markdown table with the escaped cells
+// followed by last.
+func (b *ContentBuilder) tableRow(cells []string, last string) {
+	for _, c := range cells {
+		b.sb.WriteString("| " + b.escape(c) + " ")
+	}
+	b.sb.WriteString("| " + last + " |")
+}
+
+// Content returns the content built so far.
+func (b *ContentBuilder) Content() MarkupContent {
+	return MarkupContent{
+		Kind:  b.kind,
+		Value: b.sb.String(),
+	}
+}
+
+// separate starts a new paragraph if the content is not empty.
+func (b *ContentBuilder) separate() {
+	if b.sb.Len() > 0 {
+		b.sb.WriteString("\n\n")
+	}
+}
+
+// escape escapes characters that have a special meaning in markdown.
+func (b *ContentBuilder) escape(text string) string {
+	if b.kind != Markdown {
+		return text
+	}
+	var sb strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\`*_{}[]()#+-.!<>|", r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestPreferredFormat(t *testing.T) {
+	tests := []struct {
+		formats []string
+		want    string
+	}{
+		{nil, PlainText},
+		{[]string{Markdown, PlainText}, Markdown},
+		{[]string{PlainText, Markdown}, PlainText},
+		{[]string{"html", Markdown}, Markdown},
+	}
+	for _, test := range tests {
+		if got := PreferredFormat(test.formats); got != test.want {
+			t.Errorf("PreferredFormat(%q) = %q; want %q", test.formats, got, test.want)
+		}
+	}
+}
+
+func TestContentBuilder(t *testing.T) {
+	pos := token.Position{Filename: "/src/foo.go", Line: 12, Column: 2}
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{
+			kind: Markdown,
+			want: "```go\nfield Name string `json:\"name\"`\n```\n\n" +
+				"declared\\_at [/src/foo\\.go:12:2](file:///src/foo.go#L12)",
+		},
+		{
+			kind: PlainText,
+			want: "field Name string `json:\"name\"`\n\n" +
+				"declared_at /src/foo.go:12:2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			b := NewContentBuilder(test.kind)
+			b.Code("go", "field Name string `json:\"name\"`")
+			b.Link("declared_at", pos)
+			got := b.Content()
+			if got.Kind != test.kind {
+				t.Errorf("Kind = %q; want %q", got.Kind, test.kind)
+			}
+			if got.Value != test.want {
+				t.Errorf("Value = %q; want %q", got.Value, test.want)
+			}
+		})
+	}
+}
+
+func TestContentBuilderTable(t *testing.T) {
+	header := []string{"identifier", "value or type", "defined at"}
+	rows := []TableRow{
+		{Cells: []string{"retries", "= 3"}, Pos: token.Position{Filename: "/src/foo.go", Line: 7, Column: 2}},
+		{Cells: []string{"cfg", "*Config"}},
+	}
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{
+			kind: Markdown,
+			want: "| identifier | value or type | defined at |\n|---|---|---|\n" +
+				"| retries | = 3 | [/src/foo\\.go:7:2](file:///src/foo.go#L7) |\n" +
+				"| cfg | \\*Config |  |",
+		},
+		{
+			kind: PlainText,
+			want: "identifier  value or type  defined at\n" +
+				"retries     = 3            /src/foo.go:7:2\n" +
+				"cfg         *Config",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.kind, func(t *testing.T) {
+			b := NewContentBuilder(test.kind)
+			b.Table(header, rows)
+			if got := b.Content().Value; got != test.want {
+				t.Errorf("Value = %q; want %q", got, test.want)
+			}
+		})
+	}
+}
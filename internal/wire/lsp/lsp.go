@@ -2,23 +2,29 @@ package lsp
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"go/token"
 	"io"
 	"net/url"
-	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 )
 
-func ReadBuffer(reader *bufio.Reader) ([]byte, bool) {
+// ReadMessage reads the content of the next message from reader. It
+// returns io.EOF if reader is closed before the message starts.
+func ReadMessage(reader *bufio.Reader) ([]byte, error) {
 	var length int
 	for {
 		header, err := reader.ReadString('\n')
+		if err == io.EOF && header == "" {
+			return nil, io.EOF
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading header: %v\n", err)
-			return nil, false
+			return nil, fmt.Errorf("error reading header: %v", err)
 		}
 		// TODO: trim the remaining \r also
 		header = strings.TrimSpace(header)
@@ -30,80 +36,150 @@ func ReadBuffer(reader *bufio.Reader) ([]byte, bool) {
 			value := strings.TrimPrefix(header, "Content-Length: ")
 			length, err = strconv.Atoi(value)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Content-Length is not a valid integer: %v\n", err)
-				return nil, false
+				return nil, fmt.Errorf("Content-Length is not a valid integer: %v", err)
 			}
 		case strings.HasPrefix(header, "Content-Type: "):
 			value := strings.TrimPrefix(header, "Content-Type: ")
 			if value != "application/vscode-jsonrpc; charset=utf-8" {
-				fmt.Fprintf(os.Stderr, "Content-Type is invalid: %v\n", value)
-				return nil, false
+				return nil, fmt.Errorf("Content-Type is invalid: %v", value)
 			}
 		default:
-			fmt.Fprintf(os.Stderr, "header field name is invalid: %v", header)
-			return nil, false
+			return nil, fmt.Errorf("header field name is invalid: %v", header)
 		}
 	}
 	// Read len bytes of content
 	buf := make([]byte, length)
 	n, err := io.ReadFull(reader, buf)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error reading content %v\n", err)
-		return nil, false
+		return nil, fmt.Errorf("error reading content %v", err)
 	}
 	if n != length {
-		fmt.Fprintln(os.Stderr, "Content-Length and content length do not match")
-		return nil, false
+		return nil, fmt.Errorf("Content-Length and content length do not match")
 	}
-	return buf, true
+	return buf, nil
 }
 
-func ParseMessage(buf []byte) (map[string]interface{}, bool) {
-	in := make(map[string]interface{})
-	if err := json.Unmarshal(buf, &in); err != nil {
-		fmt.Fprintf(os.Stderr, "error deserializing message: %v\n", err)
-		return nil, false
+// WriteMessage writes res to w as a message with a Content-Length header,
+// with a single call to w.Write.
+func WriteMessage(w io.Writer, res interface{}) error {
+	content, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("error serializing message: %v", err)
 	}
-	return in, true
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n", len(content))
+	buf.Write(content)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing message: %v", err)
+	}
+	return nil
 }
 
-func ParseRequest(buf []byte, req interface{}) bool {
-	if err := json.Unmarshal(buf, req); err != nil {
-		fmt.Fprintf(os.Stderr, "error deserializing request (or notification): %v\n", err)
-		return false
-	}
-	return true
+// A Writer writes messages to an underlying writer. Each message, header
+// and content, is written while holding a lock, so that messages written
+// concurrently are not interleaved.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
 }
 
-func SendMessage(res interface{}) bool {
-	bytes, err := json.Marshal(res)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error serializing message: %v\n", err)
-		return false
+// NewWriter returns a Writer writing messages to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteMessage writes res as a message with a Content-Length header.
+func (w *Writer) WriteMessage(res interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WriteMessage(w.w, res)
+}
+
+// NewErrorResponse returns the response to the request with the given id
+// reporting an error with the given code and message.
+func NewErrorResponse(id interface{}, code int, format string, args ...interface{}) *ErrorResponse {
+	return &ErrorResponse{
+		Jsonrpc: "2.0",
+		Id:      id,
+		Error: &ResponseError{
+			Code:    code,
+			Message: fmt.Sprintf(format, args...),
+		},
 	}
-	fmt.Printf("Content-Length: %d\r\n", len(bytes))
-	fmt.Printf("\r\n")
-	fmt.Print(string(bytes))
-	return true
 }
 
-func SendError(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\r\n", args...)
+// DocumentPath returns the path of the file identified by uri, a file URI,
+// or the empty string if uri is not one. Percent-encoded characters are
+// decoded, and on Windows, drive letters and UNC paths are supported, e.g.
+// "file:///c%3A/app/wire.go" is `C:\app\wire.go` and
+// "file://server/share/wire.go" is `\\server\share\wire.go`.
+func DocumentPath(uri string) string {
+	return uriToPath(uri, runtime.GOOS == "windows")
+}
+
+// DocumentUri returns the file URI for the given path, the inverse of
+// DocumentPath.
+func DocumentUri(path string) string {
+	return pathToURI(path, runtime.GOOS == "windows")
 }
 
-func SendErrors(errs []error) {
-	for _, err := range errs {
-		SendError("%v", err.Error())
+// uriToPath implements DocumentPath, for Windows if windows is set.
+func uriToPath(uri string, windows bool) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" || u.Opaque != "" {
+		return ""
+	}
+	path := u.Path
+	host := u.Host
+	if host == "localhost" {
+		host = ""
+	}
+	if !windows {
+		if host != "" {
+			// Only Windows has paths on other machines.
+			return ""
+		}
+		return path
 	}
+	switch {
+	case host != "":
+		path = "//" + host + path
+	case isDrivePath(strings.TrimPrefix(path, "/")):
+		// Go reports paths with upper case drive letters, while clients
+		// may send lower case ones.
+		path = strings.ToUpper(path[1:2]) + path[2:]
+	}
+	return strings.ReplaceAll(path, "/", `\`)
 }
 
-func ParseDocumentUri(uri string) *url.URL {
-	url, err := url.Parse(uri)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse document uri: %v\n", url)
-		return nil
+// pathToURI implements DocumentUri, for Windows if windows is set.
+func pathToURI(path string, windows bool) string {
+	u := url.URL{Scheme: "file", Path: path}
+	if windows {
+		path = strings.ReplaceAll(path, `\`, "/")
+		switch {
+		case strings.HasPrefix(path, "//"):
+			host, rest := path[2:], "/"
+			if i := strings.Index(host, "/"); i >= 0 {
+				host, rest = host[:i], host[i:]
+			}
+			u.Host, u.Path = host, rest
+		case isDrivePath(path):
+			u.Path = "/" + path
+		default:
+			u.Path = path
+		}
 	}
-	return url
+	return u.String()
+}
+
+// isDrivePath reports whether path starts with a drive letter, e.g. "C:/".
+func isDrivePath(path string) bool {
+	if len(path) < 2 || path[1] != ':' || (len(path) > 2 && path[2] != '/') {
+		return false
+	}
+	c := path[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
 }
 
 // line and char must be zero-based
@@ -116,7 +192,29 @@ func CalculatePos(fset *token.FileSet, path string, line int, char int) token.Po
 		}
 		return true
 	})
+	if file == nil || line+1 > file.LineCount() {
+		return token.NoPos
+	}
 	// LineStart accepts one-based line number
 	start := file.LineStart(line + 1)
 	return token.Pos(int(start) + char)
 }
+
+// EndPosition returns the position at the end of content, which is used to
+// replace a whole document. The character offset is counted in UTF-16 code
+// units as required by the protocol.
+func EndPosition(content []byte) Position {
+	s := string(content)
+	line := strings.Count(s, "\n")
+	last := s[strings.LastIndex(s, "\n")+1:]
+	char := 0
+	for _, r := range last {
+		if r >= 0x10000 {
+			// Encoded as a surrogate pair.
+			char += 2
+		} else {
+			char++
+		}
+	}
+	return Position{Line: line, Character: char}
+}
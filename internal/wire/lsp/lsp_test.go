@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	// bytes.Buffer is not safe for concurrent use, so the writes must be
+	// serialized by the Writer.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := w.WriteMessage(NewErrorResponse(i, InternalError, "error %d", i)); err != nil {
+				t.Errorf("failed to write message %d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	r := bufio.NewReader(&buf)
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		content, err := ReadMessage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen[string(content)] = true
+	}
+	for i := 0; i < n; i++ {
+		want := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32603,"message":"error %d"}}`, i, i)
+		if !seen[want] {
+			t.Errorf("message %s was not written", want)
+		}
+	}
+	if buf.Len() > 0 {
+		t.Errorf("%d bytes left after %d messages", buf.Len(), n)
+	}
+}
+
+func TestDocumentPath(t *testing.T) {
+	tests := []struct {
+		uri     string
+		windows bool
+		want    string
+	}{
+		{uri: "file:///app/wire.go", want: "/app/wire.go"},
+		{uri: "file:///my%20app/wire%23.go", want: "/my app/wire#.go"},
+		{uri: "file://localhost/app/wire.go", want: "/app/wire.go"},
+		{uri: "file://server/app/wire.go", want: ""},
+		{uri: "untitled:Untitled-1", want: ""},
+		{uri: "https://example.com/wire.go", want: ""},
+		{uri: "file:///c%3A/my%20app/wire.go", windows: true, want: `C:\my app\wire.go`},
+		{uri: "file:///C:/app/wire.go", windows: true, want: `C:\app\wire.go`},
+		{uri: "file://server/share/app/wire.go", windows: true, want: `\\server\share\app\wire.go`},
+		{uri: "file:///app/wire.go", windows: true, want: `\app\wire.go`},
+	}
+	for _, test := range tests {
+		if got := uriToPath(test.uri, test.windows); got != test.want {
+			t.Errorf("uriToPath(%q, %t) = %q; want %q", test.uri, test.windows, got, test.want)
+		}
+	}
+}
+
+func TestDocumentUri(t *testing.T) {
+	tests := []struct {
+		path    string
+		windows bool
+		want    string
+	}{
+		{path: "/app/wire.go", want: "file:///app/wire.go"},
+		{path: "/my app/wire#.go", want: "file:///my%20app/wire%23.go"},
+		{path: `C:\my app\wire.go`, windows: true, want: "file:///C:/my%20app/wire.go"},
+		{path: `\\server\share\app\wire.go`, windows: true, want: "file://server/share/app/wire.go"},
+	}
+	for _, test := range tests {
+		got := pathToURI(test.path, test.windows)
+		if got != test.want {
+			t.Errorf("pathToURI(%q, %t) = %q; want %q", test.path, test.windows, got, test.want)
+		}
+		// The paths come back from their URIs.
+		if back := uriToPath(got, test.windows); back != test.path {
+			t.Errorf("uriToPath(%q, %t) = %q; want %q", got, test.windows, back, test.path)
+		}
+	}
+}
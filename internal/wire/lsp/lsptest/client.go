@@ -0,0 +1,143 @@
+// Package lsptest provides a client speaking framed JSON-RPC to a language
+// server, runs scripted conformance tests with it and writes the modules
+// the tests load.
+package lsptest
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/taichimaeda/wireplus/internal/wire/lsp"
+)
+
+// A Client sends requests and notifications to a server and reads the
+// messages it sends back. A test fails as soon as the exchange does not
+// go as expected.
+type Client struct {
+	t      testing.TB
+	w      io.Writer
+	r      *bufio.Reader
+	nextId int
+	// queue holds the messages initiated by the server that were read while
+	// waiting for the response to a request.
+	queue []*Message
+}
+
+// NewClient returns a client reading the messages of the server from r and
+// writing its own to w.
+func NewClient(t testing.TB, r io.Reader, w io.Writer) *Client {
+	return &Client{t: t, w: w, r: bufio.NewReader(r)}
+}
+
+// A Message is a request, response or notification sent by the server.
+type Message struct {
+	Id     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"`
+
+	// Raw is the content of the message.
+	Raw []byte `json:"-"`
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(method string, params interface{}) {
+	c.t.Helper()
+	if err := lsp.WriteMessage(c.w, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	}); err != nil {
+		c.t.Fatalf("failed to send %s: %v", method, err)
+	}
+}
+
+// Call sends a request and returns the result of its response. Messages
+// initiated by the server in the meantime are kept for Next.
+func (c *Client) Call(method string, params interface{}) json.RawMessage {
+	c.t.Helper()
+	c.nextId++
+	if err := lsp.WriteMessage(c.w, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      c.nextId,
+		"method":  method,
+		"params":  params,
+	}); err != nil {
+		c.t.Fatalf("failed to send %s: %v", method, err)
+	}
+	for {
+		msg := c.read()
+		if msg.Method != "" {
+			c.queue = append(c.queue, msg)
+			continue
+		}
+		if msg.Id == nil || *msg.Id != c.nextId {
+			c.t.Fatalf("got %s; want response to %s", msg.Raw, method)
+		}
+		if len(msg.Error) > 0 && string(msg.Error) != "null" {
+			c.t.Fatalf("%s failed: %s", method, msg.Error)
+		}
+		return msg.Result
+	}
+}
+
+// Reply sends the response to msg, a request initiated by the server, with
+// result.
+func (c *Client) Reply(msg *Message, result interface{}) {
+	c.t.Helper()
+	if msg.Id == nil {
+		c.t.Fatalf("got %s; want a request", msg.Raw)
+	}
+	if err := lsp.WriteMessage(c.w, map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      *msg.Id,
+		"result":  result,
+	}); err != nil {
+		c.t.Fatalf("failed to reply to %s: %v", msg.Method, err)
+	}
+}
+
+// Next returns the next message initiated by the server.
+func (c *Client) Next() *Message {
+	c.t.Helper()
+	if len(c.queue) > 0 {
+		msg := c.queue[0]
+		c.queue = c.queue[1:]
+		return msg
+	}
+	msg := c.read()
+	if msg.Method == "" {
+		c.t.Fatalf("got %s; want a request or notification", msg.Raw)
+	}
+	return msg
+}
+
+// Expect reads the next message initiated by the server, which must have
+// the given method, and decodes its params into params.
+func (c *Client) Expect(method string, params interface{}) {
+	c.t.Helper()
+	msg := c.Next()
+	if msg.Method != method {
+		c.t.Fatalf("got %s; want %s", msg.Raw, method)
+	}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read reads the next message sent by the server.
+func (c *Client) read() *Message {
+	c.t.Helper()
+	buf, err := lsp.ReadMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("failed to read message: %v", err)
+	}
+	msg := &Message{Raw: buf}
+	if err := json.Unmarshal(buf, msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
@@ -0,0 +1,60 @@
+package lsptest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// WriteFiles writes files, which map slash-separated paths relative to root
+// to their contents.
+func WriteFiles(t testing.TB, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// ModuleEnv returns the environment for loading the modules written by the
+// tests, which replace github.com/google/wire with a local copy.
+func ModuleEnv() []string {
+	return append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")
+}
+
+// AppMod is the go.mod of the module example.com/app written by the tests
+// next to the wire module written by SetupModules.
+const AppMod = `module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`
+
+// SetupModules writes wireGo as the module github.com/google/wire in the
+// directory "wire" of a new temporary directory, followed by files as by
+// WriteFiles, and returns the directory, which the caller removes.
+func SetupModules(t testing.TB, wireGo []byte, files map[string]string) string {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "wireplus_lsp_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := filepath.EvalSymlinks(tmp)
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+	WriteFiles(t, root, map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+	})
+	WriteFiles(t, root, files)
+	return root
+}
@@ -0,0 +1,185 @@
+package lsptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Script is a sequence of steps exchanging messages with a server.
+//
+// Each line of a script is a step, a comment starting with "#" or blank.
+// Lines starting with a space or tab continue the previous step, so that
+// long JSON values can be split. The steps are:
+//
+//	call METHOD [PARAMS]    send a request and wait for its response
+//	result JSON             check the result of the last response
+//	notify METHOD [PARAMS]  send a notification
+//	expect METHOD [JSON]    check the next request or notification from
+//	                        the server and its params
+//
+// JSON values in result and expect steps may omit object keys, which are
+// not checked. References to variables of the form $NAME are replaced
+// before a step runs.
+type Script struct {
+	// Name is the name the script was parsed with.
+	Name  string
+	steps []step
+}
+
+type step struct {
+	line   int
+	kind   string
+	method string
+	arg    string
+}
+
+// ParseScript parses the script in data.
+func ParseScript(name string, data []byte) (*Script, error) {
+	s := &Script{Name: name}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			if len(s.steps) == 0 {
+				return nil, fmt.Errorf("%s:%d: continuation line without a step", name, n)
+			}
+			s.steps[len(s.steps)-1].arg += " " + trimmed
+			continue
+		}
+		fields := strings.SplitN(trimmed, " ", 2)
+		st := step{line: n, kind: fields[0]}
+		var rest string
+		if len(fields) > 1 {
+			rest = strings.TrimSpace(fields[1])
+		}
+		switch st.kind {
+		case "call", "notify", "expect":
+			parts := strings.SplitN(rest, " ", 2)
+			st.method = parts[0]
+			if st.method == "" {
+				return nil, fmt.Errorf("%s:%d: %s requires a method", name, n, st.kind)
+			}
+			if len(parts) > 1 {
+				st.arg = strings.TrimSpace(parts[1])
+			}
+		case "result":
+			st.arg = rest
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown step %q", name, n, st.kind)
+		}
+		s.steps = append(s.steps, st)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run runs s with c, replacing the variables in vars.
+func (c *Client) Run(s *Script, vars map[string]string) {
+	c.t.Helper()
+	var last json.RawMessage
+	for _, st := range s.steps {
+		arg := os.Expand(st.arg, func(name string) string {
+			if v, ok := vars[name]; ok {
+				return v
+			}
+			return "$" + name
+		})
+		var value interface{}
+		if arg != "" {
+			if err := json.Unmarshal([]byte(arg), &value); err != nil {
+				c.t.Fatalf("%s:%d: invalid JSON: %v", s.Name, st.line, err)
+			}
+		}
+		switch st.kind {
+		case "call":
+			last = c.Call(st.method, value)
+		case "notify":
+			c.Notify(st.method, value)
+		case "result":
+			if err := match(value, last); err != nil {
+				c.t.Fatalf("%s:%d: result %s: %v", s.Name, st.line, last, err)
+			}
+		case "expect":
+			msg := c.Next()
+			if msg.Method != st.method {
+				c.t.Fatalf("%s:%d: got %s; want %s", s.Name, st.line, msg.Raw, st.method)
+			}
+			if arg == "" {
+				continue
+			}
+			if err := match(value, msg.Params); err != nil {
+				c.t.Fatalf("%s:%d: %s params %s: %v", s.Name, st.line, st.method, msg.Params, err)
+			}
+		}
+	}
+}
+
+// match reports an error if the JSON value got does not match want.
+func match(want interface{}, got json.RawMessage) error {
+	var v interface{}
+	if len(got) > 0 {
+		if err := json.Unmarshal(got, &v); err != nil {
+			return err
+		}
+	}
+	return matchValue("$", want, v)
+}
+
+// matchValue reports an error if got does not match want at path. Objects
+// match if got has a matching value for every key of want, and all other
+// values must be equal.
+func matchValue(path string, want, got interface{}) error {
+	switch w := want.(type) {
+	case map[string]interface{}:
+		g, ok := got.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: got %v; want an object", path, got)
+		}
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, ok := g[k]
+			if !ok {
+				return fmt.Errorf("%s: missing key %q", path, k)
+			}
+			if err := matchValue(path+"."+k, w[k], v); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		g, ok := got.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: got %v; want an array", path, got)
+		}
+		if len(g) != len(w) {
+			return fmt.Errorf("%s: got %d elements; want %d", path, len(g), len(w))
+		}
+		for i := range w {
+			if err := matchValue(fmt.Sprintf("%s[%d]", path, i), w[i], g[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if !reflect.DeepEqual(want, got) {
+			return fmt.Errorf("%s: got %v; want %v", path, got, want)
+		}
+		return nil
+	}
+}
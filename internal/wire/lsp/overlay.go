@@ -0,0 +1,156 @@
+package lsp
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// An Overlay holds the contents of the documents open in the client, keyed
+// by file path, which differ from the files on disk until they are saved.
+// Packages are loaded with the overlay so that the analysis reflects the
+// unsaved contents.
+//
+// The zero Overlay is empty and ready to use. An Overlay is safe for
+// concurrent use.
+type Overlay struct {
+	mu   sync.Mutex
+	docs map[string][]byte
+}
+
+// Open sets the content of the document at path, as sent by didOpen.
+func (o *Overlay) Open(path string, content []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.docs == nil {
+		o.docs = make(map[string][]byte)
+	}
+	o.docs[path] = content
+}
+
+// Change applies the changes sent by didChange to the document at path. If
+// the document is not open or a change is invalid, it returns an error and
+// leaves the document unchanged.
+func (o *Overlay) Change(path string, changes []TextDocumentContentChangeEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	content, ok := o.docs[path]
+	if !ok {
+		return fmt.Errorf("%s is not open", path)
+	}
+	content, err := ApplyChanges(content, changes)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	o.docs[path] = content
+	return nil
+}
+
+// Close removes the document at path, whose content is read from disk
+// again.
+func (o *Overlay) Close(path string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.docs, path)
+}
+
+// Files returns a copy of the contents of the open documents keyed by path,
+// as expected by packages.Config.Overlay.
+func (o *Overlay) Files() map[string][]byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	files := make(map[string][]byte, len(o.docs))
+	for path, content := range o.docs {
+		files[path] = content
+	}
+	return files
+}
+
+// ReadFile returns the content of the document at path if it is open, or
+// else of the file on disk.
+func (o *Overlay) ReadFile(path string) ([]byte, error) {
+	o.mu.Lock()
+	content, ok := o.docs[path]
+	o.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// Unsaved returns the sorted paths of the open documents whose content
+// differs from the file on disk, or whose file does not exist.
+func (o *Overlay) Unsaved() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var paths []string
+	for path, content := range o.docs {
+		if cur, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(cur, content) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ApplyChanges returns content with changes applied in order. Each change
+// replaces the text in its range, given against the content left by the
+// previous changes, or the whole content if it has no range.
+func ApplyChanges(content []byte, changes []TextDocumentContentChangeEvent) ([]byte, error) {
+	for _, c := range changes {
+		if c.Range == nil {
+			content = []byte(c.Text)
+			continue
+		}
+		start, err := Offset(content, c.Range.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := Offset(content, c.Range.End)
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid range %d:%d-%d:%d: start is after end",
+				c.Range.Start.Line, c.Range.Start.Character, c.Range.End.Line, c.Range.End.Character)
+		}
+		// The result is a new slice, as content may be shared by a copy
+		// returned by Overlay.Files.
+		next := make([]byte, 0, len(content)-(end-start)+len(c.Text))
+		next = append(next, content[:start]...)
+		next = append(next, c.Text...)
+		content = append(next, content[end:]...)
+	}
+	return content, nil
+}
+
+// Offset returns the byte offset in content of pos, whose character offset
+// is counted in UTF-16 code units as required by the protocol. A character
+// offset past the end of the line is the end of the line.
+func Offset(content []byte, pos Position) (int, error) {
+	if pos.Line < 0 || pos.Character < 0 {
+		return 0, fmt.Errorf("invalid position %d:%d", pos.Line, pos.Character)
+	}
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		i := bytes.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("invalid position %d:%d: the document has %d lines", pos.Line, pos.Character, line+1)
+		}
+		offset += i + 1
+	}
+	for char := 0; char < pos.Character && offset < len(content) && content[offset] != '\n'; {
+		r, size := utf8.DecodeRune(content[offset:])
+		if r >= 0x10000 {
+			// Encoded as a surrogate pair.
+			char += 2
+		} else {
+			char++
+		}
+		offset += size
+	}
+	return offset, nil
+}
@@ -0,0 +1,183 @@
+package lsp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApplyChanges(t *testing.T) {
+	edit := func(sl, sc, el, ec int, text string) TextDocumentContentChangeEvent {
+		return TextDocumentContentChangeEvent{
+			Range: &Range{Start: Position{Line: sl, Character: sc}, End: Position{Line: el, Character: ec}},
+			Text:  text,
+		}
+	}
+	tests := []struct {
+		name    string
+		content string
+		changes []TextDocumentContentChangeEvent
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Insert",
+			content: "var Set = wire.NewSet(NewFoo)\n",
+			changes: []TextDocumentContentChangeEvent{edit(0, 28, 0, 28, ", NewBar")},
+			want:    "var Set = wire.NewSet(NewFoo, NewBar)\n",
+		},
+		{
+			name:    "MultiLine",
+			content: "func a() {\n\treturn\n}\n\nfunc b() {}\n",
+			changes: []TextDocumentContentChangeEvent{edit(0, 9, 2, 1, "{ x(); y() }")},
+			want:    "func a() { x(); y() }\n\nfunc b() {}\n",
+		},
+		{
+			name:    "InsertLines",
+			content: "a\nd\n",
+			changes: []TextDocumentContentChangeEvent{edit(1, 0, 1, 0, "b\nc\n")},
+			want:    "a\nb\nc\nd\n",
+		},
+		{
+			// Each change applies to the content left by the previous one,
+			// whatever the order of their ranges.
+			name:    "OutOfOrder",
+			content: "one\ntwo\nthree\n",
+			changes: []TextDocumentContentChangeEvent{
+				edit(2, 0, 2, 5, "THREE"),
+				edit(0, 0, 0, 3, "ONE\nONE"),
+				edit(2, 0, 2, 3, "TWO"),
+			},
+			want: "ONE\nONE\nTWO\nTHREE\n",
+		},
+		{
+			// The character offsets count UTF-16 code units: é is one unit
+			// and two bytes, 🙂 is two units and four bytes.
+			name:    "UTF16",
+			content: "s := \"é🙂x\"\n",
+			changes: []TextDocumentContentChangeEvent{edit(0, 7, 0, 9, ":)")},
+			want:    "s := \"é:)x\"\n",
+		},
+		{
+			name:    "PastEndOfLine",
+			content: "ab\ncd\n",
+			changes: []TextDocumentContentChangeEvent{edit(0, 1, 0, 10, "X")},
+			want:    "aX\ncd\n",
+		},
+		{
+			name:    "EndOfDocument",
+			content: "a\n",
+			changes: []TextDocumentContentChangeEvent{edit(1, 0, 1, 0, "b\n")},
+			want:    "a\nb\n",
+		},
+		{
+			name:    "Full",
+			content: "old\n",
+			changes: []TextDocumentContentChangeEvent{
+				edit(0, 0, 0, 0, "ignored "),
+				{Text: "new\n"},
+				edit(0, 3, 0, 3, "er"),
+			},
+			want: "newer\n",
+		},
+		{
+			name:    "StartAfterEnd",
+			content: "abc\n",
+			changes: []TextDocumentContentChangeEvent{edit(0, 2, 0, 1, "")},
+			wantErr: true,
+		},
+		{
+			name:    "LineOutOfRange",
+			content: "abc\n",
+			changes: []TextDocumentContentChangeEvent{edit(3, 0, 3, 0, "x")},
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		got, err := ApplyChanges([]byte(test.content), test.changes)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: ApplyChanges(...) = %q; want an error", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ApplyChanges(...): %v", test.name, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: ApplyChanges(...) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	var o Overlay
+	if err := o.Change("/a.go", []TextDocumentContentChangeEvent{{Text: "x"}}); err == nil {
+		t.Error("Change of a document that is not open succeeded")
+	}
+	o.Open("/a.go", []byte("package a\n"))
+	files := o.Files()
+	change := TextDocumentContentChangeEvent{
+		Range: &Range{Start: Position{Line: 0, Character: 8}, End: Position{Line: 0, Character: 9}},
+		Text:  "b",
+	}
+	if err := o.Change("/a.go", []TextDocumentContentChangeEvent{change}); err != nil {
+		t.Fatal(err)
+	}
+	// Files returned earlier are not affected by later changes.
+	if got := string(files["/a.go"]); got != "package a\n" {
+		t.Errorf("earlier Files()[/a.go] = %q; want %q", got, "package a\n")
+	}
+	if got := string(o.Files()["/a.go"]); got != "package b\n" {
+		t.Errorf("Files()[/a.go] = %q; want %q", got, "package b\n")
+	}
+	// An invalid change leaves the document unchanged.
+	change.Range.Start.Line = 5
+	if err := o.Change("/a.go", []TextDocumentContentChangeEvent{{Text: "package c\n"}, change}); err == nil {
+		t.Error("invalid Change succeeded")
+	}
+	if got := string(o.Files()["/a.go"]); got != "package b\n" {
+		t.Errorf("Files()[/a.go] after an invalid change = %q; want %q", got, "package b\n")
+	}
+	o.Close("/a.go")
+	if got := len(o.Files()); got != 0 {
+		t.Errorf("got %d files after Close; want 0", got)
+	}
+}
+
+func TestOverlayUnsaved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overlay_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved, changed, missing := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "c.go")
+	for _, path := range []string{saved, changed} {
+		if err := ioutil.WriteFile(path, []byte("package a\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var o Overlay
+	o.Open(saved, []byte("package a\n"))
+	o.Open(changed, []byte("package b\n"))
+	o.Open(missing, []byte("package a\n"))
+	want := []string{changed, missing}
+	if got := o.Unsaved(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unsaved() = %q; want %q", got, want)
+	}
+	// ReadFile prefers the open documents to the files on disk.
+	if got, err := o.ReadFile(changed); err != nil || string(got) != "package b\n" {
+		t.Errorf("ReadFile(%s) = %q, %v; want the open document", changed, got, err)
+	}
+	o.Close(changed)
+	if got, err := o.ReadFile(changed); err != nil || string(got) != "package a\n" {
+		t.Errorf("ReadFile(%s) after Close = %q, %v; want the file on disk", changed, got, err)
+	}
+	o.Close(missing)
+	if _, err := o.ReadFile(missing); err == nil {
+		t.Errorf("ReadFile(%s) of a closed missing file succeeded", missing)
+	}
+}
@@ -0,0 +1,161 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taichimaeda/wireplus/internal/logging"
+)
+
+// TestServerCache checks that loads are shared by concurrent requests and
+// reused until a file of the package or of one of its dependencies changes.
+func TestServerCache(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := ioutil.TempDir("", "wireplus_lsp_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	root, err = filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writeFiles writes files, which map slash-separated paths relative to
+	// root to their contents.
+	writeFiles := func(files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			path := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	const injectOne = `//+build wireinject
+
+package main
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+func injectDep() *dep.Dep {
+	wire.Build(dep.NewDep)
+	return nil
+}
+`
+	injectTwo := injectOne + `
+func injectOther() *dep.Dep {
+	wire.Build(dep.NewDep)
+	return nil
+}
+`
+	writeFiles(map[string]string{
+		"wire/go.mod":  "module github.com/google/wire\n",
+		"wire/wire.go": string(wireGo),
+		"app/go.mod": `module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`,
+		"app/main.go":    "package main\n\nfunc main() {}\n",
+		"app/wire.go":    injectOne,
+		"app/dep/dep.go": "package dep\n\ntype Dep struct{}\n\nfunc NewDep() *Dep { return new(Dep) }\n",
+	})
+	dir := filepath.Join(root, "app")
+	wirePath := filepath.Join(dir, "wire.go")
+
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	defer logging.SetOutput(os.Stderr)
+	misses := func() int { return strings.Count(buf.String(), "cache miss") }
+	srv := NewServer(Options{
+		Env:     append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off"),
+		Verbose: true,
+	})
+	ctx := context.Background()
+	reload := func() *packageSnapshot {
+		t.Helper()
+		snap, err := srv.reload(ctx, dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ps, _ := snap.Value.(*packageSnapshot)
+		if ps == nil {
+			t.Fatalf("failed to load %s: %s", dir, buf.String())
+		}
+		return ps
+	}
+
+	// Concurrent requests share a single load.
+	const n = 8
+	snaps := make(chan *packageSnapshot, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			snap, _ := srv.reload(ctx, dir, nil)
+			ps, _ := snap.Value.(*packageSnapshot)
+			snaps <- ps
+		}()
+	}
+	first := <-snaps
+	for i := 1; i < n; i++ {
+		if ps := <-snaps; ps == nil || ps != first {
+			t.Errorf("concurrent reload returned snapshot %p; want %p", ps, first)
+		}
+	}
+	if got := misses(); got != 1 {
+		t.Errorf("got %d cache misses for concurrent reloads; want 1", got)
+	}
+	if ps := reload(); ps != first || misses() != 1 {
+		t.Errorf("reload did not hit the cache: %s", buf.String())
+	}
+
+	// Saving a file of the package invalidates it.
+	writeFiles(map[string]string{"app/wire.go": injectTwo})
+	srv.invalidate(wirePath)
+	if got := len(reload().info.Injectors); got != 2 || misses() != 2 {
+		t.Errorf("got %d injectors after %d misses; want 2 injectors after saving", got, misses())
+	}
+	// So does an unsaved change.
+	srv.overlay.Open(wirePath, []byte(injectOne))
+	srv.invalidate(wirePath)
+	if got := len(reload().info.Injectors); got != 1 || misses() != 3 {
+		t.Errorf("got %d injectors after %d misses; want 1 injector after the change", got, misses())
+	}
+	// And a change to a dependency, unlike a change to another package.
+	srv.invalidate(filepath.Join(root, "wire", "other", "other.go"))
+	reload()
+	if got := misses(); got != 3 {
+		t.Errorf("got %d cache misses after changing an unrelated package; want 3", got)
+	}
+	srv.invalidate(filepath.Join(dir, "dep", "dep.go"))
+	reload()
+	if got := misses(); got != 4 {
+		t.Errorf("got %d cache misses after changing a dependency; want 4", got)
+	}
+	// A canceled request does not load the package, which the next request
+	// loads.
+	srv.invalidate(wirePath)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := srv.reload(canceled, dir, nil); err != context.Canceled {
+		t.Errorf("reload of a canceled request = %v; want %v", err, context.Canceled)
+	}
+	reload()
+	if got := misses(); got != 5 {
+		t.Errorf("got %d cache misses after a canceled request; want 5", got)
+	}
+}
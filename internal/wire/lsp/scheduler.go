@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Scheduler debounces work by key, such as the diagnostics of a package
+// directory: the work scheduled for a key runs once Delay has passed
+// without the key being scheduled again, and replaces the work scheduled
+// earlier that has not started yet. Each scheduling gets a sequence number,
+// with which work that has started checks whether it is still the latest.
+//
+// The zero Scheduler runs work without delay. A Scheduler is safe for
+// concurrent use; Delay must not change once work is scheduled.
+type Scheduler struct {
+	// Delay is the time to wait for the key to be scheduled again.
+	Delay time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*scheduled
+}
+
+type scheduled struct {
+	seq   int
+	timer *time.Timer
+}
+
+// Schedule schedules run for key and returns the sequence number that is
+// passed to run.
+func (s *Scheduler) Schedule(key string, run func(seq int)) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = make(map[string]*scheduled)
+	}
+	k := s.keys[key]
+	if k == nil {
+		k = new(scheduled)
+		s.keys[key] = k
+	}
+	k.seq++
+	seq := k.seq
+	if k.timer != nil {
+		// Work that has already started finds out with Latest.
+		k.timer.Stop()
+	}
+	k.timer = time.AfterFunc(s.Delay, func() { run(seq) })
+	return seq
+}
+
+// Latest reports whether seq is the sequence number of the latest
+// scheduling of key.
+func (s *Scheduler) Latest(key string, seq int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := s.keys[key]
+	return k != nil && k.seq == seq
+}
+
+// Keys returns the sorted keys that were ever scheduled.
+func (s *Scheduler) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := &Scheduler{Delay: 50 * time.Millisecond}
+	ran := make(chan string, 10)
+	run := func(key string) func(int) {
+		return func(seq int) {
+			if s.Latest(key, seq) {
+				ran <- key
+			}
+		}
+	}
+	// Rapid schedulings of a key run once, after the last one.
+	for i := 0; i < 5; i++ {
+		s.Schedule("a", run("a"))
+	}
+	seq := s.Schedule("b", run("b"))
+	if seq != 1 {
+		t.Errorf("first Schedule of b = %d; want 1", seq)
+	}
+	got := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case key := <-ran:
+			got[key]++
+		case <-timeout:
+			t.Fatalf("got runs %v; want a and b", got)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(ran)
+	for key := range ran {
+		got[key]++
+	}
+	if want := map[string]int{"a": 1, "b": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got runs %v; want %v", got, want)
+	}
+	if !s.Latest("a", 5) || s.Latest("a", 4) || s.Latest("c", 0) {
+		t.Error("Latest does not report only the last scheduling of a key")
+	}
+	if got, want := s.Keys(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,3571 @@
+package lsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	gopackages "golang.org/x/tools/go/packages"
+)
+
+// Options configures a Server. The zero value is ready to use.
+type Options struct {
+	// Tags holds the build tags appended to wireinject, and Env the
+	// environment used to load packages, os.Environ() if nil. The settings
+	// of the client may replace Tags and add to Env.
+	Tags string
+	Env  []string
+	// Verbose logs cache hits and misses, load durations and the messages
+	// received.
+	Verbose bool
+	// LogLevel is the least severe level of the messages logged to the
+	// client with window/logMessage. LogFile, if not nil, is passed a copy
+	// of them.
+	LogLevel logging.Level
+	LogFile  *logging.Logger
+	// DiagnosticsDelay is the time to wait for further changes to a
+	// package before publishing diagnostics for it,
+	// DefaultDiagnosticsDelay if zero.
+	DiagnosticsDelay time.Duration
+	// MaxCachedPackages is the number of package directories whose loads
+	// are kept, DefaultMaxCachedPackages if zero.
+	MaxCachedPackages int
+}
+
+// DefaultDiagnosticsDelay is the default value of
+// Options.DiagnosticsDelay.
+const DefaultDiagnosticsDelay = 200 * time.Millisecond
+
+// DefaultMaxCachedPackages is the default value of
+// Options.MaxCachedPackages.
+const DefaultMaxCachedPackages = 32
+
+var (
+	// ErrNoShutdown is returned by ServeTransport if the client sends the
+	// exit notification without requesting a shutdown first.
+	ErrNoShutdown = errors.New("exit notification received before shutdown")
+	// ErrClosed is returned by ServeTransport if the client closes the
+	// connection before sending the exit notification.
+	ErrClosed = errors.New("client closed the connection")
+)
+
+// NewServer returns a Server configured by opts.
+func NewServer(opts Options) *Server {
+	s := &Server{
+		tags:             opts.Tags,
+		env:              opts.Env,
+		verbose:          opts.Verbose,
+		logLevel:         opts.LogLevel,
+		logFile:          opts.LogFile,
+		diagnosticsDelay: opts.DiagnosticsDelay,
+	}
+	if s.env == nil {
+		s.env = os.Environ()
+	}
+	if s.diagnosticsDelay == 0 {
+		s.diagnosticsDelay = DefaultDiagnosticsDelay
+	}
+	s.snapshots.MaxEntries = opts.MaxCachedPackages
+	if s.snapshots.MaxEntries == 0 {
+		s.snapshots.MaxEntries = DefaultMaxCachedPackages
+	}
+	return s
+}
+
+// A Server is a language server for Wire. It serves a single client, with
+// Serve or ServeTransport; each client needs a Server of its own.
+type Server struct {
+	// tags holds the build tags appended to wireinject.
+	tags string
+	// env is the environment used to load packages. The settings of the
+	// client may add to it and replace tags, see buildConfig.
+	env []string
+	// snapshots holds the latest successful load of each package
+	// directory and the build tags, see reload. The loads are reused until
+	// a document in the package or one of its dependencies changes.
+	snapshots Cache
+	// overlay holds the contents of the open documents, with which
+	// packages are loaded so that unsaved changes are analyzed.
+	overlay Overlay
+	// verbose logs cache hits and misses, load durations and the messages
+	// received.
+	verbose bool
+	// logLevel is the least severe level of the messages logged to the
+	// client, see logger.
+	logLevel logging.Level
+	// logFile, if not nil, is passed a copy of the messages logged to the
+	// client.
+	logFile *logging.Logger
+	// log forwards the messages of the session to the client with
+	// window/logMessage, see logger.
+	log *logging.Logger
+	// symbols indexes the provider sets, injectors and bindings of the
+	// workspace for workspace/symbol and textDocument/implementation.
+	symbols symbolIndex
+	// workspace checks the packages of the workspace folders in the
+	// background, see checkWorkspace.
+	workspace workspaceCheck
+	// diagnostics debounces the diagnostics jobs by package directory, with
+	// diagnosticsDelay.
+	diagnostics Scheduler
+	// done is closed when the session ends, after which the messages sent
+	// to the client are dropped, see send.
+	done <-chan struct{}
+	// tasks counts the handlers and the background work of the session,
+	// which ServeTransport waits for before returning.
+	tasks sync.WaitGroup
+
+	// mu guards the fields below, which are negotiated with the client
+	// during initialization.
+	mu sync.Mutex
+	// hoverFormat, completionFormat and signatureFormat are the markup
+	// kinds used for hover contents, completion item documentation and
+	// signature documentation.
+	hoverFormat      string
+	completionFormat string
+	signatureFormat  string
+	// snippetSupport reports whether the client supports snippets in
+	// completion items, see snippetItems.
+	snippetSupport bool
+	// settings holds the settings of the client, sent as initialization
+	// options and with workspace/didChangeConfiguration.
+	settings Settings
+	// severity is the severity of the published diagnostics, as set by
+	// settings.
+	severity int
+	// applyEdit reports whether the client supports workspace/applyEdit.
+	applyEdit bool
+	// showDocument reports whether the client supports window/showDocument.
+	showDocument bool
+	// lineFoldingOnly reports whether the client folds whole lines only.
+	lineFoldingOnly bool
+	// pullDiagnostics reports whether the client pulls the diagnostics of
+	// documents with textDocument/diagnostic, so that they are not
+	// published.
+	pullDiagnostics bool
+	// watchFiles reports whether the client supports registering for
+	// workspace/didChangeWatchedFiles.
+	watchFiles bool
+	// workDoneProgress reports whether the client supports work done
+	// progress created by the server, see startProgress.
+	workDoneProgress bool
+	// started reports whether the client has sent the initialize request,
+	// before which the server answers no other request.
+	started bool
+	// initialized reports whether the client has sent the initialized
+	// notification, before which the server sends no requests.
+	initialized bool
+	// roots holds the paths of the workspace folders sent by the client,
+	// sorted, as updated with workspace/didChangeWorkspaceFolders.
+	roots []string
+	// shutdown reports whether the client has sent the shutdown request.
+	shutdown bool
+	// jobs holds the documents and files of the diagnostics jobs of each
+	// package directory.
+	jobs map[string]*diagnosticsJob
+	// nextId is the id of the next request sent to the client.
+	nextId int
+	// requests holds the requests of the client that are not answered yet,
+	// keyed by request id, see handle in ServeTransport.
+	requests map[interface{}]*pendingRequest
+	// replies holds the channels receiving the errors of the responses to
+	// the requests sent to the client that are awaited, keyed by id.
+	replies map[int]chan *ResponseError
+
+	// diagnosticsDelay is the time to wait for further changes to a package
+	// before publishing diagnostics for it.
+	diagnosticsDelay time.Duration
+}
+
+// symbolIndex holds the provider sets, injectors and bindings of the
+// packages of the workspace. It is built in the background after initialization, and
+// rebuilt on the next query once a document has changed.
+type symbolIndex struct {
+	// ctx is the context of the server, with which builds run so that they
+	// outlive the requests starting them.
+	ctx context.Context
+
+	mu sync.Mutex
+	// done is closed once the latest build has finished. It is nil until
+	// the first build starts.
+	done chan struct{}
+	// seq is incremented when a build starts.
+	seq int
+	// symbols holds, for each workspace folder, the symbols of its latest
+	// successful build to finish, which was started as build number
+	// built[root]. Without workspace folders, the current directory is
+	// indexed under "".
+	symbols map[string][]SymbolInformation
+	built   map[string]int
+	// bindings holds, for each workspace folder, the calls to wire.Bind of
+	// the same build as its symbols.
+	bindings map[string][]indexedBinding
+	// providers holds, for each workspace folder, the provider functions
+	// of the same build as its symbols.
+	providers map[string]*wire.ProviderIndex
+	// stale reports whether a document changed since the latest build
+	// started.
+	stale bool
+}
+
+// workspaceCheck holds the state of the check of the workspace folders,
+// which publishes the diagnostics of the files that are not open.
+type workspaceCheck struct {
+	// ctx is the context of the server, with which checks run.
+	ctx context.Context
+
+	mu sync.Mutex
+	// cancel cancels the running check, if any, and token is the token of
+	// its progress, or empty if the client does not support progress.
+	cancel context.CancelFunc
+	token  string
+	// published holds the paths of the files with diagnostics published
+	// by the last check, which the next one clears if they are fixed.
+	published map[string]bool
+}
+
+// indexedBinding is a call to wire.Bind in the symbol index. Types are
+// kept as strings, as the index is loaded separately from the packages of
+// requests.
+type indexedBinding struct {
+	// iface and provided are the types of the binding, qualified by
+	// package path.
+	iface, provided string
+	// bind is the location of the call, and provider the one of the
+	// provider of provided in its set, if any.
+	bind, provider Location
+}
+
+// diagnosticsJob tracks the diagnostics requested for a package directory.
+type diagnosticsJob struct {
+	// save reports whether a document was saved since the last job ran.
+	save bool
+	// uris is the set of documents to publish diagnostics for.
+	uris map[string]bool
+	// others is the set of other files, such as go.mod, that the last job
+	// published diagnostics for, which are cleared by the next job.
+	others map[string]bool
+}
+
+// packageSnapshot is the value of a package directory in Server.snapshots.
+type packageSnapshot struct {
+	pkg  *gopackages.Package
+	info *wire.Info
+	// errs holds the errors found by wire.LoadInfo.
+	errs []error
+	// dirs holds the directories of the files the package and its
+	// dependencies were loaded from, and of their go.mod files, a change
+	// to which invalidates the snapshot.
+	dirs map[string]bool
+}
+
+// staleNote is appended to hover contents served from a stale snapshot.
+const staleNote = "The package failed to load, so this may be out of date."
+
+// Serve runs the server, reading messages with Content-Length headers
+// from r and writing messages to w, as over stdio, see ServeTransport.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	return s.ServeTransport(ctx, NewStreamTransport(r, w))
+}
+
+// ServeTransport runs the server, exchanging messages with the client over
+// t until the client sends the exit notification or closes the connection.
+// It returns nil only if the client requested a shutdown before the exit
+// notification, ErrNoShutdown if it did not and ErrClosed if it closed the
+// connection first. The work in progress is canceled on exit, and waited
+// for before ServeTransport returns.
+//
+// Every request is answered with either a result or a JSON-RPC error:
+// ParseError for content that is not JSON, InvalidRequest for messages
+// without a method, for requests whose id is neither a number nor a string,
+// for a second initialize request and for requests after
+// the shutdown request, ServerNotInitialized for requests before the
+// initialize request, MethodNotFound for unknown methods, InvalidParams
+// for params that cannot be decoded, and InternalError if the handler
+// panics. A message that cannot be read is answered with a ParseError of
+// null id. Notifications before the initialize request, except exit, and
+// notifications of unknown methods are ignored, and those that cannot be
+// decoded are reported with window/logMessage.
+//
+// Each request is handled with a context of its own, which $/cancelRequest
+// cancels. Handlers stop waiting for package loads once it is done, and
+// answer with a RequestCancelled error.
+func (s *Server) ServeTransport(ctx context.Context, t Transport) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		s.tasks.Wait()
+	}()
+	s.done = ctx.Done()
+	s.symbols.ctx = ctx
+	s.workspace.ctx = ctx
+	s.diagnostics.Delay = s.diagnosticsDelay
+	out := t
+	// The messages are written by a single goroutine, in the order they
+	// are sent on resCh, which answers each request exactly once: the
+	// responses to requests already answered, e.g. canceled ones, are
+	// dropped, and the requests whose handler returns without answering
+	// are answered with an InternalError. It stops when the session ends.
+	resCh := make(chan interface{})
+	go func() {
+		for {
+			var res interface{}
+			select {
+			case res = <-resCh:
+			case <-ctx.Done():
+				return
+			}
+			if done, ok := res.(requestDone); ok {
+				if s.answer(done.id, done.req) {
+					s.write(out, NewErrorResponse(done.id, InternalError, "%s returned no response", done.req.method))
+				}
+				continue
+			}
+			if id, ok := responseId(res); ok && !s.answer(id, nil) {
+				continue
+			}
+			s.write(out, res)
+		}
+	}()
+	s.log = logging.NewHandler(func(level logging.Level, msg string) {
+		s.send(resCh, makeLogMessage(messageType(level), msg))
+		if s.logFile != nil {
+			s.logFile.Log(level, msg)
+		}
+	}, s.logLevel)
+
+	for {
+		buf, err := t.ReadMessage()
+		if err == io.EOF {
+			return ErrClosed
+		}
+		if err != nil {
+			// The id of the message is unknown, so the error is reported
+			// with a null id as for content that is not JSON.
+			s.write(out, NewErrorResponse(nil, ParseError, "failed to read message: %v", err))
+			continue
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(buf, &msg); err != nil {
+			s.write(out, NewErrorResponse(nil, ParseError, "failed to parse message: %v", err))
+			continue
+		}
+		id, isRequest := msg["id"]
+		method, ok := msg["method"].(string)
+		if !ok {
+			_, isResult := msg["result"]
+			_, isError := msg["error"]
+			if isRequest && (isResult || isError) {
+				// Response to a request sent by the server, which is
+				// ignored unless awaited.
+				s.deliverReply(id, buf)
+				continue
+			}
+			s.write(out, NewErrorResponse(id, InvalidRequest, "message does not specify method"))
+			continue
+		}
+		if isRequest && !validId(id) {
+			// The id cannot be answered, nor used to track the request.
+			s.write(out, NewErrorResponse(nil, InvalidRequest, "request id %s is neither a number nor a string", formatId(id)))
+			continue
+		}
+		if s.verbose {
+			s.logger().Infof("received %s", buf)
+		}
+		if !isRequest {
+			// parseNotification decodes the notification into notif. Notifications are
+			// not answered, so a failure is logged to the client instead.
+			parseNotification := func(notif interface{}) bool {
+				if err := json.Unmarshal(buf, notif); err != nil {
+					s.write(out, makeLogMessage(MessageError, fmt.Sprintf("invalid %s notification: %v", method, err)))
+					return false
+				}
+				return true
+			}
+			s.mu.Lock()
+			started := s.started
+			s.mu.Unlock()
+			if !started && method != "exit" {
+				// Notifications before the initialize request are dropped
+				// as required by the protocol.
+				continue
+			}
+			switch method {
+			case "exit":
+				s.mu.Lock()
+				shutdown := s.shutdown
+				s.mu.Unlock()
+				if !shutdown {
+					return ErrNoShutdown
+				}
+				return nil
+			case "textDocument/didOpen":
+				notif := &DidOpenTextDocumentNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				doc := notif.Params.TextDocument
+				if path := DocumentPath(doc.Uri); path != "" {
+					s.overlay.Open(path, []byte(doc.Text))
+				}
+				s.scheduleDiagnostics(ctx, doc.Uri, false, resCh)
+			case "textDocument/didChange":
+				notif := &DidChangeTextDocumentNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				uri := notif.Params.TextDocument.Uri
+				if path := DocumentPath(uri); path != "" {
+					if err := s.overlay.Change(path, notif.Params.ContentChanges); err != nil {
+						// The document is out of sync, so fall back to the
+						// file on disk until it is opened again.
+						s.write(out, makeShowMessage(MessageError, fmt.Sprintf("failed to apply changes to %s: %v; analyzing the file on disk until it is opened again", path, err)))
+						s.overlay.Close(path)
+					}
+				}
+				s.scheduleDiagnostics(ctx, uri, false, resCh)
+			case "workspace/didChangeConfiguration":
+				notif := &DidChangeConfigurationNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				settings := notif.Params.Settings.Wireplus
+				if settings == nil {
+					// The settings of other tools changed.
+					continue
+				}
+				if err := s.applySettings(*settings); err != nil {
+					s.write(out, makeShowMessage(MessageError, fmt.Sprintf("invalid wireplus settings: %v", err)))
+					continue
+				}
+				// The loads were invalidated if the build changed, and
+				// the severity of the diagnostics may have changed too.
+				s.refreshDiagnostics(ctx, resCh)
+			case "workspace/didChangeWorkspaceFolders":
+				notif := &DidChangeWorkspaceFoldersNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				s.mu.Lock()
+				roots := removeRoots(s.roots, notif.Params.Event.Removed)
+				s.roots = addRoots(roots, notif.Params.Event.Added)
+				s.mu.Unlock()
+				// The index is rebuilt for the new folders; the symbols of
+				// the removed ones are no longer returned. The workspace is
+				// checked again, clearing the diagnostics of the removed
+				// folders.
+				s.indexSymbols(resCh)
+				s.checkWorkspace(resCh)
+			case "initialized":
+				s.mu.Lock()
+				s.initialized = true
+				s.mu.Unlock()
+				s.registerWatchers(resCh)
+				s.checkWorkspace(resCh)
+			case "window/workDoneProgress/cancel":
+				notif := &WorkDoneProgressCancelNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				s.workspace.mu.Lock()
+				if s.workspace.cancel != nil && s.workspace.token == notif.Params.Token {
+					s.workspace.cancel()
+				}
+				s.workspace.mu.Unlock()
+			case "$/cancelRequest":
+				notif := &CancelNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				if !validId(notif.Params.Id) {
+					s.write(out, makeLogMessage(MessageError, fmt.Sprintf("invalid $/cancelRequest notification: id %s is neither a number nor a string", formatId(notif.Params.Id))))
+					continue
+				}
+				// Requests that were already answered are not found.
+				s.mu.Lock()
+				if req := s.requests[notif.Params.Id]; req != nil {
+					req.cancel()
+				}
+				s.mu.Unlock()
+			case "workspace/didChangeWatchedFiles":
+				notif := &DidChangeWatchedFilesNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				for _, change := range notif.Params.Changes {
+					if path := DocumentPath(change.Uri); path != "" {
+						s.invalidate(path)
+					}
+				}
+				s.refreshDiagnostics(ctx, resCh)
+			case "textDocument/didSave":
+				notif := &TextDocumentNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				s.scheduleDiagnostics(ctx, notif.Params.TextDocument.Uri, true, resCh)
+			case "textDocument/didClose":
+				notif := &TextDocumentNotification{}
+				if !parseNotification(notif) {
+					continue
+				}
+				// Unsaved changes are discarded, so the diagnostics are
+				// published again for the file on disk.
+				uri := notif.Params.TextDocument.Uri
+				if path := DocumentPath(uri); path != "" {
+					s.overlay.Close(path)
+				}
+				s.scheduleDiagnostics(ctx, uri, false, resCh)
+			default:
+				// Notifications of unknown methods are ignored as required
+				// by the protocol.
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		started, shutdown := s.started, s.shutdown
+		s.mu.Unlock()
+		switch {
+		case method == "initialize" && started:
+			s.write(out, NewErrorResponse(id, InvalidRequest, "initialize received twice"))
+			continue
+		case method != "initialize" && !started:
+			s.write(out, NewErrorResponse(id, ServerNotInitialized, "%s received before initialize", method))
+			continue
+		case shutdown:
+			s.write(out, NewErrorResponse(id, InvalidRequest, "%s received after shutdown", method))
+			continue
+		}
+		// parse decodes the request into req, answering it with an error
+		// if it cannot be decoded.
+		parse := func(req interface{}) bool {
+			if err := json.Unmarshal(buf, req); err != nil {
+				s.write(out, NewErrorResponse(id, InvalidParams, "invalid %s request: %v", method, err))
+				return false
+			}
+			return true
+		}
+		// handle runs the handler of the request with the context of the
+		// request, answering it with an error if the handler panics. The
+		// request is pending until answered, and rejected if another
+		// request with the same id is.
+		handle := func(f func(ctx context.Context)) {
+			reqCtx, cancel := context.WithCancel(ctx)
+			req := &pendingRequest{method: method, cancel: cancel}
+			s.mu.Lock()
+			if s.requests[id] != nil {
+				s.mu.Unlock()
+				cancel()
+				s.write(out, NewErrorResponse(id, InvalidRequest, "request %v is already being handled", id))
+				return
+			}
+			if s.requests == nil {
+				s.requests = make(map[interface{}]*pendingRequest)
+			}
+			s.requests[id] = req
+			s.mu.Unlock()
+			s.tasks.Add(1)
+			go func() {
+				defer s.tasks.Done()
+				defer func() {
+					cancel()
+					s.send(resCh, requestDone{id: id, req: req})
+				}()
+				defer func() {
+					if r := recover(); r != nil {
+						s.send(resCh, NewErrorResponse(id, InternalError, "%s failed: %v", method, r))
+					}
+				}()
+				f(reqCtx)
+			}()
+		}
+		switch method {
+		case "initialize":
+			req := &InitializeRequest{}
+			if parse(req) {
+				// The server is started before the next message is read,
+				// so that the requests following initialize are answered.
+				s.mu.Lock()
+				s.started = true
+				s.mu.Unlock()
+				handle(func(ctx context.Context) { s.handleInitializeRequest(ctx, req, resCh) })
+			}
+		case "shutdown":
+			req := &ShutdownRequest{}
+			if parse(req) {
+				// The shutdown state is set before the next message is
+				// read, so that later requests are rejected.
+				s.mu.Lock()
+				s.shutdown = true
+				s.mu.Unlock()
+				handle(func(ctx context.Context) { s.handleShutdownRequest(req, resCh) })
+			}
+		case "textDocument/codeLens":
+			req := &CodeLensRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleCodeLensRequest(ctx, req, resCh) })
+			}
+		case "codeLens/resolve":
+			req := &CodeLensResolveRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleCodeLensResolveRequest(ctx, req, resCh) })
+			}
+		case "textDocument/signatureHelp":
+			req := &SignatureHelpRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleSignatureHelpRequest(ctx, req, resCh) })
+			}
+		case "textDocument/definition":
+			req := &DefinitionRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleDefinitionRequest(ctx, req, resCh) })
+			}
+		case "textDocument/implementation":
+			req := &ImplementationRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleImplementationRequest(ctx, req, resCh) })
+			}
+		case "textDocument/references":
+			req := &ReferenceRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleReferencesRequest(ctx, req, resCh) })
+			}
+		case "textDocument/rename":
+			req := &RenameRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleRenameRequest(ctx, req, resCh) })
+			}
+		case "textDocument/codeAction":
+			req := &CodeActionRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleCodeActionRequest(ctx, req, resCh) })
+			}
+		case "workspace/symbol":
+			req := &WorkspaceSymbolRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleWorkspaceSymbolRequest(ctx, req, resCh) })
+			}
+		case "textDocument/documentSymbol":
+			req := &DocumentSymbolRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleDocumentSymbolRequest(ctx, req, resCh) })
+			}
+		case "textDocument/foldingRange":
+			req := &FoldingRangeRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleFoldingRangeRequest(ctx, req, resCh) })
+			}
+		case "textDocument/diagnostic":
+			req := &DocumentDiagnosticRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleDocumentDiagnosticRequest(ctx, req, resCh) })
+			}
+		case "textDocument/documentLink":
+			req := &DocumentLinkRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleDocumentLinkRequest(ctx, req, resCh) })
+			}
+		case "textDocument/semanticTokens/full":
+			req := &SemanticTokensRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleSemanticTokensRequest(ctx, req, resCh) })
+			}
+		case "textDocument/inlayHint":
+			req := &InlayHintRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleInlayHintRequest(ctx, req, resCh) })
+			}
+		case "textDocument/prepareCallHierarchy":
+			req := &PrepareCallHierarchyRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handlePrepareCallHierarchyRequest(ctx, req, resCh) })
+			}
+		case "callHierarchy/incomingCalls":
+			req := &CallHierarchyCallsRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleIncomingCallsRequest(ctx, req, resCh) })
+			}
+		case "callHierarchy/outgoingCalls":
+			req := &CallHierarchyCallsRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleOutgoingCallsRequest(ctx, req, resCh) })
+			}
+		case "textDocument/hover":
+			req := &HoverRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleHoverRequest(ctx, req, resCh) })
+			}
+		case "textDocument/completion":
+			req := &CompletionRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleCompletionRequest(ctx, req, resCh) })
+			}
+		case "workspace/executeCommand":
+			req := &ExecuteCommandRequest{}
+			if parse(req) {
+				handle(func(ctx context.Context) { s.handleExecuteCommandRequest(ctx, req, resCh) })
+			}
+		default:
+			s.write(out, NewErrorResponse(id, MethodNotFound, "method not found: %s", method))
+		}
+	}
+}
+
+func (s *Server) handleInitializeRequest(ctx context.Context, req *InitializeRequest, resCh chan interface{}) {
+	res := &InitializeResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result: &InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:        2, // 2: Incremental
+				CodeLensProvider:        &CodeLensOptions{ResolveProvider: true},
+				HoverProvider:           true,
+				DefinitionProvider:      true,
+				ImplementationProvider:  true,
+				ReferencesProvider:      true,
+				RenameProvider:          true,
+				CodeActionProvider:      true,
+				WorkspaceSymbolProvider: true,
+				DocumentSymbolProvider:  true,
+				FoldingRangeProvider:    true,
+				DocumentLinkProvider:    &DocumentLinkOptions{},
+				DiagnosticProvider:      &DiagnosticOptions{InterFileDependencies: true},
+				SemanticTokensProvider: &SemanticTokensOptions{
+					Legend: SemanticTokensLegend{
+						TokenTypes:     semanticTokenTypes,
+						TokenModifiers: []string{"unused", "missing"},
+					},
+					Full: true,
+				},
+				InlayHintProvider:     true,
+				CallHierarchyProvider: true,
+				CompletionProvider: &CompletionOptions{
+					TriggerCharacters: []string{"(", ","},
+				},
+				SignatureHelpProvider: &SignatureHelpOptions{
+					TriggerCharacters:   []string{"("},
+					RetriggerCharacters: []string{","},
+				},
+				ExecuteCommandProvider: &ExecuteCommandOptions{
+					Commands: []string{"wireplus.previewDiff", "wireplus.graph", "wireplus.check", "wireplus.generate", wire.OpenLocationCommand},
+				},
+			},
+		},
+	}
+	tdClientCap := req.Params.Capabilities.TextDocument
+	s.mu.Lock()
+	s.hoverFormat = PreferredFormat(tdClientCap.Hover.ContentFormat)
+	s.completionFormat = PreferredFormat(tdClientCap.Completion.CompletionItem.DocumentationFormat)
+	s.snippetSupport = tdClientCap.Completion.CompletionItem.SnippetSupport
+	s.signatureFormat = PreferredFormat(tdClientCap.SignatureHelp.SignatureInformation.DocumentationFormat)
+	s.applyEdit = req.Params.Capabilities.Workspace.ApplyEdit
+	s.showDocument = req.Params.Capabilities.Window.ShowDocument.Support
+	s.lineFoldingOnly = tdClientCap.FoldingRange.LineFoldingOnly
+	s.pullDiagnostics = tdClientCap.Diagnostic != nil
+	s.watchFiles = req.Params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+	s.workDoneProgress = req.Params.Capabilities.Window.WorkDoneProgress
+	folders := req.Params.WorkspaceFolders
+	if len(folders) == 0 && req.Params.RootUri != "" {
+		folders = []WorkspaceFolder{{Uri: req.Params.RootUri}}
+	}
+	s.roots = addRoots(nil, folders)
+	roots := s.roots
+	s.mu.Unlock()
+	if err := s.applySettings(req.Params.InitializationOptions); err != nil {
+		s.send(resCh, makeShowMessage(MessageError, fmt.Sprintf("invalid initialization options: %v", err)))
+	}
+	if req.Params.Capabilities.Workspace.WorkspaceFolders {
+		wsServerCap := &res.Result.Capabilities.Workspace
+		wsServerCap.WorkspaceFolders.Supported = true
+		wsServerCap.WorkspaceFolders.ChangeNotifications = true
+	}
+	if len(roots) > 0 {
+		// The index is started before the response, so that the first
+		// query waits for it.
+		s.indexSymbols(resCh)
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleShutdownRequest(req *ShutdownRequest, resCh chan interface{}) {
+	res := &ShutdownResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	s.send(resCh, res)
+}
+
+// codeLensTitles are the titles of the code lenses by command. Injectors
+// get the lenses of codeLensInjector, provider sets those of codeLensSet.
+var (
+	codeLensTitles = map[string]string{
+		"wireplus.showGraph":   "Show Graph",
+		"wireplus.previewDiff": "Preview Changes",
+		"wireplus.generate":    "Generate",
+		"wireplus.showDetail":  "Show Detail",
+	}
+	codeLensInjector = []string{"wireplus.showGraph", "wireplus.previewDiff", "wireplus.generate"}
+	codeLensSet      = []string{"wireplus.showGraph", "wireplus.showDetail"}
+)
+
+// handleCodeLensRequest returns the code lenses of the injectors and
+// provider sets of the document, found from its syntax alone. Their
+// commands are left to codeLens/resolve, which loads the package.
+func (s *Server) handleCodeLensRequest(ctx context.Context, req *CodeLensRequest, resCh chan interface{}) {
+	res := &CodeLensResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	path := DocumentPath(req.Params.TextDocument.Uri)
+	if path == "" {
+		s.send(resCh, res)
+		return
+	}
+	content, err := s.overlay.ReadFile(path)
+	if err != nil {
+		s.send(resCh, res)
+		return
+	}
+	fset := token.NewFileSet()
+	// A file with syntax errors still has lenses for what parses.
+	f, _ := parser.ParseFile(fset, path, content, 0)
+	if f == nil {
+		s.send(resCh, res)
+		return
+	}
+	wd := filepath.Dir(path)
+	var codeLenses []CodeLens
+	for _, d := range wire.ScanFile(f) {
+		commands := codeLensSet
+		if d.Injector {
+			commands = codeLensInjector
+		}
+		for _, command := range commands {
+			codeLenses = append(codeLenses, makeCodeLens(fset, d.Pos, &CodeLensData{
+				Dir:     wd,
+				Name:    d.Name,
+				Command: command,
+			}))
+		}
+	}
+	res.Result = codeLenses
+	s.send(resCh, res)
+}
+
+// handleCodeLensResolveRequest sets the command of a code lens returned
+// by handleCodeLensRequest, once the package of the lens loads and
+// declares its injector or provider set. Otherwise, the command only
+// tells why it is unavailable.
+func (s *Server) handleCodeLensResolveRequest(ctx context.Context, req *CodeLensResolveRequest, resCh chan interface{}) {
+	lens := req.Params
+	res := &CodeLensResolveResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  &lens,
+	}
+	data := lens.Data
+	if data == nil || codeLensTitles[data.Command] == "" {
+		s.send(resCh, NewErrorResponse(req.Id, InvalidParams, "code lens has no wireplus command to resolve"))
+		return
+	}
+	title := codeLensTitles[data.Command]
+	snap, err := s.reload(ctx, data.Dir, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	// Serve the last good snapshot if the package fails to load.
+	ps, _ := snap.Value.(*packageSnapshot)
+	switch {
+	case ps == nil || len(ps.errs) > 0:
+		lens.Command = &Command{Title: title + " (unavailable: the package has errors)"}
+	case !declares(ps.info, data.Name):
+		lens.Command = &Command{Title: title + " (unavailable: not an injector or provider set)"}
+	default:
+		lens.Command = &Command{
+			Title:     title,
+			Command:   data.Command,
+			Arguments: []interface{}{data.Dir, data.Name},
+		}
+	}
+	s.send(resCh, res)
+}
+
+// declares reports whether info has an injector or a top-level provider
+// set named name.
+func declares(info *wire.Info, name string) bool {
+	for _, inj := range info.Injectors {
+		if inj.FuncName == name {
+			return true
+		}
+	}
+	for _, set := range info.Sets {
+		if set.VarName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func makeCodeLens(fset *token.FileSet, pos token.Pos, data *CodeLensData) CodeLens {
+	position := fset.Position(pos)
+	line := position.Line - 1
+	char := position.Column - 1
+	return CodeLens{
+		Range: Range{
+			Start: Position{
+				Line:      line,
+				Character: char,
+			},
+			End: Position{
+				Line:      line,
+				Character: char,
+			},
+		},
+		Data: data,
+	}
+}
+
+func (s *Server) handleExecuteCommandRequest(ctx context.Context, req *ExecuteCommandRequest, resCh chan interface{}) {
+	res := &ExecuteCommandResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+	}
+	switch req.Params.Command {
+	case "wireplus.previewDiff":
+		var dir, name string
+		if args := req.Params.Arguments; len(args) == 2 {
+			dir, _ = args[0].(string)
+			name, _ = args[1].(string)
+		}
+		if dir == "" || name == "" {
+			res.Error = &ResponseError{
+				Code:    InvalidParams,
+				Message: "wireplus.previewDiff requires two arguments: package directory and injector name",
+			}
+			break
+		}
+		result, err := s.previewDiff(ctx, dir, name)
+		if err != nil {
+			res.Error = &ResponseError{
+				Code:    InternalError,
+				Message: err.Error(),
+			}
+			break
+		}
+		res.Result = result
+	case "wireplus.graph":
+		var dir, name string
+		if args := req.Params.Arguments; len(args) == 2 {
+			dir, _ = args[0].(string)
+			name, _ = args[1].(string)
+		}
+		if dir == "" || name == "" {
+			res.Error = &ResponseError{
+				Code:    InvalidParams,
+				Message: "wireplus.graph requires two arguments: package directory and injector or provider set name",
+			}
+			break
+		}
+		result, err := s.graph(ctx, dir, name, resCh)
+		if err != nil {
+			res.Error = &ResponseError{
+				Code:    InternalError,
+				Message: err.Error(),
+			}
+			break
+		}
+		res.Result = result
+	case "wireplus.check":
+		var dir string
+		if args := req.Params.Arguments; len(args) == 1 {
+			dir, _ = args[0].(string)
+		}
+		if dir == "" {
+			res.Error = &ResponseError{
+				Code:    InvalidParams,
+				Message: "wireplus.check requires one argument: package directory",
+			}
+			break
+		}
+		result, err := s.check(ctx, dir, resCh)
+		if err != nil {
+			res.Error = &ResponseError{
+				Code:    InternalError,
+				Message: err.Error(),
+			}
+			break
+		}
+		res.Result = result
+	case "wireplus.generate":
+		var dir, name string
+		if args := req.Params.Arguments; len(args) == 2 {
+			dir, _ = args[0].(string)
+			name, _ = args[1].(string)
+		}
+		if dir == "" || name == "" {
+			res.Error = &ResponseError{
+				Code:    InvalidParams,
+				Message: "wireplus.generate requires two arguments: package directory and injector name",
+			}
+			break
+		}
+		// The outcome is shown to the user rather than returned, as for
+		// generation on save.
+		if msg := s.commitGenerate(ctx, dir, resCh); msg != nil {
+			s.send(resCh, msg)
+		}
+	case wire.OpenLocationCommand:
+		// The arguments are as set on the nodes of wireplus.graph.
+		var file string
+		var line, col float64
+		if args := req.Params.Arguments; len(args) == 3 {
+			file, _ = args[0].(string)
+			line, _ = args[1].(float64)
+			col, _ = args[2].(float64)
+		}
+		if file == "" || line < 1 || col < 1 {
+			res.Error = &ResponseError{
+				Code:    InvalidParams,
+				Message: "wireplus.openLocation requires three arguments: file name, line and column",
+			}
+			break
+		}
+		loc := makeFileLocation(file, int(line), int(col))
+		s.mu.Lock()
+		showDocument := s.showDocument
+		id := s.nextId
+		if showDocument {
+			s.nextId++
+		}
+		s.mu.Unlock()
+		if !showDocument {
+			// Let the client reveal the location.
+			res.Result = loc
+			break
+		}
+		s.send(resCh, &ShowDocumentRequest{
+			Jsonrpc: "2.0",
+			Id:      id,
+			Method:  "window/showDocument",
+			Params: ShowDocumentParams{
+				Uri:       loc.Uri,
+				TakeFocus: true,
+				Selection: &loc.Range,
+			},
+		})
+	default:
+		res.Error = &ResponseError{
+			Code:    InvalidParams,
+			Message: fmt.Sprintf("unknown command: %s", req.Params.Command),
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		// The command failed or was cut short, as its loads were canceled.
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	s.send(resCh, res)
+}
+
+// graph returns the cytospace graph of the injector or provider set named
+// name in the package in dir, with the contents of the open documents. The
+// package is taken from s.snapshots, and only loaded if it is not there.
+func (s *Server) graph(ctx context.Context, dir string, name string, resCh chan interface{}) (json.RawMessage, error) {
+	snap, err := s.reload(ctx, dir, resCh)
+	if err != nil {
+		return nil, err
+	}
+	if snap.State != StateFresh {
+		return nil, fmt.Errorf("graph failed: %v", snap.Errs[0])
+	}
+	ps := snap.Value.(*packageSnapshot)
+	data, _, errs := wire.GraphPackages([]*gopackages.Package{ps.pkg}, []string{"."}, name, "cytospace", false, nil, nil, wire.ClusterBySet, wire.EdgeLabelsNone)
+	// An injector with missing providers is drawn partially, the problems
+	// being reported by the diagnostics.
+	if len(errs) > 0 && data == "" {
+		return nil, fmt.Errorf("graph failed: %v", errs[0])
+	}
+	return json.RawMessage(data), nil
+}
+
+// check returns the problems of the package in dir, with the contents of
+// the open documents, as its diagnostics would publish them. Like graph, it
+// takes the package from s.snapshots.
+func (s *Server) check(ctx context.Context, dir string, resCh chan interface{}) (*CheckResult, error) {
+	diags, err := s.diagnose(ctx, dir, resCh)
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{Diagnostics: make(map[string][]Diagnostic)}
+	for path, d := range diags {
+		result.Diagnostics[DocumentUri(path)] = d
+	}
+	return result, nil
+}
+
+// diagnose returns the diagnostics of the package in dir by file, as
+// diagnosticsByPath, from its snapshot in s.snapshots: the problems of
+// the package, or the errors of its latest load if it failed.
+func (s *Server) diagnose(ctx context.Context, dir string, resCh chan interface{}) (map[string][]Diagnostic, error) {
+	snap, err := s.reload(ctx, dir, resCh)
+	if err != nil {
+		return nil, err
+	}
+	errs := snap.Errs
+	if snap.State == StateFresh {
+		errs = snap.Value.(*packageSnapshot).errs
+	}
+	s.mu.Lock()
+	severity := s.severity
+	s.mu.Unlock()
+	return diagnosticsByPath(dir, errs, severity), nil
+}
+
+// handleDocumentDiagnosticRequest returns the diagnostics of a document, as
+// runDiagnostics would publish them. The result id is a hash of the
+// diagnostics, so that the report is unchanged as long as they are.
+func (s *Server) handleDocumentDiagnosticRequest(ctx context.Context, req *DocumentDiagnosticRequest, resCh chan interface{}) {
+	res := &DocumentDiagnosticResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+	}
+	items := []Diagnostic{}
+	if path := DocumentPath(req.Params.TextDocument.Uri); path != "" {
+		diags, err := s.diagnose(ctx, filepath.Dir(path), resCh)
+		if err != nil {
+			s.send(resCh, makeCancelledResponse(req.Id, err))
+			return
+		}
+		// Errors without a file are attributed to every document.
+		items = append(append(items, diags[path]...), diags[""]...)
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		s.send(resCh, NewErrorResponse(req.Id, InternalError, "%v", err))
+		return
+	}
+	resultId := fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+	if resultId == req.Params.PreviousResultId {
+		res.Result = &UnchangedDocumentDiagnosticReport{Kind: "unchanged", ResultId: resultId}
+	} else {
+		res.Result = &FullDocumentDiagnosticReport{Kind: "full", ResultId: resultId, Items: items}
+	}
+	s.send(resCh, res)
+}
+
+// generate generates the package in dir in memory, reading the files in
+// overlay instead of those on disk.
+func (s *Server) generate(ctx context.Context, dir string, overlay map[string][]byte) (*wire.GenerateResult, error) {
+	out, errs := s.generateAll(ctx, dir, overlay)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("generate failed: %v", errs[0])
+	}
+	return out, nil
+}
+
+// generateAll is like generate, but returns all the errors.
+func (s *Server) generateAll(ctx context.Context, dir string, overlay map[string][]byte) (*wire.GenerateResult, []error) {
+	s.mu.Lock()
+	headerFile := s.settings.HeaderFile
+	s.mu.Unlock()
+	opts := new(wire.GenerateOptions)
+	if headerFile != "" {
+		var err error
+		opts.Header, err = ioutil.ReadFile(headerFile)
+		if err != nil {
+			return nil, []error{fmt.Errorf("failed to read header file %q: %v", headerFile, err)}
+		}
+	}
+	tags, env := s.buildConfig()
+	opts.Tags, opts.Overlay = tags, overlay
+	outs, errs := wire.Generate(ctx, dir, env, []string{"."}, opts)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(outs) != 1 {
+		return nil, []error{fmt.Errorf("expected exactly one package")}
+	}
+	out := outs[0]
+	if len(out.Errs) > 0 {
+		return nil, out.Errs
+	}
+	return &out, nil
+}
+
+// commitGenerate generates the package in dir and writes wire_gen.go, as
+// requested by the wireplus.generate command, and publishes the errors of
+// the generation as diagnostics. It returns the message reporting the
+// outcome, or nil if ctx is done before wire_gen.go is written. Generation
+// reads the files on disk, so it is refused while a document of the
+// package has unsaved changes.
+func (s *Server) commitGenerate(ctx context.Context, dir string, resCh chan interface{}) *ShowMessageNotification {
+	var unsaved []string
+	for _, path := range s.overlay.Unsaved() {
+		if filepath.Dir(path) == dir {
+			unsaved = append(unsaved, filepath.Base(path))
+		}
+	}
+	if len(unsaved) > 0 {
+		return makeShowMessage(MessageError, fmt.Sprintf("not generating %s: unsaved changes in %s; save them first, as wire_gen.go is generated from the files on disk",
+			dir, strings.Join(unsaved, ", ")))
+	}
+	out, errs := s.generateAll(ctx, dir, nil)
+	if ctx.Err() != nil {
+		return nil
+	}
+	s.publishDiagnostics(dir, errs, resCh)
+	if len(errs) > 0 {
+		msg := fmt.Sprintf("failed to generate %s: %v", dir, errs[0])
+		if len(errs) > 1 {
+			msg += fmt.Sprintf(" (and %d more errors)", len(errs)-1)
+		}
+		return makeShowMessage(MessageError, msg)
+	}
+	if len(out.Content) == 0 {
+		return makeShowMessage(MessageWarning, fmt.Sprintf("no injectors found in %s", dir))
+	}
+	if err := out.Commit(); err != nil {
+		return makeShowMessage(MessageError, fmt.Sprintf("failed to write %s: %v", out.OutputPath, err))
+	}
+	return makeShowMessage(MessageInfo, fmt.Sprintf("generated %s", out.OutputPath))
+}
+
+// publishDiagnostics publishes the diagnostics for errs outside of a
+// diagnostics job, on the open documents of the package in dir, unless the
+// client pulls their diagnostics, and on the files errs mention. The next
+// diagnostics job for dir clears them.
+func (s *Server) publishDiagnostics(dir string, errs []error, resCh chan interface{}) {
+	s.mu.Lock()
+	severity := s.severity
+	pull := s.pullDiagnostics
+	s.mu.Unlock()
+	diags := diagnosticsByPath(dir, errs, severity)
+	open := make(map[string]bool)
+	s.mu.Lock()
+	if job := s.jobs[dir]; job != nil {
+		for uri := range job.uris {
+			if path := DocumentPath(uri); path != "" {
+				open[path] = true
+			}
+		}
+		if job.others == nil {
+			job.others = make(map[string]bool)
+		}
+		for path := range diags {
+			if path != "" && !open[path] {
+				job.others[path] = true
+			}
+		}
+	}
+	s.mu.Unlock()
+	paths := make(map[string]bool)
+	for path := range open {
+		paths[path] = true
+	}
+	for path := range diags {
+		if path != "" {
+			paths[path] = true
+		}
+	}
+	for _, path := range sortSet(paths) {
+		if open[path] && pull {
+			// The client pulls the diagnostics of the documents.
+			continue
+		}
+		d := diags[path]
+		if open[path] {
+			// Errors without a file are attributed to every document.
+			d = append(d, diags[""]...)
+		}
+		s.send(resCh, makeDiagnostics(DocumentUri(path), d))
+	}
+}
+
+// checkWorkspace starts loading the packages of the workspace folders in
+// the background, canceling the previous check, and publishes the
+// diagnostics of their files that are not open, whose diagnostics are
+// published by runDiagnostics instead. The diagnostics published by the
+// previous check are cleared once fixed, or once their folder is removed. The progress of the check is reported on resCh,
+// and the client may cancel it.
+func (s *Server) checkWorkspace(resCh chan interface{}) {
+	s.mu.Lock()
+	roots := s.roots
+	severity := s.severity
+	s.mu.Unlock()
+	w := &s.workspace
+	w.mu.Lock()
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	if len(roots) == 0 && len(w.published) == 0 {
+		w.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.cancel = cancel
+	w.token = ""
+	w.mu.Unlock()
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		defer cancel()
+		var p *progress
+		if len(roots) > 0 {
+			p = s.beginProgress(ctx, resCh, &WorkDoneProgressBegin{
+				Kind:        "begin",
+				Title:       "wireplus: checking",
+				Message:     "loading the packages of the workspace",
+				Cancellable: true,
+			})
+		}
+		defer p.end()
+		if p != nil {
+			w.mu.Lock()
+			if ctx.Err() == nil {
+				w.token = p.token
+			}
+			w.mu.Unlock()
+		}
+		tags, env := s.buildConfig()
+		diags := make(map[string][]Diagnostic)
+		for _, root := range roots {
+			if len(roots) > 1 {
+				p.report(fmt.Sprintf("loading the packages of %s", root))
+			}
+			pkgs, errs := wire.LoadPackagesWithOverlay(ctx, root, env, tags, []string{"./..."}, s.overlay.Files())
+			if ctx.Err() != nil {
+				s.logger().Infof("canceled checking the workspace")
+				return
+			}
+			if len(errs) == 0 {
+				p.report(fmt.Sprintf("solving injectors in %s", root))
+				_, errs = wire.LoadInfo(pkgs)
+			}
+			for path, d := range diagnosticsByPath(root, errs, severity) {
+				if path != "" {
+					diags[path] = append(diags[path], d...)
+				}
+			}
+		}
+		open := s.overlay.Files()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if ctx.Err() != nil {
+			// The client or a later check canceled it.
+			return
+		}
+		paths := make(map[string]bool)
+		for path := range diags {
+			paths[path] = true
+		}
+		for path := range w.published {
+			paths[path] = true
+		}
+		w.published = make(map[string]bool)
+		for _, path := range sortSet(paths) {
+			if _, ok := open[path]; ok {
+				continue
+			}
+			if len(diags[path]) > 0 {
+				w.published[path] = true
+			}
+			s.send(resCh, makeDiagnostics(DocumentUri(path), diags[path]))
+		}
+	}()
+}
+
+// previewDiff generates the package in dir in memory, with the contents of
+// the open documents, and returns the diff of the injector named name
+// against the current wire_gen.go.
+func (s *Server) previewDiff(ctx context.Context, dir string, name string) (*PreviewDiffResult, error) {
+	out, err := s.generate(ctx, dir, s.overlay.Files())
+	if err != nil {
+		return nil, err
+	}
+	want, err := wire.InjectorSource(out.Content, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated code: %v", err)
+	}
+	if want == nil {
+		return nil, fmt.Errorf("no injector named %s found", name)
+	}
+	// Assumes the injector has not been generated yet if we can't read the
+	// current file or it does not contain the injector.
+	var cur []byte
+	if src, err := ioutil.ReadFile(out.OutputPath); err == nil {
+		cur, _ = wire.InjectorSource(src, name)
+	}
+	var a []string
+	if len(cur) > 0 {
+		a = difflib.SplitLines(string(cur))
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        a,
+		B:        difflib.SplitLines(string(want)),
+		FromFile: out.OutputPath,
+		ToFile:   out.OutputPath,
+		Context:  3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s: %v", out.OutputPath, err)
+	}
+	return &PreviewDiffResult{
+		Uri:      DocumentUri(out.OutputPath),
+		UpToDate: diff == "",
+		Diff:     diff,
+	}, nil
+}
+
+func (s *Server) handleDefinitionRequest(ctx context.Context, req *DefinitionRequest, resCh chan interface{}) {
+	res := &DefinitionResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	if sf := wire.FieldAt(pkg, pos); sf != nil && sf.Field != nil {
+		loc := makeLocation(pkg.Fset, sf.Field.Pos(), sf.Field.Pos()+token.Pos(len(sf.Field.Name())))
+		res.Result = &loc
+	} else if _, obj := wire.ObjectAt(pkg, pos); obj != nil && obj.Pkg() != nil && obj.Pos().IsValid() {
+		// Dependencies are loaded with their syntax into the same file set,
+		// so objects declared in other packages have positions too.
+		// Builtins and universe-scope identifiers have no package.
+		loc := makeLocation(pkg.Fset, obj.Pos(), obj.Pos()+token.Pos(len(obj.Name())))
+		res.Result = &loc
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleImplementationRequest(ctx context.Context, req *ImplementationRequest, resCh chan interface{}) {
+	res := &ImplementationResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	_, obj := wire.ObjectAt(ps.pkg, pos)
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		s.send(resCh, res)
+		return
+	}
+	bindings, err := s.workspaceBindings(ctx, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	// An interface leads to the providers of the types bound to it, or to
+	// the bindings if their sets provide none, and any other type to the
+	// bindings of it or of a pointer to it.
+	typ := types.TypeString(tn.Type(), nil)
+	seen := make(map[Location]bool)
+	for _, b := range bindings {
+		var loc Location
+		switch {
+		case types.IsInterface(tn.Type()) && b.iface == typ:
+			loc = b.provider
+			if loc.Uri == "" {
+				loc = b.bind
+			}
+		case !types.IsInterface(tn.Type()) && (b.provided == typ || b.provided == "*"+typ):
+			loc = b.bind
+		default:
+			continue
+		}
+		if !seen[loc] {
+			seen[loc] = true
+			res.Result = append(res.Result, loc)
+		}
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleReferencesRequest(ctx context.Context, req *ReferenceRequest, resCh chan interface{}) {
+	res := &ReferenceResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	var obj types.Object
+	if sf := wire.FieldAt(pkg, pos); sf != nil {
+		if sf.Field != nil {
+			obj = sf.Field
+		}
+	} else {
+		_, obj = wire.ObjectAt(pkg, pos)
+	}
+	if obj == nil || obj.Pkg() == nil {
+		s.send(resCh, res)
+		return
+	}
+	tags, env := s.buildConfig()
+	var refs []token.Position
+	for _, dir := range s.workspaceDirs(pkg) {
+		dirRefs, errs := wire.FindReferencesWithOverlay(ctx, dir, env, tags, obj, s.overlay.Files())
+		if err := ctx.Err(); err != nil {
+			s.send(resCh, makeCancelledResponse(req.Id, err))
+			return
+		}
+		for _, err := range errs {
+			s.logger().Errorf("failed to find references to %s: %v", obj.Name(), err)
+		}
+		refs = append(refs, dirRefs...)
+	}
+	seen := make(map[Location]bool)
+	add := func(p token.Position) {
+		loc := Location{
+			Uri: DocumentUri(p.Filename),
+			Range: Range{
+				Start: Position{Line: p.Line - 1, Character: p.Column - 1},
+				End:   Position{Line: p.Line - 1, Character: p.Column - 1 + len(obj.Name())},
+			},
+		}
+		if !seen[loc] {
+			seen[loc] = true
+			res.Result = append(res.Result, loc)
+		}
+	}
+	if req.Params.Context.IncludeDeclaration && obj.Pos().IsValid() {
+		add(pkg.Fset.Position(obj.Pos()))
+	}
+	for _, ref := range refs {
+		add(ref)
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleRenameRequest(ctx context.Context, req *RenameRequest, resCh chan interface{}) {
+	res := &RenameResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+	}
+	fail := func(format string, args ...interface{}) {
+		res.Error = &ResponseError{
+			Code:    RequestFailed,
+			Message: fmt.Sprintf(format, args...),
+		}
+		s.send(resCh, res)
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		fail("no package found for %s", req.Params.TextDocument.Uri)
+		return
+	}
+	pkg := ps.pkg
+	_, obj := wire.ObjectAt(pkg, pos)
+	if obj == nil {
+		fail("no provider set found at the position")
+		return
+	}
+	tags, env := s.buildConfig()
+	var refs []token.Position
+	for _, dir := range s.workspaceDirs(pkg) {
+		dirRefs, errs := wire.RenameProviderSet(ctx, dir, env, tags, obj, req.Params.NewName, s.overlay.Files())
+		if err := ctx.Err(); err != nil {
+			s.send(resCh, makeCancelledResponse(req.Id, err))
+			return
+		}
+		if len(errs) > 0 {
+			msgs := make([]string, len(errs))
+			for i, err := range errs {
+				msgs[i] = err.Error()
+			}
+			fail("cannot rename %s: %s", obj.Name(), strings.Join(msgs, "; "))
+			return
+		}
+		refs = append(refs, dirRefs...)
+	}
+	edit := &WorkspaceEdit{Changes: make(map[string][]TextEdit)}
+	seen := make(map[token.Position]bool)
+	for _, ref := range refs {
+		// Nested workspace folders find the same references.
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		uri := DocumentUri(ref.Filename)
+		edit.Changes[uri] = append(edit.Changes[uri], TextEdit{
+			Range: Range{
+				Start: Position{Line: ref.Line - 1, Character: ref.Column - 1},
+				End:   Position{Line: ref.Line - 1, Character: ref.Column - 1 + len(obj.Name())},
+			},
+			NewText: req.Params.NewName,
+		})
+	}
+	res.Result = edit
+	s.send(resCh, res)
+}
+
+func (s *Server) handleCodeActionRequest(ctx context.Context, req *CodeActionRequest, resCh chan interface{}) {
+	res := &CodeActionResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []CodeAction{},
+	}
+	// A stale package may not match the document, so its positions cannot
+	// be edited.
+	ps, pos, stale, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Range.Start, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil || stale {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	// matching returns the diagnostics of the request whose first line
+	// matches, which the action fixes. No action is offered without one.
+	matching := func(match func(line string) bool) []Diagnostic {
+		var diags []Diagnostic
+		for _, d := range req.Params.Context.Diagnostics {
+			if match(strings.SplitN(d.Message, "\n", 2)[0]) {
+				diags = append(diags, d)
+			}
+		}
+		return diags
+	}
+	workspaceEdit := func(edits []wire.Edit) *WorkspaceEdit {
+		edit := &WorkspaceEdit{Changes: make(map[string][]TextEdit)}
+		for _, e := range edits {
+			loc := makeLocation(pkg.Fset, e.Pos, e.End)
+			edit.Changes[loc.Uri] = append(edit.Changes[loc.Uri], TextEdit{Range: loc.Range, NewText: e.NewText})
+		}
+		return edit
+	}
+	add := func(title string, diags []Diagnostic, edits []wire.Edit) {
+		if len(diags) == 0 || !wantsKind(req.Params.Context.Only, CodeActionQuickFix) {
+			return
+		}
+		res.Result = append(res.Result, CodeAction{
+			Title:       title,
+			Kind:        CodeActionQuickFix,
+			Diagnostics: diags,
+			Edit:        workspaceEdit(edits),
+		})
+	}
+	fixes := wire.ProviderFixesAt(pkg, pos)
+	// The providers of the rest of the workspace are only looked up for
+	// a missing type, as the index may have to be built first.
+	missing := matching(func(line string) bool { return strings.Contains(line, "no provider found for ") })
+	if len(missing) > 0 && wantsKind(req.Params.Context.Only, CodeActionQuickFix) {
+		providers, err := s.workspaceProviders(ctx, resCh)
+		if err != nil {
+			s.send(resCh, makeCancelledResponse(req.Id, err))
+			return
+		}
+		fixes = append(fixes, wire.CandidateFixesAt(pkg, pos, providers)...)
+		// Keep the fixes of each type together, the nearest first.
+		sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].Type < fixes[j].Type })
+	}
+	for _, fix := range fixes {
+		title := fmt.Sprintf("Add %s to wire.Build", fix.Expr)
+		if fix.Bind != "" {
+			title = fmt.Sprintf("Add %s and %s to wire.Build", fix.Expr, fix.Bind)
+		}
+		if len(fix.Imports) > 0 {
+			imports := make([]string, len(fix.Imports))
+			for i, imp := range fix.Imports {
+				imports[i] = strconv.Quote(imp)
+			}
+			title += " and import " + strings.Join(imports, ", ")
+		}
+		diags := matching(func(line string) bool { return reportsMissing(line, fix.Type) })
+		add(title, diags, fix.Edits)
+	}
+	for _, arg := range wire.UnusedArgsAt(pkg, pos) {
+		diags := matching(func(line string) bool {
+			for _, msg := range arg.Messages {
+				if strings.HasSuffix(line, ": "+msg) {
+					return true
+				}
+			}
+			return false
+		})
+		add(fmt.Sprintf("Remove %s from wire.Build", types.ExprString(arg.Arg)), diags, []wire.Edit{arg.Edit})
+	}
+	if path := DocumentPath(req.Params.TextDocument.Uri); path != "" && wantsKind(req.Params.Context.Only, CodeActionRefactorExtract) {
+		end := CalculatePos(pkg.Fset, path, req.Params.Range.End.Line, req.Params.Range.End.Character)
+		// The selection is not a diagnostic, so the refactoring is
+		// offered whenever it covers arguments of wire.Build or
+		// wire.NewSet.
+		if x := wire.ExtractSetAt(pkg, pos, end); x != nil {
+			res.Result = append(res.Result, CodeAction{
+				Title: fmt.Sprintf("Extract %d argument(s) into %s", len(x.Args), x.Name),
+				Kind:  CodeActionRefactorExtract,
+				Edit:  workspaceEdit(x.Edits),
+			})
+		}
+	}
+	// Like organizing imports, organizing providers applies to the whole
+	// document, whatever the range.
+	if path := DocumentPath(req.Params.TextDocument.Uri); path != "" && wantsKind(req.Params.Context.Only, CodeActionSourceOrganizeProviders) {
+		if edits := wire.OrganizeProviders(pkg, path); len(edits) > 0 {
+			res.Result = append(res.Result, CodeAction{
+				Title: "Organize providers",
+				Kind:  CodeActionSourceOrganizeProviders,
+				Edit:  workspaceEdit(edits),
+			})
+		}
+	}
+	s.send(resCh, res)
+}
+
+// wantsKind reports whether a code action of kind is requested by only,
+// the kinds of a request: all kinds if only is empty, and the kinds they
+// are a prefix of otherwise, e.g. "refactor" for "refactor.extract".
+func wantsKind(only []string, kind string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, k := range only {
+		if k == kind || strings.HasPrefix(kind, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// reportsMissing reports whether line, the first line of a diagnostic, is
+// the error of an injector missing a provider for typ.
+func reportsMissing(line, typ string) bool {
+	const prefix = "no provider found for "
+	i := strings.Index(line, prefix)
+	if i < 0 || !strings.HasPrefix(line[i+len(prefix):], typ) {
+		return false
+	}
+	rest := line[i+len(prefix)+len(typ):]
+	return rest == "" || strings.HasPrefix(rest, ", ")
+}
+
+func (s *Server) handleWorkspaceSymbolRequest(ctx context.Context, req *WorkspaceSymbolRequest, resCh chan interface{}) {
+	res := &WorkspaceSymbolResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []SymbolInformation{},
+	}
+	symbols, err := s.workspaceSymbols(ctx, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	query := strings.ToLower(req.Params.Query)
+	for _, sym := range symbols {
+		if strings.Contains(strings.ToLower(sym.Name), query) {
+			res.Result = append(res.Result, sym)
+		}
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleDocumentSymbolRequest(ctx context.Context, req *DocumentSymbolRequest, resCh chan interface{}) {
+	res := &DocumentSymbolResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []DocumentSymbol{},
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, _, _, err := s.loadPackageAt(ctx, uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	for _, item := range wire.Outline(pkg, DocumentPath(uri)) {
+		res.Result = append(res.Result, makeDocumentSymbol(pkg.Fset, item))
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleFoldingRangeRequest(ctx context.Context, req *FoldingRangeRequest, resCh chan interface{}) {
+	res := &FoldingRangeResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []FoldingRange{},
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, _, _, err := s.loadPackageAt(ctx, uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	s.mu.Lock()
+	lineFoldingOnly := s.lineFoldingOnly
+	s.mu.Unlock()
+	pkg := ps.pkg
+	// add folds the arguments of the call of item and of its nested
+	// wire.NewSet calls, between the parentheses. The closing parenthesis
+	// stays visible for clients folding whole lines.
+	var add func(item *wire.OutlineItem)
+	add = func(item *wire.OutlineItem) {
+		if !item.Rparen.IsValid() {
+			return
+		}
+		r := makeLocation(pkg.Fset, item.Lparen+1, item.Rparen).Range
+		fr := FoldingRange{
+			StartLine:      r.Start.Line,
+			StartCharacter: r.Start.Character,
+			EndLine:        r.End.Line,
+			EndCharacter:   r.End.Character,
+			Kind:           "region",
+			CollapsedText:  foldedText(item.Children),
+		}
+		if lineFoldingOnly {
+			fr.EndLine--
+		}
+		if fr.EndLine > fr.StartLine {
+			res.Result = append(res.Result, fr)
+		}
+		for _, child := range item.Children {
+			add(child)
+		}
+	}
+	for _, item := range wire.Outline(pkg, DocumentPath(uri)) {
+		add(item)
+	}
+	s.send(resCh, res)
+}
+
+// handleDocumentLinkRequest links the references to provider sets of other
+// packages in the wire.NewSet and wire.Build calls of the document to their
+// declarations, see wire.SetLinks.
+func (s *Server) handleDocumentLinkRequest(ctx context.Context, req *DocumentLinkRequest, resCh chan interface{}) {
+	res := &DocumentLinkResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []DocumentLink{},
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, _, _, err := s.loadPackageAt(ctx, uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	for _, link := range wire.SetLinks(pkg, DocumentPath(uri)) {
+		res.Result = append(res.Result, DocumentLink{
+			Range:   makeLocation(pkg.Fset, link.Pos, link.End).Range,
+			Target:  fmt.Sprintf("%s#L%d,%d", DocumentUri(link.Target.Filename), link.Target.Line, link.Target.Column),
+			Tooltip: link.Target.String(),
+		})
+	}
+	s.send(resCh, res)
+}
+
+// foldedText summarizes the folded arguments of a wire.NewSet or
+// wire.Build call, e.g. "3 providers, 1 set", counting nested
+// wire.NewSet calls as sets.
+func foldedText(args []*wire.OutlineItem) string {
+	var providers, sets int
+	for _, arg := range args {
+		switch arg.Kind {
+		case wire.OutlineProvider:
+			providers++
+		case wire.OutlineImport, wire.OutlineProviderSet:
+			sets++
+		}
+	}
+	plural := func(n int, noun string) string {
+		if n == 1 {
+			return "1 " + noun
+		}
+		return fmt.Sprintf("%d %ss", n, noun)
+	}
+	return plural(providers, "provider") + ", " + plural(sets, "set")
+}
+
+// outlineSymbolKinds maps the kinds of wire.OutlineItem to symbol kinds.
+var outlineSymbolKinds = map[string]int{
+	wire.OutlineProviderSet: SymbolVariable,
+	wire.OutlineInjector:    SymbolFunction,
+	wire.OutlineProvider:    SymbolConstructor,
+	wire.OutlineImport:      SymbolModule,
+	wire.OutlineBinding:     SymbolInterface,
+	wire.OutlineValue:       SymbolConstant,
+	wire.OutlineStruct:      SymbolStruct,
+	wire.OutlineFields:      SymbolField,
+}
+
+// makeDocumentSymbol converts item and its children into a DocumentSymbol.
+// The selection range of a declaration is its name, and that of an
+// argument is the whole argument.
+func makeDocumentSymbol(fset *token.FileSet, item *wire.OutlineItem) DocumentSymbol {
+	sym := DocumentSymbol{
+		Name:   item.Name,
+		Detail: item.Detail,
+		Kind:   outlineSymbolKinds[item.Kind],
+		Range:  makeLocation(fset, item.Pos, item.End).Range,
+	}
+	if !item.NamePos.IsValid() {
+		sym.SelectionRange = sym.Range
+	} else {
+		sym.SelectionRange = makeLocation(fset, item.NamePos, item.NamePos+token.Pos(len(item.Name))).Range
+	}
+	for _, child := range item.Children {
+		sym.Children = append(sym.Children, makeDocumentSymbol(fset, child))
+	}
+	return sym
+}
+
+// semanticTokenTypes is the legend of the token types, indexed by the
+// kinds of wire.SemanticToken in semanticTokenKinds.
+var semanticTokenTypes = []string{"macro", "function", "variable", "type"}
+
+var semanticTokenKinds = map[string]int{
+	wire.TokenDirective:   0,
+	wire.TokenProvider:    1,
+	wire.TokenProviderSet: 2,
+	wire.TokenType:        3,
+}
+
+func (s *Server) handleSemanticTokensRequest(ctx context.Context, req *SemanticTokensRequest, resCh chan interface{}) {
+	res := &SemanticTokensResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  &SemanticTokens{Data: []int{}},
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, _, _, err := s.loadPackageAt(ctx, uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	var line, char int
+	for _, tok := range wire.SemanticTokens(pkg, DocumentPath(uri)) {
+		pos := pkg.Fset.Position(tok.Pos)
+		l, c := pos.Line-1, pos.Column-1
+		if l != line {
+			char = 0
+		}
+		modifiers := 0
+		if tok.Unused {
+			modifiers |= 1
+		}
+		if tok.Missing {
+			modifiers |= 2
+		}
+		res.Result.Data = append(res.Result.Data, l-line, c-char, tok.Len, semanticTokenKinds[tok.Kind], modifiers)
+		line, char = l, c
+	}
+	s.send(resCh, res)
+}
+
+// handleInlayHintRequest returns the hints of the document whose position
+// is in the requested range.
+func (s *Server) handleInlayHintRequest(ctx context.Context, req *InlayHintRequest, resCh chan interface{}) {
+	res := &InlayHintResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []InlayHint{},
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, _, _, err := s.loadPackageAt(ctx, uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg := ps.pkg
+	before := func(a, b Position) bool {
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	}
+	rng := req.Params.Range
+	for _, hint := range wire.InlayHints(pkg, DocumentPath(uri)) {
+		position := makeLocation(pkg.Fset, hint.Pos, hint.Pos).Range.Start
+		if before(position, rng.Start) || before(rng.End, position) {
+			continue
+		}
+		res.Result = append(res.Result, InlayHint{
+			Position: position,
+			Label:    hint.Label,
+			Kind:     InlayHintType,
+		})
+	}
+	s.send(resCh, res)
+}
+
+// handlePrepareCallHierarchyRequest returns the item of the injector or
+// provider at the requested position. Its calls are those of the solutions
+// of the injectors of the package of the document.
+func (s *Server) handlePrepareCallHierarchyRequest(ctx context.Context, req *PrepareCallHierarchyRequest, resCh chan interface{}) {
+	res := &PrepareCallHierarchyResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	uri := req.Params.TextDocument.Uri
+	ps, pos, _, err := s.loadPackageAt(ctx, uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	if item := wire.HierarchyItemAt(ps.pkg, pos); item != nil {
+		res.Result = []CallHierarchyItem{makeCallHierarchyItem(ps.pkg.Fset, uri, item)}
+	}
+	s.send(resCh, res)
+}
+
+// handleIncomingCallsRequest returns the items depending on the requested
+// item, which are the providers taking its output and the injector
+// returning it.
+func (s *Server) handleIncomingCallsRequest(ctx context.Context, req *CallHierarchyCallsRequest, resCh chan interface{}) {
+	res := &CallHierarchyIncomingCallsResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []CallHierarchyIncomingCall{},
+	}
+	data := req.Params.Item.Data
+	ps, _, _, err := s.loadPackageAt(ctx, data.Uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	item := &wire.HierarchyItem{Kind: data.Kind, Key: data.Key}
+	for _, dep := range wire.Dependents(ps.pkg, item) {
+		from := makeCallHierarchyItem(ps.pkg.Fset, data.Uri, dep)
+		res.Result = append(res.Result, CallHierarchyIncomingCall{
+			From:       from,
+			FromRanges: []Range{from.SelectionRange},
+		})
+	}
+	s.send(resCh, res)
+}
+
+// handleOutgoingCallsRequest returns the items the requested item depends
+// on, which are the steps producing its arguments, or the step producing
+// the output of an injector.
+func (s *Server) handleOutgoingCallsRequest(ctx context.Context, req *CallHierarchyCallsRequest, resCh chan interface{}) {
+	res := &CallHierarchyOutgoingCallsResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  []CallHierarchyOutgoingCall{},
+	}
+	data := req.Params.Item.Data
+	ps, _, _, err := s.loadPackageAt(ctx, data.Uri, Position{}, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	item := &wire.HierarchyItem{Kind: data.Kind, Key: data.Key}
+	for _, dep := range wire.Dependencies(ps.pkg, item) {
+		res.Result = append(res.Result, CallHierarchyOutgoingCall{
+			To:         makeCallHierarchyItem(ps.pkg.Fset, data.Uri, dep),
+			FromRanges: []Range{req.Params.Item.SelectionRange},
+		})
+	}
+	s.send(resCh, res)
+}
+
+// hierarchySymbolKinds maps the kinds of wire.HierarchyItem to symbol
+// kinds.
+var hierarchySymbolKinds = map[string]int{
+	wire.HierarchyInjector: SymbolFunction,
+	wire.HierarchyInput:    SymbolVariable,
+	wire.HierarchyProvider: SymbolConstructor,
+	wire.HierarchyStruct:   SymbolStruct,
+	wire.HierarchyValue:    SymbolConstant,
+	wire.HierarchyField:    SymbolField,
+}
+
+// makeCallHierarchyItem converts item, found in the package of the document
+// identified by uri, into a CallHierarchyItem. The range of a value is
+// empty, as its name is its source.
+func makeCallHierarchyItem(fset *token.FileSet, uri string, item *wire.HierarchyItem) CallHierarchyItem {
+	end := item.Pos + token.Pos(len(item.Name))
+	if item.Kind == wire.HierarchyValue {
+		end = item.Pos
+	}
+	loc := makeLocation(fset, item.Pos, end)
+	return CallHierarchyItem{
+		Name:           item.Name,
+		Kind:           hierarchySymbolKinds[item.Kind],
+		Detail:         item.Detail,
+		Uri:            loc.Uri,
+		Range:          loc.Range,
+		SelectionRange: loc.Range,
+		Data: CallHierarchyItemData{
+			Uri:  uri,
+			Kind: item.Kind,
+			Key:  item.Key,
+		},
+	}
+}
+
+// indexSymbols starts building the symbol index from the packages of the
+// workspace folders. Without any, the index is built from the packages of
+// the current directory on the first query.
+func (s *Server) indexSymbols(resCh chan interface{}) {
+	s.symbols.mu.Lock()
+	defer s.symbols.mu.Unlock()
+	s.startIndex(resCh)
+}
+
+// startIndex starts building the symbol index, reporting its progress on
+// resCh. s.symbols.mu must be held.
+func (s *Server) startIndex(resCh chan interface{}) {
+	idx := &s.symbols
+	ctx := idx.ctx
+	done := make(chan struct{})
+	idx.done = done
+	idx.stale = false
+	idx.seq++
+	seq := idx.seq
+	s.mu.Lock()
+	roots := s.roots
+	s.mu.Unlock()
+	if len(roots) == 0 {
+		roots = []string{""}
+	}
+	s.tasks.Add(1)
+	go func() {
+		defer s.tasks.Done()
+		defer close(done)
+		start := time.Now()
+		p := s.startProgress(ctx, resCh, "wireplus: indexing", "loading the packages of the workspace")
+		defer p.end()
+		tags, env := s.buildConfig()
+		n := 0
+		for _, root := range roots {
+			if len(roots) > 1 {
+				p.report(fmt.Sprintf("loading the packages of %s", root))
+			}
+			pkgs, errs := wire.LoadPackagesWithOverlay(ctx, root, env, tags, []string{"./..."}, s.overlay.Files())
+			if len(errs) > 0 {
+				// Keep the symbols of the last successful build of root.
+				for _, err := range errs {
+					s.logger().Errorf("failed to index symbols: %v", err)
+				}
+				continue
+			}
+			var symbols []SymbolInformation
+			for _, d := range wire.AllNamed(pkgs) {
+				sym := SymbolInformation{
+					Name:          d.Name,
+					Kind:          SymbolVariable,
+					Location:      makeLocation(d.Pkg.Fset, d.Pos, d.Pos+token.Pos(len(d.Name))),
+					ContainerName: d.Pkg.PkgPath,
+				}
+				if d.Injector {
+					sym.Kind = SymbolFunction
+				}
+				symbols = append(symbols, sym)
+			}
+			var bindings []indexedBinding
+			for _, b := range wire.AllBindings(pkgs) {
+				ib := indexedBinding{
+					iface:    types.TypeString(b.Iface, nil),
+					provided: types.TypeString(b.Provided, nil),
+					bind:     makeLocation(b.Pkg.Fset, b.Pos, b.End),
+				}
+				if b.Provider.IsValid() {
+					ib.provider = makeLocation(b.Pkg.Fset, b.Provider, b.Provider)
+				}
+				bindings = append(bindings, ib)
+			}
+			providers := wire.IndexProviders(pkgs)
+			n += len(symbols)
+			idx.mu.Lock()
+			if idx.symbols == nil {
+				idx.symbols = make(map[string][]SymbolInformation)
+				idx.built = make(map[string]int)
+				idx.bindings = make(map[string][]indexedBinding)
+				idx.providers = make(map[string]*wire.ProviderIndex)
+			}
+			if seq > idx.built[root] {
+				idx.symbols[root] = symbols
+				idx.bindings[root] = bindings
+				idx.providers[root] = providers
+				idx.built[root] = seq
+			}
+			idx.mu.Unlock()
+		}
+		if s.verbose {
+			s.logger().Infof("indexed %d symbols in %v", n, time.Since(start))
+		}
+	}()
+}
+
+// workspaceSymbols returns the symbols of the index, waiting for the build
+// in progress, and rebuilding it first if a document has changed. It
+// returns ctx.Err() if ctx is done first; the build goes on for the next
+// query.
+func (s *Server) workspaceSymbols(ctx context.Context, resCh chan interface{}) ([]SymbolInformation, error) {
+	roots, err := s.awaitIndex(ctx, resCh)
+	if err != nil {
+		return nil, err
+	}
+	idx := &s.symbols
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	// Nested workspace folders share symbols.
+	var symbols []SymbolInformation
+	seen := make(map[Location]bool)
+	for _, root := range roots {
+		for _, sym := range idx.symbols[root] {
+			if !seen[sym.Location] {
+				seen[sym.Location] = true
+				symbols = append(symbols, sym)
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// workspaceBindings is like workspaceSymbols, but returns the bindings
+// of the index.
+func (s *Server) workspaceBindings(ctx context.Context, resCh chan interface{}) ([]indexedBinding, error) {
+	roots, err := s.awaitIndex(ctx, resCh)
+	if err != nil {
+		return nil, err
+	}
+	idx := &s.symbols
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	var bindings []indexedBinding
+	seen := make(map[Location]bool)
+	for _, root := range roots {
+		for _, b := range idx.bindings[root] {
+			if !seen[b.bind] {
+				seen[b.bind] = true
+				bindings = append(bindings, b)
+			}
+		}
+	}
+	return bindings, nil
+}
+
+// workspaceProviders is like workspaceSymbols, but returns the provider
+// functions of the index.
+func (s *Server) workspaceProviders(ctx context.Context, resCh chan interface{}) (*wire.ProviderIndex, error) {
+	roots, err := s.awaitIndex(ctx, resCh)
+	if err != nil {
+		return nil, err
+	}
+	idx := &s.symbols
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	providers := &wire.ProviderIndex{}
+	for _, root := range roots {
+		if p := idx.providers[root]; p != nil {
+			providers.Merge(p)
+		}
+	}
+	return providers, nil
+}
+
+// awaitIndex waits for the build of the index in progress, rebuilding it
+// first if a document has changed, and returns the indexed roots. It
+// returns ctx.Err() if ctx is done first.
+func (s *Server) awaitIndex(ctx context.Context, resCh chan interface{}) ([]string, error) {
+	idx := &s.symbols
+	idx.mu.Lock()
+	if idx.done == nil || idx.stale {
+		s.startIndex(resCh)
+	}
+	done := idx.done
+	idx.mu.Unlock()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	s.mu.Lock()
+	roots := s.roots
+	s.mu.Unlock()
+	if len(roots) == 0 {
+		roots = []string{""}
+	}
+	return roots, nil
+}
+
+// workspaceDirs returns the directories in which to search for references
+// from pkg: every workspace folder, the one containing pkg first, or else
+// the root of the module of pkg, or else the directory of pkg.
+func (s *Server) workspaceDirs(pkg *gopackages.Package) []string {
+	dir := filepath.Dir(pkg.GoFiles[0])
+	s.mu.Lock()
+	roots := s.roots
+	s.mu.Unlock()
+	// The innermost folder containing pkg is searched first.
+	var dirs []string
+	for i := len(roots) - 1; i >= 0; i-- {
+		if rel, err := filepath.Rel(roots[i], dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			dirs = append(dirs, roots[i])
+			break
+		}
+	}
+	if len(dirs) == 0 {
+		if pkg.Module != nil && pkg.Module.Dir != "" {
+			dirs = append(dirs, pkg.Module.Dir)
+		} else {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, root := range roots {
+		if root != dirs[0] {
+			dirs = append(dirs, root)
+		}
+	}
+	return dirs
+}
+
+// addRoots returns roots with the paths of folders added, sorted.
+func addRoots(roots []string, folders []WorkspaceFolder) []string {
+	set := make(map[string]bool)
+	for _, root := range roots {
+		set[root] = true
+	}
+	for _, f := range folders {
+		if path := DocumentPath(f.Uri); path != "" {
+			set[filepath.Clean(path)] = true
+		}
+	}
+	return sortSet(set)
+}
+
+// removeRoots returns roots without the paths of folders.
+func removeRoots(roots []string, folders []WorkspaceFolder) []string {
+	removed := make(map[string]bool)
+	for _, f := range folders {
+		if path := DocumentPath(f.Uri); path != "" {
+			removed[filepath.Clean(path)] = true
+		}
+	}
+	var rest []string
+	for _, root := range roots {
+		if !removed[root] {
+			rest = append(rest, root)
+		}
+	}
+	return rest
+}
+
+func (s *Server) handleHoverRequest(ctx context.Context, req *HoverRequest, resCh chan interface{}) {
+	res := &HoverResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	ps, pos, stale, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	pkg, info := ps.pkg, ps.info
+	if sf := wire.FieldAt(pkg, pos); sf != nil && sf.Field != nil {
+		qualifier := types.RelativeTo(sf.Field.Pkg())
+		sig := fmt.Sprintf("field %s %s", sf.Field.Name(), types.TypeString(sf.Field.Type(), qualifier))
+		if sf.Tag != "" {
+			sig += " `" + sf.Tag + "`"
+		}
+		b := NewContentBuilder(s.format(&s.hoverFormat))
+		b.Code("go", sig)
+		b.Link("at", pkg.Fset.Position(sf.Field.Pos()))
+		if stale {
+			b.Text(staleNote)
+		}
+		rng := makeLocation(pkg.Fset, sf.Lit.Pos(), sf.Lit.End()).Range
+		res.Result = &Hover{
+			Contents: b.Content(),
+			Range:    &rng,
+		}
+	} else if v := wire.ValueAt(pkg, pos); v != nil {
+		qualifier := types.RelativeTo(pkg.Types)
+		b := NewContentBuilder(s.format(&s.hoverFormat))
+		b.Code("go", v.Source)
+		b.Text("type " + types.TypeString(v.Type, qualifier))
+		if len(v.Idents) > 0 {
+			rows := make([]TableRow, len(v.Idents))
+			for i, id := range v.Idents {
+				desc := types.TypeString(id.Obj.Type(), qualifier)
+				if id.Value != nil {
+					desc = "= " + id.Value.ExactString()
+				}
+				rows[i] = TableRow{
+					Cells: []string{id.Ident.Name, desc},
+					Pos:   pkg.Fset.Position(id.Obj.Pos()),
+				}
+			}
+			b.Table([]string{"identifier", "value or type", "defined at"}, rows)
+		}
+		if stale {
+			b.Text(staleNote)
+		}
+		rng := makeLocation(pkg.Fset, v.Expr.Pos(), v.Expr.End()).Range
+		res.Result = &Hover{
+			Contents: b.Content(),
+			Range:    &rng,
+		}
+	} else if id, fn := wire.ProviderRefAt(pkg, pos); fn != nil {
+		if p, sets := info.ProviderOf(fn); p != nil {
+			b := NewContentBuilder(s.format(&s.hoverFormat))
+			writeProviderHover(b, info, pkg.Types, fn, p, sets)
+			if stale {
+				b.Text(staleNote)
+			}
+			rng := makeLocation(pkg.Fset, id.Pos(), id.End()).Range
+			res.Result = &Hover{
+				Contents: b.Content(),
+				Range:    &rng,
+			}
+		}
+	} else if id, obj := wire.ObjectAt(pkg, pos); obj != nil {
+		var b *ContentBuilder
+		qualifier := types.RelativeTo(pkg.Types)
+		if set, key := info.SetOf(obj); set != nil {
+			b = NewContentBuilder(s.format(&s.hoverFormat))
+			b.Code("go", fmt.Sprintf("var %s %s", obj.Name(), types.TypeString(obj.Type(), qualifier)))
+			b.Link("declared at", pkg.Fset.Position(obj.Pos()))
+			writeSetHover(b, info, set, key)
+		} else if in := info.InjectorOf(obj); in != nil && in.Set != nil {
+			b = NewContentBuilder(s.format(&s.hoverFormat))
+			b.Code("go", types.ObjectString(obj, qualifier))
+			b.Link("declared at", pkg.Fset.Position(obj.Pos()))
+			key := wire.ProviderSetID{ImportPath: in.Set.PkgPath, VarName: in.Set.AnonID}
+			// Describe the calls of the solved injector, or the set passed
+			// to wire.Build if it cannot be solved or is declared in another
+			// package.
+			var d *wire.InjectorDetail
+			if obj.Pkg() == pkg.Types {
+				d = wire.DescribeInjector(pkg, obj.Name())
+			}
+			if d != nil && len(d.Steps) > 0 {
+				writeInjectorHover(b, info, in.Set, key, d)
+			} else {
+				writeSetHover(b, info, in.Set, key)
+			}
+		}
+		if b != nil {
+			if stale {
+				b.Text(staleNote)
+			}
+			rng := makeLocation(pkg.Fset, id.Pos(), id.End()).Range
+			res.Result = &Hover{
+				Contents: b.Content(),
+				Range:    &rng,
+			}
+		}
+	}
+	s.send(resCh, res)
+}
+
+// handleCompletionRequest suggests the arguments of the wire.Build or
+// wire.NewSet call at the position of req, see wire.CompletionsAt. The
+// providers and provider sets come first, and the ones providing a type the
+// call is missing say so in their documentation.
+// handleSignatureHelpRequest describes the call to a wire helper at the
+// position, such as wire.Bind, with the problems of the arguments typed so
+// far.
+func (s *Server) handleSignatureHelpRequest(ctx context.Context, req *SignatureHelpRequest, resCh chan interface{}) {
+	res := &SignatureHelpResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	sig := wire.SignatureHelpAt(ps.pkg, pos)
+	if sig == nil {
+		s.send(resCh, res)
+		return
+	}
+	b := NewContentBuilder(s.format(&s.signatureFormat))
+	b.Text(sig.Doc)
+	for _, p := range sig.Problems {
+		b.Text("Problem: " + p)
+	}
+	doc := b.Content()
+	info := SignatureInformation{
+		Label:         sig.Label,
+		Documentation: &doc,
+	}
+	for _, p := range sig.Params {
+		info.Parameters = append(info.Parameters, ParameterInformation{
+			Label:         p.Label,
+			Documentation: p.Doc,
+		})
+	}
+	res.Result = &SignatureHelp{
+		Signatures:      []SignatureInformation{info},
+		ActiveParameter: sig.Active,
+	}
+	s.send(resCh, res)
+}
+
+func (s *Server) handleCompletionRequest(ctx context.Context, req *CompletionRequest, resCh chan interface{}) {
+	res := &CompletionResponse{
+		Jsonrpc: "2.0",
+		Id:      req.Id,
+		Result:  nil,
+	}
+	s.mu.Lock()
+	snippetSupport := s.snippetSupport
+	s.mu.Unlock()
+	if path := DocumentPath(req.Params.TextDocument.Uri); path != "" && snippetSupport {
+		content, err := s.overlay.ReadFile(path)
+		if err == nil {
+			if items := snippetItems(path, content, req.Params.Position); len(items) > 0 {
+				res.Result = &CompletionList{Items: items}
+				s.send(resCh, res)
+				return
+			}
+		}
+	}
+	ps, pos, _, err := s.loadPackageAt(ctx, req.Params.TextDocument.Uri, req.Params.Position, resCh)
+	if err != nil {
+		s.send(resCh, makeCancelledResponse(req.Id, err))
+		return
+	}
+	if ps == nil {
+		s.send(resCh, res)
+		return
+	}
+	c := wire.CompletionsAt(ps.pkg, pos)
+	if c == nil {
+		s.send(resCh, res)
+		return
+	}
+	list := &CompletionList{Items: []CompletionItem{}}
+	for i, item := range c.Items {
+		kind := CompletionFunction
+		if item.Kind == wire.CompletionProviderSet {
+			kind = CompletionVariable
+		}
+		b := NewContentBuilder(s.format(&s.completionFormat))
+		if len(item.Provides) > 0 {
+			b.Text("Provides the missing " + strings.Join(item.Provides, ", "))
+		}
+		b.Link("declared at", ps.pkg.Fset.Position(item.Pos))
+		doc := b.Content()
+		list.Items = append(list.Items, CompletionItem{
+			Label:         item.Label,
+			Kind:          kind,
+			Detail:        item.Detail,
+			Documentation: &doc,
+			// Keep the order of the candidates.
+			SortText: fmt.Sprintf("%04d", i),
+		})
+	}
+	res.Result = list
+	s.send(resCh, res)
+}
+
+// writeSetHover adds the description of set identified by key to b, as
+// printed by detail: the provider sets it imports, the inputs it requires
+// and its outputs grouped by the inputs needed to create them.
+func writeSetHover(b *ContentBuilder, info *wire.Info, set *wire.ProviderSet, key wire.ProviderSetID) {
+	outGroups, imports := wire.Gather(info, set, key)
+	if len(imports) > 0 {
+		b.Text("Imports " + strings.Join(sortSet(imports), ", "))
+	}
+	if len(set.Requires) > 0 {
+		requires := make([]string, len(set.Requires))
+		for i, r := range set.Requires {
+			requires[i] = types.TypeString(r.Type, nil)
+		}
+		b.Text("Requires " + strings.Join(requires, ", "))
+	}
+	for _, g := range outGroups {
+		out := make(map[string]token.Pos, g.Outputs.Len())
+		g.Outputs.Iterate(func(t types.Type, v interface{}) {
+			switch v := v.(type) {
+			case *wire.Provider:
+				out[types.TypeString(t, nil)] = v.Pos
+			case *wire.Value:
+				out[types.TypeString(t, nil)] = v.Pos
+			case *wire.Field:
+				out[types.TypeString(t, nil)] = v.Pos
+			default:
+				panic("unreachable")
+			}
+		})
+		var rows []TableRow
+		for _, t := range sortSet(out) {
+			rows = append(rows, TableRow{
+				Cells: []string{t},
+				Pos:   info.Fset.Position(out[t]),
+			})
+		}
+		b.Table([]string{"outputs given " + g.Name, "at"}, rows)
+	}
+}
+
+// writeInjectorHover adds the description of the solved injector d to b:
+// the sets it imports and the provider calls that build its result, in
+// order, with the step or injector parameter each argument comes from.
+func writeInjectorHover(b *ContentBuilder, info *wire.Info, set *wire.ProviderSet, key wire.ProviderSetID, d *wire.InjectorDetail) {
+	_, imports := wire.Gather(info, set, key)
+	if len(imports) > 0 {
+		b.Text("Imports " + strings.Join(sortSet(imports), ", "))
+	}
+	rows := make([]TableRow, len(d.Steps))
+	for i, step := range d.Steps {
+		call := step.Kind
+		if step.Name != "" {
+			call = step.Name
+		}
+		args := make([]string, len(step.Args))
+		for j, a := range step.Args {
+			if a.Param >= 0 {
+				args[j] = fmt.Sprintf("parameter %s %s", a.Name, a.Type)
+			} else {
+				args[j] = fmt.Sprintf("step %d", a.Step+1)
+			}
+		}
+		from := strings.Join(args, ", ")
+		if from == "" {
+			from = "no arguments"
+		}
+		rows[i] = TableRow{
+			Cells: []string{fmt.Sprintf("%d. %s", i+1, call), step.Type, from},
+			Pos:   step.Position,
+		}
+	}
+	b.Table([]string{"calls", "provides", "from", "at"}, rows)
+	if len(d.UnusedInputs) > 0 {
+		b.Text("Unused inputs " + strings.Join(d.UnusedInputs, ", "))
+	}
+}
+
+// writeProviderHover adds the description of the provider function fn to
+// b: its signature, what it provides and returns, and the top-level
+// provider sets that include it.
+func writeProviderHover(b *ContentBuilder, info *wire.Info, pkg *types.Package, fn *types.Func, p *wire.Provider, sets []wire.ProviderSetID) {
+	qualifier := types.RelativeTo(pkg)
+	b.Code("go", types.ObjectString(fn, qualifier))
+	outs := make([]string, len(p.Out))
+	for i, t := range p.Out {
+		outs[i] = types.TypeString(t, qualifier)
+	}
+	desc := "Provides " + strings.Join(outs, ", ")
+	var returns []string
+	if p.HasCleanup {
+		returns = append(returns, "a cleanup function")
+	}
+	if p.HasErr {
+		returns = append(returns, "an error")
+	}
+	if p.Conditional {
+		returns = append(returns, "whether it found its output")
+	}
+	switch n := len(returns); {
+	case n == 1:
+		desc += " and returns " + returns[0]
+	case n > 1:
+		desc += " and returns " + strings.Join(returns[:n-1], ", ") + " and " + returns[n-1]
+	}
+	b.Text(desc + ".")
+	b.Link("declared at", info.Fset.Position(p.Pos))
+	if len(sets) > 0 {
+		rows := make([]TableRow, len(sets))
+		for i, id := range sets {
+			rows[i] = TableRow{
+				Cells: []string{id.String()},
+				Pos:   info.Fset.Position(info.Sets[id].Pos),
+			}
+		}
+		b.Table([]string{"included in", "at"}, rows)
+	}
+}
+
+// format returns the markup kind stored in *f, which defaults to plaintext
+// if the client has not been initialized.
+func (s *Server) format(f *string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *f == "" {
+		return PlainText
+	}
+	return *f
+}
+
+// loadPackageAt loads the package containing the document identified by uri
+// and returns its snapshot along with the position corresponding to pos. If
+// the package fails to load, it returns the last snapshot loaded
+// successfully and reports that it is stale.
+// It returns nil if no load of the package succeeded or pos is not in the
+// document, and ctx.Err() if ctx is done before the package is loaded.
+func (s *Server) loadPackageAt(ctx context.Context, uri string, pos Position, resCh chan interface{}) (*packageSnapshot, token.Pos, bool, error) {
+	path := DocumentPath(uri)
+	if path == "" {
+		return nil, token.NoPos, false, nil
+	}
+	snap, err := s.reload(ctx, filepath.Dir(path), resCh)
+	if err != nil {
+		return nil, token.NoPos, false, err
+	}
+	ps, _ := snap.Value.(*packageSnapshot)
+	if ps == nil {
+		return nil, token.NoPos, false, nil
+	}
+	p := CalculatePos(ps.pkg.Fset, path, pos.Line, pos.Character)
+	if p == token.NoPos {
+		return nil, token.NoPos, false, nil
+	}
+	return ps, p, snap.State == StateStale, nil
+}
+
+// reload loads the package in dir, with the contents of the open documents
+// in s.overlay, into s.snapshots and returns its snapshot, whose value
+// is a *packageSnapshot unless no load of the package succeeded. A failed
+// load keeps the last good snapshot, marked stale, and its errors are
+// logged when the package starts failing to load rather than on every
+// request.
+//
+// The package is only loaded again once invalidated, and concurrent
+// requests for it share a single load, which is canceled once all of them
+// are. reload returns ctx.Err() if ctx is done before the load finishes.
+// The progress of the load is reported on resCh, see startProgress.
+func (s *Server) reload(ctx context.Context, dir string, resCh chan interface{}) (Snapshot, error) {
+	start := time.Now()
+	snap, err := s.snapshots.FetchContext(ctx, s.cacheKey(dir), func(ctx context.Context) (interface{}, []error) {
+		p := s.startProgress(ctx, resCh, "wireplus: analyzing", "loading "+dir)
+		defer p.end()
+		tags, env := s.buildConfig()
+		pkgs, errs := wire.LoadPackagesWithOverlay(ctx, dir, env, tags, []string{"."}, s.overlay.Files())
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		if len(pkgs) != 1 {
+			return nil, []error{fmt.Errorf("expected exactly one package in %s", dir)}
+		}
+		p.report("solving injectors in " + dir)
+		info, errs := wire.LoadInfo(pkgs)
+		return &packageSnapshot{pkg: pkgs[0], info: info, errs: errs, dirs: packageDirs(pkgs)}, nil
+	})
+	if err != nil {
+		if s.verbose {
+			s.logger().Infof("canceled loading %s after %v", dir, time.Since(start).Round(time.Millisecond))
+		}
+		return snap, err
+	}
+	s.logger().Debug("cache", "name", "snapshots", "dir", dir, "state", snap.State, "changed", snap.Changed, "hit", snap.Cached)
+	if s.verbose {
+		if snap.Cached {
+			s.logger().Infof("cache hit: %s (%s)", dir, snap.State)
+		} else {
+			s.logger().Infof("cache miss: loaded %s in %v (%s)", dir, time.Since(start).Round(time.Millisecond), snap.State)
+		}
+	}
+	if snap.Changed {
+		// The errors are published as diagnostics by runDiagnostics, so they
+		// are only logged as warnings.
+		for _, err := range snap.Errs {
+			s.logger().Warnf("failed to load %s: %v", dir, err)
+		}
+	}
+	return snap, nil
+}
+
+// cacheKey returns the key of the package in dir in s.snapshots.
+func (s *Server) cacheKey(dir string) string {
+	tags, _ := s.buildConfig()
+	return dir + " -tags=" + tags
+}
+
+// buildConfig returns the build tags and the environment with which
+// packages are loaded: the -tags flag and the environment of the server,
+// as changed by the settings of the client.
+func (s *Server) buildConfig() (string, []string) {
+	s.mu.Lock()
+	settings := s.settings
+	s.mu.Unlock()
+	tags := s.tags
+	if settings.Tags != "" {
+		tags = settings.Tags
+	}
+	if len(settings.Env) == 0 && len(settings.BuildFlags) == 0 {
+		return tags, s.env
+	}
+	env := append([]string(nil), s.env...)
+	keys := make([]string, 0, len(settings.Env))
+	for k := range settings.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+settings.Env[k])
+	}
+	if len(settings.BuildFlags) > 0 {
+		// The last value of GOFLAGS takes precedence.
+		var goflags string
+		for _, kv := range env {
+			if strings.HasPrefix(kv, "GOFLAGS=") {
+				goflags = strings.TrimPrefix(kv, "GOFLAGS=")
+			}
+		}
+		env = append(env, "GOFLAGS="+strings.TrimSpace(goflags+" "+strings.Join(settings.BuildFlags, " ")))
+	}
+	return tags, env
+}
+
+// diagnosticSeverities maps the values of the diagnosticSeverity setting to
+// the severities of diagnostics.
+var diagnosticSeverities = map[string]int{
+	"":            SeverityError,
+	"error":       SeverityError,
+	"warning":     SeverityWarning,
+	"information": SeverityInformation,
+	"hint":        SeverityHint,
+}
+
+// applySettings replaces the settings of the client with settings, unless
+// they are invalid. If the build tags or environment change, the loads of
+// packages and the symbol index are invalidated.
+func (s *Server) applySettings(settings Settings) error {
+	severity, ok := diagnosticSeverities[settings.DiagnosticSeverity]
+	if !ok {
+		return fmt.Errorf("unknown diagnosticSeverity %q; want error, warning, information or hint", settings.DiagnosticSeverity)
+	}
+	for _, flag := range settings.BuildFlags {
+		if strings.ContainsAny(flag, " \t") {
+			return fmt.Errorf("build flag %q contains spaces, which GOFLAGS cannot hold", flag)
+		}
+	}
+	oldTags, oldEnv := s.buildConfig()
+	s.mu.Lock()
+	s.settings = settings
+	s.severity = severity
+	s.mu.Unlock()
+	tags, env := s.buildConfig()
+	if tags == oldTags && reflect.DeepEqual(env, oldEnv) {
+		return nil
+	}
+	s.symbols.mu.Lock()
+	s.symbols.stale = true
+	s.symbols.mu.Unlock()
+	s.snapshots.InvalidateFunc(func(string, Snapshot) bool { return true })
+	return nil
+}
+
+// invalidate invalidates the cached loads that may depend on the file at
+// path: those of its package, of the packages depending on it, and of
+// packages that failed to load, as the change may fix them. The symbol
+// index is rebuilt on its next query.
+func (s *Server) invalidate(path string) {
+	s.symbols.mu.Lock()
+	s.symbols.stale = true
+	s.symbols.mu.Unlock()
+	dir := filepath.Dir(path)
+	key := s.cacheKey(dir)
+	s.snapshots.InvalidateFunc(func(k string, snap Snapshot) bool {
+		if k == key || snap.State != StateFresh {
+			return true
+		}
+		ps, _ := snap.Value.(*packageSnapshot)
+		return ps != nil && ps.dirs[dir]
+	})
+}
+
+// packageDirs returns the directories of the files of pkgs and their
+// dependencies, and of the go.mod files of their modules.
+func packageDirs(pkgs []*gopackages.Package) map[string]bool {
+	dirs := make(map[string]bool)
+	gopackages.Visit(pkgs, nil, func(p *gopackages.Package) {
+		for _, f := range p.GoFiles {
+			dirs[filepath.Dir(f)] = true
+		}
+		if p.Module != nil && p.Module.GoMod != "" {
+			dirs[filepath.Dir(p.Module.GoMod)] = true
+		}
+	})
+	return dirs
+}
+
+// makeFileLocation returns the empty location at the 1-based line and
+// column of file.
+func makeFileLocation(file string, line int, col int) Location {
+	pos := Position{Line: line - 1, Character: col - 1}
+	return Location{
+		Uri:   DocumentUri(file),
+		Range: Range{Start: pos, End: pos},
+	}
+}
+
+// makeLocation converts the range between start and end into a Location.
+func makeLocation(fset *token.FileSet, start token.Pos, end token.Pos) Location {
+	startPosition := fset.Position(start)
+	endPosition := fset.Position(end)
+	return Location{
+		Uri: DocumentUri(startPosition.Filename),
+		Range: Range{
+			Start: Position{
+				Line:      startPosition.Line - 1,
+				Character: startPosition.Column - 1,
+			},
+			End: Position{
+				Line:      endPosition.Line - 1,
+				Character: endPosition.Column - 1,
+			},
+		},
+	}
+}
+
+// scheduleDiagnostics publishes diagnostics for the package containing the
+// document identified by uri once diagnosticsDelay has passed without
+// another document in the package being opened, changed, saved or closed.
+// If save is true and the generateOnSave option is set, the package is then
+// regenerated. The cached loads that may depend on the document are
+// invalidated right away, so that no request is served from them.
+func (s *Server) scheduleDiagnostics(ctx context.Context, uri string, save bool, resCh chan interface{}) {
+	path := DocumentPath(uri)
+	if path == "" {
+		return
+	}
+	s.invalidate(path)
+	dir := filepath.Dir(path)
+	s.mu.Lock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]*diagnosticsJob)
+	}
+	job := s.jobs[dir]
+	if job == nil {
+		job = &diagnosticsJob{uris: make(map[string]bool)}
+		s.jobs[dir] = job
+	}
+	job.save = job.save || save
+	job.uris[uri] = true
+	s.mu.Unlock()
+	s.diagnostics.Schedule(dir, func(seq int) {
+		s.runDiagnostics(ctx, dir, seq, resCh)
+	})
+}
+
+// refreshDiagnostics publishes diagnostics again for every package with a
+// diagnostics job once diagnosticsDelay has passed without another change,
+// as files may have changed outside the editor. Only the packages whose
+// loads were invalidated are loaded again.
+func (s *Server) refreshDiagnostics(ctx context.Context, resCh chan interface{}) {
+	for _, dir := range s.diagnostics.Keys() {
+		dir := dir
+		s.diagnostics.Schedule(dir, func(seq int) {
+			s.runDiagnostics(ctx, dir, seq, resCh)
+		})
+	}
+}
+
+// watchedFiles are the files whose changes outside the editor, e.g. by git
+// checkout, invalidate the loaded packages: the Go files, including
+// wire.go and wire_gen.go, and the module files.
+var watchedFiles = []string{"**/*.go", "**/go.mod", "**/go.sum"}
+
+// registerWatchers asks the client to send workspace/didChangeWatchedFiles
+// for watchedFiles, if it supports registering for it.
+func (s *Server) registerWatchers(resCh chan interface{}) {
+	s.mu.Lock()
+	watchFiles := s.watchFiles
+	id := s.nextId
+	if watchFiles {
+		s.nextId++
+	}
+	s.mu.Unlock()
+	if !watchFiles {
+		return
+	}
+	var watchers []FileSystemWatcher
+	for _, pattern := range watchedFiles {
+		watchers = append(watchers, FileSystemWatcher{GlobPattern: pattern})
+	}
+	s.send(resCh, &RegistrationRequest{
+		Jsonrpc: "2.0",
+		Id:      id,
+		Method:  "client/registerCapability",
+		Params: RegistrationParams{
+			Registrations: []Registration{{
+				Id:              "wireplus.watchedFiles",
+				Method:          "workspace/didChangeWatchedFiles",
+				RegisterOptions: DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+			}},
+		},
+	})
+}
+
+// deliverReply passes the error of the response buf, to the request with
+// the given id sent to the client, to the channel awaiting it, if any.
+// A pendingRequest is a request of the client that is being handled and
+// is not answered yet.
+type pendingRequest struct {
+	method string
+	// cancel cancels the context of the handler, for $/cancelRequest.
+	cancel context.CancelFunc
+}
+
+// requestDone is sent on resCh once the handler of the request with the
+// given id returns, after the messages it sent.
+type requestDone struct {
+	id  interface{}
+	req *pendingRequest
+}
+
+// answer records that the request with the given id is answered, if it is
+// pending and, unless req is nil, is req, and reports whether it was.
+func (s *Server) answer(id interface{}, req *pendingRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.requests[id]
+	if pending == nil || req != nil && pending != req {
+		return false
+	}
+	delete(s.requests, id)
+	return true
+}
+
+// responseId returns the id of res if it is a response to a request of the
+// client, which has an id but no method.
+func responseId(res interface{}) (interface{}, bool) {
+	v := reflect.Indirect(reflect.ValueOf(res))
+	if v.Kind() != reflect.Struct || v.FieldByName("Method").IsValid() {
+		return nil, false
+	}
+	id := v.FieldByName("Id")
+	if !id.IsValid() {
+		return nil, false
+	}
+	return id.Interface(), true
+}
+
+func (s *Server) deliverReply(id interface{}, buf []byte) {
+	n, ok := id.(float64)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	reply := s.replies[int(n)]
+	delete(s.replies, int(n))
+	s.mu.Unlock()
+	if reply == nil {
+		return
+	}
+	var res struct {
+		Error *ResponseError `json:"error"`
+	}
+	if err := json.Unmarshal(buf, &res); err != nil {
+		res.Error = &ResponseError{Code: ParseError, Message: err.Error()}
+	}
+	reply <- res.Error
+}
+
+// A progress reports the work done by a long analysis, such as loading a
+// package, to the client with $/progress notifications, so that it shows
+// the server is busy. The nil *progress reports nothing.
+type progress struct {
+	token string
+	resCh chan interface{}
+	// done is Server.done, on which the notifications are dropped.
+	done <-chan struct{}
+}
+
+// startProgress asks the client to create a work done progress on resCh,
+// waits for its response and begins the progress with title and message.
+// It returns nil if resCh is nil, the client does not support work done
+// progress or has not sent the initialized notification yet, it fails to
+// create the progress, or ctx is done first.
+func (s *Server) startProgress(ctx context.Context, resCh chan interface{}, title string, message string) *progress {
+	return s.beginProgress(ctx, resCh, &WorkDoneProgressBegin{Kind: "begin", Title: title, Message: message})
+}
+
+// beginProgress is like startProgress, but begins the progress with begin,
+// e.g. a cancellable one.
+func (s *Server) beginProgress(ctx context.Context, resCh chan interface{}, begin *WorkDoneProgressBegin) *progress {
+	if resCh == nil {
+		return nil
+	}
+	s.mu.Lock()
+	supported := s.workDoneProgress && s.initialized
+	id := s.nextId
+	reply := make(chan *ResponseError, 1)
+	if supported {
+		s.nextId++
+		if s.replies == nil {
+			s.replies = make(map[int]chan *ResponseError)
+		}
+		s.replies[id] = reply
+	}
+	s.mu.Unlock()
+	if !supported {
+		return nil
+	}
+	p := &progress{token: fmt.Sprintf("wireplus/%d", id), resCh: resCh, done: s.done}
+	s.send(resCh, &WorkDoneProgressCreateRequest{
+		Jsonrpc: "2.0",
+		Id:      id,
+		Method:  "window/workDoneProgress/create",
+		Params:  WorkDoneProgressCreateParams{Token: p.token},
+	})
+	select {
+	case err := <-reply:
+		if err != nil {
+			return nil
+		}
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.replies, id)
+		s.mu.Unlock()
+		return nil
+	}
+	p.send(begin)
+	return p
+}
+
+// report reports that the work goes on with message.
+func (p *progress) report(message string) {
+	if p == nil {
+		return
+	}
+	p.send(&WorkDoneProgressReport{Kind: "report", Message: message})
+}
+
+// end reports that the work is done.
+func (p *progress) end() {
+	if p == nil {
+		return
+	}
+	p.send(&WorkDoneProgressEnd{Kind: "end"})
+}
+
+func (p *progress) send(value interface{}) {
+	select {
+	case p.resCh <- &ProgressNotification{
+		Jsonrpc: "2.0",
+		Method:  "$/progress",
+		Params:  ProgressParams{Token: p.token, Value: value},
+	}:
+	case <-p.done:
+	}
+}
+
+// send sends msg on resCh to be written to the client, unless the session
+// has ended, in which case msg is dropped so that the sender does not block
+// once the writer has stopped.
+func (s *Server) send(resCh chan interface{}, msg interface{}) {
+	select {
+	case resCh <- msg:
+	case <-s.done:
+	}
+}
+
+// runDiagnostics loads the package in dir and publishes diagnostics for its
+// documents, unless a later job for dir has been scheduled in the meantime.
+func (s *Server) runDiagnostics(ctx context.Context, dir string, seq int, resCh chan interface{}) {
+	if !s.diagnostics.Latest(dir, seq) {
+		return
+	}
+	// Diagnostics are only published for the latest load: a failed load
+	// publishes its errors rather than those of the last good snapshot.
+	var info *wire.Info
+	var errs []error
+	snap, err := s.reload(ctx, dir, resCh)
+	if err != nil {
+		return
+	}
+	if snap.State == StateFresh {
+		ps := snap.Value.(*packageSnapshot)
+		info, errs = ps.info, ps.errs
+	} else {
+		errs = snap.Errs
+	}
+	s.mu.Lock()
+	severity := s.severity
+	s.mu.Unlock()
+	diags := diagnosticsByPath(dir, errs, severity)
+	if !s.diagnostics.Latest(dir, seq) {
+		// The later job publishes diagnostics for the final state.
+		return
+	}
+	s.mu.Lock()
+	job := s.jobs[dir]
+	uris := make([]string, 0, len(job.uris))
+	// The documents are matched by path, as the URIs of the client may
+	// be encoded differently than DocumentUri would.
+	open := make(map[string]bool, len(job.uris))
+	for uri := range job.uris {
+		uris = append(uris, uri)
+		open[DocumentPath(uri)] = true
+	}
+	save := job.save && s.settings.GenerateOnSave
+	pull := s.pullDiagnostics
+	job.save = false
+	prevOthers := job.others
+	job.others = make(map[string]bool)
+	var others []string
+	for path := range diags {
+		if path != "" && !open[path] {
+			job.others[path] = true
+			others = append(others, path)
+		}
+	}
+	for path := range prevOthers {
+		if !job.others[path] {
+			others = append(others, path)
+		}
+	}
+	s.mu.Unlock()
+
+	if pull {
+		// The client pulls the diagnostics of the documents.
+		uris = nil
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		path := DocumentPath(uri)
+		// Errors without a file are attributed to every document.
+		s.send(resCh, makeDiagnostics(uri, append(diags[path], diags[""]...)))
+	}
+	// Publish the diagnostics of other files, such as go.mod, and clear
+	// those published by the previous job.
+	sort.Strings(others)
+	for _, path := range others {
+		s.send(resCh, makeDiagnostics(DocumentUri(path), diags[path]))
+	}
+	if !save {
+		return
+	}
+	if len(errs) > 0 {
+		s.send(resCh, makeLogMessage(MessageLog, fmt.Sprintf("skipped generating %s: diagnostics contain errors", dir)))
+		return
+	}
+	if len(info.Injectors) == 0 {
+		return
+	}
+	s.regenerate(ctx, dir, seq, resCh)
+}
+
+// regenerate generates the package in dir and writes wire_gen.go, either
+// through the client with workspace/applyEdit so that the editor shows the
+// change immediately or directly to disk.
+func (s *Server) regenerate(ctx context.Context, dir string, seq int, resCh chan interface{}) {
+	// The package was just saved, and wire_gen.go must match the files on
+	// disk.
+	out, err := s.generate(ctx, dir, nil)
+	if err != nil {
+		s.send(resCh, makeLogMessage(MessageError, err.Error()))
+		return
+	}
+	cur, readErr := ioutil.ReadFile(out.OutputPath)
+	if readErr == nil && bytes.Equal(cur, out.Content) {
+		s.send(resCh, makeLogMessage(MessageInfo, fmt.Sprintf("%s is up to date", out.OutputPath)))
+		return
+	}
+	if !s.diagnostics.Latest(dir, seq) {
+		// The package changed while generating.
+		return
+	}
+	s.mu.Lock()
+	applyEdit := s.applyEdit
+	id := s.nextId
+	s.nextId++
+	s.mu.Unlock()
+	// A workspace edit cannot replace a file that does not exist yet.
+	if applyEdit && readErr == nil {
+		uri := DocumentUri(out.OutputPath)
+		s.send(resCh, &ApplyWorkspaceEditRequest{
+			Jsonrpc: "2.0",
+			Id:      id,
+			Method:  "workspace/applyEdit",
+			Params: ApplyWorkspaceEditParams{
+				Label: "wireplus: regenerate",
+				Edit: WorkspaceEdit{
+					Changes: map[string][]TextEdit{
+						uri: {{
+							Range:   Range{End: EndPosition(cur)},
+							NewText: string(out.Content),
+						}},
+					},
+				},
+			},
+		})
+		s.send(resCh, makeLogMessage(MessageInfo, fmt.Sprintf("regenerated %s", out.OutputPath)))
+		return
+	}
+	if err := out.Commit(); err != nil {
+		s.send(resCh, makeLogMessage(MessageError, fmt.Sprintf("failed to write %s: %v", out.OutputPath, err)))
+		return
+	}
+	s.send(resCh, makeLogMessage(MessageInfo, fmt.Sprintf("regenerated %s", out.OutputPath)))
+}
+
+// diagnosticsByPath returns the diagnostics for errs by file path. Wire
+// errors are attributed to their position. Other errors, such as those
+// loading the package in dir, are attributed to the first position they
+// mention, or to the go.mod file of the package otherwise. Errors that
+// cannot be attributed to a file are keyed by the empty path.
+//
+// Each diagnostic has the code of the category of its error, e.g.
+// "wire/no-provider", and the positions related to a wire error. Unused
+// arguments are reported as warnings, unless severity is lower, and the
+// other errors with severity.
+func diagnosticsByPath(dir string, errs []error, severity int) map[string][]Diagnostic {
+	diags := make(map[string][]Diagnostic)
+	for _, err := range errs {
+		position, msg := wire.ErrorPosition(dir, err)
+		if position.Filename == "" {
+			position = token.Position{Filename: findGoMod(dir), Line: 1, Column: 1}
+		}
+		start := positionOf(position)
+		diag := Diagnostic{
+			Range: Range{
+				Start: start,
+				End: Position{
+					Line:      start.Line + 1,
+					Character: 0,
+				},
+			},
+			Severity: severity,
+			Code:     "wire/" + wire.CategoryLoad,
+			Message:  msg,
+		}
+		if w, ok := err.(*wire.WireErr); ok {
+			diag.Code = "wire/" + w.Category()
+			if w.Category() == wire.CategoryUnused && severity < SeverityWarning {
+				diag.Severity = SeverityWarning
+			}
+			for _, r := range w.Related() {
+				if !r.Position.IsValid() {
+					continue
+				}
+				p := positionOf(r.Position)
+				diag.RelatedInformation = append(diag.RelatedInformation, DiagnosticRelatedInformation{
+					Location: Location{Uri: DocumentUri(r.Position.Filename), Range: Range{Start: p, End: p}},
+					Message:  r.Message,
+				})
+			}
+		}
+		diags[position.Filename] = append(diags[position.Filename], diag)
+	}
+	return diags
+}
+
+// positionOf converts position, whose line and column start at 1 or are
+// unknown, to an LSP position.
+func positionOf(position token.Position) Position {
+	line := position.Line - 1
+	if line < 0 {
+		line = 0
+	}
+	char := position.Column - 1
+	if char < 0 {
+		char = 0
+	}
+	return Position{Line: line, Character: char}
+}
+
+// findGoMod returns the path of the go.mod file of the module containing
+// dir, which may no longer exist, or the empty string if there is none.
+func findGoMod(dir string) string {
+	for {
+		path := filepath.Join(dir, "go.mod")
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// makeDiagnostics returns the notification publishing diags for the
+// document identified by uri.
+func makeDiagnostics(uri string, diags []Diagnostic) *PublishDiagnosticsNotification {
+	if diags == nil {
+		// Need to return an empty slice when no error exists
+		// to clear existing diagnostics
+		diags = make([]Diagnostic, 0)
+	}
+	return &PublishDiagnosticsNotification{
+		Jsonrpc: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: PublishDiagnosticsParams{
+			Uri:         uri,
+			Diagnostics: diags,
+		},
+	}
+}
+
+// makeCancelledResponse returns the response to the request with the given
+// id whose handler stopped as the request was canceled with err.
+func makeCancelledResponse(id interface{}, err error) *ErrorResponse {
+	return NewErrorResponse(id, RequestCancelled, "request canceled: %v", err)
+}
+
+// write writes res to the client over t. A failure is reported to the log
+// file only, since the client would not receive it either.
+func (s *Server) write(t Transport, res interface{}) {
+	if err := t.WriteMessage(res); err != nil && s.logFile != nil {
+		s.logFile.Errorf("%v", err)
+	}
+}
+
+// logger returns the logger of the session, or the default logger outside
+// of ServeTransport.
+func (s *Server) logger() *logging.Logger {
+	if s.log == nil {
+		return logging.Default()
+	}
+	return s.log
+}
+
+// messageType returns the type of window/logMessage notifications for the
+// messages at level.
+func messageType(level logging.Level) int {
+	switch level {
+	case logging.LevelError:
+		return MessageError
+	case logging.LevelWarn:
+		return MessageWarning
+	case logging.LevelInfo:
+		return MessageInfo
+	}
+	return MessageLog
+}
+
+// validId reports whether id, as decoded from JSON, is a number or a
+// string, the only ids of requests that the server accepts.
+func validId(id interface{}) bool {
+	switch id.(type) {
+	case float64, string:
+		return true
+	}
+	return false
+}
+
+// formatId returns id, as decoded from JSON, as JSON again.
+func formatId(id interface{}) string {
+	buf, err := json.Marshal(id)
+	if err != nil {
+		return fmt.Sprint(id)
+	}
+	return string(buf)
+}
+
+func makeLogMessage(typ int, msg string) *LogMessageNotification {
+	return &LogMessageNotification{
+		Jsonrpc: "2.0",
+		Method:  "window/logMessage",
+		Params: LogMessageParams{
+			Type:    typ,
+			Message: "wireplus: " + msg,
+		},
+	}
+}
+
+func makeShowMessage(typ int, msg string) *ShowMessageNotification {
+	return &ShowMessageNotification{
+		Jsonrpc: "2.0",
+		Method:  "window/showMessage",
+		Params: ShowMessageParams{
+			Type:    typ,
+			Message: "wireplus: " + msg,
+		},
+	}
+}
+
+// sortSet returns the keys of the map set, which are strings, sorted.
+func sortSet(set interface{}) []string {
+	rv := reflect.ValueOf(set)
+	a := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		a = append(a, k.String())
+	}
+	sort.Strings(a)
+	return a
+}
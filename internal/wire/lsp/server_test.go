@@ -0,0 +1,1838 @@
+package lsp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"github.com/taichimaeda/wireplus/internal/wire"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp"
+	"github.com/taichimaeda/wireplus/internal/wire/lsp/lsptest"
+)
+
+// startServer starts a server with serve and returns a client talking to
+// it. The error returned by Serve is sent on the returned channel.
+func startServer(t *testing.T, ctx context.Context, env []string) (*lsptest.Client, <-chan error) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	srv := lsp.NewServer(lsp.Options{Env: env, DiagnosticsDelay: 200 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, inR, outW)
+	}()
+	return lsptest.NewClient(t, outR, inW), done
+}
+
+func TestServerGenerateOnSave(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectGood = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	const injectBad = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build()
+	return 0
+}
+`
+	const staleGen = "// Code generated by Wire. DO NOT EDIT.\n\n//+build !wireinject\n\npackage main\n"
+	files := map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": injectGood,
+	}
+	root := lsptest.SetupModules(t, wireGo, files)
+	defer os.RemoveAll(root)
+	wirePath := filepath.Join(root, "app", "wire.go")
+	genPath := filepath.Join(root, "app", "wire_gen.go")
+	doc := map[string]interface{}{
+		"textDocument": map[string]string{"uri": lsp.DocumentUri(wirePath)},
+	}
+	initialize := func(c *lsptest.Client, applyEdit bool) {
+		c.Call("initialize", map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"workspace": map[string]bool{"applyEdit": applyEdit},
+			},
+			"initializationOptions": map[string]bool{"generateOnSave": true},
+		})
+		c.Notify("initialized", struct{}{})
+	}
+	exit := func(c *lsptest.Client) {
+		c.Call("shutdown", nil)
+		c.Notify("exit", nil)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("WriteToDisk", func(t *testing.T) {
+		c, _ := startServer(t, ctx, lsptest.ModuleEnv())
+		initialize(c, false)
+		// Saves in quick succession are debounced into a single run.
+		c.Notify("textDocument/didSave", doc)
+		c.Notify("textDocument/didSave", doc)
+		var diags lsp.PublishDiagnosticsParams
+		c.Expect("textDocument/publishDiagnostics", &diags)
+		if len(diags.Diagnostics) != 0 {
+			t.Fatalf("got diagnostics %+v; want none", diags.Diagnostics)
+		}
+		var logMsg lsp.LogMessageParams
+		c.Expect("window/logMessage", &logMsg)
+		if logMsg.Type != lsp.MessageInfo || !strings.Contains(logMsg.Message, "regenerated") {
+			t.Errorf("got log message %+v; want regenerated", logMsg)
+		}
+		// The next message must be the shutdown response, i.e. the second
+		// save did not trigger another run.
+		exit(c)
+		got, err := ioutil.ReadFile(genPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(got), "func injectFoo() Foo {") {
+			t.Errorf("wire_gen.go does not contain injectFoo:\n%s", got)
+		}
+	})
+	t.Run("SkipOnErrors", func(t *testing.T) {
+		if err := ioutil.WriteFile(wirePath, []byte(injectBad), 0666); err != nil {
+			t.Fatal(err)
+		}
+		defer ioutil.WriteFile(wirePath, []byte(injectGood), 0666)
+		if err := ioutil.WriteFile(genPath, []byte(staleGen), 0666); err != nil {
+			t.Fatal(err)
+		}
+		c, _ := startServer(t, ctx, lsptest.ModuleEnv())
+		initialize(c, false)
+		c.Notify("textDocument/didSave", doc)
+		var diags lsp.PublishDiagnosticsParams
+		c.Expect("textDocument/publishDiagnostics", &diags)
+		if len(diags.Diagnostics) == 0 {
+			t.Fatal("got no diagnostics; want an error")
+		}
+		var logMsg lsp.LogMessageParams
+		c.Expect("window/logMessage", &logMsg)
+		if !strings.Contains(logMsg.Message, "skipped") {
+			t.Errorf("got log message %+v; want skipped", logMsg)
+		}
+		exit(c)
+		if got, _ := ioutil.ReadFile(genPath); string(got) != staleGen {
+			t.Errorf("wire_gen.go was written:\n%s", got)
+		}
+	})
+	t.Run("ApplyEdit", func(t *testing.T) {
+		if err := ioutil.WriteFile(genPath, []byte(staleGen), 0666); err != nil {
+			t.Fatal(err)
+		}
+		c, _ := startServer(t, ctx, lsptest.ModuleEnv())
+		initialize(c, true)
+		c.Notify("textDocument/didSave", doc)
+		var diags lsp.PublishDiagnosticsParams
+		c.Expect("textDocument/publishDiagnostics", &diags)
+		var edit lsp.ApplyWorkspaceEditParams
+		c.Expect("workspace/applyEdit", &edit)
+		edits := edit.Edit.Changes[lsp.DocumentUri(genPath)]
+		if len(edits) != 1 {
+			t.Fatalf("got edits %+v; want a single edit of wire_gen.go", edit.Edit.Changes)
+		}
+		wantRange := lsp.Range{End: lsp.Position{Line: 5, Character: 0}}
+		if edits[0].Range != wantRange {
+			t.Errorf("got range %+v; want %+v", edits[0].Range, wantRange)
+		}
+		if !strings.Contains(edits[0].NewText, "func injectFoo() Foo {") {
+			t.Errorf("edit does not contain injectFoo:\n%s", edits[0].NewText)
+		}
+		var logMsg lsp.LogMessageParams
+		c.Expect("window/logMessage", &logMsg)
+		if !strings.Contains(logMsg.Message, "regenerated") {
+			t.Errorf("got log message %+v; want regenerated", logMsg)
+		}
+		exit(c)
+		// The client is responsible for applying the edit.
+		if got, _ := ioutil.ReadFile(genPath); string(got) != staleGen {
+			t.Errorf("wire_gen.go was written:\n%s", got)
+		}
+	})
+}
+
+// TestServerLoadFailure breaks go.mod in the middle of a session: the load
+// error is published on go.mod while code lenses are served from the last
+// good snapshot, until go.mod is fixed.
+func TestServerLoadFailure(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectGo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": injectGo,
+	})
+	defer os.RemoveAll(root)
+	wirePath := filepath.Join(root, "app", "wire.go")
+	modPath := filepath.Join(root, "app", "go.mod")
+	doc := map[string]interface{}{
+		"textDocument": map[string]string{"uri": lsp.DocumentUri(wirePath)},
+	}
+	// codeLenses returns the code lenses of wire.go whose commands resolve.
+	codeLenses := func(c *lsptest.Client) []lsp.CodeLens {
+		var lenses, resolved []lsp.CodeLens
+		if err := json.Unmarshal(c.Call("textDocument/codeLens", doc), &lenses); err != nil {
+			t.Fatal(err)
+		}
+		for _, lens := range lenses {
+			var r lsp.CodeLens
+			if err := json.Unmarshal(c.Call("codeLens/resolve", lens), &r); err != nil {
+				t.Fatal(err)
+			}
+			if r.Command != nil && r.Command.Command != "" {
+				resolved = append(resolved, r)
+			}
+		}
+		return resolved
+	}
+	expectDiagnostics := func(c *lsptest.Client, path string, want int) []lsp.Diagnostic {
+		t.Helper()
+		var diags lsp.PublishDiagnosticsParams
+		c.Expect("textDocument/publishDiagnostics", &diags)
+		if diags.Uri != lsp.DocumentUri(path) || len(diags.Diagnostics) != want {
+			t.Fatalf("got diagnostics %+v; want %d for %s", diags, want, path)
+		}
+		return diags.Diagnostics
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	c.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": lsp.DocumentUri(wirePath), "version": 1, "text": injectGo},
+	})
+	expectDiagnostics(c, wirePath, 0)
+	if got := len(codeLenses(c)); got != 3 {
+		t.Fatalf("got %d code lenses; want 3", got)
+	}
+
+	lsptest.WriteFiles(t, root, map[string]string{"app/go.mod": lsptest.AppMod + "requir example.com/other v1.0.0\n"})
+	c.Notify("textDocument/didSave", doc)
+	expectDiagnostics(c, wirePath, 0)
+	diags := expectDiagnostics(c, modPath, 1)
+	if diags[0].Range.Start.Line != 5 || !strings.Contains(diags[0].Message, "requir") {
+		t.Errorf("got go.mod diagnostic %+v; want unknown directive on line 5", diags[0])
+	}
+	// The last good snapshot still serves code lenses.
+	if got := len(codeLenses(c)); got != 3 {
+		t.Fatalf("got %d code lenses from stale snapshot; want 3", got)
+	}
+
+	lsptest.WriteFiles(t, root, map[string]string{"app/go.mod": lsptest.AppMod})
+	c.Notify("textDocument/didSave", doc)
+	expectDiagnostics(c, wirePath, 0)
+	// The go.mod diagnostic is cleared.
+	expectDiagnostics(c, modPath, 0)
+
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+// TestServerDidChange edits a document without saving it: the diagnostics
+// reflect the unsaved content, and match those published once the same
+// content is saved.
+func TestServerDidChange(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectGo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": injectGo,
+	})
+	defer os.RemoveAll(root)
+	wirePath := filepath.Join(root, "app", "wire.go")
+	uri := lsp.DocumentUri(wirePath)
+	expectDiagnostics := func(c *lsptest.Client) []lsp.Diagnostic {
+		t.Helper()
+		var diags lsp.PublishDiagnosticsParams
+		c.Expect("textDocument/publishDiagnostics", &diags)
+		if diags.Uri != uri {
+			t.Fatalf("got diagnostics for %s; want %s", diags.Uri, uri)
+		}
+		return diags.Diagnostics
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	c.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 1, "text": injectGo},
+	})
+	if diags := expectDiagnostics(c); len(diags) != 0 {
+		t.Fatalf("got diagnostics %+v; want none", diags)
+	}
+
+	// Remove the provider from wire.Build, in two changes.
+	c.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []lsp.TextDocumentContentChangeEvent{
+			{Range: &lsp.Range{Start: lsp.Position{Line: 7, Character: 19}, End: lsp.Position{Line: 7, Character: 22}}},
+			{Range: &lsp.Range{Start: lsp.Position{Line: 7, Character: 12}, End: lsp.Position{Line: 7, Character: 19}}},
+		},
+	})
+	changed := expectDiagnostics(c)
+	if len(changed) == 0 || !strings.Contains(changed[0].Message, "no provider found") {
+		t.Fatalf("got diagnostics %+v after didChange; want no provider found", changed)
+	}
+
+	// Closing the document discards the changes.
+	c.Notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+	})
+	if diags := expectDiagnostics(c); len(diags) != 0 {
+		t.Fatalf("got diagnostics %+v after didClose; want none", diags)
+	}
+
+	// Saving the same content publishes the same diagnostics.
+	lsptest.WriteFiles(t, root, map[string]string{"app/wire.go": strings.Replace(injectGo, "provideFoo", "", 1)})
+	c.Notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+	})
+	if saved := expectDiagnostics(c); !reflect.DeepEqual(saved, changed) {
+		t.Errorf("got diagnostics %+v after saving; want %+v as after didChange", saved, changed)
+	}
+
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerDefinition(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod":  lsptest.AppMod,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+func injectDep() *dep.Dep {
+	wire.Build(dep.NewDep)
+	return nil
+}
+`,
+		"app/dep/dep.go": `package dep
+
+type Dep struct{}
+
+func NewDep() *Dep { return new(Dep) }
+`,
+	})
+	defer os.RemoveAll(root)
+	wirePath := filepath.Join(root, "app", "wire.go")
+	depPath := filepath.Join(root, "app", "dep", "dep.go")
+	// wire.Build is declared in another module, replaced by a directory.
+	buildLine := strings.Count(string(wireGo[:bytes.Index(wireGo, []byte("\nfunc Build("))+1]), "\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	tests := []struct {
+		desc string
+		pos  lsp.Position
+		want *lsp.Location
+	}{
+		{
+			desc: "provider in another package",
+			pos:  lsp.Position{Line: 10, Character: 17},
+			want: &lsp.Location{
+				Uri: lsp.DocumentUri(depPath),
+				Range: lsp.Range{
+					Start: lsp.Position{Line: 4, Character: 5},
+					End:   lsp.Position{Line: 4, Character: 11},
+				},
+			},
+		},
+		{
+			desc: "type in another package",
+			pos:  lsp.Position{Line: 9, Character: 23},
+			want: &lsp.Location{
+				Uri: lsp.DocumentUri(depPath),
+				Range: lsp.Range{
+					Start: lsp.Position{Line: 2, Character: 5},
+					End:   lsp.Position{Line: 2, Character: 8},
+				},
+			},
+		},
+		{
+			desc: "function in another module",
+			pos:  lsp.Position{Line: 10, Character: 7},
+			want: &lsp.Location{
+				Uri: lsp.DocumentUri(filepath.Join(root, "wire", "wire.go")),
+				Range: lsp.Range{
+					Start: lsp.Position{Line: buildLine, Character: 5},
+					End:   lsp.Position{Line: buildLine, Character: 10},
+				},
+			},
+		},
+		{
+			desc: "universe-scope identifier",
+			pos:  lsp.Position{Line: 11, Character: 9},
+		},
+		{
+			desc: "no identifier",
+			pos:  lsp.Position{Line: 1, Character: 0},
+		},
+	}
+	for _, test := range tests {
+		var got *lsp.Location
+		data := c.Call("textDocument/definition", lsp.TextDocumentPositionParams{
+			TextDocument: lsp.TextDocumentIdentifier{Uri: lsp.DocumentUri(wirePath)},
+			Position:     test.pos,
+		})
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: definition = %+v; want %+v", test.desc, got, test.want)
+		}
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerDocumentLink(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod":  lsptest.AppMod,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+var localSet = wire.NewSet(dep.NewDep)
+
+func injectDep() *dep.Dep {
+	wire.Build(localSet, wire.NewSet(dep.Set))
+	return nil
+}
+
+func injectOther() *dep.Dep {
+	wire.Build(dep.Set)
+	return nil
+}
+`,
+		"app/dep/dep.go": `package dep
+
+import "github.com/google/wire"
+
+type Dep struct{}
+
+func NewDep() *Dep { return new(Dep) }
+
+var Set = wire.NewSet(NewDep)
+`,
+	})
+	defer os.RemoveAll(root)
+	wirePath := filepath.Join(root, "app", "wire.go")
+	depPath := filepath.Join(root, "app", "dep", "dep.go")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	var got []lsp.DocumentLink
+	data := c.Call("textDocument/documentLink", lsp.DocumentLinkParams{
+		TextDocument: lsp.TextDocumentIdentifier{Uri: lsp.DocumentUri(wirePath)},
+	})
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	// The provider dep.NewDep and the local set are not linked.
+	link := func(line, start, end int) lsp.DocumentLink {
+		return lsp.DocumentLink{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: line, Character: start},
+				End:   lsp.Position{Line: line, Character: end},
+			},
+			Target:  string(lsp.DocumentUri(depPath)) + "#L9,5",
+			Tooltip: depPath + ":9:5",
+		}
+	}
+	want := []lsp.DocumentLink{link(12, 34, 41), link(17, 12, 19)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("document links = %+v; want %+v", got, want)
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerPullDiagnostics(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const broken = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+type Foo struct{}
+
+func injectFoo() *Foo {
+	wire.Build()
+	return nil
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod":  lsptest.AppMod,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"app/wire.go": broken,
+	})
+	defer os.RemoveAll(root)
+	uri := lsp.DocumentUri(filepath.Join(root, "app", "wire.go"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	var init lsp.InitializeResult
+	data := c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{
+		"textDocument": map[string]interface{}{"diagnostic": map[string]interface{}{}},
+	}})
+	if err := json.Unmarshal(data, &init); err != nil {
+		t.Fatal(err)
+	}
+	if p := init.Capabilities.DiagnosticProvider; p == nil || !p.InterFileDependencies {
+		t.Errorf("diagnosticProvider = %+v; want interFileDependencies", p)
+	}
+	c.Notify("initialized", struct{}{})
+	c.Notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "go", "version": 1, "text": broken},
+	})
+
+	// pull returns the report for the document, decoding the items of a
+	// full report.
+	pull := func(previous string) (kind, resultId string, items []lsp.Diagnostic) {
+		t.Helper()
+		var report struct {
+			Kind     string           `json:"kind"`
+			ResultId string           `json:"resultId"`
+			Items    []lsp.Diagnostic `json:"items"`
+		}
+		data := c.Call("textDocument/diagnostic", lsp.DocumentDiagnosticParams{
+			TextDocument:     lsp.TextDocumentIdentifier{Uri: uri},
+			PreviousResultId: previous,
+		})
+		if err := json.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+		return report.Kind, report.ResultId, report.Items
+	}
+	kind, first, items := pull("")
+	if kind != "full" || first == "" || len(items) != 1 || items[0].Code != "wire/no-provider" {
+		t.Fatalf("first report = %s %q %+v; want a full report of the missing provider", kind, first, items)
+	}
+	if kind, id, _ := pull(first); kind != "unchanged" || id != first {
+		t.Errorf("report after %q = %s %q; want unchanged", first, kind, id)
+	}
+	// The diagnostics are not published as well: the next message of the
+	// server is the one of the command, past the diagnostics delay.
+	time.Sleep(500 * time.Millisecond)
+	c.Call("workspace/executeCommand", lsp.ExecuteCommandParams{
+		Command:   "wireplus.generate",
+		Arguments: []interface{}{filepath.Join(root, "app"), "injectFoo"},
+	})
+	if msg := c.Next(); msg.Method != "window/showMessage" {
+		t.Errorf("got %s; want window/showMessage", msg.Raw)
+	}
+
+	fixed := strings.Replace(broken, "wire.Build()", "wire.Build(wire.Struct(new(Foo)))", 1)
+	c.Notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+		"contentChanges": []interface{}{map[string]interface{}{"text": fixed}},
+	})
+	kind, id, items := pull(first)
+	if kind != "full" || id == first || len(items) != 0 {
+		t.Errorf("report after the fix = %s %q %+v; want a full report without items", kind, id, items)
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerReferences(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod":  lsptest.AppMod,
+		"app/main.go": "package main\n\nfunc main() {}\n",
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+func injectDep() *dep.Dep {
+	wire.Build(dep.NewDep)
+	return nil
+}
+`,
+		"app/dep/dep.go": `package dep
+
+import "github.com/google/wire"
+
+type Dep struct{}
+
+func NewDep() *Dep { return new(Dep) }
+
+var Set = wire.NewSet(NewDep)
+
+type Opts struct{ Name string }
+
+var OptsSet = wire.NewSet(wire.Struct(new(Opts), "Name"))
+`,
+		"app/other/other.go": `package other
+
+import (
+	"example.com/app/dep"
+	"github.com/google/wire"
+)
+
+var Set = wire.NewSet(dep.NewDep)
+
+func newDep() *dep.Dep { return dep.NewDep() }
+`,
+	})
+	defer os.RemoveAll(root)
+	depURI := lsp.DocumentUri(filepath.Join(root, "app", "dep", "dep.go"))
+	loc := func(uri string, line, char int) lsp.Location {
+		return lsp.Location{
+			Uri: uri,
+			Range: lsp.Range{
+				Start: lsp.Position{Line: line, Character: char},
+				End:   lsp.Position{Line: line, Character: char + len("NewDep")},
+			},
+		}
+	}
+	refs := []lsp.Location{
+		loc(lsp.DocumentUri(filepath.Join(root, "app", "dep", "dep.go")), 8, 22),
+		loc(lsp.DocumentUri(filepath.Join(root, "app", "other", "other.go")), 7, 26),
+		loc(lsp.DocumentUri(filepath.Join(root, "app", "wire.go")), 10, 16),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	tests := []struct {
+		desc string
+		// uri is the document of pos, dep.go if empty.
+		uri                string
+		pos                lsp.Position
+		includeDeclaration bool
+		want               []lsp.Location
+	}{
+		{
+			desc: "provider",
+			pos:  lsp.Position{Line: 6, Character: 6},
+			want: refs,
+		},
+		{
+			desc:               "provider with its declaration",
+			pos:                lsp.Position{Line: 6, Character: 6},
+			includeDeclaration: true,
+			want:               append([]lsp.Location{loc(depURI, 6, 5)}, refs...),
+		},
+		{
+			desc:               "reference",
+			pos:                lsp.Position{Line: 8, Character: 24},
+			includeDeclaration: true,
+			want:               append([]lsp.Location{loc(depURI, 6, 5)}, refs...),
+		},
+		{
+			// The provider sets and injectors including the provider are
+			// found from any of them, here the injector in another package.
+			desc:               "reference in wire.Build",
+			uri:                lsp.DocumentUri(filepath.Join(root, "app", "wire.go")),
+			pos:                lsp.Position{Line: 10, Character: 18},
+			includeDeclaration: true,
+			want:               append([]lsp.Location{loc(depURI, 6, 5)}, refs...),
+		},
+		{
+			desc:               "struct field",
+			pos:                lsp.Position{Line: 12, Character: 51},
+			includeDeclaration: true,
+			want: []lsp.Location{
+				{Uri: depURI, Range: lsp.Range{Start: lsp.Position{Line: 10, Character: 18}, End: lsp.Position{Line: 10, Character: 22}}},
+				{Uri: depURI, Range: lsp.Range{Start: lsp.Position{Line: 12, Character: 50}, End: lsp.Position{Line: 12, Character: 54}}},
+			},
+		},
+		{
+			desc: "no identifier",
+			pos:  lsp.Position{Line: 1, Character: 0},
+		},
+	}
+	for _, test := range tests {
+		uri := test.uri
+		if uri == "" {
+			uri = depURI
+		}
+		var got []lsp.Location
+		data := c.Call("textDocument/references", lsp.ReferenceParams{
+			TextDocument: lsp.TextDocumentIdentifier{Uri: uri},
+			Position:     test.pos,
+			Context:      lsp.ReferenceContext{IncludeDeclaration: test.includeDeclaration},
+		})
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: references = %+v; want %+v", test.desc, got, test.want)
+		}
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerOpenLocation(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`,
+	})
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "app")
+	// provideFoo is declared on line 5, column 6 of foo.go.
+	want := lsp.Location{
+		Uri: lsp.DocumentUri(filepath.Join(dir, "foo.go")),
+		Range: lsp.Range{
+			Start: lsp.Position{Line: 4, Character: 5},
+			End:   lsp.Position{Line: 4, Character: 5},
+		},
+	}
+	// nodeCommand requests the graph of injectFoo and returns the command of
+	// the node of provideFoo.
+	nodeCommand := func(t *testing.T, c *lsptest.Client) *wire.CytospaceCommand {
+		t.Helper()
+		var elems wire.CytospaceElements
+		data := c.Call("workspace/executeCommand", lsp.ExecuteCommandParams{
+			Command:   "wireplus.graph",
+			Arguments: []interface{}{dir, "injectFoo"},
+		})
+		if err := json.Unmarshal(data, &elems); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range elems.Nodes {
+			if strings.Contains(n.Data.Content, "provideFoo") {
+				if n.Data.Command == nil || n.Data.Command.Command != wire.OpenLocationCommand {
+					t.Fatalf("node %s has command %+v; want %s", n.Data.Id, n.Data.Command, wire.OpenLocationCommand)
+				}
+				return n.Data.Command
+			}
+		}
+		t.Fatalf("graph %s has no node for provideFoo", data)
+		return nil
+	}
+	run := func(t *testing.T, capabilities map[string]interface{}, check func(c *lsptest.Client, result json.RawMessage)) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		c, done := startServer(t, ctx, lsptest.ModuleEnv())
+		c.Call("initialize", map[string]interface{}{"capabilities": capabilities})
+		c.Notify("initialized", struct{}{})
+		command := nodeCommand(t, c)
+		check(c, c.Call("workspace/executeCommand", lsp.ExecuteCommandParams{
+			Command:   command.Command,
+			Arguments: command.Arguments,
+		}))
+		c.Call("shutdown", nil)
+		c.Notify("exit", nil)
+		if err := <-done; err != nil {
+			t.Errorf("server exited with %v; want nil", err)
+		}
+	}
+
+	t.Run("Result", func(t *testing.T) {
+		run(t, map[string]interface{}{}, func(c *lsptest.Client, result json.RawMessage) {
+			var got lsp.Location
+			if err := json.Unmarshal(result, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("wireplus.openLocation returned %+v; want %+v", got, want)
+			}
+		})
+	})
+	t.Run("ShowDocument", func(t *testing.T) {
+		capabilities := map[string]interface{}{
+			"window": map[string]interface{}{
+				"showDocument": map[string]interface{}{"support": true},
+			},
+		}
+		run(t, capabilities, func(c *lsptest.Client, result json.RawMessage) {
+			if string(result) != "" && string(result) != "null" {
+				t.Errorf("wireplus.openLocation returned %s; want null when the server shows the document", result)
+			}
+			var params lsp.ShowDocumentParams
+			c.Expect("window/showDocument", &params)
+			if params.Uri != want.Uri || params.Selection == nil || *params.Selection != want.Range || !params.TakeFocus {
+				t.Errorf("window/showDocument params = %+v; want %s at %+v with focus", params, want.Uri, want.Range)
+			}
+		})
+	})
+}
+
+func TestServerGenerateCommand(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectBad = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build()
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`,
+	})
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "app")
+	genPath := filepath.Join(dir, "wire_gen.go")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	c.Notify("initialized", struct{}{})
+	generate := func() {
+		c.Call("workspace/executeCommand", lsp.ExecuteCommandParams{
+			Command:   "wireplus.generate",
+			Arguments: []interface{}{dir, "injectFoo"},
+		})
+	}
+
+	// No document is open and there are no errors, so no diagnostics are
+	// published.
+	generate()
+	var msg lsp.ShowMessageParams
+	c.Expect("window/showMessage", &msg)
+	if msg.Type != lsp.MessageInfo || msg.Message != "wireplus: generated "+genPath {
+		t.Errorf("got message %+v; want generated", msg)
+	}
+	gen, err := ioutil.ReadFile(genPath)
+	if err != nil || !strings.Contains(string(gen), "provideFoo()") {
+		t.Fatalf("wire_gen.go was not generated: %v\n%s", err, gen)
+	}
+
+	// Errors are published on the file they are about, and wire_gen.go is
+	// left unchanged.
+	lsptest.WriteFiles(t, root, map[string]string{"app/wire.go": injectBad})
+	generate()
+	var diags lsp.PublishDiagnosticsParams
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != lsp.DocumentUri(filepath.Join(dir, "wire.go")) || len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Range.Start.Line != 6 ||
+		!strings.Contains(diags.Diagnostics[0].Message, "no provider found for example.com/app.Foo") {
+		t.Errorf("got diagnostics %+v; want no provider found for Foo on line 7 of wire.go", diags)
+	}
+	c.Expect("window/showMessage", &msg)
+	if msg.Type != lsp.MessageError || !strings.Contains(msg.Message, "failed to generate") {
+		t.Errorf("got message %+v; want failed to generate", msg)
+	}
+	if got, err := ioutil.ReadFile(genPath); err != nil || !bytes.Equal(got, gen) {
+		t.Errorf("wire_gen.go changed after a failed generation:\n%s", got)
+	}
+
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerWatchedFiles(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectFoo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": injectFoo,
+	})
+	defer os.RemoveAll(root)
+	wireURI := lsp.DocumentUri(filepath.Join(root, "app", "wire.go"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{
+		"workspace": map[string]interface{}{
+			"didChangeWatchedFiles": map[string]interface{}{"dynamicRegistration": true},
+		},
+	}})
+	c.Notify("initialized", struct{}{})
+	var reg lsp.RegistrationParams
+	c.Expect("client/registerCapability", &reg)
+	if len(reg.Registrations) != 1 || reg.Registrations[0].Method != "workspace/didChangeWatchedFiles" {
+		t.Fatalf("got registrations %+v; want workspace/didChangeWatchedFiles", reg)
+	}
+
+	c.Notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": wireURI, "languageId": "go", "version": 1, "text": injectFoo,
+	}})
+	var diags lsp.PublishDiagnosticsParams
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != wireURI || len(diags.Diagnostics) != 0 {
+		t.Errorf("got diagnostics %+v; want none on wire.go", diags)
+	}
+
+	// A change of a file that is not open, e.g. by git checkout, refreshes
+	// the diagnostics of the open documents depending on it.
+	lsptest.WriteFiles(t, root, map[string]string{"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo(s string) Foo { return Foo(len(s)) }
+
+func main() {}
+`})
+	c.Notify("workspace/didChangeWatchedFiles", map[string]interface{}{"changes": []interface{}{
+		map[string]interface{}{"uri": lsp.DocumentUri(filepath.Join(root, "app", "foo.go")), "type": lsp.FileChanged},
+	}})
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != wireURI || len(diags.Diagnostics) != 1 || !strings.Contains(diags.Diagnostics[0].Message, "no provider found for string") {
+		t.Errorf("got diagnostics %+v; want no provider found for string on wire.go", diags)
+	}
+
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerProgress(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectFoo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`,
+		"app/wire.go": injectFoo,
+	})
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "app")
+	wireURI := lsp.DocumentUri(filepath.Join(dir, "wire.go"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{
+		"window": map[string]interface{}{"workDoneProgress": true},
+	}})
+	c.Notify("initialized", struct{}{})
+
+	// Loading the package for the diagnostics of the opened document is
+	// reported once the client has created the progress.
+	c.Notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": wireURI, "languageId": "go", "version": 1, "text": injectFoo,
+	}})
+	create := c.Next()
+	var params lsp.WorkDoneProgressCreateParams
+	if create.Method != "window/workDoneProgress/create" || json.Unmarshal(create.Params, &params) != nil || params.Token == "" {
+		t.Fatalf("got %s; want window/workDoneProgress/create", create.Raw)
+	}
+	c.Reply(create, nil)
+	var kinds, messages []string
+	for len(kinds) == 0 || kinds[len(kinds)-1] != "end" {
+		var progress struct {
+			Token string
+			Value struct {
+				Kind    string
+				Title   string
+				Message string
+			}
+		}
+		c.Expect("$/progress", &progress)
+		if progress.Token != params.Token {
+			t.Fatalf("got progress %+v; want token %q", progress, params.Token)
+		}
+		kinds = append(kinds, progress.Value.Kind)
+		messages = append(messages, progress.Value.Message)
+	}
+	if want := []string{"begin", "report", "end"}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got progress %q; want %q", kinds, want)
+	}
+	if want := []string{"loading " + dir, "solving injectors in " + dir, ""}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("got progress messages %q; want %q", messages, want)
+	}
+	var diags lsp.PublishDiagnosticsParams
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != wireURI || len(diags.Diagnostics) != 0 {
+		t.Errorf("got diagnostics %+v; want none on wire.go", diags)
+	}
+
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerConfiguration(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const injectFoo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo.go": `package main
+
+type Foo int
+
+func main() {}
+`,
+		// The provider is only built with the extra tag.
+		"app/extra.go": `//+build extra
+
+package main
+
+func provideFoo() Foo { return 42 }
+`,
+		"app/wire.go": injectFoo,
+	})
+	defer os.RemoveAll(root)
+	wireURI := lsp.DocumentUri(filepath.Join(root, "app", "wire.go"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{
+		"capabilities":          map[string]interface{}{},
+		"initializationOptions": map[string]interface{}{"diagnosticSeverity": "warning"},
+	})
+	c.Notify("initialized", struct{}{})
+	c.Notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+		"uri": wireURI, "languageId": "go", "version": 1, "text": injectFoo,
+	}})
+	var diags lsp.PublishDiagnosticsParams
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != wireURI || len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Severity != lsp.SeverityWarning {
+		t.Errorf("got diagnostics %+v; want a warning on wire.go", diags)
+	}
+
+	// Changing the build tags loads the package again.
+	c.Notify("workspace/didChangeConfiguration", map[string]interface{}{"settings": map[string]interface{}{
+		"wireplus": map[string]interface{}{"tags": "extra"},
+	}})
+	c.Expect("textDocument/publishDiagnostics", &diags)
+	if diags.Uri != wireURI || len(diags.Diagnostics) != 0 {
+		t.Errorf("got diagnostics %+v; want none on wire.go with the extra tag", diags)
+	}
+
+	// Invalid settings are reported and not applied.
+	c.Notify("workspace/didChangeConfiguration", map[string]interface{}{"settings": map[string]interface{}{
+		"wireplus": map[string]interface{}{"diagnosticSeverity": "fatal"},
+	}})
+	var msg lsp.ShowMessageParams
+	c.Expect("window/showMessage", &msg)
+	if msg.Type != lsp.MessageError || !strings.Contains(msg.Message, `unknown diagnosticSeverity "fatal"`) {
+		t.Errorf("got message %+v; want an error for the unknown severity", msg)
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+// TestServerWorkspaceFolders checks that the workspace symbols span every
+// workspace folder, as added and removed by the client.
+func TestServerWorkspaceFolders(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, name := range []string{"one", "two"} {
+		files[name+"/go.mod"] = `module example.com/` + name + `
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
+`
+		files[name+"/set.go"] = `package ` + name + `
+
+import "github.com/google/wire"
+
+type Foo int
+
+func provideFoo() Foo { return 0 }
+
+var ` + strings.Title(name) + `Set = wire.NewSet(provideFoo)
+`
+	}
+	root := lsptest.SetupModules(t, wireGo, files)
+	defer os.RemoveAll(root)
+	folder := func(name string) map[string]string {
+		return map[string]string{"uri": lsp.DocumentUri(filepath.Join(root, name)), "name": name}
+	}
+	symbols := func(c *lsptest.Client) []string {
+		t.Helper()
+		var syms []lsp.SymbolInformation
+		if err := json.Unmarshal(c.Call("workspace/symbol", map[string]string{"query": ""}), &syms); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, sym := range syms {
+			names = append(names, sym.Name)
+		}
+		return names
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	var init lsp.InitializeResult
+	if err := json.Unmarshal(c.Call("initialize", map[string]interface{}{
+		"capabilities":     map[string]interface{}{"workspace": map[string]bool{"workspaceFolders": true}},
+		"workspaceFolders": []interface{}{folder("one")},
+	}), &init); err != nil {
+		t.Fatal(err)
+	}
+	if wf := init.Capabilities.Workspace.WorkspaceFolders; !wf.Supported || !wf.ChangeNotifications {
+		t.Errorf("got workspace folders capabilities %+v; want support with change notifications", wf)
+	}
+	c.Notify("initialized", struct{}{})
+	if got, want := symbols(c), []string{"OneSet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols %v; want %v", got, want)
+	}
+
+	c.Notify("workspace/didChangeWorkspaceFolders", map[string]interface{}{"event": map[string]interface{}{
+		"added": []interface{}{folder("two")}, "removed": []interface{}{},
+	}})
+	if got, want := symbols(c), []string{"OneSet", "TwoSet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after adding two, got symbols %v; want %v", got, want)
+	}
+
+	c.Notify("workspace/didChangeWorkspaceFolders", map[string]interface{}{"event": map[string]interface{}{
+		"added": []interface{}{}, "removed": []interface{}{folder("one")},
+	}})
+	if got, want := symbols(c), []string{"TwoSet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after removing one, got symbols %v; want %v", got, want)
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+// TestServerWorkspaceDiagnostics checks that the packages of the workspace
+// folders are checked once initialized, publishing the diagnostics of files
+// that are not open, and that they are cleared once their folder is removed.
+func TestServerWorkspaceDiagnostics(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod": lsptest.AppMod,
+		"app/foo/foo.go": `package foo
+
+type Foo int
+
+func ProvideFoo() Foo { return 42 }
+`,
+		"app/bar/wire.go": `//+build wireinject
+
+package bar
+
+import "github.com/google/wire"
+
+type Bar int
+
+func injectBar() Bar {
+	wire.Build()
+	return 0
+}
+`,
+	})
+	defer os.RemoveAll(root)
+	app := lsp.DocumentUri(filepath.Join(root, "app"))
+	barURI := lsp.DocumentUri(filepath.Join(root, "app", "bar", "wire.go"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Call("initialize", map[string]interface{}{
+		"capabilities":     map[string]interface{}{"window": map[string]interface{}{"workDoneProgress": true}},
+		"workspaceFolders": []interface{}{map[string]string{"uri": app, "name": "app"}},
+	})
+	c.Notify("initialized", struct{}{})
+
+	// nextDiagnostics creates the progresses asked for by the server until
+	// it publishes diagnostics, and records whether the check can be
+	// canceled.
+	cancellable := false
+	nextDiagnostics := func() lsp.PublishDiagnosticsParams {
+		t.Helper()
+		for {
+			msg := c.Next()
+			switch msg.Method {
+			case "window/workDoneProgress/create":
+				c.Reply(msg, nil)
+			case "$/progress":
+				var progress struct {
+					Value lsp.WorkDoneProgressBegin
+				}
+				if err := json.Unmarshal(msg.Params, &progress); err != nil {
+					t.Fatal(err)
+				}
+				if progress.Value.Title == "wireplus: checking" {
+					cancellable = progress.Value.Cancellable
+				}
+			case "textDocument/publishDiagnostics":
+				var diags lsp.PublishDiagnosticsParams
+				if err := json.Unmarshal(msg.Params, &diags); err != nil {
+					t.Fatal(err)
+				}
+				return diags
+			default:
+				t.Fatalf("got %s; want textDocument/publishDiagnostics", msg.Raw)
+			}
+		}
+	}
+	diags := nextDiagnostics()
+	if diags.Uri != barURI || len(diags.Diagnostics) != 1 || diags.Diagnostics[0].Code != "wire/no-provider" {
+		t.Fatalf("got diagnostics %+v; want a missing provider in %s", diags, barURI)
+	}
+	if !cancellable {
+		t.Error("the check of the workspace cannot be canceled")
+	}
+
+	c.Notify("workspace/didChangeWorkspaceFolders", map[string]interface{}{"event": map[string]interface{}{
+		"added": []interface{}{}, "removed": []interface{}{map[string]string{"uri": app, "name": "app"}},
+	}})
+	if diags := nextDiagnostics(); diags.Uri != barURI || len(diags.Diagnostics) != 0 {
+		t.Errorf("after removing app, got diagnostics %+v; want none for %s", diags, barURI)
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+// TestServerImplementation checks that an interface leads to the providers of
+// the types bound to it in other packages of the workspace, and a bound
+// type to its bindings.
+func TestServerImplementation(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const storeGo = `package store
+
+type Store interface{ Get() string }
+`
+	const dbGo = `package db
+
+import (
+	"example.com/app/store"
+	"github.com/google/wire"
+)
+
+type DB struct{}
+
+func (*DB) Get() string { return "" }
+
+func NewDB() *DB { return new(DB) }
+
+var Set = wire.NewSet(NewDB, wire.Bind(new(store.Store), new(*DB)))
+
+var BindSet = wire.NewSet(wire.Bind(new(store.Store), new(*DB)))
+`
+	root := lsptest.SetupModules(t, wireGo, map[string]string{
+		"app/go.mod":         lsptest.AppMod,
+		"app/store/store.go": storeGo,
+		"app/db/db.go":       dbGo,
+	})
+	defer os.RemoveAll(root)
+	storeURI := lsp.DocumentUri(filepath.Join(root, "app", "store", "store.go"))
+	dbURI := lsp.DocumentUri(filepath.Join(root, "app", "db", "db.go"))
+	// at returns the position of the first occurrence of s in src.
+	at := func(src, s string) lsp.Position {
+		i := strings.Index(src, s)
+		line := strings.Count(src[:i], "\n")
+		return lsp.Position{Line: line, Character: i - strings.LastIndex(src[:i], "\n") - 1}
+	}
+
+	// bindSetBind is the position of the binding of BindSet.
+	bindSetBind := at(dbGo, "wire.NewSet(wire.Bind")
+	bindSetBind.Character += len("wire.NewSet(")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, done := startServer(t, ctx, lsptest.ModuleEnv())
+	var init lsp.InitializeResult
+	if err := json.Unmarshal(c.Call("initialize", map[string]interface{}{
+		"capabilities":     map[string]interface{}{},
+		"workspaceFolders": []interface{}{map[string]string{"uri": lsp.DocumentUri(filepath.Join(root, "app")), "name": "app"}},
+	}), &init); err != nil {
+		t.Fatal(err)
+	}
+	if !init.Capabilities.ImplementationProvider {
+		t.Error("implementationProvider is not advertised")
+	}
+	c.Notify("initialized", struct{}{})
+
+	tests := []struct {
+		name string
+		uri  string
+		pos  lsp.Position
+		want []lsp.Position
+	}{
+		{
+			// BindSet provides no *DB, so its binding is returned instead.
+			name: "interface",
+			uri:  storeURI,
+			pos:  at(storeGo, "Store interface"),
+			want: []lsp.Position{at(dbGo, "NewDB() *DB"), bindSetBind},
+		},
+		{
+			name: "bound type",
+			uri:  dbURI,
+			pos:  at(dbGo, "DB struct"),
+			want: []lsp.Position{at(dbGo, "wire.Bind"), bindSetBind},
+		},
+		{
+			name: "provider",
+			uri:  dbURI,
+			pos:  at(dbGo, "NewDB() *DB"),
+		},
+	}
+	for _, test := range tests {
+		var locs []lsp.Location
+		if err := json.Unmarshal(c.Call("textDocument/implementation", map[string]interface{}{
+			"textDocument": map[string]string{"uri": test.uri},
+			"position":     test.pos,
+		}), &locs); err != nil {
+			t.Fatal(err)
+		}
+		var got []lsp.Position
+		for _, loc := range locs {
+			if loc.Uri != dbURI {
+				t.Errorf("%s: got location in %s; want %s", test.name, loc.Uri, dbURI)
+			}
+			got = append(got, loc.Range.Start)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got implementations at %v; want %v", test.name, got, test.want)
+		}
+	}
+	c.Call("shutdown", nil)
+	c.Notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+}
+
+func TestServerLogging(t *testing.T) {
+	var stderr, file bytes.Buffer
+	logging.SetOutput(&stderr)
+	defer logging.SetOutput(os.Stderr)
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	srv := lsp.NewServer(lsp.Options{
+		Env:      lsptest.ModuleEnv(),
+		Verbose:  true,
+		LogLevel: logging.LevelInfo,
+		LogFile:  logging.New(&file, "wireplus: ", logging.LevelInfo),
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(context.Background(), inR, outW)
+	}()
+	c := lsptest.NewClient(t, outR, inW)
+	c.Call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+	// The messages received are logged to the client with -verbose.
+	var logMsg lsp.LogMessageParams
+	c.Expect("window/logMessage", &logMsg)
+	if logMsg.Type != lsp.MessageInfo || !strings.HasPrefix(logMsg.Message, `wireplus: received {"id":1,"jsonrpc":"2.0","method":"initialize"`) {
+		t.Errorf("got log message %+v; want the initialize request logged at info level", logMsg)
+	}
+	c.Call("shutdown", nil)
+	c.Expect("window/logMessage", &logMsg)
+	c.Notify("exit", nil)
+	c.Expect("window/logMessage", &logMsg)
+	if err := <-done; err != nil {
+		t.Errorf("server exited with %v; want nil", err)
+	}
+	if got := strings.Count(file.String(), "wireplus: received "); got != 3 {
+		t.Errorf("log file has %d received messages; want 3:\n%s", got, file.String())
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("server logged to stderr while serving:\n%s", stderr.String())
+	}
+}
+
+// TestServerConformance runs each script in testdata/scripts against a
+// copy of the module in testdata/app. See lsptest.Script for the format
+// of the scripts. The server must exit successfully at the end of each
+// script.
+func TestServerConformance(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scripts, err := filepath.Glob(filepath.Join("testdata", "scripts", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appFiles, err := filepath.Glob(filepath.Join("testdata", "app", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range scripts {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(t *testing.T) {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			script, err := lsptest.ParseScript(path, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := map[string]string{}
+			for _, f := range appFiles {
+				content, err := ioutil.ReadFile(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				files["app/"+filepath.Base(f)] = string(content)
+			}
+			root := lsptest.SetupModules(t, wireGo, files)
+			defer os.RemoveAll(root)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			c, done := startServer(t, ctx, lsptest.ModuleEnv())
+			c.Run(script, map[string]string{"ROOT": root})
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("server exited with %v; want nil", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Error("server did not exit")
+			}
+		})
+	}
+}
+
+// TestServerErrors checks that every request is answered, with a JSON-RPC
+// error if it fails, that notifications of unknown methods are ignored,
+// that invalid notifications are logged to the client and that requests
+// before the initialize request and after the shutdown request are
+// rejected.
+func TestServerErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	srv := lsp.NewServer(lsp.Options{Env: lsptest.ModuleEnv(), DiagnosticsDelay: 200 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(ctx, inR, outW)
+	}()
+	frame := func(content string) string {
+		return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(content), content)
+	}
+	send := func(content string) {
+		t.Helper()
+		if _, err := io.WriteString(inW, frame(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader := bufio.NewReader(outR)
+	// expect reads the next message, which must be exactly want framed.
+	expect := func(want string) {
+		t.Helper()
+		buf := make([]byte, len(frame(want)))
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf); got != frame(want) {
+			t.Fatalf("got %q; want %q", got, frame(want))
+		}
+	}
+	// expectError reads the next message, which must be an error response
+	// to the request with the given id, as JSON, with code.
+	expectError := func(id string, code int) {
+		t.Helper()
+		buf, err := lsp.ReadMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res struct {
+			Jsonrpc string
+			Id      json.RawMessage
+			Error   *lsp.ResponseError
+		}
+		if err := json.Unmarshal(buf, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Jsonrpc != "2.0" || string(res.Id) != id || res.Error == nil || res.Error.Code != code {
+			t.Fatalf("got %s; want error %d for id %s", buf, code, id)
+		}
+	}
+	// Requests before the initialize request are rejected, and
+	// notifications dropped.
+	send(`{"jsonrpc":"2.0","method":"textDocument/didSave","params":{"textDocument":{"uri":1}}}`)
+	send(`{"jsonrpc":"2.0","id":0,"method":"textDocument/hover","params":{}}`)
+	expect(`{"jsonrpc":"2.0","id":0,"error":{"code":-32002,"message":"textDocument/hover received before initialize"}}`)
+	send(`{"jsonrpc":"2.0","id":"init","method":"initialize","params":{"capabilities":{}}}`)
+	buf, err := lsp.ReadMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(buf), `{"jsonrpc":"2.0","id":"init","result":{`) {
+		t.Fatalf("got %s; want the result of initialize", buf)
+	}
+	send(`{"jsonrpc":"2.0","id":"again","method":"initialize","params":{"capabilities":{}}}`)
+	expect(`{"jsonrpc":"2.0","id":"again","error":{"code":-32600,"message":"initialize received twice"}}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"foo/bar"}`)
+	expect(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found: foo/bar"}}`)
+	send(`{"jsonrpc":"2.0","id":"a","method":"foo/bar"}`)
+	expect(`{"jsonrpc":"2.0","id":"a","error":{"code":-32601,"message":"method not found: foo/bar"}}`)
+	// Notifications are not answered, so the next message is the response
+	// to the next request.
+	send(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":1}}`)
+	send(`{"jsonrpc":"2.0","method":"initialized","params":{}}`)
+	// Notifications whose params cannot be decoded are logged to the client.
+	send(`{"jsonrpc":"2.0","method":"textDocument/didSave","params":{"textDocument":{"uri":1}}}`)
+	buf, err = lsp.ReadMessage(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Method string
+		Params lsp.LogMessageParams
+	}
+	if err := json.Unmarshal(buf, &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Method != "window/logMessage" || log.Params.Type != lsp.MessageError || !strings.HasPrefix(log.Params.Message, "wireplus: invalid textDocument/didSave notification: ") {
+		t.Fatalf("got %s; want an error logged for textDocument/didSave", buf)
+	}
+	send(`{"jsonrpc":"2.0","id":2}`)
+	expect(`{"jsonrpc":"2.0","id":2,"error":{"code":-32600,"message":"message does not specify method"}}`)
+	send(`{"jsonrpc":"2.0","id":3,"method":`)
+	expectError("null", lsp.ParseError)
+	send(`{"jsonrpc":"2.0","id":4,"method":"textDocument/hover","params":{"position":{"line":"x"}}}`)
+	expectError("4", lsp.InvalidParams)
+	// Requests whose id is neither a number nor a string are rejected with
+	// a null id, as their id cannot be answered, and so is canceling one.
+	send(`{"jsonrpc":"2.0","id":[7],"method":"shutdown"}`)
+	expect(`{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"request id [7] is neither a number nor a string"}}`)
+	send(`{"jsonrpc":"2.0","id":{"a":1},"method":"textDocument/hover","params":{}}`)
+	expectError("null", lsp.InvalidRequest)
+	send(`{"jsonrpc":"2.0","id":true,"method":"textDocument/hover","params":{}}`)
+	expectError("null", lsp.InvalidRequest)
+	send(`{"jsonrpc":"2.0","method":"$/cancelRequest","params":{"id":[1]}}`)
+	expect(`{"jsonrpc":"2.0","method":"window/logMessage","params":{"type":1,"message":"wireplus: invalid $/cancelRequest notification: id [1] is neither a number nor a string"}}`)
+	// Concurrent requests are answered in any order, each with its id,
+	// whether a number or a string.
+	ids := []string{`7`, `"seven"`, `8`, `"eight"`}
+	for _, id := range ids {
+		send(`{"jsonrpc":"2.0","id":` + id + `,"method":"textDocument/hover","params":{"textDocument":{"uri":"file:///nonexistent/a.go"}}}`)
+	}
+	answered := make(map[string]int)
+	for range ids {
+		buf, err := lsp.ReadMessage(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res struct {
+			Id json.RawMessage
+		}
+		if err := json.Unmarshal(buf, &res); err != nil {
+			t.Fatal(err)
+		}
+		answered[string(res.Id)]++
+	}
+	for _, id := range ids {
+		if answered[id] != 1 {
+			t.Errorf("request %s answered %d times; want once (answered: %v)", id, answered[id], answered)
+		}
+	}
+	send(`{"jsonrpc":"2.0","id":5,"method":"shutdown"}`)
+	expect(`{"jsonrpc":"2.0","id":5,"result":null}`)
+	send(`{"jsonrpc":"2.0","id":6,"method":"textDocument/hover","params":{}}`)
+	expect(`{"jsonrpc":"2.0","id":6,"error":{"code":-32600,"message":"textDocument/hover received after shutdown"}}`)
+	send(`{"jsonrpc":"2.0","method":"exit"}`)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("server exited with %v; want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("server did not exit")
+	}
+
+	// Exiting without the shutdown request fails.
+	c, exited := startServer(t, ctx, lsptest.ModuleEnv())
+	c.Notify("exit", nil)
+	select {
+	case err := <-exited:
+		if err != lsp.ErrNoShutdown {
+			t.Errorf("server exited with %v; want %v", err, lsp.ErrNoShutdown)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("server did not exit")
+	}
+}
+
+// scriptTransport is a Transport reading msgs in order, then io.EOF, and
+// discarding the messages written.
+type scriptTransport struct {
+	msgs []string
+}
+
+func (t *scriptTransport) ReadMessage() ([]byte, error) {
+	if len(t.msgs) == 0 {
+		return nil, io.EOF
+	}
+	msg := t.msgs[0]
+	t.msgs = t.msgs[1:]
+	return []byte(msg), nil
+}
+
+func (t *scriptTransport) WriteMessage(res interface{}) error { return nil }
+
+func (t *scriptTransport) Close() error { return nil }
+
+func TestServerClosedConnection(t *testing.T) {
+	before := runtime.NumGoroutine()
+	srv := lsp.NewServer(lsp.Options{Env: lsptest.ModuleEnv()})
+	// The connection is closed while workspace/symbol waits for the
+	// symbols to be indexed, whose handler must not outlive the session.
+	err := srv.ServeTransport(context.Background(), &scriptTransport{msgs: []string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"workspace/symbol","params":{"query":"Foo"}}`,
+	}})
+	if err != lsp.ErrClosed {
+		t.Errorf("server exited with %v; want %v", err, lsp.ErrClosed)
+	}
+	// The goroutines of the session exit with it.
+	deadline := time.Now().Add(10 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines are running after the session; want at most %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
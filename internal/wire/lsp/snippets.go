@@ -0,0 +1,106 @@
+package lsp
+
+import (
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A snippet is the template of a completion expanding to wire boilerplate,
+// in the snippet syntax of the protocol.
+type snippet struct {
+	// keyword is the word typed to get the snippet, e.g. "newset".
+	keyword string
+	detail  string
+	body    string
+	// header is the file header the body is preceded by in a file without
+	// a package clause, or else the empty string.
+	header string
+}
+
+// snippets are the templates offered by snippetItems, in order.
+var snippets = []snippet{
+	{
+		keyword: "wireinject",
+		detail:  "injector declaration",
+		body:    "func ${1:initApp}(${2}) ${3:*App} {\n\tpanic(wire.Build(${0}))\n}",
+		header:  "//+build wireinject\n\npackage ${4:main}\n\nimport \"github.com/google/wire\"\n\n",
+	},
+	{
+		keyword: "newset",
+		detail:  "provider set declaration",
+		body:    "var ${1:Set} = wire.NewSet(${0})",
+	},
+}
+
+// isWireFile reports whether path is a file that declares injectors by
+// convention: wire.go, or a file whose name ends with _wire.go.
+func isWireFile(path string) bool {
+	name := filepath.Base(path)
+	return name == "wire.go" || strings.HasSuffix(name, "_wire.go")
+}
+
+// snippetItems returns the snippets whose keyword starts with the word
+// typed at the start of the line of pos in content, the contents of the
+// wire file at path, or nil if pos follows anything else. They replace
+// the word, and the import of the wire package is added if the file lacks
+// it. Unlike the other completions, they do not need the package to load,
+// as the file does not parse while the word is being typed.
+func snippetItems(path string, content []byte, pos Position) []CompletionItem {
+	if !isWireFile(path) {
+		return nil
+	}
+	lines := strings.Split(string(content), "\n")
+	if pos.Line >= len(lines) || pos.Character > len(lines[pos.Line]) {
+		return nil
+	}
+	word := lines[pos.Line][:pos.Character]
+	if word == "" || strings.TrimLeft(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return nil
+	}
+	// The package clause and imports precede the word, if any.
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, path, content, parser.ImportsOnly)
+	// The parser reports a package clause even if the keyword is missing.
+	hasPackage := f != nil && f.Name != nil && f.Name.Name != "_" &&
+		strings.HasPrefix(string(content[fset.Position(f.Package).Offset:]), "package")
+	hasImport := false
+	if f != nil {
+		for _, imp := range f.Imports {
+			if p, err := strconv.Unquote(imp.Path.Value); err == nil && p == "github.com/google/wire" {
+				hasImport = true
+			}
+		}
+	}
+	var items []CompletionItem
+	for _, sn := range snippets {
+		if !strings.HasPrefix(sn.keyword, strings.ToLower(word)) {
+			continue
+		}
+		item := CompletionItem{
+			Label:            sn.keyword,
+			Kind:             CompletionSnippet,
+			Detail:           sn.detail,
+			InsertTextFormat: InsertTextFormatSnippet,
+			TextEdit: &TextEdit{
+				Range:   Range{Start: Position{Line: pos.Line}, End: pos},
+				NewText: sn.body,
+			},
+		}
+		switch {
+		case !hasPackage && sn.header != "":
+			item.TextEdit.NewText = sn.header + sn.body
+		case hasPackage && !hasImport:
+			// Import the wire package right after the package clause.
+			end := positionOf(fset.Position(f.Name.End()))
+			item.AdditionalTextEdits = []TextEdit{{
+				Range:   Range{Start: end, End: end},
+				NewText: "\n\nimport \"github.com/google/wire\"",
+			}}
+		}
+		items = append(items, item)
+	}
+	return items
+}
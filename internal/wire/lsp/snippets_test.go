@@ -0,0 +1,88 @@
+package lsp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSnippetItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		// pos is the position of the cursor, at the end of content if nil.
+		pos *Position
+		// want lists the labels of the snippets, and wantHeader and
+		// wantImport whether the injector has the file header and the
+		// snippets import the wire package.
+		want       []string
+		wantHeader bool
+		wantImport bool
+	}{
+		{
+			name:       "empty file",
+			path:       "/app/wire.go",
+			content:    "wire",
+			want:       []string{"wireinject"},
+			wantHeader: true,
+		},
+		{
+			name:       "without import",
+			path:       "/app/app_wire.go",
+			content:    "package main\n\nn",
+			want:       []string{"newset"},
+			wantImport: true,
+		},
+		{
+			name:    "with import",
+			path:    "/app/wire.go",
+			content: "//+build wireinject\n\npackage main\n\nimport \"github.com/google/wire\"\n\nNewS",
+			want:    []string{"newset"},
+		},
+		{
+			name:    "no word",
+			path:    "/app/wire.go",
+			content: "package main\n\nimport \"github.com/google/wire\"\n\n",
+			pos:     &Position{Line: 4},
+		},
+		{
+			name:    "indented",
+			path:    "/app/wire.go",
+			content: "package main\n\nfunc f() {\n\tnew",
+		},
+		{
+			name:    "not a wire file",
+			path:    "/app/main.go",
+			content: "package main\n\nnew",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pos := test.pos
+			if pos == nil {
+				lines := strings.Split(test.content, "\n")
+				pos = &Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+			}
+			items := snippetItems(test.path, []byte(test.content), *pos)
+			var labels []string
+			for _, item := range items {
+				labels = append(labels, item.Label)
+				if item.Kind != CompletionSnippet || item.InsertTextFormat != InsertTextFormatSnippet {
+					t.Errorf("%s has kind %d and format %d; want a snippet", item.Label, item.Kind, item.InsertTextFormat)
+				}
+				if r := item.TextEdit.Range; r.Start != (Position{Line: pos.Line}) || r.End != *pos {
+					t.Errorf("%s replaces %+v; want the word before %+v", item.Label, r, *pos)
+				}
+				if got := strings.HasPrefix(item.TextEdit.NewText, "//+build wireinject\n"); got != test.wantHeader {
+					t.Errorf("%s has the file header: %t; want %t", item.Label, got, test.wantHeader)
+				}
+				if got := len(item.AdditionalTextEdits) > 0; got != test.wantImport {
+					t.Errorf("%s imports the wire package: %t; want %t", item.Label, got, test.wantImport)
+				}
+			}
+			if strings.Join(labels, ",") != strings.Join(test.want, ",") {
+				t.Errorf("got snippets %q; want %q", labels, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+type Config struct {
+	Name string
+}
+
+type Greeter struct {
+	Config *Config
+}
+
+func NewConfig() *Config { return &Config{Name: "wire"} }
+
+func main() {}
+
+const (
+	greeting   = "hello"
+	maxRetries = 3
+)
@@ -0,0 +1,5 @@
+module example.com/app
+
+require github.com/google/wire v0.0.0
+
+replace github.com/google/wire => ../wire
@@ -0,0 +1,20 @@
+package main
+
+import "github.com/google/wire"
+
+type Settings struct {
+	Greeting string
+	Retries  int
+	Limits   []Limit
+}
+
+type Limit struct {
+	Name string
+	Max  int
+}
+
+var Values = wire.NewSet(wire.Value(Settings{
+	Greeting: greeting + ", world",
+	Retries:  maxRetries * 2,
+	Limits:   []Limit{{Name: "burst", Max: maxRetries}},
+}))
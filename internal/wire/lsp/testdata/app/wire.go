@@ -0,0 +1,12 @@
+//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+var Set = wire.NewSet(NewConfig, wire.Struct(new(Greeter), "Config"))
+
+func InitGreeter() *Greeter {
+	wire.Build(Set)
+	return nil
+}
@@ -0,0 +1,64 @@
+package lsp
+
+import (
+	"bufio"
+	"io"
+)
+
+// A Transport carries the messages between the language server and a
+// client, such as over stdio, a TCP connection or a WebSocket.
+type Transport interface {
+	// ReadMessage returns the content of the next message from the client.
+	// It returns io.EOF if the client closed the connection before the
+	// message starts.
+	ReadMessage() ([]byte, error)
+	// WriteMessage writes res as a message to the client. Messages written
+	// concurrently are not interleaved.
+	WriteMessage(res interface{}) error
+	// Close closes the connection to the client.
+	Close() error
+}
+
+// NewStreamTransport returns a Transport reading messages with a
+// Content-Length header from r and writing them to w, as over stdio or a
+// TCP connection. Close closes r and w if they are io.Closers.
+func NewStreamTransport(r io.Reader, w io.Writer) Transport {
+	return &streamTransport{r: bufio.NewReader(r), w: NewWriter(w), closers: closers(r, w)}
+}
+
+type streamTransport struct {
+	r       *bufio.Reader
+	w       *Writer
+	closers []io.Closer
+}
+
+func (t *streamTransport) ReadMessage() ([]byte, error) {
+	return ReadMessage(t.r)
+}
+
+func (t *streamTransport) WriteMessage(res interface{}) error {
+	return t.w.WriteMessage(res)
+}
+
+func (t *streamTransport) Close() error {
+	var first error
+	for _, c := range t.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// closers returns r and w if they are io.Closers, once if they are the
+// same, as for a net.Conn.
+func closers(r io.Reader, w io.Writer) []io.Closer {
+	var cs []io.Closer
+	if c, ok := r.(io.Closer); ok {
+		cs = append(cs, c)
+	}
+	if c, ok := w.(io.Closer); ok && (len(cs) == 0 || cs[0] != c) {
+		cs = append(cs, c)
+	}
+	return cs
+}
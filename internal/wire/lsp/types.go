@@ -32,26 +32,112 @@ type Command struct {
 
 type InitializeRequest struct {
 	Jsonrpc string           `json:"jsonrpc"`
-	Id      int              `json:"id"`
+	Id      interface{}      `json:"id"`
 	Method  string           `json:"method"`
 	Params  InitializeParams `json:"params"`
 }
 
 type InitializeParams struct {
-	Capabilities ClientCapabilities `json:"capabilities"`
+	RootUri               string             `json:"rootUri"`
+	WorkspaceFolders      []WorkspaceFolder  `json:"workspaceFolders"`
+	Capabilities          ClientCapabilities `json:"capabilities"`
+	InitializationOptions Settings           `json:"initializationOptions"`
+}
+
+// Settings are the wireplus specific settings sent by the client as the
+// initialization options of the initialize request, and again under the
+// wireplus section of workspace/didChangeConfiguration whenever they
+// change. Settings left out take their default value.
+type Settings struct {
+	// GenerateOnSave makes the server regenerate wire_gen.go when a file
+	// in a package with injectors is saved without errors.
+	GenerateOnSave bool `json:"generateOnSave"`
+	// Tags replaces the build tags of the -tags flag of the server, if not
+	// empty.
+	Tags string `json:"tags"`
+	// Env holds environment variables, such as GOOS, set for the go
+	// command in addition to those of the server.
+	Env map[string]string `json:"env"`
+	// BuildFlags are flags, such as -mod=vendor, passed to the go command
+	// by appending them to GOFLAGS.
+	BuildFlags []string `json:"buildFlags"`
+	// HeaderFile is the path of a file inserted as a header in generated
+	// wire_gen.go files, as with gen -header_file.
+	HeaderFile string `json:"headerFile"`
+	// DiagnosticSeverity is the severity of the published diagnostics:
+	// error, the default, warning, information or hint.
+	DiagnosticSeverity string `json:"diagnosticSeverity"`
 }
 
 type ClientCapabilities struct {
-	Workspace WorkspaceClientCapabilities `json:"workspace"`
+	Workspace    WorkspaceClientCapabilities    `json:"workspace"`
+	TextDocument TextDocumentClientCapabilities `json:"textDocument"`
+	Window       WindowClientCapabilities       `json:"window"`
+}
+
+type WindowClientCapabilities struct {
+	ShowDocument     ShowDocumentClientCapabilities `json:"showDocument"`
+	WorkDoneProgress bool                           `json:"workDoneProgress"`
+}
+
+type ShowDocumentClientCapabilities struct {
+	Support bool `json:"support"`
+}
+
+type TextDocumentClientCapabilities struct {
+	Hover         HoverClientCapabilities         `json:"hover"`
+	Completion    CompletionClientCapabilities    `json:"completion"`
+	SignatureHelp SignatureHelpClientCapabilities `json:"signatureHelp"`
+	FoldingRange  FoldingRangeClientCapabilities  `json:"foldingRange"`
+	// Diagnostic is set if the client pulls diagnostics with
+	// textDocument/diagnostic.
+	Diagnostic *DiagnosticClientCapabilities `json:"diagnostic"`
+}
+
+type DiagnosticClientCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
+}
+
+type FoldingRangeClientCapabilities struct {
+	// LineFoldingOnly reports whether the client ignores the characters
+	// of folding ranges and folds whole lines.
+	LineFoldingOnly bool `json:"lineFoldingOnly"`
+}
+
+type HoverClientCapabilities struct {
+	ContentFormat []string `json:"contentFormat"`
+}
+
+type CompletionClientCapabilities struct {
+	CompletionItem CompletionItemClientCapabilities `json:"completionItem"`
+}
+
+type CompletionItemClientCapabilities struct {
+	DocumentationFormat []string `json:"documentationFormat"`
+	SnippetSupport      bool     `json:"snippetSupport"`
+}
+
+type SignatureHelpClientCapabilities struct {
+	SignatureInformation SignatureInformationClientCapabilities `json:"signatureInformation"`
+}
+
+type SignatureInformationClientCapabilities struct {
+	DocumentationFormat []string `json:"documentationFormat"`
 }
 
 type WorkspaceClientCapabilities struct {
-	WorkspaceFolders bool `json:"workspaceFolders"`
+	ApplyEdit             bool                                    `json:"applyEdit"`
+	WorkspaceFolders      bool                                    `json:"workspaceFolders"`
+	DidChangeWatchedFiles DidChangeWatchedFilesClientCapabilities `json:"didChangeWatchedFiles"`
+}
+
+type DidChangeWatchedFilesClientCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration"`
 }
 
 type InitializeResponse struct {
 	Jsonrpc string            `json:"jsonrpc"`
-	Id      int               `json:"id"`
+	Id      interface{}       `json:"id"`
 	Result  *InitializeResult `json:"result"`
 }
 type InitializeResult struct {
@@ -59,9 +145,44 @@ type InitializeResult struct {
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync int                         `json:"textDocumentSync"`
-	CodeLensProvider bool                        `json:"codeLensProvider"`
-	Workspace        WorkspaceServerCapabilities `json:"workspace"`
+	TextDocumentSync        int                         `json:"textDocumentSync"`
+	CodeLensProvider        *CodeLensOptions            `json:"codeLensProvider,omitempty"`
+	HoverProvider           bool                        `json:"hoverProvider"`
+	DefinitionProvider      bool                        `json:"definitionProvider"`
+	ReferencesProvider      bool                        `json:"referencesProvider"`
+	ImplementationProvider  bool                        `json:"implementationProvider"`
+	RenameProvider          bool                        `json:"renameProvider"`
+	CodeActionProvider      bool                        `json:"codeActionProvider"`
+	WorkspaceSymbolProvider bool                        `json:"workspaceSymbolProvider"`
+	DocumentSymbolProvider  bool                        `json:"documentSymbolProvider"`
+	FoldingRangeProvider    bool                        `json:"foldingRangeProvider"`
+	DocumentLinkProvider    *DocumentLinkOptions        `json:"documentLinkProvider,omitempty"`
+	DiagnosticProvider      *DiagnosticOptions          `json:"diagnosticProvider,omitempty"`
+	SemanticTokensProvider  *SemanticTokensOptions      `json:"semanticTokensProvider,omitempty"`
+	InlayHintProvider       bool                        `json:"inlayHintProvider"`
+	CallHierarchyProvider   bool                        `json:"callHierarchyProvider"`
+	CompletionProvider      *CompletionOptions          `json:"completionProvider,omitempty"`
+	SignatureHelpProvider   *SignatureHelpOptions       `json:"signatureHelpProvider,omitempty"`
+	ExecuteCommandProvider  *ExecuteCommandOptions      `json:"executeCommandProvider,omitempty"`
+	Workspace               WorkspaceServerCapabilities `json:"workspace"`
+}
+
+type CompletionOptions struct {
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+}
+
+type SemanticTokensOptions struct {
+	Legend SemanticTokensLegend `json:"legend"`
+	Full   bool                 `json:"full"`
+}
+
+type SemanticTokensLegend struct {
+	TokenTypes     []string `json:"tokenTypes"`
+	TokenModifiers []string `json:"tokenModifiers"`
+}
+
+type ExecuteCommandOptions struct {
+	Commands []string `json:"commands"`
 }
 
 type WorkspaceServerCapabilities struct {
@@ -69,23 +190,29 @@ type WorkspaceServerCapabilities struct {
 }
 
 type WorkspaceFoldersServerCapabilities struct {
-	Supported bool `json:"supported"`
+	Supported           bool `json:"supported"`
+	ChangeNotifications bool `json:"changeNotifications"`
+}
+
+type WorkspaceFolder struct {
+	Uri  string `json:"uri"`
+	Name string `json:"name"`
 }
 
 type ShutdownRequest struct {
-	Jsonrpc string `json:"jsonrpc"`
-	Id      int    `json:"id"`
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
 }
 
 type ShutdownResponse struct {
 	Jsonrpc string      `json:"jsonrpc"`
-	Id      int         `json:"id"`
+	Id      interface{} `json:"id"`
 	Result  interface{} `json:"result"`
 }
 
 type CodeLensRequest struct {
 	Jsonrpc string         `json:"jsonrpc"`
-	Id      int            `json:"id"`
+	Id      interface{}    `json:"id"`
 	Method  string         `json:"method"`
 	Params  CodeLensParams `json:"Params"`
 }
@@ -95,14 +222,558 @@ type CodeLensParams struct {
 }
 
 type CodeLensResponse struct {
-	Jsonrpc string     `json:"jsonrpc"`
-	Id      int        `json:"id"`
-	Result  []CodeLens `json:"result"`
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  []CodeLens  `json:"result"`
 }
 
+// A CodeLens is returned without Command by textDocument/codeLens, and
+// resolved with codeLens/resolve, which gets back its Data.
 type CodeLens struct {
-	Range   Range   `json:"range"`
-	Command Command `json:"command"`
+	Range   Range         `json:"range"`
+	Command *Command      `json:"command,omitempty"`
+	Data    *CodeLensData `json:"data,omitempty"`
+}
+
+// CodeLensData identifies the declaration and the command of a code lens
+// to resolve.
+type CodeLensData struct {
+	Dir     string `json:"dir"`
+	Name    string `json:"name"`
+	Command string `json:"command"`
+}
+
+type CodeLensResolveRequest struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Method  string      `json:"method"`
+	Params  CodeLens    `json:"params"`
+}
+
+type CodeLensResolveResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  *CodeLens   `json:"result"`
+}
+
+type CodeLensOptions struct {
+	ResolveProvider bool `json:"resolveProvider"`
+}
+
+type DiagnosticOptions struct {
+	// InterFileDependencies reports that editing a document may change the
+	// diagnostics of others, which the client then pulls again.
+	InterFileDependencies bool `json:"interFileDependencies"`
+	WorkspaceDiagnostics  bool `json:"workspaceDiagnostics"`
+}
+
+type DocumentLinkOptions struct {
+	ResolveProvider bool `json:"resolveProvider"`
+}
+
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+type DefinitionRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type DefinitionResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  *Location   `json:"result"`
+}
+
+type ImplementationRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type ImplementationResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  []Location  `json:"result"`
+}
+
+type ReferenceRequest struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  ReferenceParams `json:"params"`
+}
+
+type ReferenceParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+	Context      ReferenceContext       `json:"context"`
+}
+
+type ReferenceContext struct {
+	IncludeDeclaration bool `json:"includeDeclaration"`
+}
+
+type ReferenceResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  []Location  `json:"result"`
+}
+
+type RenameRequest struct {
+	Jsonrpc string       `json:"jsonrpc"`
+	Id      interface{}  `json:"id"`
+	Method  string       `json:"method"`
+	Params  RenameParams `json:"params"`
+}
+
+type RenameParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+	NewName      string                 `json:"newName"`
+}
+
+type RenameResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Result  *WorkspaceEdit `json:"result,omitempty"`
+	Error   *ResponseError `json:"error,omitempty"`
+}
+
+type CodeActionRequest struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Id      interface{}      `json:"id"`
+	Method  string           `json:"method"`
+	Params  CodeActionParams `json:"params"`
+}
+
+type CodeActionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+	Context      CodeActionContext      `json:"context"`
+}
+
+type CodeActionContext struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Only are the kinds of actions requested, or all if empty.
+	Only []string `json:"only,omitempty"`
+}
+
+type CodeActionResponse struct {
+	Jsonrpc string       `json:"jsonrpc"`
+	Id      interface{}  `json:"id"`
+	Result  []CodeAction `json:"result"`
+}
+
+type CodeAction struct {
+	Title       string         `json:"title"`
+	Kind        string         `json:"kind,omitempty"`
+	Diagnostics []Diagnostic   `json:"diagnostics,omitempty"`
+	Edit        *WorkspaceEdit `json:"edit,omitempty"`
+}
+
+// Kinds of CodeAction.
+const (
+	CodeActionQuickFix        = "quickfix"
+	CodeActionRefactorExtract = "refactor.extract"
+	// CodeActionSourceOrganizeProviders sorts the arguments of the
+	// wire.Build and wire.NewSet calls of a document.
+	CodeActionSourceOrganizeProviders = "source.organizeProviders"
+)
+
+type WorkspaceSymbolRequest struct {
+	Jsonrpc string                `json:"jsonrpc"`
+	Id      interface{}           `json:"id"`
+	Method  string                `json:"method"`
+	Params  WorkspaceSymbolParams `json:"params"`
+}
+
+type WorkspaceSymbolParams struct {
+	Query string `json:"query"`
+}
+
+type WorkspaceSymbolResponse struct {
+	Jsonrpc string              `json:"jsonrpc"`
+	Id      interface{}         `json:"id"`
+	Result  []SymbolInformation `json:"result"`
+}
+
+type SymbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
+// Kinds of SymbolInformation and DocumentSymbol.
+const (
+	SymbolModule      = 2
+	SymbolField       = 8
+	SymbolConstructor = 9
+	SymbolInterface   = 11
+	SymbolFunction    = 12
+	SymbolVariable    = 13
+	SymbolConstant    = 14
+	SymbolStruct      = 23
+)
+
+type FoldingRangeRequest struct {
+	Jsonrpc string             `json:"jsonrpc"`
+	Id      interface{}        `json:"id"`
+	Method  string             `json:"method"`
+	Params  FoldingRangeParams `json:"params"`
+}
+
+type FoldingRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type FoldingRangeResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Result  []FoldingRange `json:"result"`
+}
+
+type FoldingRange struct {
+	StartLine      int `json:"startLine"`
+	StartCharacter int `json:"startCharacter"`
+	EndLine        int `json:"endLine"`
+	EndCharacter   int `json:"endCharacter"`
+	// Kind is "comment", "imports" or "region".
+	Kind string `json:"kind,omitempty"`
+	// CollapsedText is shown instead of the folded lines by clients that
+	// support it.
+	CollapsedText string `json:"collapsedText,omitempty"`
+}
+
+type DocumentLinkRequest struct {
+	Jsonrpc string             `json:"jsonrpc"`
+	Id      interface{}        `json:"id"`
+	Method  string             `json:"method"`
+	Params  DocumentLinkParams `json:"params"`
+}
+
+type DocumentLinkParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentLinkResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Result  []DocumentLink `json:"result"`
+}
+
+type DocumentLink struct {
+	Range Range `json:"range"`
+	// Target is the URI of the linked file, with the line and column of
+	// the target as a fragment, e.g. "file:///app/wire.go#L7,5".
+	Target  string `json:"target,omitempty"`
+	Tooltip string `json:"tooltip,omitempty"`
+}
+
+type DocumentSymbolRequest struct {
+	Jsonrpc string               `json:"jsonrpc"`
+	Id      interface{}          `json:"id"`
+	Method  string               `json:"method"`
+	Params  DocumentSymbolParams `json:"params"`
+}
+
+type DocumentSymbolParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DocumentSymbolResponse struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Id      interface{}      `json:"id"`
+	Result  []DocumentSymbol `json:"result"`
+}
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type SemanticTokensRequest struct {
+	Jsonrpc string               `json:"jsonrpc"`
+	Id      interface{}          `json:"id"`
+	Method  string               `json:"method"`
+	Params  SemanticTokensParams `json:"params"`
+}
+
+type SemanticTokensParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type SemanticTokensResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      interface{}     `json:"id"`
+	Result  *SemanticTokens `json:"result"`
+}
+
+// SemanticTokens encodes each token as five integers: the line relative to
+// the previous token, the character relative to the previous token on the
+// same line or to the start of the line, the length, the index of the type
+// in the legend and the bit set of the indexes of the modifiers.
+type SemanticTokens struct {
+	Data []int `json:"data"`
+}
+
+type InlayHintRequest struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      interface{}     `json:"id"`
+	Method  string          `json:"method"`
+	Params  InlayHintParams `json:"params"`
+}
+
+type InlayHintParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+}
+
+type InlayHintResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  []InlayHint `json:"result"`
+}
+
+type InlayHint struct {
+	Position Position `json:"position"`
+	Label    string   `json:"label"`
+	Kind     int      `json:"kind,omitempty"`
+}
+
+// Kinds of InlayHint.
+const (
+	InlayHintType = 1
+)
+
+type PrepareCallHierarchyRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type PrepareCallHierarchyResponse struct {
+	Jsonrpc string              `json:"jsonrpc"`
+	Id      interface{}         `json:"id"`
+	Result  []CallHierarchyItem `json:"result"`
+}
+
+type CallHierarchyItem struct {
+	Name           string                `json:"name"`
+	Kind           int                   `json:"kind"`
+	Detail         string                `json:"detail,omitempty"`
+	Uri            string                `json:"uri"`
+	Range          Range                 `json:"range"`
+	SelectionRange Range                 `json:"selectionRange"`
+	Data           CallHierarchyItemData `json:"data"`
+}
+
+// CallHierarchyItemData identifies a CallHierarchyItem in the document
+// whose package was solved to find it.
+type CallHierarchyItemData struct {
+	Uri  string `json:"uri"`
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+}
+
+type CallHierarchyCallsRequest struct {
+	Jsonrpc string                   `json:"jsonrpc"`
+	Id      interface{}              `json:"id"`
+	Method  string                   `json:"method"`
+	Params  CallHierarchyCallsParams `json:"params"`
+}
+
+type CallHierarchyCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+type CallHierarchyIncomingCallsResponse struct {
+	Jsonrpc string                      `json:"jsonrpc"`
+	Id      interface{}                 `json:"id"`
+	Result  []CallHierarchyIncomingCall `json:"result"`
+}
+
+type CallHierarchyIncomingCall struct {
+	From       CallHierarchyItem `json:"from"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+type CallHierarchyOutgoingCallsResponse struct {
+	Jsonrpc string                      `json:"jsonrpc"`
+	Id      interface{}                 `json:"id"`
+	Result  []CallHierarchyOutgoingCall `json:"result"`
+}
+
+type CallHierarchyOutgoingCall struct {
+	To         CallHierarchyItem `json:"to"`
+	FromRanges []Range           `json:"fromRanges"`
+}
+
+type HoverRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type HoverResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  *Hover      `json:"result"`
+}
+
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+type CompletionRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type SignatureHelpOptions struct {
+	TriggerCharacters   []string `json:"triggerCharacters,omitempty"`
+	RetriggerCharacters []string `json:"retriggerCharacters,omitempty"`
+}
+
+type SignatureHelpRequest struct {
+	Jsonrpc string                     `json:"jsonrpc"`
+	Id      interface{}                `json:"id"`
+	Method  string                     `json:"method"`
+	Params  TextDocumentPositionParams `json:"params"`
+}
+
+type SignatureHelpResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Result  *SignatureHelp `json:"result"`
+}
+
+type SignatureHelp struct {
+	Signatures      []SignatureInformation `json:"signatures"`
+	ActiveSignature int                    `json:"activeSignature"`
+	ActiveParameter int                    `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	Label         string                 `json:"label"`
+	Documentation *MarkupContent         `json:"documentation,omitempty"`
+	Parameters    []ParameterInformation `json:"parameters"`
+}
+
+type ParameterInformation struct {
+	Label         string `json:"label"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+type CompletionResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      interface{}     `json:"id"`
+	Result  *CompletionList `json:"result"`
+}
+
+type CompletionList struct {
+	IsIncomplete bool             `json:"isIncomplete"`
+	Items        []CompletionItem `json:"items"`
+}
+
+type CompletionItem struct {
+	Label               string         `json:"label"`
+	Kind                int            `json:"kind,omitempty"`
+	Detail              string         `json:"detail,omitempty"`
+	Documentation       *MarkupContent `json:"documentation,omitempty"`
+	SortText            string         `json:"sortText,omitempty"`
+	InsertTextFormat    int            `json:"insertTextFormat,omitempty"`
+	TextEdit            *TextEdit      `json:"textEdit,omitempty"`
+	AdditionalTextEdits []TextEdit     `json:"additionalTextEdits,omitempty"`
+}
+
+// Kinds of CompletionItem.
+const (
+	CompletionFunction = 3
+	CompletionVariable = 6
+	CompletionSnippet  = 15
+)
+
+// InsertTextFormatSnippet is the InsertTextFormat of a CompletionItem whose
+// text has tab stops and placeholders, e.g. "${1:Set}".
+const InsertTextFormatSnippet = 2
+
+type ExecuteCommandRequest struct {
+	Jsonrpc string               `json:"jsonrpc"`
+	Id      interface{}          `json:"id"`
+	Method  string               `json:"method"`
+	Params  ExecuteCommandParams `json:"params"`
+}
+
+type ExecuteCommandParams struct {
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments"`
+}
+
+type ExecuteCommandResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Result  interface{}    `json:"result,omitempty"`
+	Error   *ResponseError `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse is the response to a request that failed. Id is nil, and
+// sent as null, if the id of the request could not be read.
+type ErrorResponse struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Id      interface{}    `json:"id"`
+	Error   *ResponseError `json:"error"`
+}
+
+// Error codes defined by JSON-RPC.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Error codes defined by the Language Server Protocol.
+const (
+	ServerNotInitialized = -32002
+	RequestCancelled     = -32800
+	RequestFailed        = -32803
+)
+
+// CheckResult is the result of the wireplus.check command. Diagnostics maps
+// the URI of each file with problems to its diagnostics, and is empty if
+// the package has none.
+type CheckResult struct {
+	Diagnostics map[string][]Diagnostic `json:"diagnostics"`
+}
+
+// PreviewDiffResult is the result of the wireplus.previewDiff command.
+// Diff is empty and UpToDate is true if the injector would not change.
+type PreviewDiffResult struct {
+	Uri      string `json:"uri"`
+	UpToDate bool   `json:"upToDate"`
+	Diff     string `json:"diff,omitempty"`
 }
 
 type TextDocumentNotification struct {
@@ -115,6 +786,46 @@ type TextDocumentParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
 
+type TextDocumentItem struct {
+	Uri        string `json:"uri"`
+	LanguageId string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+type VersionedTextDocumentIdentifier struct {
+	Uri     string `json:"uri"`
+	Version int    `json:"version"`
+}
+
+type DidOpenTextDocumentNotification struct {
+	Jsonrpc string                    `json:"jsonrpc"`
+	Method  string                    `json:"method"`
+	Params  DidOpenTextDocumentParams `json:"params"`
+}
+
+type DidOpenTextDocumentParams struct {
+	TextDocument TextDocumentItem `json:"textDocument"`
+}
+
+type DidChangeTextDocumentNotification struct {
+	Jsonrpc string                      `json:"jsonrpc"`
+	Method  string                      `json:"method"`
+	Params  DidChangeTextDocumentParams `json:"params"`
+}
+
+type DidChangeTextDocumentParams struct {
+	TextDocument   VersionedTextDocumentIdentifier  `json:"textDocument"`
+	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
+}
+
+// TextDocumentContentChangeEvent replaces the text in Range with Text, or
+// the whole document if Range is nil.
+type TextDocumentContentChangeEvent struct {
+	Range *Range `json:"range,omitempty"`
+	Text  string `json:"text"`
+}
+
 type PublishDiagnosticsNotification struct {
 	Jsonrpc string                   `json:"jsonrpc"`
 	Method  string                   `json:"method"`
@@ -126,7 +837,271 @@ type PublishDiagnosticsParams struct {
 	Diagnostics []Diagnostic `json:"diagnostics"`
 }
 
+type DocumentDiagnosticRequest struct {
+	Jsonrpc string                   `json:"jsonrpc"`
+	Id      interface{}              `json:"id"`
+	Method  string                   `json:"method"`
+	Params  DocumentDiagnosticParams `json:"params"`
+}
+
+type DocumentDiagnosticParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// PreviousResultId is the ResultId of the last report the client
+	// received for the document, if any.
+	PreviousResultId string `json:"previousResultId,omitempty"`
+}
+
+// DocumentDiagnosticResponse holds a *FullDocumentDiagnosticReport, or an
+// *UnchangedDocumentDiagnosticReport if the diagnostics of the document
+// are those of the previous result.
+type DocumentDiagnosticResponse struct {
+	Jsonrpc string      `json:"jsonrpc"`
+	Id      interface{} `json:"id"`
+	Result  interface{} `json:"result"`
+}
+
+type FullDocumentDiagnosticReport struct {
+	// Kind is "full".
+	Kind     string       `json:"kind"`
+	ResultId string       `json:"resultId"`
+	Items    []Diagnostic `json:"items"`
+}
+
+type UnchangedDocumentDiagnosticReport struct {
+	// Kind is "unchanged".
+	Kind     string `json:"kind"`
+	ResultId string `json:"resultId"`
+}
+
 type Diagnostic struct {
+	Range    Range `json:"range"`
+	Severity int   `json:"severity,omitempty"`
+	// Code identifies the kind of diagnostic, e.g. "wire/no-provider".
+	Code               string                         `json:"code,omitempty"`
+	Message            string                         `json:"message"`
+	RelatedInformation []DiagnosticRelatedInformation `json:"relatedInformation,omitempty"`
+}
+
+type DiagnosticRelatedInformation struct {
+	Location Location `json:"location"`
+	Message  string   `json:"message"`
+}
+
+// Severities of Diagnostic.
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+type DidChangeConfigurationNotification struct {
+	Jsonrpc string                       `json:"jsonrpc"`
+	Method  string                       `json:"method"`
+	Params  DidChangeConfigurationParams `json:"params"`
+}
+
+type DidChangeConfigurationParams struct {
+	Settings ConfigurationSettings `json:"settings"`
+}
+
+// ConfigurationSettings holds the settings of the client, of which those
+// of wireplus are in the wireplus section. Wireplus is nil if the client
+// sent none.
+type ConfigurationSettings struct {
+	Wireplus *Settings `json:"wireplus"`
+}
+
+type DidChangeWorkspaceFoldersNotification struct {
+	Jsonrpc string                          `json:"jsonrpc"`
+	Method  string                          `json:"method"`
+	Params  DidChangeWorkspaceFoldersParams `json:"params"`
+}
+
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
+type RegistrationRequest struct {
+	Jsonrpc string             `json:"jsonrpc"`
+	Id      int                `json:"id"`
+	Method  string             `json:"method"`
+	Params  RegistrationParams `json:"params"`
+}
+
+type RegistrationParams struct {
+	Registrations []Registration `json:"registrations"`
+}
+
+type Registration struct {
+	Id              string      `json:"id"`
+	Method          string      `json:"method"`
+	RegisterOptions interface{} `json:"registerOptions,omitempty"`
+}
+
+type DidChangeWatchedFilesRegistrationOptions struct {
+	Watchers []FileSystemWatcher `json:"watchers"`
+}
+
+type FileSystemWatcher struct {
+	GlobPattern string `json:"globPattern"`
+}
+
+type DidChangeWatchedFilesNotification struct {
+	Jsonrpc string                      `json:"jsonrpc"`
+	Method  string                      `json:"method"`
+	Params  DidChangeWatchedFilesParams `json:"params"`
+}
+
+type DidChangeWatchedFilesParams struct {
+	Changes []FileEvent `json:"changes"`
+}
+
+type FileEvent struct {
+	Uri  string `json:"uri"`
+	Type int    `json:"type"`
+}
+
+type CancelNotification struct {
+	Jsonrpc string       `json:"jsonrpc"`
+	Method  string       `json:"method"`
+	Params  CancelParams `json:"params"`
+}
+
+// CancelParams identifies the request to cancel by its id, which is a
+// number or a string.
+type CancelParams struct {
+	Id interface{} `json:"id"`
+}
+
+// Types of FileEvent.
+const (
+	FileCreated = 1
+	FileChanged = 2
+	FileDeleted = 3
+)
+
+type ApplyWorkspaceEditRequest struct {
+	Jsonrpc string                   `json:"jsonrpc"`
+	Id      int                      `json:"id"`
+	Method  string                   `json:"method"`
+	Params  ApplyWorkspaceEditParams `json:"params"`
+}
+
+type ApplyWorkspaceEditParams struct {
+	Label string        `json:"label,omitempty"`
+	Edit  WorkspaceEdit `json:"edit"`
+}
+
+type WorkspaceEdit struct {
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+type TextEdit struct {
 	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type ShowDocumentRequest struct {
+	Jsonrpc string             `json:"jsonrpc"`
+	Id      int                `json:"id"`
+	Method  string             `json:"method"`
+	Params  ShowDocumentParams `json:"params"`
+}
+
+type ShowDocumentParams struct {
+	Uri       string `json:"uri"`
+	TakeFocus bool   `json:"takeFocus,omitempty"`
+	Selection *Range `json:"selection,omitempty"`
+}
+
+type WorkDoneProgressCreateRequest struct {
+	Jsonrpc string                       `json:"jsonrpc"`
+	Id      int                          `json:"id"`
+	Method  string                       `json:"method"`
+	Params  WorkDoneProgressCreateParams `json:"params"`
+}
+
+type WorkDoneProgressCreateParams struct {
+	Token string `json:"token"`
+}
+
+// WorkDoneProgressCancelNotification asks the server to cancel the work
+// reported with a cancellable progress.
+type WorkDoneProgressCancelNotification struct {
+	Jsonrpc string                       `json:"jsonrpc"`
+	Method  string                       `json:"method"`
+	Params  WorkDoneProgressCancelParams `json:"params"`
+}
+
+type WorkDoneProgressCancelParams struct {
+	Token string `json:"token"`
+}
+
+type ProgressNotification struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Method  string         `json:"method"`
+	Params  ProgressParams `json:"params"`
+}
+
+// ProgressParams reports progress on the work identified by Token. Value
+// is a WorkDoneProgressBegin, WorkDoneProgressReport or
+// WorkDoneProgressEnd.
+type ProgressParams struct {
+	Token string      `json:"token"`
+	Value interface{} `json:"value"`
+}
+
+type WorkDoneProgressBegin struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Message string `json:"message,omitempty"`
+	// Cancellable reports whether the client may cancel the work with
+	// window/workDoneProgress/cancel.
+	Cancellable bool `json:"cancellable,omitempty"`
+}
+
+type WorkDoneProgressReport struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message,omitempty"`
+}
+
+type WorkDoneProgressEnd struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message,omitempty"`
+}
+
+type LogMessageNotification struct {
+	Jsonrpc string           `json:"jsonrpc"`
+	Method  string           `json:"method"`
+	Params  LogMessageParams `json:"params"`
+}
+
+type LogMessageParams struct {
+	Type    int    `json:"type"`
+	Message string `json:"message"`
+}
+
+type ShowMessageNotification struct {
+	Jsonrpc string            `json:"jsonrpc"`
+	Method  string            `json:"method"`
+	Params  ShowMessageParams `json:"params"`
+}
+
+type ShowMessageParams struct {
+	Type    int    `json:"type"`
 	Message string `json:"message"`
 }
+
+// Message types of LogMessageParams and ShowMessageParams.
+const (
+	MessageError   = 1
+	MessageWarning = 2
+	MessageInfo    = 3
+	MessageLog     = 4
+)
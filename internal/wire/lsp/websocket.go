@@ -0,0 +1,260 @@
+package lsp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// webSocketGUID is appended to the key of the client to compute the
+// Sec-WebSocket-Accept header, see RFC 6455, section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes, see RFC 6455, section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// UpgradeWebSocket upgrades the HTTP request r to a WebSocket and returns a
+// Transport exchanging each message as the JSON content of a text frame,
+// without headers, as browser-based clients do. If r is not a WebSocket
+// handshake, it answers r with an error and returns the error.
+//
+// The handshakes of web pages are refused unless their Origin is on a
+// loopback host or is one of origins, where "*" allows any origin: the
+// client may set the environment and flags of the go command the server
+// runs, which must not be left to any page open in a browser. Handshakes
+// without an Origin, which browsers always send, are accepted.
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request, origins []string) (Transport, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, errors.New("request is not a WebSocket handshake")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" && !allowedOrigin(origin, origins) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return nil, fmt.Errorf("origin %q is not allowed", origin)
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("unsupported WebSocket version %q", v)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("connection cannot be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade connection: %v", err)
+	}
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to upgrade connection: %v", err)
+	}
+	return &webSocketTransport{conn: conn, r: rw.Reader}, nil
+}
+
+// allowedOrigin reports whether origin, the Origin header of a handshake,
+// is on a loopback host or is one of origins.
+func allowedOrigin(origin string, origins []string) bool {
+	for _, o := range origins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return IsLoopback(u.Hostname())
+}
+
+// IsLoopback reports whether host is localhost or a loopback IP address.
+func IsLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// headerContains reports whether a comma-separated value of the header
+// name is token, ignoring case.
+func headerContains(h http.Header, name string, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type webSocketTransport struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// mu serializes the frames written, which include the pongs and the
+	// close frame written while reading.
+	mu sync.Mutex
+}
+
+// ReadMessage returns the payload of the next text or binary message,
+// reassembled from its fragments. Pings are answered while reading, and a
+// close frame is answered and reported as io.EOF.
+func (t *webSocketTransport) ReadMessage() ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := t.readFrame()
+		if err != nil {
+			if err == io.EOF && started {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := t.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			t.writeFrame(opClose, nil)
+			return nil, io.EOF
+		case opText, opBinary:
+			if started {
+				return nil, errors.New("new WebSocket message before the end of the previous one")
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				return nil, errors.New("WebSocket continuation frame without a message")
+			}
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %#x", op)
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads a frame, which clients must mask, and returns its
+// unmasked payload. It returns io.EOF if the connection is closed before
+// the frame starts.
+func (t *webSocketTransport) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(t.r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0f
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("WebSocket frame from the client is not masked")
+	}
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(t.r, ext[:]); err != nil {
+			return false, 0, nil, unexpectedEOF(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(t.r, ext[:]); err != nil {
+			return false, 0, nil, unexpectedEOF(err)
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > 1<<31 {
+		return false, 0, nil, fmt.Errorf("WebSocket frame of %d bytes is too large", length)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(t.r, mask[:]); err != nil {
+		return false, 0, nil, unexpectedEOF(err)
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(t.r, payload); err != nil {
+		return false, 0, nil, unexpectedEOF(err)
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeFrame writes payload as a single unmasked frame, as servers do.
+func (t *webSocketTransport) writeFrame(op byte, payload []byte) error {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(frame, 127)
+		frame = append(frame, ext[:]...)
+	}
+	frame = append(frame, payload...)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.conn.Write(frame)
+	return err
+}
+
+func (t *webSocketTransport) WriteMessage(res interface{}) error {
+	content, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("error serializing message: %v", err)
+	}
+	if err := t.writeFrame(opText, content); err != nil {
+		return fmt.Errorf("error writing message: %v", err)
+	}
+	return nil
+}
+
+// Close sends a close frame and closes the connection.
+func (t *webSocketTransport) Close() error {
+	t.writeFrame(opClose, nil)
+	return t.conn.Close()
+}
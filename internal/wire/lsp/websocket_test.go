@@ -0,0 +1,195 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// writeClientFrame writes payload as a frame masked as clients do.
+func writeClientFrame(t *testing.T, w io.Writer, fin bool, op byte, payload []byte) {
+	t.Helper()
+	first := op
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := w.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame reads an unmasked frame as servers write them.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		t.Fatal(err)
+	}
+	if head[0]&0x80 == 0 || head[1]&0x80 != 0 {
+		t.Fatalf("got frame header %x; want a final unmasked frame", head)
+	}
+	n := int(head[1])
+	if n == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	done := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr, err := UpgradeWebSocket(w, r, nil)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer tr.Close()
+		// Echo messages until the client closes the connection.
+		for {
+			buf, err := tr.ReadMessage()
+			if err != nil {
+				done <- err
+				return
+			}
+			tr.WriteMessage(NewErrorResponse(string(buf), InternalError, "echo"))
+		}
+	}))
+	defer srv.Close()
+
+	// A request that is not a handshake is refused.
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d for a plain request; want %d", res.StatusCode, http.StatusBadRequest)
+	}
+	if err := <-done; err == nil {
+		t.Error("UpgradeWebSocket succeeded for a plain request")
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The key and accept values are those of the example in RFC 6455.
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	res, err = http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("got handshake response %d %v; want 101 with the accept key", res.StatusCode, res.Header)
+	}
+
+	// A fragmented message is reassembled, and pings are answered in
+	// between.
+	long := strings.Repeat("x", 200)
+	writeClientFrame(t, conn, false, opText, []byte(`{"a":"`))
+	writeClientFrame(t, conn, true, opPing, []byte("ping"))
+	writeClientFrame(t, conn, true, opContinuation, []byte(long+`"}`))
+	if op, payload := readServerFrame(t, r); op != opPong || string(payload) != "ping" {
+		t.Errorf("got frame %#x %q; want pong", op, payload)
+	}
+	op, payload := readServerFrame(t, r)
+	want := `{"jsonrpc":"2.0","id":"{\"a\":\"` + long + `\"}","error":{"code":-32603,"message":"echo"}}`
+	if op != opText || string(payload) != want {
+		t.Errorf("got frame %#x %s; want text %s", op, payload, want)
+	}
+
+	// Closing the connection ends the messages.
+	writeClientFrame(t, conn, true, opClose, nil)
+	if op, _ := readServerFrame(t, r); op != opClose {
+		t.Errorf("got frame %#x; want close", op)
+	}
+	if err := <-done; err != io.EOF {
+		t.Errorf("ReadMessage after close = %v; want %v", err, io.EOF)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr, err := UpgradeWebSocket(w, r, []string{"https://editor.example.com/"})
+		if err == nil {
+			tr.Close()
+		}
+	}))
+	defer srv.Close()
+	tests := []struct {
+		origin string
+		want   int
+	}{
+		// Clients that are not web pages send no origin.
+		{"", http.StatusSwitchingProtocols},
+		{"http://localhost:8080", http.StatusSwitchingProtocols},
+		{"http://127.0.0.1:3000", http.StatusSwitchingProtocols},
+		{"http://[::1]", http.StatusSwitchingProtocols},
+		{"https://editor.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		// A page of another host resolving to a loopback address still has
+		// its own origin.
+		{"http://localhost.evil.example.com", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+		if test.origin != "" {
+			req += "Origin: " + test.origin + "\r\n"
+		}
+		io.WriteString(conn, req+"\r\n")
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != test.want {
+			t.Errorf("handshake with origin %q got status %d; want %d", test.origin, res.StatusCode, test.want)
+		}
+	}
+}
+
+func TestWebSocketWriteError(t *testing.T) {
+	server, client := net.Pipe()
+	client.Close()
+	tr := &webSocketTransport{conn: server, r: bufio.NewReader(server)}
+	if err := tr.WriteMessage(make(chan int)); err == nil {
+		t.Error("WriteMessage succeeded for a value that is not JSON")
+	}
+	if err := tr.WriteMessage(NewErrorResponse(1, InternalError, "closed")); err == nil {
+		t.Error("WriteMessage succeeded on a closed connection")
+	}
+}
@@ -0,0 +1,162 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"go/types"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// manifestFileName is the name of the file written by Generate with
+// GenerateOptions.EmitManifest, after the output file prefix.
+const manifestFileName = "wire_manifest_gen.go"
+
+// manifestInjector is the construction plan of an injector, as written to
+// the manifest file.
+type manifestInjector struct {
+	name  string
+	steps []manifestStep
+}
+
+// manifestStep describes a call in the construction plan of an injector.
+type manifestStep struct {
+	// name identifies the provider, value or field, typ is the type it
+	// provides and pos is its position in the source.
+	name string
+	typ  string
+	pos  string
+}
+
+// addManifest records calls as the construction plan of the injector
+// name, which uses set.
+func (g *gen) addManifest(name string, set *ProviderSet, calls []call) {
+	inj := manifestInjector{name: name}
+	for i := range calls {
+		c := &calls[i]
+		step := manifestStep{
+			name: providerID(set, c),
+			typ:  types.TypeString(c.out, nil),
+		}
+		var pos token.Pos
+		pt := set.For(c.out)
+		switch c.kind {
+		case funcProviderCall, structProvider:
+			if p := pt.Provider(); p != nil {
+				pos = p.Pos
+			}
+		case valueExpr:
+			if v := pt.Value(); v != nil {
+				pos = v.Pos
+			}
+		case selectorExpr:
+			if f := pt.Field(); f != nil {
+				pos = f.Pos
+			}
+		}
+		step.pos = g.sourcePos(pos)
+		inj.steps = append(inj.steps, step)
+	}
+	g.manifest = append(g.manifest, inj)
+}
+
+// providerID returns the stable identifier of the provider, value or field
+// of c. Providers are identified by their import path and name, as passed
+// to wire.TraceHooks, fields by their parent type and name, and all values
+// by "wire.Value". set is the provider set of c and is only used for fields.
+func providerID(set *ProviderSet, c *call) string {
+	switch c.kind {
+	case funcProviderCall, structProvider:
+		return c.pkg.Path() + "." + c.name
+	case valueExpr:
+		return "wire.Value"
+	case selectorExpr:
+		f := set.For(c.out).Field()
+		return types.TypeString(f.Parent, nil) + "." + f.Name
+	}
+	panic("unknown kind")
+}
+
+// sourcePos formats pos in the style of AnonSetID, as the import path of
+// the package of the file followed by its base name, so that it does not
+// depend on where the source is.
+func (g *gen) sourcePos(pos token.Pos) string {
+	if !pos.IsValid() {
+		return ""
+	}
+	if g.pkgDirs == nil {
+		g.pkgDirs = make(map[string]string)
+		packages.Visit([]*packages.Package{g.pkg}, nil, func(pkg *packages.Package) {
+			for _, f := range pkg.CompiledGoFiles {
+				g.pkgDirs[filepath.Dir(f)] = pkg.PkgPath
+			}
+		})
+	}
+	p := g.pkg.Fset.Position(pos)
+	name := filepath.Base(p.Filename)
+	if pkgPath, ok := g.pkgDirs[filepath.Dir(p.Filename)]; ok {
+		name = pkgPath + "/" + name
+	}
+	return fmt.Sprintf("%s:%d:%d", name, p.Line, p.Column)
+}
+
+// manifestFrame returns the unformatted source of the manifest file, or nil
+// if the package has no injectors.
+func (g *gen) manifestFrame() []byte {
+	if len(g.manifest) == 0 {
+		return nil
+	}
+	scope := g.pkg.Types.Scope()
+	var declared []string
+	collides := func(name string) bool {
+		if scope.Lookup(name) != nil {
+			return true
+		}
+		for _, d := range declared {
+			if d == name {
+				return true
+			}
+		}
+		return false
+	}
+	declare := func(name string) string {
+		name = disambiguate(name, collides)
+		declared = append(declared, name)
+		return name
+	}
+	typeName := declare("WireProvider")
+	varName := declare("wireManifest")
+
+	var buf bytes.Buffer
+	buf.WriteString(generatedHeader + "\n\n")
+	buf.WriteString("//+build !wireinject\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", g.pkg.Name)
+	fmt.Fprintf(&buf, "// %s describes a step of the construction plan of an injector.\n", typeName)
+	fmt.Fprintf(&buf, "type %s struct {\n", typeName)
+	buf.WriteString("\t// Name identifies the provider, value or field.\n\tName string\n")
+	buf.WriteString("\t// Type is the type provided by the step.\n\tType string\n")
+	buf.WriteString("\t// Pos is the position of the provider in the source.\n\tPos string\n")
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(&buf, "// %s holds the construction plans of the injectors in the package, in call order.\n", varName)
+	fmt.Fprintf(&buf, "var %s = []%s{\n", varName, typeName)
+	for _, inj := range g.manifest {
+		fmt.Fprintf(&buf, "\t// %s\n", inj.name)
+		for _, step := range inj.steps {
+			fmt.Fprintf(&buf, "\t{Name: %q, Type: %q, Pos: %q},\n", step.name, step.typ, step.pos)
+		}
+	}
+	buf.WriteString("}\n\n")
+	start := 0
+	for _, inj := range g.manifest {
+		end := start + len(inj.steps)
+		accessor := declare(inj.name + "Manifest")
+		fmt.Fprintf(&buf, "// %s returns the construction plan of %s.\n", accessor, inj.name)
+		fmt.Fprintf(&buf, "func %s() []%s {\n", accessor, typeName)
+		fmt.Fprintf(&buf, "\treturn append([]%s(nil), %s[%d:%d]...)\n", typeName, varName, start, end)
+		buf.WriteString("}\n\n")
+		start = end
+	}
+	return buf.Bytes()
+}
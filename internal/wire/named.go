@@ -0,0 +1,107 @@
+package wire
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A NamedDecl is a top-level provider set variable or injector function
+// found by FindNamed.
+type NamedDecl struct {
+	// Pkg is the package declaring the provider set or injector.
+	Pkg *packages.Package
+	// Name is the name of the variable or function.
+	Name string
+	// Injector is true if the declaration is a function calling wire.Build,
+	// and false if it is a provider set variable.
+	Injector bool
+	// Pos is the position of the name in the declaration.
+	Pos token.Pos
+}
+
+// String returns the kind of the declaration followed by its package path
+// and name, e.g. `injector "example.com/foo".initApp`.
+func (d *NamedDecl) String() string {
+	kind := "provider set"
+	if d.Injector {
+		kind = "injector"
+	}
+	return kind + " " + strconv.Quote(d.Pkg.PkgPath) + "." + d.Name
+}
+
+// FindNamed returns the provider sets and injectors named name declared at
+// the top level of pkgs, in the order of pkgs. Injectors calling wire.Build
+// incorrectly are included, so that solving them reports the problem.
+func FindNamed(pkgs []*packages.Package, name string) []*NamedDecl {
+	var decls []*NamedDecl
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || isWireImport(pkg.PkgPath) {
+			continue
+		}
+		if obj := pkg.Types.Scope().Lookup(name); obj != nil && isProviderSetType(obj.Type()) {
+			decls = append(decls, &NamedDecl{Pkg: pkg, Name: name, Pos: obj.Pos()})
+			continue
+		}
+		if fn := findFuncDecl(pkg, name); fn != nil && fn.Recv == nil {
+			if build, err := findInjectorBuild(pkg.TypesInfo, fn); build != nil || err != nil {
+				decls = append(decls, &NamedDecl{Pkg: pkg, Name: name, Injector: true, Pos: fn.Name.Pos()})
+			}
+		}
+	}
+	return decls
+}
+
+// AllNamed returns the provider sets and injectors declared at the top
+// level of pkgs, but not of their dependencies. The declarations of each
+// package are sorted by name.
+func AllNamed(pkgs []*packages.Package) []*NamedDecl {
+	var decls []*NamedDecl
+	for _, pkg := range pkgs {
+		if pkg.Types == nil || isWireImport(pkg.PkgPath) {
+			continue
+		}
+		var pkgDecls []*NamedDecl
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			if obj := scope.Lookup(name); isProviderSetType(obj.Type()) {
+				if _, ok := obj.(*types.Var); ok {
+					pkgDecls = append(pkgDecls, &NamedDecl{Pkg: pkg, Name: name, Pos: obj.Pos()})
+				}
+			}
+		}
+		for _, name := range injectorNames(pkg) {
+			if fn := findFuncDecl(pkg, name); fn != nil && fn.Recv == nil {
+				pkgDecls = append(pkgDecls, &NamedDecl{Pkg: pkg, Name: name, Injector: true, Pos: fn.Name.Pos()})
+			}
+		}
+		sort.SliceStable(pkgDecls, func(i, j int) bool { return pkgDecls[i].Name < pkgDecls[j].Name })
+		decls = append(decls, pkgDecls...)
+	}
+	return decls
+}
+
+// ResolveNamed returns the provider set or injector named name in pkgs,
+// which were loaded from patterns. It returns an error if none of pkgs
+// declares one, or if more than one does, listing the candidates with
+// their package paths.
+func ResolveNamed(pkgs []*packages.Package, patterns []string, name string) (*NamedDecl, error) {
+	decls := FindNamed(pkgs, name)
+	switch len(decls) {
+	case 0:
+		return nil, fmt.Errorf("no provider set or injector named %s found in %s", name, strings.Join(patterns, " "))
+	case 1:
+		return decls[0], nil
+	}
+	candidates := make([]string, len(decls))
+	for i, d := range decls {
+		candidates[i] = d.String()
+	}
+	sort.Strings(candidates)
+	return nil, fmt.Errorf("%s is ambiguous in %s; pass the package of one of:\n\t%s", name, strings.Join(patterns, " "), strings.Join(candidates, "\n\t"))
+}
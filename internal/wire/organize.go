@@ -0,0 +1,191 @@
+package wire
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// Groups of the arguments of wire.Build and wire.NewSet, in the order
+// OrganizeProviders sorts them.
+const (
+	argSet = iota
+	argProvider
+	argOther
+)
+
+// organizedArg is an argument of a call organized by OrganizeProviders.
+type organizedArg struct {
+	group int
+	// pkgPath and name identify the set or provider, which are sorted by
+	// them, the package of the file first.
+	pkgPath, name string
+	// text is the formatted argument, with its own calls organized.
+	text string
+	// key identifies duplicates: the set or provider, or else text.
+	key string
+}
+
+// OrganizeProviders returns the edits sorting the arguments of the
+// wire.Build and wire.NewSet calls in the file of pkg named filename into
+// a canonical order, in source order, or nil if they are already sorted or
+// pkg has no such file. Provider sets come first, then provider functions,
+// each grouped by package, the package of the file first and the others
+// by path, and sorted by name. The other arguments, such as bindings and
+// values, come last in their original order. Duplicate arguments are
+// removed. Calls containing comments are left alone, as their comments
+// could not be moved along with the arguments.
+//
+// The arguments of a call spanning several lines are put on a line each,
+// as they are in large injectors.
+func OrganizeProviders(pkg *packages.Package, filename string) []Edit {
+	var file *ast.File
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			file = f
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	var edits []Edit
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || !isWireCall(pkg.TypesInfo, call, "Build", "NewSet") {
+			return true
+		}
+		text, changed, ok := organizeCall(pkg, file, call)
+		if ok && changed {
+			edits = append(edits, Edit{Pos: call.Args[0].Pos(), End: call.Args[len(call.Args)-1].End(), NewText: text})
+		}
+		// The calls among the arguments were organized along with call,
+		// or left alone with it.
+		return false
+	})
+	return edits
+}
+
+// organizeCall returns the organized arguments of call, and whether they
+// differ from the original ones. It returns false if call cannot be
+// organized, e.g. for comments among its arguments.
+func organizeCall(pkg *packages.Package, file *ast.File, call *ast.CallExpr) (string, bool, bool) {
+	if len(call.Args) == 0 || call.Ellipsis.IsValid() {
+		return "", false, true
+	}
+	for _, cg := range file.Comments {
+		if call.Lparen < cg.Pos() && cg.End() <= call.Rparen {
+			return "", false, false
+		}
+	}
+	info := pkg.TypesInfo
+	changed := false
+	args := make([]*organizedArg, 0, len(call.Args))
+	for _, arg := range call.Args {
+		a := &organizedArg{group: argOther}
+		switch x := astutil.Unparen(arg).(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			id, _ := x.(*ast.Ident)
+			if sel, ok := x.(*ast.SelectorExpr); ok {
+				id = sel.Sel
+			}
+			switch obj := info.ObjectOf(id).(type) {
+			case *types.Var:
+				if obj.Pkg() != nil && isProviderSetType(obj.Type()) {
+					a.group, a.pkgPath, a.name = argSet, obj.Pkg().Path(), obj.Name()
+				}
+			case *types.Func:
+				if obj.Pkg() != nil && obj.Type().(*types.Signature).Recv() == nil {
+					a.group, a.pkgPath, a.name = argProvider, obj.Pkg().Path(), obj.Name()
+				}
+			}
+		case *ast.CallExpr:
+			if x == arg && isWireCall(info, x, "NewSet") {
+				a.group = argSet
+				text, innerChanged, ok := organizeCall(pkg, file, x)
+				if !ok {
+					return "", false, false
+				}
+				if innerChanged {
+					changed = true
+					fun, err := formatNode(pkg.Fset, x.Fun)
+					if err != nil {
+						return "", false, false
+					}
+					a.text = fun + "(" + text + ")"
+				}
+			}
+		}
+		if a.text == "" {
+			text, err := formatNode(pkg.Fset, arg)
+			if err != nil {
+				return "", false, false
+			}
+			a.text = text
+		}
+		a.key = a.text
+		if a.name != "" {
+			a.key = a.pkgPath + "." + a.name
+		}
+		args = append(args, a)
+	}
+	organized := make([]*organizedArg, 0, len(args))
+	seen := make(map[string]bool, len(args))
+	for _, a := range args {
+		if !seen[a.key] {
+			seen[a.key] = true
+			organized = append(organized, a)
+		}
+	}
+	sort.SliceStable(organized, func(i, j int) bool {
+		ai, aj := organized[i], organized[j]
+		if ai.group != aj.group {
+			return ai.group < aj.group
+		}
+		if ai.name == "" || aj.name == "" {
+			// Nested sets come after the named ones, and keep their
+			// order, as do the other arguments.
+			return ai.name != "" && aj.name == ""
+		}
+		if (ai.pkgPath == pkg.PkgPath) != (aj.pkgPath == pkg.PkgPath) {
+			return ai.pkgPath == pkg.PkgPath
+		}
+		if ai.pkgPath != aj.pkgPath {
+			return ai.pkgPath < aj.pkgPath
+		}
+		return ai.name < aj.name
+	})
+	if len(organized) != len(args) {
+		changed = true
+	}
+	for i, a := range organized {
+		if a != args[i] {
+			changed = true
+		}
+	}
+	sep := ", "
+	first := pkg.Fset.Position(call.Args[0].Pos())
+	if pkg.Fset.Position(call.Lparen).Line != first.Line {
+		sep = ",\n" + strings.Repeat("\t", first.Column-1)
+	}
+	texts := make([]string, len(organized))
+	for i, a := range organized {
+		texts[i] = a.text
+	}
+	return strings.Join(texts, sep), changed, true
+}
+
+// formatNode returns the source of node, formatted.
+func formatNode(fset *token.FileSet, node ast.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
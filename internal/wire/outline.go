@@ -0,0 +1,207 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of OutlineItem.
+const (
+	OutlineProviderSet = "provider set"
+	OutlineInjector    = "injector"
+	OutlineProvider    = "provider"
+	OutlineImport      = "import"
+	OutlineBinding     = "binding"
+	OutlineValue       = "value"
+	OutlineStruct      = "struct"
+	OutlineFields      = "fields"
+)
+
+// An OutlineItem is a provider set, an injector or an argument of their
+// wire.NewSet or wire.Build call, as found by Outline.
+type OutlineItem struct {
+	// Name is the name of the provider set or injector, the expression of a
+	// provider or imported set, e.g. "NewConfig" or "config.Set", the type
+	// involved in another argument, e.g. "Config" for wire.Struct,
+	// "Fooer = *Foo" for a binding, or "wire.NewSet" for a nested set.
+	Name string
+	// Kind is one of the Outline constants.
+	Kind string
+	// Detail is the type of a provider set variable, injector or provider,
+	// with the types of the package unqualified and the others qualified by
+	// the name of their package.
+	Detail string
+	// Pos and End delimit the argument or declaration, which includes the
+	// var keyword unless the declaration is grouped in parentheses.
+	Pos, End token.Pos
+	// NamePos is the position of the name of a declaration, or NoPos for
+	// an argument.
+	NamePos token.Pos
+	// Lparen and Rparen are the positions of the parentheses of the
+	// wire.NewSet or wire.Build call of a provider set or injector, or of
+	// a nested wire.NewSet call, and NoPos for other items.
+	Lparen, Rparen token.Pos
+	// Children lists the arguments of the wire.NewSet or wire.Build call of
+	// a provider set or injector, and of a nested wire.NewSet call, in
+	// order.
+	Children []*OutlineItem
+}
+
+// Outline returns the top-level provider sets declared with wire.NewSet
+// and the injectors in the file of pkg named filename, in source order,
+// or nil if pkg has no such file.
+func Outline(pkg *packages.Package, filename string) []*OutlineItem {
+	var file *ast.File
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			file = f
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	info := pkg.TypesInfo
+	qualifier := nameQualifier(pkg.Types)
+	var items []*OutlineItem
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				// A declaration without parentheses is delimited by the
+				// var keyword.
+				pos := spec.Pos()
+				if !decl.Lparen.IsValid() {
+					pos = decl.Pos()
+				}
+				for i, id := range spec.Names {
+					obj := info.Defs[id]
+					if obj == nil || !isProviderSetType(obj.Type()) || i >= len(spec.Values) {
+						continue
+					}
+					call, ok := astutil.Unparen(spec.Values[i]).(*ast.CallExpr)
+					if !ok || !isWireCall(info, call, "NewSet") {
+						continue
+					}
+					items = append(items, &OutlineItem{
+						Name:     id.Name,
+						Kind:     OutlineProviderSet,
+						Detail:   types.TypeString(obj.Type(), qualifier),
+						Pos:      pos,
+						End:      spec.End(),
+						NamePos:  id.Pos(),
+						Lparen:   call.Lparen,
+						Rparen:   call.Rparen,
+						Children: outlineArgs(info, qualifier, call),
+					})
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Recv != nil {
+				continue
+			}
+			build, err := findInjectorBuild(info, decl)
+			if build == nil || err != nil {
+				continue
+			}
+			items = append(items, &OutlineItem{
+				Name:     decl.Name.Name,
+				Kind:     OutlineInjector,
+				Detail:   types.TypeString(info.Defs[decl.Name].Type(), qualifier),
+				Pos:      decl.Pos(),
+				End:      decl.End(),
+				NamePos:  decl.Name.Pos(),
+				Lparen:   build.Lparen,
+				Rparen:   build.Rparen,
+				Children: outlineArgs(info, qualifier, build),
+			})
+		}
+	}
+	return items
+}
+
+// outlineArgs returns the items of the arguments of call, a wire.NewSet or
+// wire.Build call. Arguments that add no provider, such as wire.Requires,
+// and invalid arguments are left out.
+func outlineArgs(info *types.Info, qualifier types.Qualifier, call *ast.CallExpr) []*OutlineItem {
+	var items []*OutlineItem
+	for _, arg := range call.Args {
+		item := &OutlineItem{Pos: arg.Pos(), End: arg.End()}
+		if c, ok := astutil.Unparen(arg).(*ast.CallExpr); ok {
+			// typeArg returns the type of the argument of c at i, which
+			// is the type T of new(T) for all but wire.Value.
+			typeArg := func(i int, ptr bool) string {
+				if i >= len(c.Args) {
+					return "?"
+				}
+				t := info.TypeOf(c.Args[i])
+				if p, ok := t.(*types.Pointer); ok && ptr {
+					t = p.Elem()
+				}
+				if t == nil {
+					return "?"
+				}
+				return types.TypeString(t, qualifier)
+			}
+			switch {
+			case isWireCall(info, c, "NewSet"):
+				item.Name = "wire.NewSet"
+				item.Kind = OutlineProviderSet
+				item.Lparen, item.Rparen = c.Lparen, c.Rparen
+				item.Children = outlineArgs(info, qualifier, c)
+			case isWireCall(info, c, "Bind"):
+				item.Name = typeArg(0, true) + " = " + typeArg(1, true)
+				item.Kind = OutlineBinding
+			case isWireCall(info, c, "Value"):
+				item.Name = typeArg(0, false)
+				item.Kind = OutlineValue
+			case isWireCall(info, c, "InterfaceValue"):
+				item.Name = typeArg(0, true)
+				item.Kind = OutlineValue
+			case isWireCall(info, c, "Struct"):
+				item.Name = typeArg(0, true)
+				item.Kind = OutlineStruct
+			case isWireCall(info, c, "FieldsOf"):
+				item.Name = typeArg(0, true)
+				item.Kind = OutlineFields
+			default:
+				continue
+			}
+			items = append(items, item)
+			continue
+		}
+		switch obj := qualifiedIdentObject(info, astutil.Unparen(arg)).(type) {
+		case *types.Func:
+			item.Kind = OutlineProvider
+			item.Detail = types.TypeString(obj.Type(), qualifier)
+		case *types.Var:
+			if !isProviderSetType(obj.Type()) {
+				continue
+			}
+			item.Kind = OutlineImport
+		default:
+			continue
+		}
+		item.Name = types.ExprString(arg)
+		items = append(items, item)
+	}
+	return items
+}
+
+// nameQualifier qualifies the types of packages other than pkg by the name
+// of their package.
+func nameQualifier(pkg *types.Package) types.Qualifier {
+	return func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+}
@@ -0,0 +1,105 @@
+package wire
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// CategoryPointerValueOverlap is the category of the warning reported when
+// a solved graph provides both a type and a pointer to it.
+const CategoryPointerValueOverlap = "pointer-value-overlap"
+
+// ignoreDirective is the comment directive that suppresses warnings for an
+// injector, e.g. "//wire:ignore pointer-value-overlap".
+const ignoreDirective = "//wire:ignore"
+
+// isIgnored reports whether doc contains a //wire:ignore directive for
+// category. A directive without categories ignores all of them.
+func isIgnored(doc *ast.CommentGroup, category string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, ignoreDirective) {
+			continue
+		}
+		rest := c.Text[len(ignoreDirective):]
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+		categories := strings.Fields(rest)
+		if len(categories) == 0 {
+			return true
+		}
+		for _, cat := range categories {
+			if cat == category {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pointerValueOverlaps returns a warning for each type T such that both T
+// and *T are provided in the graph solved by calls, either by a call or as
+// an argument of the injector. Named types whose underlying type is a
+// pointer are distinct from the pointer and are not reported.
+func pointerValueOverlaps(fset *token.FileSet, inj *InjectorArgs, set *ProviderSet, calls []call, out types.Type) []error {
+	var provided []types.Type
+	for i := 0; i < inj.Tuple.Len(); i++ {
+		provided = append(provided, inj.Tuple.At(i).Type())
+	}
+	for i := range calls {
+		provided = append(provided, calls[i].out)
+	}
+	var warnings []error
+	for _, t := range provided {
+		ptr, ok := t.(*types.Pointer)
+		if !ok || !containsType(provided, ptr.Elem()) {
+			continue
+		}
+		sb := new(strings.Builder)
+		fmt.Fprintf(sb, "%s: %s and %s are both provided", CategoryPointerValueOverlap,
+			types.TypeString(ptr.Elem(), nil), types.TypeString(ptr, nil))
+		for _, typ := range []types.Type{ptr.Elem(), ptr} {
+			fmt.Fprintf(sb, "\n%s:\n<- %s", types.TypeString(typ, nil), leafSrc(set, typ).description(fset, typ))
+			consumers := consumerDescriptions(fset, inj, set, calls, out, typ)
+			if len(consumers) == 0 {
+				sb.WriteString("\nconsumed by nothing")
+				continue
+			}
+			fmt.Fprintf(sb, "\nconsumed by:\n-> %s", strings.Join(consumers, "\n-> "))
+		}
+		warnings = append(warnings, notePosition(fset.Position(inj.Pos),
+			fmt.Errorf("inject %s: %s", inj.Name, sb.String())))
+	}
+	return warnings
+}
+
+// consumerDescriptions describes the calls taking t as an argument and the
+// injector itself if it returns t.
+func consumerDescriptions(fset *token.FileSet, inj *InjectorArgs, set *ProviderSet, calls []call, out types.Type, t types.Type) []string {
+	var descs []string
+	for i := range calls {
+		if containsType(calls[i].ins, t) {
+			descs = append(descs, leafSrc(set, calls[i].out).description(fset, calls[i].out))
+		}
+	}
+	if types.Identical(out, t) {
+		descs = append(descs, fmt.Sprintf("injector function %s (%s)", inj.Name, fset.Position(inj.Pos)))
+	}
+	return descs
+}
+
+// containsType reports whether ts contains a type identical to t.
+func containsType(ts []types.Type, t types.Type) bool {
+	for _, u := range ts {
+		if types.Identical(t, u) {
+			return true
+		}
+	}
+	return false
+}
@@ -19,20 +19,23 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/doc"
 	"go/token"
 	"go/types"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/taichimaeda/wireplus/internal/logging"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/types/typeutil"
 )
 
 // A providerSetSrc captures the source for a type provided by a ProviderSet.
-// Exactly one of the fields will be set.
+// Exactly one of the fields other than Splice will be set.
 type providerSetSrc struct {
 	Provider    *Provider
 	Binding     *IfaceBinding
@@ -40,10 +43,23 @@ type providerSetSrc struct {
 	Import      *ProviderSet
 	InjectorArg *InjectorArg
 	Field       *Field
+
+	// Splice is set if the source was added to the set by wire.Splice.
+	Splice *Splice
 }
 
 // description returns a string describing the source of p, including line numbers.
 func (p *providerSetSrc) description(fset *token.FileSet, typ types.Type) string {
+	desc := p.sourceDescription(fset, typ)
+	if p.Splice != nil {
+		desc += fmt.Sprintf(" spliced from %s (%s)", p.Splice.VarName, fset.Position(p.Splice.Pos))
+	}
+	return desc
+}
+
+// sourceDescription returns a string describing the source of p, ignoring
+// p.Splice.
+func (p *providerSetSrc) sourceDescription(fset *token.FileSet, typ types.Type) string {
 	quoted := func(s string) string {
 		if s == "" {
 			return ""
@@ -62,7 +78,7 @@ func (p *providerSetSrc) description(fset *token.FileSet, typ types.Type) string
 	case p.Value != nil:
 		return fmt.Sprintf("wire.Value (%s)", fset.Position(p.Value.Pos))
 	case p.Import != nil:
-		return fmt.Sprintf("provider set %s(%s)", quoted(p.Import.VarName), fset.Position(p.Import.Pos))
+		return fmt.Sprintf("provider set %s(%s)", quoted(p.Import.Name()), fset.Position(p.Import.Pos))
 	case p.InjectorArg != nil:
 		args := p.InjectorArg.Args
 		return fmt.Sprintf("argument %s to injector function %s (%s)", args.Tuple.At(p.InjectorArg.Index).Name(), args.Name, fset.Position(args.Pos))
@@ -72,6 +88,25 @@ func (p *providerSetSrc) description(fset *token.FileSet, typ types.Type) string
 	panic("providerSetSrc with no fields set")
 }
 
+// pos returns the position of the source of p, ignoring p.Splice.
+func (p *providerSetSrc) pos() token.Pos {
+	switch {
+	case p.Provider != nil:
+		return p.Provider.Pos
+	case p.Binding != nil:
+		return p.Binding.Pos
+	case p.Value != nil:
+		return p.Value.Pos
+	case p.Import != nil:
+		return p.Import.Pos
+	case p.InjectorArg != nil:
+		return p.InjectorArg.Args.Pos
+	case p.Field != nil:
+		return p.Field.Pos
+	}
+	panic("providerSetSrc with no fields set")
+}
+
 // trace returns a slice of strings describing the (possibly recursive) source
 // of p, including line numbers.
 func (p *providerSetSrc) trace(fset *token.FileSet, typ types.Type) []string {
@@ -97,15 +132,31 @@ type ProviderSet struct {
 	// VarName is the variable name of the set, if it came from a package
 	// variable.
 	VarName string
+	// AnonID is the identifier of the set if VarName is empty, as returned
+	// by AnonSetID.
+	AnonID string
 
 	Providers []*Provider
 	Bindings  []*IfaceBinding
 	Values    []*Value
 	Fields    []*Field
 	Imports   []*ProviderSet
+	// Requires lists the inputs declared by wire.Requires, in order.
+	Requires []*Requirement
+	// Optionals lists the types marked by wire.Optional, in order.
+	Optionals []*OptionalType
 	// InjectorArgs is only filled in for wire.Build.
 	InjectorArgs *InjectorArgs
 
+	// spliced maps the providers, bindings, values, fields and imports
+	// added to the set by wire.Splice to the splice that added them.
+	spliced map[splicedKey]*Splice
+
+	// args maps the providers, bindings, values, fields and imports of the
+	// set to the argument of its wire.NewSet or wire.Build call that added
+	// them.
+	args map[splicedKey]ast.Expr
+
 	// providerMap maps from provided type to a *ProvidedType.
 	// It includes all of the imported types.
 	providerMap *typeutil.Map
@@ -115,6 +166,31 @@ type ProviderSet struct {
 	srcMap *typeutil.Map
 }
 
+// Name returns VarName, or AnonID if the set is anonymous.
+func (set *ProviderSet) Name() string {
+	if set.VarName == "" {
+		return set.AnonID
+	}
+	return set.VarName
+}
+
+// AnonSetPrefix is the prefix of identifiers of anonymous provider sets.
+const AnonSetPrefix = "anon@"
+
+// AnonSetID returns the identifier of the anonymous provider set created
+// by the call to wire.NewSet or wire.Build at pos in the package pkgPath.
+//
+// The identifier has the form "anon@" + pkgPath + "/" + file + ":" + line
+// + ":" + column, where file is the base name of the file containing pos,
+// e.g. "anon@example.com/app/wire.go:42:17". The column is counted in
+// bytes. It only depends on the source, so it is stable across runs on
+// unchanged source and can be used to refer to the set from tooling.
+// Changing this scheme breaks such references.
+func AnonSetID(fset *token.FileSet, pkgPath string, pos token.Pos) string {
+	p := fset.Position(pos)
+	return fmt.Sprintf("%s%s/%s:%d:%d", AnonSetPrefix, pkgPath, filepath.Base(p.Filename), p.Line, p.Column)
+}
+
 // Outputs returns a new slice containing the set of possible types the
 // provider set can produce. The order is unspecified.
 func (set *ProviderSet) Outputs() []types.Type {
@@ -130,6 +206,44 @@ func (set *ProviderSet) For(t types.Type) ProvidedType {
 	return *pt.(*ProvidedType)
 }
 
+// splicedKey identifies an element of one of the slices of a ProviderSet.
+type splicedKey struct {
+	// kind is one of "provider", "binding", "value", "field" or "import".
+	kind  string
+	index int
+}
+
+// spliceOf returns the splice that added the element of the given kind at
+// index to set, or nil if it was not added by wire.Splice.
+func (set *ProviderSet) spliceOf(kind string, index int) *Splice {
+	return set.spliced[splicedKey{kind: kind, index: index}]
+}
+
+// A Requirement is an input of a provider set declared by wire.Requires.
+type Requirement struct {
+	// Pos is the position of the argument to wire.Requires.
+	Pos token.Pos
+	// Type is the required type.
+	Type types.Type
+}
+
+// An OptionalType is a type marked as optional by wire.Optional.
+type OptionalType struct {
+	// Pos is the position of the argument to wire.Optional.
+	Pos token.Pos
+	// Type is the optional type.
+	Type types.Type
+}
+
+// A Splice records that the elements of a package-level slice were
+// expanded into a provider set by wire.Splice.
+type Splice struct {
+	// Pos is the position of the call to wire.Splice.
+	Pos token.Pos
+	// VarName is the name of the spliced variable.
+	VarName string
+}
+
 // An IfaceBinding declares that a type should be used to satisfy inputs
 // of the given interface type.
 type IfaceBinding struct {
@@ -177,6 +291,22 @@ type Provider struct {
 	// HasErr reports whether the provider function can return an error.
 	// (Always false for structs.)
 	HasErr bool
+
+	// Conditional reports whether the provider function returns a bool
+	// reporting whether its output was found. It may only provide types
+	// marked by wire.Optional. (Always false for structs.)
+	Conditional bool
+
+	// Cost is the estimated construction cost given by a //wire:cost
+	// directive in the doc comment of the provider function, usually one
+	// of CostLight, CostMedium or CostHeavy. It is empty if there is no
+	// directive. (Always empty for structs.)
+	Cost string
+
+	// Doc is the first sentence of the doc comment of the provider function
+	// or struct type. It is empty if there is no doc comment or the
+	// declaration was not parsed.
+	Doc string
 }
 
 // ProviderInput describes an incoming edge in the provider graph.
@@ -185,6 +315,10 @@ type ProviderInput struct {
 
 	// If the provider is a struct, FieldName will be the field name to set.
 	FieldName string
+
+	// If the provider is a function, ParamName is the name of the
+	// parameter, if any.
+	ParamName string
 }
 
 // Value describes a value expression.
@@ -253,21 +387,31 @@ func Load(ctx context.Context, wd string, env []string, tags string, patterns []
 	if len(errs) > 0 {
 		return nil, errs
 	}
+	return LoadInfo(pkgs)
+}
+
+// LoadInfo is like Load, but finds the provider sets and injectors of pkgs,
+// which were loaded by LoadPackages. It may return both errors and Info.
+func LoadInfo(pkgs []*packages.Package) (*Info, []error) {
 	if len(pkgs) == 0 {
 		return new(Info), nil
 	}
+	defer logging.Phase("analyze")()
 	fset := pkgs[0].Fset
 	info := &Info{
-		Fset: fset,
-		Sets: make(map[ProviderSetID]*ProviderSet),
+		Fset:     fset,
+		Sets:     make(map[ProviderSetID]*ProviderSet),
+		AnonSets: make(map[string]*ProviderSet),
 	}
 	oc := newObjectCache(pkgs)
 	ec := new(errorCollector)
+	var warnings []error
 	for _, pkg := range pkgs {
 		if isWireImport(pkg.PkgPath) {
 			// The marker function package confuses analysis.
 			continue
 		}
+		nerrs, nwarnings := len(ec.errors), len(warnings)
 		scope := pkg.Types.Scope()
 		for _, name := range scope.Names() {
 			obj := scope.Lookup(name)
@@ -280,9 +424,9 @@ func Load(ctx context.Context, wd string, env []string, tags string, patterns []
 				continue
 			}
 			pset := item.(*ProviderSet)
-			// pset.Name may not equal name, since it could be an alias to
-			// another provider set.
-			id := ProviderSetID{ImportPath: pset.PkgPath, VarName: name}
+			// pset.VarName and pset.PkgPath may not equal name and the path
+			// of pkg, since it could be an alias to another provider set.
+			id := ProviderSetID{ImportPath: pkg.PkgPath, VarName: name}
 			info.Sets[id] = pset
 		}
 		for _, f := range pkg.Syntax {
@@ -302,13 +446,10 @@ func Load(ctx context.Context, wd string, env []string, tags string, patterns []
 				sig := pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature)
 				ins, out, err := injectorFuncSignature(sig)
 				if err != nil {
-					if w, ok := err.(*WireErr); ok {
-						ec.add(notePosition(w.position, fmt.Errorf("inject %s: %v", fn.Name.Name, w.error)))
-					} else {
-						ec.add(notePosition(fset.Position(fn.Pos()), fmt.Errorf("inject %s: %v", fn.Name.Name, err)))
-					}
+					ec.add(noteInjector(fn.Name.Name, fset.Position(fn.Pos()), err))
 					continue
 				}
+				warnings = append(warnings, resultNameWarnings(fset, pkg.Types.Scope(), fn.Name.Name, sig)...)
 				injectorArgs := &InjectorArgs{
 					Name:  fn.Name.Name,
 					Tuple: ins,
@@ -319,24 +460,36 @@ func Load(ctx context.Context, wd string, env []string, tags string, patterns []
 					ec.add(notePositionAll(fset.Position(fn.Pos()), errs)...)
 					continue
 				}
-				_, errs = solve(fset, out.out, ins, set)
+				calls, errs := solve(fset, out.out, ins, set)
 				if len(errs) > 0 {
 					ec.add(mapErrors(errs, func(e error) error {
-						if w, ok := e.(*WireErr); ok {
-							return notePosition(w.position, fmt.Errorf("inject %s: %v", fn.Name.Name, w.error))
-						}
-						return notePosition(fset.Position(fn.Pos()), fmt.Errorf("inject %s: %v", fn.Name.Name, e))
+						return noteInjector(fn.Name.Name, fset.Position(fn.Pos()), e)
 					})...)
 					continue
 				}
+				if !isIgnored(fn.Doc, CategoryPointerValueOverlap) {
+					warnings = append(warnings, pointerValueOverlaps(fset, injectorArgs, set, calls, out.out)...)
+				}
 				info.Injectors = append(info.Injectors, &Injector{
 					Pos:        fn.Pos(),
 					ImportPath: pkg.PkgPath,
 					FuncName:   fn.Name.Name,
+					Set:        set,
 				})
 			}
 		}
+		copy(ec.errors[nerrs:], notePkgPath(pkg.PkgPath, ec.errors[nerrs:]))
+		copy(warnings[nwarnings:], notePkgPath(pkg.PkgPath, warnings[nwarnings:]))
+	}
+	for _, pkg := range pkgs {
+		for id, set := range oc.anonSets {
+			if set.PkgPath == pkg.PkgPath {
+				info.AnonSets[id] = set
+			}
+		}
 	}
+	info.Warnings = append(oc.costWarnings(), warnings...)
+	logging.Debug("cache", "name", "objects", "hits", oc.hits, "misses", oc.misses)
 	return info, ec.errors
 }
 
@@ -351,12 +504,27 @@ func Load(ctx context.Context, wd string, env []string, tags string, patterns []
 // In case of duplicate environment variables, the last one in the list
 // takes precedence.
 func LoadPackages(ctx context.Context, wd string, env []string, tags string, patterns []string) ([]*packages.Package, []error) {
+	return LoadPackagesWithOverlay(ctx, wd, env, tags, patterns, nil)
+}
+
+// LoadPackagesWithOverlay is like LoadPackages, but reads the files in
+// overlay, keyed by absolute path, from their contents in the map instead
+// of from disk, as the language server does for unsaved documents.
+func LoadPackagesWithOverlay(ctx context.Context, wd string, env []string, tags string, patterns []string, overlay map[string][]byte) ([]*packages.Package, []error) {
+	return loadPackages(ctx, wd, env, tags, patterns, overlay, false)
+}
+
+// loadPackages is LoadPackagesWithOverlay, also loading the test variants
+// of the packages if tests is true.
+func loadPackages(ctx context.Context, wd string, env []string, tags string, patterns []string, overlay map[string][]byte, tests bool) ([]*packages.Package, []error) {
 	cfg := &packages.Config{
 		Context:    ctx,
-		Mode:       packages.LoadAllSyntax,
+		Mode:       packages.LoadAllSyntax | packages.NeedModule,
 		Dir:        wd,
 		Env:        env,
 		BuildFlags: []string{"-tags=wireinject"},
+		Tests:      tests,
+		Overlay:    overlay,
 		// TODO(light): Use ParseFile to skip function bodies and comments in indirect packages.
 	}
 	if len(tags) > 0 {
@@ -366,14 +534,27 @@ func LoadPackages(ctx context.Context, wd string, env []string, tags string, pat
 	for i := range patterns {
 		escaped[i] = "pattern=" + patterns[i]
 	}
+	logging.Debug("load.config", "dir", wd, "tags", strings.TrimPrefix(cfg.BuildFlags[0], "-tags="), "mode", cfg.Mode, "env", debugEnv(env))
+	done := logging.Phase("load")
 	pkgs, err := packages.Load(cfg, escaped...)
+	done()
 	if err != nil {
 		return nil, []error{err}
 	}
+	if err := ctx.Err(); err != nil {
+		// The packages that were not parsed yet carry the error, which is
+		// reported once rather than for each of their files.
+		return nil, []error{err}
+	}
+	pkgPaths := make([]string, len(pkgs))
+	for i, p := range pkgs {
+		pkgPaths[i] = p.PkgPath
+	}
+	logging.Debug("load.result", "patterns", strings.Join(patterns, ","), "packages", strings.Join(pkgPaths, ","))
 	var errs []error
 	for _, p := range pkgs {
 		for _, e := range p.Errors {
-			errs = append(errs, e)
+			errs = append(errs, loadError(wd, p.PkgPath, e))
 		}
 	}
 	if len(errs) > 0 {
@@ -382,6 +563,18 @@ func LoadPackages(ctx context.Context, wd string, env []string, tags string, pat
 	return pkgs, nil
 }
 
+// loadError returns e, reported by packages.Load for the package pkgPath, as
+// a *WireErr, so that the errors of Load all carry their position if they
+// have one. File names relative to wd, as the go command reports some, are
+// made absolute.
+func loadError(wd string, pkgPath string, e packages.Error) error {
+	p := parseErrorPos(e.Pos)
+	if p.Filename != "" && !filepath.IsAbs(p.Filename) {
+		p.Filename = filepath.Join(wd, p.Filename)
+	}
+	return &WireErr{error: errors.New(e.Msg), position: p, pkgPath: pkgPath, category: CategoryLoad}
+}
+
 // Info holds the result of Load.
 type Info struct {
 	Fset *token.FileSet
@@ -392,6 +585,41 @@ type Info struct {
 	// Injectors contains all the injector functions in the initial packages.
 	// The order is undefined.
 	Injectors []*Injector
+
+	// AnonSets contains all the anonymous provider sets in the initial
+	// packages, keyed by AnonID. These include the sets passed to
+	// wire.Build.
+	AnonSets map[string]*ProviderSet
+
+	// Warnings contains problems that do not prevent generating injectors,
+	// such as providers with an unknown //wire:cost category.
+	Warnings []error
+}
+
+// AnonSet returns the anonymous provider set identified by id, or nil if
+// there is none. id is either an identifier returned by AnonSetID or one
+// with the package path omitted, e.g. "anon@wire.go:42:17", which must
+// match a single set.
+func (info *Info) AnonSet(id string) *ProviderSet {
+	if set := info.AnonSets[id]; set != nil {
+		return set
+	}
+	if !strings.HasPrefix(id, AnonSetPrefix) || strings.Contains(id, "/") {
+		return nil
+	}
+	suffix := "/" + id[len(AnonSetPrefix):]
+	var found *ProviderSet
+	for anonID, set := range info.AnonSets {
+		if !strings.HasSuffix(anonID, suffix) {
+			continue
+		}
+		if found != nil {
+			// Ambiguous between packages.
+			return nil
+		}
+		found = set
+	}
+	return found
 }
 
 // A ProviderSetID identifies a named provider set.
@@ -410,6 +638,8 @@ type Injector struct {
 	Pos        token.Pos
 	ImportPath string
 	FuncName   string
+	// Set is the provider set passed to wire.Build.
+	Set *ProviderSet
 }
 
 // String returns the injector name as ""path/to/pkg".Foo".
@@ -423,6 +653,16 @@ type objectCache struct {
 	packages map[string]*packages.Package
 	objects  map[objRef]objCacheEntry
 	hasher   typeutil.Hasher
+	// anonSets maps the AnonID of each anonymous provider set processed
+	// to the set.
+	anonSets map[string]*ProviderSet
+	// hits and misses count the lookups of get, for debugging.
+	hits   int
+	misses int
+	// allowCycles keeps the provider sets whose providers depend on each
+	// other in cycles, which are otherwise errors, so that they can be
+	// drawn.
+	allowCycles bool
 }
 
 type objRef struct {
@@ -444,6 +684,7 @@ func newObjectCache(pkgs []*packages.Package) *objectCache {
 		packages: make(map[string]*packages.Package),
 		objects:  make(map[objRef]objCacheEntry),
 		hasher:   typeutil.MakeHasher(),
+		anonSets: make(map[string]*ProviderSet),
 	}
 	// Depth-first search of all dependencies to gather import path to
 	// packages.Package mapping. go/packages guarantees that for a single
@@ -472,8 +713,10 @@ func (oc *objectCache) get(obj types.Object) (val interface{}, errs []error) {
 		name:       obj.Name(),
 	}
 	if ent, cached := oc.objects[ref]; cached {
+		oc.hits++
 		return ent.val, append([]error(nil), ent.errs...)
 	}
+	oc.misses++
 	defer func() {
 		oc.objects[ref] = objCacheEntry{
 			val:  val,
@@ -495,7 +738,14 @@ func (oc *objectCache) get(obj types.Object) (val interface{}, errs []error) {
 		pkgPath := obj.Pkg().Path()
 		return oc.processExpr(oc.packages[pkgPath].TypesInfo, pkgPath, spec.Values[i], obj.Name())
 	case *types.Func:
-		return processFuncProvider(oc.fset, obj)
+		p, errs := processFuncProvider(oc.fset, obj)
+		if p != nil {
+			if decl := oc.funcDecl(obj); decl != nil {
+				p.Cost = parseCostDirective(decl.Doc)
+				p.Doc = synopsis(decl.Doc)
+			}
+		}
+		return p, errs
 	default:
 		return nil, []error{fmt.Errorf("%v is not a provider or a provider set", obj)}
 	}
@@ -521,8 +771,70 @@ func (oc *objectCache) varDecl(obj *types.Var) *ast.ValueSpec {
 	return nil
 }
 
+// funcDecl finds the declaration that defines the given function.
+func (oc *objectCache) funcDecl(obj *types.Func) *ast.FuncDecl {
+	pkg := oc.packages[obj.Pkg().Path()]
+	if pkg == nil {
+		return nil
+	}
+	pos := obj.Pos()
+	for _, f := range pkg.Syntax {
+		tokenFile := oc.fset.File(f.Pos())
+		if base := tokenFile.Base(); base <= int(pos) && int(pos) < base+tokenFile.Size() {
+			path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+			for _, node := range path {
+				if decl, ok := node.(*ast.FuncDecl); ok {
+					return decl
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// typeDoc finds the doc comment of the type declared at pos in pkg. A type
+// declared alone in a group takes the doc comment of the group.
+func (oc *objectCache) typeDoc(pkg *types.Package, pos token.Pos) *ast.CommentGroup {
+	p := oc.packages[pkg.Path()]
+	if p == nil {
+		return nil
+	}
+	for _, f := range p.Syntax {
+		tokenFile := oc.fset.File(f.Pos())
+		if base := tokenFile.Base(); base <= int(pos) && int(pos) < base+tokenFile.Size() {
+			path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+			for i, node := range path {
+				spec, ok := node.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				if spec.Doc != nil {
+					return spec.Doc
+				}
+				if i+1 < len(path) {
+					if decl, ok := path[i+1].(*ast.GenDecl); ok && len(decl.Specs) == 1 {
+						return decl.Doc
+					}
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// synopsis returns the first sentence of the doc comment cg, or "" if cg is
+// nil.
+func synopsis(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return doc.Synopsis(cg.Text())
+}
+
 // processExpr converts an expression into a Wire structure. It may return a
-// *Provider, an *IfaceBinding, a *ProviderSet, a *Value or a []*Field.
+// *Provider, an *IfaceBinding, a *ProviderSet, a *Value, a []*Field, a
+// []*Requirement or a []*OptionalType.
 func (oc *objectCache) processExpr(info *types.Info, pkgPath string, expr ast.Expr, varName string) (interface{}, []error) {
 	exprPos := oc.fset.Position(expr.Pos())
 	expr = astutil.Unparen(expr)
@@ -571,6 +883,7 @@ func (oc *objectCache) processExpr(info *types.Info, pkgPath string, expr ast.Ex
 			if err != nil {
 				return nil, []error{notePosition(exprPos, err)}
 			}
+			s.Doc = synopsis(oc.typeDoc(s.Pkg, s.Pos))
 			return s, nil
 		case "FieldsOf":
 			v, err := processFieldsOf(oc.fset, info, call)
@@ -578,6 +891,20 @@ func (oc *objectCache) processExpr(info *types.Info, pkgPath string, expr ast.Ex
 				return nil, []error{notePosition(exprPos, err)}
 			}
 			return v, nil
+		case "Requires":
+			r, err := processRequires(oc.fset, info, call)
+			if err != nil {
+				return nil, []error{notePosition(exprPos, err)}
+			}
+			return r, nil
+		case "Optional":
+			o, err := processOptional(oc.fset, info, call)
+			if err != nil {
+				return nil, []error{notePosition(exprPos, err)}
+			}
+			return o, nil
+		case "Splice":
+			return nil, []error{notePosition(exprPos, errors.New("wire.Splice may only be used as an argument to wire.NewSet or wire.Build"))}
 		default:
 			return nil, []error{notePosition(exprPos, errors.New("unknown pattern"))}
 		}
@@ -587,6 +914,7 @@ func (oc *objectCache) processExpr(info *types.Info, pkgPath string, expr ast.Ex
 		if len(errs) > 0 {
 			return nil, notePositionAll(exprPos, errs)
 		}
+		p.Doc = synopsis(oc.typeDoc(p.Pkg, p.Pos))
 		return p, nil
 	}
 	return nil, []error{notePosition(exprPos, errors.New("unknown pattern"))}
@@ -601,27 +929,79 @@ func (oc *objectCache) processNewSet(info *types.Info, pkgPath string, call *ast
 		PkgPath:      pkgPath,
 		VarName:      varName,
 	}
+	if varName == "" {
+		pset.AnonID = AnonSetID(oc.fset, pkgPath, call.Pos())
+		oc.anonSets[pset.AnonID] = pset
+	}
 	ec := new(errorCollector)
-	for _, arg := range call.Args {
+	// top is the argument of call being added.
+	var top ast.Expr
+	var add func(arg ast.Expr, splice *Splice)
+	add = func(arg ast.Expr, splice *Splice) {
+		if call, ok := astutil.Unparen(arg).(*ast.CallExpr); ok && isWireCall(info, call, "Splice") {
+			elems, s, err := oc.processSplice(info, pkgPath, call)
+			if err != nil {
+				ec.add(notePosition(oc.fset.Position(call.Pos()), err))
+				return
+			}
+			for _, elem := range elems {
+				add(elem, s)
+			}
+			return
+		}
 		item, errs := oc.processExpr(info, pkgPath, arg, "")
 		if len(errs) > 0 {
 			ec.add(errs...)
-			continue
+			return
 		}
+		var keys []splicedKey
 		switch item := item.(type) {
 		case *Provider:
+			keys = append(keys, splicedKey{"provider", len(pset.Providers)})
 			pset.Providers = append(pset.Providers, item)
 		case *ProviderSet:
+			keys = append(keys, splicedKey{"import", len(pset.Imports)})
 			pset.Imports = append(pset.Imports, item)
 		case *IfaceBinding:
+			keys = append(keys, splicedKey{"binding", len(pset.Bindings)})
 			pset.Bindings = append(pset.Bindings, item)
 		case *Value:
+			keys = append(keys, splicedKey{"value", len(pset.Values)})
 			pset.Values = append(pset.Values, item)
 		case []*Field:
+			for i := range item {
+				keys = append(keys, splicedKey{"field", len(pset.Fields) + i})
+			}
 			pset.Fields = append(pset.Fields, item...)
+		case []*Requirement:
+			if args != nil {
+				ec.add(notePosition(oc.fset.Position(arg.Pos()), errors.New("wire.Requires may only be used as an argument to wire.NewSet")))
+				return
+			}
+			pset.Requires = append(pset.Requires, item...)
+		case []*OptionalType:
+			pset.Optionals = append(pset.Optionals, item...)
 		default:
 			panic("unknown item type")
 		}
+		if pset.args == nil {
+			pset.args = make(map[splicedKey]ast.Expr)
+		}
+		for _, key := range keys {
+			pset.args[key] = top
+		}
+		if splice != nil {
+			if pset.spliced == nil {
+				pset.spliced = make(map[splicedKey]*Splice)
+			}
+			for _, key := range keys {
+				pset.spliced[key] = splice
+			}
+		}
+	}
+	for _, arg := range call.Args {
+		top = arg
+		add(arg, nil)
 	}
 	if len(ec.errors) > 0 {
 		return nil, ec.errors
@@ -631,12 +1011,124 @@ func (oc *objectCache) processNewSet(info *types.Info, pkgPath string, call *ast
 	if len(errs) > 0 {
 		return nil, errs
 	}
-	if errs := verifyAcyclic(pset.providerMap, oc.hasher); len(errs) > 0 {
+	if !oc.allowCycles {
+		if errs := verifyAcyclic(oc.fset, pset.providerMap, oc.hasher); len(errs) > 0 {
+			return nil, errs
+		}
+	}
+	if errs := verifyRequires(oc.fset, pset); len(errs) > 0 {
 		return nil, errs
 	}
 	return pset, nil
 }
 
+// processSplice returns the elements of the slice or array passed to a call
+// to wire.Splice. The argument must be a package-level variable in pkgPath
+// that is initialized with a composite literal and never assigned to, so
+// that its elements are known statically.
+func (oc *objectCache) processSplice(info *types.Info, pkgPath string, call *ast.CallExpr) ([]ast.Expr, *Splice, error) {
+	// Assumes that call.Fun is wire.Splice.
+
+	if len(call.Args) != 1 {
+		return nil, nil, errors.New("call to Splice must specify exactly one argument")
+	}
+	arg := astutil.Unparen(call.Args[0])
+	var v *types.Var
+	switch expr := arg.(type) {
+	case *ast.Ident:
+		v, _ = info.ObjectOf(expr).(*types.Var)
+	case *ast.SelectorExpr:
+		if obj := qualifiedIdentObject(info, expr); obj != nil && obj.Pkg() != nil && obj.Pkg().Path() != pkgPath {
+			return nil, nil, fmt.Errorf("cannot splice %s: the variable must be declared in package %s, not %s", types.ExprString(arg), pkgPath, obj.Pkg().Path())
+		}
+	}
+	if v == nil || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		return nil, nil, fmt.Errorf("cannot splice %s: argument to Splice must be a package-level variable", types.ExprString(arg))
+	}
+	spec := oc.varDecl(v)
+	var value ast.Expr
+	if spec != nil && len(spec.Values) == len(spec.Names) {
+		for i := range spec.Names {
+			if spec.Names[i].Name == v.Name() {
+				value = astutil.Unparen(spec.Values[i])
+			}
+		}
+	}
+	lit, ok := value.(*ast.CompositeLit)
+	if ok {
+		switch info.TypeOf(lit).Underlying().(type) {
+		case *types.Slice, *types.Array:
+		default:
+			ok = false
+		}
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("cannot splice %s: the variable must be initialized with a slice or array literal", v.Name())
+	}
+	if pos := oc.findAssignment(info, pkgPath, v); pos.IsValid() {
+		return nil, nil, fmt.Errorf("cannot splice %s: the variable is modified at %v, so its elements cannot be determined statically", v.Name(), pos)
+	}
+	elems := make([]ast.Expr, len(lit.Elts))
+	for i, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			elt = kv.Value
+		}
+		elems[i] = elt
+	}
+	return elems, &Splice{Pos: call.Pos(), VarName: v.Name()}, nil
+}
+
+// findAssignment returns the position of a statement in pkgPath that assigns
+// to v or one of its elements, or takes its address, or an invalid position
+// if there is none.
+func (oc *objectCache) findAssignment(info *types.Info, pkgPath string, v *types.Var) token.Position {
+	refersToV := func(expr ast.Expr) bool {
+		for {
+			switch e := astutil.Unparen(expr).(type) {
+			case *ast.IndexExpr:
+				expr = e.X
+			case *ast.Ident:
+				return info.ObjectOf(e) == v
+			default:
+				return false
+			}
+		}
+	}
+	var pos token.Pos
+	for _, f := range oc.packages[pkgPath].Syntax {
+		ast.Inspect(f, func(node ast.Node) bool {
+			if pos.IsValid() {
+				return false
+			}
+			switch node := node.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range node.Lhs {
+					if refersToV(lhs) {
+						pos = node.Pos()
+					}
+				}
+			case *ast.IncDecStmt:
+				if refersToV(node.X) {
+					pos = node.Pos()
+				}
+			case *ast.UnaryExpr:
+				if node.Op == token.AND && refersToV(node.X) {
+					pos = node.Pos()
+				}
+			case *ast.RangeStmt:
+				if node.Key != nil && refersToV(node.Key) || node.Value != nil && refersToV(node.Value) {
+					pos = node.Pos()
+				}
+			}
+			return true
+		})
+	}
+	if !pos.IsValid() {
+		return token.Position{}
+	}
+	return oc.fset.Position(pos)
+}
+
 // structArgType attempts to interpret an expression as a simple struct type.
 // It assumes any parentheses have been stripped.
 func structArgType(info *types.Info, expr ast.Expr) *types.TypeName {
@@ -684,18 +1176,20 @@ func processFuncProvider(fset *token.FileSet, fn *types.Func) (*Provider, []erro
 	}
 	params := sig.Params()
 	provider := &Provider{
-		Pkg:        fn.Pkg(),
-		Name:       fn.Name(),
-		Pos:        fn.Pos(),
-		Args:       make([]ProviderInput, params.Len()),
-		Varargs:    sig.Variadic(),
-		Out:        []types.Type{providerSig.out},
-		HasCleanup: providerSig.cleanup,
-		HasErr:     providerSig.err,
+		Pkg:         fn.Pkg(),
+		Name:        fn.Name(),
+		Pos:         fn.Pos(),
+		Args:        make([]ProviderInput, params.Len()),
+		Varargs:     sig.Variadic(),
+		Out:         []types.Type{providerSig.out},
+		HasCleanup:  providerSig.cleanup,
+		HasErr:      providerSig.err,
+		Conditional: providerSig.found,
 	}
 	for i := 0; i < params.Len(); i++ {
 		provider.Args[i] = ProviderInput{
-			Type: params.At(i).Type(),
+			Type:      params.At(i).Type(),
+			ParamName: params.At(i).Name(),
 		}
 		for j := 0; j < i; j++ {
 			if types.Identical(provider.Args[i].Type, provider.Args[j].Type) {
@@ -711,13 +1205,55 @@ func injectorFuncSignature(sig *types.Signature) (*types.Tuple, outputSignature,
 	if err != nil {
 		return nil, outputSignature{}, err
 	}
+	if out.found {
+		return nil, outputSignature{}, errors.New("last return type is bool; injectors must return error instead")
+	}
 	return sig.Params(), out, nil
 }
 
+// resultNameWarnings returns a warning for each named result of the
+// injector name with signature sig that collides with an identifier in
+// scope, such as a provider, which the generated injector renames so as
+// not to shadow it.
+func resultNameWarnings(fset *token.FileSet, scope *types.Scope, name string, sig *types.Signature) []error {
+	var warnings []error
+	results := sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		r := results.At(i)
+		if r.Name() == "" || r.Name() == "_" {
+			continue
+		}
+		if _, obj := scope.LookupParent(r.Name(), token.NoPos); obj != nil {
+			warnings = append(warnings, notePosition(fset.Position(r.Pos()),
+				fmt.Errorf("inject %s: result %s collides with %s; the generated injector renames it", name, r.Name(), objectKind(obj))))
+		}
+	}
+	return warnings
+}
+
+// objectKind describes the kind and name of obj, e.g. "func provideFoo".
+func objectKind(obj types.Object) string {
+	switch obj.(type) {
+	case *types.Func:
+		return "func " + obj.Name()
+	case *types.TypeName:
+		return "type " + obj.Name()
+	case *types.Const:
+		return "const " + obj.Name()
+	case *types.Builtin:
+		return "builtin " + obj.Name()
+	case *types.PkgName:
+		return "package " + obj.Name()
+	}
+	return "var " + obj.Name()
+}
+
 type outputSignature struct {
 	out     types.Type
 	cleanup bool
 	err     bool
+	// found is true for conditional providers returning a bool.
+	found bool
 }
 
 // funcOutput validates an injector or provider function's return signature.
@@ -735,21 +1271,28 @@ func funcOutput(sig *types.Signature) (outputSignature, error) {
 			return outputSignature{out: out, err: true}, nil
 		case types.Identical(t, cleanupType):
 			return outputSignature{out: out, cleanup: true}, nil
+		case types.Identical(t, boolType):
+			return outputSignature{out: out, found: true}, nil
 		default:
-			return outputSignature{}, fmt.Errorf("second return type is %s; must be error or func()", types.TypeString(t, nil))
+			return outputSignature{}, fmt.Errorf("second return type is %s; must be error, func() or bool", types.TypeString(t, nil))
 		}
 	case 3:
 		if t := results.At(1).Type(); !types.Identical(t, cleanupType) {
 			return outputSignature{}, fmt.Errorf("second return type is %s; must be func()", types.TypeString(t, nil))
 		}
-		if t := results.At(2).Type(); !types.Identical(t, errorType) {
-			return outputSignature{}, fmt.Errorf("third return type is %s; must be error", types.TypeString(t, nil))
-		}
-		return outputSignature{
+		sig := outputSignature{
 			out:     results.At(0).Type(),
 			cleanup: true,
-			err:     true,
-		}, nil
+		}
+		switch t := results.At(2).Type(); {
+		case types.Identical(t, errorType):
+			sig.err = true
+		case types.Identical(t, boolType):
+			sig.found = true
+		default:
+			return outputSignature{}, fmt.Errorf("third return type is %s; must be error or bool", types.TypeString(t, nil))
+		}
+		return sig, nil
 	default:
 		return outputSignature{}, errors.New("too many return values")
 	}
@@ -845,7 +1388,7 @@ func processStructProvider(fset *token.FileSet, info *types.Info, call *ast.Call
 		for i := 1; i < len(call.Args); i++ {
 			v, err := checkField(call.Args[i], st)
 			if err != nil {
-				return nil, notePosition(fset.Position(call.Pos()), err)
+				return nil, notePosition(fset.Position(call.Args[i].Pos()), err)
 			}
 			provider.Args[i-1] = ProviderInput{
 				Type:      v.Type(),
@@ -928,6 +1471,53 @@ func processBind(fset *token.FileSet, info *types.Info, call *ast.CallExpr) (*If
 	}, nil
 }
 
+// processRequires creates the requirements declared by a wire.Requires call.
+func processRequires(fset *token.FileSet, info *types.Info, call *ast.CallExpr) ([]*Requirement, error) {
+	// Assumes that call.Fun is wire.Requires.
+
+	if len(call.Args) == 0 {
+		return nil, notePosition(fset.Position(call.Pos()), errors.New("call to Requires must specify at least one type"))
+	}
+	var reqs []*Requirement
+	seen := new(typeutil.Map)
+	for _, arg := range call.Args {
+		argType := info.TypeOf(arg)
+		ptr, ok := argType.(*types.Pointer)
+		if !ok {
+			return nil, notePosition(fset.Position(arg.Pos()),
+				fmt.Errorf("argument to Requires must be a pointer to the required type; found %s", types.TypeString(argType, nil)))
+		}
+		if seen.At(ptr.Elem()) != nil {
+			return nil, notePosition(fset.Position(arg.Pos()),
+				fmt.Errorf("%s is required more than once", types.TypeString(ptr.Elem(), nil)))
+		}
+		seen.Set(ptr.Elem(), true)
+		reqs = append(reqs, &Requirement{Pos: arg.Pos(), Type: ptr.Elem()})
+	}
+	return reqs, nil
+}
+
+// processOptional creates the optional types marked by a wire.Optional
+// call.
+func processOptional(fset *token.FileSet, info *types.Info, call *ast.CallExpr) ([]*OptionalType, error) {
+	// Assumes that call.Fun is wire.Optional.
+
+	if len(call.Args) == 0 {
+		return nil, notePosition(fset.Position(call.Pos()), errors.New("call to Optional must specify at least one type"))
+	}
+	var opts []*OptionalType
+	for _, arg := range call.Args {
+		argType := info.TypeOf(arg)
+		ptr, ok := argType.(*types.Pointer)
+		if !ok {
+			return nil, notePosition(fset.Position(arg.Pos()),
+				fmt.Errorf("argument to Optional must be a pointer to the optional type; found %s", types.TypeString(argType, nil)))
+		}
+		opts = append(opts, &OptionalType{Pos: arg.Pos(), Type: ptr.Elem()})
+	}
+	return opts, nil
+}
+
 // processValue creates a value from a wire.Value call.
 func processValue(fset *token.FileSet, info *types.Info, call *ast.CallExpr) (*Value, error) {
 	// Assumes that call.Fun is wire.Value.
@@ -1043,7 +1633,7 @@ func processFieldsOf(fset *token.FileSet, info *types.Info, call *ast.CallExpr)
 	for i := 1; i < len(call.Args); i++ {
 		v, err := checkField(call.Args[i], struc)
 		if err != nil {
-			return nil, notePosition(fset.Position(call.Pos()), err)
+			return nil, notePosition(fset.Position(call.Args[i].Pos()), err)
 		}
 		out := []types.Type{v.Type()}
 		if isPtrToStruct {
@@ -0,0 +1,201 @@
+package wire
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// injectorNames returns the names of the functions in pkg that call
+// wire.Build, including the ones that call it incorrectly, in source order.
+func injectorNames(pkg *packages.Package) []string {
+	var names []string
+	for _, f := range pkg.Syntax {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if build, err := findInjectorBuild(pkg.TypesInfo, fn); build != nil || err != nil {
+				names = append(names, fn.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// checkInjectorNames returns an error listing the injectors of pkgs if one
+// of names is not an injector of any of them.
+func checkInjectorNames(pkgs []*packages.Package, names []string) error {
+	available := make(map[string]bool)
+	for _, pkg := range pkgs {
+		for _, name := range injectorNames(pkg) {
+			available[name] = true
+		}
+	}
+	var missing []string
+	for _, name := range names {
+		if !available[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if len(available) == 0 {
+		return fmt.Errorf("no injector named %s: the packages declare no injectors", strings.Join(missing, ", "))
+	}
+	var list []string
+	for name := range available {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return fmt.Errorf("no injector named %s; available injectors: %s", strings.Join(missing, ", "), strings.Join(list, ", "))
+}
+
+// preserveInjectors reads the implementations of the injectors in keep
+// from the existing output file at path, if any, and records them in
+// g.preserved to be written verbatim in place of generating them. Each
+// implementation includes the variables holding the wire.Value values it
+// uses. The imports they use are added to g with their names in the
+// existing file, and the names of the variables are reserved, so the
+// injectors generated next do not take them.
+func (g *gen) preserveInjectors(filename string, keep map[string]bool) error {
+	src, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse existing output to keep the other injectors: %v", err)
+	}
+	text := func(start, end token.Pos) string {
+		file := fset.File(start)
+		return string(src[file.Offset(start):file.Offset(end)])
+	}
+	imports := make(map[string]string) // local name to path
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		switch {
+		case imp.Name == nil:
+			imports[g.packageName(p)] = p
+		case imp.Name.Name != "_" && imp.Name.Name != ".":
+			imports[imp.Name.Name] = p
+		}
+	}
+	values := make(map[string]*ast.ValueSpec)
+	for _, decl := range f.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.VAR {
+			for _, spec := range d.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Names) == 1 && strings.HasPrefix(vs.Names[0].Name, "_wire") {
+					values[vs.Names[0].Name] = vs
+				}
+			}
+		}
+	}
+	// refs records the imports and values referenced by node.
+	refs := func(node ast.Node, usedImports map[string]bool, usedValues map[string]bool) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				if id, ok := n.X.(*ast.Ident); ok && id.Obj == nil && imports[id.Name] != "" {
+					usedImports[id.Name] = true
+				}
+			case *ast.Ident:
+				if values[n.Name] != nil {
+					usedValues[n.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !keep[fn.Name.Name] {
+			continue
+		}
+		usedImports := make(map[string]bool)
+		usedValues := make(map[string]bool)
+		refs(fn, usedImports, usedValues)
+		var valueNames []string
+		for name := range usedValues {
+			refs(values[name], usedImports, make(map[string]bool))
+			valueNames = append(valueNames, name)
+		}
+		sort.Strings(valueNames)
+		for name := range usedImports {
+			if err := g.keepImport(name, imports[name]); err != nil {
+				return fmt.Errorf("keep injector %s from existing output: %v", fn.Name.Name, err)
+			}
+		}
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		sb := new(strings.Builder)
+		sb.WriteString(text(start, fn.End()))
+		sb.WriteString("\n\n")
+		if len(valueNames) > 0 {
+			sb.WriteString("var (\n")
+			for _, name := range valueNames {
+				g.reserved[name] = true
+				fmt.Fprintf(sb, "\t%s\n", text(values[name].Pos(), values[name].End()))
+			}
+			sb.WriteString(")\n\n")
+		}
+		g.preserved[fn.Name.Name] = sb.String()
+	}
+	return nil
+}
+
+// keepImport adds the import of importPath as name, which the code kept
+// from an existing output file uses.
+func (g *gen) keepImport(name, importPath string) error {
+	if info, ok := g.imports[importPath]; ok {
+		if info.name != name {
+			return fmt.Errorf("%q is imported as both %s and %s", importPath, info.name, name)
+		}
+		return nil
+	}
+	if g.nameInFileScope(name) {
+		return fmt.Errorf("import name %s of %q is declared in package %s", name, importPath, g.pkg.Name)
+	}
+	g.imports[importPath] = importInfo{
+		name:    name,
+		differs: name != g.packageName(importPath),
+	}
+	return nil
+}
+
+// packageName returns the name of the package importPath, which g.pkg
+// depends on, or the last element of importPath if it does not.
+func (g *gen) packageName(importPath string) string {
+	var name string
+	packages.Visit([]*packages.Package{g.pkg}, func(p *packages.Package) bool {
+		if p.PkgPath == importPath {
+			name = p.Name
+		}
+		return name == ""
+	}, nil)
+	if name == "" {
+		return path.Base(importPath)
+	}
+	return name
+}
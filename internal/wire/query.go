@@ -0,0 +1,705 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// StructField describes a struct field that is referenced by name from a
+// string literal passed to wire.Struct or wire.FieldsOf.
+type StructField struct {
+	// Lit is the string literal naming the field.
+	Lit *ast.BasicLit
+	// Call is the call to wire.Struct or wire.FieldsOf containing Lit.
+	Call *ast.CallExpr
+	// Name is the unquoted field name.
+	Name string
+	// Field is the field named by Lit, or nil if the struct has no field
+	// with that name.
+	Field *types.Var
+	// Tag is the struct tag of Field.
+	Tag string
+}
+
+// FieldAt returns the struct field referenced by the field name string
+// literal at pos, or nil if pos is not inside a field name argument to
+// wire.Struct or wire.FieldsOf.
+func FieldAt(pkg *packages.Package, pos token.Pos) *StructField {
+	path := pathEnclosingPos(pkg, pos)
+	if len(path) < 2 {
+		return nil
+	}
+	lit, ok := path[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return nil
+	}
+	call, ok := path[1].(*ast.CallExpr)
+	if !ok || !isWireCall(pkg.TypesInfo, call, "Struct", "FieldsOf") {
+		return nil
+	}
+	if len(call.Args) == 0 || call.Args[0] == ast.Expr(lit) {
+		// The first argument is the struct, not a field name.
+		return nil
+	}
+	name, err := strconv.Unquote(lit.Value)
+	if err != nil || name == "*" {
+		return nil
+	}
+	sf := &StructField{
+		Lit:  lit,
+		Call: call,
+		Name: name,
+	}
+	st := structOf(pkg.TypesInfo.TypeOf(call.Args[0]))
+	if st == nil {
+		return sf
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		if st.Field(i).Name() == name {
+			sf.Field = st.Field(i)
+			sf.Tag = st.Tag(i)
+			break
+		}
+	}
+	return sf
+}
+
+// ValueExpr describes the expression passed to a wire.Value call.
+type ValueExpr struct {
+	// Call is the call to wire.Value.
+	Call *ast.CallExpr
+	// Expr is the argument of Call.
+	Expr ast.Expr
+	// Type is the type of Expr.
+	Type types.Type
+	// Source is Expr formatted by go/format, with the constant
+	// subexpressions that are not literals replaced by their value.
+	Source string
+	// Idents holds the identifiers in Expr that refer to objects declared
+	// in a package, once per object, in the order they appear.
+	Idents []*ValueIdent
+}
+
+// ValueIdent is an identifier in the expression passed to wire.Value.
+type ValueIdent struct {
+	Ident *ast.Ident
+	// Obj is the object Ident refers to.
+	Obj types.Object
+	// Value is the value of Obj if it is a constant, or nil.
+	Value constant.Value
+}
+
+// ValueAt returns the expression passed to wire.Value that contains pos, or
+// nil if pos is not inside the argument of a call to wire.Value.
+func ValueAt(pkg *packages.Package, pos token.Pos) *ValueExpr {
+	var call *ast.CallExpr
+	for _, n := range pathEnclosingPos(pkg, pos) {
+		if c, ok := n.(*ast.CallExpr); ok && isWireCall(pkg.TypesInfo, c, "Value") {
+			call = c
+			break
+		}
+	}
+	if call == nil || len(call.Args) != 1 || pos < call.Args[0].Pos() || pos > call.Args[0].End() {
+		return nil
+	}
+	info := pkg.TypesInfo
+	expr := call.Args[0]
+	v := &ValueExpr{
+		Call: call,
+		Expr: expr,
+		Type: info.TypeOf(expr),
+	}
+	seen := make(map[types.Object]bool)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := info.Uses[id]
+		if obj == nil || obj.Pkg() == nil || seen[obj] {
+			return true
+		}
+		if _, ok := obj.(*types.PkgName); ok {
+			return true
+		}
+		seen[obj] = true
+		vi := &ValueIdent{Ident: id, Obj: obj}
+		if c, ok := obj.(*types.Const); ok {
+			vi.Value = c.Val()
+		}
+		v.Idents = append(v.Idents, vi)
+		return true
+	})
+	v.Source = formatFolded(pkg.Fset, info, expr)
+	return v
+}
+
+// ObjectAt returns the identifier at pos and the object it declares or
+// refers to, or nil if pos is not on an identifier naming an object.
+func ObjectAt(pkg *packages.Package, pos token.Pos) (*ast.Ident, types.Object) {
+	path := pathEnclosingPos(pkg, pos)
+	if len(path) == 0 {
+		return nil, nil
+	}
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return nil, nil
+	}
+	obj := pkg.TypesInfo.ObjectOf(id)
+	if obj == nil {
+		return nil, nil
+	}
+	return id, obj
+}
+
+// ProviderRefAt returns the identifier at pos and the function it refers
+// to, or nil if pos is not on a function passed to wire.NewSet or
+// wire.Build, e.g. on NewConfig or config.NewConfig.
+func ProviderRefAt(pkg *packages.Package, pos token.Pos) (*ast.Ident, *types.Func) {
+	path := pathEnclosingPos(pkg, pos)
+	if len(path) == 0 {
+		return nil, nil
+	}
+	id, ok := path[0].(*ast.Ident)
+	if !ok {
+		return nil, nil
+	}
+	fn, ok := pkg.TypesInfo.Uses[id].(*types.Func)
+	if !ok {
+		return nil, nil
+	}
+	arg := ast.Node(id)
+	for _, n := range path[1:] {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if n.Sel != id {
+				return nil, nil
+			}
+		case *ast.ParenExpr:
+		case *ast.CallExpr:
+			if !isWireCall(pkg.TypesInfo, n, "NewSet", "Build") {
+				return nil, nil
+			}
+			for _, a := range n.Args {
+				if a == arg {
+					return id, fn
+				}
+			}
+			return nil, nil
+		default:
+			return nil, nil
+		}
+		arg = n
+	}
+	return nil, nil
+}
+
+// SetOf returns the top-level provider set declared by the package
+// variable obj and its ID, or nil if obj does not declare one.
+func (info *Info) SetOf(obj types.Object) (*ProviderSet, ProviderSetID) {
+	if _, ok := obj.(*types.Var); !ok || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return nil, ProviderSetID{}
+	}
+	id := ProviderSetID{ImportPath: obj.Pkg().Path(), VarName: obj.Name()}
+	return info.Sets[id], id
+}
+
+// InjectorOf returns the injector declared by the function obj, or nil if
+// obj is not an injector.
+func (info *Info) InjectorOf(obj types.Object) *Injector {
+	if _, ok := obj.(*types.Func); !ok || obj.Pkg() == nil {
+		return nil
+	}
+	for _, in := range info.Injectors {
+		if in.ImportPath == obj.Pkg().Path() && in.FuncName == obj.Name() {
+			return in
+		}
+	}
+	return nil
+}
+
+// ProviderOf returns the provider function fn and the IDs of the top-level
+// provider sets that include it, directly or through the sets they import,
+// sorted. It returns nil if no provider set includes fn.
+func (info *Info) ProviderOf(fn *types.Func) (*Provider, []ProviderSetID) {
+	var provider *Provider
+	includes := make(map[*ProviderSet]bool)
+	var visit func(set *ProviderSet) bool
+	visit = func(set *ProviderSet) bool {
+		if found, ok := includes[set]; ok {
+			return found
+		}
+		includes[set] = false
+		for _, p := range set.Providers {
+			if !p.IsStruct && p.Pkg == fn.Pkg() && p.Name == fn.Name() {
+				provider = p
+				includes[set] = true
+				return true
+			}
+		}
+		for _, imp := range set.Imports {
+			if visit(imp) {
+				includes[set] = true
+				return true
+			}
+		}
+		return false
+	}
+	var ids []ProviderSetID
+	for id, set := range info.Sets {
+		if visit(set) {
+			ids = append(ids, id)
+		}
+	}
+	for _, set := range info.AnonSets {
+		visit(set)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	return provider, ids
+}
+
+// FindReferences loads the packages matched by "./..." in wd and returns
+// the positions of the identifiers referring to obj in the arguments of
+// wire.NewSet and wire.Build calls, in those packages and their
+// dependencies, sorted and without duplicates. obj must be declared at
+// package level and is matched by its package path and name, so it may come
+// from another load. If obj is a field of a struct type declared at package
+// level, the positions are instead those of the field names in the string
+// literals naming it in wire.Struct and wire.FieldsOf calls. References in
+// generated wire_gen.go files are excluded.
+func FindReferences(ctx context.Context, wd string, env []string, tags string, obj types.Object) ([]token.Position, []error) {
+	return FindReferencesWithOverlay(ctx, wd, env, tags, obj, nil)
+}
+
+// FindReferencesWithOverlay is like FindReferences, but loads the packages
+// with overlay as LoadPackagesWithOverlay does.
+func FindReferencesWithOverlay(ctx context.Context, wd string, env []string, tags string, obj types.Object, overlay map[string][]byte) ([]token.Position, []error) {
+	if obj.Pkg() == nil {
+		return nil, nil
+	}
+	var owner *types.TypeName
+	if v, ok := obj.(*types.Var); ok && v.IsField() {
+		if owner = fieldOwner(v); owner == nil {
+			return nil, nil
+		}
+	} else if obj.Parent() != obj.Pkg().Scope() {
+		return nil, nil
+	}
+	pkgs, errs := LoadPackagesWithOverlay(ctx, wd, env, tags, []string{"./..."}, overlay)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	seen := make(map[token.Position]bool)
+	var refs []token.Position
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, f := range pkg.Syntax {
+			if filepath.Base(pkg.Fset.File(f.Pos()).Name()) == "wire_gen.go" {
+				continue
+			}
+			ast.Inspect(f, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				if owner != nil {
+					if !isWireCall(pkg.TypesInfo, call, "Struct", "FieldsOf") || len(call.Args) == 0 || !sameObject(namedObject(pkg.TypesInfo.TypeOf(call.Args[0])), owner) {
+						return true
+					}
+					for _, arg := range call.Args[1:] {
+						lit, ok := arg.(*ast.BasicLit)
+						if !ok || lit.Kind != token.STRING {
+							continue
+						}
+						if name, err := strconv.Unquote(lit.Value); err != nil || name != obj.Name() {
+							continue
+						}
+						// The reference is the field name, inside the quotes.
+						if pos := pkg.Fset.Position(lit.Pos() + 1); !seen[pos] {
+							seen[pos] = true
+							refs = append(refs, pos)
+						}
+					}
+					return true
+				}
+				if !isWireCall(pkg.TypesInfo, call, "NewSet", "Build") {
+					return true
+				}
+				for _, arg := range call.Args {
+					ast.Inspect(arg, func(n ast.Node) bool {
+						id, ok := n.(*ast.Ident)
+						if !ok || !sameObject(pkg.TypesInfo.Uses[id], obj) {
+							return true
+						}
+						if pos := pkg.Fset.Position(id.Pos()); !seen[pos] {
+							seen[pos] = true
+							refs = append(refs, pos)
+						}
+						return true
+					})
+				}
+				// Nested calls have been visited with the arguments.
+				return false
+			})
+		}
+	})
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Filename != refs[j].Filename {
+			return refs[i].Filename < refs[j].Filename
+		}
+		return refs[i].Offset < refs[j].Offset
+	})
+	return refs, nil
+}
+
+// fieldOwner returns the package-level named type whose underlying struct
+// declares the field v, or nil if there is none.
+func fieldOwner(v *types.Var) *types.TypeName {
+	scope := v.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		st, ok := tn.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			if st.Field(i) == v {
+				return tn
+			}
+		}
+	}
+	return nil
+}
+
+// namedObject returns the type name of t, or of the type t points to
+// through one or more pointers, or nil if that is not a named type.
+func namedObject(t types.Type) types.Object {
+	for {
+		ptr, ok := t.(*types.Pointer)
+		if !ok {
+			break
+		}
+		t = ptr.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+// RenameProviderSet loads the packages matched by "./..." in wd and their
+// tests with overlay, as LoadPackagesWithOverlay does, and returns the
+// positions of the identifiers to replace by name to rename the provider
+// set variable obj: its declaration and every reference to it in those
+// packages and their dependencies, sorted. obj is matched as by
+// FindReferences. It returns an error if obj is not a package-level
+// provider set variable, if name is not a valid identifier, if name is
+// already declared in the package of obj or would shadow or be shadowed at
+// a reference, if name is unexported while obj is referenced from another
+// package, or if a file excluded by build constraints may refer to obj.
+func RenameProviderSet(ctx context.Context, wd string, env []string, tags string, obj types.Object, name string, overlay map[string][]byte) ([]token.Position, []error) {
+	if _, ok := obj.(*types.Var); !ok || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() || !isProviderSetType(obj.Type()) {
+		return nil, []error{fmt.Errorf("%s is not a top-level provider set", obj.Name())}
+	}
+	if !isIdentifier(name) || name == "_" {
+		return nil, []error{fmt.Errorf("%q is not a valid identifier", name)}
+	}
+	if name == obj.Name() {
+		return nil, []error{fmt.Errorf("%s is already named %s", obj.Name(), name)}
+	}
+	pkgs, errs := loadPackages(ctx, wd, env, tags, []string{"./..."}, overlay, true)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	// A package with tests is loaded again as "p [p.test]" with its
+	// _test.go files, whose declarations name must not conflict with
+	// either, so the package without them is skipped.
+	tested := make(map[string]bool)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.ID == pkg.PkgPath+" ["+pkg.PkgPath+".test]" {
+			tested[pkg.PkgPath] = true
+		}
+	})
+	seen := make(map[token.Position]bool)
+	var refs []token.Position
+	var ec errorCollector
+	ignored := make(map[string]bool)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.ID == pkg.PkgPath && tested[pkg.PkgPath] {
+			return
+		}
+		for _, name := range pkg.IgnoredFiles {
+			if ignored[name] || !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			ignored[name] = true
+			if pos, ok := ignoredReference(name, overlay, pkg.PkgPath == obj.Pkg().Path(), obj); ok {
+				ec.add(notePosition(pos, fmt.Errorf("the file is excluded by build constraints and may refer to %s; rename it with tags that include the file", obj.Name())))
+			}
+		}
+		for _, f := range pkg.Syntax {
+			ast.Inspect(f, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				o := pkg.TypesInfo.Uses[id]
+				if o == nil {
+					o = pkg.TypesInfo.Defs[id]
+				}
+				if !sameObject(o, obj) {
+					return true
+				}
+				pos := pkg.Fset.Position(id.Pos())
+				if seen[pos] {
+					return true
+				}
+				seen[pos] = true
+				refs = append(refs, pos)
+				if pkg.PkgPath != obj.Pkg().Path() {
+					if !ast.IsExported(name) {
+						ec.add(notePosition(pos, fmt.Errorf("renaming %s to %s would make it inaccessible from %s", obj.Name(), name, pkg.PkgPath)))
+					}
+					return true
+				}
+				// The references in the package of obj are unqualified, so
+				// name must not resolve to anything else there.
+				if scope := pkg.Types.Scope().Innermost(id.Pos()); scope != nil {
+					if _, other := scope.LookupParent(name, id.Pos()); other != nil {
+						msg := fmt.Errorf("renaming %s to %s would conflict with %s", obj.Name(), name, other.Name())
+						if other.Pos().IsValid() {
+							msg = fmt.Errorf("%v declared at %v", msg, pkg.Fset.Position(other.Pos()))
+						}
+						ec.add(notePosition(pos, msg))
+					}
+				}
+				return true
+			})
+		}
+	})
+	if len(ec.errors) > 0 {
+		return nil, ec.errors
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Filename != refs[j].Filename {
+			return refs[i].Filename < refs[j].Filename
+		}
+		return refs[i].Offset < refs[j].Offset
+	})
+	return refs, nil
+}
+
+// ignoredReference parses the file name, excluded by build constraints, and
+// returns the position of the first identifier that may refer to obj: any
+// identifier named as obj if the file is in the package of obj, or a
+// selector of obj from an import of its package otherwise.
+func ignoredReference(name string, overlay map[string][]byte, local bool, obj types.Object) (token.Position, bool) {
+	fset := token.NewFileSet()
+	// The file is read from disk if src is nil.
+	var src interface{}
+	if content, ok := overlay[name]; ok {
+		src = content
+	}
+	f, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		return token.Position{}, false
+	}
+	var found token.Pos
+	ast.Inspect(f, func(n ast.Node) bool {
+		if found.IsValid() {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.Ident:
+			if local && n.Name == obj.Name() {
+				found = n.Pos()
+			}
+		case *ast.SelectorExpr:
+			x, ok := n.X.(*ast.Ident)
+			if ok && !local && n.Sel.Name == obj.Name() && importsAs(f, obj.Pkg(), x.Name) {
+				found = n.Sel.Pos()
+			}
+		}
+		return true
+	})
+	if !found.IsValid() {
+		return token.Position{}, false
+	}
+	return fset.Position(found), true
+}
+
+// importsAs reports whether f imports pkg under the name local.
+func importsAs(f *ast.File, pkg *types.Package, local string) bool {
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil || path != pkg.Path() {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name == local
+		}
+		return pkg.Name() == local
+	}
+	return false
+}
+
+// isIdentifier reports whether name is a Go identifier that is not a
+// keyword.
+func isIdentifier(name string) bool {
+	if name == "" || token.Lookup(name).IsKeyword() {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameObject reports whether a and b are the same kind of package-level
+// object with the same package path and name.
+func sameObject(a, b types.Object) bool {
+	if a == nil || b == nil || a.Pkg() == nil || b.Pkg() == nil {
+		return false
+	}
+	if a.Parent() != a.Pkg().Scope() || reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	return a.Pkg().Path() == b.Pkg().Path() && a.Name() == b.Name()
+}
+
+// formatFolded formats expr with its constant subexpressions that are not
+// literals replaced by literals of their value.
+func formatFolded(fset *token.FileSet, info *types.Info, expr ast.Expr) string {
+	// Nodes of the copy keep the positions of the original nodes, which
+	// identify the subexpressions to replace.
+	type span struct {
+		pos, end token.Pos
+		typ      reflect.Type
+	}
+	folded := make(map[span]constant.Value)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		e, ok := n.(ast.Expr)
+		if !ok {
+			return true
+		}
+		tv, ok := info.Types[e]
+		if !ok || tv.Value == nil || tv.IsType() {
+			return true
+		}
+		if _, ok := e.(*ast.BasicLit); ok {
+			return false
+		}
+		if id, ok := e.(*ast.Ident); ok && (id.Name == "true" || id.Name == "false") {
+			return false
+		}
+		folded[span{e.Pos(), e.End(), reflect.TypeOf(e)}] = tv.Value
+		return false
+	})
+	node := astutil.Apply(copyAST(expr), func(c *astutil.Cursor) bool {
+		n := c.Node()
+		if n == nil {
+			return true
+		}
+		val, ok := folded[span{n.Pos(), n.End(), reflect.TypeOf(n)}]
+		if !ok {
+			return true
+		}
+		c.Replace(&ast.BasicLit{ValuePos: n.Pos(), Kind: literalKind(val), Value: constantLiteral(val)})
+		return false
+	}, nil)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, node); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// constantLiteral returns the source of a literal of val.
+func constantLiteral(val constant.Value) string {
+	switch val.Kind() {
+	case constant.String:
+		return strconv.Quote(constant.StringVal(val))
+	case constant.Float:
+		if f, exact := constant.Float64Val(val); exact {
+			return strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+	return val.ExactString()
+}
+
+func literalKind(val constant.Value) token.Token {
+	switch val.Kind() {
+	case constant.String:
+		return token.STRING
+	case constant.Float:
+		return token.FLOAT
+	case constant.Complex:
+		return token.IMAG
+	}
+	return token.INT
+}
+
+// pathEnclosingPos returns the path from the innermost node enclosing pos
+// to the root of the file in pkg that contains pos.
+func pathEnclosingPos(pkg *packages.Package, pos token.Pos) []ast.Node {
+	for _, f := range pkg.Syntax {
+		if f.Pos() <= pos && pos <= f.End() {
+			path, _ := astutil.PathEnclosingInterval(f, pos, pos)
+			return path
+		}
+	}
+	return nil
+}
+
+// isWireCall reports whether call is a call to one of the named functions
+// in the wire package.
+func isWireCall(info *types.Info, call *ast.CallExpr, names ...string) bool {
+	obj := qualifiedIdentObject(info, call.Fun)
+	if obj == nil || obj.Pkg() == nil || !isWireImport(obj.Pkg().Path()) {
+		return false
+	}
+	for _, name := range names {
+		if obj.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// structOf returns the struct type underlying t after removing any
+// pointer indirections, or nil if there is none.
+func structOf(t types.Type) *types.Struct {
+	for t != nil {
+		switch u := t.Underlying().(type) {
+		case *types.Pointer:
+			t = u.Elem()
+		case *types.Struct:
+			return u
+		default:
+			return nil
+		}
+	}
+	return nil
+}
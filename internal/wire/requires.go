@@ -0,0 +1,78 @@
+package wire
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Inputs returns the types that set needs but does not provide, sorted by
+// name. These are the inputs declared by wire.Requires if set has any.
+func (set *ProviderSet) Inputs() []types.Type {
+	_, missing := solvePartial(nil, set)
+	var seen typeutil.Map
+	var inputs []types.Type
+	for _, m := range missing {
+		if seen.At(*m) != nil {
+			continue
+		}
+		seen.Set(*m, true)
+		inputs = append(inputs, *m)
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return types.TypeString(inputs[i], nil) < types.TypeString(inputs[j], nil)
+	})
+	return inputs
+}
+
+// Declares reports whether t is declared as an input of set by
+// wire.Requires.
+func (set *ProviderSet) Declares(t types.Type) bool {
+	for _, r := range set.Requires {
+		if types.Identical(r.Type, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyRequires ensures that the inputs declared by wire.Requires in set,
+// if any, are exactly the inputs of set.
+func verifyRequires(fset *token.FileSet, set *ProviderSet) []error {
+	if len(set.Requires) == 0 {
+		return nil
+	}
+	setName := set.VarName
+	if setName == "" {
+		setName = fmt.Sprintf("provider set %q", set.AnonID)
+	}
+	ec := new(errorCollector)
+	inputs := set.Inputs()
+	for _, in := range inputs {
+		if !set.Declares(in) {
+			ec.add(notePosition(fset.Position(set.Pos),
+				fmt.Errorf("%s needs %s, which is not declared by wire.Requires", setName, types.TypeString(in, nil))))
+		}
+	}
+	for _, r := range set.Requires {
+		needed := false
+		for _, in := range inputs {
+			if types.Identical(in, r.Type) {
+				needed = true
+			}
+		}
+		switch {
+		case needed:
+		case !set.For(r.Type).IsNil():
+			ec.add(notePosition(fset.Position(r.Pos),
+				fmt.Errorf("%s requires %s, but also provides it", setName, types.TypeString(r.Type, nil))))
+		default:
+			ec.add(notePosition(fset.Position(r.Pos),
+				fmt.Errorf("%s requires %s, but does not need it", setName, types.TypeString(r.Type, nil))))
+		}
+	}
+	return ec.errors
+}
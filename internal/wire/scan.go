@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A ScannedDecl is an injector or a top-level provider set found by
+// ScanFile.
+type ScannedDecl struct {
+	// Name is the name of the injector function or of the set variable.
+	Name string
+	// Pos is the position of the injector function or of the wire.NewSet
+	// call of the set, as in Injector.Pos and ProviderSet.Pos.
+	Pos      token.Pos
+	Injector bool
+}
+
+// ScanFile returns the injectors and the top-level provider sets declared
+// in f, in order. Unlike Load, it only looks at the syntax of f: an
+// injector is a function calling wire.Build, and a provider set a package
+// variable initialized with a call to wire.NewSet. It is cheap, but may
+// report declarations that Load rejects.
+func ScanFile(f *ast.File) []*ScannedDecl {
+	wireName := ""
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err != nil || !isWireImport(path) {
+			continue
+		}
+		wireName = "wire"
+		if imp.Name != nil {
+			wireName = imp.Name.Name
+		}
+	}
+	if wireName == "" || wireName == "_" || wireName == "." {
+		return nil
+	}
+	isCall := func(expr ast.Expr, name string) bool {
+		call, ok := astutil.Unparen(expr).(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != name {
+			return false
+		}
+		x, ok := sel.X.(*ast.Ident)
+		return ok && x.Name == wireName
+	}
+	var decls []*ScannedDecl
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil || decl.Body == nil {
+				continue
+			}
+			found := false
+			ast.Inspect(decl.Body, func(n ast.Node) bool {
+				if expr, ok := n.(ast.Expr); ok && isCall(expr, "Build") {
+					found = true
+				}
+				return !found
+			})
+			if found {
+				decls = append(decls, &ScannedDecl{Name: decl.Name.Name, Pos: decl.Pos(), Injector: true})
+			}
+		case *ast.GenDecl:
+			if decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				for i, name := range spec.Names {
+					if i < len(spec.Values) && name.Name != "_" && isCall(spec.Values[i], "NewSet") {
+						decls = append(decls, &ScannedDecl{Name: name.Name, Pos: astutil.Unparen(spec.Values[i]).Pos()})
+					}
+				}
+			}
+		}
+	}
+	return decls
+}
@@ -0,0 +1,283 @@
+package wire
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The files of an example run by SelfTest.
+const (
+	// SelfTestManifestFile declares the command an example runs, see
+	// SelfTestManifest.
+	SelfTestManifestFile = "selftest.json"
+	// SelfTestOutputFile holds the expected output of the command.
+	SelfTestOutputFile = "expected_output.txt"
+	// SelfTestGenFile holds the expected code generated by gen.
+	SelfTestGenFile = "expected_wire_gen.go"
+)
+
+// SelfTestManifest is the content of the manifest file of an example, e.g.
+//
+//	{"command": "graph", "name": "initApp", "format": "cytospace"}
+type SelfTestManifest struct {
+	// Description says what the example shows. It is not used otherwise.
+	Description string `json:"description,omitempty"`
+	// Command is the command to run: gen, check or graph.
+	Command string `json:"command"`
+	// Package is the package pattern, relative to the example directory.
+	// It defaults to ".".
+	Package string `json:"package,omitempty"`
+	// Name is the injector or provider set to graph. It is required by
+	// graph and not allowed otherwise.
+	Name string `json:"name,omitempty"`
+	// Format is the format of the graph, graphviz or cytospace. It
+	// defaults to graphviz.
+	Format string `json:"format,omitempty"`
+	// Tags are the build tags appended to wireinject, as for -tags.
+	Tags string `json:"tags,omitempty"`
+}
+
+// A SelfTestResult is the result of running an example.
+type SelfTestResult struct {
+	// Dir is the directory of the example, relative to the corpus.
+	Dir string
+	// Manifest is the manifest of the example.
+	Manifest *SelfTestManifest
+	// Mismatches lists the expected files that do not match what the
+	// command produced. The example passed if there are none.
+	Mismatches []*SelfTestMismatch
+}
+
+// A SelfTestMismatch is an expected file of an example that does not
+// match what its command produced.
+type SelfTestMismatch struct {
+	// Path is the path of the expected file.
+	Path string
+	// Want is the content of the expected file and Got what the command
+	// produced instead.
+	Want string
+	Got  string
+}
+
+// SelfTest runs each example in the corpus under root and compares what
+// its command produces with the expected files next to its manifest.
+//
+// An example is a directory with a manifest file, usually the root of a
+// module; the directories below it are not searched for more examples. It
+// must have an expected_output.txt file, an expected_wire_gen.go file or
+// both; a missing expected_output.txt expects no output. The output of each
+// command is:
+//
+//	gen    the errors, one per line, and nothing if generation succeeds,
+//	       in which case the generated code is compared with
+//	       expected_wire_gen.go
+//	check  the errors and the warnings found by wireplus check, one per
+//	       line, with warnings after "warning: "
+//	graph  the graph of the named injector or provider set, or the errors
+//	       if it fails
+//
+// The example directory is removed from file names in the output, so that
+// they are relative to it.
+//
+// The errors returned are those that prevented running the corpus, such as
+// an invalid manifest. Failures of the examples are reported in the
+// results, sorted by directory.
+func SelfTest(ctx context.Context, root string, env []string) ([]*SelfTestResult, []error) {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, SelfTestManifestFile)); err == nil {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, []error{err}
+	}
+	if len(dirs) == 0 {
+		return nil, []error{fmt.Errorf("no examples found in %s: an example is a directory with a %s file", root, SelfTestManifestFile)}
+	}
+	sort.Strings(dirs)
+	ec := new(errorCollector)
+	var results []*SelfTestResult
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			ec.add(err)
+			continue
+		}
+		m, err := readSelfTestManifest(dir)
+		if err != nil {
+			ec.add(err)
+			continue
+		}
+		mismatches, err := runExample(ctx, dir, env, m)
+		if err != nil {
+			ec.add(fmt.Errorf("%s: %v", rel, err))
+			continue
+		}
+		results = append(results, &SelfTestResult{
+			Dir:        filepath.ToSlash(rel),
+			Manifest:   m,
+			Mismatches: mismatches,
+		})
+	}
+	if len(ec.errors) > 0 {
+		return nil, ec.errors
+	}
+	return results, nil
+}
+
+// readSelfTestManifest reads and validates the manifest of the example in
+// dir.
+func readSelfTestManifest(dir string) (*SelfTestManifest, error) {
+	path := filepath.Join(dir, SelfTestManifestFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := new(SelfTestManifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if m.Package == "" {
+		m.Package = "."
+	}
+	switch m.Command {
+	case "gen", "check":
+		if m.Name != "" || m.Format != "" {
+			return nil, fmt.Errorf("%s: name and format are only allowed for graph", path)
+		}
+	case "graph":
+		if m.Name == "" {
+			return nil, fmt.Errorf("%s: graph requires a name", path)
+		}
+		if m.Format == "" {
+			m.Format = "graphviz"
+		}
+		if m.Format != "graphviz" && m.Format != "cytospace" {
+			return nil, fmt.Errorf("%s: unknown format %q; want graphviz or cytospace", path, m.Format)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown command %q; want gen, check or graph", path, m.Command)
+	}
+	return m, nil
+}
+
+// runExample runs the command of the example in dir and returns the
+// expected files that do not match.
+func runExample(ctx context.Context, dir string, env []string, m *SelfTestManifest) ([]*SelfTestMismatch, error) {
+	outputPath := filepath.Join(dir, SelfTestOutputFile)
+	genPath := filepath.Join(dir, SelfTestGenFile)
+	wantOutput, outputErr := ioutil.ReadFile(outputPath)
+	wantGen, genErr := ioutil.ReadFile(genPath)
+	if outputErr != nil && genErr != nil {
+		return nil, fmt.Errorf("no %s or %s", SelfTestOutputFile, SelfTestGenFile)
+	}
+	if genErr == nil && m.Command != "gen" {
+		return nil, fmt.Errorf("%s is only compared by gen", SelfTestGenFile)
+	}
+	patterns := []string{m.Package}
+	var lines []string
+	var gen string
+	switch m.Command {
+	case "gen":
+		outs, errs := Generate(ctx, dir, env, patterns, &GenerateOptions{Tags: m.Tags})
+		for _, out := range outs {
+			errs = append(errs, out.Errs...)
+			gen += string(out.Content)
+		}
+		lines = errorLines(errs)
+	case "check":
+		lines = checkLines(ctx, dir, env, m.Tags, patterns)
+	case "graph":
+		data, _, errs := Graph(ctx, dir, env, patterns, m.Name, m.Tags, m.Format, false, nil, nil, ClusterBySet, EdgeLabelsNone)
+		lines = errorLines(errs)
+		if len(errs) == 0 {
+			lines = []string{strings.TrimSuffix(data, "\n")}
+		}
+	}
+	var output string
+	if len(lines) > 0 {
+		output = strings.Join(lines, "\n") + "\n"
+	}
+	// Make the file names relative to the example. The directory is also
+	// replaced when quoted in JSON, as in the commands of cytospace nodes,
+	// and in file URLs, as in the links of graphviz nodes.
+	prefix := dir + string(filepath.Separator)
+	output = strings.Replace(output, fileURL(filepath.ToSlash(prefix)), "", -1)
+	quoted, _ := json.Marshal(prefix)
+	output = strings.Replace(output, string(quoted[1:len(quoted)-1]), "", -1)
+	output = strings.Replace(output, prefix, "", -1)
+
+	var mismatches []*SelfTestMismatch
+	if output != string(wantOutput) {
+		mismatches = append(mismatches, &SelfTestMismatch{Path: outputPath, Want: string(wantOutput), Got: output})
+	}
+	if genErr == nil && gen != string(wantGen) {
+		mismatches = append(mismatches, &SelfTestMismatch{Path: genPath, Want: string(wantGen), Got: gen})
+	}
+	return mismatches, nil
+}
+
+// checkLines returns the errors and warnings wireplus check reports for the
+// packages matching patterns in dir. Budgets are read from the config file
+// in dir, if any, and exceeding them is a warning.
+func checkLines(ctx context.Context, dir string, env []string, tags string, patterns []string) []string {
+	info, errs := Load(ctx, dir, env, tags, patterns)
+	if len(errs) > 0 {
+		return errorLines(errs)
+	}
+	var lines []string
+	for _, w := range info.Warnings {
+		lines = append(lines, "warning: "+w.Error())
+	}
+	mismatches, errs := CheckSignatures(ctx, dir, env, tags, patterns)
+	if len(errs) > 0 {
+		return append(lines, errorLines(errs)...)
+	}
+	for _, m := range mismatches {
+		lines = append(lines, m.Error())
+	}
+	cfg := new(Config)
+	if path := filepath.Join(dir, ConfigFileName); fileExists(path) {
+		var err error
+		if cfg, err = LoadConfig(path); err != nil {
+			return append(lines, err.Error())
+		}
+	}
+	violations, errs := CheckBudgets(ctx, dir, env, tags, patterns, cfg.Budgets)
+	if len(errs) > 0 {
+		return append(lines, errorLines(errs)...)
+	}
+	for _, v := range violations {
+		lines = append(lines, "warning: "+v.Error())
+	}
+	return lines
+}
+
+// errorLines returns the messages of errs.
+func errorLines(errs []error) []string {
+	lines := make([]string, len(errs))
+	for i, err := range errs {
+		lines[i] = err.Error()
+	}
+	return lines
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,202 @@
+package wire
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// Kinds of SemanticToken.
+const (
+	// TokenDirective is the name of a function of the wire package in a
+	// call, e.g. Build in wire.Build(...).
+	TokenDirective = "directive"
+	// TokenProvider is a provider passed to wire.Build or wire.NewSet.
+	TokenProvider = "provider"
+	// TokenProviderSet is a provider set passed to wire.Build or
+	// wire.NewSet.
+	TokenProviderSet = "provider set"
+	// TokenType is a type in an argument of another function of the wire
+	// package, e.g. Fooer in wire.Bind(new(Fooer), new(*Foo)).
+	TokenType = "type"
+)
+
+// A SemanticToken is an identifier in a call to the wire package, as found
+// by SemanticTokens.
+type SemanticToken struct {
+	Pos token.Pos
+	// Len is the length of the identifier in bytes.
+	Len int
+	// Kind is one of the Token constants.
+	Kind string
+	// Unused is true in an argument of wire.Build that the injector does not
+	// use.
+	Unused bool
+	// Missing is true in an argument of wire.Build that needs a type that the
+	// injector is missing.
+	Missing bool
+}
+
+// SemanticTokens returns the tokens of the calls to the wire package in the
+// file of pkg named filename, sorted by position, or nil if pkg has no such
+// file. The tokens in the arguments of wire.Build calls are marked unused
+// or missing as the injector is solved.
+func SemanticTokens(pkg *packages.Package, filename string) []*SemanticToken {
+	var file *ast.File
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.File(f.Pos()).Name() == filename {
+			file = f
+		}
+	}
+	if file == nil {
+		return nil
+	}
+	info := pkg.TypesInfo
+	tokens := make(map[token.Pos]*SemanticToken)
+	add := func(id *ast.Ident, kind string) {
+		if tokens[id.Pos()] == nil {
+			tokens[id.Pos()] = &SemanticToken{Pos: id.Pos(), Len: len(id.Name), Kind: kind}
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fn, ok := qualifiedIdentObject(info, call.Fun).(*types.Func)
+		if !ok || fn.Pkg() == nil || !isWireImport(fn.Pkg().Path()) {
+			return true
+		}
+		add(lastIdent(call.Fun), TokenDirective)
+		for _, arg := range call.Args {
+			if fn.Name() != "Build" && fn.Name() != "NewSet" {
+				// The types of the other functions are passed as new(T).
+				ast.Inspect(arg, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok {
+						if _, ok := info.Uses[id].(*types.TypeName); ok {
+							add(id, TokenType)
+						}
+					}
+					return true
+				})
+				continue
+			}
+			arg = astutil.Unparen(arg)
+			switch obj := qualifiedIdentObject(info, arg).(type) {
+			case *types.Func:
+				add(lastIdent(arg), TokenProvider)
+			case *types.Var:
+				if isProviderSetType(obj.Type()) {
+					add(lastIdent(arg), TokenProviderSet)
+				}
+			}
+		}
+		return true
+	})
+
+	// Mark the tokens in the arguments of wire.Build from the solution of
+	// each injector.
+	mark := func(arg ast.Expr, f func(*SemanticToken)) {
+		for pos, tok := range tokens {
+			if arg.Pos() <= pos && pos < arg.End() {
+				f(tok)
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil {
+			continue
+		}
+		build, err := findInjectorBuild(info, fn)
+		if build == nil || err != nil {
+			continue
+		}
+		for _, ua := range UnusedArgsAt(pkg, build.Pos()) {
+			mark(ua.Arg, func(tok *SemanticToken) { tok.Unused = true })
+		}
+		for _, arg := range missingArgs(pkg, fn, build) {
+			mark(arg, func(tok *SemanticToken) { tok.Missing = true })
+		}
+	}
+
+	sorted := make([]*SemanticToken, 0, len(tokens))
+	for _, tok := range tokens {
+		sorted = append(sorted, tok)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Pos < sorted[j].Pos })
+	return sorted
+}
+
+// missingArgs returns the arguments of build, the wire.Build call of the
+// injector fn, that add a provider needing a type that the injector is
+// missing, directly or through an imported provider set.
+func missingArgs(pkg *packages.Package, fn *ast.FuncDecl, build *ast.CallExpr) []ast.Expr {
+	oc := newObjectCache([]*packages.Package{pkg})
+	set, _, out := injectorSet(oc, pkg, fn, build)
+	if set == nil {
+		return nil
+	}
+	missing := make(map[string]bool)
+	for _, t := range missingInputs(set, out) {
+		missing[t] = true
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	var args []ast.Expr
+	for _, arg := range build.Args {
+		for _, key := range argKeys(set, arg) {
+			needs := false
+			switch key.kind {
+			case "provider":
+				needs = providerNeeds(set.Providers[key.index], missing)
+			case "import":
+				needs = setNeeds(set.Imports[key.index], missing)
+			}
+			if needs {
+				args = append(args, arg)
+				break
+			}
+		}
+	}
+	return args
+}
+
+// providerNeeds reports whether one of the inputs of p is in missing.
+func providerNeeds(p *Provider, missing map[string]bool) bool {
+	for _, in := range p.Args {
+		if missing[types.TypeString(in.Type, nil)] {
+			return true
+		}
+	}
+	return false
+}
+
+// setNeeds reports whether a provider of set or of the sets it imports
+// has an input in missing.
+func setNeeds(set *ProviderSet, missing map[string]bool) bool {
+	for _, p := range set.Providers {
+		if providerNeeds(p, missing) {
+			return true
+		}
+	}
+	for _, imp := range set.Imports {
+		if setNeeds(imp, missing) {
+			return true
+		}
+	}
+	return false
+}
+
+// lastIdent returns the identifier of expr, an identifier or a selector.
+func lastIdent(expr ast.Expr) *ast.Ident {
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel
+	}
+	return expr.(*ast.Ident)
+}
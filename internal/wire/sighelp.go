@@ -0,0 +1,223 @@
+package wire
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// A SignatureHelp describes the call to a helper of the wire package
+// enclosing a position, as found by SignatureHelpAt.
+type SignatureHelp struct {
+	// Label is the signature of the helper, e.g.
+	// "wire.Bind(iface interface{}, to interface{}) wire.Binding".
+	Label string
+	// Doc describes the arguments the helper expects.
+	Doc string
+	// Params are the parameters of the helper, whose labels are substrings
+	// of Label.
+	Params []SignatureHelpParam
+	// Active is the index in Params of the argument at the position. It
+	// stays on the last parameter of a variadic helper.
+	Active int
+	// Problems describes what is wrong with the arguments typed so far,
+	// ignoring the argument at the position, which is being typed.
+	Problems []string
+}
+
+// A SignatureHelpParam is a parameter of a SignatureHelp.
+type SignatureHelpParam struct {
+	Label string
+	Doc   string
+}
+
+const providersDoc = "Each argument is a provider function, a provider set, or a call to wire.Bind, wire.Value, wire.InterfaceValue, wire.Struct or wire.FieldsOf."
+
+// helperSignatures are the helpers of the wire package that
+// SignatureHelpAt describes, by name.
+var helperSignatures = map[string]SignatureHelp{
+	"Build": {
+		Label:  "wire.Build(providers ...interface{}) string",
+		Doc:    "Build declares an injector, whose output is built from the given providers. " + providersDoc,
+		Params: []SignatureHelpParam{{"providers ...interface{}", "A provider, provider set or binding to build the output from."}},
+	},
+	"NewSet": {
+		Label:  "wire.NewSet(providers ...interface{}) wire.ProviderSet",
+		Doc:    "NewSet groups providers into a provider set. " + providersDoc,
+		Params: []SignatureHelpParam{{"providers ...interface{}", "A provider, provider set or binding to add to the set."}},
+	},
+	"Bind": {
+		Label: "wire.Bind(iface interface{}, to interface{}) wire.Binding",
+		Doc:   "Bind provides the interface type I with the type T implementing it.",
+		Params: []SignatureHelpParam{
+			{"iface interface{}", "new(I), a pointer to the interface type I."},
+			{"to interface{}", "new(T), a pointer to the type T implementing I, e.g. new(*Impl) for pointer receivers."},
+		},
+	},
+	"Struct": {
+		Label: "wire.Struct(structType interface{}, fieldNames ...string) wire.StructProvider",
+		Doc:   "Struct provides the struct type S and *S with the given fields injected.",
+		Params: []SignatureHelpParam{
+			{"structType interface{}", "new(S), a pointer to the named struct type S."},
+			{"fieldNames ...string", `The name of a field of S to inject, as a string, or "*" for all of them.`},
+		},
+	},
+	"FieldsOf": {
+		Label: "wire.FieldsOf(structType interface{}, fieldNames ...string) wire.StructFields",
+		Doc:   "FieldsOf provides the types of the given fields of the struct type S.",
+		Params: []SignatureHelpParam{
+			{"structType interface{}", "new(S) or new(*S), a pointer to the struct type S or to a pointer to it."},
+			{"fieldNames ...string", "The name of a field of S to provide, as a string."},
+		},
+	},
+}
+
+// SignatureHelpAt returns the signature of the innermost call to wire.Build,
+// wire.NewSet, wire.Bind, wire.Struct or wire.FieldsOf whose parentheses
+// enclose pos, along with the problems of its arguments, or nil if there
+// is none.
+func SignatureHelpAt(pkg *packages.Package, pos token.Pos) *SignatureHelp {
+	var call *ast.CallExpr
+	var name string
+	for _, n := range pathEnclosingPos(pkg, pos) {
+		c, ok := n.(*ast.CallExpr)
+		if !ok || pos <= c.Lparen || pos > c.Rparen {
+			continue
+		}
+		if obj := qualifiedIdentObject(pkg.TypesInfo, c.Fun); obj != nil && obj.Pkg() != nil && isWireImport(obj.Pkg().Path()) {
+			if _, ok := helperSignatures[obj.Name()]; ok {
+				call, name = c, obj.Name()
+				break
+			}
+		}
+	}
+	if call == nil {
+		return nil
+	}
+	sig := helperSignatures[name]
+	sig.Problems = nil
+	// The arguments ending before pos are those typed so far.
+	var typed []int
+	for i, arg := range call.Args {
+		if arg.End() < pos {
+			sig.Active++
+			typed = append(typed, i)
+		} else if arg.Pos() > pos {
+			typed = append(typed, i)
+		}
+	}
+	if sig.Active >= len(sig.Params) {
+		sig.Active = len(sig.Params) - 1
+	}
+	info := pkg.TypesInfo
+	check := func(err error) {
+		if err == nil {
+			return
+		}
+		if w, ok := err.(*WireErr); ok {
+			err = w.error
+		}
+		sig.Problems = append(sig.Problems, err.Error())
+	}
+	for _, i := range typed {
+		arg := call.Args[i]
+		t := info.TypeOf(arg)
+		if t == nil || t == types.Typ[types.Invalid] {
+			continue
+		}
+		switch name {
+		case "Build", "NewSet":
+			check(checkProviderArg(arg, t))
+		case "Bind":
+			if i == 0 {
+				check(checkPointerTo(t, "first argument to Bind must be a pointer to an interface type; found %s", isInterface))
+			} else if i == 1 && len(typed) == 2 && len(call.Args) == 2 && len(sig.Problems) == 0 {
+				// Both arguments are typed, and the first is valid.
+				_, err := processBind(pkg.Fset, info, call)
+				check(err)
+			}
+		case "Struct":
+			if i == 0 {
+				check(checkPointerTo(t, "first argument to Struct must be a pointer to a named struct; found %s", isStruct))
+			} else if st := structArg(info, call, false); st != nil && !(len(call.Args) == 2 && allFields(call)) {
+				_, err := checkField(arg, st)
+				check(err)
+			}
+		case "FieldsOf":
+			if i == 0 {
+				check(checkPointerTo(t, "first argument to FieldsOf must be a pointer to a struct or a pointer to a pointer to a struct; found %s", func(t types.Type) bool {
+					if p, ok := t.Underlying().(*types.Pointer); ok {
+						t = p.Elem()
+					}
+					return isStruct(t)
+				}))
+			} else if st := structArg(info, call, true); st != nil {
+				_, err := checkField(arg, st)
+				check(err)
+			}
+		}
+	}
+	return &sig
+}
+
+// checkProviderArg returns an error if arg, of type t, cannot be passed to
+// wire.Build or wire.NewSet.
+func checkProviderArg(arg ast.Expr, t types.Type) error {
+	if _, ok := t.Underlying().(*types.Signature); ok {
+		return nil
+	}
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() != nil && isWireImport(named.Obj().Pkg().Path()) {
+		return nil
+	}
+	return fmt.Errorf("%s is not a provider, provider set or wire helper; found %s", exprString(arg), types.TypeString(t, nil))
+}
+
+// checkPointerTo returns an error formatted with t if t is not a pointer
+// to a type for which ok reports true.
+func checkPointerTo(t types.Type, format string, ok func(types.Type) bool) error {
+	if p, isPtr := t.(*types.Pointer); isPtr && ok(p.Elem()) {
+		return nil
+	}
+	return fmt.Errorf(format, types.TypeString(t, nil))
+}
+
+func isInterface(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Interface)
+	return ok
+}
+
+func isStruct(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Struct)
+	return ok
+}
+
+// structArg returns the struct type of the first argument of the
+// wire.Struct or wire.FieldsOf call, dereferencing a pointer to a pointer
+// if deref is set, or nil if it is not one.
+func structArg(info *types.Info, call *ast.CallExpr, deref bool) *types.Struct {
+	if len(call.Args) == 0 {
+		return nil
+	}
+	p, ok := info.TypeOf(call.Args[0]).(*types.Pointer)
+	if !ok {
+		return nil
+	}
+	t := p.Elem()
+	if pp, ok := t.Underlying().(*types.Pointer); ok && deref {
+		t = pp.Elem()
+	}
+	st, _ := t.Underlying().(*types.Struct)
+	return st
+}
+
+// exprString returns the source of expr, abbreviated if it is long.
+func exprString(expr ast.Expr) string {
+	s := types.ExprString(expr)
+	if len(s) > 40 {
+		s = s[:37] + "..."
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// generatedHeader is the first line of the files written by Generate.
+const generatedHeader = "// Code generated by Wire. DO NOT EDIT."
+
+// A SignatureMismatch is an injector whose declaration in a wireinject file
+// and implementation in a file generated by Wire have different signatures,
+// e.g. after the declaration was edited without regenerating.
+type SignatureMismatch struct {
+	PkgPath string
+	Name    string
+	// Decl and Gen are the positions of the declaration and of the
+	// generated implementation, and DeclSig and GenSig their signatures
+	// without parameter names.
+	Decl    token.Position
+	Gen     token.Position
+	DeclSig string
+	GenSig  string
+	// DeclModTime and GenModTime are the modification times of the files
+	// of Decl and Gen, or zero if unknown.
+	DeclModTime time.Time
+	GenModTime  time.Time
+}
+
+// Error describes the mismatch and hints at the side that changed last.
+func (m *SignatureMismatch) Error() string {
+	var hint string
+	switch {
+	case m.DeclModTime.IsZero() || m.GenModTime.IsZero():
+	case m.DeclModTime.After(m.GenModTime):
+		hint = "; the declaration is newer, regenerate"
+	case m.GenModTime.After(m.DeclModTime):
+		hint = "; the generated file is newer, fix the declaration or regenerate"
+	}
+	return fmt.Sprintf("%v: inject %s: signature mismatch: declared as %s but generated as %s (%v)%s",
+		m.Decl, m.Name, m.DeclSig, m.GenSig, m.Gen, hint)
+}
+
+// CheckSignatures compares the signature of each injector declared in the
+// packages matching patterns with the signature of its implementation in
+// the files generated by Wire, if any, and returns the injectors whose
+// signatures differ. Parameter names are not compared.
+func CheckSignatures(ctx context.Context, wd string, env []string, tags string, patterns []string) ([]*SignatureMismatch, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	type decl struct {
+		pos token.Position
+		sig *types.Signature
+	}
+	decls := make(map[string]map[string]decl)
+	var genPatterns []string
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			for _, d := range f.Decls {
+				fn, ok := d.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil {
+					continue
+				}
+				if build, _ := findInjectorBuild(pkg.TypesInfo, fn); build == nil {
+					continue
+				}
+				if decls[pkg.PkgPath] == nil {
+					decls[pkg.PkgPath] = make(map[string]decl)
+					genPatterns = append(genPatterns, "pattern="+pkg.PkgPath)
+				}
+				decls[pkg.PkgPath][fn.Name.Name] = decl{
+					pos: pkg.Fset.Position(fn.Name.Pos()),
+					sig: pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature),
+				}
+			}
+		}
+	}
+	if len(genPatterns) == 0 {
+		return nil, nil
+	}
+	// Load the packages as go build would, to see the generated files.
+	// Type errors are expected if the signatures differ.
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadAllSyntax,
+		Dir:     wd,
+		Env:     env,
+	}
+	if len(tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + tags}
+	}
+	genPkgs, err := packages.Load(cfg, genPatterns...)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var mismatches []*SignatureMismatch
+	for _, pkg := range genPkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+		for _, f := range pkg.Syntax {
+			if !isGeneratedFile(f) {
+				continue
+			}
+			for _, d := range f.Decls {
+				fn, ok := d.(*ast.FuncDecl)
+				if !ok || fn.Recv != nil {
+					continue
+				}
+				dd, ok := decls[pkg.PkgPath][fn.Name.Name]
+				obj := pkg.TypesInfo.ObjectOf(fn.Name)
+				if !ok || obj == nil {
+					continue
+				}
+				genSig, ok := obj.Type().(*types.Signature)
+				if !ok {
+					continue
+				}
+				q := relativeToPath(pkg.PkgPath)
+				declStr, genStr := signatureString(dd.sig, q), signatureString(genSig, q)
+				if declStr == genStr {
+					continue
+				}
+				gen := pkg.Fset.Position(fn.Name.Pos())
+				mismatches = append(mismatches, &SignatureMismatch{
+					PkgPath:     pkg.PkgPath,
+					Name:        fn.Name.Name,
+					Decl:        dd.pos,
+					Gen:         gen,
+					DeclSig:     declStr,
+					GenSig:      genStr,
+					DeclModTime: modTime(dd.pos.Filename),
+					GenModTime:  modTime(gen.Filename),
+				})
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// isGeneratedFile reports whether f was written by Generate, possibly with
+// a header.
+func isGeneratedFile(f *ast.File) bool {
+	for _, cg := range f.Comments {
+		if cg.Pos() > f.Package {
+			break
+		}
+		for _, c := range cg.List {
+			if strings.HasPrefix(c.Text, generatedHeader) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// relativeToPath is like types.RelativeTo, but compares packages by path
+// so that it applies to packages from separate loads.
+func relativeToPath(path string) types.Qualifier {
+	return func(pkg *types.Package) string {
+		if pkg.Path() == path {
+			return ""
+		}
+		return pkg.Path()
+	}
+}
+
+// signatureString formats sig without parameter names, qualifying types
+// with q. Types are compared by name, as the two sides of a mismatch are
+// loaded separately.
+func signatureString(sig *types.Signature, q types.Qualifier) string {
+	unnamed := func(t *types.Tuple) *types.Tuple {
+		vars := make([]*types.Var, t.Len())
+		for i := range vars {
+			vars[i] = types.NewParam(token.NoPos, nil, "", t.At(i).Type())
+		}
+		return types.NewTuple(vars...)
+	}
+	return types.TypeString(types.NewSignature(nil, unnamed(sig.Params()), unnamed(sig.Results()), sig.Variadic()), q)
+}
+
+func modTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,633 @@
+package wire
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// SnapshotVersion is the version of the snapshot format written by Dump.
+const SnapshotVersion = 1
+
+// snapshotManifestName is the name of the manifest in a snapshot archive.
+// The files of the snapshot are stored under snapshotSrcDir.
+const (
+	snapshotManifestName = "manifest.json"
+	snapshotSrcDir       = "src/"
+)
+
+// A Snapshot holds the sources needed to reproduce the analysis of a
+// package without access to the repository it comes from, together with
+// the result of the analysis. It is written by Dump and read back by
+// Replay.
+type Snapshot struct {
+	Manifest SnapshotManifest
+	// Files maps slash-separated paths of the form "<module path>/<path in
+	// module>" to the contents of the files of the snapshot, including the
+	// go.mod file of each module.
+	Files map[string][]byte
+}
+
+// SnapshotManifest describes the contents of a snapshot.
+type SnapshotManifest struct {
+	Version int `json:"version"`
+	// PkgPath is the import path of the analyzed package and Name the
+	// injector or provider set graphed, if any. Without Name, the snapshot
+	// reproduces the code generated for the package.
+	PkgPath string `json:"pkgPath"`
+	Name    string `json:"name,omitempty"`
+	Tags    string `json:"tags,omitempty"`
+	// Main is the path of the module containing PkgPath and Modules the
+	// paths of the other modules in the snapshot.
+	Main    string   `json:"main"`
+	Modules []string `json:"modules,omitempty"`
+	// Minimized reports whether packages and files that do not affect the
+	// result were dropped, and Redacted whether string literals were
+	// replaced.
+	Minimized bool `json:"minimized"`
+	Redacted  bool `json:"redacted"`
+	// Sets describes the provider sets declared in PkgPath, for reading
+	// without replaying the snapshot.
+	Sets []*SnapshotSet `json:"sets,omitempty"`
+	// Result is the result of the analysis when the snapshot was taken.
+	Result *SnapshotResult `json:"result"`
+}
+
+// SnapshotSet describes the contents of a provider set.
+type SnapshotSet struct {
+	Name      string   `json:"name"`
+	Providers []string `json:"providers,omitempty"`
+	Bindings  []string `json:"bindings,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Imports   []string `json:"imports,omitempty"`
+	Requires  []string `json:"requires,omitempty"`
+}
+
+// SnapshotResult is the result of the analysis recorded in a snapshot:
+// either the errors it reported or its output, the graph of the named
+// injector or provider set in Graphviz format or the generated code.
+// File names in errors are relative to the module path.
+type SnapshotResult struct {
+	Errors []string `json:"errors,omitempty"`
+	Output string   `json:"output,omitempty"`
+}
+
+// Equal reports whether r and other are the same result.
+func (r *SnapshotResult) Equal(other *SnapshotResult) bool {
+	return reflect.DeepEqual(r, other)
+}
+
+// Dump analyzes the package matching pattern and returns a snapshot from
+// which Replay reproduces the result offline. If name is not empty, the
+// result is the graph of the injector or provider set called name, as
+// printed by Graph; otherwise it is the code generated for the package.
+//
+// Files that do not declare anything the injectors of the package depend
+// on are dropped from the snapshot, and so are the packages left without
+// files. If redact is true, the contents of string literals are replaced
+// by "x" except in import paths, struct tags, arguments of calls to
+// functions of the wire package and files declaring injectors, which end
+// up in the generated code. Dump replays the snapshot before returning it
+// and falls back to keeping all files if the minimized snapshot does not
+// reproduce the result; it fails if that does not either.
+func Dump(ctx context.Context, wd string, env []string, tags string, pattern string, name string, redact bool) (*Snapshot, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, []string{pattern})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(pkgs) != 1 {
+		return nil, []error{fmt.Errorf("expected exactly one package")}
+	}
+	pkg := pkgs[0]
+	main := moduleOf(pkg)
+	if main == nil {
+		return nil, []error{fmt.Errorf("%s is not in a module; dump only supports module mode", pkg.PkgPath)}
+	}
+	sf := newSnapshotFiles(pkg)
+	result := analysisResult(ctx, wd, env, tags, pkg.PkgPath, name, sf.moduleDirs())
+	manifest := SnapshotManifest{
+		Version: SnapshotVersion,
+		PkgPath: pkg.PkgPath,
+		Name:    name,
+		Tags:    tags,
+		Main:    main.Path,
+		Sets:    snapshotSets(ctx, wd, env, tags, pkg.PkgPath),
+		Result:  result,
+	}
+	for _, minimize := range []bool{true, false} {
+		keep := sf.all()
+		if minimize {
+			keep = sf.minimize(name)
+		}
+		s, err := sf.snapshot(manifest, keep, redact)
+		if err != nil {
+			return nil, []error{err}
+		}
+		s.Manifest.Minimized = minimize
+		replayed, errs := replayTemp(ctx, env, s)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		if replayed.Equal(result) {
+			return s, nil
+		}
+	}
+	if redact {
+		return nil, []error{errors.New("the redacted snapshot does not reproduce the result; dump without redaction")}
+	}
+	return nil, []error{errors.New("the snapshot does not reproduce the result")}
+}
+
+// Replay writes the files of s to dir, which must be empty or not exist,
+// and analyzes the package of s again from there, as Dump did. It does not
+// access the network: every module the package depends on outside the
+// standard library is in s.
+func Replay(ctx context.Context, env []string, s *Snapshot, dir string) (*SnapshotResult, []error) {
+	if s.Manifest.Version != SnapshotVersion {
+		return nil, []error{fmt.Errorf("unsupported snapshot version %d", s.Manifest.Version)}
+	}
+	dirs := make(map[string]string)
+	for _, mod := range append([]string{s.Manifest.Main}, s.Manifest.Modules...) {
+		dirs[filepath.Join(dir, filepath.FromSlash(mod))] = mod
+	}
+	for p, content := range s.Files {
+		if path.Base(p) == "go.mod" {
+			continue
+		}
+		if err := writeSnapshotFile(dir, p, content); err != nil {
+			return nil, []error{err}
+		}
+	}
+	for _, mod := range dirs {
+		var deps []string
+		if mod == s.Manifest.Main {
+			deps = s.Manifest.Modules
+		}
+		goMod := replayGoMod(s.Files[mod+"/go.mod"], mod, dir, deps)
+		if err := writeSnapshotFile(dir, mod+"/go.mod", goMod); err != nil {
+			return nil, []error{err}
+		}
+	}
+	env = append(append([]string(nil), env...),
+		"GO111MODULE=on", "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	wd := filepath.Join(dir, filepath.FromSlash(s.Manifest.Main))
+	return analysisResult(ctx, wd, env, s.Manifest.Tags, s.Manifest.PkgPath, s.Manifest.Name, dirs), nil
+}
+
+// replayTemp replays s in a temporary directory.
+func replayTemp(ctx context.Context, env []string, s *Snapshot) (*SnapshotResult, []error) {
+	dir, err := ioutil.TempDir("", "wireplus-replay")
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer os.RemoveAll(dir)
+	return Replay(ctx, env, s, dir)
+}
+
+func writeSnapshotFile(dir, p string, content []byte) error {
+	dst := filepath.Join(dir, filepath.FromSlash(p))
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, content, 0666)
+}
+
+// majorSuffix matches the major version suffix of a module path.
+var majorSuffix = regexp.MustCompile(`[/.]v([0-9]+)$`)
+
+// replayGoMod returns the go.mod file of module mod when replaying in dir.
+// It keeps the module and go directives of orig, the original go.mod file,
+// and requires each module in deps from its directory in dir.
+func replayGoMod(orig []byte, mod string, dir string, deps []string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "module %s\n", strconv.Quote(mod))
+	for _, line := range strings.Split(string(orig), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "go" {
+			fmt.Fprintf(&buf, "\ngo %s\n", fields[1])
+			break
+		}
+	}
+	for _, dep := range deps {
+		version := "v0.0.0"
+		if m := majorSuffix.FindStringSubmatch(dep); m != nil && (m[1] != "0" && m[1] != "1" || strings.HasPrefix(dep, "gopkg.in/")) {
+			version = "v" + m[1] + ".0.0"
+		}
+		fmt.Fprintf(&buf, "\nrequire %s %s\nreplace %s => %s\n", strconv.Quote(dep), version,
+			strconv.Quote(dep), strconv.Quote(filepath.Join(dir, filepath.FromSlash(dep))))
+	}
+	return buf.Bytes()
+}
+
+// analysisResult graphs name in the package pkgPath, or generates code for
+// the package if name is empty. dirs maps the directories of modules to
+// their paths, which replace them in errors and in the positions the graph
+// gives.
+func analysisResult(ctx context.Context, wd string, env []string, tags string, pkgPath string, name string, dirs map[string]string) *SnapshotResult {
+	result := new(SnapshotResult)
+	var errs []error
+	if name != "" {
+		result.Output, _, errs = Graph(ctx, wd, env, []string{pkgPath}, name, tags, "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	} else {
+		var gens []GenerateResult
+		gens, errs = Generate(ctx, wd, env, []string{pkgPath}, &GenerateOptions{Tags: tags})
+		for _, gen := range gens {
+			errs = append(errs, gen.Errs...)
+			result.Output += string(gen.Content)
+		}
+	}
+	if len(errs) > 0 {
+		result.Output = ""
+	}
+	prefixes := make([]string, 0, len(dirs))
+	for d := range dirs {
+		prefixes = append(prefixes, d)
+	}
+	// Replace longer directories first, in case modules are nested.
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+	// The tooltips of the graph give the positions of the providers.
+	for _, d := range prefixes {
+		result.Output = strings.Replace(result.Output, d+string(filepath.Separator), dirs[d]+"/", -1)
+	}
+	for _, err := range errs {
+		msg := err.Error()
+		for _, d := range prefixes {
+			msg = strings.Replace(msg, d+string(filepath.Separator), dirs[d]+"/", -1)
+		}
+		result.Errors = append(result.Errors, msg)
+	}
+	return result
+}
+
+// snapshotSets describes the provider sets declared in the package pkgPath.
+// Failures to load the sets are part of the result and are not reported.
+func snapshotSets(ctx context.Context, wd string, env []string, tags string, pkgPath string) []*SnapshotSet {
+	info, _ := Load(ctx, wd, env, tags, []string{pkgPath})
+	if info == nil {
+		return nil
+	}
+	var sets []*SnapshotSet
+	for id, set := range info.Sets {
+		if id.ImportPath != pkgPath {
+			continue
+		}
+		s := &SnapshotSet{Name: id.VarName}
+		for _, p := range set.Providers {
+			s.Providers = append(s.Providers, p.Pkg.Path()+"."+p.Name)
+		}
+		for _, b := range set.Bindings {
+			s.Bindings = append(s.Bindings, types.TypeString(b.Iface, nil)+" -> "+types.TypeString(b.Provided, nil))
+		}
+		for _, v := range set.Values {
+			s.Values = append(s.Values, types.TypeString(v.Out, nil))
+		}
+		for _, f := range set.Fields {
+			s.Fields = append(s.Fields, types.TypeString(f.Parent, nil)+"."+f.Name)
+		}
+		for _, imp := range set.Imports {
+			s.Imports = append(s.Imports, imp.Name())
+		}
+		for _, r := range set.Requires {
+			s.Requires = append(s.Requires, types.TypeString(r.Type, nil))
+		}
+		sets = append(sets, s)
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		return sets[i].Name < sets[j].Name
+	})
+	return sets
+}
+
+// moduleOf returns the module providing the files of pkg, or nil if pkg is
+// not in a module or is in the standard library.
+func moduleOf(pkg *packages.Package) *packages.Module {
+	if pkg.Module == nil || isStdlib(pkg.PkgPath) {
+		return nil
+	}
+	if pkg.Module.Replace != nil {
+		return &packages.Module{Path: pkg.Module.Path, Dir: pkg.Module.Replace.Dir, GoMod: pkg.Module.Replace.GoMod}
+	}
+	return pkg.Module
+}
+
+// A snapshotFile is a source file that may be part of a snapshot.
+type snapshotFile struct {
+	pkg    *packages.Package
+	file   *ast.File
+	module *packages.Module
+	// path is the path of the file in the snapshot.
+	path string
+}
+
+// snapshotFiles indexes the files of the packages in modules that the
+// analyzed package depends on.
+type snapshotFiles struct {
+	target *packages.Package
+	fset   *token.FileSet
+	files  []*snapshotFile
+	byFile map[*token.File]*snapshotFile
+	byPkg  map[string][]*snapshotFile
+	// modules maps module paths to the modules.
+	modules map[string]*packages.Module
+}
+
+func newSnapshotFiles(target *packages.Package) *snapshotFiles {
+	sf := &snapshotFiles{
+		target:  target,
+		fset:    target.Fset,
+		byFile:  make(map[*token.File]*snapshotFile),
+		byPkg:   make(map[string][]*snapshotFile),
+		modules: make(map[string]*packages.Module),
+	}
+	packages.Visit([]*packages.Package{target}, nil, func(pkg *packages.Package) {
+		mod := moduleOf(pkg)
+		if mod == nil {
+			return
+		}
+		sf.modules[mod.Path] = mod
+		for _, f := range pkg.Syntax {
+			tf := sf.fset.File(f.Pos())
+			rel, err := filepath.Rel(mod.Dir, tf.Name())
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			file := &snapshotFile{pkg: pkg, file: f, module: mod, path: mod.Path + "/" + filepath.ToSlash(rel)}
+			sf.files = append(sf.files, file)
+			sf.byFile[tf] = file
+			sf.byPkg[pkg.PkgPath] = append(sf.byPkg[pkg.PkgPath], file)
+		}
+	})
+	sort.Slice(sf.files, func(i, j int) bool {
+		return sf.files[i].path < sf.files[j].path
+	})
+	return sf
+}
+
+// moduleDirs maps the directories of the modules to their paths.
+func (sf *snapshotFiles) moduleDirs() map[string]string {
+	dirs := make(map[string]string)
+	for _, mod := range sf.modules {
+		dirs[mod.Dir] = mod.Path
+	}
+	return dirs
+}
+
+func (sf *snapshotFiles) all() map[*snapshotFile]bool {
+	keep := make(map[*snapshotFile]bool)
+	for _, f := range sf.files {
+		keep[f] = true
+	}
+	return keep
+}
+
+// minimize returns the files needed to analyze name in the target package,
+// or all of its injectors if name is empty. Starting from the files
+// declaring them, it adds the files declaring every object they use, the
+// methods of the types they declare and the packages they import for side
+// effects, until no more files are added.
+func (sf *snapshotFiles) minimize(name string) map[*snapshotFile]bool {
+	keep := make(map[*snapshotFile]bool)
+	var queue []*snapshotFile
+	add := func(f *snapshotFile) {
+		if f != nil && !keep[f] {
+			keep[f] = true
+			queue = append(queue, f)
+		}
+	}
+	addObj := func(obj types.Object) {
+		if obj.Pos().IsValid() {
+			add(sf.byFile[sf.fset.File(obj.Pos())])
+		}
+	}
+	for _, f := range sf.byPkg[sf.target.PkgPath] {
+		for _, decl := range f.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			if name != "" && fn.Recv == nil && fn.Name.Name == name {
+				add(f)
+			}
+			if build, _ := findInjectorBuild(sf.target.TypesInfo, fn); build != nil && name == "" {
+				add(f)
+			}
+		}
+	}
+	if name != "" {
+		if obj := sf.target.Types.Scope().Lookup(name); obj != nil {
+			addObj(obj)
+		}
+	}
+	if len(queue) == 0 {
+		for _, f := range sf.byPkg[sf.target.PkgPath] {
+			add(f)
+		}
+	}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		info := f.pkg.TypesInfo
+		ast.Inspect(f.file, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if obj := info.Uses[id]; obj != nil {
+				addObj(obj)
+			}
+			if obj, ok := info.Defs[id].(*types.TypeName); ok {
+				if named, ok := obj.Type().(*types.Named); ok {
+					for i := 0; i < named.NumMethods(); i++ {
+						addObj(named.Method(i))
+					}
+				}
+			}
+			return true
+		})
+		for _, imp := range f.file.Imports {
+			if imp.Name == nil || imp.Name.Name != "_" {
+				continue
+			}
+			path, err := strconv.Unquote(imp.Path.Value)
+			if err != nil || f.pkg.Imports[path] == nil {
+				continue
+			}
+			for _, g := range sf.byPkg[f.pkg.Imports[path].PkgPath] {
+				add(g)
+			}
+		}
+	}
+	return keep
+}
+
+// snapshot returns a snapshot of the files in keep and the go.mod files of
+// their modules, with manifest.
+func (sf *snapshotFiles) snapshot(manifest SnapshotManifest, keep map[*snapshotFile]bool, redact bool) (*Snapshot, error) {
+	s := &Snapshot{Manifest: manifest, Files: make(map[string][]byte)}
+	mods := make(map[string]*packages.Module)
+	for _, f := range sf.files {
+		if !keep[f] {
+			continue
+		}
+		src, err := ioutil.ReadFile(sf.fset.File(f.file.Pos()).Name())
+		if err != nil {
+			return nil, err
+		}
+		if redact {
+			src = redactFile(f.pkg.TypesInfo, sf.fset.File(f.file.Pos()), f.file, src)
+		}
+		s.Files[f.path] = src
+		mods[f.module.Path] = f.module
+	}
+	for p, mod := range mods {
+		if mod.GoMod != "" {
+			goMod, err := ioutil.ReadFile(mod.GoMod)
+			if err != nil {
+				return nil, err
+			}
+			s.Files[p+"/go.mod"] = goMod
+		}
+		if p != manifest.Main {
+			s.Manifest.Modules = append(s.Manifest.Modules, p)
+		}
+	}
+	sort.Strings(s.Manifest.Modules)
+	s.Manifest.Redacted = redact
+	return s, nil
+}
+
+// redactFile returns src, the source of f, with the contents of string
+// literals replaced by "x", byte for byte so that positions do not change.
+// Literals whose value matters to the analysis or ends up in generated
+// code are kept: import paths, struct tags, arguments of calls to wire
+// functions and all literals of files declaring injectors.
+func redactFile(info *types.Info, tf *token.File, f *ast.File, src []byte) []byte {
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			if build, _ := findInjectorBuild(info, fn); build != nil {
+				return src
+			}
+		}
+	}
+	out := append([]byte(nil), src...)
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.Field:
+			// Skip the tag.
+			ast.Inspect(n.Type, visit)
+			return false
+		case *ast.CallExpr:
+			return !isWireCall(info, n, "NewSet", "Build", "Bind", "Value", "InterfaceValue", "Struct", "FieldsOf", "Splice")
+		case *ast.BasicLit:
+			redactLit(tf, n, out)
+		}
+		return true
+	}
+	ast.Inspect(f, visit)
+	return out
+}
+
+// redactLit replaces the contents of lit in out if it is a string literal.
+func redactLit(tf *token.File, lit *ast.BasicLit, out []byte) {
+	if lit.Kind != token.STRING || len(lit.Value) < 2 {
+		return
+	}
+	start := tf.Offset(lit.Pos())
+	for i := start + 1; i < start+len(lit.Value)-1; i++ {
+		if out[i] != '\n' && out[i] != '\r' {
+			out[i] = 'x'
+		}
+	}
+}
+
+// WriteZip writes s to w as a zip archive.
+func (s *Snapshot) WriteZip(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	manifest, err := json.MarshalIndent(s.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(s.Files))
+	for p := range s.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	entries := append([]string{snapshotManifestName}, paths...)
+	for _, name := range entries {
+		content := manifest
+		if name != snapshotManifestName {
+			content = s.Files[name]
+			name = snapshotSrcDir + name
+		}
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ReadSnapshot reads a snapshot from the zip archive at file.
+func ReadSnapshot(file string) (*Snapshot, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	s := &Snapshot{Files: make(map[string][]byte)}
+	foundManifest := false
+	for _, zf := range zr.File {
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case zf.Name == snapshotManifestName:
+			if err := json.Unmarshal(content, &s.Manifest); err != nil {
+				return nil, fmt.Errorf("%s: invalid manifest: %v", file, err)
+			}
+			foundManifest = true
+		case strings.HasPrefix(zf.Name, snapshotSrcDir):
+			name := strings.TrimPrefix(zf.Name, snapshotSrcDir)
+			if clean := path.Clean(name); clean != name || strings.HasPrefix(clean, "../") || path.IsAbs(clean) {
+				return nil, fmt.Errorf("%s: invalid file name %q", file, zf.Name)
+			}
+			s.Files[name] = content
+		}
+	}
+	if !foundManifest {
+		return nil, fmt.Errorf("%s: missing %s", file, snapshotManifestName)
+	}
+	return s, nil
+}
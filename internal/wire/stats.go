@@ -0,0 +1,115 @@
+package wire
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// solveInjectors solves every injector function in pkgs and calls f with
+// the result. It returns the errors encountered while finding or solving
+// the injectors.
+func solveInjectors(pkgs []*packages.Package, f func(in *Injector, sol *buildSolution)) []error {
+	ec := new(errorCollector)
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+				build, err := findInjectorBuild(pkg.TypesInfo, fn)
+				if err != nil {
+					ec.add(err)
+					continue
+				}
+				if build == nil {
+					continue
+				}
+				sol, errs := solveForBuild(pkg, fn.Name.Name)
+				if len(errs) > 0 {
+					ec.add(errs...)
+					continue
+				}
+				f(&Injector{Pos: fn.Pos(), ImportPath: pkg.PkgPath, FuncName: fn.Name.Name}, sol)
+			}
+		}
+	}
+	return ec.errors
+}
+
+// injectorStats holds metrics of the graph of a solved injector.
+type injectorStats struct {
+	// providers is the number of calls in the injector.
+	providers int
+	// depth is the length of the longest chain of calls, and chain holds
+	// the indices into calls of such a chain, from input to output.
+	depth int
+	chain []int
+	// consumers maps each type consumed by a call to the indices of the
+	// calls consuming it.
+	consumers *typeutil.Map
+}
+
+// computeStats computes the statistics of the graph in sol.
+func computeStats(sol *buildSolution) *injectorStats {
+	st := &injectorStats{
+		providers: len(sol.calls),
+		consumers: new(typeutil.Map),
+	}
+	given := len(sol.ins)
+	depths := make([]int, len(sol.calls))
+	prev := make([]int, len(sol.calls))
+	for i := range sol.calls {
+		c := &sol.calls[i]
+		// Calls are in topological order, so the depth of each argument has
+		// already been computed.
+		depths[i], prev[i] = 1, -1
+		for _, arg := range c.args {
+			if arg < given {
+				continue
+			}
+			if d := depths[arg-given] + 1; d > depths[i] {
+				depths[i], prev[i] = d, arg-given
+			}
+		}
+		if depths[i] > st.depth {
+			st.depth = depths[i]
+			st.chain = nil
+			for j := i; j >= 0; j = prev[j] {
+				st.chain = append([]int{j}, st.chain...)
+			}
+		}
+		for _, in := range c.ins {
+			list, _ := st.consumers.At(in).([]int)
+			st.consumers.Set(in, append(list, i))
+		}
+	}
+	return st
+}
+
+// callName returns a short description of c for use in messages.
+func callName(c *call) string {
+	switch c.kind {
+	case funcProviderCall:
+		return c.pkg.Name() + "." + c.name
+	case structProvider:
+		return c.pkg.Name() + "." + c.name + "{}"
+	case selectorExpr:
+		return types.TypeString(c.out, nil) + " (field " + c.name + ")"
+	default:
+		return types.TypeString(c.out, nil) + " (value)"
+	}
+}
+
+// callNames returns the names of the calls at the given indices.
+func callNames(calls []call, indices []int) string {
+	names := make([]string, len(indices))
+	for i, j := range indices {
+		names[i] = callName(&calls[j])
+	}
+	return strings.Join(names, ", ")
+}
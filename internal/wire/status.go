@@ -0,0 +1,91 @@
+package wire
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+)
+
+// States of a package reported by Status.
+const (
+	StatusUpToDate          = "up to date"
+	StatusStale             = "stale"
+	StatusNotGenerated      = "not generated"
+	StatusSignatureMismatch = "signature mismatch"
+	StatusError             = "error"
+)
+
+// PackageStatus is the state of the generated file of a package.
+type PackageStatus struct {
+	PkgPath    string
+	OutputPath string
+	// State is one of the Status constants. StatusSignatureMismatch takes
+	// precedence over StatusStale, as regenerating may not be the fix.
+	State string
+	// Mismatches holds the injectors whose signatures differ between their
+	// declaration and the generated file.
+	Mismatches []*SignatureMismatch
+	// Errs holds the errors that prevented generation.
+	Errs []error
+}
+
+// Status compares the files Generate would write for the packages matching
+// patterns with the files on disk. Packages without injectors are omitted.
+func Status(ctx context.Context, wd string, env []string, patterns []string, opts *GenerateOptions) ([]*PackageStatus, []error) {
+	if opts == nil {
+		opts = &GenerateOptions{}
+	}
+	outs, errs := Generate(ctx, wd, env, patterns, opts)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	mismatches, errs := CheckSignatures(ctx, wd, env, opts.Tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	var statuses []*PackageStatus
+	for _, out := range outs {
+		st := &PackageStatus{PkgPath: out.PkgPath, OutputPath: out.OutputPath}
+		switch {
+		case len(out.Errs) > 0:
+			st.State = StatusError
+			st.Errs = out.Errs
+		case len(out.Content) == 0:
+			continue
+		default:
+			cur, err := ioutil.ReadFile(out.OutputPath)
+			switch {
+			case os.IsNotExist(err):
+				st.State = StatusNotGenerated
+			case err != nil:
+				st.State = StatusError
+				st.Errs = []error{err}
+			case bytes.Equal(cur, out.Content) && manifestUpToDate(out):
+				st.State = StatusUpToDate
+			default:
+				st.State = StatusStale
+			}
+		}
+		for _, m := range mismatches {
+			if m.PkgPath == out.PkgPath {
+				st.Mismatches = append(st.Mismatches, m)
+			}
+		}
+		if len(st.Mismatches) > 0 && st.State != StatusError {
+			st.State = StatusSignatureMismatch
+		}
+		statuses = append(statuses, st)
+	}
+	return statuses, nil
+}
+
+// manifestUpToDate reports whether the manifest file of out, if any, is on
+// disk with the generated content.
+func manifestUpToDate(out GenerateResult) bool {
+	if len(out.ManifestContent) == 0 {
+		return true
+	}
+	cur, err := ioutil.ReadFile(out.ManifestPath)
+	return err == nil && bytes.Equal(cur, out.ManifestContent)
+}
@@ -0,0 +1,30 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// WireProvider describes a step of the construction plan of an injector.
+type WireProvider struct {
+	// Name identifies the provider, value or field.
+	Name string
+	// Type is the type provided by the step.
+	Type string
+	// Pos is the position of the provider in the source.
+	Pos string
+}
+
+// wireManifest holds the construction plans of the injectors in the package, in call order.
+var wireManifest = []WireProvider{
+	// injectApp
+	{Name: "wire.Value", Type: "example.com/foo.Config", Pos: "example.com/foo/wire.go:25:14"},
+	{Name: "example.com/foo.provideGreeter", Type: "*example.com/foo.Greeter", Pos: "example.com/foo/foo.go:30:6"},
+	{Name: "example.com/foo.Config.Name", Type: "string", Pos: "example.com/foo/foo.go:18:2"},
+	{Name: "example.com/foo.App", Type: "*example.com/foo.App", Pos: "example.com/foo/foo.go:25:6"},
+}
+
+// injectAppManifest returns the construction plan of injectApp.
+func injectAppManifest() []WireProvider {
+	return append([]WireProvider(nil), wireManifest[0:4]...)
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/wire"
+)
+
+func main() {
+	fmt.Println(injectFooBar())
+}
+
+type Foo int
+type Bar int
+type FooBar int
+
+var FooSet = wire.NewSet(provideFoo)
+
+var OtherFooSet = wire.NewSet(provideOtherFoo)
+
+// AllFooSet provides Foo twice.
+var AllFooSet = wire.NewSet(FooSet, OtherFooSet)
+
+// BarSet provides Bar twice.
+var BarSet = wire.NewSet(provideBar, provideOtherBar)
+
+func provideFoo() Foo {
+	return 41
+}
+
+func provideOtherFoo() Foo {
+	return 14
+}
+
+func provideBar() Bar {
+	return 1
+}
+
+func provideOtherBar() Bar {
+	return 2
+}
+
+func provideFooBar(foo Foo, bar Bar) FooBar {
+	return FooBar(foo) + FooBar(bar)
+}
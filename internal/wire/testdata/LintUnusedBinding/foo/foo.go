@@ -0,0 +1,57 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/wire"
+)
+
+func main() {
+	fmt.Println(injectApp().Greeter.Greet())
+}
+
+type Greeter interface {
+	Greet() string
+}
+
+type Closer interface {
+	Close() error
+}
+
+type Impl struct{}
+
+func (*Impl) Greet() string { return "hello" }
+func (*Impl) Close() error  { return nil }
+
+type App struct {
+	Greeter Greeter
+}
+
+// Nothing consumes a Closer.
+var Set = wire.NewSet(
+	NewImpl,
+	wire.Bind(new(Greeter), new(*Impl)),
+	wire.Bind(new(Closer), new(*Impl)),
+	NewApp)
+
+func NewImpl() *Impl {
+	return new(Impl)
+}
+
+func NewApp(g Greeter) *App {
+	return &App{Greeter: g}
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/wire"
+)
+
+func main() {
+	fmt.Println(injectFoo(), injectBar())
+}
+
+type Foo int
+type Bar int
+type Baz int
+
+// provideBaz is in Set, but no injector needs a Baz.
+var Set = wire.NewSet(provideFoo, provideBar, provideBaz)
+
+func provideFoo() Foo {
+	return 41
+}
+
+func provideBar() Bar {
+	return 42
+}
+
+func provideBaz() Baz {
+	return 43
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	app, cleanup := injectApp()
+	fmt.Println(app.cache.name, app.store == nil)
+	cleanup()
+}
+
+type Cache struct {
+	name string
+}
+
+type Store struct {
+	name string
+}
+
+type App struct {
+	cache *Cache
+	store *Store
+}
+
+func provideCache() (*Cache, bool) {
+	return &Cache{name: "cache"}, true
+}
+
+// provideStore does not find the store, so its value is replaced and its
+// cleanup function is never called.
+func provideStore() (*Store, func(), bool) {
+	return &Store{name: "store"}, func() { fmt.Println("store closed") }, false
+}
+
+func provideApp(cache *Cache, store *Store) (*App, func()) {
+	return &App{cache: cache, store: store}, func() { fmt.Println("app closed") }
+}
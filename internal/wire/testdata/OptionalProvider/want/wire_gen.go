@@ -0,0 +1,26 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func injectApp() (*App, func()) {
+	cache, ok := provideCache()
+	if !ok {
+		cache = nil
+	}
+	store, cleanup, ok := provideStore()
+	if !ok {
+		store = nil
+		cleanup = func() {}
+	}
+	app, cleanup2 := provideApp(cache, store)
+	return app, func() {
+		cleanup2()
+		cleanup()
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	app, cleanup, err := injectApp()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(app.DB.Name)
+	cleanup()
+	fmt.Println(app.DB.Name)
+}
+
+type DB struct {
+	Name string
+}
+
+type App struct {
+	DB *DB
+}
+
+func provideDB() (*DB, func(), error) {
+	db := &DB{Name: "db"}
+	return db, func() { db.Name = "closed" }, nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/wire"
+)
+
+func main() {
+	s := injectServer(context.Background(), &Config{Name: "requires"})
+	fmt.Println(s.name)
+}
+
+type Config struct {
+	Name string
+}
+
+type Server struct {
+	name string
+}
+
+func NewServer(ctx context.Context, cfg *Config) *Server {
+	return &Server{name: cfg.Name}
+}
+
+var ServerSet = wire.NewSet(
+	wire.Requires(new(*Config), new(context.Context)),
+	NewServer,
+)
@@ -0,0 +1,18 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+import (
+	"context"
+)
+
+// Injectors from wire.go:
+
+func injectServer(ctx context.Context, cfg *Config) *Server {
+	server := NewServer(ctx, cfg)
+	return server
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/wire"
+)
+
+func main() {
+	fmt.Println(injectApp().Cache.DB.Config)
+}
+
+type Config string
+
+type DB struct {
+	Config Config
+}
+
+type Cache struct {
+	DB *DB
+}
+
+type App struct {
+	DB    *DB
+	Cache *Cache
+}
+
+var storageProviders = []interface{}{
+	provideDB,
+	provideCache,
+}
+
+var configProviders = [...]interface{}{
+	wire.Value(Config("postgres")),
+}
+
+var Set = wire.NewSet(
+	wire.Splice(storageProviders),
+	wire.Splice(configProviders),
+	wire.Struct(new(App), "*"))
+
+func provideDB(cfg Config) *DB {
+	return &DB{Config: cfg}
+}
+
+func provideCache(db *DB) *Cache {
+	return &Cache{DB: db}
+}
@@ -0,0 +1,24 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func injectApp() *App {
+	config := _wireConfigValue
+	db := provideDB(config)
+	cache := provideCache(db)
+	app := &App{
+		DB:    db,
+		Cache: cache,
+	}
+	return app
+}
+
+var (
+	_wireConfigValue = Config("postgres")
+)
@@ -0,0 +1,53 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	fmt.Println(injectFoo())
+}
+
+type Foo int
+
+type Baz int
+
+func provideFoo() Foo {
+	return 41
+}
+
+func provideBaz() Baz {
+	return 42
+}
+
+var invalidProviders = []interface{}{
+	provideFoo,
+	"not a provider",
+}
+
+var dynamicProviders = makeProviders()
+
+func makeProviders() []interface{} {
+	return []interface{}{provideBaz}
+}
+
+var mutableProviders = []interface{}{provideBaz}
+
+func init() {
+	mutableProviders = append(mutableProviders, provideFoo)
+}
+
+var bazProviders = []interface{}{provideBaz}
@@ -0,0 +1,48 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+import (
+	"github.com/google/wire"
+)
+
+// Injectors from wire.go:
+
+func injectBar() (Bar, func(), error) {
+	traceHooks := provideHooks()
+	traceHooks.Before("example.com/foo.provideFoo")
+	foo, err := provideFoo()
+	traceHooks.After("example.com/foo.provideFoo", err)
+	if err != nil {
+		return 0, nil, err
+	}
+	traceHooks.Before("example.com/foo.provideBar")
+	bar, cleanup, err := provideBar(foo)
+	traceHooks.After("example.com/foo.provideBar", err)
+	if err != nil {
+		return 0, nil, err
+	}
+	return bar, func() {
+		cleanup()
+	}, nil
+}
+
+func injectBaz(hooks wire.TraceHooks) (Baz, error) {
+	hooks.Before("example.com/foo.provideFoo")
+	foo, err := provideFoo()
+	hooks.After("example.com/foo.provideFoo", err)
+	if err != nil {
+		return 0, err
+	}
+	hooks.Before("example.com/foo.provideBaz")
+	baz, err := provideBaz(foo)
+	hooks.After("example.com/foo.provideBaz", err)
+	if err != nil {
+		return 0, err
+	}
+	return baz, nil
+}
@@ -0,0 +1,39 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+import (
+	"github.com/google/wire"
+)
+
+// Injectors from wire.go:
+
+func injectBar() (Bar, func(), error) {
+	foo, err := provideFoo()
+	if err != nil {
+		return 0, nil, err
+	}
+	bar, cleanup, err := provideBar(foo)
+	if err != nil {
+		return 0, nil, err
+	}
+	return bar, func() {
+		cleanup()
+	}, nil
+}
+
+func injectBaz(hooks wire.TraceHooks) (Baz, error) {
+	foo, err := provideFoo()
+	if err != nil {
+		return 0, err
+	}
+	baz, err := provideBaz(foo)
+	if err != nil {
+		return 0, err
+	}
+	return baz, nil
+}
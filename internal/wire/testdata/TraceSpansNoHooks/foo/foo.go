@@ -0,0 +1,42 @@
+// Copyright 2018 The Wire Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+)
+
+func main() {
+	bar, cleanup, err := injectBar()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(bar)
+	cleanup()
+}
+
+type (
+	Foo int
+	Bar int
+)
+
+func provideFoo() (Foo, error) {
+	return 41, nil
+}
+
+func provideBar(foo Foo) (Bar, func(), error) {
+	return Bar(foo + 1), func() { fmt.Println("cleanup bar") }, nil
+}
@@ -0,0 +1,23 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func injectBar() (Bar, func(), error) {
+	foo, err := provideFoo()
+	if err != nil {
+		return 0, nil, err
+	}
+	bar, cleanup, err := provideBar(foo)
+	if err != nil {
+		return 0, nil, err
+	}
+	return bar, func() {
+		cleanup()
+	}, nil
+}
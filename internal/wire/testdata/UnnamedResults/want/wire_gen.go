@@ -0,0 +1,22 @@
+// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//go:build !wireinject
+// +build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func injectApp() (*App, func(), error) {
+	db, cleanup, err := provideDB()
+	if err != nil {
+		return nil, nil, err
+	}
+	app := &App{
+		DB: db,
+	}
+	return app, func() {
+		cleanup()
+	}, nil
+}
@@ -0,0 +1,150 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timings maps the stable identifiers of providers, as returned by
+// providerID and written to the manifest and passed to wire.TraceHooks, to
+// their measured construction durations.
+type Timings map[string]time.Duration
+
+// ParseTimings parses a JSON object mapping provider identifiers to
+// durations, given either as strings accepted by time.ParseDuration, e.g.
+// "12.5ms", or as numbers of nanoseconds.
+func ParseTimings(data []byte) (Timings, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse timings: %v", err)
+	}
+	timings := make(Timings, len(raw))
+	for id, v := range raw {
+		switch v := v.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("parse timings: %s: %v", id, err)
+			}
+			timings[id] = d
+		case float64:
+			timings[id] = time.Duration(v)
+		default:
+			return nil, fmt.Errorf("parse timings: %s: duration must be a string or a number", id)
+		}
+	}
+	return timings, nil
+}
+
+// A ProviderTiming is the measured duration of a provider in a graph.
+type ProviderTiming struct {
+	ID       string
+	Duration time.Duration
+}
+
+// A TimingsReport summarizes the timings overlaid onto a graph.
+type TimingsReport struct {
+	// Unmatched lists the identifiers of the timings that match no
+	// provider in the graph, sorted.
+	Unmatched []string
+	// Slowest lists the providers in the graph with a measured duration,
+	// slowest first.
+	Slowest []ProviderTiming
+	// CriticalPath is the chain of providers whose measured durations sum
+	// to the largest total, from the root of the graph.
+	CriticalPath []ProviderTiming
+}
+
+// matchTimings returns the measured duration of each call found in timings,
+// by index, and the report of the graph of calls. index is as for
+// criticalPath.
+func matchTimings(timings Timings, calls []call, set *ProviderSet, index func(arg int) int) (map[int]time.Duration, *TimingsReport) {
+	durations := make(map[int]time.Duration)
+	matched := make(map[string]bool)
+	report := new(TimingsReport)
+	for i := range calls {
+		id := providerID(set, &calls[i])
+		d, ok := timings[id]
+		if !ok {
+			continue
+		}
+		durations[i] = d
+		report.Slowest = append(report.Slowest, ProviderTiming{ID: id, Duration: d})
+		matched[id] = true
+	}
+	for id := range timings {
+		if !matched[id] {
+			report.Unmatched = append(report.Unmatched, id)
+		}
+	}
+	sort.Strings(report.Unmatched)
+	sort.SliceStable(report.Slowest, func(i, j int) bool {
+		return report.Slowest[i].Duration > report.Slowest[j].Duration
+	})
+	path := heaviestPath(calls, index, func(i int) int64 {
+		return int64(durations[i])
+	})
+	if path != nil {
+		// Find the root of the path, which no call on it points to.
+		next := make(map[int]bool)
+		for _, j := range path {
+			next[j] = true
+		}
+		for i := range path {
+			if next[i] {
+				continue
+			}
+			for ; i != -1; i = path[i] {
+				report.CriticalPath = append(report.CriticalPath, ProviderTiming{
+					ID:       providerID(set, &calls[i]),
+					Duration: durations[i],
+				})
+			}
+			break
+		}
+	}
+	return durations, report
+}
+
+// heatLevels is the number of classes of nodes with a measured duration,
+// from "heat-1" for the fastest to "heat-5" for the slowest.
+const heatLevels = 5
+
+// heat returns the fraction of max that d represents, between 0 and 1.
+func heat(d, max time.Duration) float64 {
+	if max <= 0 {
+		return 0
+	}
+	return float64(d) / float64(max)
+}
+
+// heatClass returns the class of a node whose duration has heat h.
+func heatClass(h float64) string {
+	level := int(h*heatLevels + 0.5)
+	if level < 1 {
+		level = 1
+	}
+	if level > heatLevels {
+		level = heatLevels
+	}
+	return fmt.Sprintf("heat-%d", level)
+}
+
+// heatColor returns the graphviz fill color of a node whose duration has
+// heat h, from white to red.
+func heatColor(h float64) string {
+	return fmt.Sprintf("0.000 %.3f 1.000", h)
+}
+
+// maxDuration returns the largest duration in durations.
+func maxDuration(durations map[int]time.Duration) time.Duration {
+	var max time.Duration
+	for _, d := range durations {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
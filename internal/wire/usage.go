@@ -0,0 +1,172 @@
+package wire
+
+import (
+	"context"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// UsageMatch describes a step of a solved injector that matches the target
+// of Usage.
+type UsageMatch struct {
+	// Kind is "provider", "struct provider", "value", "field" or "binding".
+	Kind string `json:"kind"`
+	// Name is the provider as "path/to/pkg.Name". It is only set for
+	// providers.
+	Name string `json:"name,omitempty"`
+	// Type is the type provided by the step, or the interface bound by a
+	// binding.
+	Type string `json:"type"`
+	// Impl is the concrete type bound to Type. It is only set for bindings.
+	Impl string `json:"impl,omitempty"`
+	// BoundTo lists the interfaces consumed by the injector that are bound
+	// to Type by wire.Bind, sorted.
+	BoundTo []string `json:"boundTo,omitempty"`
+	// Sets is the chain of provider sets through which the step is
+	// imported, from the one passed to wire.Build to the one declaring it.
+	// It is empty if the step is passed to wire.Build directly.
+	Sets []string `json:"sets"`
+	// Position is the position of the declaration of the provider, value or
+	// field, or of the call to wire.Bind.
+	Position string `json:"position"`
+}
+
+// InjectorUsage describes how a single injector uses the target of Usage.
+type InjectorUsage struct {
+	// Injector is the injector name as ""path/to/pkg".Foo".
+	Injector string `json:"injector"`
+	// Matches lists the matching steps in the order of the solved graph.
+	// It is empty if the injector does not use the target.
+	Matches []*UsageMatch `json:"matches"`
+}
+
+// UsageReport is the result of Usage.
+type UsageReport struct {
+	// Target is the provider or type looked up.
+	Target string `json:"target"`
+	// Injectors is the list of all solved injectors, sorted by name.
+	Injectors []*InjectorUsage `json:"injectors"`
+}
+
+// Used returns the number of injectors that use the target.
+func (r *UsageReport) Used() int {
+	n := 0
+	for _, iu := range r.Injectors {
+		if len(iu.Matches) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Usage solves every injector in the packages matching patterns and
+// reports the steps of each solved graph that match target. target is
+// either a provider function, as "path/to/pkg.Name" or just "Name", or a
+// type as formatted by types.TypeString, e.g. "*path/to/pkg.Name". A
+// provider reached through wire.Bind is reported with the interfaces it is
+// bound to, and a type matching a bound interface is reported as a binding.
+func Usage(ctx context.Context, wd string, env []string, patterns []string, tags string, target string) (*UsageReport, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	report := &UsageReport{Target: target, Injectors: []*InjectorUsage{}}
+	if len(pkgs) == 0 {
+		return report, nil
+	}
+	fset := pkgs[0].Fset
+	errs = solveInjectors(pkgs, func(in *Injector, sol *buildSolution) {
+		iu := &InjectorUsage{Injector: in.String(), Matches: []*UsageMatch{}}
+		// Interface bindings do not create calls, so they are found by
+		// looking at the types consumed by the calls and the injector
+		// itself, as in moduleAttributor.attribute.
+		var bound typeutil.Map
+		var bindings []types.Type
+		bind := func(t types.Type) {
+			if bound.At(t) != nil {
+				return
+			}
+			bound.Set(t, true)
+			if src := leafSrc(sol.pset, t); src != nil && src.Binding != nil {
+				bindings = append(bindings, t)
+			}
+		}
+		bind(sol.out)
+		for i := range sol.calls {
+			for _, t := range sol.calls[i].ins {
+				bind(t)
+			}
+		}
+		boundTo := func(t types.Type) []string {
+			var ifaces []string
+			for _, iface := range bindings {
+				if types.Identical(leafSrc(sol.pset, iface).Binding.Provided, t) {
+					ifaces = append(ifaces, types.TypeString(iface, nil))
+				}
+			}
+			sort.Strings(ifaces)
+			return ifaces
+		}
+		for i := range sol.calls {
+			c := &sol.calls[i]
+			m := &UsageMatch{
+				Type:     types.TypeString(c.out, nil),
+				Sets:     importChain(sol.pset, c.out),
+				Position: fset.Position(c.pos).String(),
+			}
+			m.Kind, m.Name = describeCall(c)
+			if m.Type != target && (m.Name == "" || (m.Name != target && c.name != target)) {
+				continue
+			}
+			m.BoundTo = boundTo(c.out)
+			iu.Matches = append(iu.Matches, m)
+		}
+		for _, iface := range bindings {
+			if types.TypeString(iface, nil) != target {
+				continue
+			}
+			b := leafSrc(sol.pset, iface).Binding
+			iu.Matches = append(iu.Matches, &UsageMatch{
+				Kind:     "binding",
+				Type:     target,
+				Impl:     types.TypeString(b.Provided, nil),
+				Sets:     importChain(sol.pset, iface),
+				Position: fset.Position(b.Pos).String(),
+			})
+		}
+		report.Injectors = append(report.Injectors, iu)
+	})
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	sort.Slice(report.Injectors, func(i, j int) bool {
+		return report.Injectors[i].Injector < report.Injectors[j].Injector
+	})
+	return report, nil
+}
+
+// importChain returns the names of the provider sets through which set
+// imports the source of t, from the nearest to set to the one declaring the
+// source, following the imports as parentKeys does. Named sets are given as
+// ""path/to/pkg".Name" and anonymous ones by their AnonID.
+func importChain(set *ProviderSet, t types.Type) []string {
+	chain := []string{}
+	for set != nil {
+		v := set.srcMap.At(t)
+		if v == nil {
+			break
+		}
+		set = v.(*providerSetSrc).Import
+		if set == nil {
+			break
+		}
+		if set.VarName == "" {
+			chain = append(chain, set.AnonID)
+		} else {
+			chain = append(chain, ProviderSetID{ImportPath: set.PkgPath, VarName: set.VarName}.String())
+		}
+	}
+	return chain
+}
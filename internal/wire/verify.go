@@ -0,0 +1,182 @@
+package wire
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/taichimaeda/wireplus/internal/logging"
+	"golang.org/x/tools/go/packages"
+)
+
+// A BuildError is a compile error found by VerifyBuild.
+type BuildError struct {
+	// Pos is the position of the error.
+	Pos token.Position
+	// Msg is the error message reported by the compiler.
+	Msg string
+	// Generated is true if the error is in a file written by Generate.
+	// Otherwise, the error was not introduced by Wire.
+	Generated bool
+	// Injector and Provider name the injector function and the provider
+	// call containing Pos, if Pos is in a generated file. Either may be
+	// empty if it could not be determined.
+	Injector string
+	Provider string
+}
+
+// Error returns the error message prefixed by the position if valid.
+func (e *BuildError) Error() string {
+	var sb strings.Builder
+	if e.Pos.IsValid() {
+		sb.WriteString(e.Pos.String() + ": ")
+	}
+	if !e.Generated {
+		sb.WriteString("pre-existing error: " + e.Msg)
+		return sb.String()
+	}
+	sb.WriteString("generated code does not compile: " + e.Msg)
+	switch {
+	case e.Injector != "" && e.Provider != "":
+		fmt.Fprintf(&sb, " (inject %s, provider %s)", e.Injector, e.Provider)
+	case e.Injector != "":
+		fmt.Fprintf(&sb, " (inject %s)", e.Injector)
+	}
+	return sb.String()
+}
+
+// VerifyBuild type checks the packages of outs without the wireinject build
+// tag, as go build would after the outputs are committed, and returns the
+// compile errors found. Errors in the generated files are attributed to the
+// injector and provider call responsible for them.
+//
+// The second return value holds the errors that prevented the check.
+func VerifyBuild(ctx context.Context, wd string, env []string, tags string, outs []GenerateResult) ([]*BuildError, []error) {
+	defer logging.Phase("verify")()
+	generated := make(map[string][]byte)
+	var patterns []string
+	for _, out := range outs {
+		if len(out.Content) == 0 {
+			continue
+		}
+		generated[filepath.Clean(out.OutputPath)] = out.Content
+		if len(out.ManifestContent) > 0 {
+			generated[filepath.Clean(out.ManifestPath)] = out.ManifestContent
+		}
+		patterns = append(patterns, "pattern="+out.PkgPath)
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packages.LoadAllSyntax,
+		Dir:     wd,
+		Env:     env,
+	}
+	if len(tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + tags}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var buildErrs []*BuildError
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			if e.Kind == packages.ListError && strings.HasPrefix(e.Msg, "# ") {
+				// Compiler output reported by go list, which duplicates the
+				// type errors.
+				continue
+			}
+			be := &BuildError{
+				Pos: parseErrorPos(e.Pos),
+				Msg: e.Msg,
+			}
+			if src, ok := generated[filepath.Clean(be.Pos.Filename)]; ok {
+				be.Generated = true
+				be.Injector, be.Provider = attributeGenerated(src, be.Pos)
+			}
+			buildErrs = append(buildErrs, be)
+		}
+	}
+	return buildErrs, nil
+}
+
+// parseErrorPos parses the position of a packages.Error, which is of the
+// form "file:line:col", "file:line" or "-".
+func parseErrorPos(pos string) token.Position {
+	parts := strings.Split(pos, ":")
+	// Strip the line and column from the right, as the file name may
+	// contain colons.
+	var nums []int
+	for len(parts) > 1 && len(nums) < 2 {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		nums = append([]int{n}, nums...)
+		parts = parts[:len(parts)-1]
+	}
+	var p token.Position
+	if len(nums) > 0 {
+		p.Line = nums[0]
+	}
+	if len(nums) > 1 {
+		p.Column = nums[1]
+	}
+	p.Filename = strings.Join(parts, ":")
+	if p.Filename == "-" {
+		p.Filename = ""
+	}
+	return p
+}
+
+// attributeGenerated returns the names of the injector function and the
+// provider call in the generated source src that contain pos.
+func attributeGenerated(src []byte, pos token.Position) (injector, provider string) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return "", ""
+	}
+	contains := func(n ast.Node) bool {
+		start, end := fset.Position(n.Pos()), fset.Position(n.End())
+		if pos.Line < start.Line || pos.Line > end.Line {
+			return false
+		}
+		if pos.Column == 0 {
+			return true
+		}
+		return (pos.Line > start.Line || pos.Column >= start.Column) &&
+			(pos.Line < end.Line || pos.Column <= end.Column)
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || !contains(fn) {
+			continue
+		}
+		injector = fn.Name.Name
+		// The innermost call or composite literal is the provider.
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if n == nil || !contains(n) {
+				return false
+			}
+			switch n := n.(type) {
+			case *ast.CallExpr:
+				provider = types.ExprString(n.Fun)
+			case *ast.CompositeLit:
+				provider = types.ExprString(n.Type)
+			}
+			return true
+		})
+		return injector, provider
+	}
+	return "", ""
+}
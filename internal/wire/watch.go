@@ -0,0 +1,65 @@
+package wire
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// WatchFiles loads the packages matching patterns and returns the Go files
+// that the code generated for them depends on, each mapped to the sorted
+// import paths of the matching packages that depend on it. These are the
+// files of the matching packages and of their dependencies in the same
+// module, or outside the standard library in GOPATH mode. The files
+// written by Generate are excluded, so that writing them does not count as
+// a change.
+func WatchFiles(ctx context.Context, wd string, env []string, tags string, patterns []string) (map[string][]string, []error) {
+	pkgs, errs := LoadPackages(ctx, wd, env, tags, patterns)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	deps := make(map[string]map[string]bool)
+	for _, root := range pkgs {
+		packages.Visit([]*packages.Package{root}, nil, func(p *packages.Package) {
+			if !sameModule(root, p) {
+				return
+			}
+			for _, path := range p.GoFiles {
+				if isGeneratedPath(path) {
+					continue
+				}
+				if deps[path] == nil {
+					deps[path] = make(map[string]bool)
+				}
+				deps[path][root.PkgPath] = true
+			}
+		})
+	}
+	files := make(map[string][]string, len(deps))
+	for path, roots := range deps {
+		for pkgPath := range roots {
+			files[path] = append(files[path], pkgPath)
+		}
+		sort.Strings(files[path])
+	}
+	return files, nil
+}
+
+// sameModule reports whether p belongs to the module of root, or, in GOPATH
+// mode, whether p is outside the standard library.
+func sameModule(root, p *packages.Package) bool {
+	if root.Module == nil || p.Module == nil {
+		return root.Module == nil && p.Module == nil && !isStdlib(p.PkgPath)
+	}
+	return root.Module.Path == p.Module.Path
+}
+
+// isGeneratedPath reports whether path is a file written by Generate, with
+// any prefix given by GenerateOptions.PrefixOutputFile.
+func isGeneratedPath(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, "wire_gen.go") || strings.HasSuffix(base, manifestFileName)
+}
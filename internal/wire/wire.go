@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
+	"go/parser"
 	"go/printer"
 	"go/token"
 	"go/types"
@@ -34,6 +35,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/taichimaeda/wireplus/internal/logging"
 	"golang.org/x/tools/go/ast/astutil"
 	"golang.org/x/tools/go/packages"
 )
@@ -50,14 +52,51 @@ type GenerateResult struct {
 	Content []byte
 	// Errs is a slice of errors identified during generation.
 	Errs []error
+	// ManifestPath and ManifestContent are the path and content of the
+	// manifest file written with GenerateOptions.EmitManifest. They are
+	// empty otherwise.
+	ManifestPath    string
+	ManifestContent []byte
 }
 
-// Commit writes the generated file to disk.
+// Commit writes the generated files to disk.
 func (gen GenerateResult) Commit() error {
 	if len(gen.Content) == 0 {
 		return nil
 	}
-	return ioutil.WriteFile(gen.OutputPath, gen.Content, 0666)
+	if err := ioutil.WriteFile(gen.OutputPath, gen.Content, 0666); err != nil {
+		return err
+	}
+	if len(gen.ManifestContent) == 0 {
+		return nil
+	}
+	return ioutil.WriteFile(gen.ManifestPath, gen.ManifestContent, 0666)
+}
+
+// InjectorSource returns the source of the injector function named name in
+// src, including its doc comment, or nil if src does not declare it.
+// src is typically the content of a wire_gen.go file, so that the output
+// for a single injector can be compared across generations.
+func InjectorSource(src []byte, name string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Name.Name != name {
+			continue
+		}
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		file := fset.File(start)
+		out := src[file.Offset(start):file.Offset(fn.End())]
+		return append(append([]byte(nil), out...), '\n'), nil
+	}
+	return nil, nil
 }
 
 // GenerateOptions holds options for Generate.
@@ -66,6 +105,22 @@ type GenerateOptions struct {
 	Header           []byte
 	PrefixOutputFile string
 	Tags             string
+	// TraceSpans causes injectors whose provider set provides
+	// wire.TraceHooks to call its methods around each provider call.
+	TraceSpans bool
+	// EmitManifest causes a manifest file to be generated next to the
+	// output file, describing the construction plan of each injector in a
+	// package-level variable with an accessor function per injector.
+	EmitManifest bool
+	// Injectors restricts generation to the injector functions with these
+	// names. The other injectors are neither solved nor checked, and their
+	// implementations in the existing output file, if any, are kept
+	// verbatim. Packages declaring none of the injectors are not generated.
+	// It cannot be combined with EmitManifest.
+	Injectors []string
+	// Overlay maps absolute file paths to contents read instead of the
+	// files on disk, as by LoadPackagesWithOverlay.
+	Overlay map[string][]byte
 }
 
 // Generate performs dependency injection for the packages that match the given
@@ -84,10 +139,24 @@ func Generate(ctx context.Context, wd string, env []string, patterns []string, o
 	if opts == nil {
 		opts = &GenerateOptions{}
 	}
-	pkgs, errs := LoadPackages(ctx, wd, env, opts.Tags, patterns)
+	if len(opts.Injectors) > 0 && opts.EmitManifest {
+		return nil, []error{errors.New("generating selected injectors cannot be combined with emitting a manifest")}
+	}
+	pkgs, errs := LoadPackagesWithOverlay(ctx, wd, env, opts.Tags, patterns, opts.Overlay)
 	if len(errs) > 0 {
 		return nil, errs
 	}
+	var selected map[string]bool
+	if len(opts.Injectors) > 0 {
+		if err := checkInjectorNames(pkgs, opts.Injectors); err != nil {
+			return nil, []error{err}
+		}
+		selected = make(map[string]bool)
+		for _, name := range opts.Injectors {
+			selected[name] = true
+		}
+	}
+	defer logging.Phase("generate")()
 	generated := make([]GenerateResult, len(pkgs))
 	for i, pkg := range pkgs {
 		generated[i].PkgPath = pkg.PkgPath
@@ -98,6 +167,27 @@ func Generate(ctx context.Context, wd string, env []string, patterns []string, o
 		}
 		generated[i].OutputPath = filepath.Join(outDir, opts.PrefixOutputFile+"wire_gen.go")
 		g := newGen(pkg)
+		g.traceSpans = opts.TraceSpans
+		g.emitManifest = opts.EmitManifest
+		if selected != nil {
+			keep := make(map[string]bool)
+			found := false
+			for _, name := range injectorNames(pkg) {
+				if selected[name] {
+					found = true
+				} else {
+					keep[name] = true
+				}
+			}
+			if !found {
+				continue
+			}
+			g.selected = selected
+			if err := g.preserveInjectors(generated[i].OutputPath, keep); err != nil {
+				generated[i].Errs = append(generated[i].Errs, err)
+				continue
+			}
+		}
 		injectorFiles, errs := generateInjectors(g, pkg)
 		if len(errs) > 0 {
 			generated[i].Errs = errs
@@ -117,6 +207,19 @@ func Generate(ctx context.Context, wd string, env []string, patterns []string, o
 			goSrc = fmtSrc
 		}
 		generated[i].Content = goSrc
+		if manifest := g.manifestFrame(); len(manifest) > 0 {
+			if len(opts.Header) > 0 {
+				manifest = append(append([]byte(nil), opts.Header...), manifest...)
+			}
+			fmtManifest, err := format.Source(manifest)
+			if err != nil {
+				generated[i].Errs = append(generated[i].Errs, err)
+			} else {
+				manifest = fmtManifest
+			}
+			generated[i].ManifestPath = filepath.Join(outDir, opts.PrefixOutputFile+manifestFileName)
+			generated[i].ManifestContent = manifest
+		}
 	}
 	return generated, nil
 }
@@ -146,6 +249,14 @@ func generateInjectors(g *gen, pkg *packages.Package) (injectorFiles []*ast.File
 				continue
 			}
 			buildCall, err := findInjectorBuild(pkg.TypesInfo, fn)
+			if (err != nil || buildCall != nil) && g.selected != nil && !g.selected[fn.Name.Name] {
+				// Keep the implementation from the existing output, if any.
+				if src, ok := g.preserved[fn.Name.Name]; ok {
+					injectorFiles = g.injectorFileHeader(injectorFiles, f)
+					g.p("%s", src)
+				}
+				continue
+			}
 			if err != nil {
 				ec.add(err)
 				continue
@@ -153,21 +264,11 @@ func generateInjectors(g *gen, pkg *packages.Package) (injectorFiles []*ast.File
 			if buildCall == nil {
 				continue
 			}
-			if len(injectorFiles) == 0 || injectorFiles[len(injectorFiles)-1] != f {
-				// This is the first injector generated for this file.
-				// Write a file header.
-				name := filepath.Base(g.pkg.Fset.File(f.Pos()).Name())
-				g.p("// Injectors from %s:\n\n", name)
-				injectorFiles = append(injectorFiles, f)
-			}
+			injectorFiles = g.injectorFileHeader(injectorFiles, f)
 			sig := pkg.TypesInfo.ObjectOf(fn.Name).Type().(*types.Signature)
 			ins, _, err := injectorFuncSignature(sig)
 			if err != nil {
-				if w, ok := err.(*WireErr); ok {
-					ec.add(notePosition(w.position, fmt.Errorf("inject %s: %v", fn.Name.Name, w.error)))
-				} else {
-					ec.add(notePosition(g.pkg.Fset.Position(fn.Pos()), fmt.Errorf("inject %s: %v", fn.Name.Name, err)))
-				}
+				ec.add(noteInjector(fn.Name.Name, g.pkg.Fset.Position(fn.Pos()), err))
 				continue
 			}
 			injectorArgs := &InjectorArgs{
@@ -198,6 +299,18 @@ func generateInjectors(g *gen, pkg *packages.Package) (injectorFiles []*ast.File
 	return injectorFiles, nil
 }
 
+// injectorFileHeader writes a header before the first injector generated
+// for f and returns injectorFiles with f appended, or injectorFiles if the
+// header has already been written.
+func (g *gen) injectorFileHeader(injectorFiles []*ast.File, f *ast.File) []*ast.File {
+	if len(injectorFiles) > 0 && injectorFiles[len(injectorFiles)-1] == f {
+		return injectorFiles
+	}
+	name := filepath.Base(g.pkg.Fset.File(f.Pos()).Name())
+	g.p("// Injectors from %s:\n\n", name)
+	return append(injectorFiles, f)
+}
+
 // copyNonInjectorDecls copies any non-injector declarations from the
 // given files into the generated output.
 func copyNonInjectorDecls(g *gen, files []*ast.File, info *types.Info) {
@@ -207,9 +320,9 @@ func copyNonInjectorDecls(g *gen, files []*ast.File, info *types.Info) {
 		for _, decl := range f.Decls {
 			switch decl := decl.(type) {
 			case *ast.FuncDecl:
-				// OK to ignore error, as any error cases should already have
-				// been filtered out.
-				if buildCall, _ := findInjectorBuild(info, decl); buildCall != nil {
+				// Injectors with errors are only left at this point if they
+				// were not selected, and are not copied either.
+				if buildCall, err := findInjectorBuild(info, decl); buildCall != nil || err != nil {
 					continue
 				}
 			case *ast.GenDecl:
@@ -246,6 +359,22 @@ type gen struct {
 	imports     map[string]importInfo
 	anonImports map[string]bool
 	values      map[ast.Expr]string
+	// traceSpans is set by GenerateOptions.TraceSpans.
+	traceSpans bool
+	// emitManifest is set by GenerateOptions.EmitManifest, in which case
+	// manifest collects the construction plans of the injectors.
+	emitManifest bool
+	manifest     []manifestInjector
+	// pkgDirs maps the directories of the packages pkg depends on to
+	// their import paths. It is computed by sourcePos.
+	pkgDirs map[string]string
+	// selected is set from GenerateOptions.Injectors, in which case only
+	// the injectors in selected are generated, and preserved holds the
+	// source of the others kept from the existing output file. reserved
+	// holds the names declared by that source.
+	selected  map[string]bool
+	preserved map[string]string
+	reserved  map[string]bool
 }
 
 func newGen(pkg *packages.Package) *gen {
@@ -254,6 +383,8 @@ func newGen(pkg *packages.Package) *gen {
 		anonImports: make(map[string]bool),
 		imports:     make(map[string]importInfo),
 		values:      make(map[ast.Expr]string),
+		preserved:   make(map[string]string),
+		reserved:    make(map[string]bool),
 	}
 }
 
@@ -266,7 +397,7 @@ func (g *gen) frame(tags string) []byte {
 	if len(tags) > 0 {
 		tags = fmt.Sprintf(" gen -tags \"%s\"", tags)
 	}
-	buf.WriteString("// Code generated by Wire. DO NOT EDIT.\n\n")
+	buf.WriteString(generatedHeader + "\n\n")
 	buf.WriteString("//go:generate go run -mod=mod github.com/google/wire/cmd/wire" + tags + "\n")
 	buf.WriteString("//+build !wireinject\n\n")
 	buf.WriteString("package ")
@@ -318,12 +449,17 @@ func (g *gen) inject(pos token.Pos, name string, sig *types.Signature, set *Prov
 	calls, errs := solve(g.pkg.Fset, injectSig.out, params, set)
 	if len(errs) > 0 {
 		return mapErrors(errs, func(e error) error {
-			if w, ok := e.(*WireErr); ok {
-				return notePosition(w.position, fmt.Errorf("inject %s: %v", name, w.error))
-			}
-			return notePosition(g.pkg.Fset.Position(pos), fmt.Errorf("inject %s: %v", name, e))
+			return noteInjector(name, g.pkg.Fset.Position(pos), e)
 		})
 	}
+	if hooks := traceHooksType(set); g.traceSpans && hooks != nil {
+		// Obtain the hooks first so that they observe as many calls as
+		// possible, unless the hooks depend on the output.
+		traced, errs := solveWithRoots(g.pkg.Fset, injectSig.out, []types.Type{hooks}, params, set)
+		if len(errs) == 0 && len(traced) > 0 && types.Identical(traced[len(traced)-1].out, injectSig.out) {
+			calls = traced
+		}
+	}
 	type pendingVar struct {
 		name     string
 		expr     ast.Expr
@@ -369,6 +505,9 @@ func (g *gen) inject(pos token.Pos, name string, sig *types.Signature, set *Prov
 	if len(ec.errors) > 0 {
 		return ec.errors
 	}
+	if g.emitManifest {
+		g.addManifest(name, set, calls)
+	}
 
 	// Perform one pass to collect all imports, followed by the real pass.
 	injectPass(name, sig, calls, set, doc, &injectorGen{
@@ -562,6 +701,9 @@ func (g *gen) nameInFileScope(name string) bool {
 			return true
 		}
 	}
+	if g.reserved[name] {
+		return true
+	}
 	_, obj := g.pkg.Types.Scope().LookupParent(name, token.NoPos)
 	return obj != nil
 }
@@ -582,6 +724,17 @@ type injectorGen struct {
 	localNames   []string
 	cleanupNames []string
 	errVar       string
+	// resultNames holds the names of the results of the injector, or nil
+	// if they are unnamed. declared is the set of names already declared
+	// in the injector that assignments reuse.
+	resultNames []string
+	declared    map[string]bool
+	// hooks is the name of the variable holding the wire.TraceHooks
+	// wrapped around provider calls, or empty if there is none yet.
+	hooks string
+	// okVar is the name of the variable receiving the bool returned by
+	// conditional providers, or empty if there is none yet.
+	okVar string
 
 	// discard causes ig.p and ig.writeAST to no-op. Useful to run
 	// generation for side-effects like filling in g.imports.
@@ -623,8 +776,45 @@ func injectPass(name string, sig *types.Signature, calls []call, set *ProviderSe
 			ig.p("%s %s", ig.paramNames[i], types.TypeString(pi.Type(), ig.g.qualifyPkg))
 		}
 	}
+	// Named results are kept in the signature and reused for the output
+	// and the error, as in the declaration.
+	results := sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		if results.At(i).Name() != "" {
+			ig.resultNames = make([]string, results.Len())
+			break
+		}
+	}
+	for i := range ig.resultNames {
+		r := results.At(i).Name()
+		if r == "_" {
+			ig.resultNames[i] = r
+			continue
+		}
+		// The type of the last result, not its name, tells whether it is
+		// the error.
+		isErr := injectSig.err && i == results.Len()-1
+		if isErr {
+			ig.errVar = ""
+		}
+		r = disambiguate(r, ig.nameInInjector)
+		if isErr {
+			ig.errVar = r
+		}
+		ig.resultNames[i] = r
+		ig.declare(r)
+	}
 	outTypeString := types.TypeString(injectSig.out, ig.g.qualifyPkg)
 	switch {
+	case ig.resultNames != nil:
+		ig.p(") (")
+		for i, r := range ig.resultNames {
+			if i > 0 {
+				ig.p(", ")
+			}
+			ig.p("%s %s", r, types.TypeString(results.At(i).Type(), ig.g.qualifyPkg))
+		}
+		ig.p(") {\n")
 	case injectSig.cleanup && injectSig.err:
 		ig.p(") (%s, func(), error) {\n", outTypeString)
 	case injectSig.cleanup:
@@ -634,9 +824,26 @@ func injectPass(name string, sig *types.Signature, calls []call, set *ProviderSe
 	default:
 		ig.p(") %s {\n", outTypeString)
 	}
+	// hooks is the type of the value passed as wire.TraceHooks, which is
+	// the concrete type if it is bound to the interface.
+	var hooks types.Type
+	if t := traceHooksType(set); ig.g.traceSpans && t != nil {
+		hooks = set.For(t).Type()
+		for i := 0; i < params.Len(); i++ {
+			if types.Identical(params.At(i).Type(), hooks) {
+				ig.hooks = ig.paramNames[i]
+			}
+		}
+	}
 	for i := range calls {
 		c := &calls[i]
-		lname := typeVariableName(c.out, "v", unexport, ig.nameInInjector)
+		var lname string
+		if i == len(calls)-1 && ig.resultNames != nil && ig.resultNames[0] != "_" {
+			// The last call provides the output.
+			lname = ig.resultNames[0]
+		} else {
+			lname = typeVariableName(c.out, "v", unexport, ig.nameInInjector)
+		}
 		ig.localNames = append(ig.localNames, lname)
 		switch c.kind {
 		case structProvider:
@@ -650,6 +857,9 @@ func injectPass(name string, sig *types.Signature, calls []call, set *ProviderSe
 		default:
 			panic("unknown kind")
 		}
+		if hooks != nil && ig.hooks == "" && types.Identical(c.out, hooks) {
+			ig.hooks = lname
+		}
 	}
 	if len(calls) == 0 {
 		ig.p("\treturn %s", ig.paramNames[set.For(injectSig.out).Arg().Index])
@@ -670,17 +880,31 @@ func injectPass(name string, sig *types.Signature, calls []call, set *ProviderSe
 }
 
 func (ig *injectorGen) funcProviderCall(lname string, c *call, injectSig outputSignature) {
+	id := providerID(nil, c)
+	if ig.hooks != "" {
+		ig.p("\t%s.Before(%q)\n", ig.hooks, id)
+	}
 	ig.p("\t%s", lname)
+	lhs := []string{lname}
 	prevCleanup := len(ig.cleanupNames)
 	if c.hasCleanup {
 		cname := disambiguate("cleanup", ig.nameInInjector)
 		ig.cleanupNames = append(ig.cleanupNames, cname)
 		ig.p(", %s", cname)
+		lhs = append(lhs, cname)
 	}
 	if c.hasErr {
 		ig.p(", %s", ig.errVar)
+		lhs = append(lhs, ig.errVar)
 	}
-	ig.p(" := ")
+	if c.conditional {
+		if ig.okVar == "" {
+			ig.okVar = disambiguate("ok", ig.nameInInjector)
+		}
+		ig.p(", %s", ig.okVar)
+		lhs = append(lhs, ig.okVar)
+	}
+	ig.p(" %s ", ig.assign(lhs...))
 	ig.p("%s(", ig.g.qualifiedID(c.pkg.Name(), c.pkg.Path(), c.name))
 	for i, a := range c.args {
 		if i > 0 {
@@ -696,6 +920,22 @@ func (ig *injectorGen) funcProviderCall(lname string, c *call, injectSig outputS
 		ig.p("...")
 	}
 	ig.p(")\n")
+	if ig.hooks != "" {
+		errVar := "nil"
+		if c.hasErr {
+			errVar = ig.errVar
+		}
+		ig.p("\t%s.After(%q, %s)\n", ig.hooks, id, errVar)
+	}
+	if c.conditional {
+		// Use the zero value and no cleanup if the output was not found.
+		ig.p("\tif !%s {\n", ig.okVar)
+		ig.p("\t\t%s = %s\n", lname, zeroValue(c.out, ig.g.qualifyPkg))
+		if c.hasCleanup {
+			ig.p("\t\t%s = func() {}\n", ig.cleanupNames[len(ig.cleanupNames)-1])
+		}
+		ig.p("\t}\n")
+	}
 	if c.hasErr {
 		ig.p("\tif %s != nil {\n", ig.errVar)
 		for i := prevCleanup - 1; i >= 0; i-- {
@@ -706,14 +946,14 @@ func (ig *injectorGen) funcProviderCall(lname string, c *call, injectSig outputS
 			ig.p(", nil")
 		}
 		// TODO(light): Give information about failing provider.
-		ig.p(", err\n")
+		ig.p(", %s\n", ig.errVar)
 		ig.p("\t}\n")
 	}
 }
 
 func (ig *injectorGen) structProviderCall(lname string, c *call) {
 	ig.p("\t%s", lname)
-	ig.p(" := ")
+	ig.p(" %s ", ig.assign(lname))
 	if _, ok := c.out.(*types.Pointer); ok {
 		ig.p("&")
 	}
@@ -731,12 +971,12 @@ func (ig *injectorGen) structProviderCall(lname string, c *call) {
 }
 
 func (ig *injectorGen) valueExpr(lname string, c *call) {
-	ig.p("\t%s := %s\n", lname, ig.g.values[c.valueExpr])
+	ig.p("\t%s %s %s\n", lname, ig.assign(lname), ig.g.values[c.valueExpr])
 }
 
 func (ig *injectorGen) fieldExpr(lname string, c *call) {
 	a := c.args[0]
-	ig.p("\t%s := ", lname)
+	ig.p("\t%s %s ", lname, ig.assign(lname))
 	if c.ptrToField {
 		ig.p("&")
 	}
@@ -750,7 +990,7 @@ func (ig *injectorGen) fieldExpr(lname string, c *call) {
 // nameInInjector reports whether name collides with any other identifier
 // in the current injector.
 func (ig *injectorGen) nameInInjector(name string) bool {
-	if name == ig.errVar {
+	if name == ig.errVar || name == ig.okVar {
 		return true
 	}
 	for _, a := range ig.paramNames {
@@ -768,9 +1008,36 @@ func (ig *injectorGen) nameInInjector(name string) bool {
 			return true
 		}
 	}
+	for _, r := range ig.resultNames {
+		if r == name {
+			return true
+		}
+	}
 	return ig.g.nameInFileScope(name)
 }
 
+// declare records name as declared in the injector.
+func (ig *injectorGen) declare(name string) {
+	if ig.declared == nil {
+		ig.declared = make(map[string]bool)
+	}
+	ig.declared[name] = true
+}
+
+// assign returns the operator of an assignment to names: "=" if all of
+// them are already declared, such as named results, and ":=" otherwise.
+// It records names as declared.
+func (ig *injectorGen) assign(names ...string) string {
+	op := "="
+	for _, name := range names {
+		if !ig.declared[name] {
+			op = ":="
+		}
+		ig.declare(name)
+	}
+	return op
+}
+
 func (ig *injectorGen) p(format string, args ...interface{}) {
 	if ig.discard {
 		return
@@ -957,4 +1224,5 @@ func accessibleFrom(info *types.Info, node ast.Node, wantPkg string) error {
 var (
 	errorType   = types.Universe.Lookup("error").Type()
 	cleanupType = types.NewSignature(nil, nil, nil, false)
+	boolType    = types.Typ[types.Bool]
 )
@@ -17,20 +17,28 @@ package wire
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"go/build"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/awalterschulze/gographviz"
 	"github.com/google/go-cmp/cmp"
+	"github.com/taichimaeda/wireplus/internal/logging"
 )
 
 var record = flag.Bool("record", false, "whether to run tests against cloud resources and record the interactions")
@@ -75,20 +83,9 @@ func TestWire(t *testing.T) {
 			t.Parallel()
 
 			// Materialize a temporary GOPATH directory.
-			gopath, err := ioutil.TempDir("", "wire_test")
-			if err != nil {
-				t.Fatal(err)
-			}
+			gopath, wd, env := test.setupGopath(t)
 			defer os.RemoveAll(gopath)
-			gopath, err = filepath.EvalSymlinks(gopath)
-			if err != nil {
-				t.Fatal(err)
-			}
-			if err := test.materialize(gopath); err != nil {
-				t.Fatal(err)
-			}
-			wd := filepath.Join(gopath, "src", "example.com")
-			gens, errs := Generate(ctx, wd, append(os.Environ(), "GOPATH="+gopath), []string{test.pkg}, &GenerateOptions{Header: test.header})
+			gens, errs := Generate(ctx, wd, env, []string{test.pkg}, &GenerateOptions{Header: test.header, TraceSpans: test.traceSpans, EmitManifest: test.emitManifest})
 			var gen GenerateResult
 			if len(gens) > 1 {
 				t.Fatalf("got %d generated files, want 0 or 1", len(gens))
@@ -150,6 +147,12 @@ func TestWire(t *testing.T) {
 				if err := ioutil.WriteFile(testdataWireGenPath, gen.Content, 0666); err != nil {
 					t.Fatalf("failed to record wire_gen.go to testdata: %v", err)
 				}
+				if test.emitManifest {
+					testdataManifestPath := filepath.Join(testRoot, test.name, "want", manifestFileName)
+					if err := ioutil.WriteFile(testdataManifestPath, gen.ManifestContent, 0666); err != nil {
+						t.Fatalf("failed to record %s to testdata: %v", manifestFileName, err)
+					}
+				}
 			} else {
 				// Replay ==> Load golden file and compare to
 				// generated result. This check is meant to
@@ -160,6 +163,11 @@ func TestWire(t *testing.T) {
 					diff := cmp.Diff(strings.Split(gotS, "\n"), strings.Split(wantS, "\n"))
 					t.Fatalf("wire output differs from golden file. If this change is expected, run with -record to update the wire_gen.go file.\n*** got:\n%s\n\n*** want:\n%s\n\n*** diff:\n%s", gotS, wantS, diff)
 				}
+				if !bytes.Equal(gen.ManifestContent, test.wantManifestOutput) {
+					gotS, wantS := string(gen.ManifestContent), string(test.wantManifestOutput)
+					diff := cmp.Diff(strings.Split(gotS, "\n"), strings.Split(wantS, "\n"))
+					t.Fatalf("manifest differs from golden file. If this change is expected, run with -record to update the %s file.\n*** got:\n%s\n\n*** want:\n%s\n\n*** diff:\n%s", manifestFileName, gotS, wantS, diff)
+				}
 			}
 		})
 	}
@@ -194,366 +202,5567 @@ func goBuildCheck(goToolPath, gopath string, test *testCase) error {
 	return nil
 }
 
-func TestUnexport(t *testing.T) {
-	tests := []struct {
-		name string
-		want string
-	}{
-		{"", ""},
-		{"a", "a"},
-		{"ab", "ab"},
-		{"A", "a"},
-		{"AB", "ab"},
-		{"A_", "a_"},
-		{"ABc", "aBc"},
-		{"ABC", "abc"},
-		{"AB_", "ab_"},
-		{"foo", "foo"},
-		{"Foo", "foo"},
-		{"HTTPClient", "httpClient"},
-		{"IFace", "iFace"},
-		{"SNAKE_CASE", "snake_CASE"},
-		{"HTTP", "http"},
+func TestExportModules(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
 	}
-	for _, test := range tests {
-		if got := unexport(test.name); got != test.want {
-			t.Errorf("unexport(%q) = %q; want %q", test.name, got, test.want)
-		}
+	gopath, err := ioutil.TempDir("", "wire_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(gopath)
+	gopath, err = filepath.EvalSymlinks(gopath)
+	if err != nil {
+		t.Fatal(err)
 	}
+	src := filepath.Join(gopath, "src")
+	wireLoc := filepath.Join(src, "github.com", "google", "wire")
+	depLoc := filepath.Join(src, "example.org", "dep")
+	files := map[string]string{
+		"github.com/google/wire/wire.go": string(wireGo),
+		"github.com/google/wire/go.mod":  "module github.com/google/wire\n",
+		"example.org/dep/go.mod":         "module example.org/dep\n",
+		"example.org/dep/dep.go": `package dep
+
+type Client struct{}
+
+func NewClient() *Client { return new(Client) }
+
+type Greeter struct{}
+
+func (*Greeter) Greet() string { return "hello" }
+`,
+		"example.com/go.mod": fmt.Sprintf(`module example.com
+
+require (
+	example.org/dep v1.2.0
+	github.com/google/wire v0.1.0
+)
+
+replace example.org/dep => %s
+
+replace github.com/google/wire => %s
+`, depLoc, wireLoc),
+		"example.com/foo/foo.go": `package main
+
+import (
+	"io"
+
+	"example.org/dep"
+)
+
+type Greeter interface{ Greet() string }
+
+type App struct{}
+
+func NewApp(c *dep.Client, g Greeter, r io.Reader, w io.Writer) *App { return new(App) }
+
+func main() {}
+`,
+		"example.com/foo/wire.go": `//+build wireinject
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"example.org/dep"
+	"github.com/google/wire"
+)
+
+func initApp() *App {
+	wire.Build(
+		NewApp,
+		dep.NewClient,
+		wire.Struct(new(dep.Greeter)),
+		wire.Bind(new(Greeter), new(*dep.Greeter)),
+		bytes.NewBuffer,
+		wire.Bind(new(io.Reader), new(*bytes.Buffer)),
+		wire.Value([]byte("hello")),
+		wire.InterfaceValue(new(io.Writer), os.Stdout),
+	)
+	return nil
 }
 
-func TestExport(t *testing.T) {
-	tests := []struct {
-		name string
-		want string
-	}{
-		{"", ""},
-		{"a", "A"},
-		{"ab", "Ab"},
-		{"A", "A"},
-		{"AB", "AB"},
-		{"A_", "A_"},
-		{"ABc", "ABc"},
-		{"ABC", "ABC"},
-		{"AB_", "AB_"},
-		{"foo", "Foo"},
-		{"Foo", "Foo"},
-		{"HTTPClient", "HTTPClient"},
-		{"httpClient", "HttpClient"},
-		{"IFace", "IFace"},
-		{"iFace", "IFace"},
-		{"SNAKE_CASE", "SNAKE_CASE"},
-		{"HTTP", "HTTP"},
+func initClient() *dep.Client {
+	wire.Build(dep.NewClient)
+	return nil
+}
+`,
 	}
-	for _, test := range tests {
-		if got := export(test.name); got != test.want {
-			t.Errorf("export(%q) = %q; want %q", test.name, got, test.want)
+	for name, content := range files {
+		dst := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(dst, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd := filepath.Join(src, "example.com")
+	env := append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=on")
+	report, errs := ExportModules(context.Background(), wd, env, []string{"example.com/foo"}, "")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, im := range append(report.Injectors, report.Rollup) {
+		for _, u := range im.External {
+			if u.Replace != depLoc {
+				t.Errorf("%s: got replace %q for %s, want %q", im.Injector, u.Replace, u.Path, depLoc)
+			}
+			u.Replace = ""
 		}
 	}
+	want := &ModulesReport{
+		Injectors: []*InjectorModules{
+			{
+				Injector: `"example.com/foo".initApp`,
+				Main:     &ModuleUsage{Providers: 1, Values: 2},
+				Std:      &ModuleUsage{Providers: 1, Bindings: 1},
+				External: []*ModuleUsage{
+					{Path: "example.org/dep", Version: "v1.2.0", Providers: 2, Bindings: 1},
+				},
+			},
+			{
+				Injector: `"example.com/foo".initClient`,
+				Main:     &ModuleUsage{},
+				Std:      &ModuleUsage{},
+				External: []*ModuleUsage{
+					{Path: "example.org/dep", Version: "v1.2.0", Providers: 1},
+				},
+			},
+		},
+		Rollup: &InjectorModules{
+			Injector: "<rollup>",
+			Main:     &ModuleUsage{Injectors: 1, Providers: 1, Values: 2},
+			Std:      &ModuleUsage{Injectors: 1, Providers: 1, Bindings: 1},
+			External: []*ModuleUsage{
+				{Path: "example.org/dep", Version: "v1.2.0", Injectors: 2, Providers: 3, Bindings: 1},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, report); diff != "" {
+		t.Errorf("ExportModules(...) diff (-want +got):\n%s", diff)
+	}
 }
 
-func TestTypeVariableName(t *testing.T) {
-	var (
-		boolT           = types.Typ[types.Bool]
-		stringT         = types.Typ[types.String]
-		fooVarT         = types.NewNamed(types.NewTypeName(0, nil, "foo", stringT), stringT, nil)
-		nonameVarT      = types.NewNamed(types.NewTypeName(0, nil, "", stringT), stringT, nil)
-		barVarInFooPkgT = types.NewNamed(types.NewTypeName(0, types.NewPackage("my.example/foo", "foo"), "bar", stringT), stringT, nil)
-	)
+func TestSandboxEnv(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "wire_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	ctx := context.Background()
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		readOnly := filepath.Join(tmp, "readonly")
+		if err := os.Mkdir(readOnly, 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(readOnly, 0555); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Chmod(readOnly, 0777)
+		if checkWritable(readOnly) == nil {
+			t.Skip("cannot make a read-only directory (running as root?)")
+		}
+		env := append(os.Environ(), "GOCACHE="+readOnly)
+		_, err := SandboxEnv(ctx, env, "", "")
+		if err == nil {
+			t.Fatal("SandboxEnv with read-only GOCACHE succeeded; want error")
+		}
+		if !strings.Contains(err.Error(), "GOCACHE") || !strings.Contains(err.Error(), TmpDirEnv) {
+			t.Errorf("SandboxEnv error = %q; want mention of GOCACHE and %s", err, TmpDirEnv)
+		}
+		// Redirecting the cache recovers from the read-only sandbox.
+		if _, err := SandboxEnv(ctx, append(env, TmpDirEnv+"="+tmp), "", ""); err != nil {
+			t.Errorf("SandboxEnv with %s: %v", TmpDirEnv, err)
+		}
+	})
+
+	base := append(os.Environ(), "GOCACHE="+filepath.Join(tmp, "default"))
 	tests := []struct {
-		description     string
-		typ             types.Type
-		defaultName     string
-		transformAppend string
-		collides        map[string]bool
-		want            string
+		name        string
+		env         []string
+		gocache     string
+		gopath      string
+		wantGoCache string
+		wantGoPath  string
 	}{
-		{"basic type", boolT, "", "", map[string]bool{}, "bool"},
-		{"basic type with transform", boolT, "", "suffix", map[string]bool{}, "boolsuffix"},
-		{"basic type with collision", boolT, "", "", map[string]bool{"bool": true}, "bool2"},
-		{"basic type with transform and collision", boolT, "", "suffix", map[string]bool{"boolsuffix": true}, "boolsuffix2"},
-		{"a different basic type", stringT, "", "", map[string]bool{}, "string"},
-		{"named type", fooVarT, "", "", map[string]bool{}, "foo"},
-		{"named type with transform", fooVarT, "", "suffix", map[string]bool{}, "foosuffix"},
-		{"named type with collision", fooVarT, "", "", map[string]bool{"foo": true}, "foo2"},
-		{"named type with transform and collision", fooVarT, "", "suffix", map[string]bool{"foosuffix": true}, "foosuffix2"},
-		{"noname type", nonameVarT, "bar", "", map[string]bool{}, "bar"},
-		{"noname type with transform", nonameVarT, "bar", "s", map[string]bool{}, "bars"},
-		{"noname type with transform and collision", nonameVarT, "bar", "s", map[string]bool{"bars": true}, "bars2"},
-		{"var in pkg type", barVarInFooPkgT, "", "", map[string]bool{}, "bar"},
-		{"var in pkg type with collision", barVarInFooPkgT, "", "", map[string]bool{"bar": true}, "fooBar"},
-		{"var in pkg type with double collision", barVarInFooPkgT, "", "", map[string]bool{"bar": true, "fooBar": true}, "bar2"},
+		{
+			name:        "Flags",
+			env:         base,
+			gocache:     filepath.Join(tmp, "cache"),
+			gopath:      filepath.Join(tmp, "gopath"),
+			wantGoCache: filepath.Join(tmp, "cache"),
+			wantGoPath:  filepath.Join(tmp, "gopath"),
+		},
+		{
+			name:        "TmpDir",
+			env:         append(base, TmpDirEnv+"="+tmp),
+			wantGoCache: filepath.Join(tmp, "gocache"),
+			wantGoPath:  lookupEnv(base, "GOPATH"),
+		},
+		{
+			name:        "FlagOverridesTmpDir",
+			env:         append(base, TmpDirEnv+"="+tmp),
+			gocache:     filepath.Join(tmp, "cache"),
+			wantGoCache: filepath.Join(tmp, "cache"),
+			wantGoPath:  lookupEnv(base, "GOPATH"),
+		},
 	}
 	for _, test := range tests {
-		t.Run(fmt.Sprintf("%s: typeVariableName(%v, %q, %q, %v)", test.description, test.typ, test.defaultName, test.transformAppend, test.collides), func(t *testing.T) {
-			got := typeVariableName(test.typ, test.defaultName, func(name string) string { return name + test.transformAppend }, func(name string) bool { return test.collides[name] })
-			if !isIdent(got) {
-				t.Errorf("%q is not an identifier", got)
+		t.Run(test.name, func(t *testing.T) {
+			env, err := SandboxEnv(ctx, test.env, test.gocache, test.gopath)
+			if err != nil {
+				t.Fatal(err)
 			}
-			if got != test.want {
-				t.Errorf("got %q want %q", got, test.want)
+			if got := lookupEnv(env, "GOCACHE"); got != test.wantGoCache {
+				t.Errorf("GOCACHE = %q; want %q", got, test.wantGoCache)
 			}
-			if test.collides[got] {
-				t.Errorf("%q collides", got)
+			if got := lookupEnv(env, "GOPATH"); got != test.wantGoPath {
+				t.Errorf("GOPATH = %q; want %q", got, test.wantGoPath)
 			}
 		})
 	}
 }
 
-func TestDisambiguate(t *testing.T) {
+func TestCheckBudgets(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The graph of injectD has 4 providers, a depth of 4 (provideA ->
+	// provideB -> provideC -> provideD), a fan-in of 2 (A is consumed by
+	// provideB and provideC) and a fan-out of 2 (provideC consumes A and B).
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+type (
+	A int
+	B int
+	C int
+	D int
+)
+
+func provideA() A         { return 1 }
+func provideB(a A) B      { return B(a) }
+func provideC(a A, b B) C { return C(a) + C(b) }
+func provideD(c C) D      { return D(c) }
+
+func main() {}
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectD() D {
+	wire.Build(provideA, provideB, provideC, provideD)
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+
 	tests := []struct {
-		name     string
-		want     string
-		collides map[string]bool
+		name    string
+		budgets Budgets
+		want    []string
 	}{
-		{"foo", "foo", nil},
-		{"foo", "foo2", map[string]bool{"foo": true}},
-		{"foo", "foo3", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
-		{"foo1", "foo1_2", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
-		{"foo\u0661", "foo\u0661", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
-		{"foo\u0661", "foo\u06612", map[string]bool{"foo": true, "foo1": true, "foo2": true, "foo\u0661": true}},
-		{"select", "select2", nil},
-		{"var", "var2", nil},
+		{name: "Unlimited"},
+		{name: "DepthAtLimit", budgets: Budgets{MaxDepth: 4}},
+		{
+			name:    "DepthOverLimit",
+			budgets: Budgets{MaxDepth: 3},
+			want:    []string{"example.com/foo/wire.go:x:y: inject injectD: dependency depth 4 exceeds budget 3: main.provideA -> main.provideB -> main.provideC -> main.provideD"},
+		},
+		{name: "FanInAtLimit", budgets: Budgets{MaxFanIn: 2}},
+		{
+			name:    "FanInOverLimit",
+			budgets: Budgets{MaxFanIn: 1},
+			want:    []string{"example.com/foo/wire.go:x:y: inject injectD: example.com/foo.A is consumed by 2 providers, budget is 1: main.provideB, main.provideC"},
+		},
+		{name: "FanOutAtLimit", budgets: Budgets{MaxFanOut: 2}},
+		{
+			name:    "FanOutOverLimit",
+			budgets: Budgets{MaxFanOut: 1},
+			want:    []string{"example.com/foo/wire.go:x:y: inject injectD: main.provideC consumes 2 inputs, budget is 1: example.com/foo.A, example.com/foo.B"},
+		},
+		{name: "ProvidersAtLimit", budgets: Budgets{MaxProvidersPerInjector: 4}},
+		{
+			name:    "ProvidersOverLimit",
+			budgets: Budgets{MaxProvidersPerInjector: 3},
+			want:    []string{"example.com/foo/wire.go:x:y: inject injectD: uses 4 providers, budget is 3"},
+		},
 	}
+	ctx := context.Background()
 	for _, test := range tests {
-		t.Run(fmt.Sprintf("disambiguate(%q, %v)", test.name, test.collides), func(t *testing.T) {
-			got := disambiguate(test.name, func(name string) bool { return test.collides[name] })
-			if !isIdent(got) {
-				t.Errorf("%q is not an identifier", got)
+		t.Run(test.name, func(t *testing.T) {
+			violations, errs := CheckBudgets(ctx, wd, env, "", []string{"example.com/foo"}, test.budgets)
+			if len(errs) > 0 {
+				t.Fatal(errs)
 			}
-			if got != test.want {
-				t.Errorf("got %q want %q", got, test.want)
+			var got []string
+			for _, v := range violations {
+				got = append(got, scrubError(gopath, v.Error()))
 			}
-			if test.collides[got] {
-				t.Errorf("%q collides", got)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("CheckBudgets(...) diff (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
-func isIdent(s string) bool {
-	if len(s) == 0 {
-		return false
+func TestPointerValueOverlap(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
 	}
-	r, i := utf8.DecodeRuneInString(s)
-	if !unicode.IsLetter(r) && r != '_' {
-		return false
+	// injectServer gets Config from wire.Value and *Config from
+	// NewConfig. injectNamed provides ConfigPtr, whose underlying type is
+	// *Config but which is a distinct type. injectIgnored suppresses the
+	// warning.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+type (
+	Config    struct{ Name string }
+	ConfigPtr *Config
+	Server    struct{}
+	Client    struct{}
+)
+
+func NewConfig() *Config                       { return &Config{} }
+func NewConfigPtr() ConfigPtr                  { return &Config{} }
+func NewServer(c Config, p *Config) *Server    { return &Server{} }
+func NewClient(c Config, p ConfigPtr) *Client  { return &Client{} }
+
+func main() {}
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectServer() *Server {
+	wire.Build(wire.Value(Config{}), NewConfig, NewServer)
+	return nil
+}
+
+func injectNamed() *Client {
+	wire.Build(wire.Value(Config{}), NewConfigPtr, NewClient)
+	return nil
+}
+
+// injectIgnored builds a server.
+//wire:ignore pointer-value-overlap
+func injectIgnored() *Server {
+	wire.Build(wire.Value(Config{}), NewConfig, NewServer)
+	return nil
+}
+`),
+		},
 	}
-	for i < len(s) {
-		r, sz := utf8.DecodeRuneInString(s[i:])
-		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
-			return false
-		}
-		i += sz
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	info, errs := Load(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var got []string
+	for _, w := range info.Warnings {
+		got = append(got, scrubError(gopath, w.Error()))
+	}
+	want := []string{`example.com/foo/wire.go:x:y: inject injectServer: pointer-value-overlap: example.com/foo.Config and *example.com/foo.Config are both provided
+example.com/foo.Config:
+<- wire.Value (example.com/foo/wire.go:x:y)
+consumed by:
+-> provider "NewServer" (example.com/foo/foo.go:x:y)
+*example.com/foo.Config:
+<- provider "NewConfig" (example.com/foo/foo.go:x:y)
+consumed by:
+-> provider "NewServer" (example.com/foo/foo.go:x:y)`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Load(...).Warnings diff (-want +got):\n%s", diff)
 	}
-	return true
 }
 
-// scrubError rewrites the given string to remove occurrences of GOPATH/src,
-// rewrites OS-specific path separators to slashes, and any line/column
-// information to a fixed ":x:y". For example, if the gopath parameter is
-// "C:\GOPATH" and running on Windows, the string
-// "C:\GOPATH\src\foo\bar.go:15:4" would be rewritten to "foo/bar.go:x:y".
-func scrubError(gopath string, s string) string {
-	sb := new(strings.Builder)
-	query := gopath + string(os.PathSeparator) + "src" + string(os.PathSeparator)
-	for {
-		// Find next occurrence of source root. This indicates the next path to
-		// scrub.
-		start := strings.Index(s, query)
-		if start == -1 {
-			sb.WriteString(s)
-			break
-		}
+func TestGraphCost(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Summing weights, provideD -> provideC -> provideB -> provideA is more
+	// expensive than provideD -> provideC -> provideA. provideD has an
+	// unknown cost, which weighs nothing.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
 
-		// Find end of file name (extension ".go").
-		fileStart := start + len(query)
-		fileEnd := strings.Index(s[fileStart:], ".go")
-		if fileEnd == -1 {
-			// If no ".go" occurs to end of string, further searches will fail too.
-			// Break the loop.
-			sb.WriteString(s)
+type (
+	A int
+	B int
+	C int
+	D int
+)
+
+// provideA dials the database.
+//wire:cost heavy
+func provideA() A { return 1 }
+
+//wire:cost light
+func provideB(a A) B { return B(a) }
+
+//wire:cost medium
+func provideC(a A, b B) C { return C(a) + C(b) }
+
+//wire:cost slow
+func provideD(c C) D { return D(c) }
+
+func main() {}
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectD() D {
+	wire.Build(provideA, provideB, provideC, provideD)
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	t.Run("Warnings", func(t *testing.T) {
+		info, errs := Load(ctx, wd, env, "", []string{"example.com/foo"})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var got []string
+		for _, w := range info.Warnings {
+			got = append(got, scrubError(gopath, w.Error()))
+		}
+		want := []string{`example.com/foo/foo.go:x:y: provider provideD has unknown cost "slow"; want light, medium or heavy`}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Load(...).Warnings diff (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("CriticalPath", func(t *testing.T) {
+		data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "injectD", "", "cytospace", true, nil, nil, ClusterBySet, EdgeLabelsNone)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var elems CytospaceElements
+		if err := json.Unmarshal([]byte(data), &elems); err != nil {
+			t.Fatal(err)
+		}
+		type node struct {
+			Cost     string
+			Critical bool
+		}
+		gotNodes := make(map[string]node)
+		for _, n := range elems.Nodes {
+			gotNodes[n.Data.Id] = node{n.Data.Cost, n.Data.Critical}
+		}
+		wantNodes := map[string]node{
+			"provideA#example.com/foo": {CostHeavy, true},
+			"provideB#example.com/foo": {CostLight, true},
+			"provideC#example.com/foo": {CostMedium, true},
+			"provideD#example.com/foo": {"slow", true},
+		}
+		if diff := cmp.Diff(wantNodes, gotNodes); diff != "" {
+			t.Errorf("nodes diff (-want +got):\n%s", diff)
+		}
+		var gotEdges []string
+		for _, e := range elems.Edges {
+			if e.Data.Critical {
+				gotEdges = append(gotEdges, e.Data.Id)
+			}
+		}
+		sort.Strings(gotEdges)
+		wantEdges := []string{
+			"provideB#example.com/foo->provideA#example.com/foo",
+			"provideC#example.com/foo->provideB#example.com/foo",
+			"provideD#example.com/foo->provideC#example.com/foo",
+		}
+		if diff := cmp.Diff(wantEdges, gotEdges); diff != "" {
+			t.Errorf("critical edges diff (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Timings", func(t *testing.T) {
+		timings, err := ParseTimings([]byte(`{
+			"example.com/foo.provideA": "1ms",
+			"example.com/foo.provideB": "500us",
+			"example.com/foo.provideC": "10ms",
+			"example.com/foo.provideD": 2000000,
+			"example.com/foo.provideE": "1s"
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, report, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "injectD", "", "cytospace", true, timings, nil, ClusterBySet, EdgeLabelsNone)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var elems CytospaceElements
+		if err := json.Unmarshal([]byte(data), &elems); err != nil {
+			t.Fatal(err)
+		}
+		type node struct {
+			Duration string
+			Classes  string
+			Critical bool
+		}
+		gotNodes := make(map[string]node)
+		for _, n := range elems.Nodes {
+			gotNodes[n.Data.Id] = node{n.Data.Duration, n.Classes, n.Data.Critical}
+		}
+		// Weighted by the measured durations, provideB is on the critical
+		// path despite being light.
+		wantNodes := map[string]node{
+			"provideA#example.com/foo": {"1ms", "heat-1", true},
+			"provideB#example.com/foo": {"500µs", "heat-1", true},
+			"provideC#example.com/foo": {"10ms", "heat-5", true},
+			"provideD#example.com/foo": {"2ms", "heat-1", true},
+		}
+		if diff := cmp.Diff(wantNodes, gotNodes); diff != "" {
+			t.Errorf("nodes diff (-want +got):\n%s", diff)
+		}
+		wantReport := &TimingsReport{
+			Unmatched: []string{"example.com/foo.provideE"},
+			Slowest: []ProviderTiming{
+				{"example.com/foo.provideC", 10 * time.Millisecond},
+				{"example.com/foo.provideD", 2 * time.Millisecond},
+				{"example.com/foo.provideA", time.Millisecond},
+				{"example.com/foo.provideB", 500 * time.Microsecond},
+			},
+			CriticalPath: []ProviderTiming{
+				{"example.com/foo.provideD", 2 * time.Millisecond},
+				{"example.com/foo.provideC", 10 * time.Millisecond},
+				{"example.com/foo.provideB", 500 * time.Microsecond},
+				{"example.com/foo.provideA", time.Millisecond},
+			},
+		}
+		if diff := cmp.Diff(wantReport, report); diff != "" {
+			t.Errorf("report diff (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestResultNameWarnings(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"NamedResults", nil},
+		{"PartiallyNamedResults", nil},
+		{"NamedResultCollision", []string{
+			"example.com/foo/wire.go:x:y: inject injectFoo: result provideFoo collides with func provideFoo; the generated injector renames it",
+		}},
+	}
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tc, err := loadTestCase(filepath.Join("testdata", test.name), wireGo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gopath, wd, env := tc.setupGopath(t)
+			defer os.RemoveAll(gopath)
+			info, errs := Load(ctx, wd, env, "", []string{tc.pkg})
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var got []string
+			for _, w := range info.Warnings {
+				got = append(got, scrubError(gopath, w.Error()))
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Load(...).Warnings diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLint(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		rule string
+		want []string
+	}{
+		{"LintUnusedProvider", RuleUnusedProvider, []string{
+			`example.com/foo/foo.go:x:y: unused-provider: provider example.com/foo.provideBaz in "example.com/foo".Set is not used by any injector`,
+		}},
+		{"LintDuplicateBinding", RuleDuplicateBinding, []string{
+			`example.com/foo/foo.go:x:y: duplicate-binding: AllFooSet has multiple bindings for example.com/foo.Foo
+current:
+<- provider "provideOtherFoo" (example.com/foo/foo.go:x:y)
+<- provider set "OtherFooSet" (example.com/foo/foo.go:x:y)
+previous:
+<- provider "provideFoo" (example.com/foo/foo.go:x:y)
+<- provider set "FooSet" (example.com/foo/foo.go:x:y)`,
+			`example.com/foo/foo.go:x:y: duplicate-binding: BarSet has multiple bindings for example.com/foo.Bar
+current:
+<- provider "provideOtherBar" (example.com/foo/foo.go:x:y)
+previous:
+<- provider "provideBar" (example.com/foo/foo.go:x:y)`,
+		}},
+		{"LintUnusedBinding", RuleUnusedBinding, []string{
+			`example.com/foo/foo.go:x:y: unused-binding: wire.Bind of example.com/foo.Closer to *example.com/foo.Impl in "example.com/foo".Set is not used by any injector`,
+		}},
+		{"LintUnusedImport", RuleUnusedImport, []string{
+			`example.com/foo/foo.go:x:y: unused-import: "example.com/foo".FooOnlySet imports "example.com/foo".BarSet, which provides nothing used by any injector`,
+		}},
+	}
+	ctx := context.Background()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tc, err := loadTestCase(filepath.Join("testdata", test.name), wireGo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gopath, wd, env := tc.setupGopath(t)
+			defer os.RemoveAll(gopath)
+
+			// The fixture of each rule only violates that rule.
+			all := make(map[string]bool)
+			for _, rule := range LintRules {
+				all[rule] = true
+			}
+			findings, errs := Lint(ctx, wd, env, "", []string{tc.pkg}, all)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var got []string
+			for _, f := range findings {
+				got = append(got, scrubError(gopath, f.Error()))
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Lint(...) diff (-want +got):\n%s", diff)
+			}
+
+			// Disabling the rule silences it, and a duplicate binding is
+			// reported as an error instead.
+			findings, errs = Lint(ctx, wd, env, "", []string{tc.pkg}, map[string]bool{})
+			if len(findings) > 0 {
+				t.Errorf("Lint(...) with no rules enabled = %v; want no findings", findings)
+			}
+			if wantErrs := test.rule == RuleDuplicateBinding; (len(errs) > 0) != wantErrs {
+				t.Errorf("Lint(...) with no rules enabled returned errors %v; want errors: %t", errs, wantErrs)
+			}
+		})
+	}
+}
+
+func TestRequires(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import (
+	"context"
+
+	"github.com/google/wire"
+)
+
+type Config struct{}
+
+type Server struct{}
+
+func NewServer(ctx context.Context, cfg *Config) *Server { return new(Server) }
+
+var ServerSet = wire.NewSet(wire.Requires(new(*Config), new(context.Context)), NewServer)
+
+var InferredSet = wire.NewSet(NewServer)
+`),
+			"example.com/bad/bad.go": []byte(`package bad
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type Logger struct{}
+
+type Server struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(cfg *Config, l *Logger) *Server { return new(Server) }
+
+var UndeclaredSet = wire.NewSet(wire.Requires(new(*Config)), NewServer)
+
+var ProvidedSet = wire.NewSet(wire.Requires(new(*Config), new(*Logger)), NewServer, NewLogger)
+
+var UnusedSet = wire.NewSet(wire.Requires(new(*Config), new(*Logger), new(string)), NewServer)
+
+var DuplicateSet = wire.NewSet(wire.Requires(new(*Config), new(*Config)), NewServer, NewLogger)
+
+var NotPointerSet = wire.NewSet(wire.Requires(Config{}), NewServer, NewLogger)
+
+func injectServer(cfg *Config) *Server {
+	wire.Build(wire.Requires(new(*Config)), NewServer, NewLogger)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	t.Run("Errors", func(t *testing.T) {
+		_, errs := Load(ctx, wd, env, "", []string{"example.com/bad"})
+		var got []string
+		for _, err := range errs {
+			got = append(got, scrubError(gopath, err.Error()))
+		}
+		sort.Strings(got)
+		want := []string{
+			"example.com/bad/bad.go:x:y: *example.com/bad.Config is required more than once",
+			"example.com/bad/bad.go:x:y: ProvidedSet requires *example.com/bad.Logger, but also provides it",
+			"example.com/bad/bad.go:x:y: UndeclaredSet needs *example.com/bad.Logger, which is not declared by wire.Requires",
+			"example.com/bad/bad.go:x:y: UnusedSet requires string, but does not need it",
+			"example.com/bad/bad.go:x:y: argument to Requires must be a pointer to the required type; found example.com/bad.Config",
+			"example.com/bad/bad.go:x:y: wire.Requires may only be used as an argument to wire.NewSet",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Load(...) errors diff (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Export", func(t *testing.T) {
+		report, errs := ExportSets(ctx, wd, env, []string{"example.com/foo"}, "")
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		want := &SetsReport{
+			Sets: []*SetInputs{
+				{
+					Set:    `"example.com/foo".InferredSet`,
+					Inputs: []string{"*example.com/foo.Config", "context.Context"},
+				},
+				{
+					Set:      `"example.com/foo".ServerSet`,
+					Inputs:   []string{"*example.com/foo.Config", "context.Context"},
+					Declared: true,
+				},
+			},
+		}
+		if diff := cmp.Diff(want, report); diff != "" {
+			t.Errorf("ExportSets(...) diff (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("Graph", func(t *testing.T) {
+		for _, set := range []string{"ServerSet", "InferredSet"} {
+			data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, set, "", "cytospace", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var elems CytospaceElements
+			if err := json.Unmarshal([]byte(data), &elems); err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range elems.Nodes {
+				if n.Data.Shape != "octagon" {
+					continue
+				}
+				if want := set == "ServerSet"; n.Data.Declared != want {
+					t.Errorf("%s: input %s declared = %t; want %t", set, n.Data.Id, n.Data.Declared, want)
+				}
+			}
+		}
+	})
+}
+
+func TestConditionalProviders(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "github.com/google/wire"
+
+type Cache struct{}
+
+type Server struct{}
+
+func NewCache() (*Cache, bool) { return new(Cache), true }
+
+func NewServer(c *Cache) *Server { return new(Server) }
+
+var ServerSet = wire.NewSet(wire.Optional(new(*Cache)), NewCache, NewServer)
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "ServerSet", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if got := strings.Count(data, "[conditional]"); got != 1 {
+		t.Errorf("graphviz output has %d conditional badges; want 1:\n%s", got, data)
+	}
+	data, _, errs = Graph(ctx, wd, env, []string{"example.com/foo"}, "ServerSet", "", "cytospace", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var elems CytospaceElements
+	if err := json.Unmarshal([]byte(data), &elems); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range elems.Nodes {
+		if n.Data.Subgraph || n.Data.Shape == "octagon" {
+			continue
+		}
+		want := strings.Contains(n.Data.Content, "NewCache")
+		found = found || want
+		if n.Data.Conditional != want {
+			t.Errorf("node %s conditional = %t; want %t", n.Data.Content, n.Data.Conditional, want)
+		}
+		if got := n.Classes == "conditional"; got != want {
+			t.Errorf("node %s classes = %q; want conditional = %t", n.Data.Content, n.Classes, want)
+		}
+	}
+	if !found {
+		t.Errorf("cytospace output has no node for NewCache:\n%s", data)
+	}
+}
+
+func TestGraphAcrossPackages(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/bar/bar.go": []byte(`package bar
+
+import "github.com/google/wire"
+
+type DB struct{}
+
+func NewDB() *DB { return new(DB) }
+
+var Set = wire.NewSet(NewDB)
+`),
+			"example.com/baz/baz.go": []byte(`package baz
+
+import "github.com/google/wire"
+
+type Cache struct{}
+
+func NewCache() *Cache { return new(Cache) }
+
+var Set = wire.NewSet(NewCache)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "example.com/bar"
+
+type Server struct{}
+
+func NewServer(db *bar.DB) *Server { return new(Server) }
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+func initServer() *Server {
+	wire.Build(bar.Set, NewServer)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	pattern := []string{"example.com/..."}
+
+	data, _, errs := Graph(ctx, wd, env, pattern, "initServer", "", "cytospace", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var elems CytospaceElements
+	if err := json.Unmarshal([]byte(data), &elems); err != nil {
+		t.Fatal(err)
+	}
+	pkgOf := make(map[string]string)
+	for _, n := range elems.Nodes {
+		if !n.Data.Subgraph {
+			pkgOf[n.Data.Content] = n.Data.Package
+		}
+	}
+	// Only providers outside example.com/foo carry their package.
+	if got := pkgOf["NewDB\nexample.com/bar"]; got != "example.com/bar" {
+		t.Errorf("package of NewDB = %q; want %q\n%s", got, "example.com/bar", data)
+	}
+	if got, ok := pkgOf["NewServer\nexample.com/foo"]; !ok || got != "" {
+		t.Errorf("package of NewServer = %q, found = %t; want \"\", true\n%s", got, ok, data)
+	}
+	data, _, errs = Graph(ctx, wd, env, pattern, "initServer", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if want := `tooltip="example.com/bar.NewDB` + "\n" + filepath.Join(gopath, "src", "example.com", "bar", "bar.go"); !strings.Contains(data, want) {
+		t.Errorf("graphviz output does not contain %s:\n%s", want, data)
+	}
+	if want := `tooltip="example.com/foo.NewServer`; strings.Contains(data, want) {
+		t.Errorf("graphviz output contains %s:\n%s", want, data)
+	}
+
+	// Set is declared by both example.com/bar and example.com/baz.
+	_, _, errs = Graph(ctx, wd, env, pattern, "Set", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v; want one error", errs)
+	}
+	for _, want := range []string{"Set is ambiguous", `provider set "example.com/bar".Set`, `provider set "example.com/baz".Set`} {
+		if !strings.Contains(errs[0].Error(), want) {
+			t.Errorf("error %q does not contain %q", errs[0], want)
+		}
+	}
+	// The pattern narrows the search.
+	if _, _, errs := Graph(ctx, wd, env, []string{"example.com/baz"}, "Set", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone); len(errs) > 0 {
+		t.Errorf("graph of example.com/baz Set: %v", errs)
+	}
+	_, _, errs = Graph(ctx, wd, env, pattern, "initClient", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if want := "no provider set or injector named initClient found in example.com/..."; len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v; want %q", errs, want)
+	}
+}
+
+func TestDiffGraphs(t *testing.T) {
+	// A consumes B, which consumes C in the old graph and D in the new one.
+	old := `{"nodes":[{"data":{"id":"set","subgraph":true}},{"data":{"id":"A","parent":"set"}},{"data":{"id":"B"}},{"data":{"id":"C"}}],
+		"edges":[{"data":{"id":"A->B","source":"A","target":"B"}},{"data":{"id":"B->C","source":"B","target":"C"}}]}`
+	new := `{"nodes":[{"data":{"id":"A"}},{"data":{"id":"B"}},{"data":{"id":"D"}}],
+		"edges":[{"data":{"id":"A->B","source":"A","target":"B"}},{"data":{"id":"B->D","source":"B","target":"D"}}]}`
+	diff, err := DiffGraphs(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &GraphDiff{
+		Nodes: []GraphDiffNode{
+			{Id: "A", Status: DiffUnchanged},
+			{Id: "B", Status: DiffRewired},
+			{Id: "C", Status: DiffRemoved},
+			{Id: "D", Status: DiffAdded},
+		},
+		Edges: []GraphDiffEdge{
+			{Source: "A", Target: "B", Status: DiffUnchanged},
+			{Source: "B", Target: "C", Status: DiffRemoved},
+			{Source: "B", Target: "D", Status: DiffAdded},
+		},
+	}
+	if d := cmp.Diff(want, diff); d != "" {
+		t.Errorf("DiffGraphs diff (-want +got):\n%s", d)
+	}
+	if _, err := gographviz.Read([]byte(diff.Graphviz())); err != nil {
+		t.Errorf("invalid graphviz output: %v\n%s", err, diff.Graphviz())
+	}
+}
+
+func TestGraphD2(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/bar/bar.go": []byte(`package bar
+
+import "github.com/google/wire"
+
+type DB struct{}
+
+//wire:cost heavy
+func NewDB() *DB { return new(DB) }
+
+var Set = wire.NewSet(NewDB)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "example.com/bar"
+
+type Server struct{}
+
+func NewServer(db *bar.DB) *Server { return new(Server) }
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+func initServer() *Server {
+	wire.Build(bar.Set, NewServer)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	data, _, errs := Graph(context.Background(), wd, env, []string{"example.com/foo"}, "initServer", "", "d2", true, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// Keys are quoted, so that the dots of package paths do not nest them,
+	// and the nodes of a set are referenced through its container.
+	want := `"NewServer#example.com/foo": {
+  label: "NewServer\nexample.com/foo"
+  shape: oval
+  style.double-border: true
+  style.stroke: "blue"
+  tooltip: "$GOPATH/src/example.com/foo/foo.go:7:6"
+}
+"Set#example.com/bar": {
+  label: "Set\nexample.com/bar"
+  "NewDB#example.com/bar": {
+    label: "NewDB\nexample.com/bar"
+    shape: rectangle
+    style.stroke-width: 4
+    style.stroke: "blue"
+    tooltip: "example.com/bar.NewDB\n$GOPATH/src/example.com/bar/bar.go:8:6"
+  }
+}
+"NewServer#example.com/foo" -> "Set#example.com/bar"."NewDB#example.com/bar": {style.stroke: "blue"; style.stroke-width: 2}
+`
+	if diff := cmp.Diff(want, strings.Replace(data, gopath, "$GOPATH", -1)); diff != "" {
+		t.Errorf("d2 output diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGraphFilter(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// From the root provideF, provideD and provideE are one edge away,
+	// provideC and db.New two, provideB three and provideA four.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+import "example.com/foo/db"
+
+type (
+	A int
+	B int
+	C int
+	D int
+	E int
+	F int
+)
+
+func provideA() A           { return 1 }
+func provideB(a A) B        { return B(a) }
+func provideC(b B) C        { return C(b) }
+func provideD(c C) D        { return D(c) }
+func provideE(d *db.DB) E   { return 0 }
+func provideF(d D, e E) F { return F(d) + F(e) }
+
+func main() {}
+`),
+			"example.com/foo/db/db.go": []byte(`package db
+
+type DB struct{}
+
+func New() *DB { return new(DB) }
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+func injectF() F {
+	wire.Build(provideA, provideB, provideC, provideD, provideE, provideF, db.New)
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter *GraphFilter
+		nodes  []string
+		edges  []string
+	}{
+		{
+			name:   "Depth",
+			filter: &GraphFilter{Depth: 1},
+			nodes:  []string{"1 hidden provider", "3 hidden providers", "provideD", "provideE", "provideF"},
+			edges:  []string{"provideD->3 hidden providers", "provideE->1 hidden provider", "provideF->provideD", "provideF->provideE"},
+		},
+		{
+			name:   "Focus",
+			filter: &GraphFilter{Focus: "example.com/foo/db"},
+			nodes:  []string{"4 hidden providers", "New", "provideE", "provideF"},
+			edges:  []string{"provideE->New", "provideF->4 hidden providers", "provideF->provideE"},
+		},
+		{
+			name:   "FocusType",
+			filter: &GraphFilter{Focus: "example.com/foo.C"},
+			nodes:  []string{"1 hidden provider", "2 hidden providers", "provideB", "provideC", "provideD", "provideF"},
+			edges:  []string{"provideB->1 hidden provider", "provideC->provideB", "provideD->provideC", "provideF->2 hidden providers", "provideF->provideD"},
+		},
+		{
+			name:   "DepthAndFocus",
+			filter: &GraphFilter{Depth: 1, Focus: "example.com/foo/db"},
+			nodes:  []string{"1 hidden provider", "4 hidden providers", "provideE", "provideF"},
+			edges:  []string{"provideE->1 hidden provider", "provideF->4 hidden providers", "provideF->provideE"},
+		},
+		{
+			name:   "NoMatch",
+			filter: &GraphFilter{Focus: "example.com/bar"},
+			nodes:  []string{"provideF"},
+		},
+		{
+			name:   "Exclude",
+			filter: &GraphFilter{Exclude: regexp.MustCompile(`^example\.com/foo\.provide[BC]$`)},
+			nodes:  []string{"New", "provideA", "provideD", "provideE", "provideF"},
+			edges:  []string{"provideD->provideA (elided)", "provideE->New", "provideF->provideD", "provideF->provideE"},
+		},
+		{
+			name:   "ExcludeType",
+			filter: &GraphFilter{Exclude: regexp.MustCompile(`db\.DB$`)},
+			nodes:  []string{"provideA", "provideB", "provideC", "provideD", "provideE", "provideF"},
+			edges:  []string{"provideB->provideA", "provideC->provideB", "provideD->provideC", "provideF->provideD", "provideF->provideE"},
+		},
+		{
+			name:   "Include",
+			filter: &GraphFilter{Include: regexp.MustCompile(`provide[AF]$`)},
+			nodes:  []string{"provideA", "provideF"},
+			edges:  []string{"provideF->provideA (elided)"},
+		},
+		{
+			name:   "IncludeAndDepth",
+			filter: &GraphFilter{Depth: 1, Include: regexp.MustCompile(`provide[ABDF]$`)},
+			nodes:  []string{"2 hidden providers", "provideD", "provideF"},
+			edges:  []string{"provideD->2 hidden providers", "provideF->provideD"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "injectF", "", "cytospace", true, nil, test.filter, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var elems CytospaceElements
+			if err := json.Unmarshal([]byte(data), &elems); err != nil {
+				t.Fatal(err)
+			}
+			// Name the nodes by their provider or label.
+			names := make(map[string]string)
+			var gotNodes []string
+			for _, n := range elems.Nodes {
+				if n.Data.Subgraph {
+					continue
+				}
+				name := strings.Split(n.Data.Content, "\n")[0]
+				names[n.Data.Id] = name
+				gotNodes = append(gotNodes, name)
+			}
+			var gotEdges []string
+			for _, e := range elems.Edges {
+				from, ok := names[e.Data.Source]
+				to, ok2 := names[e.Data.Target]
+				if !ok || !ok2 {
+					t.Errorf("edge %s dangles", e.Data.Id)
+					continue
+				}
+				edge := from + "->" + to
+				if e.Data.Elided {
+					edge += " (elided)"
+				}
+				gotEdges = append(gotEdges, edge)
+			}
+			sort.Strings(gotNodes)
+			sort.Strings(gotEdges)
+			if diff := cmp.Diff(test.nodes, gotNodes); diff != "" {
+				t.Errorf("nodes diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.edges, gotEdges); diff != "" {
+				t.Errorf("edges diff (-want +got):\n%s", diff)
+			}
+
+			// The graphviz output draws the same collapsed nodes.
+			data, _, errs = Graph(ctx, wd, env, []string{"example.com/foo"}, "injectF", "", "graphviz", false, nil, test.filter, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if _, err := gographviz.Read([]byte(data)); err != nil {
+				t.Errorf("invalid graphviz output: %v\n%s", err, data)
+			}
+			want := 0
+			for _, n := range test.nodes {
+				if strings.Contains(n, "hidden") {
+					want++
+				}
+			}
+			if got := strings.Count(data, "hidden provider"); got != want {
+				t.Errorf("graphviz output has %d collapsed nodes; want %d:\n%s", got, want, data)
+			}
+			want = 0
+			for _, e := range test.edges {
+				if strings.HasSuffix(e, "(elided)") {
+					want++
+				}
+			}
+			got := 0
+			for _, line := range strings.Split(data, "\n") {
+				if strings.Contains(line, "->") && strings.Contains(line, "style=dashed") {
+					got++
+				}
+			}
+			if got != want {
+				t.Errorf("graphviz output has %d dashed edges; want %d:\n%s", got, want, data)
+			}
+		})
+	}
+}
+
+func TestDebugLogging(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "github.com/google/wire"
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+var Set = wire.NewSet(provideFoo)
+
+var OtherSet = wire.NewSet(Set)
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+
+	var buf bytes.Buffer
+	logger := logging.Default()
+	logger.SetOutput(&buf)
+	logger.SetLevel(logging.LevelDebug)
+	defer func() {
+		logger.SetOutput(os.Stderr)
+		logger.SetLevel(logging.LevelInfo)
+	}()
+	if _, errs := Load(context.Background(), wd, env, "", []string{"example.com/foo"}); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	logged := buf.String()
+	// The events and keys documented in package logging.
+	for _, want := range []string{
+		`wireplus: debug: load\.config dir=\S+ tags=wireinject mode=\S+ env="[^"]*GOPATH=`,
+		`wireplus: debug: load\.result patterns=example\.com/foo packages=example\.com/foo\n`,
+		`wireplus: debug: cache name=objects hits=1 misses=3\n`,
+		`wireplus: debug: phase name=load duration=\S+\n`,
+		`wireplus: debug: phase name=analyze duration=\S+\n`,
+	} {
+		if !regexp.MustCompile(want).MatchString(logged) {
+			t.Errorf("debug output does not match %s:\n%s", want, logged)
+		}
+	}
+}
+
+func TestAnonSetID(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+import "github.com/google/wire"
+
+type (
+	Foo int
+	Bar int
+)
+
+func provideFoo() Foo { return 1 }
+func provideBar() Bar { return 2 }
+
+var Set = wire.NewSet(wire.NewSet(provideFoo), provideBar)
+
+func main() {}
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectBar() Bar {
+	wire.Build(provideBar)
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	// The identifiers must be identical across runs.
+	for run := 0; run < 2; run++ {
+		info, errs := Load(ctx, wd, env, "", []string{"example.com/foo"})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var got []string
+		for id := range info.AnonSets {
+			got = append(got, id)
+		}
+		sort.Strings(got)
+		want := []string{
+			"anon@example.com/foo/foo.go:13:23",
+			"anon@example.com/foo/wire.go:8:2",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("run %d: AnonSets diff (-want +got):\n%s", run, diff)
+		}
+		named := info.Sets[ProviderSetID{ImportPath: "example.com/foo", VarName: "Set"}]
+		if len(named.Imports) != 1 || named.Imports[0].Name() != want[0] {
+			t.Errorf("run %d: Set imports %v; want %s", run, named.Imports, want[0])
+		}
+		for _, id := range []string{want[0], "anon@foo.go:13:23"} {
+			if set := info.AnonSet(id); set != named.Imports[0] {
+				t.Errorf("run %d: AnonSet(%q) = %v; want %s", run, id, set, want[0])
+			}
+		}
+		if set := info.AnonSet("anon@foo.go:1:1"); set != nil {
+			t.Errorf("run %d: AnonSet(%q) = %v; want nil", run, "anon@foo.go:1:1", set)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package main
+
+import "example.com/bar"
+
+type (
+	Foo    int
+	Fooer  interface{ Foo() }
+	FooBar struct {
+		Foo Foo
+		Bar bar.Bar
+	}
+	Config struct{ Name string }
+)
+
+func (Foo) Foo() {}
+
+func provideFoo() Foo                         { return 1 }
+func provideFooBar(f Foo, b bar.Bar) *FooBar   { return &FooBar{f, b} }
+func provideConfig() *Config                  { return &Config{} }
+
+func main() {}
+`
+	const barGo = `package bar
+
+import "github.com/google/wire"
+
+type Bar int
+
+func NewBar() Bar { return 2 }
+
+var Set = wire.NewSet(NewBar)
+`
+	const wireGo0 = `//+build wireinject
+
+package main
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+// Unrelated code   is left   untouched.
+var unrelated = []int{1,2}
+
+var Set = wire.NewSet(wire.Value("x"), provideFooBar, /* inline */ provideFoo, // trailing of provideFoo
+	// leading of bar.Set
+	bar.Set,
+	wire.Bind(new(Fooer), new(Foo)),
+	wire.NewSet(provideConfig,
+		wire.FieldsOf(new(*Config), "Name")), // trailing of the nested set
+	// dangling
+)
+
+func injectFooBar() *FooBar {
+	wire.Build(provideFooBar, wire.Struct(new(Config), "*"), Set)
+	return nil
+}
+`
+	const want = `//+build wireinject
+
+package main
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+// Unrelated code   is left   untouched.
+var unrelated = []int{1,2}
+
+var Set = wire.NewSet(
+	// leading of bar.Set
+	bar.Set,
+	wire.NewSet(
+		provideConfig,
+		wire.FieldsOf(new(*Config), "Name"),
+	), // trailing of the nested set
+	/* inline */ provideFoo, // trailing of provideFoo
+	provideFooBar,
+	wire.Bind(new(Fooer), new(Foo)),
+	wire.Value("x"),
+	// dangling
+)
+
+func injectFooBar() *FooBar {
+	wire.Build(
+		Set,
+		provideFooBar,
+		wire.Struct(new(Config), "*"),
+	)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+			"example.com/foo/wire.go":        []byte(wireGo0),
+			"example.com/bar/bar.go":         []byte(barGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	for run := 0; run < 2; run++ {
+		results, errs := Format(ctx, wd, env, "", []string{"example.com/foo", "example.com/bar"})
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		got := make(map[string]string)
+		for _, r := range results {
+			rel, err := filepath.Rel(wd, r.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Changed != (run == 0 && rel != "foo/foo.go") {
+				t.Errorf("run %d: %s changed = %t", run, rel, r.Changed)
+			}
+			got[filepath.ToSlash(rel)] = string(r.Content)
+			if err := r.Commit(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		wantFiles := map[string]string{
+			"bar/bar.go":  strings.Replace(barGo, "wire.NewSet(NewBar)", "wire.NewSet(\n\tNewBar,\n)", 1),
+			"foo/foo.go":  fooGo,
+			"foo/wire.go": want,
+		}
+		if diff := cmp.Diff(wantFiles, got); diff != "" {
+			t.Errorf("run %d: Format(...) diff (-want +got):\n%s", run, diff)
+		}
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package main
+
+import "github.com/google/wire"
+
+const (
+	prefix  = "app"
+	retries = 3
+)
+
+type Limit struct {
+	Name string
+	Max  int
+}
+
+type Config struct {
+	Name   string
+	Limits []Limit
+	Tags   map[string][]int
+}
+
+var defaultLimit = Limit{Name: "default", Max: 1}
+
+var Set = wire.NewSet(wire.Value(Config{
+	Name: prefix + "-server",
+	Limits: []Limit{
+		{Name: prefix, Max: retries * 2},
+		defaultLimit,
+	},
+	Tags: map[string][]int{"a": {retries, 1 << 2}},
+}))
+
+func main() {}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	const wantSource = `Config{
+	Name: "app-server",
+	Limits: []Limit{
+		{Name: "app", Max: 6},
+		defaultLimit,
+	},
+	Tags: map[string][]int{"a": {3, 4}},
+}`
+	wantIdents := []string{
+		"Config", "Name", `prefix = "app"`, "Limits", "Limit", "Name", "Max",
+		"retries = 3", "defaultLimit", "Tags",
+	}
+	tests := []struct {
+		// at is the source at the position looked up.
+		at   string
+		want bool
+	}{
+		{at: "wire.NewSet", want: false},
+		{at: "Value(Config", want: false},
+		{at: "Config{\n", want: true},
+		{at: "retries * 2", want: true},
+		{at: "2},", want: true},
+		{at: "defaultLimit,", want: true},
+		{at: `"a"`, want: true},
+		{at: "main() {}", want: false},
+	}
+	for _, test := range tests {
+		offset := strings.Index(fooGo, test.at)
+		if offset < 0 {
+			t.Fatalf("%q not found", test.at)
+		}
+		v := ValueAt(pkg, file.Pos(offset))
+		if !test.want {
+			if v != nil {
+				t.Errorf("ValueAt(%q) = %q; want nil", test.at, v.Source)
+			}
+			continue
+		}
+		if v == nil {
+			t.Errorf("ValueAt(%q) = nil", test.at)
+			continue
+		}
+		if v.Source != wantSource {
+			t.Errorf("ValueAt(%q).Source = %q; want %q", test.at, v.Source, wantSource)
+		}
+		if got := types.TypeString(v.Type, nil); got != "example.com/foo.Config" {
+			t.Errorf("ValueAt(%q).Type = %s; want example.com/foo.Config", test.at, got)
+		}
+		var idents []string
+		for _, id := range v.Idents {
+			s := id.Ident.Name
+			if id.Value != nil {
+				s += " = " + id.Value.ExactString()
+			}
+			idents = append(idents, s)
+			if got, want := pkg.Fset.Position(id.Obj.Pos()).Filename, file.Name(); got != want {
+				t.Errorf("ValueAt(%q): %s declared in %s; want %s", test.at, id.Ident.Name, got, want)
+			}
+		}
+		if diff := cmp.Diff(wantIdents, idents); diff != "" {
+			t.Errorf("ValueAt(%q).Idents diff (-want +got):\n%s", test.at, diff)
+		}
+	}
+}
+
+func TestProviderRefAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package main
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type Server struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewServer(cfg *Config) (*Server, func(), error) { return new(Server), func() {}, nil }
+
+var ConfigSet = wire.NewSet(NewConfig)
+
+var ServerSet = wire.NewSet(ConfigSet, (NewServer))
+
+var OtherSet = wire.NewSet(wire.Struct(new(Server)))
+
+func main() { NewConfig() }
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	info, errs := LoadInfo(pkgs)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	tests := []struct {
+		// at is the source at the position looked up.
+		at string
+		// want is the provider found, if any, and sets the sets including it.
+		want string
+		sets []string
+	}{
+		{at: "NewConfig)", want: "NewConfig", sets: []string{"ConfigSet", "ServerSet"}},
+		{at: "NewServer))", want: "NewServer", sets: []string{"ServerSet"}},
+		{at: "ConfigSet, ", want: ""},
+		{at: "wire.NewSet(NewConfig", want: ""},
+		{at: "NewConfig() }\n", want: ""},
+		{at: "NewConfig() *Config", want: ""},
+	}
+	for _, test := range tests {
+		offset := strings.Index(fooGo, test.at)
+		if offset < 0 {
+			t.Fatalf("%q not found", test.at)
+		}
+		_, fn := ProviderRefAt(pkg, file.Pos(offset))
+		if test.want == "" {
+			if fn != nil {
+				t.Errorf("ProviderRefAt(%q) = %s; want nil", test.at, fn.Name())
+			}
+			continue
+		}
+		if fn == nil || fn.Name() != test.want {
+			t.Errorf("ProviderRefAt(%q) = %v; want %s", test.at, fn, test.want)
+			continue
+		}
+		p, ids := info.ProviderOf(fn)
+		if p == nil || p.Name != test.want {
+			t.Errorf("ProviderOf(%s) = %v; want its provider", test.want, p)
+			continue
+		}
+		var sets []string
+		for _, id := range ids {
+			sets = append(sets, id.VarName)
+		}
+		if diff := cmp.Diff(test.sets, sets); diff != "" {
+			t.Errorf("ProviderOf(%s) sets diff (-want +got):\n%s", test.want, diff)
+		}
+	}
+}
+
+func TestCompletionsAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const configGo = `package config
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type Other struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewOther() *Other { return new(Other) }
+
+var Set = wire.NewSet(NewConfig)
+`
+	const fooGo = `package foo
+
+import (
+	"example.com/config"
+	"github.com/google/wire"
+)
+
+type Logger struct{}
+
+type Server struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(cfg *config.Config, l *Logger) *Server { return new(Server) }
+
+func run(s *Server) {}
+
+var LoggerSet = wire.NewSet(NewLogger, )
+
+var PartialSet = wire.NewSet(NewServer, )
+
+func initServer() *Server {
+	wire.Build(NewServer, )
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go":   []byte(configGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	helpers := []string{"wire.Bind", "wire.FieldsOf", "wire.InterfaceValue", "wire.NewSet", "wire.Optional", "wire.Requires", "wire.Splice", "wire.Struct", "wire.Value"}
+	tests := []struct {
+		// at is the source around the position looked up, which is at the
+		// "|" if any, and at the end of at otherwise.
+		at      string
+		missing []string
+		labels  []string
+	}{
+		{
+			at:      "wire.Build(NewServer, ",
+			missing: []string{"*example.com/config.Config", "*example.com/foo.Logger"},
+			labels:  append([]string{"LoggerSet", "NewLogger", "config.NewConfig", "config.Set"}, helpers...),
+		},
+		{
+			at:      "wire.NewSet(NewServer, ",
+			missing: []string{"*example.com/config.Config", "*example.com/foo.Logger"},
+			labels:  append([]string{"LoggerSet", "NewLogger", "config.NewConfig", "config.Set"}, helpers...),
+		},
+		// The argument at the position is being typed, so it is ignored.
+		{
+			at:      "wire.Build(New|Server",
+			missing: []string{"*example.com/foo.Server"},
+			labels:  append([]string{"NewServer", "PartialSet"}, helpers...),
+		},
+		// Nothing is missing, so every provider and set in scope but the
+		// ones already passed, the injector and the set being declared is
+		// suggested.
+		{
+			at:      "wire.NewSet(NewLogger, ",
+			missing: []string{},
+			labels:  append([]string{"NewServer", "PartialSet", "config.NewConfig", "config.NewOther", "config.Set"}, helpers...),
+		},
+		{at: "wire.Bu|ild", labels: nil},
+		{at: "return nil", labels: nil},
+	}
+	for _, test := range tests {
+		src := strings.Replace(test.at, "|", "", 1)
+		offset := strings.Index(fooGo, src)
+		if offset < 0 {
+			t.Fatalf("%q not found", src)
+		}
+		if i := strings.Index(test.at, "|"); i >= 0 {
+			offset += i
+		} else {
+			offset += len(src)
+		}
+		c := CompletionsAt(pkg, file.Pos(offset))
+		if test.labels == nil {
+			if c != nil {
+				t.Errorf("CompletionsAt(%q) = %v; want nil", test.at, c)
+			}
+			continue
+		}
+		if c == nil {
+			t.Errorf("CompletionsAt(%q) = nil; want completions", test.at)
+			continue
+		}
+		if diff := cmp.Diff(test.missing, c.Missing); diff != "" {
+			t.Errorf("CompletionsAt(%q) missing diff (-want +got):\n%s", test.at, diff)
+		}
+		var labels []string
+		for _, item := range c.Items {
+			labels = append(labels, item.Label)
+		}
+		if diff := cmp.Diff(test.labels, labels); diff != "" {
+			t.Errorf("CompletionsAt(%q) labels diff (-want +got):\n%s", test.at, diff)
+		}
+	}
+}
+
+func TestProviderFixesAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const configGo = `package config
+
+type Config struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func LoadConfig() (*Config, error) { return new(Config), nil }
+
+func newConfig() *Config { return new(Config) }
+`
+	const fooGo = `package foo
+
+import "example.com/config"
+
+type Logger struct{}
+
+type Server struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(cfg *config.Config, l *Logger) *Server { return new(Server) }
+`
+	const injectorsGo = `package foo
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(NewServer)
+	return nil
+}
+
+func initLogger() *Logger {
+	wire.Build(NewLogger)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go":   []byte(configGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+			"example.com/foo/injectors.go":   []byte(injectorsGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	var file *token.File
+	for _, f := range pkg.Syntax {
+		if tf := pkg.Fset.File(f.Pos()); filepath.Base(tf.Name()) == "injectors.go" {
+			file = tf
+		}
+	}
+	at := func(src string) token.Pos {
+		offset := strings.Index(injectorsGo, src)
+		if offset < 0 {
+			t.Fatalf("%q not found", src)
+		}
+		return file.Pos(offset)
+	}
+
+	// The unexported provider of config, the injector initLogger and the
+	// injector itself are not offered.
+	fixes := ProviderFixesAt(pkg, at("wire.Build(NewServer)"))
+	var got []string
+	for _, fix := range fixes {
+		got = append(got, fix.Type+": "+fix.Expr+" "+strings.Join(fix.Imports, ","))
+	}
+	want := []string{
+		"*example.com/config.Config: config.LoadConfig example.com/config",
+		"*example.com/config.Config: config.NewConfig example.com/config",
+		"*example.com/foo.Logger: NewLogger ",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("ProviderFixesAt diff (-want +got):\n%s", diff)
+	}
+
+	// The edits are in order, so apply them from the last.
+	edited := injectorsGo
+	for i := len(fixes[0].Edits) - 1; i >= 0; i-- {
+		e := fixes[0].Edits[i]
+		edited = edited[:file.Offset(e.Pos)] + e.NewText + edited[file.Offset(e.End):]
+	}
+	const wantEdited = `package foo
+
+import "github.com/google/wire"
+import "example.com/config"
+
+func initServer() *Server {
+	wire.Build(NewServer, config.LoadConfig)
+	return nil
+}
+`
+	if !strings.HasPrefix(edited, wantEdited) {
+		t.Errorf("edited source:\n%s\nwant prefix:\n%s", edited, wantEdited)
+	}
+
+	if fixes := ProviderFixesAt(pkg, at("wire.Build(NewLogger)")); fixes != nil {
+		t.Errorf("ProviderFixesAt(initLogger) = %v; want nil", fixes)
+	}
+}
+
+func TestCandidateFixesAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "example.com/config"
+
+type Greeter interface {
+	Greet() string
+}
+
+type Server struct{}
+
+func NewServer(cfg *config.Config, g Greeter) *Server { return new(Server) }
+`
+	const injectorsGo = `package foo
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(NewServer)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go": []byte(`package config
+
+type Config struct{}
+
+func NewConfig() *Config { return new(Config) }
+`),
+			"example.com/config/load/load.go": []byte(`package load
+
+import "example.com/config"
+
+func NewConfig() *config.Config { return new(config.Config) }
+
+func newConfig() *config.Config { return new(config.Config) }
+`),
+			"example.com/x/y/far/far.go": []byte(`package far
+
+import "example.com/config"
+
+func NewConfig() *config.Config { return new(config.Config) }
+`),
+			"example.com/foo/sub/sub.go": []byte(`package sub
+
+import (
+	"example.com/config"
+	"example.com/foo"
+)
+
+var _ *foo.Server
+
+func NewConfig() *config.Config { return new(config.Config) }
+`),
+			"example.com/english/english.go": []byte(`package english
+
+type Greeter struct{}
+
+func (*Greeter) Greet() string { return "hello" }
+
+func NewGreeter() *Greeter { return new(Greeter) }
+`),
+			"example.com/foo/foo.go":       []byte(fooGo),
+			"example.com/foo/injectors.go": []byte(injectorsGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	all, errs := LoadPackages(context.Background(), wd, env, "", []string{"./..."})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	idx := IndexProviders(all)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	var file *token.File
+	for _, f := range pkg.Syntax {
+		if tf := pkg.Fset.File(f.Pos()); filepath.Base(tf.Name()) == "injectors.go" {
+			file = tf
+		}
+	}
+	pos := file.Pos(strings.Index(injectorsGo, "wire.Build"))
+
+	// config.NewConfig is offered by ProviderFixesAt, sub.NewConfig would
+	// make an import cycle and load.newConfig is not exported. The nearest
+	// package comes first.
+	fixes := CandidateFixesAt(pkg, pos, idx)
+	var got []string
+	for _, fix := range fixes {
+		got = append(got, fix.Type+": "+fix.Expr+" "+fix.Bind+" "+strings.Join(fix.Imports, ","))
+	}
+	want := []string{
+		"*example.com/config.Config: load.NewConfig  example.com/config/load",
+		"*example.com/config.Config: far.NewConfig  example.com/x/y/far",
+		"example.com/foo.Greeter: english.NewGreeter wire.Bind(new(Greeter), new(*english.Greeter)) example.com/english",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("CandidateFixesAt diff (-want +got):\n%s", diff)
+	}
+
+	edited := injectorsGo
+	for i := len(fixes[2].Edits) - 1; i >= 0; i-- {
+		e := fixes[2].Edits[i]
+		edited = edited[:file.Offset(e.Pos)] + e.NewText + edited[file.Offset(e.End):]
+	}
+	const wantEdited = `package foo
+
+import "github.com/google/wire"
+import "example.com/english"
+
+func initServer() *Server {
+	wire.Build(NewServer, english.NewGreeter, wire.Bind(new(Greeter), new(*english.Greeter)))
+	return nil
+}
+`
+	if edited != wantEdited {
+		t.Errorf("edited source:\n%s\nwant:\n%s", edited, wantEdited)
+	}
+}
+
+func TestUnusedArgsAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "github.com/google/wire"
+
+type Logger struct{}
+
+type Server struct{}
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(l *Logger) *Server { return new(Server) }
+
+func NewFoo() *Foo { return new(Foo) }
+
+var FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))
+
+func initServer() *Server {
+	wire.Build(
+		NewLogger,
+		FooSet,
+		NewServer,
+		wire.Value(42),
+	)
+	return nil
+}
+
+func initLogger() *Logger {
+	wire.Build(NewServer, NewLogger)
+	return nil
+}
+
+func initFoo() *Foo {
+	wire.Build(FooSet)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	type result struct {
+		Messages []string
+		// Edited is the wire.Build call with the edit applied.
+		Edited string
+	}
+	tests := []struct {
+		injector string
+		want     []result
+	}{
+		{
+			injector: "initServer",
+			want: []result{
+				{[]string{`unused provider set "FooSet"`}, "wire.Build(\n\t\tNewLogger,\n\t\tNewServer,\n\t\twire.Value(42),\n\t)"},
+				{[]string{"unused value of type int"}, "wire.Build(\n\t\tNewLogger,\n\t\tFooSet,\n\t\tNewServer,\n\t)"},
+			},
+		},
+		{
+			injector: "initLogger",
+			want: []result{
+				{[]string{`unused provider "foo.NewServer"`}, "wire.Build(NewLogger)"},
+			},
+		},
+		// Only the arguments of wire.Build are checked, so the binding of
+		// FooSet is not reported.
+		{injector: "initFoo", want: nil},
+	}
+	for _, test := range tests {
+		start := strings.Index(fooGo, "func "+test.injector+"(")
+		if start < 0 {
+			t.Fatalf("%s not found", test.injector)
+		}
+		buildStart := start + strings.Index(fooGo[start:], "wire.Build(")
+		buildEnd := start + strings.Index(fooGo[start:], ")\n\treturn") + 1
+		var got []result
+		for _, arg := range UnusedArgsAt(pkg, file.Pos(start)) {
+			pos, end := file.Offset(arg.Edit.Pos), file.Offset(arg.Edit.End)
+			edited := fooGo[buildStart:pos] + arg.Edit.NewText + fooGo[end:buildEnd]
+			got = append(got, result{Messages: arg.Messages, Edited: edited})
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("UnusedArgsAt(%s) diff (-want +got):\n%s", test.injector, diff)
+		}
+	}
+}
+
+func TestExtractSetAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import w "github.com/google/wire"
+
+type Logger struct{}
+
+type Server struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(l *Logger) *Server { return new(Server) }
+
+var extractedSet = w.NewSet(NewLogger)
+
+var ServerSet = w.NewSet(NewLogger, NewServer)
+
+// initServer is an injector.
+func initServer() *Server {
+	w.Build(NewLogger, NewServer)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	// apply returns fooGo with the edits of x applied.
+	apply := func(x *SetExtraction) string {
+		src, last := "", 0
+		for _, e := range x.Edits {
+			pos, end := file.Offset(e.Pos), file.Offset(e.End)
+			src += fooGo[last:pos] + e.NewText
+			last = end
+		}
+		return src + fooGo[last:]
+	}
+	tests := []struct {
+		name string
+		// selected is the selected text, in the line starting with line.
+		line, selected string
+		// The extraction replaces old by new in fooGo; none is expected if
+		// old is "".
+		old, new string
+	}{
+		{
+			name:     "build",
+			line:     "\tw.Build(",
+			selected: "NewLogger, NewServer",
+			old:      "// initServer is an injector.\nfunc initServer() *Server {\n\tw.Build(NewLogger, NewServer)",
+			new:      "var extractedSet2 = w.NewSet(NewLogger, NewServer)\n\n// initServer is an injector.\nfunc initServer() *Server {\n\tw.Build(extractedSet2)",
+		},
+		{
+			name:     "partial",
+			line:     "\tw.Build(",
+			selected: "Logger, New",
+			old:      "// initServer is an injector.\nfunc initServer() *Server {\n\tw.Build(NewLogger, NewServer)",
+			new:      "var extractedSet2 = w.NewSet(NewLogger, NewServer)\n\n// initServer is an injector.\nfunc initServer() *Server {\n\tw.Build(extractedSet2)",
+		},
+		{
+			name:     "set",
+			line:     "var ServerSet",
+			selected: "NewServer",
+			old:      "var ServerSet = w.NewSet(NewLogger, NewServer)",
+			new:      "var extractedSet2 = w.NewSet(NewServer)\n\nvar ServerSet = w.NewSet(NewLogger, extractedSet2)",
+		},
+		{
+			name:     "all of a set",
+			line:     "var ServerSet",
+			selected: "NewLogger, NewServer",
+		},
+		{
+			name:     "outside a call",
+			line:     "var ServerSet",
+			selected: "ServerSet",
+		},
+		{
+			name:     "empty",
+			line:     "\tw.Build(",
+			selected: "",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := strings.Index(fooGo, test.line)
+			start := line + strings.Index(fooGo[line:], test.selected)
+			x := ExtractSetAt(pkg, file.Pos(start), file.Pos(start+len(test.selected)))
+			switch {
+			case x == nil && test.old != "":
+				t.Fatal("ExtractSetAt = nil; want an extraction")
+			case x == nil:
+				return
+			case test.old == "":
+				t.Fatalf("ExtractSetAt = %+v; want nil", x)
+			}
+			want := strings.Replace(fooGo, test.old, test.new, 1)
+			if diff := cmp.Diff(want, apply(x)); diff != "" {
+				t.Errorf("edited source diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestOrganizeProviders(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const barGo = `package bar
+
+import "github.com/google/wire"
+
+type Bar int
+
+func NewBar() Bar { return 0 }
+
+var Set = wire.NewSet(NewBar)
+`
+	const fooGo = `package foo
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+type Fooer interface{ Foo() }
+
+type Foo struct{ Bar bar.Bar }
+
+func (Foo) Foo() {}
+
+type Logger struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewFoo(l *Logger, b bar.Bar) Foo { return Foo{} }
+
+var LoggerSet = wire.NewSet(NewLogger)
+
+var Sorted = wire.NewSet(LoggerSet, NewFoo, wire.Bind(new(Fooer), new(Foo)))
+
+var Mixed = wire.NewSet(wire.Bind(new(Fooer), new(Foo)), NewFoo, bar.NewBar, NewLogger, bar.Set, LoggerSet)
+
+var Duplicated = wire.NewSet(NewFoo, NewLogger, NewFoo, wire.Value(42), wire.Value(42))
+
+var Nested = wire.NewSet(wire.NewSet(NewLogger, LoggerSet), bar.Set)
+
+var Commented = wire.NewSet(NewLogger /* last */, LoggerSet)
+
+func initFoo() Foo {
+	wire.Build(
+		wire.Struct(new(Foo), "*"),
+		NewLogger,
+		bar.Set,
+	)
+	return Foo{}
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/bar/bar.go":         []byte(barGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+	edits := OrganizeProviders(pkg, file.Name())
+	src, last := "", 0
+	for _, e := range edits {
+		pos, end := file.Offset(e.Pos), file.Offset(e.End)
+		src += fooGo[last:pos] + e.NewText
+		last = end
+	}
+	src += fooGo[last:]
+	want := strings.NewReplacer(
+		"wire.NewSet(wire.Bind(new(Fooer), new(Foo)), NewFoo, bar.NewBar, NewLogger, bar.Set, LoggerSet)",
+		"wire.NewSet(LoggerSet, bar.Set, NewFoo, NewLogger, bar.NewBar, wire.Bind(new(Fooer), new(Foo)))",
+		"wire.NewSet(NewFoo, NewLogger, NewFoo, wire.Value(42), wire.Value(42))",
+		"wire.NewSet(NewFoo, NewLogger, wire.Value(42))",
+		"wire.NewSet(wire.NewSet(NewLogger, LoggerSet), bar.Set)",
+		"wire.NewSet(bar.Set, wire.NewSet(LoggerSet, NewLogger))",
+		"\t\twire.Struct(new(Foo), \"*\"),\n\t\tNewLogger,\n\t\tbar.Set,\n",
+		"\t\tbar.Set,\n\t\tNewLogger,\n\t\twire.Struct(new(Foo), \"*\"),\n",
+	).Replace(fooGo)
+	if diff := cmp.Diff(want, src); diff != "" {
+		t.Errorf("organized source diff (-want +got):\n%s", diff)
+	}
+	if n := len(edits); n != 4 {
+		t.Errorf("got %d edits; want 4, leaving the sorted and commented calls alone", n)
+	}
+}
+
+func TestAllBindings(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "github.com/google/wire"
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+func NewFoo() *Foo { return new(Foo) }
+
+var FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))
+
+var BindSet = wire.NewSet(wire.Bind(new(Fooer), new(*Foo)))
+
+var BadSet = wire.NewSet(wire.Bind(new(Fooer), new(Foo)))
+
+func initFooer() Fooer {
+	wire.Build(BindSet, NewFoo)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	fset := pkgs[0].Fset
+
+	type binding struct {
+		Pos, Iface, Provided, Provider string
+	}
+	var got []binding
+	for _, b := range AllBindings(pkgs) {
+		got = append(got, binding{
+			Pos:      fmt.Sprint(fset.Position(b.Pos).Line),
+			Iface:    types.TypeString(b.Iface, nil),
+			Provided: types.TypeString(b.Provided, nil),
+			Provider: fmt.Sprint(fset.Position(b.Provider).Line),
+		})
+	}
+	// BindSet provides no *Foo itself, and BadSet is not valid.
+	want := []binding{
+		{"13", "example.com/foo.Fooer", "*example.com/foo.Foo", "11"},
+		{"15", "example.com/foo.Fooer", "*example.com/foo.Foo", "0"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("AllBindings diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "github.com/google/wire"
+
+type A int
+
+type B int
+
+type C int
+
+func NewA(B) A { return 0 }
+
+func NewB(A) B { return 0 }
+
+func NewC() C { return 0 }
+
+func OtherC() C { return 0 }
+
+var CycleSet = wire.NewSet(NewA, NewB)
+
+var ConflictSet = wire.NewSet(NewC, OtherC)
+
+func initA() A {
+	wire.Build(NewA)
+	return 0
+}
+
+func initC() C {
+	wire.Build(NewC, wire.Value(B(0)))
+	return 0
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	_, errs := Load(context.Background(), wd, env, "", []string{"example.com/foo"})
+
+	// Each error is described by its category and related positions, as
+	// line: message.
+	var got []string
+	for _, err := range errs {
+		w, ok := err.(*WireErr)
+		if !ok {
+			t.Fatalf("got error %v of type %T; want a *WireErr", err, err)
+		}
+		desc := w.Category()
+		for _, r := range w.Related() {
+			desc += fmt.Sprintf(", %d: %s", r.Position.Line, r.Message)
+		}
+		got = append(got, desc)
+	}
+	sort.Strings(got)
+	want := []string{
+		"cycle, 11: provider of example.com/foo.A, 13: provider of example.com/foo.B",
+		"multiple-bindings, 17: current binding for example.com/foo.C, 15: previous binding for example.com/foo.C",
+		"no-provider, 11: needed by example.com/foo.A",
+		"unused, 29: declared here",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("categories diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSignatureHelpAt(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "github.com/google/wire"
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+type Config struct {
+	Name string
+	Port int
+}
+
+func NewFoo() *Foo { return new(Foo) }
+
+var BindSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(Foo)))
+
+var BadBind = wire.NewSet(wire.Bind(new(Foo), new(*Foo)))
+
+var StructSet = wire.NewSet(wire.Struct(new(Config), "Name", "Host"))
+
+var FieldsSet = wire.NewSet(wire.FieldsOf(new(*Config), "Port"))
+
+var Mixed = wire.NewSet(NewFoo, 42)
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	type result struct {
+		Label    string
+		Active   int
+		Problems []string
+	}
+	tests := []struct {
+		// The position is at the end of before, which must be unique.
+		before string
+		want   *result
+	}{
+		{
+			before: "wire.Bind(new(Fooer), ",
+			want:   &result{Label: helperSignatures["Bind"].Label, Active: 1},
+		},
+		{
+			before: "wire.Bind(new(Fooer),",
+			want: &result{Label: helperSignatures["Bind"].Label, Active: 1, Problems: []string{
+				"example.com/foo.Foo does not implement example.com/foo.Fooer",
+			}},
+		},
+		{
+			before: "wire.Bind(new(Foo),",
+			want: &result{Label: helperSignatures["Bind"].Label, Active: 1, Problems: []string{
+				"first argument to Bind must be a pointer to an interface type; found *example.com/foo.Foo",
+			}},
+		},
+		{
+			before: `wire.Struct(new(Config), "Name",`,
+			want: &result{Label: helperSignatures["Struct"].Label, Active: 1, Problems: []string{
+				`"Host" is not a field of struct{Name string; Port int}`,
+			}},
+		},
+		{
+			before: "wire.FieldsOf(",
+			want:   &result{Label: helperSignatures["FieldsOf"].Label},
+		},
+		{
+			before: "Mixed = wire.NewSet(NewFoo,",
+			want: &result{Label: helperSignatures["NewSet"].Label, Problems: []string{
+				"42 is not a provider, provider set or wire helper; found int",
+			}},
+		},
+		{before: "func NewFoo() *Foo { return new(", want: nil},
+	}
+	for _, test := range tests {
+		offset := strings.Index(fooGo, test.before)
+		if offset < 0 {
+			t.Fatalf("%q not found", test.before)
+		}
+		var got *result
+		if sig := SignatureHelpAt(pkg, file.Pos(offset+len(test.before))); sig != nil {
+			got = &result{Label: sig.Label, Active: sig.Active, Problems: sig.Problems}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("SignatureHelpAt after %q diff (-want +got):\n%s", test.before, diff)
+		}
+	}
+}
+
+func TestOutline(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const configGo = `package config
+
+import "github.com/google/wire"
+
+type Config struct{ Name string }
+
+func NewConfig() *Config { return new(Config) }
+
+var Set = wire.NewSet(NewConfig)
+`
+	const fooGo = `package foo
+
+import (
+	"example.com/config"
+	"github.com/google/wire"
+)
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+func NewFoo() *Foo { return new(Foo) }
+
+type Server struct{ Name string }
+
+var (
+	FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))
+	notASet = 42
+)
+
+var ServerSet = wire.NewSet(
+	config.Set,
+	wire.FieldsOf(new(*config.Config), "Name"),
+	wire.NewSet(wire.Value(42), wire.InterfaceValue(new(Fooer), &Foo{})),
+	wire.Requires(new(Fooer)),
+	wire.Struct(new(Server), "*"),
+)
+
+func initServer() *Server {
+	wire.Build(ServerSet)
+	return nil
+}
+
+func notAnInjector() {}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go":   []byte(configGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	// describe formats items as indented lines of kind, name, detail and
+	// the source they delimit.
+	var describe func(items []*OutlineItem, indent string) []string
+	describe = func(items []*OutlineItem, indent string) []string {
+		var lines []string
+		for _, item := range items {
+			src := fooGo[file.Offset(item.Pos):file.Offset(item.End)]
+			if i := strings.Index(src, "\n"); i >= 0 {
+				src = src[:i] + "..."
+			}
+			lines = append(lines, fmt.Sprintf("%s%s %s [%s] %s", indent, item.Kind, item.Name, item.Detail, src))
+			if item.Kind == OutlineProviderSet || item.Kind == OutlineInjector {
+				if lp, rp := file.Offset(item.Lparen), file.Offset(item.Rparen); fooGo[lp] != '(' || fooGo[rp] != ')' {
+					t.Errorf("%s: parentheses at %q and %q", item.Name, fooGo[lp], fooGo[rp])
+				}
+			}
+			lines = append(lines, describe(item.Children, indent+"\t")...)
+		}
+		return lines
+	}
+	got := describe(Outline(pkg, file.Name()), "")
+	want := []string{
+		"provider set FooSet [wire.ProviderSet] FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))",
+		"\tprovider NewFoo [func() *Foo] NewFoo",
+		"\tbinding Fooer = *Foo [] wire.Bind(new(Fooer), new(*Foo))",
+		"provider set ServerSet [wire.ProviderSet] var ServerSet = wire.NewSet(...",
+		"\timport config.Set [] config.Set",
+		"\tfields *config.Config [] wire.FieldsOf(new(*config.Config), \"Name\")",
+		"\tprovider set wire.NewSet [] wire.NewSet(wire.Value(42), wire.InterfaceValue(new(Fooer), &Foo{}))",
+		"\t\tvalue int [] wire.Value(42)",
+		"\t\tvalue Fooer [] wire.InterfaceValue(new(Fooer), &Foo{})",
+		"\tstruct Server [] wire.Struct(new(Server), \"*\")",
+		"injector initServer [func() *Server] func initServer() *Server {...",
+		"\timport ServerSet [] ServerSet",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Outline diff (-want +got):\n%s", diff)
+	}
+	if items := Outline(pkg, filepath.Join(wd, "foo", "missing.go")); items != nil {
+		t.Errorf("Outline(missing.go) = %v; want nil", items)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package foo
+
+import "github.com/google/wire"
+
+type Logger struct{}
+
+type Server struct{}
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewServer(l *Logger) *Server { return new(Server) }
+
+func NewFoo() *Foo { return new(Foo) }
+
+var FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))
+
+func initServer() *Server {
+	wire.Build(NewLogger, NewServer, FooSet)
+	return nil
+}
+
+func initMissing() *Server {
+	wire.Build(NewServer, wire.Struct(new(Foo)))
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	var got []string
+	for _, tok := range SemanticTokens(pkg, file.Name()) {
+		pos := file.Position(tok.Pos)
+		s := fmt.Sprintf("%d:%d %s %s", pos.Line, pos.Column, fooGo[pos.Offset:pos.Offset+tok.Len], tok.Kind)
+		if tok.Unused {
+			s += " unused"
+		}
+		if tok.Missing {
+			s += " missing"
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"21:19 NewSet directive",
+		"21:26 NewFoo provider",
+		"21:39 Bind directive",
+		"21:48 Fooer type",
+		"21:61 Foo type",
+		"24:7 Build directive",
+		"24:13 NewLogger provider",
+		"24:24 NewServer provider",
+		"24:35 FooSet provider set unused",
+		"29:7 Build directive",
+		"29:13 NewServer provider missing",
+		"29:29 Struct directive",
+		"29:40 Foo type",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("SemanticTokens diff (-want +got):\n%s", diff)
+	}
+	if toks := SemanticTokens(pkg, filepath.Join(wd, "foo", "missing.go")); toks != nil {
+		t.Errorf("SemanticTokens(missing.go) = %v; want nil", toks)
+	}
+}
+
+func TestInlayHints(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const configGo = `package config
+
+import "github.com/google/wire"
+
+type Config struct{ Name string }
+
+func NewConfig() *Config { return new(Config) }
+
+var Set = wire.NewSet(NewConfig)
+`
+	const fooGo = `package foo
+
+import (
+	"example.com/config"
+	"github.com/google/wire"
+)
+
+type Fooer interface{ Foo() }
+
+type Foo struct{}
+
+func (*Foo) Foo() {}
+
+func NewFoo() *Foo { return new(Foo) }
+
+type Server struct {
+	Name  string
+	Fooer Fooer
+}
+
+var FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer), new(*Foo)))
+
+func initServer() Server {
+	wire.Build(
+		config.Set,
+		FooSet,
+		wire.FieldsOf(new(*config.Config), "Name"),
+		wire.Struct(new(Server), "*"),
+		wire.Value(42),
+	)
+	return Server{}
+}
+
+func initInvalid() *Foo {
+	wire.Build(NewFoo, NewFoo)
+	return nil
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go":   []byte(configGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	// Each hint is shown with the line it follows.
+	var got []string
+	for _, hint := range InlayHints(pkg, file.Name()) {
+		offset := file.Offset(hint.Pos)
+		start := strings.LastIndex(fooGo[:offset], "\n") + 1
+		got = append(got, strings.TrimSpace(fooGo[start:offset])+hint.Label)
+	}
+	want := []string{
+		"var FooSet = wire.NewSet(NewFoo, wire.Bind(new(Fooer): *Foo",
+		"config.Set: *config.Config",
+		"FooSet: *Foo, Fooer",
+		`wire.FieldsOf(new(*config.Config), "Name"): string, *string`,
+		`wire.Struct(new(Server), "*"): Server, *Server`,
+		"wire.Value(42): int",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("InlayHints diff (-want +got):\n%s", diff)
+	}
+	if hints := InlayHints(pkg, filepath.Join(wd, "foo", "missing.go")); hints != nil {
+		t.Errorf("InlayHints(missing.go) = %v; want nil", hints)
+	}
+}
+
+func TestHierarchy(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const configGo = `package config
+
+type Config struct{ Name string }
+
+func NewConfig() *Config { return new(Config) }
+`
+	const fooGo = `package foo
+
+import (
+	"example.com/config"
+	"github.com/google/wire"
+)
+
+type Logger struct{ Name string }
+
+func NewLogger(c *config.Config) *Logger { return &Logger{Name: c.Name} }
+
+type Server struct {
+	Logger *Logger
+	Port   int
+}
+
+func NewServer(l *Logger, port int) *Server { return &Server{Logger: l, Port: port} }
+
+func initServer() *Server {
+	wire.Build(config.NewConfig, NewLogger, NewServer, wire.Value(8080))
+	return nil
+}
+
+func initLogger(c *config.Config) *Logger {
+	wire.Build(NewLogger)
+	return nil
+}
+
+func unused() {}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/config/config.go":   []byte(configGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	pkgs, errs := LoadPackages(context.Background(), wd, env, "", []string{"example.com/foo"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	pkg := pkgs[0]
+	file := pkg.Fset.File(pkg.Syntax[0].Pos())
+
+	describe := func(items []*HierarchyItem) []string {
+		var lines []string
+		for _, item := range items {
+			lines = append(lines, fmt.Sprintf("%s %s [%s]", item.Kind, item.Name, item.Detail))
+		}
+		return lines
+	}
+	tests := []struct {
+		// at is the text following the position in foo.go.
+		at           string
+		item         string
+		dependencies []string
+		dependents   []string
+	}{
+		{
+			at:           "NewLogger, NewServer",
+			item:         "provider NewLogger [*Logger]",
+			dependencies: []string{"provider NewConfig [*config.Config]", "input c [*config.Config]"},
+			dependents:   []string{"provider NewServer [*Server]", "injector initLogger [*Logger]"},
+		},
+		{
+			at:           "NewServer(l *Logger",
+			item:         "provider NewServer [*Server]",
+			dependencies: []string{"provider NewLogger [*Logger]", "value 8080 [int]"},
+			dependents:   []string{"injector initServer [*Server]"},
+		},
+		{
+			at:           "NewConfig, NewLogger",
+			item:         "provider NewConfig [*config.Config]",
+			dependencies: nil,
+			dependents:   []string{"provider NewLogger [*Logger]"},
+		},
+		{
+			at:           "initServer()",
+			item:         "injector initServer [*Server]",
+			dependencies: []string{"provider NewServer [*Server]"},
+			dependents:   nil,
+		},
+		{at: "unused()", item: ""},
+		{at: "Logger struct", item: ""},
+	}
+	for _, test := range tests {
+		offset := strings.Index(fooGo, test.at)
+		if offset < 0 {
+			t.Fatalf("%q not found", test.at)
+		}
+		item := HierarchyItemAt(pkg, file.Pos(offset))
+		if test.item == "" {
+			if item != nil {
+				t.Errorf("HierarchyItemAt(%q) = %v; want nil", test.at, item)
+			}
+			continue
+		}
+		if item == nil {
+			t.Errorf("HierarchyItemAt(%q) = nil; want %s", test.at, test.item)
+			continue
+		}
+		if got := describe([]*HierarchyItem{item})[0]; got != test.item {
+			t.Errorf("HierarchyItemAt(%q) = %s; want %s", test.at, got, test.item)
+		}
+		if diff := cmp.Diff(test.dependencies, describe(Dependencies(pkg, item))); diff != "" {
+			t.Errorf("Dependencies(%s) diff (-want +got):\n%s", test.item, diff)
+		}
+		if diff := cmp.Diff(test.dependents, describe(Dependents(pkg, item))); diff != "" {
+			t.Errorf("Dependents(%s) diff (-want +got):\n%s", test.item, diff)
+		}
+	}
+}
+
+func TestFindReferences(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const depGo = `package dep
+
+import "github.com/google/wire"
+
+type Config struct{ Name string }
+
+func NewConfig() *Config { return new(Config) }
+
+var Set = wire.NewSet(NewConfig, wire.Struct(new(Config)))
+
+var FieldSet = wire.NewSet(wire.Struct(new(Config), "Name"), wire.FieldsOf(new(*Config), "Name"))
+`
+	const fooGo = `package main
+
+import (
+	"example.com/dep"
+	"github.com/google/wire"
+)
+
+var FooSet = wire.NewSet(dep.Set, dep.NewConfig, wire.NewSet(dep.NewConfig))
+
+func main() { dep.NewConfig() }
+`
+	// wire_gen.go has no build constraint here, so only its name excludes it.
+	const genGo = `package gen
+
+import (
+	"example.com/dep"
+	"github.com/google/wire"
+)
+
+var GenSet = wire.NewSet(dep.NewConfig)
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/dep/dep.go":         []byte(depGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+			"example.com/gen/wire_gen.go":    []byte(genGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	pkgs, errs := LoadPackages(ctx, wd, env, "", []string{"example.com/dep"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	scope := pkgs[0].Types.Scope()
+	depPath := filepath.Join(wd, "dep", "dep.go")
+	fooPath := filepath.Join(wd, "foo", "foo.go")
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		// The call in main is not a reference, and the nested set is only
+		// visited once.
+		{"NewConfig", []string{depPath + ":9:23", fooPath + ":8:39", fooPath + ":8:66"}},
+		{"Config", []string{depPath + ":9:50", depPath + ":11:44", depPath + ":11:81"}},
+		{"Set", []string{fooPath + ":8:30"}},
+	}
+	for _, test := range tests {
+		refs, errs := FindReferences(ctx, wd, env, "", scope.Lookup(test.name))
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var got []string
+		for _, ref := range refs {
+			got = append(got, ref.String())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("FindReferences(%s) diff (-want +got):\n%s", test.name, diff)
+		}
+	}
+
+	// The references of a field are its names in wire.Struct and
+	// wire.FieldsOf calls on the struct.
+	field := scope.Lookup("Config").Type().Underlying().(*types.Struct).Field(0)
+	refs, errs := FindReferences(ctx, wd, env, "", field)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var got []string
+	for _, ref := range refs {
+		got = append(got, ref.String())
+	}
+	want := []string{depPath + ":11:54", depPath + ":11:91"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("FindReferences(Config.Name) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRenameProviderSet(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const depGo = `package dep
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+var Set = wire.NewSet(NewConfig)
+
+var Other = wire.NewSet(Set)
+
+func useSet() wire.ProviderSet {
+	local := 1
+	_ = local
+	return Set
+}
+`
+	const fooGo = `package main
+
+import (
+	"example.com/dep"
+	"github.com/google/wire"
+)
+
+var FooSet = wire.NewSet(dep.Set)
+
+func main() {}
+`
+	const depTestGo = `package dep
+
+var inTest = Set
+`
+	const extTestGo = `package dep_test
+
+import "example.com/dep"
+
+var _ = dep.Set
+`
+	const barGo = `package bar
+
+import "github.com/google/wire"
+
+var Set = wire.NewSet()
+`
+	const barIgnoredGo = `// +build ignore
+
+package bar
+
+var _ = Set
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/dep/dep.go":         []byte(depGo),
+			"example.com/dep/dep_test.go":    []byte(depTestGo),
+			"example.com/dep/ext_test.go":    []byte(extTestGo),
+			"example.com/foo/foo.go":         []byte(fooGo),
+			"example.com/bar/bar.go":         []byte(barGo),
+			"example.com/bar/bar_ignored.go": []byte(barIgnoredGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	pkgs, errs := LoadPackages(ctx, wd, env, "", []string{"example.com/dep", "example.com/bar"})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	scope := pkgs[0].Types.Scope()
+	depPath := filepath.Join(wd, "dep", "dep.go")
+	depTestPath := filepath.Join(wd, "dep", "dep_test.go")
+	extTestPath := filepath.Join(wd, "dep", "ext_test.go")
+	fooPath := filepath.Join(wd, "foo", "foo.go")
+
+	tests := []struct {
+		scope   *types.Scope
+		obj     string
+		name    string
+		want    []string
+		wantErr string
+	}{
+		// The declaration and the references outside wire calls and in
+		// tests are renamed too.
+		{obj: "Set", name: "ConfigSet", want: []string{depPath + ":9:5", depPath + ":11:25", depPath + ":16:9", depTestPath + ":3:14", extTestPath + ":5:13", fooPath + ":8:30"}},
+		{obj: "Set", name: "Other", wantErr: "would conflict with Other"},
+		{obj: "Set", name: "inTest", wantErr: "would conflict with inTest"},
+		{obj: "Set", name: "local", wantErr: "would conflict with local"},
+		{obj: "Set", name: "set", wantErr: "inaccessible from example.com/foo"},
+		{obj: "Set", name: "func", wantErr: "not a valid identifier"},
+		{obj: "NewConfig", name: "NewSettings", wantErr: "not a top-level provider set"},
+		{scope: pkgs[1].Types.Scope(), obj: "Set", name: "BarSet", wantErr: "excluded by build constraints and may refer to Set"},
+	}
+	for _, test := range tests {
+		if test.scope == nil {
+			test.scope = scope
+		}
+		refs, errs := RenameProviderSet(ctx, wd, env, "", test.scope.Lookup(test.obj), test.name, nil)
+		if test.wantErr != "" {
+			// The packages, and so the errors, are in no particular order.
+			if !strings.Contains(fmt.Sprint(errs), test.wantErr) {
+				t.Errorf("RenameProviderSet(%s, %q) = %v; want an error containing %q", test.obj, test.name, errs, test.wantErr)
+			}
+			continue
+		}
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var got []string
+		for _, ref := range refs {
+			got = append(got, ref.String())
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("RenameProviderSet(%s, %q) diff (-want +got):\n%s", test.obj, test.name, diff)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package main
+
+import "github.com/google/wire"
+
+type Store interface{ Get() string }
+
+type DB struct{}
+
+func (*DB) Get() string { return "" }
+
+func NewDB() *DB { return new(DB) }
+
+type Config struct{ Name string }
+
+type Server struct{}
+
+func NewServer(s Store, cfg Config) *Server { return new(Server) }
+
+var DBSet = wire.NewSet(NewDB, wire.Bind(new(Store), new(*DB)))
+
+var AppSet = wire.NewSet(DBSet, NewServer)
+
+func main() {}
+`
+	const wireGoSrc = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(AppSet, wire.Value(Config{}))
+	return nil
+}
+
+func initDB() *DB {
+	wire.Build(NewDB)
+	return nil
+}
+
+func initConfig() Config {
+	wire.Build(wire.Value(Config{Name: "config"}))
+	return Config{}
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go":         []byte(fooGo),
+			"example.com/foo/wire.go":        []byte(wireGoSrc),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+
+	const (
+		initConfig = `"example.com/foo".initConfig`
+		initDB     = `"example.com/foo".initDB`
+		initServer = `"example.com/foo".initServer`
+	)
+	chain := []string{`"example.com/foo".AppSet`, `"example.com/foo".DBSet`}
+	tests := []struct {
+		target string
+		// want maps the injectors using target to their matches, without
+		// their positions.
+		want map[string][]*UsageMatch
+	}{
+		{
+			target: "NewDB",
+			want: map[string][]*UsageMatch{
+				initDB: {{Kind: "provider", Name: "example.com/foo.NewDB", Type: "*example.com/foo.DB", Sets: []string{}}},
+				initServer: {{
+					Kind:    "provider",
+					Name:    "example.com/foo.NewDB",
+					Type:    "*example.com/foo.DB",
+					BoundTo: []string{"example.com/foo.Store"},
+					Sets:    chain,
+				}},
+			},
+		},
+		{
+			target: "example.com/foo.NewServer",
+			want: map[string][]*UsageMatch{
+				initServer: {{Kind: "provider", Name: "example.com/foo.NewServer", Type: "*example.com/foo.Server", Sets: chain[:1]}},
+			},
+		},
+		{
+			target: "example.com/foo.Store",
+			want: map[string][]*UsageMatch{
+				initServer: {{Kind: "binding", Type: "example.com/foo.Store", Impl: "*example.com/foo.DB", Sets: chain}},
+			},
+		},
+		{
+			target: "example.com/foo.Config",
+			want: map[string][]*UsageMatch{
+				initConfig: {{Kind: "value", Type: "example.com/foo.Config", Sets: []string{}}},
+				initServer: {{Kind: "value", Type: "example.com/foo.Config", Sets: []string{}}},
+			},
+		},
+		{
+			target: "NewCache",
+			want:   map[string][]*UsageMatch{},
+		},
+	}
+	for _, test := range tests {
+		report, errs := Usage(context.Background(), wd, env, []string{"example.com/foo"}, "", test.target)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if len(report.Injectors) != 3 {
+			t.Fatalf("Usage(%s) reported %d injectors; want 3", test.target, len(report.Injectors))
+		}
+		got := make(map[string][]*UsageMatch)
+		for _, iu := range report.Injectors {
+			if len(iu.Matches) == 0 {
+				continue
+			}
+			for _, m := range iu.Matches {
+				if !strings.Contains(m.Position, "example.com/foo/") {
+					t.Errorf("Usage(%s) reported %s at %s; want a position in example.com/foo", test.target, m.Kind, m.Position)
+				}
+				m.Position = ""
+			}
+			got[iu.Injector] = iu.Matches
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Usage(%s) diff (-want +got):\n%s", test.target, diff)
+		}
+		if report.Used() != len(test.want) {
+			t.Errorf("Usage(%s).Used() = %d; want %d", test.target, report.Used(), len(test.want))
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const fooGo = `package main
+
+type Foo int
+
+func provideFoo() Foo { return 42 }
+
+func main() {}
+`
+	const injectGo = `//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+`
+	const genGo = `// Code generated by Wire. DO NOT EDIT.
+
+//go:generate go run -mod=mod github.com/google/wire/cmd/wire
+//+build !wireinject
+
+package main
+
+// Injectors from wire.go:
+
+func injectFoo() Foo {
+	foo := provideFoo()
+	return foo
+}
+`
+	// ok is generated below. mismatch declares a parameter its generated
+	// implementation lacks. stale has the right signature but not the
+	// right body.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go":   wireGo,
+			"example.com/ok/foo.go":            []byte(fooGo),
+			"example.com/ok/wire.go":           []byte(injectGo),
+			"example.com/missing/foo.go":       []byte(fooGo),
+			"example.com/missing/wire.go":      []byte(injectGo),
+			"example.com/stale/foo.go":         []byte(fooGo),
+			"example.com/stale/wire.go":        []byte(injectGo),
+			"example.com/stale/wire_gen.go":    []byte(strings.Replace(genGo, "return foo", "return foo + 1", 1)),
+			"example.com/mismatch/foo.go":      []byte(fooGo),
+			"example.com/mismatch/wire.go":     []byte(strings.Replace(injectGo, "injectFoo()", "injectFoo(n int)", 1)),
+			"example.com/mismatch/wire_gen.go": []byte(genGo),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	gens, errs := Generate(ctx, wd, env, []string{"example.com/ok"}, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := gens[0].Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// The declaration changed after the file was generated.
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(wd, "mismatch", "wire_gen.go"), past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatches, errs := CheckSignatures(ctx, wd, env, "", []string{"./..."})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var got []string
+	for _, m := range mismatches {
+		got = append(got, scrubError(gopath, m.Error()))
+	}
+	want := []string{"example.com/mismatch/wire.go:x:y: inject injectFoo: signature mismatch: " +
+		"declared as func(int) Foo but generated as func() Foo (example.com/mismatch/wire_gen.go:x:y); " +
+		"the declaration is newer, regenerate"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("CheckSignatures(...) diff (-want +got):\n%s", diff)
+	}
+
+	statuses, errs := Status(ctx, wd, env, []string{"./..."}, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	gotStates := make(map[string]string)
+	for _, st := range statuses {
+		gotStates[st.PkgPath] = st.State
+	}
+	wantStates := map[string]string{
+		"example.com/ok":       StatusUpToDate,
+		"example.com/missing":  StatusNotGenerated,
+		"example.com/stale":    StatusStale,
+		"example.com/mismatch": StatusSignatureMismatch,
+	}
+	if diff := cmp.Diff(wantStates, gotStates); diff != "" {
+		t.Errorf("Status(...) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestDumpReplay(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// extra.go and store/other.go declare nothing the injectors use, so
+	// they are dropped from the snapshot together with example.com/unused.
+	// broken has an injector missing a provider.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/app/app.go": []byte(`package main
+
+import "example.com/store"
+
+type App struct{ db *store.DB }
+
+func NewApp(db *store.DB) *App { return &App{db: db} }
+
+func main() {}
+`),
+			"example.com/app/extra.go": []byte(`package main
+
+import "example.com/unused"
+
+func extra() string { return unused.Name() }
+`),
+			"example.com/app/wire.go": []byte(`//+build wireinject
+
+package main
+
+import (
+	"example.com/store"
+	"github.com/google/wire"
+)
+
+func injectApp() *App {
+	wire.Build(store.Set, NewApp)
+	return nil
+}
+`),
+			"example.com/store/store.go": []byte(`package store
+
+import "github.com/google/wire"
+
+type Config struct {
+	DSN    string
+	secret string ` + "`wire:\"-\"`" + `
+}
+
+type DB struct{ cfg *Config }
+
+func NewConfig() *Config { return &Config{DSN: "postgres://admin:hunter2@db"} }
+
+func NewDB(cfg *Config) *DB { return &DB{cfg: cfg} }
+
+var Set = wire.NewSet(NewConfig, NewDB)
+`),
+			"example.com/store/other.go": []byte(`package store
+
+func Other() {}
+`),
+			"example.com/unused/unused.go": []byte(`package unused
+
+func Name() string { return "unused" }
+`),
+			"example.com/broken/broken.go": []byte(`package main
+
+type Foo int
+
+func main() {}
+`),
+			"example.com/broken/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFoo() Foo {
+	wire.Build()
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		pattern  string
+		injector string
+		redact   bool
+		// want holds the files of the snapshot.
+		want []string
+		// wantOutput is a substring of the recorded output, or of the first
+		// error if empty.
+		wantOutput string
+		wantError  string
+	}{
+		{
+			name:    "Generate",
+			pattern: "example.com/app",
+			want: []string{
+				"example.com/app/app.go",
+				"example.com/app/wire.go",
+				"example.com/go.mod",
+				"example.com/store/store.go",
+				"github.com/google/wire/go.mod",
+				"github.com/google/wire/wire.go",
+			},
+			wantOutput: "func injectApp() *App {",
+		},
+		{
+			name:     "GraphRedacted",
+			pattern:  "example.com/app",
+			injector: "injectApp",
+			redact:   true,
+			want: []string{
+				"example.com/app/app.go",
+				"example.com/app/wire.go",
+				"example.com/go.mod",
+				"example.com/store/store.go",
+				"github.com/google/wire/go.mod",
+				"github.com/google/wire/wire.go",
+			},
+			wantOutput: "digraph",
+		},
+		{
+			name:    "Errors",
+			pattern: "example.com/broken",
+			want: []string{
+				"example.com/broken/broken.go",
+				"example.com/broken/wire.go",
+				"example.com/go.mod",
+				"github.com/google/wire/go.mod",
+				"github.com/google/wire/wire.go",
+			},
+			wantError: "example.com/broken/wire.go:",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, errs := Dump(ctx, wd, env, "", test.pattern, test.injector, test.redact)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var got []string
+			for p := range s.Files {
+				got = append(got, p)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("Dump(...) files diff (-want +got):\n%s", diff)
+			}
+			if !s.Manifest.Minimized {
+				t.Error("Dump(...) did not minimize the snapshot")
+			}
+			result := s.Manifest.Result
+			switch {
+			case test.wantOutput != "" && !strings.Contains(result.Output, test.wantOutput):
+				t.Errorf("Dump(...) output = %q; want it to contain %q", result.Output, test.wantOutput)
+			case test.wantError != "" && (len(result.Errors) == 0 || !strings.HasPrefix(result.Errors[0], test.wantError)):
+				t.Errorf("Dump(...) errors = %q; want the first to start with %q", result.Errors, test.wantError)
+			}
+			storeGo := string(s.Files["example.com/store/store.go"])
+			if test.redact && (strings.Contains(storeGo, "hunter2") || !strings.Contains(storeGo, "`wire:\"-\"`")) {
+				t.Errorf("redacted store.go:\n%s", storeGo)
+			}
+
+			// Replay from the archive in a directory of its own.
+			dir, err := ioutil.TempDir("", "wire_test_replay")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			archive := filepath.Join(dir, "state.zip")
+			var buf bytes.Buffer
+			if err := s.WriteZip(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(archive, buf.Bytes(), 0666); err != nil {
+				t.Fatal(err)
+			}
+			read, err := ReadSnapshot(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			replayed, errs := Replay(ctx, env, read, filepath.Join(dir, "src"))
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if diff := cmp.Diff(result, replayed); diff != "" {
+				t.Errorf("Replay(...) diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Budgets
+		wantErr bool
+	}{
+		{name: "Empty"},
+		{
+			name: "Budgets",
+			data: "# guardrails\n[budgets]\nmaxDepth = 5\nmaxFanIn = 3 # per type\nmaxFanOut = 4\nmaxProvidersPerInjector = 20\n",
+			want: Budgets{MaxDepth: 5, MaxFanIn: 3, MaxFanOut: 4, MaxProvidersPerInjector: 20},
+		},
+		{
+			name: "PartialBudgets",
+			data: "[budgets]\nmaxDepth = 5\n",
+			want: Budgets{MaxDepth: 5},
+		},
+		{
+			name: "OtherSection",
+			data: "[other]\nmaxDepth = \"x\"\n",
+		},
+		{
+			name:    "UnknownBudget",
+			data:    "[budgets]\nmaxWidth = 5\n",
+			wantErr: true,
+		},
+		{
+			name:    "InvalidValue",
+			data:    "[budgets]\nmaxDepth = -1\n",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(test.data))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("ParseConfig succeeded; want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Budgets != test.want {
+				t.Errorf("ParseConfig(...).Budgets = %+v; want %+v", cfg.Budgets, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyBuild(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// provideFoo has a different signature outside of the wireinject build,
+	// so the generated call to provideFooBar does not compile.
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+type Foo int
+type FooBar int
+
+func provideFooBar(foo Foo) FooBar { return FooBar(foo) }
+
+func main() {}
+`),
+			"example.com/foo/provide_inject.go": []byte(`//+build wireinject
+
+package main
+
+func provideFoo() Foo { return 41 }
+`),
+			"example.com/foo/provide.go": []byte(`//+build !wireinject
+
+package main
+
+func provideFoo() string { return "foo" }
+
+var preExisting int = "foo"
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package main
+
+import "github.com/google/wire"
+
+func injectFooBar() FooBar {
+	wire.Build(provideFoo, provideFooBar)
+	return 0
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+
+	ctx := context.Background()
+	outs, errs := Generate(ctx, wd, env, []string{"example.com/foo"}, nil)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	for _, out := range outs {
+		if len(out.Errs) > 0 {
+			t.Fatal(out.Errs)
+		}
+		if err := out.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buildErrs, errs := VerifyBuild(ctx, wd, env, "", outs)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	type result struct {
+		File      string
+		Generated bool
+		Injector  string
+		Provider  string
+	}
+	var got []result
+	for _, e := range buildErrs {
+		t.Log(e)
+		got = append(got, result{filepath.Base(e.Pos.Filename), e.Generated, e.Injector, e.Provider})
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].File < got[j].File })
+	want := []result{
+		{File: "provide.go"},
+		{File: "wire_gen.go", Generated: true, Injector: "injectFooBar", Provider: "provideFooBar"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("VerifyBuild(...) diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGenerateSelectedInjectors(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wireInject = `//+build wireinject
+
+package main
+
+import (
+	"example.com/foo/bar"
+	"github.com/google/wire"
+)
+
+func injectFoo() Foo {
+	wire.Build(provideFoo)
+	return 0
+}
+
+func injectBaz() Baz {
+	wire.Build(provideBaz, wire.Value(bar.Bar(2)))
+	return 0
+}
+`
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package main
+
+import "example.com/foo/bar"
+
+type Foo int
+type Baz int
+
+func provideFoo() Foo        { return 41 }
+func provideOtherFoo() Foo   { return 42 }
+func provideBaz(b bar.Bar) Baz { return Baz(b) }
+
+func main() {}
+`),
+			"example.com/foo/bar/bar.go": []byte("package bar\n\ntype Bar int\n"),
+			"example.com/foo/wire.go":    []byte(wireInject),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	generate := func(opts *GenerateOptions) GenerateResult {
+		t.Helper()
+		gens, errs := Generate(ctx, wd, env, []string{"example.com/foo"}, opts)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		if len(gens) != 1 {
+			t.Fatalf("Generate(...) returned %d results; want 1", len(gens))
+		}
+		return gens[0]
+	}
+
+	// Generate both injectors into the prefixed output file.
+	first := generate(&GenerateOptions{PrefixOutputFile: "prefix_"})
+	if len(first.Errs) > 0 {
+		t.Fatal(first.Errs)
+	}
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	wantBaz, err := InjectorSource(first.Content, "injectBaz")
+	if err != nil || wantBaz == nil {
+		t.Fatalf("InjectorSource(first output, injectBaz) = %q, %v", wantBaz, err)
+	}
+
+	// Change injectFoo and break injectBaz.
+	broken := strings.Replace(wireInject, "wire.Build(provideFoo)", "wire.Build(provideOtherFoo)", 1)
+	broken = strings.Replace(broken, "wire.Build(provideBaz, wire.Value(bar.Bar(2)))", "wire.Build(provideBaz)", 1)
+	broken = strings.Replace(broken, "\t\"example.com/foo/bar\"\n", "", 1)
+	if err := ioutil.WriteFile(filepath.Join(wd, "foo", "wire.go"), []byte(broken), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if all := generate(nil); len(all.Errs) == 0 {
+		t.Fatal("Generate(...) of both injectors succeeded; want an error for injectBaz")
+	}
+
+	// Regenerating injectFoo keeps injectBaz from the prefixed file, along
+	// with the value and import it uses.
+	got := generate(&GenerateOptions{PrefixOutputFile: "prefix_", Injectors: []string{"injectFoo"}})
+	if len(got.Errs) > 0 {
+		t.Fatal(got.Errs)
+	}
+	for _, want := range []string{"provideOtherFoo()", string(wantBaz), "_wireBarValue = bar.Bar(2)", `"example.com/foo/bar"`} {
+		if !strings.Contains(string(got.Content), want) {
+			t.Errorf("Generate(...) with injectFoo selected = \n%s\nwant it to contain %q", got.Content, want)
+		}
+	}
+
+	// Without the prefix, there is no existing output to keep injectBaz from.
+	got = generate(&GenerateOptions{Injectors: []string{"injectFoo"}})
+	if len(got.Errs) > 0 {
+		t.Fatal(got.Errs)
+	}
+	if strings.Contains(string(got.Content), "injectBaz") {
+		t.Errorf("Generate(...) without an existing output = \n%s\nwant no injectBaz", got.Content)
+	}
+
+	_, errs := Generate(ctx, wd, env, []string{"example.com/foo"}, &GenerateOptions{Injectors: []string{"injectBar"}})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "available injectors: injectBaz, injectFoo") {
+		t.Errorf("Generate(...) with an unknown injector returned %v; want an error listing the injectors", errs)
+	}
+}
+
+func TestInjectorSource(t *testing.T) {
+	const src = `package main
+
+// initFoo is an injector.
+func initFoo() Foo {
+	foo := provideFoo()
+	return foo
+}
+
+func (b *Bar) initFoo() Foo {
+	return Foo{}
+}
+
+func initBar() Bar {
+	return Bar{}
+}
+`
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"initFoo", "// initFoo is an injector.\nfunc initFoo() Foo {\n\tfoo := provideFoo()\n\treturn foo\n}\n"},
+		{"initBar", "func initBar() Bar {\n\treturn Bar{}\n}\n"},
+		{"initBaz", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := InjectorSource([]byte(src), test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("InjectorSource(src, %q) = %q; want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestScanFile(t *testing.T) {
+	const src = `package main
+
+import w "github.com/google/wire"
+
+var (
+	Set         = w.NewSet(provideFoo)
+	other, Pair = 42, (w.NewSet(Set))
+)
+
+var _ = w.NewSet(Set)
+
+func initFoo() Foo {
+	panic(w.Build(Set))
+}
+
+func (b *Bar) initFoo() Foo {
+	w.Build(Set)
+	return Foo{}
+}
+
+func provideFoo() Foo {
+	return Foo{}
+}
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "wire.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range ScanFile(f) {
+		got = append(got, fmt.Sprintf("%s %v %v", d.Name, d.Injector, fset.Position(d.Pos)))
+	}
+	want := []string{
+		"Set false wire.go:6:16",
+		"Pair false wire.go:7:21",
+		"initFoo true wire.go:12:1",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ScanFile (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnexport(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"a", "a"},
+		{"ab", "ab"},
+		{"A", "a"},
+		{"AB", "ab"},
+		{"A_", "a_"},
+		{"ABc", "aBc"},
+		{"ABC", "abc"},
+		{"AB_", "ab_"},
+		{"foo", "foo"},
+		{"Foo", "foo"},
+		{"HTTPClient", "httpClient"},
+		{"IFace", "iFace"},
+		{"SNAKE_CASE", "snake_CASE"},
+		{"HTTP", "http"},
+	}
+	for _, test := range tests {
+		if got := unexport(test.name); got != test.want {
+			t.Errorf("unexport(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", ""},
+		{"a", "A"},
+		{"ab", "Ab"},
+		{"A", "A"},
+		{"AB", "AB"},
+		{"A_", "A_"},
+		{"ABc", "ABc"},
+		{"ABC", "ABC"},
+		{"AB_", "AB_"},
+		{"foo", "Foo"},
+		{"Foo", "Foo"},
+		{"HTTPClient", "HTTPClient"},
+		{"httpClient", "HttpClient"},
+		{"IFace", "IFace"},
+		{"iFace", "IFace"},
+		{"SNAKE_CASE", "SNAKE_CASE"},
+		{"HTTP", "HTTP"},
+	}
+	for _, test := range tests {
+		if got := export(test.name); got != test.want {
+			t.Errorf("export(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTypeVariableName(t *testing.T) {
+	var (
+		boolT           = types.Typ[types.Bool]
+		stringT         = types.Typ[types.String]
+		fooVarT         = types.NewNamed(types.NewTypeName(0, nil, "foo", stringT), stringT, nil)
+		nonameVarT      = types.NewNamed(types.NewTypeName(0, nil, "", stringT), stringT, nil)
+		barVarInFooPkgT = types.NewNamed(types.NewTypeName(0, types.NewPackage("my.example/foo", "foo"), "bar", stringT), stringT, nil)
+	)
+	tests := []struct {
+		description     string
+		typ             types.Type
+		defaultName     string
+		transformAppend string
+		collides        map[string]bool
+		want            string
+	}{
+		{"basic type", boolT, "", "", map[string]bool{}, "bool"},
+		{"basic type with transform", boolT, "", "suffix", map[string]bool{}, "boolsuffix"},
+		{"basic type with collision", boolT, "", "", map[string]bool{"bool": true}, "bool2"},
+		{"basic type with transform and collision", boolT, "", "suffix", map[string]bool{"boolsuffix": true}, "boolsuffix2"},
+		{"a different basic type", stringT, "", "", map[string]bool{}, "string"},
+		{"named type", fooVarT, "", "", map[string]bool{}, "foo"},
+		{"named type with transform", fooVarT, "", "suffix", map[string]bool{}, "foosuffix"},
+		{"named type with collision", fooVarT, "", "", map[string]bool{"foo": true}, "foo2"},
+		{"named type with transform and collision", fooVarT, "", "suffix", map[string]bool{"foosuffix": true}, "foosuffix2"},
+		{"noname type", nonameVarT, "bar", "", map[string]bool{}, "bar"},
+		{"noname type with transform", nonameVarT, "bar", "s", map[string]bool{}, "bars"},
+		{"noname type with transform and collision", nonameVarT, "bar", "s", map[string]bool{"bars": true}, "bars2"},
+		{"var in pkg type", barVarInFooPkgT, "", "", map[string]bool{}, "bar"},
+		{"var in pkg type with collision", barVarInFooPkgT, "", "", map[string]bool{"bar": true}, "fooBar"},
+		{"var in pkg type with double collision", barVarInFooPkgT, "", "", map[string]bool{"bar": true, "fooBar": true}, "bar2"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s: typeVariableName(%v, %q, %q, %v)", test.description, test.typ, test.defaultName, test.transformAppend, test.collides), func(t *testing.T) {
+			got := typeVariableName(test.typ, test.defaultName, func(name string) string { return name + test.transformAppend }, func(name string) bool { return test.collides[name] })
+			if !isIdent(got) {
+				t.Errorf("%q is not an identifier", got)
+			}
+			if got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+			if test.collides[got] {
+				t.Errorf("%q collides", got)
+			}
+		})
+	}
+}
+
+func TestDisambiguate(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     string
+		collides map[string]bool
+	}{
+		{"foo", "foo", nil},
+		{"foo", "foo2", map[string]bool{"foo": true}},
+		{"foo", "foo3", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
+		{"foo1", "foo1_2", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
+		{"foo\u0661", "foo\u0661", map[string]bool{"foo": true, "foo1": true, "foo2": true}},
+		{"foo\u0661", "foo\u06612", map[string]bool{"foo": true, "foo1": true, "foo2": true, "foo\u0661": true}},
+		{"select", "select2", nil},
+		{"var", "var2", nil},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("disambiguate(%q, %v)", test.name, test.collides), func(t *testing.T) {
+			got := disambiguate(test.name, func(name string) bool { return test.collides[name] })
+			if !isIdent(got) {
+				t.Errorf("%q is not an identifier", got)
+			}
+			if got != test.want {
+				t.Errorf("got %q want %q", got, test.want)
+			}
+			if test.collides[got] {
+				t.Errorf("%q collides", got)
+			}
+		})
+	}
+}
+
+func isIdent(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	r, i := utf8.DecodeRuneInString(s)
+	if !unicode.IsLetter(r) && r != '_' {
+		return false
+	}
+	for i < len(s) {
+		r, sz := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return false
+		}
+		i += sz
+	}
+	return true
+}
+
+// scrubError rewrites the given string to remove occurrences of GOPATH/src,
+// rewrites OS-specific path separators to slashes, and any line/column
+// information to a fixed ":x:y". For example, if the gopath parameter is
+// "C:\GOPATH" and running on Windows, the string
+// "C:\GOPATH\src\foo\bar.go:15:4" would be rewritten to "foo/bar.go:x:y".
+func scrubError(gopath string, s string) string {
+	sb := new(strings.Builder)
+	query := gopath + string(os.PathSeparator) + "src" + string(os.PathSeparator)
+	for {
+		// Find next occurrence of source root. This indicates the next path to
+		// scrub.
+		start := strings.Index(s, query)
+		if start == -1 {
+			sb.WriteString(s)
+			break
+		}
+
+		// Find end of file name (extension ".go").
+		fileStart := start + len(query)
+		fileEnd := strings.Index(s[fileStart:], ".go")
+		if fileEnd == -1 {
+			// If no ".go" occurs to end of string, further searches will fail too.
+			// Break the loop.
+			sb.WriteString(s)
 			break
 		}
-		fileEnd += fileStart + 3 // Advance to end of extension.
+		fileEnd += fileStart + 3 // Advance to end of extension.
+
+		// Write out file name and advance scrub position.
+		file := s[fileStart:fileEnd]
+		if os.PathSeparator != '/' {
+			file = strings.Replace(file, string(os.PathSeparator), "/", -1)
+		}
+		sb.WriteString(s[:start])
+		sb.WriteString(file)
+		s = s[fileEnd:]
+
+		// Peek past to see if there is line/column info.
+		linecol, linecolLen := scrubLineColumn(s)
+		sb.WriteString(linecol)
+		s = s[linecolLen:]
+	}
+	return sb.String()
+}
+
+func scrubLineColumn(s string) (replacement string, n int) {
+	if !strings.HasPrefix(s, ":") {
+		return "", 0
+	}
+	// Skip first colon and run of digits.
+	for n++; len(s) > n && '0' <= s[n] && s[n] <= '9'; {
+		n++
+	}
+	if n == 1 {
+		// No digits followed colon.
+		return "", 0
+	}
+
+	// Start on column part.
+	if !strings.HasPrefix(s[n:], ":") {
+		return ":x", n
+	}
+	lineEnd := n
+	// Skip second colon and run of digits.
+	for n++; len(s) > n && '0' <= s[n] && s[n] <= '9'; {
+		n++
+	}
+	if n == lineEnd+1 {
+		// No digits followed second colon.
+		return ":x", lineEnd
+	}
+	return ":x:y", n
+}
+
+type testCase struct {
+	name                 string
+	pkg                  string
+	header               []byte
+	traceSpans           bool
+	emitManifest         bool
+	goFiles              map[string][]byte
+	wantProgramOutput    []byte
+	wantWireOutput       []byte
+	wantManifestOutput   []byte
+	wantWireError        bool
+	wantWireErrorStrings []string
+}
+
+// loadTestCase reads a test case from a directory.
+//
+// The directory structure is:
+//
+//	root/
+//
+//		pkg
+//			file containing the package name containing the inject function
+//			(must also be package main)
+//
+//		trace_spans
+//			if present, the injectors are generated with the TraceSpans
+//			option
+//
+//		emit_manifest
+//			if present, the manifest is generated with the EmitManifest
+//			option
+//
+//		...
+//			any Go files found recursively placed under GOPATH/src/...
+//
+//		want/
+//
+//			wire_errs.txt
+//					Expected errors from the Wire Generate function,
+//					missing if no errors expected.
+//					Distinct errors are separated by a blank line,
+//					and line numbers and line positions are scrubbed
+//					(e.g. "$GOPATH/src/foo.go:52:8" --> "foo.go:x:y").
+//
+//			wire_gen.go
+//					verified output of wire from a test run with
+//					-record, missing if wire_errs.txt is present
+//
+//			wire_manifest_gen.go
+//					verified manifest from a test run with -record,
+//					present only with emit_manifest
+//
+//			program_out.txt
+//					expected output from the final compiled program,
+//					missing if wire_errs.txt is present
+func loadTestCase(root string, wireGoSrc []byte) (*testCase, error) {
+	name := filepath.Base(root)
+	pkg, err := ioutil.ReadFile(filepath.Join(root, "pkg"))
+	if err != nil {
+		return nil, fmt.Errorf("load test case %s: %v", name, err)
+	}
+	header, _ := ioutil.ReadFile(filepath.Join(root, "header"))
+	_, err = os.Stat(filepath.Join(root, "trace_spans"))
+	traceSpans := err == nil
+	_, err = os.Stat(filepath.Join(root, "emit_manifest"))
+	emitManifest := err == nil
+	var wantProgramOutput []byte
+	var wantWireOutput []byte
+	var wantManifestOutput []byte
+	wireErrb, err := ioutil.ReadFile(filepath.Join(root, "want", "wire_errs.txt"))
+	wantWireError := err == nil
+	var wantWireErrorStrings []string
+	if wantWireError {
+		wantWireErrorStrings = strings.Split(string(wireErrb), "\n\n")
+	} else {
+		if !*record {
+			wantWireOutput, err = ioutil.ReadFile(filepath.Join(root, "want", "wire_gen.go"))
+			if err != nil {
+				return nil, fmt.Errorf("load test case %s: %v, if this is a new testcase, run with -record to generate the wire_gen.go file", name, err)
+			}
+			if emitManifest {
+				wantManifestOutput, err = ioutil.ReadFile(filepath.Join(root, "want", manifestFileName))
+				if err != nil {
+					return nil, fmt.Errorf("load test case %s: %v, if this is a new testcase, run with -record to generate the %s file", name, err, manifestFileName)
+				}
+			}
+		}
+		wantProgramOutput, err = ioutil.ReadFile(filepath.Join(root, "want", "program_out.txt"))
+		if err != nil {
+			return nil, fmt.Errorf("load test case %s: %v", name, err)
+		}
+	}
+	goFiles := map[string][]byte{
+		"github.com/google/wire/wire.go": wireGoSrc,
+	}
+	err = filepath.Walk(root, func(src string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, src)
+		if err != nil {
+			return err // unlikely
+		}
+		if info.Mode().IsDir() && rel == "want" {
+			// The "want" directory should not be included in goFiles.
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || filepath.Ext(src) != ".go" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		goFiles["example.com/"+filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load test case %s: %v", name, err)
+	}
+	return &testCase{
+		name:                 name,
+		pkg:                  string(bytes.TrimSpace(pkg)),
+		header:               header,
+		traceSpans:           traceSpans,
+		emitManifest:         emitManifest,
+		goFiles:              goFiles,
+		wantWireOutput:       wantWireOutput,
+		wantManifestOutput:   wantManifestOutput,
+		wantProgramOutput:    wantProgramOutput,
+		wantWireError:        wantWireError,
+		wantWireErrorStrings: wantWireErrorStrings,
+	}, nil
+}
+
+// setupGopath materializes test in a new temporary GOPATH, which the caller
+// removes, and returns it along with the example.com module in it, to be
+// used as the working directory, and the environment selecting it.
+func (test *testCase) setupGopath(t *testing.T) (gopath, wd string, env []string) {
+	t.Helper()
+	tmp, err := ioutil.TempDir("", "wire_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gopath, err = filepath.EvalSymlinks(tmp)
+	if err == nil {
+		err = test.materialize(gopath)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+	return gopath, filepath.Join(gopath, "src", "example.com"), append(os.Environ(), "GOPATH="+gopath)
+}
+
+// materialize creates a new GOPATH at the given directory, which may or
+// may not exist.
+func (test *testCase) materialize(gopath string) error {
+	for name, content := range test.goFiles {
+		dst := filepath.Join(gopath, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+			return fmt.Errorf("materialize GOPATH: %v", err)
+		}
+		if err := ioutil.WriteFile(dst, content, 0666); err != nil {
+			return fmt.Errorf("materialize GOPATH: %v", err)
+		}
+	}
+
+	// Add go.mod files to example.com and github.com/google/wire.
+	const importPath = "example.com"
+	const depPath = "github.com/google/wire"
+	depLoc := filepath.Join(gopath, "src", filepath.FromSlash(depPath))
+	example := fmt.Sprintf("module %s\n\nrequire %s v0.1.0\nreplace %s => %s\n", importPath, depPath, depPath, depLoc)
+	gomod := filepath.Join(gopath, "src", filepath.FromSlash(importPath), "go.mod")
+	if err := ioutil.WriteFile(gomod, []byte(example), 0666); err != nil {
+		return fmt.Errorf("generate go.mod for %s: %v", gomod, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(depLoc, "go.mod"), []byte("module "+depPath+"\n"), 0666); err != nil {
+		return fmt.Errorf("generate go.mod for %s: %v", depPath, err)
+	}
+	return nil
+}
+
+func TestGraphMissingProviders(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+type Config struct{}
+
+type DB struct{}
+
+type Server struct{}
+
+func NewDB(cfg *Config) *DB { return new(DB) }
+
+func NewServer(cfg *Config, db *DB) *Server { return new(Server) }
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import "github.com/google/wire"
+
+func initServer() *Server {
+	wire.Build(NewDB, NewServer)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	data, _, errs := Graph(context.Background(), wd, env, []string{"example.com/foo"}, "initServer", "", "cytospace", true, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) == 0 {
+		t.Fatal("Graph succeeded; want errors for the missing provider")
+	}
+	if data == "" {
+		t.Fatalf("Graph returned no graph; errors: %v", errs)
+	}
+	var elems CytospaceElements
+	if err := json.Unmarshal([]byte(data), &elems); err != nil {
+		t.Fatal(err)
+	}
+	const missing = "missing#*example.com/foo.Config"
+	var found bool
+	for _, n := range elems.Nodes {
+		if n.Data.Id == missing {
+			found = true
+			if !n.Data.Missing || n.Classes != "missing" {
+				t.Errorf("node %s is not marked missing: %+v", missing, n)
+			}
+		} else if n.Data.Missing {
+			t.Errorf("node %s is marked missing", n.Data.Id)
+		}
+	}
+	if !found {
+		t.Fatalf("no node %s in %s", missing, data)
+	}
+	var consumers []string
+	for _, e := range elems.Edges {
+		if e.Data.Target == missing {
+			consumers = append(consumers, e.Data.Source)
+		}
+	}
+	sort.Strings(consumers)
+	want := []string{"NewDB#example.com/foo", "NewServer#example.com/foo"}
+	if diff := cmp.Diff(want, consumers); diff != "" {
+		t.Errorf("consumers of %s diff (-want +got):\n%s", missing, diff)
+	}
+
+	// Other errors leave no graph.
+	data, _, errs = Graph(context.Background(), wd, env, []string{"example.com/foo"}, "initNothing", "", "cytospace", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) == 0 || data != "" {
+		t.Errorf("Graph of an unknown injector = %q, %v; want no graph and errors", data, errs)
+	}
+}
+
+func TestGraphCycles(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "github.com/google/wire"
+
+type A struct{}
+
+type B struct{}
+
+type C struct{}
+
+type App struct{}
+
+func NewA(b *B) *A { return new(A) }
+
+func NewB(c *C) *B { return new(B) }
+
+func NewC(a *A) *C { return new(C) }
+
+func NewApp(a *A) *App { return new(App) }
+
+var Set = wire.NewSet(NewA, NewB, NewC, NewApp)
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import "github.com/google/wire"
+
+func initApp() *App {
+	wire.Build(Set)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	// The set and the injector using it are drawn alike, with the cycle
+	// starting at the provider of the type that sorts first.
+	for _, name := range []string{"Set", "initApp"} {
+		data, _, errs := Graph(context.Background(), wd, env, []string{"example.com/foo"}, name, "", "cytospace", true, nil, nil, ClusterBySet, EdgeLabelsNone)
+		if len(errs) != 1 {
+			t.Fatalf("%s: got %d errors %v; want one for the cycle", name, len(errs), errs)
+		}
+		wantErr := `cycle 1 for *example.com/foo.A:
+*example.com/foo.A (example.com/foo.NewA) at $GOPATH/src/example.com/foo/foo.go:13:6 ->
+*example.com/foo.B (example.com/foo.NewB) at $GOPATH/src/example.com/foo/foo.go:15:6 ->
+*example.com/foo.C (example.com/foo.NewC) at $GOPATH/src/example.com/foo/foo.go:17:6 ->
+*example.com/foo.A`
+		if diff := cmp.Diff(wantErr, strings.Replace(errs[0].(*WireErr).Message(), gopath, "$GOPATH", -1)); diff != "" {
+			t.Errorf("%s: error diff (-want +got):\n%s", name, diff)
+		}
+		if data == "" {
+			t.Fatalf("%s: Graph returned no graph", name)
+		}
+		var elems CytospaceElements
+		if err := json.Unmarshal([]byte(data), &elems); err != nil {
+			t.Fatal(err)
+		}
+		var cycle []string
+		for _, n := range elems.Nodes {
+			if n.Data.Cycle {
+				cycle = append(cycle, n.Data.Id)
+			}
+		}
+		sort.Strings(cycle)
+		wantCycle := []string{"NewA#example.com/foo", "NewB#example.com/foo", "NewC#example.com/foo"}
+		if diff := cmp.Diff(wantCycle, cycle); diff != "" {
+			t.Errorf("%s: nodes on the cycle diff (-want +got):\n%s", name, diff)
+		}
+		labels := make(map[string]string)
+		for _, e := range elems.Edges {
+			labels[e.Data.Source+" -> "+e.Data.Target] = e.Data.Cycle
+		}
+		wantLabels := map[string]string{
+			"NewA#example.com/foo -> NewB#example.com/foo":   "cycle 1: 1/3",
+			"NewB#example.com/foo -> NewC#example.com/foo":   "cycle 1: 2/3",
+			"NewC#example.com/foo -> NewA#example.com/foo":   "cycle 1: 3/3",
+			"NewApp#example.com/foo -> NewA#example.com/foo": "",
+		}
+		if diff := cmp.Diff(wantLabels, labels); diff != "" {
+			t.Errorf("%s: edge labels diff (-want +got):\n%s", name, diff)
+		}
+	}
+
+	// The other formats label the edges alike.
+	for _, format := range []string{"graphviz", "d2"} {
+		data, _, _ := Graph(context.Background(), wd, env, []string{"example.com/foo"}, "Set", "", format, false, nil, nil, ClusterBySet, EdgeLabelsNone)
+		if n := strings.Count(data, "cycle 1: "); n != 3 {
+			t.Errorf("%s output labels %d edges with the cycle; want 3:\n%s", format, n, data)
+		}
+		if !strings.Contains(data, "magenta") {
+			t.Errorf("%s output does not highlight the cycle:\n%s", format, data)
+		}
+	}
+}
+
+func TestGraphJSON(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/db/db.go": []byte(`package db
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type DB struct{}
+
+func NewDB(c *Config) *DB { return new(DB) }
+
+var Set = wire.NewSet(NewDB)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+type App struct {
+	DB   *db.DB
+	Name string
+}
+
+var Set = wire.NewSet(db.Set, wire.Struct(new(App), "DB", "Name"), wire.Value("app"))
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+func initApp(cfg *db.Config) *App {
+	wire.Build(Set)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	data, _, errs := Graph(context.Background(), wd, env, []string{"example.com/foo"}, "initApp", "", "json", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var g JSONGraph
+	if err := json.Unmarshal([]byte(data), &g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Version != GraphSchemaVersion || g.Kind != "injector" || g.Name != "initApp" || g.Package != "example.com/foo" {
+		t.Errorf("got graph %d %s %s#%s; want %d injector initApp#example.com/foo", g.Version, g.Kind, g.Name, g.Package, GraphSchemaVersion)
+	}
+	// Positions are compared by their base name and line.
+	var nodes []string
+	for _, n := range g.Nodes {
+		node := fmt.Sprintf("%s %s provider=%q package=%q expr=%q param=%q set=%q root=%t", n.Kind, n.Type, n.Provider, n.Package, n.Expr, n.Param, n.Set, n.Root)
+		if n.Position != nil {
+			node += fmt.Sprintf(" at %s:%d", filepath.Base(n.Position.File), n.Position.Line)
+		}
+		nodes = append(nodes, node)
+	}
+	wantNodes := []string{
+		`input *example.com/foo/db.Config provider="" package="" expr="" param="cfg" set="" root=false`,
+		`function *example.com/foo/db.DB provider="NewDB" package="example.com/foo/db" expr="" param="" set="Set#example.com/foo/db" root=false at db.go:9`,
+		`value string provider="" package="" expr="\"app\"" param="" set="Set#example.com/foo" root=false at foo.go:13`,
+		`struct *example.com/foo.App provider="App" package="example.com/foo" expr="" param="" set="Set#example.com/foo" root=true at foo.go:8`,
+	}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes diff (-want +got):\n%s", diff)
+	}
+	wantEdges := []JSONEdge{
+		{Source: "NewDB#example.com/foo/db", Target: "cfg#*example.com/foo/db.Config", Role: JSONEdgeArgument, Index: 0, Param: "c"},
+		{Source: "App#example.com/foo", Target: "NewDB#example.com/foo/db", Role: JSONEdgeField, Index: 0, Field: "DB"},
+		{Source: "App#example.com/foo", Target: `"app"#string`, Role: JSONEdgeField, Index: 1, Field: "Name"},
+	}
+	if diff := cmp.Diff(wantEdges, g.Edges); diff != "" {
+		t.Errorf("edges diff (-want +got):\n%s", diff)
+	}
+	// The set of package db is nested in that of package foo.
+	wantSets := []JSONSet{
+		{ID: "Set#example.com/foo", Name: "Set", Package: "example.com/foo"},
+		{ID: "Set#example.com/foo/db", Name: "Set", Package: "example.com/foo/db", Parent: "Set#example.com/foo"},
+	}
+	if diff := cmp.Diff(wantSets, g.Sets); diff != "" {
+		t.Errorf("sets diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestGraphClusterByPackage(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/db/db.go": []byte(`package db
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type DB struct{}
+
+func NewDB(c *Config) *DB { return new(DB) }
+
+var Set = wire.NewSet(NewDB)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+type App struct {
+	DB   *db.DB
+	Name string
+}
+
+var Set = wire.NewSet(db.Set, wire.Struct(new(App), "DB", "Name"), wire.Value("app"))
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+func initApp(cfg *db.Config) *App {
+	wire.Build(Set)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	tests := []struct {
+		cluster GraphCluster
+		// want maps the providers to their parents, and the clusters to
+		// theirs, or to "" at the top level.
+		want map[string]string
+	}{
+		{
+			cluster: ClusterBySet,
+			want: map[string]string{
+				"Set#example.com/foo":      "",
+				"Set#example.com/foo/db":   "Set#example.com/foo",
+				"NewDB#example.com/foo/db": "Set#example.com/foo/db",
+				"App#example.com/foo":      "Set#example.com/foo",
+				`"app"#string`:             "Set#example.com/foo",
+			},
+		},
+		{
+			// The packages are not nested, and the value belongs to the
+			// package of its set.
+			cluster: ClusterByPackage,
+			want: map[string]string{
+				"example.com/foo":          "",
+				"example.com/foo/db":       "",
+				"NewDB#example.com/foo/db": "example.com/foo/db",
+				"App#example.com/foo":      "example.com/foo",
+				`"app"#string`:             "example.com/foo",
+			},
+		},
+	}
+	for _, test := range tests {
+		data, _, errs := Graph(context.Background(), wd, env, []string{"example.com/foo"}, "initApp", "", "cytospace", false, nil, nil, test.cluster, EdgeLabelsNone)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		var elems CytospaceElements
+		if err := json.Unmarshal([]byte(data), &elems); err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, n := range elems.Nodes {
+			// Inputs are never clustered.
+			if strings.HasPrefix(n.Data.Id, "cfg#") {
+				continue
+			}
+			got[n.Data.Id] = ""
+			if n.Data.Parent != nil {
+				got[n.Data.Id] = *n.Data.Parent
+			}
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("%s: parents diff (-want +got):\n%s", test.cluster, diff)
+		}
+	}
+}
+
+func TestGraphCollapse(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/db/db.go": []byte(`package db
+
+import "github.com/google/wire"
+
+type DSN string
+
+type Config struct{}
+
+type DB struct{}
+
+func NewConfig(dsn DSN) *Config { return new(Config) }
+
+func NewDB(c *Config) *DB { return new(DB) }
+
+var Set = wire.NewSet(NewConfig, NewDB)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+type Logger struct{}
+
+type App struct{}
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewApp(d *db.DB, l *Logger) *App { return new(App) }
+
+var Set = wire.NewSet(db.Set, NewLogger, NewApp)
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import (
+	"example.com/foo/db"
+	"github.com/google/wire"
+)
+
+func initApp(dsn db.DSN) *App {
+	wire.Build(Set)
+	return nil
+}
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		collapse []string
+		nodes    []string
+		edges    []string
+	}{
+		{
+			name:     "Qualified",
+			collapse: []string{"example.com/foo/db.Set"},
+			nodes: []string{
+				"NewApp example.com/foo",
+				"NewLogger example.com/foo",
+				"Set example.com/foo/db 2 providers, 1 input, 1 output",
+				"dsn example.com/foo/db.DSN",
+			},
+			edges: []string{
+				"NewApp example.com/foo->NewLogger example.com/foo",
+				"NewApp example.com/foo->Set example.com/foo/db 2 providers, 1 input, 1 output",
+				"Set example.com/foo/db 2 providers, 1 input, 1 output->dsn example.com/foo/db.DSN",
+			},
+		},
+		{
+			// Both sets are named Set, and the outer one summarizes the
+			// providers of the inner one, but not the root output.
+			name:     "Nested",
+			collapse: []string{"Set"},
+			nodes: []string{
+				"NewApp example.com/foo",
+				"Set example.com/foo 3 providers, 1 input, 2 outputs",
+				"dsn example.com/foo/db.DSN",
+			},
+			edges: []string{
+				"NewApp example.com/foo->Set example.com/foo 3 providers, 1 input, 2 outputs",
+				"Set example.com/foo 3 providers, 1 input, 2 outputs->dsn example.com/foo/db.DSN",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter := &GraphFilter{Collapse: test.collapse}
+			data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "initApp", "", "cytospace", false, nil, filter, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var elems CytospaceElements
+			if err := json.Unmarshal([]byte(data), &elems); err != nil {
+				t.Fatal(err)
+			}
+			names := make(map[string]string)
+			var gotNodes []string
+			for _, n := range elems.Nodes {
+				if n.Data.Subgraph {
+					continue
+				}
+				name := strings.Replace(n.Data.Content, "\n", " ", -1)
+				names[n.Data.Id] = name
+				gotNodes = append(gotNodes, name)
+			}
+			var gotEdges []string
+			for _, e := range elems.Edges {
+				gotEdges = append(gotEdges, names[e.Data.Source]+"->"+names[e.Data.Target])
+			}
+			sort.Strings(gotNodes)
+			sort.Strings(gotEdges)
+			if diff := cmp.Diff(test.nodes, gotNodes); diff != "" {
+				t.Errorf("nodes diff (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(test.edges, gotEdges); diff != "" {
+				t.Errorf("edges diff (-want +got):\n%s", diff)
+			}
+
+			// The graphviz output draws the same summary node.
+			data, _, errs = Graph(ctx, wd, env, []string{"example.com/foo"}, "initApp", "", "graphviz", false, nil, filter, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			if _, err := gographviz.Read([]byte(data)); err != nil {
+				t.Errorf("invalid graphviz output: %v\n%s", err, data)
+			}
+			if !strings.Contains(data, "providers, 1 input") {
+				t.Errorf("graphviz output has no summary node:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestGraphEdgeLabels(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+type Logger struct{}
+
+type DB struct{}
+
+type App struct {
+	DB *DB
+}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewDB(_ *Logger, cfg *Config) *DB { return new(DB) }
+
+var Set = wire.NewSet(NewConfig, NewLogger, NewDB, wire.Struct(new(App), "DB"))
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		labels GraphEdgeLabels
+		filter *GraphFilter
+		// want maps the edges, by the names of their ends, to their labels.
+		want map[string]string
+	}{
+		{
+			name:   "None",
+			labels: EdgeLabelsNone,
+			want: map[string]string{
+				"NewDB->NewConfig": "",
+				"NewDB->NewLogger": "",
+				"App->NewDB":       "",
+			},
+		},
+		{
+			// The unnamed parameter is not labeled.
+			name:   "Param",
+			labels: EdgeLabelsParam,
+			want: map[string]string{
+				"NewDB->NewConfig": "param: cfg",
+				"NewDB->NewLogger": "",
+				"App->NewDB":       "field: DB",
+			},
+		},
+		{
+			name:   "Position",
+			labels: EdgeLabelsPosition,
+			want: map[string]string{
+				"NewDB->NewConfig": "param 2: cfg",
+				"NewDB->NewLogger": "param 1",
+				"App->NewDB":       "field 1: DB",
+			},
+		},
+		{
+			// The positions are those in the signature, whatever is drawn.
+			name:   "Filtered",
+			labels: EdgeLabelsPosition,
+			filter: &GraphFilter{Exclude: regexp.MustCompile(`NewLogger$`)},
+			want: map[string]string{
+				"NewDB->NewConfig": "param 2: cfg",
+				"App->NewDB":       "field 1: DB",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "Set", "", "cytospace", false, nil, test.filter, ClusterBySet, test.labels)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var elems CytospaceElements
+			if err := json.Unmarshal([]byte(data), &elems); err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, e := range elems.Edges {
+				from := strings.Split(e.Data.Source, "#")[0]
+				to := strings.Split(e.Data.Target, "#")[0]
+				got[from+"->"+to] = e.Data.Label
+			}
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("labels diff (-want +got):\n%s", diff)
+			}
+
+			// The graphviz and D2 outputs carry the same labels.
+			for _, format := range []string{"graphviz", "d2"} {
+				data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "Set", "", format, false, nil, test.filter, ClusterBySet, test.labels)
+				if len(errs) > 0 {
+					t.Fatal(errs)
+				}
+				for _, label := range test.want {
+					if label != "" && !strings.Contains(data, `label: "`+label+`"`) && !strings.Contains(data, `label="`+label+`"`) {
+						t.Errorf("%s output has no label %q:\n%s", format, label, data)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGraphTooltips(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+import "github.com/google/wire"
+
+type Config struct{}
+
+// DB is a database. It is shared.
+type DB struct{}
+
+type (
+	// App serves requests.
+	App struct {
+		DB *DB
+	}
+)
+
+func NewConfig() *Config { return new(Config) }
+
+// NewDB opens the "main" database. It retries on failure.
+//
+//wire:cost heavy
+func NewDB(cfg *Config) *DB { return new(DB) }
+
+var Set = wire.NewSet(NewConfig, NewDB, wire.Struct(new(App), "DB"))
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	file := filepath.Join(gopath, "src", "example.com", "foo", "foo.go")
 
-		// Write out file name and advance scrub position.
-		file := s[fileStart:fileEnd]
-		if os.PathSeparator != '/' {
-			file = strings.Replace(file, string(os.PathSeparator), "/", -1)
+	data, _, errs := Graph(ctx, wd, env, []string{"example.com/foo"}, "Set", "", "cytospace", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var elems CytospaceElements
+	if err := json.Unmarshal([]byte(data), &elems); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, n := range elems.Nodes {
+		if !n.Data.Subgraph {
+			got[strings.Split(n.Data.Id, "#")[0]] = n.Data.Tooltip
 		}
-		sb.WriteString(s[:start])
-		sb.WriteString(file)
-		s = s[fileEnd:]
-
-		// Peek past to see if there is line/column info.
-		linecol, linecolLen := scrubLineColumn(s)
-		sb.WriteString(linecol)
-		s = s[linecolLen:]
 	}
-	return sb.String()
-}
+	want := map[string]string{
+		"NewConfig": file + ":17:6",
+		"NewDB":     file + ":22:6\nNewDB opens the \"main\" database.",
+		"App":       file + ":12:2\nApp serves requests.",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("tooltips diff (-want +got):\n%s", diff)
+	}
 
-func scrubLineColumn(s string) (replacement string, n int) {
-	if !strings.HasPrefix(s, ":") {
-		return "", 0
+	// The graphviz output escapes the tooltips and links the nodes to their
+	// file.
+	data, _, errs = Graph(ctx, wd, env, []string{"example.com/foo"}, "Set", "", "graphviz", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
 	}
-	// Skip first colon and run of digits.
-	for n++; len(s) > n && '0' <= s[n] && s[n] <= '9'; {
-		n++
+	if _, err := gographviz.Read([]byte(data)); err != nil {
+		t.Errorf("invalid graphviz output: %v\n%s", err, data)
 	}
-	if n == 1 {
-		// No digits followed colon.
-		return "", 0
+	if want := "tooltip=\"" + file + ":22:6\nNewDB opens the \\\"main\\\" database.\""; !strings.Contains(data, want) {
+		t.Errorf("graphviz output does not contain %s:\n%s", want, data)
+	}
+	if got, want := strings.Count(data, `URL="file://`), 3; got != want {
+		t.Errorf("graphviz output has %d URLs; want %d:\n%s", got, want, data)
 	}
 
-	// Start on column part.
-	if !strings.HasPrefix(s[n:], ":") {
-		return ":x", n
+	// The json output carries the doc sentences.
+	data, _, errs = Graph(ctx, wd, env, []string{"example.com/foo"}, "Set", "", "json", false, nil, nil, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
 	}
-	lineEnd := n
-	// Skip second colon and run of digits.
-	for n++; len(s) > n && '0' <= s[n] && s[n] <= '9'; {
-		n++
+	var graph JSONGraph
+	if err := json.Unmarshal([]byte(data), &graph); err != nil {
+		t.Fatal(err)
 	}
-	if n == lineEnd+1 {
-		// No digits followed second colon.
-		return ":x", lineEnd
+	docs := make(map[string]string)
+	for _, n := range graph.Nodes {
+		if n.Doc != "" {
+			docs[n.Provider] = n.Doc
+		}
+	}
+	wantDocs := map[string]string{
+		"NewDB": "NewDB opens the \"main\" database.",
+		"App":   "App serves requests.",
+	}
+	if diff := cmp.Diff(wantDocs, docs); diff != "" {
+		t.Errorf("docs diff (-want +got):\n%s", diff)
 	}
-	return ":x:y", n
 }
 
-type testCase struct {
-	name                 string
-	pkg                  string
-	header               []byte
-	goFiles              map[string][]byte
-	wantProgramOutput    []byte
-	wantWireOutput       []byte
-	wantWireError        bool
-	wantWireErrorStrings []string
+func TestGraphSets(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/bar/bar.go": []byte(`package bar
+
+import "github.com/google/wire"
+
+type DB struct{}
+
+func NewDB() *DB { return new(DB) }
+
+var DBSet = wire.NewSet(NewDB)
+
+var Set = wire.NewSet(DBSet)
+`),
+			"example.com/foo/foo.go": []byte(`package foo
+
+import (
+	"example.com/bar"
+	"github.com/google/wire"
+)
+
+type Config struct{}
+
+type App struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewApp(*Config, *bar.DB) *App { return new(App) }
+
+var ConfigSet = wire.NewSet(NewConfig)
+
+var AppSet = wire.NewSet(NewApp, wire.NewSet(ConfigSet, bar.Set))
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import "github.com/google/wire"
+
+func initApp() *App {
+	wire.Build(AppSet)
+	return nil
 }
+`),
+		},
+	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
 
-// loadTestCase reads a test case from a directory.
-//
-// The directory structure is:
-//
-//	root/
-//
-//		pkg
-//			file containing the package name containing the inject function
-//			(must also be package main)
-//
-//		...
-//			any Go files found recursively placed under GOPATH/src/...
-//
-//		want/
-//
-//			wire_errs.txt
-//					Expected errors from the Wire Generate function,
-//					missing if no errors expected.
-//					Distinct errors are separated by a blank line,
-//					and line numbers and line positions are scrubbed
-//					(e.g. "$GOPATH/src/foo.go:52:8" --> "foo.go:x:y").
-//
-//			wire_gen.go
-//					verified output of wire from a test run with
-//					-record, missing if wire_errs.txt is present
-//
-//			program_out.txt
-//					expected output from the final compiled program,
-//					missing if wire_errs.txt is present
-//
-func loadTestCase(root string, wireGoSrc []byte) (*testCase, error) {
-	name := filepath.Base(root)
-	pkg, err := ioutil.ReadFile(filepath.Join(root, "pkg"))
-	if err != nil {
-		return nil, fmt.Errorf("load test case %s: %v", name, err)
+	// The sets of example.com/bar are drawn as imported: bar.DBSet is only
+	// imported by bar.Set, which is not drawn.
+	data, errs := GraphSets(ctx, wd, env, []string{"example.com/foo"}, "", "json")
+	if len(errs) > 0 {
+		t.Fatal(errs)
 	}
-	header, _ := ioutil.ReadFile(filepath.Join(root, "header"))
-	var wantProgramOutput []byte
-	var wantWireOutput []byte
-	wireErrb, err := ioutil.ReadFile(filepath.Join(root, "want", "wire_errs.txt"))
-	wantWireError := err == nil
-	var wantWireErrorStrings []string
-	if wantWireError {
-		wantWireErrorStrings = strings.Split(string(wireErrb), "\n\n")
-	} else {
-		if !*record {
-			wantWireOutput, err = ioutil.ReadFile(filepath.Join(root, "want", "wire_gen.go"))
-			if err != nil {
-				return nil, fmt.Errorf("load test case %s: %v, if this is a new testcase, run with -record to generate the wire_gen.go file", name, err)
-			}
-		}
-		wantProgramOutput, err = ioutil.ReadFile(filepath.Join(root, "want", "program_out.txt"))
-		if err != nil {
-			return nil, fmt.Errorf("load test case %s: %v", name, err)
-		}
+	var graph JSONGraph
+	if err := json.Unmarshal([]byte(data), &graph); err != nil {
+		t.Fatal(err)
 	}
-	goFiles := map[string][]byte{
-		"github.com/google/wire/wire.go": wireGoSrc,
+	var nodes, edges []string
+	for _, n := range graph.Nodes {
+		nodes = append(nodes, fmt.Sprintf("%s %s external=%t", n.Kind, n.ID, n.External))
 	}
-	err = filepath.Walk(root, func(src string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		rel, err := filepath.Rel(root, src)
-		if err != nil {
-			return err // unlikely
+	for _, e := range graph.Edges {
+		edges = append(edges, e.Source+" -> "+e.Target)
+	}
+	wantNodes := []string{
+		"set Set#example.com/bar external=true",
+		"set AppSet#example.com/foo external=false",
+		"set ConfigSet#example.com/foo external=false",
+		"injector initApp#example.com/foo external=false",
+	}
+	wantEdges := []string{
+		"AppSet#example.com/foo -> ConfigSet#example.com/foo",
+		"AppSet#example.com/foo -> Set#example.com/bar",
+		"initApp#example.com/foo -> AppSet#example.com/foo",
+	}
+	if diff := cmp.Diff(wantNodes, nodes); diff != "" {
+		t.Errorf("nodes diff (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantEdges, edges); diff != "" {
+		t.Errorf("edges diff (-want +got):\n%s", diff)
+	}
+
+	// With both packages, bar.DBSet is drawn with the import of bar.Set.
+	data, errs = GraphSets(ctx, wd, env, []string{"example.com/..."}, "", "cytospace")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var elems CytospaceElements
+	if err := json.Unmarshal([]byte(data), &elems); err != nil {
+		t.Fatal(err)
+	}
+	parents := make(map[string]string)
+	for _, n := range elems.Nodes {
+		if n.Data.Parent != nil {
+			parents[n.Data.Id] = *n.Data.Parent
 		}
-		if info.Mode().IsDir() && rel == "want" {
-			// The "want" directory should not be included in goFiles.
-			return filepath.SkipDir
+	}
+	wantParents := map[string]string{
+		"DBSet#example.com/bar":     "example.com/bar",
+		"Set#example.com/bar":       "example.com/bar",
+		"AppSet#example.com/foo":    "example.com/foo",
+		"ConfigSet#example.com/foo": "example.com/foo",
+		"initApp#example.com/foo":   "example.com/foo",
+	}
+	if diff := cmp.Diff(wantParents, parents); diff != "" {
+		t.Errorf("parents diff (-want +got):\n%s", diff)
+	}
+	if got, want := len(elems.Edges), 4; got != want {
+		t.Errorf("got %d edges; want %d:\n%s", got, want, data)
+	}
+
+	for _, format := range []string{"graphviz", "d2"} {
+		data, errs := GraphSets(ctx, wd, env, []string{"example.com/..."}, "", format)
+		if len(errs) > 0 {
+			t.Fatal(errs)
 		}
-		if !info.Mode().IsRegular() || filepath.Ext(src) != ".go" {
-			return nil
+		if format == "graphviz" {
+			if _, err := gographviz.Read([]byte(data)); err != nil {
+				t.Errorf("invalid graphviz output: %v\n%s", err, data)
+			}
 		}
-		data, err := ioutil.ReadFile(src)
-		if err != nil {
-			return err
+		if got, want := strings.Count(data, "->"), 4; got != want {
+			t.Errorf("%s output has %d edges; want %d:\n%s", format, got, want, data)
 		}
-		goFiles["example.com/"+filepath.ToSlash(rel)] = data
-		return nil
-	})
+	}
+}
+
+func TestGraphReverse(t *testing.T) {
+	wireGo, err := ioutil.ReadFile(filepath.Join("..", "..", "wire.go"))
 	if err != nil {
-		return nil, fmt.Errorf("load test case %s: %v", name, err)
+		t.Fatal(err)
 	}
-	return &testCase{
-		name:                 name,
-		pkg:                  string(bytes.TrimSpace(pkg)),
-		header:               header,
-		goFiles:              goFiles,
-		wantWireOutput:       wantWireOutput,
-		wantProgramOutput:    wantProgramOutput,
-		wantWireError:        wantWireError,
-		wantWireErrorStrings: wantWireErrorStrings,
-	}, nil
+	test := &testCase{
+		goFiles: map[string][]byte{
+			"github.com/google/wire/wire.go": wireGo,
+			"example.com/foo/foo.go": []byte(`package foo
+
+type Config struct{}
+
+type DB struct{}
+
+type Store struct{}
+
+type Logger struct{}
+
+type Cache struct{}
+
+type App struct{}
+
+func NewConfig() *Config { return new(Config) }
+
+func NewDB(*Config) *DB { return new(DB) }
+
+func NewStore(*DB) *Store { return new(Store) }
+
+func NewLogger() *Logger { return new(Logger) }
+
+func NewCache(*Config) *Cache { return new(Cache) }
+
+func NewApp(*Store, *Logger, *Cache) *App { return new(App) }
+`),
+			"example.com/foo/wire.go": []byte(`//+build wireinject
+
+package foo
+
+import "github.com/google/wire"
+
+func initApp() *App {
+	wire.Build(NewConfig, NewDB, NewStore, NewLogger, NewCache, NewApp)
+	return nil
 }
 
-// materialize creates a new GOPATH at the given directory, which may or
-// may not exist.
-func (test *testCase) materialize(gopath string) error {
-	for name, content := range test.goFiles {
-		dst := filepath.Join(gopath, "src", filepath.FromSlash(name))
-		if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
-			return fmt.Errorf("materialize GOPATH: %v", err)
-		}
-		if err := ioutil.WriteFile(dst, content, 0666); err != nil {
-			return fmt.Errorf("materialize GOPATH: %v", err)
-		}
+func initCache() *Cache {
+	wire.Build(NewConfig, NewCache)
+	return nil
+}
+`),
+		},
 	}
+	gopath, wd, env := test.setupGopath(t)
+	defer os.RemoveAll(gopath)
+	ctx := context.Background()
+	pattern := []string{"example.com/foo"}
 
-	// Add go.mod files to example.com and github.com/google/wire.
-	const importPath = "example.com"
-	const depPath = "github.com/google/wire"
-	depLoc := filepath.Join(gopath, "src", filepath.FromSlash(depPath))
-	example := fmt.Sprintf("module %s\n\nrequire %s v0.1.0\nreplace %s => %s\n", importPath, depPath, depPath, depLoc)
-	gomod := filepath.Join(gopath, "src", filepath.FromSlash(importPath), "go.mod")
-	if err := ioutil.WriteFile(gomod, []byte(example), 0666); err != nil {
-		return fmt.Errorf("generate go.mod for %s: %v", gomod, err)
+	tests := []struct {
+		name   string
+		filter *GraphFilter
+		want   []string
+	}{
+		{
+			// The dependencies of the dependents are left out, and so is
+			// the rest of the graph.
+			name:   "Reverse",
+			filter: &GraphFilter{Reverse: "*example.com/foo.DB"},
+			want: []string{
+				"NewApp#example.com/foo -> NewStore#example.com/foo",
+				"NewDB#example.com/foo",
+				"NewStore#example.com/foo -> NewDB#example.com/foo",
+			},
+		},
+		{
+			// NewDB is summarized, as it is hidden by Depth.
+			name:   "Depth",
+			filter: &GraphFilter{Reverse: "*example.com/foo.DB", Depth: 1},
+			want: []string{
+				"NewApp#example.com/foo -> NewStore#example.com/foo",
+				"NewStore#example.com/foo -> collapsed-1",
+			},
+		},
 	}
-	if err := ioutil.WriteFile(filepath.Join(depLoc, "go.mod"), []byte("module "+depPath+"\n"), 0666); err != nil {
-		return fmt.Errorf("generate go.mod for %s: %v", depPath, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _, errs := Graph(ctx, wd, env, pattern, "initApp", "", "json", false, nil, test.filter, ClusterBySet, EdgeLabelsNone)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			var graph JSONGraph
+			if err := json.Unmarshal([]byte(data), &graph); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			targets := make(map[string]bool)
+			for _, e := range graph.Edges {
+				got = append(got, e.Source+" -> "+e.Target)
+				targets[e.Source] = true
+			}
+			for _, n := range graph.Nodes {
+				if !targets[n.ID] && n.Kind != JSONNodeCollapsed {
+					got = append(got, n.ID)
+				}
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("graph diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// An injector not depending on the type is not drawn.
+	_, _, errs := Graph(ctx, wd, env, pattern, "initCache", "", "json", false, nil, &GraphFilter{Reverse: "*example.com/foo.DB"}, ClusterBySet, EdgeLabelsNone)
+	if want := "initCache does not depend on *example.com/foo.DB"; len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v; want %q", errs, want)
+	}
+
+	// Across the injectors, only those depending on the type are drawn.
+	graphs, errs := GraphAll(ctx, wd, env, pattern, "", "json", false, &GraphFilter{Reverse: "*example.com/foo.Config"}, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	var names []string
+	for _, g := range graphs {
+		names = append(names, g.Decl.Name)
+	}
+	if diff := cmp.Diff([]string{"initApp", "initCache"}, names); diff != "" {
+		t.Errorf("graphs diff (-want +got):\n%s", diff)
+	}
+	graphs, errs = GraphAll(ctx, wd, env, pattern, "", "json", false, &GraphFilter{Reverse: "*example.com/foo.DB"}, ClusterBySet, EdgeLabelsNone)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if len(graphs) != 1 || graphs[0].Decl.Name != "initApp" {
+		t.Errorf("got %d graphs; want the graph of initApp", len(graphs))
+	}
+	_, errs = GraphAll(ctx, wd, env, pattern, "", "json", false, &GraphFilter{Reverse: "*example.com/foo.Unknown"}, ClusterBySet, EdgeLabelsNone)
+	if want := "no injector depends on *example.com/foo.Unknown"; len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("got errors %v; want %q", errs, want)
+	}
+}
+
+func TestFileURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/home/me/app/main.go", want: "file:///home/me/app/main.go"},
+		{path: "C:/app/main.go", want: "file:///C:/app/main.go"},
+		{path: "//server/share/app/main.go", want: "file://server/share/app/main.go"},
+		{path: "main.go", want: "file:///main.go"},
+		{path: "/tmp/my app/main.go", want: "file:///tmp/my%20app/main.go"},
+	}
+	for _, test := range tests {
+		if got := fileURL(test.path); got != test.want {
+			t.Errorf("fileURL(%q) = %q; want %q", test.path, got, test.want)
+		}
 	}
-	return nil
 }
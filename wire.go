@@ -30,8 +30,8 @@ type ProviderSet struct{}
 
 // NewSet creates a new provider set that includes the providers in its
 // arguments. Each argument is a function value, a provider set, a call to
-// Struct, a call to Bind, a call to Value, a call to InterfaceValue or a call
-// to FieldsOf.
+// Struct, a call to Bind, a call to Value, a call to InterfaceValue, a call
+// to FieldsOf, a call to Requires or a call to Optional.
 //
 // Passing a function value to NewSet declares that the function's first
 // return value type will be provided by calling the function. The arguments
@@ -194,3 +194,94 @@ type StructFields struct{}
 func FieldsOf(structType interface{}, fieldNames ...string) StructFields {
 	return StructFields{}
 }
+
+// SplicedProviders is a marker type for the result of Splice.
+type SplicedProviders struct{}
+
+// Splice expands the elements of a slice or array of providers into the
+// enclosing call to NewSet or Build, as if they had been written inline.
+// This allows grouping providers for readability.
+//
+// The argument must be a package-level variable declared in the same package
+// as the call to Splice, initialized with a slice or array literal, and never
+// assigned to afterwards, so that its elements can be determined statically.
+// Each element may be anything that can be passed to NewSet.
+//
+// Example:
+//
+//	var storageProviders = []interface{}{NewDB, NewCache}
+//
+//	var Set = wire.NewSet(wire.Splice(storageProviders), NewServer)
+func Splice(providers interface{}) SplicedProviders {
+	return SplicedProviders{}
+}
+
+// RequiredInputs is a marker type for the result of Requires.
+type RequiredInputs struct{}
+
+// Requires declares the inputs of the enclosing provider set: the types
+// that the set needs but does not provide, and that an injector using the
+// set must therefore get from elsewhere. Each argument is a pointer to a
+// required type, as returned by new.
+//
+// Wire reports an error if the set needs a type that is not declared, or
+// if a declared type is provided by the set or not needed at all, so the
+// declaration stays in sync with the providers. Requires may only be passed
+// to NewSet.
+//
+// Example:
+//
+//	var ServerSet = wire.NewSet(
+//		wire.Requires(new(*Config), new(context.Context)),
+//		NewServer,
+//	)
+func Requires(inputs ...interface{}) RequiredInputs {
+	return RequiredInputs{}
+}
+
+// OptionalTypes is a marker type for the result of Optional.
+type OptionalTypes struct{}
+
+// Optional marks types as optional dependencies in the enclosing provider
+// set or injector. Each argument is a pointer to an optional type, as
+// returned by new.
+//
+// An optional type may be provided by a conditional provider: a function
+// returning the type and a bool reporting whether it was found, optionally
+// with a cleanup function in between, i.e. (T, bool) or (T, func(), bool).
+// When the bool is false, the injector uses the zero value of T instead and
+// does not call the cleanup function. Wire reports an error if a
+// conditional provider provides a type that is not optional; return
+// (T, error) instead to fail when the value is not found.
+//
+// Example:
+//
+//	func LookupCache(cfg *Config) (*Cache, bool) { /* ... */ }
+//
+//	var Set = wire.NewSet(wire.Optional(new(*Cache)), LookupCache, NewServer)
+func Optional(optional ...interface{}) OptionalTypes {
+	return OptionalTypes{}
+}
+
+// TraceHooks observes the provider calls of injectors generated with the
+// -trace-spans option, for example to record each call as a span.
+//
+// If the provider set of an injector provides TraceHooks, the generated
+// injector obtains it first and calls Before and After around each call to a
+// provider function. name is the identifier of the provider, its import path
+// and name separated by a dot, and err is the error the provider returned,
+// if any. The hooks do not affect the calls: errors are still returned and
+// cleanup functions still run as without the option.
+//
+// Example:
+//
+//	func NewHooks(tracer *Tracer) wire.TraceHooks { /* ... */ }
+//
+//	func initApp() (*App, error) {
+//		wire.Build(NewTracer, NewHooks, NewDB, NewApp)
+//		return nil, nil
+//	}
+type TraceHooks interface {
+	Before(name string)
+	After(name string, err error)
+}